@@ -0,0 +1,585 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: api/loki/v1/loki.proto
+
+package lokiv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Connection selects the Loki server. Credentials are taken from the configured datasource or
+// environment, or from the metadata of the call when header forwarding is configured.
+type Connection struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Named datasource from LOKI_DATASOURCES_FILE (default: LOKI_URL)
+	Datasource string `protobuf:"bytes,1,opt,name=datasource,proto3" json:"datasource,omitempty"`
+	// Tenant sent in the X-Scope-OrgID header (default: LOKI_ORG_ID)
+	Org           string `protobuf:"bytes,2,opt,name=org,proto3" json:"org,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_api_loki_v1_loki_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_api_loki_v1_loki_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_api_loki_v1_loki_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Connection) GetDatasource() string {
+	if x != nil {
+		return x.Datasource
+	}
+	return ""
+}
+
+func (x *Connection) GetOrg() string {
+	if x != nil {
+		return x.Org
+	}
+	return ""
+}
+
+type QueryRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Connection *Connection            `protobuf:"bytes,1,opt,name=connection,proto3" json:"connection,omitempty"`
+	// LogQL query
+	Query string `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	// Start and end of the time range, as accepted by loki_query (default: the last hour)
+	Start string `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	End   string `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`
+	// Maximum number of entries to return (default: 100)
+	Limit int32 `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Output format: raw, json, text, ndjson, logfmt or html (default: raw)
+	Format string `protobuf:"bytes,6,opt,name=format,proto3" json:"format,omitempty"`
+	// Any other loki_query argument, e.g. parse, fields or strip_ansi
+	Options       map[string]string `protobuf:"bytes,7,rep,name=options,proto3" json:"options,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_api_loki_v1_loki_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_loki_v1_loki_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_api_loki_v1_loki_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QueryRequest) GetConnection() *Connection {
+	if x != nil {
+		return x.Connection
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetOptions() map[string]string {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type LabelsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connection    *Connection            `protobuf:"bytes,1,opt,name=connection,proto3" json:"connection,omitempty"`
+	Start         string                 `protobuf:"bytes,2,opt,name=start,proto3" json:"start,omitempty"`
+	End           string                 `protobuf:"bytes,3,opt,name=end,proto3" json:"end,omitempty"`
+	Format        string                 `protobuf:"bytes,4,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LabelsRequest) Reset() {
+	*x = LabelsRequest{}
+	mi := &file_api_loki_v1_loki_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LabelsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LabelsRequest) ProtoMessage() {}
+
+func (x *LabelsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_loki_v1_loki_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LabelsRequest.ProtoReflect.Descriptor instead.
+func (*LabelsRequest) Descriptor() ([]byte, []int) {
+	return file_api_loki_v1_loki_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LabelsRequest) GetConnection() *Connection {
+	if x != nil {
+		return x.Connection
+	}
+	return nil
+}
+
+func (x *LabelsRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *LabelsRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *LabelsRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type LabelValuesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connection    *Connection            `protobuf:"bytes,1,opt,name=connection,proto3" json:"connection,omitempty"`
+	Label         string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Start         string                 `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	End           string                 `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`
+	Format        string                 `protobuf:"bytes,5,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LabelValuesRequest) Reset() {
+	*x = LabelValuesRequest{}
+	mi := &file_api_loki_v1_loki_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LabelValuesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LabelValuesRequest) ProtoMessage() {}
+
+func (x *LabelValuesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_loki_v1_loki_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LabelValuesRequest.ProtoReflect.Descriptor instead.
+func (*LabelValuesRequest) Descriptor() ([]byte, []int) {
+	return file_api_loki_v1_loki_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LabelValuesRequest) GetConnection() *Connection {
+	if x != nil {
+		return x.Connection
+	}
+	return nil
+}
+
+func (x *LabelValuesRequest) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *LabelValuesRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *LabelValuesRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *LabelValuesRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type SeriesRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Connection *Connection            `protobuf:"bytes,1,opt,name=connection,proto3" json:"connection,omitempty"`
+	// Stream selector, e.g. {app="api"}
+	Selector string `protobuf:"bytes,2,opt,name=selector,proto3" json:"selector,omitempty"`
+	Start    string `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	End      string `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`
+	Format   string `protobuf:"bytes,5,opt,name=format,proto3" json:"format,omitempty"`
+	// Number of most frequent values to list per label (default: 5)
+	Top           int32 `protobuf:"varint,6,opt,name=top,proto3" json:"top,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SeriesRequest) Reset() {
+	*x = SeriesRequest{}
+	mi := &file_api_loki_v1_loki_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SeriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SeriesRequest) ProtoMessage() {}
+
+func (x *SeriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_loki_v1_loki_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SeriesRequest.ProtoReflect.Descriptor instead.
+func (*SeriesRequest) Descriptor() ([]byte, []int) {
+	return file_api_loki_v1_loki_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SeriesRequest) GetConnection() *Connection {
+	if x != nil {
+		return x.Connection
+	}
+	return nil
+}
+
+func (x *SeriesRequest) GetSelector() string {
+	if x != nil {
+		return x.Selector
+	}
+	return ""
+}
+
+func (x *SeriesRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *SeriesRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *SeriesRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *SeriesRequest) GetTop() int32 {
+	if x != nil {
+		return x.Top
+	}
+	return 0
+}
+
+// ToolResult is the result of the tool handling the call
+type ToolResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Text contents of the result, in order, including warnings
+	Content []string `protobuf:"bytes,1,rep,name=content,proto3" json:"content,omitempty"`
+	// The _meta field of the tool result encoded as JSON, with the request ID and provenance
+	MetaJson      string `protobuf:"bytes,2,opt,name=meta_json,json=metaJson,proto3" json:"meta_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolResult) Reset() {
+	*x = ToolResult{}
+	mi := &file_api_loki_v1_loki_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolResult) ProtoMessage() {}
+
+func (x *ToolResult) ProtoReflect() protoreflect.Message {
+	mi := &file_api_loki_v1_loki_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolResult.ProtoReflect.Descriptor instead.
+func (*ToolResult) Descriptor() ([]byte, []int) {
+	return file_api_loki_v1_loki_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ToolResult) GetContent() []string {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+func (x *ToolResult) GetMetaJson() string {
+	if x != nil {
+		return x.MetaJson
+	}
+	return ""
+}
+
+var File_api_loki_v1_loki_proto protoreflect.FileDescriptor
+
+const file_api_loki_v1_loki_proto_rawDesc = "" +
+	"\n" +
+	"\x16api/loki/v1/loki.proto\x12\vloki.mcp.v1\">\n" +
+	"\n" +
+	"Connection\x12\x1e\n" +
+	"\n" +
+	"datasource\x18\x01 \x01(\tR\n" +
+	"datasource\x12\x10\n" +
+	"\x03org\x18\x02 \x01(\tR\x03org\"\xb1\x02\n" +
+	"\fQueryRequest\x127\n" +
+	"\n" +
+	"connection\x18\x01 \x01(\v2\x17.loki.mcp.v1.ConnectionR\n" +
+	"connection\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\tR\x03end\x12\x14\n" +
+	"\x05limit\x18\x05 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06format\x18\x06 \x01(\tR\x06format\x12@\n" +
+	"\aoptions\x18\a \x03(\v2&.loki.mcp.v1.QueryRequest.OptionsEntryR\aoptions\x1a:\n" +
+	"\fOptionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x88\x01\n" +
+	"\rLabelsRequest\x127\n" +
+	"\n" +
+	"connection\x18\x01 \x01(\v2\x17.loki.mcp.v1.ConnectionR\n" +
+	"connection\x12\x14\n" +
+	"\x05start\x18\x02 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x03 \x01(\tR\x03end\x12\x16\n" +
+	"\x06format\x18\x04 \x01(\tR\x06format\"\xa3\x01\n" +
+	"\x12LabelValuesRequest\x127\n" +
+	"\n" +
+	"connection\x18\x01 \x01(\v2\x17.loki.mcp.v1.ConnectionR\n" +
+	"connection\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\tR\x03end\x12\x16\n" +
+	"\x06format\x18\x05 \x01(\tR\x06format\"\xb6\x01\n" +
+	"\rSeriesRequest\x127\n" +
+	"\n" +
+	"connection\x18\x01 \x01(\v2\x17.loki.mcp.v1.ConnectionR\n" +
+	"connection\x12\x1a\n" +
+	"\bselector\x18\x02 \x01(\tR\bselector\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\tR\x03end\x12\x16\n" +
+	"\x06format\x18\x05 \x01(\tR\x06format\x12\x10\n" +
+	"\x03top\x18\x06 \x01(\x05R\x03top\"C\n" +
+	"\n" +
+	"ToolResult\x12\x18\n" +
+	"\acontent\x18\x01 \x03(\tR\acontent\x12\x1b\n" +
+	"\tmeta_json\x18\x02 \x01(\tR\bmetaJson2\x8a\x02\n" +
+	"\x04Loki\x12;\n" +
+	"\x05Query\x12\x19.loki.mcp.v1.QueryRequest\x1a\x17.loki.mcp.v1.ToolResult\x12=\n" +
+	"\x06Labels\x12\x1a.loki.mcp.v1.LabelsRequest\x1a\x17.loki.mcp.v1.ToolResult\x12G\n" +
+	"\vLabelValues\x12\x1f.loki.mcp.v1.LabelValuesRequest\x1a\x17.loki.mcp.v1.ToolResult\x12=\n" +
+	"\x06Series\x12\x1a.loki.mcp.v1.SeriesRequest\x1a\x17.loki.mcp.v1.ToolResultB2Z0github.com/scottlepp/loki-mcp/api/loki/v1;lokiv1b\x06proto3"
+
+var (
+	file_api_loki_v1_loki_proto_rawDescOnce sync.Once
+	file_api_loki_v1_loki_proto_rawDescData []byte
+)
+
+func file_api_loki_v1_loki_proto_rawDescGZIP() []byte {
+	file_api_loki_v1_loki_proto_rawDescOnce.Do(func() {
+		file_api_loki_v1_loki_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_loki_v1_loki_proto_rawDesc), len(file_api_loki_v1_loki_proto_rawDesc)))
+	})
+	return file_api_loki_v1_loki_proto_rawDescData
+}
+
+var file_api_loki_v1_loki_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_api_loki_v1_loki_proto_goTypes = []any{
+	(*Connection)(nil),         // 0: loki.mcp.v1.Connection
+	(*QueryRequest)(nil),       // 1: loki.mcp.v1.QueryRequest
+	(*LabelsRequest)(nil),      // 2: loki.mcp.v1.LabelsRequest
+	(*LabelValuesRequest)(nil), // 3: loki.mcp.v1.LabelValuesRequest
+	(*SeriesRequest)(nil),      // 4: loki.mcp.v1.SeriesRequest
+	(*ToolResult)(nil),         // 5: loki.mcp.v1.ToolResult
+	nil,                        // 6: loki.mcp.v1.QueryRequest.OptionsEntry
+}
+var file_api_loki_v1_loki_proto_depIdxs = []int32{
+	0, // 0: loki.mcp.v1.QueryRequest.connection:type_name -> loki.mcp.v1.Connection
+	6, // 1: loki.mcp.v1.QueryRequest.options:type_name -> loki.mcp.v1.QueryRequest.OptionsEntry
+	0, // 2: loki.mcp.v1.LabelsRequest.connection:type_name -> loki.mcp.v1.Connection
+	0, // 3: loki.mcp.v1.LabelValuesRequest.connection:type_name -> loki.mcp.v1.Connection
+	0, // 4: loki.mcp.v1.SeriesRequest.connection:type_name -> loki.mcp.v1.Connection
+	1, // 5: loki.mcp.v1.Loki.Query:input_type -> loki.mcp.v1.QueryRequest
+	2, // 6: loki.mcp.v1.Loki.Labels:input_type -> loki.mcp.v1.LabelsRequest
+	3, // 7: loki.mcp.v1.Loki.LabelValues:input_type -> loki.mcp.v1.LabelValuesRequest
+	4, // 8: loki.mcp.v1.Loki.Series:input_type -> loki.mcp.v1.SeriesRequest
+	5, // 9: loki.mcp.v1.Loki.Query:output_type -> loki.mcp.v1.ToolResult
+	5, // 10: loki.mcp.v1.Loki.Labels:output_type -> loki.mcp.v1.ToolResult
+	5, // 11: loki.mcp.v1.Loki.LabelValues:output_type -> loki.mcp.v1.ToolResult
+	5, // 12: loki.mcp.v1.Loki.Series:output_type -> loki.mcp.v1.ToolResult
+	9, // [9:13] is the sub-list for method output_type
+	5, // [5:9] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_api_loki_v1_loki_proto_init() }
+func file_api_loki_v1_loki_proto_init() {
+	if File_api_loki_v1_loki_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_loki_v1_loki_proto_rawDesc), len(file_api_loki_v1_loki_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_loki_v1_loki_proto_goTypes,
+		DependencyIndexes: file_api_loki_v1_loki_proto_depIdxs,
+		MessageInfos:      file_api_loki_v1_loki_proto_msgTypes,
+	}.Build()
+	File_api_loki_v1_loki_proto = out.File
+	file_api_loki_v1_loki_proto_goTypes = nil
+	file_api_loki_v1_loki_proto_depIdxs = nil
+}
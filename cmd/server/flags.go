@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/scottlepp/loki-mcp/internal/middleware"
+)
+
+// parseFlags parses the command line of the server. The listen settings default to their
+// environment variables, which the flags override.
+func parseFlags(args []string) (systemdMode bool, listen middleware.ListenConfig) {
+	listen = middleware.ListenConfigFromEnv()
+	flags := flag.NewFlagSet("loki-mcp-server", flag.ExitOnError)
+	flags.BoolVar(&systemdMode, "systemd", false, "run as a systemd service: log without timestamps, notify readiness and don't serve stdio")
+	flags.StringVar(&listen.Host, "listen-addr", listen.Host, "host or IP address the HTTP transports listen on, empty for all interfaces (default: $"+middleware.EnvListenAddr+")")
+	flags.StringVar(&listen.Port, "port", listen.Port, "port the HTTP transports listen on (default: $"+middleware.EnvPort+" or "+middleware.DefaultPort+")")
+	flags.StringVar(&listen.BasePath, "base-path", listen.BasePath, "URL path the HTTP endpoints are served under, e.g. /loki-mcp (default: $"+middleware.EnvBasePath+")")
+	flags.StringVar(&listen.GRPCPort, "grpc-port", listen.GRPCPort, "port the gRPC interface listens on, empty to not serve it (default: $"+middleware.EnvGRPCPort+")")
+	flags.Parse(args)
+	listen.BasePath = middleware.NormalizeBasePath(listen.BasePath)
+	return systemdMode, listen
+}
@@ -1,94 +1,483 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
 
+	"github.com/scottlepp/loki-mcp/internal/grpcserver"
 	"github.com/scottlepp/loki-mcp/internal/handlers"
+	"github.com/scottlepp/loki-mcp/internal/middleware"
+	"github.com/scottlepp/loki-mcp/internal/systemd"
 )
 
-const (
-	version = "0.1.0"
+// Version information, stamped at build time with -ldflags "-X main.version=..."
+var (
+	version   = "0.1.0"
+	commit    = "unknown"
+	buildDate = "unknown"
 )
 
 func main() {
-	// Create a new MCP server
-	s := server.NewMCPServer(
-		"Loki MCP Server",
-		version,
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate-config":
+			os.Exit(validateConfig(os.Args[2:], os.Stdout))
+		case "verify-provenance":
+			os.Exit(verifyProvenance(os.Args[2:], os.Stdin, os.Stdout))
+		case "version", "--version", "-version":
+			fmt.Printf("loki-mcp-server %s (commit %s, built %s)\n", version, commit, buildDate)
+			return
+		}
+	}
+
+	// Under systemd, journald timestamps the log and stdin is not a client
+	systemdMode, listen := parseFlags(os.Args[1:])
+	if systemdMode {
+		log.SetFlags(0)
+	}
+	log.Printf("Loki MCP Server %s (commit %s, built %s)", version, commit, buildDate)
+
+	// Resolve the configuration once so every tool and handler sees the same settings
+	cfg := handlers.LoadConfig()
+	for _, problem := range cfg.SecretErrors {
+		log.Printf("Warning: %s", problem)
+	}
+	if cfg.DatasourcesFile != "" {
+		datasources, err := handlers.LoadDatasources(cfg.DatasourcesFile)
+		if err != nil {
+			log.Fatalf("Failed to load datasources: %v", err)
+		}
+		cfg.Datasources = datasources
+		log.Printf("Loaded %d datasources from %s", len(datasources), cfg.DatasourcesFile)
+	}
+	if cfg.AnonymizationFile != "" {
+		profiles, err := handlers.LoadAnonymizationProfiles(cfg.AnonymizationFile)
+		if err != nil {
+			log.Fatalf("Failed to load anonymization profiles: %v", err)
+		}
+		cfg.AnonymizationProfiles = profiles
+		log.Printf("Loaded %d anonymization profiles from %s", len(profiles), cfg.AnonymizationFile)
+	}
+	if err := handlers.CheckAnonymizationProfiles(cfg); err != nil {
+		log.Fatalf("Invalid anonymization settings: %v", err)
+	}
+	if cfg.SavedQueriesFile != "" {
+		queries, err := handlers.LoadSavedQueries(cfg.SavedQueriesFile)
+		if err != nil {
+			log.Fatalf("Failed to load saved queries: %v", err)
+		}
+		cfg.SavedQueries = queries
+		log.Printf("Loaded %d saved queries from %s", len(queries), cfg.SavedQueriesFile)
+	}
+	if cfg.SourceLinksFile != "" {
+		rules, err := handlers.LoadSourceLinks(cfg.SourceLinksFile)
+		if err != nil {
+			log.Fatalf("Failed to load source links: %v", err)
+		}
+		cfg.SourceLinks = rules
+		log.Printf("Loaded %d source link rules from %s", len(rules), cfg.SourceLinksFile)
+	}
+	if cfg.MultilineFile != "" {
+		rules, err := handlers.LoadMultilineRules(cfg.MultilineFile)
+		if err != nil {
+			log.Fatalf("Failed to load multiline rules: %v", err)
+		}
+		cfg.Multiline = rules
+		log.Printf("Loaded %d multiline rules from %s", len(rules), cfg.MultilineFile)
+	}
+	if cfg.AccessPolicyFile != "" {
+		policy, err := handlers.LoadAccessPolicy(cfg.AccessPolicyFile)
+		if err != nil {
+			log.Fatalf("Failed to load access policy: %v", err)
+		}
+		cfg.AccessPolicy = policy
+		if policy.UsesClaims() && policy.Issuer == "" && cfg.OIDC.Issuer == "" {
+			log.Fatalf("The access policy matches OIDC claims but neither issuer nor %s is set", handlers.EnvLokiOIDCIssuer)
+		}
+		log.Printf("Loaded %d roles and %d subjects from %s", len(policy.Roles), len(policy.Subjects), cfg.AccessPolicyFile)
+	}
+	handlers.SetConfig(cfg)
+	if removed := handlers.PruneResponseCache(cfg); removed > 0 {
+		log.Printf("Removed %d expired cached responses from %s", removed, cfg.CacheDir)
+	}
+
+	// Probe the datasources so an unreachable Loki is reported clearly instead of failing every tool call
+	if cfg.StartupProbe || cfg.StrictStartup {
+		unhealthy := 0
+		for _, probe := range handlers.ProbeDatasources(context.Background()) {
+			name := probe.Datasource
+			if name == "" {
+				name = handlers.EnvLokiURL
+			}
+			if probe.Healthy {
+				log.Printf("Datasource %s (%s) is reachable", name, probe.URL)
+				continue
+			}
+			unhealthy++
+			log.Printf("Datasource %s (%s) is unreachable: %s", name, probe.URL, probe.Error)
+		}
+		if unhealthy > 0 {
+			if cfg.StrictStartup {
+				log.Fatalf("%d datasources unreachable and %s is set, exiting", unhealthy, handlers.EnvStrictStartup)
+			}
+			log.Printf("Warning: continuing with %d unreachable datasources; tool calls using them will report warnings", unhealthy)
+		}
+	}
+
+	// Create a new MCP server, whose tool calls clients can cancel with notifications/cancelled
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(handlers.CancellationHook)
+	opts := []server.ServerOption{
 		server.WithResourceCapabilities(true, true),
 		server.WithLogging(),
-	)
+		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(handlers.RequestIDMiddleware),
+		server.WithToolHandlerMiddleware(handlers.ProvenanceMiddleware(version)),
+		server.WithToolHandlerMiddleware(handlers.CancellationMiddleware),
+		server.WithToolHandlerMiddleware(handlers.InFlightMiddleware),
+		server.WithToolHandlerMiddleware(handlers.AccessPolicyMiddleware),
+		server.WithToolHandlerMiddleware(handlers.DryRunMiddleware),
+		server.WithToolHandlerMiddleware(handlers.VerboseMiddleware),
+		server.WithToolHandlerMiddleware(handlers.WarningsMiddleware),
+	}
+	// Add middleware registered by custom tools
+	opts = append(opts, handlers.DefaultRegistry.ServerOptions()...)
+	s := server.NewMCPServer("Loki MCP Server", version, opts...)
+	s.AddNotificationHandler(handlers.MethodNotificationCancelled, handlers.HandleCancelledNotification)
+
+	// Register tools unless disabled by configuration, keeping their handlers for scheduled reports
+	toolHandlers := make(map[string]server.ToolHandlerFunc)
+	addTool := func(tool mcp.Tool, handler server.ToolHandlerFunc) {
+		if !handlers.ToolEnabled(tool.Name) {
+			log.Printf("Tool %s disabled by configuration", tool.Name)
+			return
+		}
+		s.AddTool(tool, handler)
+		toolHandlers[tool.Name] = handler
+	}
 
 	// Add Loki query tool
 	lokiQueryTool := handlers.NewLokiQueryTool()
-	s.AddTool(lokiQueryTool, handlers.HandleLokiQuery)
+	addTool(lokiQueryTool, handlers.HandleLokiQuery)
 
 	// Add Loki label names tool
 	lokiLabelNamesTool := handlers.NewLokiLabelNamesTool()
-	s.AddTool(lokiLabelNamesTool, handlers.HandleLokiLabelNames)
+	addTool(lokiLabelNamesTool, handlers.HandleLokiLabelNames)
 
 	// Add Loki label values tool
 	lokiLabelValuesTool := handlers.NewLokiLabelValuesTool()
-	s.AddTool(lokiLabelValuesTool, handlers.HandleLokiLabelValues)
+	addTool(lokiLabelValuesTool, handlers.HandleLokiLabelValues)
+
+	// Add Loki drilldown tool
+	lokiDrilldownTool := handlers.NewLokiDrilldownTool()
+	addTool(lokiDrilldownTool, handlers.HandleLokiDrilldown)
+
+	// Add session context tools
+	addTool(handlers.NewLokiSetContextTool(), handlers.HandleLokiSetContext)
+	addTool(handlers.NewLokiGetContextTool(), handlers.HandleLokiGetContext)
+
+	// Add Loki cardinality tool
+	addTool(handlers.NewLokiCardinalityTool(), handlers.HandleLokiCardinality)
+
+	// Add Loki silent streams tool
+	addTool(handlers.NewLokiSilentStreamsTool(), handlers.HandleLokiSilentStreams)
+
+	// Add Loki version diff tool
+	addTool(handlers.NewLokiVersionDiffTool(), handlers.HandleLokiVersionDiff)
+
+	// Add Loki error budget tool
+	addTool(handlers.NewLokiErrorBudgetTool(), handlers.HandleLokiErrorBudget)
+
+	// Add Loki latency stats tool
+	addTool(handlers.NewLokiLatencyStatsTool(), handlers.HandleLokiLatencyStats)
+
+	// Add Loki unwrap query tool
+	addTool(handlers.NewLokiUnwrapQueryTool(), handlers.HandleLokiUnwrapQuery)
+
+	// Add Loki endpoint health tool
+	addTool(handlers.NewLokiEndpointHealthTool(), handlers.HandleLokiEndpointHealth)
+
+	// Add Loki limits tool
+	addTool(handlers.NewLokiLimitsTool(), handlers.HandleLokiLimits)
+
+	// Add Loki retention tool
+	addTool(handlers.NewLokiRetentionTool(), handlers.HandleLokiRetention)
+
+	// Add Loki first and last occurrence tools
+	addTool(handlers.NewLokiFirstOccurrenceTool(), handlers.HandleLokiFirstOccurrence)
+	addTool(handlers.NewLokiLastOccurrenceTool(), handlers.HandleLokiLastOccurrence)
+
+	// Add Loki deploy compare tool
+	addTool(handlers.NewLokiDeployCompareTool(), handlers.HandleLokiDeployCompare)
+
+	// Add Loki correlate tool
+	addTool(handlers.NewLokiCorrelateTool(), handlers.HandleLokiCorrelate)
+
+	// Add Loki push file tool when a directory to read files from is configured
+	if handlers.PushEnabled() {
+		addTool(handlers.NewLokiPushFileTool(), handlers.HandleLokiPushFile)
+	}
+
+	// Add Loki dashboard queries tool when a Grafana URL is configured
+	if handlers.GrafanaEnabled() {
+		addTool(handlers.NewLokiDashboardQueriesTool(), handlers.HandleLokiDashboardQueries)
+	}
+
+	// Add Loki annotate tool when writing Grafana annotations is enabled
+	if handlers.GrafanaAnnotationsEnabled() {
+		addTool(handlers.NewLokiAnnotateTool(), handlers.HandleLokiAnnotate)
+	}
+
+	// Add usage tool reporting the queries and bytes processed per caller
+	addTool(handlers.NewLokiMCPUsageTool(), handlers.HandleLokiMCPUsage)
 
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Add slow query log tool when a slow query threshold is configured
+	if handlers.SlowQueryLogEnabled() {
+		addTool(handlers.NewLokiMCPSlowQueriesTool(), handlers.HandleLokiMCPSlowQueries)
 	}
 
+	// Add Loki admin tools when an admin token is configured
+	if handlers.AdminEnabled() {
+		addTool(handlers.NewLokiAdminTenantsTool(), handlers.HandleLokiAdminTenants)
+		addTool(handlers.NewLokiAdminTokensTool(), handlers.HandleLokiAdminTokens)
+	}
+
+	// Add Kubernetes convenience tools
+	addTool(handlers.NewLokiK8sLogsTool(), handlers.HandleLokiK8sLogs)
+	addTool(handlers.NewLokiServicesTool(), handlers.HandleLokiServices)
+
+	// Add Loki explain query tool
+	addTool(handlers.NewLokiExplainQueryTool(), handlers.HandleLokiExplainQuery)
+
+	// Add Loki find label value tool
+	addTool(handlers.NewLokiFindLabelValueTool(), handlers.HandleLokiFindLabelValue)
+
+	// Add Loki query diff tool
+	addTool(handlers.NewLokiQueryDiffTool(), handlers.HandleLokiQueryDiff)
+
+	// Add Loki volume heatmap tool
+	addTool(handlers.NewLokiVolumeHeatmapTool(), handlers.HandleLokiVolumeHeatmap)
+
+	// Add Loki investigation report tool
+	addTool(handlers.NewLokiReportTool(), handlers.HandleLokiReport)
+
+	// Add Loki saved query tool when saved queries are configured
+	if len(handlers.CurrentConfig().SavedQueries) > 0 {
+		addTool(handlers.NewLokiSavedQueryTool(), handlers.HandleLokiSavedQuery)
+		addTool(handlers.NewLokiSavedQueryOptionsTool(), handlers.HandleLokiSavedQueryOptions)
+	}
+
+	// Add Loki watch tools
+	addTool(handlers.NewLokiWatchCreateTool(), handlers.HandleLokiWatchCreate)
+	addTool(handlers.NewLokiWatchListTool(), handlers.HandleLokiWatchList)
+	addTool(handlers.NewLokiWatchDeleteTool(), handlers.HandleLokiWatchDelete)
+
+	// Add Loki tail tools
+	addTool(handlers.NewLokiTailStartTool(), handlers.HandleLokiTailStart)
+	addTool(handlers.NewLokiTailReadTool(), handlers.HandleLokiTailRead)
+	addTool(handlers.NewLokiTailStopTool(), handlers.HandleLokiTailStop)
+
+	// Add Loki snapshot tools
+	addTool(handlers.NewLokiSnapshotTool(), handlers.HandleLokiSnapshot)
+	addTool(handlers.NewLokiSnapshotGetTool(), handlers.HandleLokiSnapshotGet)
+	addTool(handlers.NewLokiSnapshotListTool(), handlers.HandleLokiSnapshotList)
+	addTool(handlers.NewLokiSnapshotDiffTool(), handlers.HandleLokiSnapshotDiff)
+
+	// Add custom tools registered with handlers.RegisterTool
+	for _, reg := range handlers.DefaultRegistry.Tools() {
+		addTool(reg.Tool, reg.Handler)
+	}
+
+	// Run scheduled reports defined in the reports file
+	reportsCtx, stopReports := context.WithCancel(context.Background())
+	defer stopReports()
+	if path := handlers.CurrentConfig().ReportsFile; path != "" {
+		reports, err := handlers.LoadReports(path)
+		if err != nil {
+			log.Fatalf("Failed to load reports: %v", err)
+		}
+		scheduler, err := handlers.NewReportScheduler(reports, toolHandlers)
+		if err != nil {
+			log.Fatalf("Invalid reports file %s: %v", path, err)
+		}
+		log.Printf("Scheduled %d reports from %s", len(reports), path)
+		go scheduler.Run(reportsCtx)
+	}
+
+	// Send keep-alive pings so proxies and load balancers don't drop idle sessions
+	keepAlive := middleware.KeepAliveIntervalFromEnv()
+
 	// Create SSE server for legacy SSE connections
-	sseServer := server.NewSSEServer(s,
+	sseOptions := []server.SSEOption{
 		server.WithSSEEndpoint("/sse"),
 		server.WithMessageEndpoint("/mcp"),
-	)
+		server.WithAppendQueryToMessageEndpoint(),
+		server.WithSSEContextFunc(handlers.HTTPContextFunc),
+	}
+	if listen.BasePath != "" {
+		// Tell SSE clients to post messages under the base path
+		sseOptions = append(sseOptions, server.WithStaticBasePath(listen.BasePath))
+	}
+	if keepAlive > 0 {
+		sseOptions = append(sseOptions, server.WithKeepAliveInterval(keepAlive))
+	}
+	sseServer := server.NewSSEServer(s, sseOptions...)
 
 	// Create Streamable HTTP server
-	streamableServer := server.NewStreamableHTTPServer(s)
+	streamableServer := server.NewStreamableHTTPServer(s,
+		server.WithHeartbeatInterval(keepAlive),
+		server.WithHTTPContextFunc(handlers.HTTPContextFunc),
+	)
 
 	// Create a multiplexer to handle both protocols on the same port
 	mux := http.NewServeMux()
 
 	// Register SSE endpoints (legacy support)
-	mux.Handle("/sse", sseServer) // SSE event stream
-	mux.Handle("/mcp", sseServer) // SSE message endpoint
+	mux.Handle("/sse", sseServer.SSEHandler())     // SSE event stream
+	mux.Handle("/mcp", sseServer.MessageHandler()) // SSE message endpoint
 
 	// Register Streamable HTTP endpoint
 	mux.Handle("/stream", streamableServer) // Streamable HTTP endpoint
 
+	// Protect the HTTP transports with authentication and CORS controls
+	authConfig := middleware.AuthConfigFromEnv()
+	handler := middleware.CORS(middleware.CORSOriginsFromEnv(), middleware.Auth(authConfig, mux))
+
+	// Answer liveness and readiness probes without authentication
+	handler = middleware.Health(handlers.Ready, handler)
+
+	// Serve the endpoints under the base path, e.g. behind a reverse proxy at a sub-path
+	handler = middleware.BasePath(listen.BasePath, handler)
+	if !authConfig.Enabled() && !cfg.OIDC.Enabled() && cfg.AccessPolicy == nil {
+		log.Printf("Warning: HTTP transports are not authenticated; set %s or %s/%s before exposing the server beyond localhost",
+			middleware.EnvAuthToken, middleware.EnvAuthUsername, middleware.EnvAuthPassword)
+	}
+
+	// Serve the gRPC interface when a port is configured, behind the same credentials and tool middleware
+	var grpcServer *grpc.Server
+	if addr := listen.GRPCAddr(); addr != "" {
+		grpcListener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+		grpcServer = grpcserver.New(s, authConfig)
+		log.Printf("Starting gRPC interface on %s", grpcListener.Addr())
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				log.Fatalf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
 	// Create a channel to handle shutdown signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	// Start unified HTTP server
-	go func() {
-		addr := fmt.Sprintf(":%s", port)
-		log.Printf("Starting unified MCP server on http://localhost%s", addr)
-		log.Printf("SSE Endpoint (legacy): http://localhost%s/sse", addr)
-		log.Printf("SSE Message Endpoint: http://localhost%s/mcp", addr)
-		log.Printf("Streamable HTTP Endpoint: http://localhost%s/stream", addr)
-
-		if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
+	httpServer := &http.Server{
+		Addr:    listen.Addr(),
+		Handler: handler,
+	}
+
+	// Serve the sockets passed by systemd socket activation, or listen on PORT
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		log.Fatalf("Socket activation error: %v", err)
+	}
+	if len(listeners) > 0 {
+		for _, listener := range listeners {
+			log.Printf("Starting unified MCP server on socket-activated %s", listener.Addr())
+		}
+	} else {
+		listener, err := net.Listen("tcp", httpServer.Addr)
+		if err != nil {
 			log.Fatalf("HTTP server error: %v", err)
 		}
-	}()
+		listeners = append(listeners, listener)
+
+		log.Printf("Starting unified MCP server on %s", listen.URL(""))
+		log.Printf("SSE Endpoint (legacy): %s", listen.URL("/sse"))
+		log.Printf("SSE Message Endpoint: %s", listen.URL("/mcp"))
+		log.Printf("Streamable HTTP Endpoint: %s", listen.URL("/stream"))
+	}
+	for _, listener := range listeners {
+		go func() {
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("HTTP server error: %v", err)
+			}
+		}()
+	}
 
 	// For backward compatibility, also serve via stdio
-	go func() {
-		log.Println("Starting stdio server")
-		if err := server.ServeStdio(s); err != nil {
-			log.Printf("Stdio server error: %v", err)
-		}
-	}()
+	if !systemdMode {
+		go func() {
+			log.Println("Starting stdio server")
+			if err := server.ServeStdio(s); err != nil {
+				log.Printf("Stdio server error: %v", err)
+			}
+		}()
+	}
+
+	// Tell systemd the server is ready, and keep its watchdog fed
+	if sent, err := systemd.Notify(systemd.Ready); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	} else if sent {
+		log.Println("Notified systemd of readiness")
+	}
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval / 2)
+			defer ticker.Stop()
+			for range ticker.C {
+				systemd.Notify(systemd.Watchdog)
+			}
+		}()
+	}
 
 	// Wait for interrupt signal
 	<-stop
-	log.Println("Shutting down servers...")
+	systemd.Notify(systemd.Stopping)
+	gracePeriod := handlers.ShutdownGracePeriod()
+	log.Printf("Shutting down servers, waiting up to %s for in-flight tool calls...", gracePeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	handlers.StopWatches()
+	handlers.StopTails()
+	stopReports()
+
+	// Stop accepting tool calls first, then let the HTTP server finish writing responses
+	if err := handlers.DrainInFlight(ctx); err != nil {
+		log.Printf("Cancelled in-flight tool calls after grace period: %v", err)
+	}
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+		httpServer.Close()
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			log.Printf("gRPC server shutdown error: %v", ctx.Err())
+			grpcServer.Stop()
+		}
+	}
+	log.Println("Shutdown complete")
 }
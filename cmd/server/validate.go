@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/scottlepp/loki-mcp/internal/handlers"
+)
+
+// validateConfig implements the validate-config command. It checks the config files named by
+// flags or environment variables, prints the problems found and returns the exit code.
+func validateConfig(args []string, out io.Writer) int {
+	cfg := handlers.LoadConfig()
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	flags.SetOutput(out)
+	datasources := flags.String("datasources", cfg.DatasourcesFile, "datasources file to validate (default: $"+handlers.EnvLokiDatasourcesFile+")")
+	reports := flags.String("reports", cfg.ReportsFile, "reports file to validate (default: $"+handlers.EnvLokiReportsFile+")")
+	accessPolicy := flags.String("access-policy", cfg.AccessPolicyFile, "access policy file to validate (default: $"+handlers.EnvLokiAccessPolicyFile+")")
+	anonymization := flags.String("anonymization", cfg.AnonymizationFile, "anonymization file to validate (default: $"+handlers.EnvLokiAnonymizationFile+")")
+	savedQueries := flags.String("saved-queries", cfg.SavedQueriesFile, "saved queries file to validate (default: $"+handlers.EnvLokiSavedQueriesFile+")")
+	sourceLinks := flags.String("source-links", cfg.SourceLinksFile, "source links file to validate (default: $"+handlers.EnvLokiSourceLinksFile+")")
+	multiline := flags.String("multiline", cfg.MultilineFile, "multiline rules file to validate (default: $"+handlers.EnvLokiMultilineFile+")")
+	schema := flags.String("schema", "", "print the JSON schema of a config file (datasources, reports, access-policy, anonymization, saved-queries, source-links or multiline) and exit")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *schema != "" {
+		data, err := handlers.ConfigSchema(*schema)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		out.Write(data)
+		return 0
+	}
+
+	failed := report(out, "environment", handlers.ValidateCredentials(cfg))
+	if *datasources != "" {
+		failed = report(out, *datasources, handlers.ValidateDatasourcesFile(*datasources)) || failed
+	}
+	if *reports != "" {
+		failed = report(out, *reports, handlers.ValidateReportsFile(*reports)) || failed
+	}
+	if *accessPolicy != "" {
+		failed = report(out, *accessPolicy, handlers.ValidateAccessPolicyFile(*accessPolicy)) || failed
+	}
+	if *anonymization != "" {
+		failed = report(out, *anonymization, handlers.ValidateAnonymizationFile(*anonymization)) || failed
+	}
+	if *savedQueries != "" {
+		failed = report(out, *savedQueries, handlers.ValidateSavedQueriesFile(*savedQueries)) || failed
+	}
+	if *sourceLinks != "" {
+		failed = report(out, *sourceLinks, handlers.ValidateSourceLinksFile(*sourceLinks)) || failed
+	}
+	if *multiline != "" {
+		failed = report(out, *multiline, handlers.ValidateMultilineFile(*multiline)) || failed
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// report prints the problems found in a config source and returns whether there were any
+func report(out io.Writer, source string, problems []string) bool {
+	if len(problems) == 0 {
+		fmt.Fprintf(out, "%s: OK\n", source)
+		return false
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(out, "%s: %s\n", source, problem)
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/loki-mcp/internal/handlers"
+)
+
+// signedResult is a tool result carrying provenance metadata, either on its own or as the result
+// of a JSON-RPC response
+type signedResult struct {
+	Content []map[string]any `json:"content"`
+	Meta    struct {
+		Provenance *handlers.Provenance `json:"provenance"`
+	} `json:"_meta"`
+	Result *signedResult `json:"result"`
+}
+
+// verifyProvenance implements the verify-provenance command. It checks the signature of a tool
+// result read from a file or stdin, prints its provenance and returns the exit code.
+func verifyProvenance(args []string, in io.Reader, out io.Writer) int {
+	cfg := handlers.LoadConfig()
+	flags := flag.NewFlagSet("verify-provenance", flag.ContinueOnError)
+	flags.SetOutput(out)
+	file := flags.String("file", "", "file containing the tool result or JSON-RPC response to verify (default: stdin)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.SigningKey == "" {
+		fmt.Fprintf(out, "%s or %s_FILE must be set to the key the server signs results with\n", handlers.EnvSigningKey, handlers.EnvSigningKey)
+		return 2
+	}
+
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+	}
+	var result signedResult
+	if err := json.NewDecoder(in).Decode(&result); err != nil {
+		fmt.Fprintf(out, "failed to parse the tool result: %v\n", err)
+		return 2
+	}
+	if result.Result != nil {
+		result = *result.Result
+	}
+	p := result.Meta.Provenance
+	if p == nil {
+		fmt.Fprintln(out, "the tool result has no provenance metadata")
+		return 1
+	}
+
+	var contents []mcp.Content
+	for i, item := range result.Content {
+		content, err := mcp.ParseContent(item)
+		if err != nil {
+			fmt.Fprintf(out, "failed to parse content %d of the tool result: %v\n", i+1, err)
+			return 2
+		}
+		contents = append(contents, content)
+	}
+	if err := handlers.VerifyProvenance([]byte(cfg.SigningKey), p, contents); err != nil {
+		fmt.Fprintf(out, "FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "OK: %s returned by %s %s at %s (request_id %s, datasource %s)\n",
+		p.Tool, p.Server, p.Version, p.ExecutedAt, p.RequestID, p.Datasource)
+	return 0
+}
@@ -2,10 +2,18 @@ module github.com/scottlepp/loki-mcp
 
 go 1.24.4
 
-require github.com/mark3labs/mcp-go v0.32.0
+require (
+	github.com/google/uuid v1.6.0
+	github.com/mark3labs/mcp-go v0.32.0
+	google.golang.org/grpc v1.80.0
+	google.golang.org/protobuf v1.36.11
+)
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
+	golang.org/x/net v0.49.0 // indirect
+	golang.org/x/sys v0.40.0 // indirect
+	golang.org/x/text v0.33.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260120221211-b8f7ae30c516 // indirect
 )
@@ -0,0 +1,287 @@
+// Package grpcserver serves the gRPC interface defined in api/loki/v1/loki.proto. Every call is
+// handled as an MCP tools/call of the server's tools, so it passes through the same transport
+// authentication, access policy and tool middleware as a call over the HTTP transports.
+package grpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	lokiv1 "github.com/scottlepp/loki-mcp/api/loki/v1"
+	"github.com/scottlepp/loki-mcp/internal/handlers"
+	"github.com/scottlepp/loki-mcp/internal/middleware"
+)
+
+// policyViolation is part of the message of errors wrapping a handlers.PolicyViolationError
+const policyViolation = "policy violation: "
+
+// lokiService implements the Loki service with the tools of an MCP server
+type lokiService struct {
+	lokiv1.UnimplementedLokiServer
+	mcp *server.MCPServer
+	ids atomic.Int64 // last JSON-RPC ID sent to the MCP server
+}
+
+// anonymousCalls numbers the calls without credentials, each of which gets a session of its own
+var anonymousCalls atomic.Int64
+
+// New returns a gRPC server answering the Loki service with the tools of s. Calls carry their
+// credentials in metadata, e.g. authorization or x-api-key, which are checked against auth and
+// the access policy like the headers of an HTTP transport request.
+func New(s *server.MCPServer, auth middleware.AuthConfig) *grpc.Server {
+	g := grpc.NewServer(grpc.UnaryInterceptor(authInterceptor(auth)))
+	lokiv1.RegisterLokiServer(g, &lokiService{mcp: s})
+	return g
+}
+
+// authInterceptor rejects calls without valid transport credentials and gives the others the
+// context an HTTP transport request with the same headers would have, in the session of the caller
+func authInterceptor(auth middleware.AuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, info.FullMethod, nil)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			r.RemoteAddr = p.Addr.String()
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for key, values := range md {
+			if strings.HasPrefix(key, ":") {
+				continue
+			}
+			for _, value := range values {
+				r.Header.Add(key, value)
+			}
+		}
+		if auth.Enabled() && !auth.Authorized(r) {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid credentials")
+		}
+		ctx = handlers.HTTPContextFunc(ctx, r)
+		return handler(handlers.WithSessionKey(ctx, callerSession(r)), req)
+	}
+}
+
+// callerSession returns the session of a call. gRPC calls have no MCP session, so calls with the
+// same credentials share one, identified by a hash of the credentials, and calls without
+// credentials each get their own.
+func callerSession(r *http.Request) string {
+	authorization, apiKey := r.Header.Get("Authorization"), r.Header.Get(handlers.APIKeyHeader)
+	if authorization == "" && apiKey == "" {
+		return "grpc-call-" + strconv.FormatInt(anonymousCalls.Add(1), 10)
+	}
+	sum := sha256.Sum256([]byte(authorization + "\n" + apiKey))
+	return "grpc-" + hex.EncodeToString(sum[:])
+}
+
+// Query runs a LogQL query with the loki_query tool
+func (s *lokiService) Query(ctx context.Context, req *lokiv1.QueryRequest) (*lokiv1.ToolResult, error) {
+	args, err := s.optionArgs(ctx, "loki_query", req.GetOptions())
+	if err != nil {
+		return nil, err
+	}
+	connectionArgs(args, req.GetConnection())
+	setString(args, "query", req.GetQuery())
+	setString(args, "start", req.GetStart())
+	setString(args, "end", req.GetEnd())
+	setNumber(args, "limit", req.GetLimit())
+	setString(args, "format", req.GetFormat())
+	return s.callTool(ctx, "loki_query", args)
+}
+
+// Labels lists the label names with the loki_label_names tool
+func (s *lokiService) Labels(ctx context.Context, req *lokiv1.LabelsRequest) (*lokiv1.ToolResult, error) {
+	args := make(map[string]any)
+	connectionArgs(args, req.GetConnection())
+	setString(args, "start", req.GetStart())
+	setString(args, "end", req.GetEnd())
+	setString(args, "format", req.GetFormat())
+	return s.callTool(ctx, "loki_label_names", args)
+}
+
+// LabelValues lists the values of a label with the loki_label_values tool
+func (s *lokiService) LabelValues(ctx context.Context, req *lokiv1.LabelValuesRequest) (*lokiv1.ToolResult, error) {
+	args := make(map[string]any)
+	connectionArgs(args, req.GetConnection())
+	setString(args, "label", req.GetLabel())
+	setString(args, "start", req.GetStart())
+	setString(args, "end", req.GetEnd())
+	setString(args, "format", req.GetFormat())
+	return s.callTool(ctx, "loki_label_values", args)
+}
+
+// Series reports the streams matching a selector with the loki_cardinality tool
+func (s *lokiService) Series(ctx context.Context, req *lokiv1.SeriesRequest) (*lokiv1.ToolResult, error) {
+	args := make(map[string]any)
+	connectionArgs(args, req.GetConnection())
+	setString(args, "selector", req.GetSelector())
+	setString(args, "start", req.GetStart())
+	setString(args, "end", req.GetEnd())
+	setString(args, "format", req.GetFormat())
+	setNumber(args, "top", req.GetTop())
+	return s.callTool(ctx, "loki_cardinality", args)
+}
+
+// connectionArgs adds the datasource and tenant of a connection to the tool arguments
+func connectionArgs(args map[string]any, c *lokiv1.Connection) {
+	setString(args, "datasource", c.GetDatasource())
+	setString(args, "org", c.GetOrg())
+}
+
+// setString sets a string argument unless it is empty, leaving the tool's default
+func setString(args map[string]any, name, value string) {
+	if value != "" {
+		args[name] = value
+	}
+}
+
+// setNumber sets a number argument unless it is zero, leaving the tool's default
+func setNumber(args map[string]any, name string, value int32) {
+	if value != 0 {
+		args[name] = float64(value)
+	}
+}
+
+// optionArgs converts the string options of a request to arguments of the types the tool's input
+// schema declares
+func (s *lokiService) optionArgs(ctx context.Context, tool string, options map[string]string) (map[string]any, error) {
+	args := make(map[string]any, len(options))
+	if len(options) == 0 {
+		return args, nil
+	}
+	schema, err := s.inputSchema(ctx, tool)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range options {
+		property, ok := schema.Properties[name].(map[string]any)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown option %s for %s", name, tool)
+		}
+		arg, err := convertOption(property["type"], value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "option %s: %v", name, err)
+		}
+		args[name] = arg
+	}
+	return args, nil
+}
+
+// convertOption converts an option value to a JSON schema type. Arrays are given as JSON or as
+// comma separated values, objects as JSON.
+func convertOption(schemaType any, value string) (any, error) {
+	switch schemaType {
+	case "number", "integer":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "array":
+		var values []any
+		if json.Unmarshal([]byte(value), &values) == nil {
+			return values, nil
+		}
+		for _, v := range strings.Split(value, ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return values, nil
+	case "object":
+		var object map[string]any
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			return nil, fmt.Errorf("invalid JSON object: %w", err)
+		}
+		return object, nil
+	}
+	return value, nil
+}
+
+// inputSchema returns the input schema of a tool from the server's tool list
+func (s *lokiService) inputSchema(ctx context.Context, tool string) (mcp.ToolInputSchema, error) {
+	response, err := s.handle(ctx, mcp.MethodToolsList, nil)
+	if err != nil {
+		return mcp.ToolInputSchema{}, err
+	}
+	if list, ok := response.(mcp.ListToolsResult); ok {
+		for _, t := range list.Tools {
+			if t.Name == tool {
+				return t.InputSchema, nil
+			}
+		}
+	}
+	return mcp.ToolInputSchema{}, status.Errorf(codes.Unimplemented, "tool %s is not enabled", tool)
+}
+
+// callTool calls a tool through the MCP server and returns its result
+func (s *lokiService) callTool(ctx context.Context, tool string, args map[string]any) (*lokiv1.ToolResult, error) {
+	response, err := s.handle(ctx, mcp.MethodToolsCall, map[string]any{"name": tool, "arguments": args})
+	if err != nil {
+		return nil, err
+	}
+	result, ok := response.(mcp.CallToolResult)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "unexpected result %T", response)
+	}
+
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := mcp.AsTextContent(content); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	if result.IsError {
+		return nil, status.Error(codes.Unknown, strings.Join(texts, "\n"))
+	}
+	out := &lokiv1.ToolResult{Content: texts}
+	if result.Meta != nil {
+		meta, err := json.Marshal(result.Meta)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding result metadata: %v", err)
+		}
+		out.MetaJson = string(meta)
+	}
+	return out, nil
+}
+
+// handle sends a JSON-RPC request to the MCP server and returns the result, or the error as a
+// gRPC status
+func (s *lokiService) handle(ctx context.Context, method mcp.MCPMethod, params any) (any, error) {
+	message, err := json.Marshal(map[string]any{"jsonrpc": mcp.JSONRPC_VERSION, "id": s.ids.Add(1), "method": method, "params": params})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	switch response := s.mcp.HandleMessage(ctx, message).(type) {
+	case mcp.JSONRPCResponse:
+		return response.Result, nil
+	case mcp.JSONRPCError:
+		return nil, errorStatus(ctx, response.Error.Message)
+	default:
+		return nil, status.Errorf(codes.Internal, "unexpected response %T", response)
+	}
+}
+
+// errorStatus returns the gRPC status of a tool call error
+func errorStatus(ctx context.Context, message string) error {
+	switch {
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	case strings.Contains(message, policyViolation):
+		return status.Error(codes.PermissionDenied, message)
+	case strings.Contains(message, server.ErrToolNotFound.Error()):
+		return status.Error(codes.Unimplemented, message)
+	}
+	return status.Error(codes.Unknown, message)
+}
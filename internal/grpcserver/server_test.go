@@ -0,0 +1,237 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	lokiv1 "github.com/scottlepp/loki-mcp/api/loki/v1"
+	"github.com/scottlepp/loki-mcp/internal/handlers"
+	"github.com/scottlepp/loki-mcp/internal/middleware"
+)
+
+const testAccessPolicy = `{
+  "roles": {
+    "analyst": {"tools": ["loki_query"], "tenants": ["team-a"], "labels": {"namespace": "team-a-.*"}},
+    "sre": {"tools": ["*"]}
+  },
+  "subjects": [
+    {"name": "dashboards", "api_key": "analyst-key", "role": "analyst"},
+    {"name": "oncall", "api_key": "sre-key", "role": "sre"}
+  ]
+}`
+
+// TestLokiService tests calling the tools over gRPC behind the transport credentials and access policy
+func TestLokiService(t *testing.T) {
+	var lokiQuery, lokiOrg string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lokiQuery = r.URL.Query().Get("query")
+		lokiOrg = r.Header.Get("X-Scope-OrgID")
+		if strings.HasSuffix(r.URL.Path, "/labels") {
+			w.Write([]byte(`{"status":"success","data":["app","namespace"]}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"web"},"values":[["1700000000000000000","hello"]]}]}}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	policyPath := filepath.Join(t.TempDir(), "access-policy.json")
+	if err := os.WriteFile(policyPath, []byte(testAccessPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := handlers.LoadAccessPolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(handlers.EnvLokiURL, loki.URL)
+	cfg := handlers.LoadConfig()
+	cfg.AccessPolicy = policy
+	handlers.SetConfig(cfg)
+	t.Cleanup(func() { handlers.SetConfig(handlers.LoadConfig()) })
+
+	s := server.NewMCPServer("test", "1.0",
+		server.WithToolHandlerMiddleware(handlers.RequestIDMiddleware),
+		server.WithToolHandlerMiddleware(handlers.AccessPolicyMiddleware),
+	)
+	s.AddTool(handlers.NewLokiQueryTool(), handlers.HandleLokiQuery)
+	s.AddTool(handlers.NewLokiLabelNamesTool(), handlers.HandleLokiLabelNames)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := New(s, middleware.AuthConfig{Token: "secret"})
+	go g.Serve(listener)
+	t.Cleanup(g.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := lokiv1.NewLokiClient(conn)
+	as := func(apiKey string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret", "x-api-key", apiKey)
+	}
+
+	// Calls without the transport credentials are rejected
+	if _, err := client.Query(context.Background(), &lokiv1.QueryRequest{Query: `{app="web"}`}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, but got %v", err)
+	}
+
+	// The analyst's query is scoped to its tenant and namespaces, with options typed by the tool schema
+	result, err := client.Query(as("analyst-key"), &lokiv1.QueryRequest{
+		Connection: &lokiv1.Connection{Org: "team-a"},
+		Query:      `{app="web"}`,
+		Limit:      10,
+		Options:    map[string]string{"strip_ansi": "true", "max_line_length": "80"},
+	})
+	if err != nil {
+		t.Fatalf("Expected the query to succeed, but got %v", err)
+	}
+	if lokiQuery != `{app="web", namespace=~"team-a-.*"}` || lokiOrg != "team-a" {
+		t.Errorf("Expected the query to be scoped to team-a, but got %s (org %s)", lokiQuery, lokiOrg)
+	}
+	if len(result.Content) == 0 || !strings.Contains(strings.Join(result.Content, "\n"), "hello") || !strings.Contains(result.MetaJson, "request_id") {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// The access policy decides which tools a caller may use
+	if _, err := client.Labels(as("analyst-key"), &lokiv1.LabelsRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied, but got %v", err)
+	}
+	if _, err := client.Query(as("analyst-key"), &lokiv1.QueryRequest{Query: `{app="web"}`, Connection: &lokiv1.Connection{Org: "team-b"}}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for another tenant, but got %v", err)
+	}
+	labels, err := client.Labels(as("sre-key"), &lokiv1.LabelsRequest{})
+	if err != nil || !strings.Contains(strings.Join(labels.GetContent(), "\n"), "namespace") {
+		t.Errorf("Expected the SRE to list labels, but got %v (%v)", labels, err)
+	}
+
+	// Unknown options and tools that are not registered are reported
+	if _, err := client.Query(as("sre-key"), &lokiv1.QueryRequest{Query: `{app="web"}`, Options: map[string]string{"nope": "1"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, but got %v", err)
+	}
+	if _, err := client.Query(as("sre-key"), &lokiv1.QueryRequest{Query: `{app="web"}`, Options: map[string]string{"limit": "many"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a non-numeric option, but got %v", err)
+	}
+	if _, err := client.Series(as("sre-key"), &lokiv1.SeriesRequest{Selector: `{app="web"}`}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected Unimplemented, but got %v", err)
+	}
+}
+
+// TestConvertOption tests converting option values to the types of the tool schema
+func TestConvertOption(t *testing.T) {
+	tests := []struct {
+		schemaType any
+		value      string
+		want       string
+	}{
+		{"string", "logfmt", "logfmt"},
+		{"number", "2.5", "2.5"},
+		{"boolean", "true", "true"},
+		{"array", `["a","b"]`, "[a b]"},
+		{"array", "a, b", "[a b]"},
+		{"object", `{"k":"v"}`, "map[k:v]"},
+	}
+	for _, tt := range tests {
+		got, err := convertOption(tt.schemaType, tt.value)
+		if err != nil || fmt.Sprint(got) != tt.want {
+			t.Errorf("convertOption(%v, %q) = %v, %v, want %s", tt.schemaType, tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := convertOption("object", "k=v"); err == nil {
+		t.Error("Expected an error for an invalid object")
+	}
+}
+
+// TestLokiService_Sessions tests that concurrent callers get their own session and JSON-RPC IDs
+func TestLokiService_Sessions(t *testing.T) {
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	t.Cleanup(loki.Close)
+	t.Setenv(handlers.EnvLokiURL, loki.URL)
+	handlers.SetConfig(handlers.LoadConfig())
+	t.Cleanup(func() { handlers.SetConfig(handlers.LoadConfig()) })
+
+	var mu sync.Mutex
+	ids := make(map[any]bool)
+	sessions := make(map[string]map[string]bool)
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, request *mcp.CallToolRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ids[id] {
+			t.Errorf("Expected unique JSON-RPC IDs, but %v was reused", id)
+		}
+		ids[id] = true
+		query, _ := request.GetArguments()["query"].(string)
+		if sessions[query] == nil {
+			sessions[query] = make(map[string]bool)
+		}
+		sessions[query][handlers.SessionKey(ctx)] = true
+	})
+	s := server.NewMCPServer("test", "1.0", server.WithHooks(hooks))
+	s.AddTool(handlers.NewLokiQueryTool(), handlers.HandleLokiQuery)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := New(s, middleware.AuthConfig{})
+	go g.Serve(listener)
+	t.Cleanup(g.Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := lokiv1.NewLokiClient(conn)
+
+	// Two callers with their own API keys query concurrently, as do callers without credentials
+	callers := map[string]string{`{app="a"}`: "key-a", `{app="b"}`: "key-b", `{app="anonymous"}`: ""}
+	var wg sync.WaitGroup
+	for query, apiKey := range callers {
+		ctx := context.Background()
+		if apiKey != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", apiKey)
+		}
+		for range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := client.Query(ctx, &lokiv1.QueryRequest{Query: query}); err != nil {
+					t.Errorf("Expected the query to succeed, but got %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if len(ids) != 15 {
+		t.Errorf("Expected 15 tool calls, but got %d", len(ids))
+	}
+	a, b := sessions[`{app="a"}`], sessions[`{app="b"}`]
+	if len(a) != 1 || len(b) != 1 || fmt.Sprint(a) == fmt.Sprint(b) || a["default"] || b["default"] {
+		t.Errorf("Expected one session per caller, but got %v and %v", a, b)
+	}
+	if anonymous := sessions[`{app="anonymous"}`]; len(anonymous) != 5 || anonymous["default"] {
+		t.Errorf("Expected a session per call without credentials, but got %v", anonymous)
+	}
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Environment variable name for the JSON file mapping client identities to roles
+const EnvLokiAccessPolicyFile = "LOKI_ACCESS_POLICY_FILE"
+
+// APIKeyHeader is the request header clients may send their API key in, instead of Authorization
+const APIKeyHeader = "X-API-Key"
+
+// How long claims fetched from the OIDC userinfo endpoint are cached
+const userinfoCacheTTL = 5 * time.Minute
+
+// AccessRole is a set of permissions: the tools a client may call, the tenants it may query and
+// the label values its queries are restricted to. Empty lists place no restriction. Daily quotas
+// replace the LOKI_MCP_DAILY_*_QUOTA defaults for the role's clients.
+type AccessRole struct {
+	Tools        []string          `json:"tools"`                   // tool names or glob patterns, e.g. loki_label_*
+	Tenants      []string          `json:"tenants,omitempty"`       // allowed organization IDs
+	Labels       map[string]string `json:"labels,omitempty"`        // label name to regular expression its values must match
+	DailyQueries int64             `json:"daily_queries,omitempty"` // queries per UTC day
+	DailyBytes   string            `json:"daily_bytes,omitempty"`   // bytes processed per UTC day, e.g. 50GB
+}
+
+// AccessSubject maps a client identity, an API key or OIDC claims, to a role
+type AccessSubject struct {
+	Name   string            `json:"name"`
+	APIKey string            `json:"api_key,omitempty"`
+	Claims map[string]string `json:"claims,omitempty"` // e.g. {"groups": "sre"}; list claims must contain the value
+	Role   string            `json:"role"`
+}
+
+// AccessPolicy maps the identities of HTTP transport clients to roles. Subjects are matched
+// in order, and clients matching none get the default role, or are rejected without one.
+type AccessPolicy struct {
+	Roles       map[string]AccessRole `json:"roles"`
+	Subjects    []AccessSubject       `json:"subjects"`
+	DefaultRole string                `json:"default_role,omitempty"`
+	Issuer      string                `json:"issuer,omitempty"` // OIDC issuer providing claims, by default LOKI_OIDC_ISSUER
+}
+
+// clientCredentialsKey is the context key for the credentials an HTTP transport client presented
+type clientCredentialsKey struct{}
+
+// accessScopeKey is the context key for the role of the client making a tool call
+type accessScopeKey struct{}
+
+// accessSubjectKey is the context key for the name of the subject the client matched
+type accessSubjectKey struct{}
+
+// Subject name of clients matching no subject, given the default role
+const defaultRoleSubject = "default role"
+
+// clientCredentials are the bearer token and API key of an HTTP transport request
+type clientCredentials struct {
+	BearerToken string
+	APIKey      string
+}
+
+// cachedClaims are userinfo claims with their expiry
+type cachedClaims struct {
+	claims  map[string]any
+	expires time.Time
+}
+
+// userinfoCache caches userinfo claims by token hash
+var userinfoCache = struct {
+	sync.Mutex
+	claims map[[sha256.Size]byte]cachedClaims
+}{claims: make(map[[sha256.Size]byte]cachedClaims)}
+
+// LoadAccessPolicy reads and validates an access policy file
+func LoadAccessPolicy(path string) (*AccessPolicy, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access policy file: %w", err)
+	}
+	var policy AccessPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse access policy file %s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid access policy file %s: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// validate checks that subjects refer to defined roles and have an identity
+func (p *AccessPolicy) validate() error {
+	if p.DefaultRole != "" {
+		if _, ok := p.Roles[p.DefaultRole]; !ok {
+			return fmt.Errorf("default role %s is not defined", p.DefaultRole)
+		}
+	}
+	for name, role := range p.Roles {
+		for label := range role.Labels {
+			if !labelNamePattern.MatchString(label) {
+				return fmt.Errorf("role %s: invalid label name: %s", name, label)
+			}
+		}
+		if role.DailyBytes != "" {
+			if _, err := parseByteSize(role.DailyBytes); err != nil {
+				return fmt.Errorf("role %s: daily_bytes: %v", name, err)
+			}
+		}
+	}
+	for i, s := range p.Subjects {
+		name := s.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		if _, ok := p.Roles[s.Role]; !ok {
+			return fmt.Errorf("subject %s: role %q is not defined", name, s.Role)
+		}
+		if (s.APIKey == "") == (len(s.Claims) == 0) {
+			return fmt.Errorf("subject %s: exactly one of api_key or claims is required", name)
+		}
+	}
+	return nil
+}
+
+// ClientCredentialsContextFunc captures the credentials of an HTTP transport request for the access policy
+func ClientCredentialsContextFunc(ctx context.Context, r *http.Request) context.Context {
+	creds := clientCredentials{APIKey: r.Header.Get(APIKeyHeader)}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		creds.BearerToken = strings.TrimSpace(token)
+	}
+	return context.WithValue(ctx, clientCredentialsKey{}, creds)
+}
+
+// AccessPolicyMiddleware enforces the access policy on tool calls received over the HTTP
+// transports. The client's role decides which tools it may call; its tenants and label
+// restrictions are applied to the Loki requests the tool makes. Calls over stdio are not restricted.
+func AccessPolicyMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		policy := CurrentConfig().AccessPolicy
+		creds, ok := ctx.Value(clientCredentialsKey{}).(clientCredentials)
+		if policy == nil || !ok {
+			return next(ctx, request)
+		}
+
+		subject, role, err := policy.resolve(ctx, creds)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(role.Tools, func(pattern string) bool { return matchesToolList(request.Params.Name, pattern) }) {
+			return nil, &PolicyViolationError{Reason: fmt.Sprintf("tool %s is not allowed for %s", request.Params.Name, subject)}
+		}
+		ctx = context.WithValue(ctx, accessScopeKey{}, &role)
+		if subject != defaultRoleSubject {
+			ctx = context.WithValue(ctx, accessSubjectKey{}, subject)
+		}
+		return next(ctx, request)
+	}
+}
+
+// resolve returns the name and role of the first subject matching the credentials
+func (p *AccessPolicy) resolve(ctx context.Context, creds clientCredentials) (string, AccessRole, error) {
+	var claims map[string]any
+	var claimsErr error
+	for _, s := range p.Subjects {
+		if s.APIKey != "" {
+			for _, key := range []string{creds.APIKey, creds.BearerToken} {
+				if key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.APIKey)) == 1 {
+					return s.Name, p.Roles[s.Role], nil
+				}
+			}
+			continue
+		}
+		if claims == nil && claimsErr == nil {
+			claims, claimsErr = userinfoClaims(ctx, p.issuer(), creds.BearerToken)
+		}
+		if claimsErr == nil && matchesClaims(claims, s.Claims) {
+			return s.Name, p.Roles[s.Role], nil
+		}
+	}
+	if p.DefaultRole != "" {
+		return defaultRoleSubject, p.Roles[p.DefaultRole], nil
+	}
+	if claimsErr != nil {
+		return "", AccessRole{}, &PolicyViolationError{Reason: fmt.Sprintf("client identity could not be verified: %v", claimsErr)}
+	}
+	return "", AccessRole{}, &PolicyViolationError{Reason: "client identity is not granted any role"}
+}
+
+// matchesClaims reports whether the claims contain every required value. A list claim, such as
+// groups, matches when it contains the value.
+func matchesClaims(claims map[string]any, required map[string]string) bool {
+	for name, value := range required {
+		switch claim := claims[name].(type) {
+		case string:
+			if claim != value {
+				return false
+			}
+		case []any:
+			if !slices.Contains(claim, any(value)) {
+				return false
+			}
+		default:
+			if fmt.Sprint(claim) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// userinfoClaims fetches the claims of an OIDC access token from the issuer's userinfo endpoint,
+// which also verifies the token
+func userinfoClaims(ctx context.Context, issuer, token string) (map[string]any, error) {
+	if token == "" {
+		return nil, fmt.Errorf("no bearer token")
+	}
+	if issuer == "" {
+		return nil, fmt.Errorf("an issuer is required to match OIDC claims")
+	}
+
+	key := sha256.Sum256([]byte(token))
+	userinfoCache.Lock()
+	cached, ok := userinfoCache.claims[key]
+	userinfoCache.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.claims, nil
+	}
+
+	endpoint, err := oidcDiscoveredEndpoint(ctx, issuer, "userinfo_endpoint")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var claims map[string]any
+	status, err := doOIDCRequest(req, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %v", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("userinfo request failed with status %d", status)
+	}
+
+	userinfoCache.Lock()
+	defer userinfoCache.Unlock()
+	now := time.Now()
+	for k, c := range userinfoCache.claims {
+		if now.After(c.expires) {
+			delete(userinfoCache.claims, k)
+		}
+	}
+	userinfoCache.claims[key] = cachedClaims{claims: claims, expires: now.Add(userinfoCacheTTL)}
+	return claims, nil
+}
+
+// issuer returns the OIDC issuer providing the claims of clients
+func (p *AccessPolicy) issuer() string {
+	if p.Issuer != "" {
+		return p.Issuer
+	}
+	return CurrentConfig().OIDC.Issuer
+}
+
+// accessScopeFromContext returns the role of the client making the tool call, if restricted
+func accessScopeFromContext(ctx context.Context) *AccessRole {
+	role, _ := ctx.Value(accessScopeKey{}).(*AccessRole)
+	return role
+}
+
+// scopeMatchers returns the label matchers a role adds to every stream selector, sorted by label
+func (r *AccessRole) scopeMatchers() []string {
+	labels := make([]string, 0, len(r.Labels))
+	for label := range r.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	matchers := make([]string, 0, len(labels))
+	for _, label := range labels {
+		matchers = append(matchers, label+"=~"+quoteLogQLString(r.Labels[label]))
+	}
+	return matchers
+}
+
+// addScopeMatchers appends a role's label matchers to the body of a stream selector. Unlike
+// mandatory matchers they are added even when the selector already has the label, so Loki only
+// returns streams matching both.
+func addScopeMatchers(inner string, matchers []string) string {
+	parts := make([]string, 0, len(matchers)+1)
+	existing := map[string]bool{}
+	for _, part := range splitOutsideQuotes(inner, ',') {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+			existing[part] = true
+		}
+	}
+	for _, m := range matchers {
+		if !existing[m] {
+			parts = append(parts, m)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// UsesClaims reports whether any subject is matched by OIDC claims
+func (p *AccessPolicy) UsesClaims() bool {
+	return slices.ContainsFunc(p.Subjects, func(s AccessSubject) bool { return len(s.Claims) > 0 })
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const testAccessPolicy = `{
+  "roles": {
+    "analyst": {"tools": ["loki_query", "loki_label_*"], "tenants": ["team-a"], "labels": {"namespace": "team-a-.*"}},
+    "sre": {"tools": ["*"]}
+  },
+  "subjects": [
+    {"name": "dashboards", "api_key": "${ANALYST_KEY}", "role": "analyst"},
+    {"name": "sre-group", "claims": {"groups": "sre"}, "role": "sre"}
+  ],
+  "issuer": "${IDP_URL:-}"
+}`
+
+// writeAccessPolicy writes an access policy file and returns its path
+func writeAccessPolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "access-policy.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadAccessPolicy tests loading and validating access policy files
+func TestLoadAccessPolicy(t *testing.T) {
+	setenv(t, "ANALYST_KEY", "analyst-key")
+	policy, err := LoadAccessPolicy(writeAccessPolicy(t, testAccessPolicy))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if policy.Subjects[0].APIKey != "analyst-key" || !policy.UsesClaims() {
+		t.Errorf("Unexpected policy: %+v", policy)
+	}
+
+	invalid := map[string]string{
+		`{"roles": {}, "subjects": [{"api_key": "k", "role": "admin"}]}`:                                        `role "admin" is not defined`,
+		`{"roles": {"a": {"tools": ["*"]}}, "subjects": [{"name": "x", "role": "a"}]}`:                          "exactly one of api_key or claims",
+		`{"roles": {"a": {"tools": ["*"]}}, "subjects": [], "default_role": "b"}`:                               "default role b is not defined",
+		`{"roles": {"a": {"tools": ["*"], "labels": {"bad-label": ".*"}}}, "subjects": []}`:                     "invalid label name",
+		`{"roles": {"a": {"tools": ["*"]}}, "subjects": [{"api_key": "k", "claims": {"g": "x"}, "role": "a"}]}`: "exactly one of api_key or claims",
+		`{"roles": {"a": {"tools": ["*"], "daily_bytes": "lots"}}, "subjects": []}`:                             "role a: daily_bytes: invalid byte size",
+	}
+	for content, expected := range invalid {
+		if _, err := LoadAccessPolicy(writeAccessPolicy(t, content)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q for %s, but got %v", expected, content, err)
+		}
+	}
+}
+
+// TestAccessPolicyMiddleware tests restricting tools, tenants and labels by client identity
+func TestAccessPolicyMiddleware(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	userinfoRequests := 0
+	var idp *httptest.Server
+	idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Write([]byte(`{"userinfo_endpoint": "` + idp.URL + `/userinfo"}`))
+		case "/userinfo":
+			userinfoRequests++
+			switch r.Header.Get("Authorization") {
+			case "Bearer bob-token":
+				w.Write([]byte(`{"sub": "bob", "groups": ["dev", "sre"]}`))
+			case "Bearer carol-token":
+				w.Write([]byte(`{"sub": "carol", "groups": ["dev"]}`))
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	t.Cleanup(idp.Close)
+
+	var lokiQuery url.Values
+	var lokiOrg string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lokiQuery = r.URL.Query()
+		lokiOrg = r.Header.Get("X-Scope-OrgID")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	setenv(t, "ANALYST_KEY", "analyst-key")
+	setenv(t, EnvLokiURL, loki.URL)
+	setenv(t, "IDP_URL", idp.URL)
+	cfg := LoadConfig()
+	policy, err := LoadAccessPolicy(writeAccessPolicy(t, testAccessPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AccessPolicy = policy
+	SetConfig(cfg)
+
+	handler := AccessPolicyMiddleware(HandleLokiQuery)
+	callAs := func(header, value, tool, org string) error {
+		incoming := httptest.NewRequest("POST", "/stream", nil)
+		if header != "" {
+			incoming.Header.Set(header, value)
+		}
+		request := mcp.CallToolRequest{}
+		request.Params.Name = tool
+		request.Params.Arguments = map[string]any{"query": `{app="web"}`, "org": org}
+		_, err := handler(HTTPContextFunc(context.Background(), incoming), request)
+		return err
+	}
+
+	// The analyst's queries are limited to its tenant and namespaces
+	if err := callAs(APIKeyHeader, "analyst-key", "loki_query", "team-a"); err != nil {
+		t.Fatalf("Expected the analyst query to succeed, but got %v", err)
+	}
+	if got := lokiQuery.Get("query"); got != `{app="web", namespace=~"team-a-.*"}` || lokiOrg != "team-a" {
+		t.Errorf("Expected the query to be scoped to team-a, but got %s (org %s)", got, lokiOrg)
+	}
+	if err := callAs(APIKeyHeader, "analyst-key", "loki_query", "team-b"); err == nil || !strings.Contains(err.Error(), "team-b is not allowed") {
+		t.Errorf("Expected team-b to be rejected, but got %v", err)
+	}
+	if err := callAs("Authorization", "Bearer analyst-key", "loki_delete_logs", "team-a"); err == nil || !strings.Contains(err.Error(), "not allowed for dashboards") {
+		t.Errorf("Expected the tool to be rejected, but got %v", err)
+	}
+
+	// SREs are matched by their OIDC group claim and are not restricted
+	for range 2 {
+		if err := callAs("Authorization", "Bearer bob-token", "loki_query", "team-b"); err != nil {
+			t.Fatalf("Expected the SRE query to succeed, but got %v", err)
+		}
+	}
+	if got := lokiQuery.Get("query"); got != `{app="web"}` || userinfoRequests != 1 {
+		t.Errorf("Expected an unscoped query and cached claims, but got %s after %d userinfo requests", got, userinfoRequests)
+	}
+	if err := callAs("Authorization", "Bearer carol-token", "loki_query", "team-a"); err == nil || !strings.Contains(err.Error(), "not granted any role") {
+		t.Errorf("Expected carol to be rejected, but got %v", err)
+	}
+	if err := callAs("", "", "loki_query", "team-a"); err == nil || !strings.Contains(err.Error(), "could not be verified") {
+		t.Errorf("Expected an anonymous client to be rejected, but got %v", err)
+	}
+
+	// Calls over stdio are not restricted
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "loki_query"
+	request.Params.Arguments = map[string]any{"query": `{app="web"}`}
+	if _, err := handler(context.Background(), request); err != nil || lokiQuery.Get("query") != `{app="web"}` {
+		t.Errorf("Expected an unrestricted stdio call, but got %s (%v)", lokiQuery.Get("query"), err)
+	}
+}
+
+// TestAccessPolicyMiddleware_LabelValues tests that label lookups are restricted to the role's streams
+func TestAccessPolicyMiddleware_LabelValues(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	var lokiPath string
+	var lokiQuery url.Values
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lokiPath, lokiQuery = r.URL.Path, r.URL.Query()
+		w.Write([]byte(`{"status":"success","data":["team-a-web"]}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	setenv(t, "ANALYST_KEY", "analyst-key")
+	setenv(t, EnvLokiURL, loki.URL)
+	cfg := LoadConfig()
+	policy, err := LoadAccessPolicy(writeAccessPolicy(t, testAccessPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AccessPolicy = policy
+	SetConfig(cfg)
+
+	incoming := httptest.NewRequest("POST", "/stream", nil)
+	incoming.Header.Set(APIKeyHeader, "analyst-key")
+	ctx := HTTPContextFunc(context.Background(), incoming)
+	for tool, handler := range map[string]server.ToolHandlerFunc{"loki_label_values": HandleLokiLabelValues, "loki_label_names": HandleLokiLabelNames} {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = tool
+		request.Params.Arguments = map[string]any{"label": "namespace", "org": "team-a"}
+		if _, err := AccessPolicyMiddleware(handler)(ctx, request); err != nil {
+			t.Fatalf("%s: expected no error, but got %v", tool, err)
+		}
+		if got := lokiQuery.Get("query"); got != `{namespace=~"team-a-.*"}` {
+			t.Errorf("%s: expected the request to %s to be scoped to team-a, but got query %q", tool, lokiPath, got)
+		}
+	}
+}
+
+// TestAddScopeMatchers tests that role matchers are added even when the label is already present
+func TestAddScopeMatchers(t *testing.T) {
+	matchers := []string{`namespace=~"team-a-.*"`}
+	tests := map[string]string{
+		``:                                  `namespace=~"team-a-.*"`,
+		`app="web"`:                         `app="web", namespace=~"team-a-.*"`,
+		`namespace="team-b"`:                `namespace="team-b", namespace=~"team-a-.*"`,
+		`app="web", namespace=~"team-a-.*"`: `app="web", namespace=~"team-a-.*"`,
+		`msg="a,b"`:                         `msg="a,b", namespace=~"team-a-.*"`,
+	}
+	for inner, expected := range tests {
+		if got := addScopeMatchers(inner, matchers); got != expected {
+			t.Errorf("addScopeMatchers(%q) = %q, expected %q", inner, got, expected)
+		}
+	}
+}
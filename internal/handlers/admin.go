@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for the Grafana Enterprise Logs admin token. The admin tools are only
+// registered when it is set.
+const EnvLokiAdminToken = "LOKI_ADMIN_TOKEN"
+
+// Environment variable name for the admin API URL, when it differs from LOKI_URL
+const EnvLokiAdminURL = "LOKI_ADMIN_URL"
+
+// adminTenant is a tenant of the GEL admin API
+type adminTenant struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Cluster     string `json:"cluster,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+// adminRealm is a tenant and cluster an access policy applies to
+type adminRealm struct {
+	Tenant  string `json:"tenant"`
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// adminAccessPolicy is an access policy of the GEL admin API
+type adminAccessPolicy struct {
+	Name        string       `json:"name"`
+	DisplayName string       `json:"display_name,omitempty"`
+	Realms      []adminRealm `json:"realms"`
+	Scopes      []string     `json:"scopes"`
+	Status      string       `json:"status,omitempty"`
+}
+
+// adminToken is a token of the GEL admin API
+type adminToken struct {
+	Name         string `json:"name"`
+	DisplayName  string `json:"display_name,omitempty"`
+	AccessPolicy string `json:"access_policy"`
+	Expiration   string `json:"expiration,omitempty"`
+	Status       string `json:"status,omitempty"`
+	CreatedAt    string `json:"created_at,omitempty"`
+}
+
+// tokenScopes is a token joined with the scopes and tenants granted by its access policy
+type tokenScopes struct {
+	adminToken
+	Scopes  []string `json:"scopes"`
+	Tenants []string `json:"tenants"`
+}
+
+// AdminEnabled reports whether an admin token is configured, so the admin tools should be registered
+func AdminEnabled() bool {
+	return CurrentConfig().AdminToken != ""
+}
+
+// NewLokiAdminTenantsTool creates and returns a tool for listing the tenants of a GEL cluster
+func NewLokiAdminTenantsTool() mcp.Tool {
+	return mcp.NewTool("loki_admin_tenants",
+		mcp.WithDescription("List the tenants of a Grafana Enterprise Logs cluster with their status, using the admin API. "+
+			"Useful for finding the org ID to query and for platform administration."),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// NewLokiAdminTokensTool creates and returns a tool for listing GEL tokens with their scopes
+func NewLokiAdminTokensTool() mcp.Tool {
+	return mcp.NewTool("loki_admin_tokens",
+		mcp.WithDescription("List the access tokens of a Grafana Enterprise Logs cluster with the scopes (e.g. logs:read) "+
+			"and tenants granted by their access policies, using the admin API. Token secrets are never returned."),
+		mcp.WithString("tenant",
+			mcp.Description("Only list tokens granting access to this tenant"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiAdminTenants handles Loki admin tenants tool requests
+func HandleLokiAdminTenants(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	format := formatArg(request.GetArguments())
+
+	var tenants []adminTenant
+	if err := fetchAdminItems(ctx, "tenants", &tenants); err != nil {
+		return nil, err
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+
+	formattedResult, err := formatAdminTenants(tenants, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// HandleLokiAdminTokens handles Loki admin tokens tool requests
+func HandleLokiAdminTokens(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	tenant, _ := args["tenant"].(string)
+	format := formatArg(args)
+
+	var tokens []adminToken
+	if err := fetchAdminItems(ctx, "tokens", &tokens); err != nil {
+		return nil, err
+	}
+	var policies []adminAccessPolicy
+	if err := fetchAdminItems(ctx, "accesspolicies", &policies); err != nil {
+		return nil, err
+	}
+
+	scopes := joinTokenScopes(tokens, policies, tenant)
+
+	formattedResult, err := formatAdminTokens(scopes, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// joinTokenScopes attaches the scopes and tenants of each token's access policy, keeping only
+// tokens granting access to the tenant when one is given
+func joinTokenScopes(tokens []adminToken, policies []adminAccessPolicy, tenant string) []tokenScopes {
+	byName := make(map[string]adminAccessPolicy)
+	for _, policy := range policies {
+		byName[policy.Name] = policy
+	}
+
+	var result []tokenScopes
+	for _, token := range tokens {
+		policy := byName[token.AccessPolicy]
+		entry := tokenScopes{adminToken: token, Scopes: policy.Scopes, Tenants: []string{}}
+		for _, realm := range policy.Realms {
+			entry.Tenants = append(entry.Tenants, realm.Tenant)
+		}
+		// A realm tenant of * grants access to every tenant
+		if tenant != "" && !slices.Contains(entry.Tenants, tenant) && !slices.Contains(entry.Tenants, "*") {
+			continue
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// fetchAdminItems requests a GEL admin API collection, such as tenants, and decodes its items
+func fetchAdminItems(ctx context.Context, collection string, items any) error {
+	cfg := CurrentConfig()
+	if cfg.AdminToken == "" {
+		return fmt.Errorf("the admin API requires %s to be set", EnvLokiAdminToken)
+	}
+	baseURL := cfg.AdminURL
+	if baseURL == "" {
+		// The first endpoint when LOKI_URL lists several for failover
+		baseURL, _, _ = strings.Cut(cfg.LokiURL, ",")
+		baseURL = strings.TrimSpace(baseURL)
+	}
+
+	adminURL, err := buildLokiRootURL(baseURL, "admin/api/v3/"+collection)
+	if err != nil {
+		return err
+	}
+	// Admin requests are not tenant queries, so they bypass the query policy and carry no org ID
+	// The admin token is always used, even when client credentials are forwarded
+	ctx = withoutClientCredentials(ctx)
+	body, err := sendLokiRequest(ctx, adminURL, "", "", cfg.AdminToken, "")
+	if err != nil {
+		return fmt.Errorf("admin API request for %s failed: %w", collection, err)
+	}
+
+	var response struct {
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to parse admin API response: %v", err)
+	}
+	if len(response.Items) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Items, items); err != nil {
+		return fmt.Errorf("failed to parse admin API response: %v", err)
+	}
+	return nil
+}
+
+// formatAdminTenants formats the tenants into a readable string
+func formatAdminTenants(tenants []adminTenant, format string) (string, error) {
+	switch format {
+	case "json":
+		if tenants == nil {
+			tenants = []adminTenant{}
+		}
+		jsonBytes, err := json.MarshalIndent(tenants, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, t := range tenants {
+			fmt.Fprintf(&b, "%s %s\n", t.Name, t.Status)
+		}
+		return b.String(), nil
+
+	case "text":
+		if len(tenants) == 0 {
+			return "No tenants found", nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d tenants:\n", len(tenants))
+		for _, t := range tenants {
+			fmt.Fprintf(&b, "  %s", t.Name)
+			if t.DisplayName != "" && t.DisplayName != t.Name {
+				fmt.Fprintf(&b, " (%s)", t.DisplayName)
+			}
+			if t.Status != "" {
+				fmt.Fprintf(&b, ": %s", t.Status)
+			}
+			if t.Cluster != "" {
+				fmt.Fprintf(&b, ", cluster %s", t.Cluster)
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
+
+// formatAdminTokens formats the tokens and their scopes into a readable string
+func formatAdminTokens(tokens []tokenScopes, format string) (string, error) {
+	switch format {
+	case "json":
+		if tokens == nil {
+			tokens = []tokenScopes{}
+		}
+		jsonBytes, err := json.MarshalIndent(tokens, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, t := range tokens {
+			fmt.Fprintf(&b, "%s %s %s %s\n", t.Name, t.AccessPolicy, strings.Join(t.Scopes, ","), strings.Join(t.Tenants, ","))
+		}
+		return b.String(), nil
+
+	case "text":
+		if len(tokens) == 0 {
+			return "No tokens found", nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d tokens:\n", len(tokens))
+		for _, t := range tokens {
+			fmt.Fprintf(&b, "  %s (policy %s)", t.Name, t.AccessPolicy)
+			if t.Status != "" {
+				fmt.Fprintf(&b, ": %s", t.Status)
+			}
+			fmt.Fprintf(&b, "\n    Scopes: %s\n    Tenants: %s\n", strings.Join(t.Scopes, ", "), strings.Join(t.Tenants, ", "))
+			if t.Expiration != "" {
+				fmt.Fprintf(&b, "    Expires: %s\n", t.Expiration)
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// adminTestServer serves canned GEL admin API collections and records the authorization header
+func adminTestServer(t *testing.T, authorization *string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/gel/admin/api/v3/tenants":
+			w.Write([]byte(`{"type":"tenant","items":[
+				{"name":"team-b","display_name":"Team B","status":"active","cluster":"prod"},
+				{"name":"team-a","display_name":"Team A","status":"inactive","cluster":"prod"}]}`))
+		case "/gel/admin/api/v3/accesspolicies":
+			w.Write([]byte(`{"type":"accesspolicy","items":[
+				{"name":"readers","scopes":["logs:read"],"realms":[{"tenant":"team-a","cluster":"prod"}]},
+				{"name":"admins","scopes":["admin:read","admin:write"],"realms":[{"tenant":"*","cluster":"prod"}]}]}`))
+		case "/gel/admin/api/v3/tokens":
+			w.Write([]byte(`{"type":"token","items":[
+				{"name":"grafana","access_policy":"readers","status":"active"},
+				{"name":"ops","access_policy":"admins","expiration":"2030-01-01T00:00:00Z"},
+				{"name":"other","access_policy":"missing"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestHandleLokiAdminTenants tests listing tenants with the admin token
+func TestHandleLokiAdminTenants(t *testing.T) {
+	var authorization string
+	server := adminTestServer(t, &authorization)
+	setenv(t, EnvLokiAdminToken, "admin-secret")
+	setenv(t, EnvLokiAdminURL, server.URL+"/gel/loki/api/v1")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"format": "raw"}
+	result, err := HandleLokiAdminTenants(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; text != "team-a inactive\nteam-b active\n" {
+		t.Errorf("Unexpected tenants: %q", text)
+	}
+	if authorization != "Bearer admin-secret" {
+		t.Errorf("Expected the admin token to be sent, but got %q", authorization)
+	}
+
+	setenv(t, EnvLokiAdminToken, "")
+	if _, err := HandleLokiAdminTenants(context.Background(), request); err == nil {
+		t.Error("Expected an error without an admin token")
+	}
+}
+
+// TestHandleLokiAdminTokens tests joining tokens with their access policies
+func TestHandleLokiAdminTokens(t *testing.T) {
+	var authorization string
+	server := adminTestServer(t, &authorization)
+	setenv(t, EnvLokiAdminToken, "admin-secret")
+	setenv(t, EnvLokiAdminURL, server.URL+"/gel")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"format": "json"}
+	result, err := HandleLokiAdminTokens(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var tokens []tokenScopes
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &tokens); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if len(tokens) != 3 || tokens[0].Name != "grafana" || strings.Join(tokens[0].Scopes, ",") != "logs:read" {
+		t.Fatalf("Unexpected tokens: %+v", tokens)
+	}
+	if tokens[1].Name != "ops" || strings.Join(tokens[1].Tenants, ",") != "*" {
+		t.Errorf("Expected the admins policy's tenants for ops, but got %+v", tokens[1])
+	}
+
+	// Tokens for a tenant include those granting access to every tenant
+	request.Params.Arguments = map[string]any{"tenant": "team-a", "format": "raw"}
+	result, err = HandleLokiAdminTokens(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expected := "grafana readers logs:read team-a\nops admins admin:read,admin:write *\n"
+	if text := result.Content[0].(mcp.TextContent).Text; text != expected {
+		t.Errorf("Expected %q, but got %q", expected, text)
+	}
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variable names for anonymizing query results
+const (
+	// EnvLokiAnonymizationFile is the JSON file defining named anonymization profiles
+	EnvLokiAnonymizationFile = "LOKI_ANONYMIZATION_FILE"
+	// EnvLokiAnonymizationProfile is the profile applied to calls that don't use a datasource with its own
+	EnvLokiAnonymizationProfile = "LOKI_ANONYMIZATION_PROFILE"
+	// EnvLokiAnonymizationKey is the key of the hashes replacing values, so they stay the same across
+	// restarts and replicas (default: a random key per process)
+	EnvLokiAnonymizationKey = "LOKI_ANONYMIZATION_KEY"
+)
+
+// Prefix of the hashes replacing anonymized values
+const anonymizedPrefix = "anon:"
+
+// AnonymizationProfile is a named set of rules applied to log lines and stream labels before
+// they are returned, so results can be shared under a data-handling policy
+type AnonymizationProfile struct {
+	// HashFields are JSON or logfmt fields, and labels, whose values are replaced by a keyed
+	// hash. The same value always gets the same hash, so entries can still be correlated.
+	HashFields []string `json:"hash_fields,omitempty"`
+	// HashPatterns are regular expressions whose matches anywhere in a line are hashed
+	HashPatterns []string `json:"hash_patterns,omitempty"`
+	// DropFields are JSON or logfmt fields, and labels, removed entirely
+	DropFields []string `json:"drop_fields,omitempty"`
+	// GeneralizeIPs replaces IPv4 addresses with their /24 network and IPv6 addresses with their /48
+	GeneralizeIPs bool `json:"generalize_ips,omitempty"`
+
+	patterns []*regexp.Regexp
+}
+
+// ipv4Pattern and ipv6Pattern find address candidates, which are checked with net.ParseIP
+var (
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\b`)
+	ipv6Pattern = regexp.MustCompile(`(?i)\b[0-9a-f]{1,4}(?::[0-9a-f]{0,4}){2,7}\b`)
+)
+
+// processAnonymizationKey is the hash key used when LOKI_ANONYMIZATION_KEY is not set
+var processAnonymizationKey = sync.OnceValue(func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+})
+
+// LoadAnonymizationProfiles reads named anonymization profiles from a JSON object mapping
+// profile names to profiles
+func LoadAnonymizationProfiles(path string) (map[string]*AnonymizationProfile, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read anonymization file: %w", err)
+	}
+	var profiles map[string]*AnonymizationProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse anonymization file %s: %w", path, err)
+	}
+	for name, profile := range profiles {
+		if profile == nil {
+			return nil, fmt.Errorf("invalid anonymization file %s: profile %s is empty", path, name)
+		}
+		if err := profile.compile(); err != nil {
+			return nil, fmt.Errorf("invalid anonymization file %s: profile %s: %w", path, name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// compile compiles the profile's hash patterns
+func (p *AnonymizationProfile) compile() error {
+	p.patterns = nil
+	for _, pattern := range p.HashPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid hash pattern %q: %v", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return nil
+}
+
+// CheckAnonymizationProfiles reports a default profile or datasource naming an undefined profile
+func CheckAnonymizationProfiles(cfg *Config) error {
+	check := func(source, profile string) error {
+		if _, ok := cfg.AnonymizationProfiles[profile]; profile != "" && !ok {
+			return fmt.Errorf("%s: unknown anonymization profile %s. Defined profiles: %s", source, profile, strings.Join(anonymizationProfileNames(cfg), ", "))
+		}
+		return nil
+	}
+	if err := check(EnvLokiAnonymizationProfile, cfg.AnonymizationProfile); err != nil {
+		return err
+	}
+	for _, ds := range cfg.Datasources {
+		if err := check("datasource "+ds.Name, ds.Anonymize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveAnonymization returns the profiles applied to a connection: the datasource's profile,
+// or the default one, plus any profile the call asks for. A call can add rules but never remove them.
+func resolveAnonymization(cfg *Config, ds *Datasource, requested string) ([]string, error) {
+	var profiles []string
+	if ds != nil && ds.Anonymize != "" {
+		profiles = append(profiles, ds.Anonymize)
+	} else if cfg.AnonymizationProfile != "" {
+		profiles = append(profiles, cfg.AnonymizationProfile)
+	}
+	if requested != "" && (len(profiles) == 0 || profiles[0] != requested) {
+		if _, ok := cfg.AnonymizationProfiles[requested]; !ok {
+			return profiles, fmt.Errorf("unknown anonymization profile: %s. Defined profiles: %s", requested, strings.Join(anonymizationProfileNames(cfg), ", "))
+		}
+		profiles = append(profiles, requested)
+	}
+	return profiles, nil
+}
+
+// anonymizationProfileNames lists the defined anonymization profiles
+func anonymizationProfileNames(cfg *Config) []string {
+	names := make([]string, 0, len(cfg.AnonymizationProfiles))
+	for name := range cfg.AnonymizationProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// anonymizingClient applies the connection's anonymization profiles to every result of the
+// client it wraps: log lines, the labels of streams, series and metric results, label names
+// and values, and detected fields
+type anonymizingClient struct {
+	LokiClient
+}
+
+// Query implements LokiClient
+func (c anonymizingClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	result, err := c.LokiClient.Query(ctx, conn, query, start, end, limit)
+	if err == nil {
+		anonymizeResult(conn, result)
+	}
+	return result, err
+}
+
+// MetricQuery implements LokiClient
+func (c anonymizingClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	result, err := c.LokiClient.MetricQuery(ctx, conn, query, start, end, step)
+	if err == nil && result != nil {
+		for _, profile := range connectionProfiles(conn) {
+			for i := range result.Data.Result {
+				result.Data.Result[i].Metric = profile.anonymizeLabels(result.Data.Result[i].Metric)
+			}
+		}
+	}
+	return result, err
+}
+
+// Labels implements LokiClient
+func (c anonymizingClient) Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error) {
+	result, err := c.LokiClient.Labels(ctx, conn, start, end)
+	if err == nil && result != nil {
+		for _, profile := range connectionProfiles(conn) {
+			result.Data = slices.DeleteFunc(result.Data, func(label string) bool { return slices.Contains(profile.DropFields, label) })
+		}
+	}
+	return result, err
+}
+
+// LabelValues implements LokiClient. A dropped label has no values.
+func (c anonymizingClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	result, err := c.LokiClient.LabelValues(ctx, conn, label, start, end)
+	if err == nil && result != nil {
+		for _, profile := range connectionProfiles(conn) {
+			if slices.Contains(profile.DropFields, label) {
+				result.Data = []string{}
+				break
+			}
+			for i, value := range result.Data {
+				if slices.Contains(profile.HashFields, label) {
+					value = hashValue(value)
+				}
+				result.Data[i] = profile.anonymizeText(value)
+			}
+		}
+		if len(conn.Anonymize) > 0 {
+			// Generalized values can coincide
+			slices.Sort(result.Data)
+			result.Data = slices.Compact(result.Data)
+		}
+	}
+	return result, err
+}
+
+// Series implements LokiClient
+func (c anonymizingClient) Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error) {
+	result, err := c.LokiClient.Series(ctx, conn, selector, start, end)
+	if err == nil && result != nil {
+		for _, profile := range connectionProfiles(conn) {
+			for i := range result.Data {
+				result.Data[i] = profile.anonymizeLabels(result.Data[i])
+			}
+		}
+	}
+	return result, err
+}
+
+// DetectedFields implements LokiClient
+func (c anonymizingClient) DetectedFields(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (*LokiDetectedFieldsResult, error) {
+	result, err := c.LokiClient.DetectedFields(ctx, conn, query, start, end)
+	if err == nil && result != nil {
+		for _, profile := range connectionProfiles(conn) {
+			result.Fields = slices.DeleteFunc(result.Fields, func(f LokiDetectedField) bool { return slices.Contains(profile.DropFields, f.Label) })
+		}
+	}
+	return result, err
+}
+
+// connectionProfiles returns the anonymization profiles applied to a connection
+func connectionProfiles(conn LokiConnection) []*AnonymizationProfile {
+	if len(conn.Anonymize) == 0 {
+		return nil
+	}
+	profiles := CurrentConfig().AnonymizationProfiles
+	var applied []*AnonymizationProfile
+	for _, name := range conn.Anonymize {
+		if profile, ok := profiles[name]; ok {
+			applied = append(applied, profile)
+		}
+	}
+	return applied
+}
+
+// anonymizeResult applies the connection's anonymization profiles to the lines and labels of a result
+func anonymizeResult(conn LokiConnection, result *LokiResult) {
+	if result == nil {
+		return
+	}
+	for _, profile := range connectionProfiles(conn) {
+		for i := range result.Data.Result {
+			entry := &result.Data.Result[i]
+			entry.Stream = profile.anonymizeLabels(entry.Stream)
+			for _, val := range entry.Values {
+				if len(val) >= 2 {
+					val[1] = profile.anonymizeLine(val[1])
+				}
+			}
+		}
+	}
+}
+
+// anonymizeLabels drops and hashes stream labels and anonymizes the remaining values
+func (p *AnonymizationProfile) anonymizeLabels(labels map[string]string) map[string]string {
+	for _, name := range p.DropFields {
+		delete(labels, name)
+	}
+	for _, name := range p.HashFields {
+		if value, ok := labels[name]; ok {
+			labels[name] = hashValue(value)
+		}
+	}
+	for name, value := range labels {
+		labels[name] = p.anonymizeText(value)
+	}
+	return labels
+}
+
+// anonymizeLine applies the profile to a log line, handling the fields of JSON and logfmt lines
+func (p *AnonymizationProfile) anonymizeLine(line string) string {
+	if len(p.DropFields) > 0 || len(p.HashFields) > 0 {
+		line = p.anonymizeFields(line)
+	}
+	return p.anonymizeText(line)
+}
+
+// anonymizeText hashes pattern matches and generalizes IP addresses in free text
+func (p *AnonymizationProfile) anonymizeText(text string) string {
+	for _, re := range p.patterns {
+		text = re.ReplaceAllStringFunc(text, hashValue)
+	}
+	if p.GeneralizeIPs {
+		text = ipv4Pattern.ReplaceAllStringFunc(text, generalizeIP)
+		text = ipv6Pattern.ReplaceAllStringFunc(text, generalizeIP)
+	}
+	return text
+}
+
+// anonymizeFields drops and hashes the fields of a JSON or logfmt line. Other lines are returned as-is.
+func (p *AnonymizationProfile) anonymizeFields(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "{") {
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+		var obj map[string]any
+		if err := decoder.Decode(&obj); err != nil {
+			return line
+		}
+		for _, path := range p.DropFields {
+			updateJSONField(obj, path, nil)
+		}
+		for _, path := range p.HashFields {
+			updateJSONField(obj, path, func(value any) any { return hashValue(renderJSONValue(value)) })
+		}
+		var b bytes.Buffer
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(obj); err != nil {
+			return line
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+
+	fields, err := parseLogfmt(line)
+	if err != nil || !isKeyValueLine(fields) {
+		return line
+	}
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if slices.Contains(p.DropFields, f.Key) {
+			continue
+		}
+		if slices.Contains(p.HashFields, f.Key) {
+			f.Value = hashValue(f.Value)
+		}
+		parts = append(parts, f.Key+"="+quoteLogfmtValue(f.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// updateJSONField replaces the value at a dotted field path such as "user.email" in a parsed
+// JSON object, or deletes it when replace is nil
+func updateJSONField(obj map[string]any, path string, replace func(any) any) {
+	if value, ok := obj[path]; ok {
+		if replace == nil {
+			delete(obj, path)
+		} else {
+			obj[path] = replace(value)
+		}
+		return
+	}
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return
+	}
+	if nested, ok := obj[head].(map[string]any); ok {
+		updateJSONField(nested, rest, replace)
+	}
+}
+
+// hashValue replaces a value with a short keyed hash, the same for the same value
+func hashValue(value string) string {
+	key := []byte(CurrentConfig().AnonymizationKey)
+	if len(key) == 0 {
+		key = processAnonymizationKey()
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return anonymizedPrefix + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// generalizeIP replaces an IP address with its network: /24 for IPv4 and /48 for IPv6.
+// Text that only looks like an address, such as a time of day, is returned as-is.
+func generalizeIP(candidate string) string {
+	ip := net.ParseIP(candidate)
+	if ip == nil {
+		return candidate
+	}
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(candidate, ":") {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
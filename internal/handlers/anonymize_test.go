@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestAnonymizationProfile tests hashing fields and patterns, dropping fields and generalizing IPs
+func TestAnonymizationProfile(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	SetConfig(&Config{AnonymizationKey: "test-key"})
+
+	profile := &AnonymizationProfile{
+		HashFields:    []string{"user", "client.email"},
+		HashPatterns:  []string{`[\w.+-]+@[\w-]+\.[\w.]+`},
+		DropFields:    []string{"password", "session"},
+		GeneralizeIPs: true,
+	}
+	if err := profile.compile(); err != nil {
+		t.Fatal(err)
+	}
+	alice := hashValue("alice")
+	if alice != hashValue("alice") || alice == hashValue("bob") || !strings.HasPrefix(alice, anonymizedPrefix) {
+		t.Fatalf("Expected consistent, distinct hashes, but got %s", alice)
+	}
+
+	tests := map[string]string{
+		`{"user":"alice","password":"hunter2","ip":"10.1.2.3","client":{"email":"a@example.com","id":7}}`: `{"client":{"email":"` + hashValue("a@example.com") + `","id":7},"ip":"10.1.2.0/24","user":"` + alice + `"}`,
+		`level=info user=alice session=abc msg="login from 192.168.7.20"`:                                 `level=info user=` + alice + ` msg="login from 192.168.7.0/24"`,
+		`mail to bob@example.org from 2001:db8:1234:5678::1 at 10:00:00`:                                  `mail to ` + hashValue("bob@example.org") + ` from 2001:db8:1234::/48 at 10:00:00`,
+		`std::string is not an address, 999.1.1.1 is not either`:                                          `std::string is not an address, 999.1.1.1 is not either`,
+	}
+	for line, expected := range tests {
+		if got := profile.anonymizeLine(line); got != expected {
+			t.Errorf("anonymizeLine(%s) =\n%s, expected\n%s", line, got, expected)
+		}
+	}
+
+	labels := profile.anonymizeLabels(map[string]string{"app": "web", "user": "alice", "session": "abc", "host": "10.0.0.5"})
+	if len(labels) != 3 || labels["user"] != alice || labels["host"] != "10.0.0.0/24" || labels["app"] != "web" {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+}
+
+// TestLoadAnonymizationProfiles tests loading profiles and checking the profiles they are referenced by
+func TestLoadAnonymizationProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anonymization.json")
+	os.WriteFile(path, []byte(`{"external": {"hash_fields": ["user"], "generalize_ips": true}}`), 0o644)
+	profiles, err := LoadAnonymizationProfiles(path)
+	if err != nil || len(profiles) != 1 || !profiles["external"].GeneralizeIPs {
+		t.Fatalf("Unexpected profiles: %v (%v)", profiles, err)
+	}
+
+	cfg := &Config{AnonymizationProfiles: profiles, Datasources: []Datasource{{Name: "prod", URL: "http://prod", Anonymize: "externl"}}}
+	if err := CheckAnonymizationProfiles(cfg); err == nil || !strings.Contains(err.Error(), "datasource prod: unknown anonymization profile externl. Defined profiles: external") {
+		t.Errorf("Expected an unknown profile error, but got %v", err)
+	}
+
+	os.WriteFile(path, []byte(`{"external": {"hash_patterns": ["("]}}`), 0o644)
+	if _, err := LoadAnonymizationProfiles(path); err == nil || !strings.Contains(err.Error(), "profile external: invalid hash pattern") {
+		t.Errorf("Expected an invalid pattern error, but got %v", err)
+	}
+}
+
+// TestHandleLokiQuery_Anonymize tests applying datasource and per-call profiles to query results
+func TestHandleLokiQuery_Anonymize(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"web","user":"alice"},"values":[["1700000000000000000","{\"user\":\"alice\",\"ip\":\"10.1.2.3\"}"]]}]}}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	SetConfig(&Config{
+		LokiURL:          loki.URL,
+		AnonymizationKey: "test-key",
+		AnonymizationProfiles: map[string]*AnonymizationProfile{
+			"users": {HashFields: []string{"user"}},
+			"ips":   {GeneralizeIPs: true},
+		},
+		Datasources: []Datasource{{Name: "shared", URL: loki.URL, Anonymize: "users"}},
+	})
+
+	query := func(args map[string]any) (string, error) {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = args
+		result, err := HandleLokiQuery(context.Background(), request)
+		if err != nil {
+			return "", err
+		}
+		return result.Content[0].(mcp.TextContent).Text, nil
+	}
+
+	text, err := query(map[string]any{"query": `{app="web"}`, "datasource": "shared", "anonymize": "ips", "format": "json"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	alice := hashValue("alice")
+	if strings.Contains(text, "alice") || strings.Contains(text, "10.1.2.3") || !strings.Contains(text, alice) || !strings.Contains(text, "10.1.2.0/24") {
+		t.Errorf("Expected hashed users and generalized IPs, but got %s", text)
+	}
+
+	// Without a profile the results are returned unchanged
+	if text, err := query(map[string]any{"query": `{app="web"}`}); err != nil || !strings.Contains(text, "alice") {
+		t.Errorf("Expected unchanged results, but got %s (%v)", text, err)
+	}
+	if _, err := query(map[string]any{"query": `{app="web"}`, "anonymize": "everything"}); err == nil || !strings.Contains(err.Error(), "unknown anonymization profile: everything") {
+		t.Errorf("Expected an unknown profile error, but got %v", err)
+	}
+}
+
+// anonymizeLokiClient returns canned label values, series and metric results
+type anonymizeLokiClient struct {
+	metricLokiClient
+	values map[string][]string
+}
+
+func (f *anonymizeLokiClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	return &LokiLabelValuesResult{Status: "success", Data: slices.Clone(f.values[label])}, nil
+}
+
+// TestAnonymizingClient tests applying profiles to label names and values, series and metric results
+func TestAnonymizingClient(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	SetConfig(&Config{
+		AnonymizationKey: "test-key",
+		AnonymizationProfiles: map[string]*AnonymizationProfile{
+			"users": {HashFields: []string{"user"}, DropFields: []string{"email"}, GeneralizeIPs: true},
+		},
+	})
+	SetLokiClient(&anonymizeLokiClient{
+		metricLokiClient: metricLokiClient{
+			fakeLokiClient: fakeLokiClient{
+				labels: []string{"app", "email", "user"},
+				series: []map[string]string{{"app": "web", "user": "alice", "email": "alice@example.com"}},
+			},
+			result: &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "vector", Result: []LokiMetricSeries{
+				{Metric: map[string]string{"user": "alice", "client": "10.1.2.3"}},
+			}}},
+		},
+		values: map[string][]string{"user": {"alice", "bob"}, "email": {"alice@example.com"}, "client": {"10.1.2.3", "10.1.2.4"}},
+	})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	ctx := context.Background()
+	conn := LokiConnection{Anonymize: []string{"users"}}
+	client := CurrentLokiClient()
+	if labels, _ := client.Labels(ctx, conn, time.Time{}, time.Time{}); !slices.Equal(labels.Data, []string{"app", "user"}) {
+		t.Errorf("Expected the dropped label to be hidden, but got %v", labels.Data)
+	}
+	if values, _ := client.LabelValues(ctx, conn, "user", time.Time{}, time.Time{}); slices.Contains(values.Data, "alice") || !slices.Contains(values.Data, hashValue("alice")) {
+		t.Errorf("Expected hashed user values, but got %v", values.Data)
+	}
+	if values, _ := client.LabelValues(ctx, conn, "email", time.Time{}, time.Time{}); len(values.Data) != 0 {
+		t.Errorf("Expected no values for a dropped label, but got %v", values.Data)
+	}
+	if values, _ := client.LabelValues(ctx, conn, "client", time.Time{}, time.Time{}); !slices.Equal(values.Data, []string{"10.1.2.0/24"}) {
+		t.Errorf("Expected generalized addresses, but got %v", values.Data)
+	}
+	if series, _ := client.Series(ctx, conn, `{app="web"}`, time.Time{}, time.Time{}); series.Data[0]["user"] != hashValue("alice") || series.Data[0]["email"] != "" {
+		t.Errorf("Expected anonymized series labels, but got %v", series.Data)
+	}
+	if metric, _ := client.MetricQuery(ctx, conn, `sum by (user) (rate({app="web"}[1m]))`, time.Time{}, time.Time{}, time.Minute); metric.Data.Result[0].Metric["user"] != hashValue("alice") {
+		t.Errorf("Expected anonymized metric labels, but got %v", metric.Data.Result[0].Metric)
+	}
+
+	// Without a profile, results are returned unchanged
+	if values, _ := client.LabelValues(ctx, LokiConnection{}, "user", time.Time{}, time.Time{}); !slices.Equal(values.Data, []string{"alice", "bob"}) {
+		t.Errorf("Expected unchanged values, but got %v", values.Data)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the built-in log backends a datasource can use
+const (
+	BackendLoki          = "loki"
+	BackendVictoriaLogs  = "victorialogs"
+	BackendElasticsearch = "elasticsearch"
+)
+
+// backendRegistry holds the clients serving each backend
+var backendRegistry = struct {
+	sync.RWMutex
+	clients map[string]LokiClient
+}{clients: map[string]LokiClient{
+	BackendLoki:          HTTPLokiClient{},
+	BackendVictoriaLogs:  VictoriaLogsClient{},
+	BackendElasticsearch: ElasticsearchClient{},
+}}
+
+// RegisterBackend registers the client serving datasources with the given backend, replacing
+// a built-in backend of the same name.
+//
+// The client receives the LogQL queries of the tools, so an adapter for another log store
+// translates them to its own query language, like ElasticsearchClient does. Forks register backends
+// from an init function, like tools registered with DefaultRegistry.
+func RegisterBackend(name string, client LokiClient) {
+	backendRegistry.Lock()
+	defer backendRegistry.Unlock()
+	backendRegistry.clients[name] = client
+}
+
+// lookupBackend returns the client serving a backend, defaulting to Loki
+func lookupBackend(name string) (LokiClient, bool) {
+	if name == "" {
+		name = BackendLoki
+	}
+	backendRegistry.RLock()
+	defer backendRegistry.RUnlock()
+	client, ok := backendRegistry.clients[name]
+	return client, ok
+}
+
+// backendNames lists the registered backends
+func backendNames() []string {
+	backendRegistry.RLock()
+	defer backendRegistry.RUnlock()
+	names := make([]string, 0, len(backendRegistry.clients))
+	for name := range backendRegistry.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requireLokiBackend returns an error for a connection to a datasource of another backend,
+// for tools calling Loki APIs that have no equivalent in other backends
+func requireLokiBackend(conn LokiConnection, tool string) error {
+	if conn.Backend == "" || conn.Backend == BackendLoki {
+		return nil
+	}
+	return fmt.Errorf("%s requires a Loki datasource, but datasource %s uses the %s backend", tool, conn.Datasource, conn.Backend)
+}
+
+// backendRouter is the default LokiClient, sending each call to the client of the backend of
+// the connection's datasource
+type backendRouter struct{}
+
+// client returns the client serving the connection's backend
+func (backendRouter) client(conn LokiConnection) (LokiClient, error) {
+	client, ok := lookupBackend(conn.Backend)
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %s for datasource %s. Registered backends: %s",
+			conn.Backend, conn.Datasource, strings.Join(backendNames(), ", "))
+	}
+	return client, nil
+}
+
+// Query implements LokiClient
+func (r backendRouter) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	client, err := r.client(conn)
+	if err != nil {
+		return nil, err
+	}
+	return client.Query(ctx, conn, query, start, end, limit)
+}
+
+// MetricQuery implements LokiClient
+func (r backendRouter) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	client, err := r.client(conn)
+	if err != nil {
+		return nil, err
+	}
+	return client.MetricQuery(ctx, conn, query, start, end, step)
+}
+
+// Labels implements LokiClient
+func (r backendRouter) Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error) {
+	client, err := r.client(conn)
+	if err != nil {
+		return nil, err
+	}
+	return client.Labels(ctx, conn, start, end)
+}
+
+// LabelValues implements LokiClient
+func (r backendRouter) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	client, err := r.client(conn)
+	if err != nil {
+		return nil, err
+	}
+	return client.LabelValues(ctx, conn, label, start, end)
+}
+
+// Series implements LokiClient
+func (r backendRouter) Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error) {
+	client, err := r.client(conn)
+	if err != nil {
+		return nil, err
+	}
+	return client.Series(ctx, conn, selector, start, end)
+}
+
+// DetectedFields implements LokiClient
+func (r backendRouter) DetectedFields(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (*LokiDetectedFieldsResult, error) {
+	client, err := r.client(conn)
+	if err != nil {
+		return nil, err
+	}
+	return client.DetectedFields(ctx, conn, query, start, end)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestRegisterBackend tests sending the calls for a datasource to the client of its backend
+func TestRegisterBackend(t *testing.T) {
+	fake := &fakeLokiClient{labels: []string{"index", "host"}}
+	RegisterBackend("custom", fake)
+	t.Cleanup(func() {
+		backendRegistry.Lock()
+		delete(backendRegistry.clients, "custom")
+		backendRegistry.Unlock()
+	})
+	SetConfig(&Config{LokiURL: DefaultLokiURL, Datasources: []Datasource{
+		{Name: "custom", URL: "http://custom:9200", Backend: "custom"},
+		{Name: "gone", URL: "http://gone:9200", Backend: "removed"},
+	}})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+
+	if err := validateDatasources(CurrentConfig().Datasources[:1]); err != nil {
+		t.Errorf("Expected the registered backend to be valid, but got %v", err)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"datasource": "custom"}
+	result, err := HandleLokiLabelNames(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "index") {
+		t.Errorf("Expected the labels of the registered backend, but got:\n%s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"datasource": "gone"}
+	if _, err := HandleLokiLabelNames(context.Background(), request); err == nil || !strings.Contains(err.Error(), "unknown backend removed") {
+		t.Errorf("Expected an unknown backend error, but got %v", err)
+	}
+
+	conn := ResolveLokiConnection(map[string]any{"datasource": "custom"})
+	if err := requireLokiBackend(conn, "loki_limits"); err == nil || !strings.Contains(err.Error(), "uses the custom backend") {
+		t.Errorf("Expected a Loki-only error, but got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits for time bucketing of log queries
+const (
+	maxBuckets     = 1000 // most buckets a time range can be split into
+	bucketBarWidth = 40   // characters of the bar drawn for the busiest bucket
+)
+
+// bucketCount is the number of matching log lines in one time bucket
+type bucketCount struct {
+	Start time.Time `json:"start"`
+	Count float64   `json:"count"`
+}
+
+// bucketReport summarizes the matching log lines of a query per time bucket
+type bucketReport struct {
+	Query   string        `json:"query"`
+	Bucket  string        `json:"bucket"`
+	Total   float64       `json:"total"`
+	First   *time.Time    `json:"first,omitempty"` // start of the first bucket with matching lines
+	Peak    *bucketCount  `json:"peak,omitempty"`  // bucket with the most matching lines
+	Buckets []bucketCount `json:"buckets"`
+}
+
+// bucketOption returns the tool option for counting matching lines per time bucket instead of returning them
+func bucketOption() mcp.ToolOption {
+	return mcp.WithString("bucket",
+		mcp.Description("Instead of log lines, return the number of matching lines per time bucket of this size, e.g. 5m, "+
+			"to find when a problem started before pulling raw lines. Line, sampling and position options are ignored"),
+	)
+}
+
+// parseBucket extracts the bucket size argument, returning 0 when unset
+func parseBucket(args map[string]any) (time.Duration, error) {
+	return durationArg(args, "bucket", 0)
+}
+
+// runBucketedQuery counts the lines matching a log query in buckets of the given size covering the time range
+func runBucketedQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, bucket time.Duration) (bucketReport, error) {
+	report := bucketReport{Query: query, Bucket: formatLogQLDuration(bucket)}
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return report, fmt.Errorf("bucket requires a log query, e.g. {app=\"api\"} |= \"error\", not a metric query")
+	}
+	if n := end.Sub(start) / bucket; n > maxBuckets {
+		return report, fmt.Errorf("bucket %s splits the time range into %d buckets; use a bucket of at least %s",
+			report.Bucket, n, formatLogQLDuration((end.Sub(start)/maxBuckets).Truncate(time.Second)+time.Second))
+	}
+
+	// Each count covers the bucket before its evaluation time, so the first is evaluated one bucket
+	// after the start. Whole seconds keep evaluation times aligned with the returned samples.
+	first := start.Truncate(time.Second).Add(bucket)
+	if first.After(end) {
+		first = end
+	}
+	expr := fmt.Sprintf("sum(count_over_time(%s [%s]))", strings.TrimSpace(query), report.Bucket)
+	result, err := runLokiMetricQuery(ctx, conn, expr, first, end, bucket)
+	if err != nil {
+		return report, err
+	}
+
+	// Loki leaves out buckets without matching lines, so fill them in with zero counts
+	sums := result.sumByTime()
+	for t := first; !t.After(end); t = t.Add(bucket) {
+		count := bucketCount{Start: t.Add(-bucket).UTC(), Count: sums[t.Unix()]}
+		report.Buckets = append(report.Buckets, count)
+		report.Total += count.Count
+		if count.Count == 0 {
+			continue
+		}
+		if report.First == nil {
+			report.First = &count.Start
+		}
+		if report.Peak == nil || count.Count > report.Peak.Count {
+			peak := count
+			report.Peak = &peak
+		}
+	}
+	return report, nil
+}
+
+// formatBuckets renders a bucket report as JSON, or as one line per bucket with a bar scaled to the busiest
+func formatBuckets(report bucketReport, format string) (string, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	var sb strings.Builder
+	if report.Peak == nil {
+		fmt.Fprintf(&sb, "No lines matching the query in %d buckets of %s\n", len(report.Buckets), report.Bucket)
+		return sb.String(), nil
+	}
+	fmt.Fprintf(&sb, "%s lines matching the query in %d buckets of %s; first in the bucket starting %s, peak of %s at %s\n",
+		formatCount(report.Total), len(report.Buckets), report.Bucket, report.First.Format(time.RFC3339),
+		formatCount(report.Peak.Count), report.Peak.Start.Format(time.RFC3339))
+	for _, b := range report.Buckets {
+		bar := strings.Repeat("█", int(b.Count/report.Peak.Count*bucketBarWidth+0.5))
+		if bar == "" && b.Count > 0 {
+			bar = "▏"
+		}
+		fmt.Fprintf(&sb, "%s %8s %s\n", b.Start.Format(time.RFC3339), formatCount(b.Count), bar)
+	}
+	return sb.String(), nil
+}
+
+// formatCount renders a line count without a fractional part
+func formatCount(count float64) string {
+	return fmt.Sprintf("%.0f", count)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestHandleLokiQuery_Bucket tests counting matching lines per bucket, filling in empty buckets
+func TestHandleLokiQuery_Bucket(t *testing.T) {
+	var query, start, step string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, start, step = r.URL.Query().Get("query"), r.URL.Query().Get("start"), r.URL.Query().Get("step")
+		// Counts for the buckets ending at 10:10 and 10:15; the others have no lines
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1705313400,"3"],[1705313700,"12"]]}]}}`))
+	}))
+	defer server.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"query": `{app="api"} |= "error"`, "url": server.URL, "bucket": "5m",
+		"start": "2024-01-15T10:00:00Z", "end": "2024-01-15T10:20:00Z",
+	}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if query != `sum(count_over_time({app="api"} |= "error" [5m]))` || step != "300" {
+		t.Errorf("Unexpected metric query %s with step %s", query, step)
+	}
+	if expected := time.Date(2024, 1, 15, 10, 5, 0, 0, time.UTC).Unix(); start != fmt.Sprint(expected) {
+		t.Errorf("Expected the first evaluation one bucket after the start, but got %s", start)
+	}
+
+	text := result.Content[0].(mcp.TextContent).Text
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected a summary and 4 buckets, but got:\n%s", text)
+	}
+	if !strings.Contains(lines[0], "15 lines matching the query in 4 buckets of 5m; first in the bucket starting 2024-01-15T10:05:00Z, peak of 12 at 2024-01-15T10:10:00Z") {
+		t.Errorf("Unexpected summary: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "2024-01-15T10:00:00Z        0") || !strings.Contains(lines[3], strings.Repeat("█", bucketBarWidth)) {
+		t.Errorf("Unexpected buckets:\n%s", text)
+	}
+}
+
+// TestRunBucketedQuery_Invalid tests rejecting metric queries and buckets too small for the time range
+func TestRunBucketedQuery_Invalid(t *testing.T) {
+	end := time.Now()
+	if _, err := runBucketedQuery(context.Background(), LokiConnection{}, `rate({app="api"}[5m])`, end.Add(-time.Hour), end, time.Minute); err == nil || !strings.Contains(err.Error(), "requires a log query") {
+		t.Errorf("Expected a log query error, but got %v", err)
+	}
+	if _, err := runBucketedQuery(context.Background(), LokiConnection{}, `{app="api"}`, end.Add(-24*time.Hour), end, time.Second); err == nil || !strings.Contains(err.Error(), "at least 87s") {
+		t.Errorf("Expected a bucket size error, but got %v", err)
+	}
+}
+
+// TestFormatBuckets tests the output when no lines matched
+func TestFormatBuckets(t *testing.T) {
+	report := bucketReport{Bucket: "1m", Buckets: []bucketCount{{Start: time.Unix(0, 0)}, {Start: time.Unix(60, 0)}}}
+	if got, _ := formatBuckets(report, "text"); got != "No lines matching the query in 2 buckets of 1m\n" {
+		t.Errorf("Unexpected output: %s", got)
+	}
+	if got, _ := formatBuckets(report, "json"); !strings.Contains(got, `"total": 0`) || strings.Contains(got, "peak") {
+		t.Errorf("Unexpected JSON output: %s", got)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// EnvLokiMaxOutputBytes sets the default output budget of loki_query (default: unlimited)
+const EnvLokiMaxOutputBytes = "LOKI_MAX_OUTPUT_BYTES"
+
+const (
+	// maxBudgetAttempts is how many times a query is re-run with a smaller limit to fit the output budget
+	maxBudgetAttempts = 3
+	// budgetHeadroom is the fraction of the budget a re-run aims for, since entries vary in size
+	budgetHeadroom = 0.9
+)
+
+// budgetAdjustment describes how a query was re-run to fit the output budget
+type budgetAdjustment struct {
+	Budget        int // max_output_bytes
+	OriginalLimit int
+	OriginalBytes int // size of the result at the original limit
+	Limit         int // limit of the returned result
+	Bytes         int // size of the returned result
+}
+
+// maxOutputBytesOption returns the tool option for the output budget
+func maxOutputBytesOption() mcp.ToolOption {
+	return mcp.WithNumber("max_output_bytes",
+		mcp.Description(fmt.Sprintf("Output budget in bytes: when the formatted result is bigger, the query is re-run with a smaller limit "+
+			"so it ends at a whole entry, narrowing the time range covered, and the adjustment is reported "+
+			"(default: %s env var, or no limit)", EnvLokiMaxOutputBytes)),
+	)
+}
+
+// parseOutputBudget extracts the output budget from tool arguments, defaulting to the configured one.
+// 0 means unlimited.
+func parseOutputBudget(args map[string]any) (int, error) {
+	budget, ok := args["max_output_bytes"].(float64)
+	if !ok {
+		return CurrentConfig().MaxOutputBytes, nil
+	}
+	if budget < 1 || budget != math.Trunc(budget) {
+		return 0, fmt.Errorf("max_output_bytes must be a positive whole number")
+	}
+	return int(budget), nil
+}
+
+// nextBudgetLimit estimates the limit at which a result fits the budget from the average size of its
+// entries. It returns less than 1 when the limit cannot be reduced any further.
+func nextBudgetLimit(opts lokiQueryOptions, rendered *renderedQuery, budget int) int {
+	if rendered.Returned == 0 {
+		return 0
+	}
+	fit := float64(rendered.Returned) * budgetHeadroom * float64(budget) / float64(rendered.Bytes)
+	if rendered.Gap {
+		// The limit applies to both the head and the tail of the time range
+		fit /= 2
+	}
+	if opts.Sampling.Rate > 0 {
+		fit /= opts.Sampling.Rate
+	}
+	return min(int(fit), opts.Limit-1)
+}
+
+// String describes the adjustment for the tool result
+func (a *budgetAdjustment) String() string {
+	return fmt.Sprintf("The result at limit %d was %d bytes, over the %d byte output budget, so the limit was reduced to %d (%d bytes). "+
+		"Use the next cursor or a narrower time range for the remaining entries", a.OriginalLimit, a.OriginalBytes, a.Budget, a.Limit, a.Bytes)
+}
+
+// meta returns the adjustment for the _meta field of the tool result
+func (a *budgetAdjustment) meta() map[string]any {
+	return map[string]any{
+		"max_output_bytes": a.Budget,
+		"original_limit":   a.OriginalLimit,
+		"original_bytes":   a.OriginalBytes,
+		"limit":            a.Limit,
+		"bytes":            a.Bytes,
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newBudgetTestServer returns a Loki server answering with limit entries of about 100 bytes each
+func newBudgetTestServer(t *testing.T, limits *[]int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		*limits = append(*limits, limit)
+		var values []string
+		for i := range limit {
+			values = append(values, fmt.Sprintf(`["%d", "line %03d %s"]`, int64(1700000000-i)*1000000000, i, strings.Repeat("x", 60)))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[%s]}]}}`, strings.Join(values, ","))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestHandleLokiQuery_OutputBudget tests re-running a query with a smaller limit to fit the output budget
+func TestHandleLokiQuery_OutputBudget(t *testing.T) {
+	var limits []int
+	server := newBudgetTestServer(t, &limits)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "max_output_bytes": float64(2000)}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if len(text) > 2000 {
+		t.Errorf("Expected the result to fit the budget, but got %d bytes", len(text))
+	}
+	if !strings.HasSuffix(strings.TrimSpace(text), "x") {
+		t.Errorf("Expected the result to end with a whole entry, but got %s", text)
+	}
+	if len(limits) < 2 || limits[0] != 100 || limits[len(limits)-1] >= 100 {
+		t.Fatalf("Expected the query to be re-run with a smaller limit, but got limits %v", limits)
+	}
+
+	adjusted, ok := result.Meta["limit_adjusted"].(map[string]any)
+	if !ok || adjusted["original_limit"] != 100 || adjusted["limit"] != limits[len(limits)-1] || adjusted["max_output_bytes"] != 2000 {
+		t.Errorf("Unexpected limit_adjusted metadata: %v", result.Meta["limit_adjusted"])
+	}
+	if result.Meta["truncated"] != true || result.Meta["next_cursor"] == nil {
+		t.Errorf("Expected a truncated result with a cursor, but got %v", result.Meta)
+	}
+	note := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+	if !strings.Contains(note, fmt.Sprintf("the limit was reduced to %d", limits[len(limits)-1])) {
+		t.Errorf("Expected the adjustment to be reported, but got %s", note)
+	}
+}
+
+// TestHandleLokiQuery_OutputBudgetDefault tests the configured budget and results that already fit
+func TestHandleLokiQuery_OutputBudgetDefault(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	var limits []int
+	server := newBudgetTestServer(t, &limits)
+	SetConfig(&Config{LokiURL: server.URL, MaxOutputBytes: 1 << 20})
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "limit": float64(10)}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(limits) != 1 || result.Meta["limit_adjusted"] != nil {
+		t.Errorf("Expected a single query without adjustment, but got limits %v and %v", limits, result.Meta["limit_adjusted"])
+	}
+
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "max_output_bytes": float64(1.5)}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "max_output_bytes must be a positive whole number") {
+		t.Errorf("Expected an invalid budget error, but got %v", err)
+	}
+}
+
+// TestNextBudgetLimit tests estimating the limit that fits the budget
+func TestNextBudgetLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     lokiQueryOptions
+		rendered renderedQuery
+		expected int
+	}{
+		{"proportional", lokiQueryOptions{Limit: 100}, renderedQuery{Returned: 100, Bytes: 10000}, 45},
+		{"head and tail", lokiQueryOptions{Limit: 100}, renderedQuery{Returned: 200, Bytes: 20000, Gap: true}, 22},
+		{"sample rate", lokiQueryOptions{Limit: 1000, Sampling: sampleOptions{Rate: 0.1}}, renderedQuery{Returned: 100, Bytes: 10000}, 450},
+		{"always smaller", lokiQueryOptions{Limit: 10}, renderedQuery{Returned: 20, Bytes: 5001}, 9},
+		{"single entry", lokiQueryOptions{Limit: 1}, renderedQuery{Returned: 1, Bytes: 10000}, 0},
+	}
+	for _, test := range tests {
+		if limit := nextBudgetLimit(test.opts, &test.rendered, 5000); limit != test.expected {
+			t.Errorf("%s: expected %d, but got %d", test.name, test.expected, limit)
+		}
+	}
+}
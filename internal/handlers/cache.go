@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variable names for caching Loki responses
+const (
+	// EnvLokiCacheTTL enables caching the responses for time ranges that ended in the past, and sets
+	// how long they are kept, e.g. 24h (default: caching disabled)
+	EnvLokiCacheTTL = "LOKI_CACHE_TTL"
+	// EnvLokiCacheDir persists cached responses in a directory, so a restarted server keeps a warm
+	// cache (default: in memory only)
+	EnvLokiCacheDir = "LOKI_CACHE_DIR"
+	// EnvLokiCacheMaxSize is the total size of the cached responses kept in memory, and separately in
+	// the cache directory, e.g. 2GB (default: 512MB)
+	EnvLokiCacheMaxSize = "LOKI_CACHE_MAX_SIZE"
+)
+
+const (
+	// cacheSettleTime is how long ago a time range must have ended for its response to be cached,
+	// since late log lines can still arrive for the most recent minutes
+	cacheSettleTime = 5 * time.Minute
+	// maxCacheEntries is the number of responses kept in memory
+	maxCacheEntries = 1000
+	// defaultCacheMaxSize is the total size of the cached responses unless LOKI_CACHE_MAX_SIZE is set
+	defaultCacheMaxSize = 512 * 1000 * 1000
+	// cacheEntryShare is the fraction of the total size a single response may take; larger
+	// responses are not cached, so one huge query doesn't evict everything else
+	cacheEntryShare = 10
+)
+
+// cachedResponse is a Loki response body stored in the cache
+type cachedResponse struct {
+	URL    string    `json:"url"`
+	Stored time.Time `json:"stored"`
+	Body   []byte    `json:"body"`
+}
+
+// responseCache holds cached responses by key, evicting the oldest beyond maxCacheEntries or the
+// maximum cache size
+var responseCache = struct {
+	sync.Mutex
+	entries map[string]*cachedResponse
+	order   []string // keys in the order they were stored
+	size    int64    // total size of the bodies held
+}{entries: make(map[string]*cachedResponse)}
+
+// cacheMaxSize returns the total size of the cached responses kept in memory and on disk
+func cacheMaxSize(cfg *Config) int64 {
+	if cfg.CacheMaxSize > 0 {
+		return cfg.CacheMaxSize
+	}
+	return defaultCacheMaxSize
+}
+
+// responseCacheKey returns the cache key of a request, and whether its response may be cached:
+// caching is enabled and the request's time range ended more than cacheSettleTime ago
+func responseCacheKey(req *http.Request, requestURL string) (string, bool) {
+	if CurrentConfig().CacheTTL <= 0 {
+		return "", false
+	}
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", false
+	}
+	end, _, ok := parseLokiTimestamp(u.Query().Get("end"))
+	if !ok || time.Since(end) < cacheSettleTime {
+		return "", false
+	}
+	return requestKey(req, requestURL), true
+}
+
+// requestKey identifies a request by its URL and the headers sent, except the request ID, so
+// callers with different credentials or tenants never share a response
+func requestKey(req *http.Request, requestURL string) string {
+	h := sha256.New()
+	h.Write([]byte(requestURL))
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if name != RequestIDHeader {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Write([]byte("\n" + name + ": " + strings.Join(req.Header[name], ", ")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedResponseBody returns the cached response for a key, reading it from the cache directory
+// when it is not in memory. Expired entries are removed.
+func cachedResponseBody(key string) ([]byte, bool) {
+	cfg := CurrentConfig()
+	responseCache.Lock()
+	entry, ok := responseCache.entries[key]
+	responseCache.Unlock()
+
+	if !ok && cfg.CacheDir != "" {
+		data, err := os.ReadFile(cacheFilePath(cfg.CacheDir, key))
+		if err != nil {
+			return nil, false
+		}
+		entry = &cachedResponse{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			os.Remove(cacheFilePath(cfg.CacheDir, key))
+			return nil, false
+		}
+		rememberResponse(key, entry)
+	}
+	if entry == nil {
+		return nil, false
+	}
+	if time.Since(entry.Stored) > cfg.CacheTTL {
+		forgetResponse(cfg, key)
+		return nil, false
+	}
+	return entry.Body, true
+}
+
+// storeResponse caches a response body, and writes it to the cache directory when one is set.
+// Responses larger than a cacheEntryShare of the maximum cache size are not cached.
+func storeResponse(key, requestURL string, body []byte) {
+	cfg := CurrentConfig()
+	maxSize := cacheMaxSize(cfg)
+	if int64(len(body)) > maxSize/cacheEntryShare {
+		return
+	}
+	entry := &cachedResponse{URL: redactURL(requestURL), Stored: time.Now(), Body: body}
+	rememberResponse(key, entry)
+	if cfg.CacheDir == "" {
+		return
+	}
+	if err := writeCacheFile(cfg.CacheDir, key, entry); err != nil {
+		slog.Warn("failed to persist cached response", "dir", cfg.CacheDir, "error", err)
+		return
+	}
+	trimCacheDir(cfg.CacheDir, maxSize)
+}
+
+// rememberResponse adds a response to the in-memory cache, evicting the oldest beyond
+// maxCacheEntries or the maximum cache size
+func rememberResponse(key string, entry *cachedResponse) {
+	maxSize := cacheMaxSize(CurrentConfig())
+	responseCache.Lock()
+	defer responseCache.Unlock()
+	if previous, ok := responseCache.entries[key]; ok {
+		responseCache.size -= int64(len(previous.Body))
+	} else {
+		responseCache.order = append(responseCache.order, key)
+	}
+	responseCache.entries[key] = entry
+	responseCache.size += int64(len(entry.Body))
+	for len(responseCache.order) > maxCacheEntries || (responseCache.size > maxSize && len(responseCache.order) > 0) {
+		oldest := responseCache.order[0]
+		if evicted, ok := responseCache.entries[oldest]; ok {
+			responseCache.size -= int64(len(evicted.Body))
+			delete(responseCache.entries, oldest)
+		}
+		responseCache.order = responseCache.order[1:]
+	}
+}
+
+// forgetResponse removes a response from memory and from the cache directory
+func forgetResponse(cfg *Config, key string) {
+	responseCache.Lock()
+	if entry, ok := responseCache.entries[key]; ok {
+		responseCache.size -= int64(len(entry.Body))
+		delete(responseCache.entries, key)
+		responseCache.order = slices.DeleteFunc(responseCache.order, func(k string) bool { return k == key })
+	}
+	responseCache.Unlock()
+	if cfg.CacheDir != "" {
+		os.Remove(cacheFilePath(cfg.CacheDir, key))
+	}
+}
+
+// writeCacheFile writes a cached response to the cache directory, replacing any previous file atomically
+func writeCacheFile(dir, key string, entry *cachedResponse) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Responses hold log lines, so only the server's user may read them. CreateTemp uses mode 0600.
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), cacheFilePath(dir, key))
+}
+
+// cacheFilePath returns the path of the file holding a cached response
+func cacheFilePath(dir, key string) string {
+	return filepath.Join(dir, key+".json")
+}
+
+// trimCacheDir removes the oldest files from the cache directory until the responses it holds
+// fit in the maximum size, returning how many were removed
+func trimCacheDir(dir string, maxSize int64) int {
+	files, err := filepath.Glob(cacheFilePath(dir, "*"))
+	if err != nil {
+		return 0
+	}
+	type cacheFile struct {
+		path     string
+		size     int64
+		modified time.Time
+	}
+	var cached []cacheFile
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			cached = append(cached, cacheFile{file, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+	}
+	if total <= maxSize {
+		return 0
+	}
+	sort.Slice(cached, func(i, j int) bool { return cached[i].modified.Before(cached[j].modified) })
+	removed := 0
+	for _, file := range cached {
+		if total <= maxSize {
+			break
+		}
+		if os.Remove(file.path) == nil {
+			total -= file.size
+			removed++
+		}
+	}
+	return removed
+}
+
+// PruneResponseCache removes expired responses and the files of interrupted writes from the cache
+// directory, then the oldest responses beyond the maximum size, returning how many were removed
+func PruneResponseCache(cfg *Config) int {
+	if cfg.CacheDir == "" || cfg.CacheTTL <= 0 {
+		return 0
+	}
+	files, err := filepath.Glob(cacheFilePath(cfg.CacheDir, "*"))
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, file := range files {
+		var entry cachedResponse
+		data, err := os.ReadFile(file)
+		if err == nil && json.Unmarshal(data, &entry) == nil && time.Since(entry.Stored) <= cfg.CacheTTL {
+			continue
+		}
+		if os.Remove(file) == nil {
+			removed++
+		}
+	}
+	temps, _ := filepath.Glob(filepath.Join(cfg.CacheDir, "*.tmp"))
+	for _, file := range temps {
+		if os.Remove(file) == nil {
+			removed++
+		}
+	}
+	return removed + trimCacheDir(cfg.CacheDir, cacheMaxSize(cfg))
+}
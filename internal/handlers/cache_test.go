@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetResponseCache empties the in-memory response cache, as after a restart
+func resetResponseCache() {
+	responseCache.Lock()
+	defer responseCache.Unlock()
+	responseCache.entries = make(map[string]*cachedResponse)
+	responseCache.order = nil
+	responseCache.size = 0
+}
+
+// TestSendLokiRequest_Cache tests caching responses for past time ranges only
+func TestSendLokiRequest_Cache(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil); resetResponseCache() })
+	requests := 0
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"status":"success","n":%d}`, requests)
+	}))
+	t.Cleanup(loki.Close)
+	dir := filepath.Join(t.TempDir(), "cache")
+	SetConfig(&Config{LokiURL: loki.URL, CacheTTL: time.Hour, CacheDir: dir})
+
+	past := fmt.Sprintf("%s/loki/api/v1/query_range?query=x&end=%d", loki.URL, time.Now().Add(-time.Hour).UnixNano())
+	for i := 0; i < 2; i++ {
+		body, err := sendLokiRequest(context.Background(), past, "", "", "", "")
+		if err != nil || string(body) != `{"status":"success","n":1}` {
+			t.Fatalf("Expected the first response, but got %s (%v)", body, err)
+		}
+	}
+
+	// Another tenant doesn't share the cached response
+	if body, _ := sendLokiRequest(context.Background(), past, "", "", "", "tenant-b"); string(body) != `{"status":"success","n":2}` {
+		t.Errorf("Expected a new response for another tenant, but got %s", body)
+	}
+
+	// Recent time ranges are always sent to Loki
+	recent := fmt.Sprintf("%s/loki/api/v1/query_range?query=x&end=%d", loki.URL, time.Now().UnixNano())
+	for i := 3; i < 5; i++ {
+		if body, _ := sendLokiRequest(context.Background(), recent, "", "", "", ""); string(body) != fmt.Sprintf(`{"status":"success","n":%d}`, i) {
+			t.Errorf("Expected response %d for a recent range, but got %s", i, body)
+		}
+	}
+
+	// The cache directory survives a restart
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 cached files, but got %v", files)
+	}
+	if info, err := os.Stat(files[0]); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a cached file readable only by its owner, but got %v (%v)", info.Mode(), err)
+	}
+	resetResponseCache()
+	if body, _ := sendLokiRequest(context.Background(), past, "", "", "", ""); string(body) != `{"status":"success","n":1}` {
+		t.Errorf("Expected the persisted response, but got %s", body)
+	}
+	if requests != 4 {
+		t.Errorf("Expected 4 requests to Loki, but got %d", requests)
+	}
+}
+
+// TestResponseCache_Expiry tests that expired responses are fetched again and pruned on startup
+func TestResponseCache_Expiry(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil); resetResponseCache() })
+	dir := t.TempDir()
+	cfg := &Config{CacheTTL: time.Hour, CacheDir: dir}
+	SetConfig(cfg)
+
+	writeCacheFile(dir, "old", &cachedResponse{Stored: time.Now().Add(-2 * time.Hour), Body: []byte("old")})
+	writeCacheFile(dir, "new", &cachedResponse{Stored: time.Now(), Body: []byte("new")})
+	os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0o600)
+
+	if _, ok := cachedResponseBody("old"); ok {
+		t.Error("Expected an expired response not to be served")
+	}
+	if body, ok := cachedResponseBody("new"); !ok || string(body) != "new" {
+		t.Errorf("Expected the cached response, but got %s", body)
+	}
+
+	writeCacheFile(dir, "old", &cachedResponse{Stored: time.Now().Add(-2 * time.Hour), Body: []byte("old")})
+	if removed := PruneResponseCache(cfg); removed != 2 {
+		t.Errorf("Expected 2 files removed, but got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.json")); err != nil {
+		t.Errorf("Expected the fresh response to be kept, but got %v", err)
+	}
+}
+
+// TestResponseCacheKey_Disabled tests that nothing is cached unless a TTL is set
+func TestResponseCacheKey_Disabled(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	SetConfig(&Config{})
+	requestURL := fmt.Sprintf("http://loki/loki/api/v1/query_range?end=%d", time.Now().Add(-time.Hour).Unix())
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	if _, ok := responseCacheKey(req, requestURL); ok {
+		t.Error("Expected no caching without a TTL")
+	}
+}
+
+// TestResponseCache_MaxSize tests evicting the oldest responses beyond the maximum size, in memory
+// and on disk, and not caching responses too large for the cache
+func TestResponseCache_MaxSize(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil); resetResponseCache() })
+	resetResponseCache()
+	dir := t.TempDir()
+	SetConfig(&Config{CacheTTL: time.Hour, CacheDir: dir, CacheMaxSize: 1000})
+
+	body := []byte(strings.Repeat("x", 90))
+	for i := range 15 {
+		storeResponse(fmt.Sprintf("k%02d", i), "http://loki/loki/api/v1/query_range", body)
+	}
+	storeResponse("large", "http://loki/loki/api/v1/query_range", []byte(strings.Repeat("x", 101)))
+
+	responseCache.Lock()
+	size := responseCache.size
+	_, hasOldest := responseCache.entries["k00"]
+	_, hasNewest := responseCache.entries["k14"]
+	_, hasLarge := responseCache.entries["large"]
+	responseCache.Unlock()
+	if size > 1000 || hasOldest || !hasNewest || hasLarge {
+		t.Errorf("Expected the oldest responses evicted from memory, but got size %d, oldest %v, newest %v, large %v", size, hasOldest, hasNewest, hasLarge)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var total int64
+	for _, file := range files {
+		info, _ := os.Stat(file)
+		total += info.Size()
+	}
+	if total > 1000 || len(files) == 0 || len(files) == 15 {
+		t.Errorf("Expected the cache directory trimmed to 1000 bytes, but got %d bytes in %d files", total, len(files))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "k14.json")); err != nil {
+		t.Errorf("Expected the newest response to be kept on disk, but got %v", err)
+	}
+}
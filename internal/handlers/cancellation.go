@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MethodNotificationCancelled is the notification an MCP client sends to cancel a request it made
+const MethodNotificationCancelled = "notifications/cancelled"
+
+// jsonrpcIDMetaField is the _meta field CancellationHook records a tool call's JSON-RPC ID in,
+// since tool handlers don't otherwise see it
+const jsonrpcIDMetaField = "loki-mcp/jsonrpc-id"
+
+// errCancelledByClient is the cause of tool calls cancelled with a notification
+var errCancelledByClient = errors.New("cancelled by the client")
+
+// cancellableCalls holds the cancel functions of running tool calls, by session and JSON-RPC ID
+var cancellableCalls = struct {
+	sync.Mutex
+	calls map[string]context.CancelCauseFunc
+}{calls: make(map[string]context.CancelCauseFunc)}
+
+// CancellationHook records the JSON-RPC ID of a tool call in its _meta field, so CancellationMiddleware
+// can find the call a cancellation notification refers to. Register it with server.Hooks.AddBeforeCallTool.
+func CancellationHook(ctx context.Context, id any, request *mcp.CallToolRequest) {
+	if id == nil {
+		return
+	}
+	if request.Params.Meta == nil {
+		request.Params.Meta = &mcp.Meta{}
+	}
+	if request.Params.Meta.AdditionalFields == nil {
+		request.Params.Meta.AdditionalFields = make(map[string]any)
+	}
+	request.Params.Meta.AdditionalFields[jsonrpcIDMetaField] = id
+}
+
+// CancellationMiddleware makes tool calls cancellable with the MCP notifications/cancelled notification.
+// Every Loki request and subquery a call makes uses its context, so cancelling it aborts them.
+func CancellationMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var id any
+		if request.Params.Meta != nil {
+			id = request.Params.Meta.AdditionalFields[jsonrpcIDMetaField]
+		}
+		key, ok := cancellationKey(ctx, id)
+		if !ok {
+			return next(ctx, request)
+		}
+
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		cancellableCalls.Lock()
+		cancellableCalls.calls[key] = cancel
+		cancellableCalls.Unlock()
+		defer func() {
+			cancellableCalls.Lock()
+			delete(cancellableCalls.calls, key)
+			cancellableCalls.Unlock()
+		}()
+
+		result, err := next(ctx, request)
+		if cause := context.Cause(ctx); errors.Is(cause, errCancelledByClient) {
+			return nil, cause
+		}
+		return result, err
+	}
+}
+
+// HandleCancelledNotification cancels the tool call a notifications/cancelled notification refers to.
+// Register it with MCPServer.AddNotificationHandler.
+func HandleCancelledNotification(ctx context.Context, notification mcp.JSONRPCNotification) {
+	key, ok := cancellationKey(ctx, notification.Params.AdditionalFields["requestId"])
+	if !ok {
+		return
+	}
+	cancellableCalls.Lock()
+	cancel, ok := cancellableCalls.calls[key]
+	cancellableCalls.Unlock()
+	if !ok {
+		// The call already finished, or the notification is for another kind of request
+		return
+	}
+
+	cause := errCancelledByClient
+	if reason, _ := notification.Params.AdditionalFields["reason"].(string); reason != "" {
+		cause = fmt.Errorf("%w: %s", errCancelledByClient, reason)
+	}
+	slog.Info("tool call cancelled", "reason", cause)
+	cancel(cause)
+}
+
+// cancellationKey identifies a request by its session and JSON-RPC ID. IDs are normalized, since
+// the ID of a request and the one in its cancellation notification are decoded differently.
+func cancellationKey(ctx context.Context, id any) (string, bool) {
+	if requestID, ok := id.(mcp.RequestId); ok {
+		id = requestID.Value()
+	}
+	var normalized string
+	switch v := id.(type) {
+	case string:
+		normalized = "s:" + v
+	case int64:
+		normalized = "n:" + strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case int:
+		normalized = "n:" + strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case float64:
+		normalized = "n:" + strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return "", false
+	}
+	session := ""
+	if s := server.ClientSessionFromContext(ctx); s != nil {
+		session = s.SessionID()
+	}
+	return session + "\x00" + normalized, true
+}
+
+// detachedCallerContext returns a context for background work a tool call starts, such as watch
+// polls. It keeps the caller's identity, access scope and forwarded credentials, so the work is
+// restricted like the call was, but not the call's cancellation, deadline or per-call recorders
+// of warnings, dry runs and timings.
+func detachedCallerContext(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range []any{warningsKey{}, dryRunKey{}, verboseKey{}, requestTimingKey{}} {
+		ctx = context.WithValue(ctx, key, nil)
+	}
+	return ctx
+}
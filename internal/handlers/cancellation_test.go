@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// TestCancellation tests that a notifications/cancelled notification aborts the Loki request of a tool call
+func TestCancellation(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	received := make(chan struct{})
+	aborted := make(chan struct{})
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	t.Cleanup(loki.Close)
+	SetConfig(&Config{LokiURL: loki.URL})
+
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(CancellationHook)
+	s := server.NewMCPServer("test", "1.0", server.WithHooks(hooks), server.WithToolHandlerMiddleware(CancellationMiddleware))
+	s.AddNotificationHandler(MethodNotificationCancelled, HandleCancelledNotification)
+	s.AddTool(NewLokiQueryTool(), HandleLokiQuery)
+
+	response := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		response <- s.HandleMessage(context.Background(), json.RawMessage(
+			`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"loki_query","arguments":{"query":"{app=\"api\"}"}}}`))
+	}()
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the Loki request")
+	}
+
+	// Another request ID doesn't cancel the call
+	s.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":8}}`))
+	s.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user aborted"}}`))
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the Loki request to be aborted")
+	}
+
+	select {
+	case msg := <-response:
+		rpcErr, ok := msg.(mcp.JSONRPCError)
+		if !ok || !strings.Contains(rpcErr.Error.Message, "cancelled by the client: user aborted") {
+			t.Errorf("Expected a cancellation error, but got %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the tool call to return once cancelled")
+	}
+	cancellableCalls.Lock()
+	defer cancellableCalls.Unlock()
+	if len(cancellableCalls.calls) != 0 {
+		t.Errorf("Expected finished calls to be forgotten, but got %v", cancellableCalls.calls)
+	}
+}
+
+// TestCancellationKey tests matching request IDs decoded from requests and notifications
+func TestCancellationKey(t *testing.T) {
+	ctx := context.Background()
+	same := [][2]any{
+		{float64(7), float64(7)},
+		{mcp.NewRequestId(int64(7)), float64(7)},
+		{"abc", "abc"},
+		{mcp.NewRequestId("abc"), "abc"},
+	}
+	for _, ids := range same {
+		a, okA := cancellationKey(ctx, ids[0])
+		b, okB := cancellationKey(ctx, ids[1])
+		if !okA || !okB || a != b {
+			t.Errorf("Expected %v and %v to match", ids[0], ids[1])
+		}
+	}
+	a, _ := cancellationKey(ctx, "7")
+	b, _ := cancellationKey(ctx, float64(7))
+	if a == b {
+		t.Error("Expected string and numeric IDs not to match")
+	}
+	if _, ok := cancellationKey(ctx, nil); ok {
+		t.Error("Expected no key without an ID")
+	}
+}
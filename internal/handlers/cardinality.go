@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// labelCardinality summarizes the values seen for a single label
+type labelCardinality struct {
+	Label     string       `json:"label"`
+	Distinct  int          `json:"distinct_values"`
+	Streams   int          `json:"streams"`
+	TopValues []valueCount `json:"top_values"`
+}
+
+// valueCount is a label value with the number of streams carrying it
+type valueCount struct {
+	Value   string `json:"value"`
+	Streams int    `json:"streams"`
+}
+
+// NewLokiCardinalityTool creates and returns a tool for reporting label cardinality
+func NewLokiCardinalityTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Report label cardinality for the streams matching a selector: for each label, the number of " +
+			"distinct values and the top values by stream count. Useful for building queries and reviewing label hygiene."),
+		mcp.WithString("selector",
+			mcp.Required(),
+			mcp.Description("Stream selector to analyze, e.g. {namespace=\"prod\"}"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the analysis (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the analysis (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("top",
+			mcp.Description("Number of top values to show per label (default: 5)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_cardinality", opts...)
+}
+
+// HandleLokiCardinality handles Loki cardinality tool requests
+func HandleLokiCardinality(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	selector, _ := args["selector"].(string)
+	if selector == "" {
+		return nil, fmt.Errorf("selector is required")
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	start, end, err := parseTimeRange(args, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	top := 5
+	if topVal, ok := args["top"].(float64); ok && topVal > 0 {
+		top = int(topVal)
+	}
+
+	format := formatArg(args)
+
+	conn := ResolveLokiConnection(args)
+	result, err := CurrentLokiClient().Series(ctx, conn, selector, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("series query execution failed: %w", err)
+	}
+
+	formattedResult, err := formatCardinality(selector, len(result.Data), computeCardinality(result.Data, top), format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// computeCardinality counts distinct values per label across a set of streams,
+// ordered by descending number of distinct values
+func computeCardinality(series []map[string]string, top int) []labelCardinality {
+	counts := make(map[string]map[string]int)
+	for _, stream := range series {
+		for label, value := range stream {
+			if counts[label] == nil {
+				counts[label] = make(map[string]int)
+			}
+			counts[label][value]++
+		}
+	}
+
+	cardinality := make([]labelCardinality, 0, len(counts))
+	for label, values := range counts {
+		lc := labelCardinality{Label: label, Distinct: len(values)}
+		for value, n := range values {
+			lc.Streams += n
+			lc.TopValues = append(lc.TopValues, valueCount{Value: value, Streams: n})
+		}
+		sort.Slice(lc.TopValues, func(i, j int) bool {
+			if lc.TopValues[i].Streams != lc.TopValues[j].Streams {
+				return lc.TopValues[i].Streams > lc.TopValues[j].Streams
+			}
+			return lc.TopValues[i].Value < lc.TopValues[j].Value
+		})
+		if len(lc.TopValues) > top {
+			lc.TopValues = lc.TopValues[:top]
+		}
+		cardinality = append(cardinality, lc)
+	}
+
+	sort.Slice(cardinality, func(i, j int) bool {
+		if cardinality[i].Distinct != cardinality[j].Distinct {
+			return cardinality[i].Distinct > cardinality[j].Distinct
+		}
+		return cardinality[i].Label < cardinality[j].Label
+	})
+	return cardinality
+}
+
+// formatCardinality formats the label cardinality report into a readable string
+func formatCardinality(selector string, streams int, cardinality []labelCardinality, format string) (string, error) {
+	if streams == 0 {
+		switch format {
+		case "json":
+			return "{\"message\": \"No streams found matching the selector\"}", nil
+		default:
+			return "No streams found matching the selector", nil
+		}
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(map[string]any{
+			"selector": selector,
+			"streams":  streams,
+			"labels":   cardinality,
+		}, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// One label per line: name, distinct values, then top values with stream counts
+		var output string
+		for _, lc := range cardinality {
+			parts := make([]string, 0, len(lc.TopValues))
+			for _, vc := range lc.TopValues {
+				parts = append(parts, fmt.Sprintf("%s=%d", vc.Value, vc.Streams))
+			}
+			output += fmt.Sprintf("%s %d %s\n", lc.Label, lc.Distinct, strings.Join(parts, ","))
+		}
+		return output, nil
+
+	case "text":
+		output := fmt.Sprintf("Found %d streams matching %s with %d labels:\n\n", streams, selector, len(cardinality))
+		for _, lc := range cardinality {
+			output += fmt.Sprintf("%s: %d distinct values across %d streams\n", lc.Label, lc.Distinct, lc.Streams)
+			for _, vc := range lc.TopValues {
+				output += fmt.Sprintf("  %s (%d streams)\n", vc.Value, vc.Streams)
+			}
+		}
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
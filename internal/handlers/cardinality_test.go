@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestComputeCardinality tests counting distinct label values and ranking top values
+func TestComputeCardinality(t *testing.T) {
+	series := []map[string]string{
+		{"app": "api", "pod": "api-1", "namespace": "prod"},
+		{"app": "api", "pod": "api-2", "namespace": "prod"},
+		{"app": "web", "pod": "web-1", "namespace": "prod"},
+		{"app": "api", "pod": "api-3", "namespace": "prod"},
+	}
+
+	cardinality := computeCardinality(series, 2)
+	if len(cardinality) != 3 {
+		t.Fatalf("Expected 3 labels, but got %d", len(cardinality))
+	}
+
+	// Labels are ordered by number of distinct values
+	if cardinality[0].Label != "pod" || cardinality[0].Distinct != 4 {
+		t.Errorf("Expected pod with 4 values first, but got %+v", cardinality[0])
+	}
+	if len(cardinality[0].TopValues) != 2 {
+		t.Errorf("Expected top values to be limited to 2, but got %d", len(cardinality[0].TopValues))
+	}
+
+	app := cardinality[1]
+	if app.Label != "app" || app.Distinct != 2 || app.Streams != 4 {
+		t.Errorf("Unexpected app cardinality: %+v", app)
+	}
+	if app.TopValues[0] != (valueCount{Value: "api", Streams: 3}) {
+		t.Errorf("Expected api to be the top app value, but got %+v", app.TopValues[0])
+	}
+
+	if cardinality[2].Label != "namespace" || cardinality[2].Distinct != 1 {
+		t.Errorf("Unexpected namespace cardinality: %+v", cardinality[2])
+	}
+}
+
+// TestFormatCardinality tests the raw and text output formats
+func TestFormatCardinality(t *testing.T) {
+	cardinality := computeCardinality([]map[string]string{{"app": "api"}, {"app": "web"}}, 5)
+
+	output, err := formatCardinality(`{app=~".+"}`, 2, cardinality, "raw")
+	if err != nil {
+		t.Fatalf("formatCardinality failed: %v", err)
+	}
+	if output != "app 2 api=1,web=1\n" {
+		t.Errorf("Unexpected raw output: %q", output)
+	}
+
+	output, err = formatCardinality(`{app=~".+"}`, 2, cardinality, "text")
+	if err != nil {
+		t.Fatalf("formatCardinality failed: %v", err)
+	}
+	if !strings.Contains(output, "app: 2 distinct values across 2 streams") {
+		t.Errorf("Unexpected text output:\n%s", output)
+	}
+
+	output, _ = formatCardinality(`{app="none"}`, 0, nil, "text")
+	if output != "No streams found matching the selector" {
+		t.Errorf("Unexpected empty output: %q", output)
+	}
+}
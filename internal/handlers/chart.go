@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Chart image size and plot area margin in pixels
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	chartMargin = 20
+)
+
+// chartPalette holds the line colors used for successive series, with names for the legend
+var chartPalette = []struct {
+	name  string
+	color color.RGBA
+}{
+	{"blue", color.RGBA{31, 119, 180, 255}},
+	{"orange", color.RGBA{255, 127, 14, 255}},
+	{"green", color.RGBA{44, 160, 44, 255}},
+	{"red", color.RGBA{214, 39, 40, 255}},
+	{"purple", color.RGBA{148, 103, 189, 255}},
+	{"brown", color.RGBA{140, 86, 75, 255}},
+	{"pink", color.RGBA{227, 119, 194, 255}},
+	{"gray", color.RGBA{127, 127, 127, 255}},
+	{"olive", color.RGBA{188, 189, 34, 255}},
+	{"cyan", color.RGBA{23, 190, 207, 255}},
+}
+
+// chartSeries is a named series of samples to plot
+type chartSeries struct {
+	Name    string
+	Samples []metricSample
+}
+
+// chartOption returns the tool option for rendering metric results as a chart
+func chartOption() mcp.ToolOption {
+	return mcp.WithBoolean("chart",
+		mcp.Description("Also return a PNG line chart of the series as image content, for clients that display images (default: false)"),
+	)
+}
+
+// metricChartSeries converts the series of a metric result into chart series named by their labels
+func metricChartSeries(result *LokiMetricResult) []chartSeries {
+	series := make([]chartSeries, 0, len(result.Data.Result))
+	for _, s := range result.Data.Result {
+		series = append(series, chartSeries{Name: formatStreamLabels(s.Metric), Samples: s.samples()})
+	}
+	return series
+}
+
+// sumsChartSeries converts per-timestamp sums, as returned by sumByTime, into a time-ordered chart series
+func sumsChartSeries(name string, sums map[int64]float64) chartSeries {
+	s := chartSeries{Name: name, Samples: make([]metricSample, 0, len(sums))}
+	for ts, value := range sums {
+		s.Samples = append(s.Samples, metricSample{Time: time.Unix(ts, 0), Value: value})
+	}
+	sort.Slice(s.Samples, func(i, j int) bool { return s.Samples[i].Time.Before(s.Samples[j].Time) })
+	return s
+}
+
+// attachChart renders the series as a PNG line chart and appends it to a tool result,
+// followed by a legend describing the colors and axes. Results without samples are left unchanged.
+func attachChart(result *mcp.CallToolResult, series []chartSeries) (*mcp.CallToolResult, error) {
+	img, bounds, ok := renderChart(series, chartWidth, chartHeight)
+	if !ok {
+		return result, nil
+	}
+
+	content, err := pngImageContent(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var legend strings.Builder
+	fmt.Fprintf(&legend, "Chart: %s to %s, y axis %s to %s\n",
+		bounds.Start.UTC().Format(time.RFC3339), bounds.End.UTC().Format(time.RFC3339),
+		strconv.FormatFloat(bounds.Min, 'g', 4, 64), strconv.FormatFloat(bounds.Max, 'g', 4, 64))
+	for i, s := range series {
+		fmt.Fprintf(&legend, "  %s: %s\n", chartPalette[i%len(chartPalette)].name, s.Name)
+	}
+
+	result.Content = append(result.Content,
+		content,
+		mcp.NewTextContent(legend.String()),
+	)
+	return result, nil
+}
+
+// pngImageContent encodes an image as PNG image content for a tool result
+func pngImageContent(img image.Image) (mcp.ImageContent, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return mcp.ImageContent{}, fmt.Errorf("failed to encode chart: %v", err)
+	}
+	return mcp.NewImageContent(base64.StdEncoding.EncodeToString(buf.Bytes()), "image/png"), nil
+}
+
+// chartBounds is the time and value range covered by a chart
+type chartBounds struct {
+	Start, End time.Time
+	Min, Max   float64
+}
+
+// renderChart draws the series as lines on a white background with horizontal grid lines.
+// It reports false when there are no samples to draw.
+func renderChart(series []chartSeries, width, height int) (*image.RGBA, chartBounds, bool) {
+	var bounds chartBounds
+	found := false
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+			if !found {
+				bounds = chartBounds{Start: sample.Time, End: sample.Time, Min: sample.Value, Max: sample.Value}
+				found = true
+				continue
+			}
+			if sample.Time.Before(bounds.Start) {
+				bounds.Start = sample.Time
+			}
+			if sample.Time.After(bounds.End) {
+				bounds.End = sample.Time
+			}
+			bounds.Min = math.Min(bounds.Min, sample.Value)
+			bounds.Max = math.Max(bounds.Max, sample.Value)
+		}
+	}
+	if !found {
+		return nil, bounds, false
+	}
+
+	// Counts and rates start the y axis at zero, and flat series still get some height
+	bounds.Min = math.Min(bounds.Min, 0)
+	if bounds.Max == bounds.Min {
+		bounds.Max = bounds.Min + 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	left, top := chartMargin, chartMargin
+	right, bottom := width-chartMargin, height-chartMargin
+	grid := color.RGBA{225, 225, 225, 255}
+	for i := 0; i <= 4; i++ {
+		y := top + (bottom-top)*i/4
+		drawLine(img, left, y, right, y, grid, 1)
+	}
+	axis := color.RGBA{90, 90, 90, 255}
+	drawLine(img, left, top, left, bottom, axis, 1)
+	drawLine(img, left, bottom, right, bottom, axis, 1)
+
+	span := bounds.End.Sub(bounds.Start)
+	point := func(sample metricSample) (int, int) {
+		x := left + (right-left)/2
+		if span > 0 {
+			x = left + int(float64(right-left)*float64(sample.Time.Sub(bounds.Start))/float64(span))
+		}
+		y := bottom - int(float64(bottom-top)*(sample.Value-bounds.Min)/(bounds.Max-bounds.Min))
+		return x, y
+	}
+
+	for i, s := range series {
+		c := chartPalette[i%len(chartPalette)].color
+		prevX, prevY, hasPrev := 0, 0, false
+		for _, sample := range s.Samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				hasPrev = false
+				continue
+			}
+			x, y := point(sample)
+			if hasPrev {
+				drawLine(img, prevX, prevY, x, y, c, 2)
+			} else {
+				drawLine(img, x, y, x, y, c, 3)
+			}
+			prevX, prevY, hasPrev = x, y, true
+		}
+	}
+	return img, bounds, true
+}
+
+// drawLine draws a line of the given thickness between two points using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA, thickness int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		for ox := 0; ox < thickness; ox++ {
+			for oy := 0; oy < thickness; oy++ {
+				img.SetRGBA(x0+ox-thickness/2, y0+oy-thickness/2, c)
+			}
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// abs returns the absolute value of an integer
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
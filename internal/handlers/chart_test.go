@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestRenderChart tests drawing series onto a chart image
+func TestRenderChart(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	series := []chartSeries{
+		{Name: "a", Samples: []metricSample{{start, 0}, {start.Add(time.Minute), 10}}},
+		{Name: "b", Samples: []metricSample{{start.Add(30 * time.Second), 5}}},
+	}
+
+	img, bounds, ok := renderChart(series, 200, 100)
+	if !ok {
+		t.Fatal("Expected a chart to be rendered")
+	}
+	if bounds.Min != 0 || bounds.Max != 10 || !bounds.Start.Equal(start) || !bounds.End.Equal(start.Add(time.Minute)) {
+		t.Errorf("Unexpected chart bounds: %+v", bounds)
+	}
+
+	// The first series runs from the bottom left to the top right of the plot area
+	blue := chartPalette[0].color
+	if img.RGBAAt(chartMargin, 100-chartMargin) != blue || img.RGBAAt(200-chartMargin, chartMargin) != blue {
+		t.Error("Expected the first series to be drawn corner to corner")
+	}
+	if c := img.RGBAAt(100, 50); c != chartPalette[1].color {
+		t.Errorf("Expected the single sample of the second series in the middle, but got %v", c)
+	}
+
+	if _, _, ok := renderChart([]chartSeries{{Name: "empty"}}, 200, 100); ok {
+		t.Error("Expected no chart without samples")
+	}
+}
+
+// TestAttachChart tests appending a PNG chart and legend to a tool result
+func TestAttachChart(t *testing.T) {
+	result, err := attachChart(mcp.NewToolResultText("report"), []chartSeries{
+		sumsChartSeries("all lines", map[int64]float64{1700000060: 20, 1700000000: 10}),
+		sumsChartSeries("error lines", map[int64]float64{1700000000: 1}),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(result.Content) != 3 {
+		t.Fatalf("Expected text, image and legend, but got %d content items", len(result.Content))
+	}
+
+	image, ok := result.Content[1].(mcp.ImageContent)
+	if !ok || image.MIMEType != "image/png" {
+		t.Fatalf("Expected PNG image content, but got %v", result.Content[1])
+	}
+	data, err := base64.StdEncoding.DecodeString(image.Data)
+	if err != nil {
+		t.Fatalf("Failed to decode image: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Expected a valid PNG, but got %v", err)
+	}
+
+	legend := result.Content[2].(mcp.TextContent).Text
+	if !strings.Contains(legend, "blue: all lines") || !strings.Contains(legend, "orange: error lines") {
+		t.Errorf("Expected the series colors in the legend, but got %s", legend)
+	}
+
+	// Nothing is attached without samples
+	result, err = attachChart(mcp.NewToolResultText("report"), nil)
+	if err != nil || len(result.Content) != 1 {
+		t.Errorf("Expected the result unchanged, but got %v, %v", result.Content, err)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// LokiClient performs the Loki API calls made by the tool handlers. Install a custom
+// implementation with SetLokiClient to use a different transport or a fake in tests.
+type LokiClient interface {
+	// Query runs a LogQL log query over the given window, in the direction given by QueryDirection(ctx)
+	Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error)
+	// MetricQuery runs a LogQL metric query over the given window, evaluated at step
+	MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error)
+	// Labels lists the label names seen in the given window
+	Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error)
+	// LabelValues lists the values of a label seen in the given window
+	LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error)
+	// Series lists the streams matching a selector in the given window
+	Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error)
+	// DetectedFields lists the fields Loki detects in the lines matching a query
+	DetectedFields(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (*LokiDetectedFieldsResult, error)
+}
+
+// HTTPLokiClient is the default LokiClient, calling the Loki HTTP API with failover,
+// query policy enforcement and dry run support
+type HTTPLokiClient struct{}
+
+// activeLokiClient holds the client installed with SetLokiClient
+var activeLokiClient atomic.Pointer[LokiClient]
+
+// SetLokiClient installs the client used by the tool handlers, or restores the default when nil
+func SetLokiClient(client LokiClient) {
+	if client == nil {
+		activeLokiClient.Store(nil)
+		return
+	}
+	activeLokiClient.Store(&client)
+}
+
+// CurrentLokiClient returns the installed client, defaulting to the client of the backend of
+// each call's datasource (HTTPLokiClient for Loki). Either way, the results are anonymized with
+// the profiles of each call's connection.
+func CurrentLokiClient() LokiClient {
+	if client := activeLokiClient.Load(); client != nil {
+		return anonymizingClient{*client}
+	}
+	return anonymizingClient{backendRouter{}}
+}
+
+// Query implements LokiClient
+func (HTTPLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	queryURL, err := buildLokiQueryURL(conn.URL, query, start.UnixNano(), end.UnixNano(), limit)
+	if err == nil {
+		queryURL, err = setQueryDirection(queryURL, QueryDirection(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+	return executeLokiQuery(ctx, queryURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// MetricQuery implements LokiClient
+func (HTTPLokiClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	queryURL, err := buildLokiMetricQueryURL(conn.URL, query, start.Unix(), end.Unix(), step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+	return executeLokiMetricQuery(ctx, queryURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// Labels implements LokiClient
+func (HTTPLokiClient) Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	labelsURL, err := buildLokiLabelsURL(conn.URL, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build labels URL: %v", err)
+	}
+	return executeLokiLabelsQuery(ctx, labelsURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// LabelValues implements LokiClient
+func (HTTPLokiClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	labelValuesURL, err := buildLokiLabelValuesURL(conn.URL, label, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build label values URL: %v", err)
+	}
+	return executeLokiLabelValuesQuery(ctx, labelValuesURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// Series implements LokiClient
+func (HTTPLokiClient) Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	seriesURL, err := buildLokiSeriesURL(conn.URL, selector, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build series URL: %v", err)
+	}
+	return executeLokiSeriesQuery(ctx, seriesURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// DetectedFields implements LokiClient
+func (HTTPLokiClient) DetectedFields(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (*LokiDetectedFieldsResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	fieldsURL, err := buildLokiDetectedFieldsURL(conn.URL, query, start.UnixNano(), end.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build detected fields URL: %v", err)
+	}
+	return executeLokiDetectedFieldsQuery(ctx, fieldsURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
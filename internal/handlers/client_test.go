@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeLokiClient serves canned results and records the calls it receives
+type fakeLokiClient struct {
+	HTTPLokiClient
+	labels    []string
+	series    []map[string]string
+	selectors []string
+}
+
+func (f *fakeLokiClient) Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error) {
+	return &LokiLabelsResult{Status: "success", Data: f.labels}, nil
+}
+
+func (f *fakeLokiClient) Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error) {
+	f.selectors = append(f.selectors, selector)
+	return &LokiSeriesResult{Status: "success", Data: f.series}, nil
+}
+
+// TestSetLokiClient tests that handlers use an injected client instead of calling Loki over HTTP
+func TestSetLokiClient(t *testing.T) {
+	fake := &fakeLokiClient{
+		labels: []string{"app", "namespace"},
+		series: []map[string]string{{"app": "api", "pod": "api-1"}, {"app": "api", "pod": "api-2"}},
+	}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"url": "http://unreachable.invalid"}
+	result, err := HandleLokiLabelNames(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "namespace") {
+		t.Errorf("Expected the fake labels in the result, but got %s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"selector": `{app="api"}`, "format": "json"}
+	if _, err := HandleLokiCardinality(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(fake.selectors) != 1 || fake.selectors[0] != `{app="api"}` {
+		t.Errorf("Expected one series call for {app=\"api\"}, but got %v", fake.selectors)
+	}
+
+	SetLokiClient(nil)
+	if client, ok := CurrentLokiClient().(anonymizingClient); !ok || client.LokiClient != (backendRouter{}) {
+		t.Error("Expected the default client after resetting")
+	}
+}
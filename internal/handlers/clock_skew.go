@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// EnvLokiClockSkewThreshold is the environment variable name for the clock skew between this host
+// and Loki above which tool calls warn, 0 to disable the check
+const EnvLokiClockSkewThreshold = "LOKI_CLOCK_SKEW_THRESHOLD"
+
+// DefaultClockSkewThreshold is well above the uncertainty of measuring the skew from the
+// one-second resolution of the Date header and the request's round trip
+const DefaultClockSkewThreshold = 30 * time.Second
+
+// clockSkews holds the last clock skew measured for each Loki endpoint, keyed by scheme and host
+var clockSkews = struct {
+	sync.Mutex
+	skews map[string]time.Duration
+}{skews: make(map[string]time.Duration)}
+
+// clockSkewKey identifies the Loki endpoint serving a request URL
+func clockSkewKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// recordClockSkew measures how far Loki's clock is ahead of this host's from the Date header of
+// a response, against the middle of the request's round trip. A warning is logged when the skew
+// of an endpoint first exceeds the threshold.
+func recordClockSkew(u *url.URL, date string, sent, received time.Time) {
+	threshold := CurrentConfig().ClockSkewThreshold
+	if threshold <= 0 || date == "" {
+		return
+	}
+	lokiTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	// The Date header is truncated to the second, so Loki's time is on average half a second later
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := lokiTime.Add(500 * time.Millisecond).Sub(local).Round(time.Second)
+
+	key := clockSkewKey(u)
+	clockSkews.Lock()
+	previous, measured := clockSkews.skews[key]
+	clockSkews.skews[key] = skew
+	clockSkews.Unlock()
+
+	if exceedsSkew(skew, threshold) && (!measured || !exceedsSkew(previous, threshold)) {
+		slog.Warn("clock skew between this host and Loki", "endpoint", redactURL(key), "loki_ahead_by", skew, "threshold", threshold)
+	}
+}
+
+// warnIfClockSkewed adds a warning when the last skew measured for the Loki endpoint serving a
+// request URL exceeds the threshold
+func warnIfClockSkewed(ctx context.Context, u *url.URL) {
+	threshold := CurrentConfig().ClockSkewThreshold
+	if threshold <= 0 {
+		return
+	}
+	clockSkews.Lock()
+	skew, ok := clockSkews.skews[clockSkewKey(u)]
+	clockSkews.Unlock()
+	if !ok || !exceedsSkew(skew, threshold) {
+		return
+	}
+	addWarning(ctx, describeClockSkew(redactURL(clockSkewKey(u)), skew))
+}
+
+// exceedsSkew reports whether a skew in either direction is above the threshold
+func exceedsSkew(skew, threshold time.Duration) bool {
+	return skew > threshold || skew < -threshold
+}
+
+// describeClockSkew explains the effect of a skew on relative time ranges
+func describeClockSkew(endpoint string, skew time.Duration) string {
+	if skew < 0 {
+		return fmt.Sprintf("this host's clock is %s ahead of Loki at %s; relative time ranges such as the last 15m "+
+			"end in Loki's future, so recent logs may appear to be missing", -skew, endpoint)
+	}
+	return fmt.Sprintf("this host's clock is %s behind Loki at %s; relative time ranges such as the last 15m "+
+		"end before Loki's present, so the most recent logs are not included", skew, endpoint)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestClockSkew tests warning about tool calls to a Loki whose clock is skewed
+func TestClockSkew(t *testing.T) {
+	var offset atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Duration(offset.Load())).UTC().Format(http.TimeFormat))
+		w.Write([]byte(`{"status": "success"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	cfg := LoadConfig()
+	cfg.ClockSkewThreshold = 30 * time.Second
+	SetConfig(cfg)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   string
+	}{
+		{"in sync", 2 * time.Second, ""},
+		{"loki ahead", 5 * time.Minute, "behind Loki at " + server.URL},
+		{"loki behind", -10 * time.Minute, "ahead of Loki at " + server.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset.Store(int64(tt.offset))
+			w := &toolWarnings{}
+			ctx := context.WithValue(context.Background(), warningsKey{}, w)
+			if _, err := executeLokiRequest(ctx, server.URL+"/loki/api/v1/labels", "", "", "", ""); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if tt.want == "" {
+				if len(w.messages) != 0 {
+					t.Errorf("Expected no warning, but got %v", w.messages)
+				}
+				return
+			}
+			if len(w.messages) != 1 || !strings.Contains(w.messages[0], tt.want) {
+				t.Errorf("Expected a warning containing %q, but got %v", tt.want, w.messages)
+			}
+		})
+	}
+
+	// The check is disabled with a zero threshold
+	cfg.ClockSkewThreshold = 0
+	w := &toolWarnings{}
+	ctx := context.WithValue(context.Background(), warningsKey{}, w)
+	if _, err := executeLokiRequest(ctx, server.URL+"/loki/api/v1/labels", "", "", "", ""); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(w.messages) != 0 {
+		t.Errorf("Expected no warning with the check disabled, but got %v", w.messages)
+	}
+}
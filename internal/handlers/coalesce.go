@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// inflightRequest is a Loki request shared by every caller sending the same request while it runs
+type inflightRequest struct {
+	done    chan struct{}
+	body    []byte
+	err     error
+	callers int                // callers that joined the request
+	waiting int                // callers still waiting for the response
+	cancel  context.CancelFunc // aborts the request once no caller waits for it
+}
+
+// inflightRequests holds the Loki requests being sent, by requestKey
+var inflightRequests = struct {
+	sync.Mutex
+	requests map[string]*inflightRequest
+}{requests: make(map[string]*inflightRequest)}
+
+// coalesceRequest runs send once for concurrent callers with the same key, so that many sessions
+// asking the same question during an incident cost Loki a single query. send gets a context that
+// keeps the first caller's values but is only cancelled when every caller has given up, so one
+// caller being cancelled doesn't fail the request for the others, while the last one aborts it.
+// Since send runs for every caller at once, each caller does its own bookkeeping with the result.
+func coalesceRequest(ctx context.Context, key string, send func(context.Context) ([]byte, error)) ([]byte, error) {
+	inflightRequests.Lock()
+	call, ok := inflightRequests.requests[key]
+	if ok {
+		call.callers++
+		call.waiting++
+	} else {
+		sendCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &inflightRequest{done: make(chan struct{}), callers: 1, waiting: 1, cancel: cancel}
+		inflightRequests.requests[key] = call
+		go func() {
+			defer cancel()
+			call.body, call.err = send(sendCtx)
+			inflightRequests.Lock()
+			if inflightRequests.requests[key] == call {
+				delete(inflightRequests.requests, key)
+			}
+			inflightRequests.Unlock()
+			if call.callers > 1 {
+				slog.Debug("coalesced concurrent Loki requests", "callers", call.callers)
+			}
+			close(call.done)
+		}()
+	}
+	inflightRequests.Unlock()
+
+	select {
+	case <-call.done:
+		return call.body, call.err
+	case <-ctx.Done():
+		inflightRequests.Lock()
+		if call.waiting--; call.waiting == 0 {
+			// Nobody waits for the response any more: abort the request, and let later callers start a new one
+			call.cancel()
+			if inflightRequests.requests[key] == call {
+				delete(inflightRequests.requests, key)
+			}
+		}
+		inflightRequests.Unlock()
+		return nil, ctx.Err()
+	}
+}
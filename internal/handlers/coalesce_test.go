@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForCallers waits until a number of callers share the in-flight requests
+func waitForCallers(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		inflightRequests.Lock()
+		callers := 0
+		for _, call := range inflightRequests.requests {
+			callers += call.callers
+		}
+		inflightRequests.Unlock()
+		if callers == n {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %d callers", n)
+}
+
+// TestSendLokiRequest_Coalescing tests that identical concurrent requests are sent to Loki once
+func TestSendLokiRequest_Coalescing(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	var requests atomic.Int32
+	release := make(chan struct{})
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(loki.Close)
+	SetConfig(&Config{LokiURL: loki.URL})
+
+	requestURL := loki.URL + "/loki/api/v1/query_range?query=x"
+	var wg sync.WaitGroup
+	bodies := make([]string, 6)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The last two callers use another tenant, so they don't share the response
+			orgID := ""
+			if i >= 4 {
+				orgID = "tenant-b"
+			}
+			body, err := sendLokiRequest(context.Background(), requestURL, "", "", "", orgID)
+			if err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			bodies[i] = string(body)
+		}()
+	}
+	waitForCallers(t, 6)
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected 2 requests to Loki, but got %d", n)
+	}
+	for i, body := range bodies {
+		if body != `{"status":"success"}` {
+			t.Errorf("Unexpected response %d: %s", i, body)
+		}
+	}
+}
+
+// TestCoalesceRequest_Cancel tests that a caller giving up doesn't cancel the request for the others
+func TestCoalesceRequest_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	send := func(ctx context.Context) ([]byte, error) {
+		select {
+		case <-release:
+			return []byte("ok"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := coalesceRequest(ctx, "key", send)
+		first <- err
+	}()
+	waitForCallers(t, 1)
+	second := make(chan string, 1)
+	go func() {
+		body, _ := coalesceRequest(context.Background(), "key", send)
+		second <- string(body)
+	}()
+	waitForCallers(t, 2)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the first caller to be canceled, but got %v", err)
+	}
+	close(release)
+	if body := <-second; body != "ok" {
+		t.Errorf("Expected the second caller to get the response, but got %q", body)
+	}
+}
+
+// TestCoalesceRequest_CancelAll tests that the request is aborted once every caller has given up
+func TestCoalesceRequest_CancelAll(t *testing.T) {
+	aborted := make(chan struct{})
+	send := func(ctx context.Context) ([]byte, error) {
+		<-ctx.Done()
+		close(aborted)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { _, err := coalesceRequest(ctx1, "key", send); errs <- err }()
+	waitForCallers(t, 1)
+	go func() { _, err := coalesceRequest(ctx2, "key", send); errs <- err }()
+	waitForCallers(t, 2)
+
+	cancel1()
+	<-errs
+	select {
+	case <-aborted:
+		t.Fatal("Expected the request to keep running while a caller waits for it")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel2()
+	<-errs
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the request to be aborted once no caller waits for it")
+	}
+}
+
+// TestSendLokiRequest_CoalescedBookkeeping tests that callers sharing a response each get their own
+// slow query entry, and that verbose callers time their own request
+func TestSendLokiRequest_CoalescedBookkeeping(t *testing.T) {
+	t.Cleanup(func() {
+		activeConfig.Store(nil)
+		slowQueries.Lock()
+		slowQueries.queries = nil
+		slowQueries.Unlock()
+	})
+	var requests atomic.Int32
+	release := make(chan struct{})
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(loki.Close)
+	SetConfig(&Config{LokiURL: loki.URL, SlowQueryThreshold: time.Nanosecond})
+
+	requestURL := loki.URL + "/loki/api/v1/query_range?query=x"
+	verbose := &verboseTimings{started: time.Now()}
+	contexts := []context.Context{
+		withRequestID(context.Background(), "req-1"),
+		withRequestID(context.Background(), "req-2"),
+		context.WithValue(withRequestID(context.Background(), "req-3"), verboseKey{}, verbose),
+	}
+	var wg sync.WaitGroup
+	for _, ctx := range contexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sendLokiRequest(ctx, requestURL, "", "", "", ""); err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+		}()
+	}
+	waitForCallers(t, 3)
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected the verbose caller to send its own request, but got %d requests to Loki", n)
+	}
+	if len(verbose.requests) != 1 || verbose.requests[0].Status != http.StatusOK {
+		t.Errorf("Expected the verbose caller's request to be timed, but got %+v", verbose.requests)
+	}
+	slowQueries.Lock()
+	defer slowQueries.Unlock()
+	ids := map[string]bool{}
+	for _, q := range slowQueries.queries {
+		ids[q.RequestID] = true
+	}
+	if len(ids) != 3 {
+		t.Errorf("Expected a slow query entry for each caller, but got %v", ids)
+	}
+}
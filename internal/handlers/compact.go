@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Marker replacing the part of a line repeated from the previous line of the stream
+const compactRepeatMarker = "…"
+
+// Shortest repeated prefix worth collapsing, so short words aren't replaced by the marker
+const compactMinPrefix = 12
+
+// compactOption returns the tool option for the token-minimizing output mode
+func compactOption() mcp.ToolOption {
+	return mcp.WithBoolean("compact",
+		mcp.Description("Minimize tokens for small-context models (raw and text formats): labels shared by all streams "+
+			"are shown once, other labels once per stream block, timestamps are trimmed to seconds with the date only when "+
+			"it changes, whitespace is collapsed and the start of a line repeated from the previous line becomes "+
+			compactRepeatMarker+" (default: false)"),
+	)
+}
+
+// compactRequested reports whether the compact output mode was requested for a tool call
+func compactRequested(args map[string]any) bool {
+	compact, _ := args["compact"].(bool)
+	return compact
+}
+
+// formatLokiCompact renders query results with as few tokens as possible. The labels shared by
+// all streams come first, then each stream's remaining labels followed by its lines in time order.
+func formatLokiCompact(result *LokiResult) string {
+	type stream struct {
+		labels map[string]string
+		key    string
+		values [][]string
+	}
+	var streams []stream
+	for _, entry := range result.Data.Result {
+		if len(entry.Values) > 0 {
+			streams = append(streams, stream{labels: entry.Stream, key: formatStreamLabels(entry.Stream), values: entry.Values})
+		}
+	}
+	if len(streams) == 0 {
+		return "No logs found matching the query"
+	}
+	sort.SliceStable(streams, func(i, j int) bool { return streams[i].key < streams[j].key })
+
+	// Labels with the same value in every stream
+	common := make(map[string]string)
+	for name, value := range streams[0].labels {
+		common[name] = value
+	}
+	for _, s := range streams[1:] {
+		for name, value := range common {
+			if s.labels[name] != value {
+				delete(common, name)
+			}
+		}
+	}
+
+	var b strings.Builder
+	if len(common) > 0 {
+		b.WriteString(compactLabels(common, nil))
+		b.WriteByte('\n')
+	}
+	for _, s := range streams {
+		if header := compactLabels(s.labels, common); header != "{}" {
+			b.WriteString(header)
+			b.WriteByte('\n')
+		}
+
+		values := make([][]string, 0, len(s.values))
+		for _, val := range s.values {
+			if len(val) >= 2 {
+				values = append(values, val)
+			}
+		}
+		sort.SliceStable(values, func(i, j int) bool { return compactNanos(values[i][0]) < compactNanos(values[j][0]) })
+
+		var lastDate, previous string
+		for _, val := range values {
+			if ns := compactNanos(val[0]); ns != 0 {
+				t := time.Unix(0, ns).UTC()
+				if date := t.Format(time.DateOnly); date != lastDate {
+					b.WriteString(t.Format("2006-01-02T15:04:05Z"))
+					lastDate = date
+				} else {
+					b.WriteString(t.Format(time.TimeOnly))
+				}
+			} else {
+				b.WriteString(val[0])
+			}
+			b.WriteByte(' ')
+
+			line := strings.Join(strings.Fields(val[1]), " ")
+			b.WriteString(collapseRepeatedPrefix(previous, line))
+			b.WriteByte('\n')
+			previous = line
+		}
+	}
+	return b.String()
+}
+
+// compactLabels renders labels as {name=value,...} without quotes, skipping those in exclude
+func compactLabels(labels, exclude map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		if _, ok := exclude[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+labels[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// collapseRepeatedPrefix replaces the words a line shares with the previous line with a marker
+func collapseRepeatedPrefix(previous, line string) string {
+	n := 0
+	for n < len(previous) && n < len(line) && previous[n] == line[n] {
+		n++
+	}
+	// Collapse whole words only; identical lines keep their last word so they remain recognizable
+	if n == len(line) || n < len(previous) || line[n] != ' ' {
+		n = strings.LastIndexByte(line[:n], ' ')
+	}
+	if n < compactMinPrefix {
+		return line
+	}
+	return compactRepeatMarker + line[n:]
+}
+
+// compactNanos parses a Loki timestamp in nanoseconds, returning 0 when it is invalid
+func compactNanos(ts string) int64 {
+	ns, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return ns
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestFormatLokiCompact tests shared labels, per-stream blocks, trimmed timestamps and collapsed prefixes
+func TestFormatLokiCompact(t *testing.T) {
+	result := &LokiResult{}
+	result.Data.Result = []LokiEntry{
+		{Stream: map[string]string{"namespace": "prod", "pod": "api-2"}, Values: [][]string{
+			{"1705312801000000000", "level=info   msg=\"request served\" path=/health"},
+		}},
+		{Stream: map[string]string{"namespace": "prod", "pod": "api-1"}, Values: [][]string{
+			{"1705312802500000000", "level=info caller=server.go:88 msg=\"request served\" path=/orders"},
+			{"1705312801000000000", "level=info caller=server.go:88 msg=\"request served\" path=/users"},
+			{"1705363200000000000", "level=info caller=server.go:88 msg=\"request served\" path=/orders"},
+		}},
+	}
+
+	expected := `{namespace=prod}
+{pod=api-1}
+2024-01-15T10:00:01Z level=info caller=server.go:88 msg="request served" path=/users
+10:00:02 … path=/orders
+2024-01-16T00:00:00Z … path=/orders
+{pod=api-2}
+2024-01-15T10:00:01Z level=info msg="request served" path=/health
+`
+	if got := formatLokiCompact(result); got != expected {
+		t.Errorf("Unexpected compact output:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	if got := formatLokiCompact(&LokiResult{}); got != "No logs found matching the query" {
+		t.Errorf("Unexpected output for no logs: %s", got)
+	}
+}
+
+// TestCollapseRepeatedPrefix tests that only whole repeated words are collapsed
+func TestCollapseRepeatedPrefix(t *testing.T) {
+	tests := []struct{ previous, line, expected string }{
+		{"", "level=info msg=started", "level=info msg=started"},
+		{"level=info caller=a.go msg=x", "level=info caller=a.go msg=y", "… msg=y"},
+		{"level=info caller=a.go msg=x", "level=info caller=a.go msg=x", "… msg=x"},
+		{"level=info caller=a.go", "level=info caller=a.goroutine", "level=info caller=a.goroutine"},
+		{"level=info callers=1", "level=info caller=2", "level=info caller=2"},
+		{"connection reset by peer", "connection refused", "connection refused"},
+	}
+	for _, test := range tests {
+		if got := collapseRepeatedPrefix(test.previous, test.line); got != test.expected {
+			t.Errorf("collapseRepeatedPrefix(%q, %q) = %q, expected %q", test.previous, test.line, got, test.expected)
+		}
+	}
+}
+
+// TestFormatLokiCompact_Savings tests that compact output is much smaller than raw output for typical Kubernetes logs
+func TestFormatLokiCompact_Savings(t *testing.T) {
+	result := &LokiResult{}
+	for p := range 3 {
+		entry := LokiEntry{Stream: map[string]string{
+			"cluster": "eu-west-1", "namespace": "checkout", "app": "payments", "container": "payments",
+			"job": "checkout/payments", "stream": "stderr", "pod": fmt.Sprintf("payments-7d9f8c-%d", p),
+		}}
+		for i := range 20 {
+			ts := fmt.Sprintf("%d", int64(1705312800000000000)+int64(i*1500+p)*1000000)
+			line := fmt.Sprintf("ts=2024-01-15T10:00:%02d.%03dZ level=info caller=handler.go:142 msg=\"processed payment\"  order_id=%d duration_ms=%d",
+				i, p, 1000+i, 20+i)
+			entry.Values = append(entry.Values, []string{ts, line})
+		}
+		result.Data.Result = append(result.Data.Result, entry)
+	}
+
+	raw, err := formatLokiResults(result, "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := formatLokiCompact(result)
+	if ratio := float64(len(compact)) / float64(len(raw)); ratio > 0.6 {
+		t.Errorf("Expected compact output to be at least 40%% smaller than raw output, but it is %.0f%% of its size", ratio*100)
+	}
+}
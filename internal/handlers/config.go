@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the server settings resolved from environment variables
+type Config struct {
+	LokiURL      string
+	LokiOrgID    string
+	LokiUsername string
+	LokiPassword string // or read from LOKI_PASSWORD_FILE
+	LokiToken    string // or read from LOKI_TOKEN_FILE
+	APIPrefix    string
+	MaxURLLength int
+
+	// Query policy settings, parsed by loadQueryPolicy
+	AllowedOrgs            []string
+	DeniedSelectors        string
+	RequiredLabels         []string
+	RequireEqualityMatcher bool
+	MinSelectivity         string
+	MandatoryMatchers      string
+
+	// Time range guardrails
+	MaxLookback    time.Duration
+	MaxRange       time.Duration
+	RangeLimitMode string // RangeLimitReject or RangeLimitClamp
+
+	SuggestSelectors bool
+	MaxOutputBytes   int // default output budget of loki_query, 0 for unlimited
+
+	// ip2asn database adding the country and ASN of IP addresses to enriched query results
+	GeoIPFile string
+	// Looking up the pods of query results in the Kubernetes API with in-cluster credentials
+	K8sEnrich bool
+
+	// Response cache for time ranges that ended in the past: disabled unless CacheTTL is set,
+	// and persisted in CacheDir when it is set
+	CacheTTL     time.Duration
+	CacheDir     string
+	CacheMaxSize int64 // total size of the cached responses, in memory and on disk; 0 for the default
+
+	// Clock skew between this host and Loki above which tool calls warn, 0 to disable the check
+	ClockSkewThreshold time.Duration
+	// Duration above which requests to Loki are kept in the slow query log, 0 to disable it
+	SlowQueryThreshold time.Duration
+
+	// Default daily quotas of each caller, 0 for unlimited
+	DailyQueryQuota int64
+	DailyBytesQuota int64
+
+	// Provenance metadata attached to tool results, signed when SigningKey is set
+	Provenance bool
+	SigningKey string // or read from LOKI_MCP_SIGNING_KEY_FILE
+
+	// Path of the JSON file defining scheduled reports, by default reports.json in the user's
+	// loki-mcp config directory when it exists
+	ReportsFile string
+
+	// Named datasources, loaded from DatasourcesFile with LoadDatasources. DatasourcesFile
+	// defaults to datasources.json in the user's loki-mcp config directory when it exists.
+	DatasourcesFile string
+	Datasources     []Datasource
+
+	// Roles of HTTP transport clients, loaded from AccessPolicyFile with LoadAccessPolicy.
+	// AccessPolicyFile defaults to access-policy.json in the user's loki-mcp config directory.
+	AccessPolicyFile string
+	AccessPolicy     *AccessPolicy
+
+	// Named anonymization profiles, loaded from AnonymizationFile with LoadAnonymizationProfiles.
+	// AnonymizationFile defaults to anonymization.json in the user's loki-mcp config directory.
+	// AnonymizationProfile applies to calls that don't use a datasource with its own profile.
+	AnonymizationFile     string
+	AnonymizationProfiles map[string]*AnonymizationProfile
+	AnonymizationProfile  string
+	AnonymizationKey      string // or read from LOKI_ANONYMIZATION_KEY_FILE
+
+	// Saved queries with typed parameters, loaded from SavedQueriesFile with LoadSavedQueries.
+	// SavedQueriesFile defaults to saved-queries.json in the user's loki-mcp config directory.
+	SavedQueriesFile string
+	SavedQueries     []SavedQuery
+
+	// Rules linking file:line references in log lines to repositories, loaded from SourceLinksFile
+	// with LoadSourceLinks. SourceLinksFile defaults to source-links.json in the user's loki-mcp config directory.
+	SourceLinksFile string
+	SourceLinks     []SourceLinkRule
+
+	// Rules joining continuation lines into multi-line entries, loaded from MultilineFile with
+	// LoadMultilineRules. MultilineFile defaults to multiline.json in the user's loki-mcp config directory.
+	MultilineFile string
+	Multiline     []MultilineRule
+
+	// Directory loki_push_file may read files from; the tool is only registered when set
+	PushDir string
+
+	// Grafana API settings; the Grafana tools are only registered when GrafanaURL is set, and the
+	// annotation tool only when GrafanaAnnotations is also set
+	GrafanaURL         string
+	GrafanaToken       string // or read from GRAFANA_TOKEN_FILE
+	GrafanaAnnotations bool
+
+	// Grafana Enterprise Logs admin API settings
+	AdminToken string // or read from LOKI_ADMIN_TOKEN_FILE
+	AdminURL   string
+
+	// Headers forwarded from HTTP transport requests to Loki, replacing the configured credentials
+	ForwardHeaders         []HeaderMapping
+	ForwardHeadersRequired bool
+
+	// Exchange of the user's OIDC token for a Loki token on HTTP transport requests
+	OIDC OIDCConfig
+
+	// Problems reading secrets from *_FILE environment variables
+	SecretErrors []string
+
+	// Startup connectivity probe settings; StrictStartup exits when a datasource is unreachable
+	StartupProbe  bool
+	StrictStartup bool
+
+	EnabledTools        string
+	DisabledTools       string
+	ShutdownGracePeriod time.Duration
+}
+
+// activeConfig is the snapshot installed with SetConfig
+var activeConfig atomic.Pointer[Config]
+
+// LoadConfig resolves the configuration from environment variables, applying defaults
+func LoadConfig() *Config {
+	cfg := &Config{
+		LokiURL:              os.Getenv(EnvLokiURL),
+		LokiOrgID:            os.Getenv(EnvLokiOrgID),
+		LokiUsername:         os.Getenv(EnvLokiUsername),
+		APIPrefix:            strings.TrimSpace(os.Getenv(EnvLokiAPIPrefix)),
+		MaxURLLength:         DefaultLokiMaxURLLength,
+		AllowedOrgs:          splitList(os.Getenv(EnvLokiAllowedOrgs)),
+		DeniedSelectors:      strings.TrimSpace(os.Getenv(EnvLokiDeniedSelectors)),
+		RequiredLabels:       splitList(os.Getenv(EnvLokiRequiredLabels)),
+		MinSelectivity:       strings.TrimSpace(os.Getenv(EnvLokiMinSelectivity)),
+		MandatoryMatchers:    strings.TrimSpace(os.Getenv(EnvLokiMandatoryMatchers)),
+		RangeLimitMode:       RangeLimitReject,
+		ReportsFile:          configFilePath(EnvLokiReportsFile, "reports.json"),
+		DatasourcesFile:      configFilePath(EnvLokiDatasourcesFile, "datasources.json"),
+		AccessPolicyFile:     configFilePath(EnvLokiAccessPolicyFile, "access-policy.json"),
+		AnonymizationFile:    configFilePath(EnvLokiAnonymizationFile, "anonymization.json"),
+		SavedQueriesFile:     configFilePath(EnvLokiSavedQueriesFile, "saved-queries.json"),
+		SourceLinksFile:      configFilePath(EnvLokiSourceLinksFile, "source-links.json"),
+		MultilineFile:        configFilePath(EnvLokiMultilineFile, "multiline.json"),
+		GeoIPFile:            configFilePath(EnvLokiGeoIPFile, "ip2asn-combined.tsv"),
+		AnonymizationProfile: strings.TrimSpace(os.Getenv(EnvLokiAnonymizationProfile)),
+		AdminURL:             strings.TrimSpace(os.Getenv(EnvLokiAdminURL)),
+		PushDir:              strings.TrimSpace(os.Getenv(EnvLokiPushDir)),
+		GrafanaURL:           strings.TrimSpace(os.Getenv(EnvGrafanaURL)),
+		EnabledTools:         os.Getenv(EnvLokiEnabledTools),
+		DisabledTools:        os.Getenv(EnvLokiDisabledTools),
+		ClockSkewThreshold:   DefaultClockSkewThreshold,
+		ShutdownGracePeriod:  DefaultShutdownGracePeriod,
+	}
+	for name, value := range map[string]*string{
+		EnvLokiPassword:         &cfg.LokiPassword,
+		EnvLokiToken:            &cfg.LokiToken,
+		EnvLokiAdminToken:       &cfg.AdminToken,
+		EnvGrafanaToken:         &cfg.GrafanaToken,
+		EnvLokiOIDCClientSecret: &cfg.OIDC.ClientSecret,
+		EnvLokiAnonymizationKey: &cfg.AnonymizationKey,
+		EnvSigningKey:           &cfg.SigningKey,
+	} {
+		secret, err := secretEnv(name)
+		if err != nil {
+			cfg.SecretErrors = append(cfg.SecretErrors, err.Error())
+		}
+		*value = secret
+	}
+	sort.Strings(cfg.SecretErrors)
+	if cfg.LokiURL == "" {
+		cfg.LokiURL = DefaultLokiURL
+	}
+	if n, err := strconv.Atoi(os.Getenv(EnvLokiMaxURLLength)); err == nil && n > 0 {
+		cfg.MaxURLLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv(EnvLokiMaxOutputBytes)); err == nil && n > 0 {
+		cfg.MaxOutputBytes = n
+	}
+	cfg.RequireEqualityMatcher, _ = strconv.ParseBool(os.Getenv(EnvLokiRequireEqualityMatcher))
+	cfg.SuggestSelectors, _ = strconv.ParseBool(os.Getenv(EnvLokiSuggestSelectors))
+	cfg.K8sEnrich, _ = strconv.ParseBool(os.Getenv(EnvLokiK8sEnrich))
+	cfg.GrafanaAnnotations, _ = strconv.ParseBool(os.Getenv(EnvGrafanaAnnotations))
+	cfg.OIDC = OIDCConfig{
+		Issuer:        strings.TrimSpace(os.Getenv(EnvLokiOIDCIssuer)),
+		TokenURL:      strings.TrimSpace(os.Getenv(EnvLokiOIDCTokenURL)),
+		ClientID:      os.Getenv(EnvLokiOIDCClientID),
+		ClientSecret:  cfg.OIDC.ClientSecret,
+		Audience:      os.Getenv(EnvLokiOIDCAudience),
+		Scope:         os.Getenv(EnvLokiOIDCScope),
+		SubjectHeader: strings.TrimSpace(os.Getenv(EnvLokiOIDCSubjectHeader)),
+	}
+	if cfg.OIDC.SubjectHeader == "" {
+		cfg.OIDC.SubjectHeader = "Authorization"
+	}
+	cfg.ForwardHeaders = parseHeaderMappings(os.Getenv(EnvLokiForwardHeaders))
+	cfg.ForwardHeadersRequired, _ = strconv.ParseBool(os.Getenv(EnvLokiForwardHeadersRequired))
+	cfg.StartupProbe, _ = strconv.ParseBool(os.Getenv(EnvStartupProbe))
+	cfg.StrictStartup, _ = strconv.ParseBool(os.Getenv(EnvStrictStartup))
+	cfg.Provenance, _ = strconv.ParseBool(os.Getenv(EnvProvenance))
+	if d, err := parseRelativeDuration(os.Getenv(EnvLokiMaxLookback)); err == nil && d > 0 {
+		cfg.MaxLookback = d
+	}
+	if d, err := parseRelativeDuration(os.Getenv(EnvLokiMaxRange)); err == nil && d > 0 {
+		cfg.MaxRange = d
+	}
+	if strings.EqualFold(strings.TrimSpace(os.Getenv(EnvLokiRangeLimitMode)), RangeLimitClamp) {
+		cfg.RangeLimitMode = RangeLimitClamp
+	}
+	if d, err := parseRelativeDuration(os.Getenv(EnvLokiCacheTTL)); err == nil && d > 0 {
+		cfg.CacheTTL = d
+	}
+	if dir := strings.TrimSpace(os.Getenv(EnvLokiCacheDir)); dir != "" {
+		cfg.CacheDir = expandPath(dir)
+	}
+	if n, err := parseByteSize(os.Getenv(EnvLokiCacheMaxSize)); err == nil && n > 0 {
+		cfg.CacheMaxSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv(EnvLokiClockSkewThreshold)); err == nil && d >= 0 {
+		cfg.ClockSkewThreshold = d
+	}
+	if d, err := time.ParseDuration(os.Getenv(EnvSlowQueryThreshold)); err == nil && d > 0 {
+		cfg.SlowQueryThreshold = d
+	}
+	loadQuotaDefaults(cfg)
+	if d, err := time.ParseDuration(os.Getenv(EnvShutdownGracePeriod)); err == nil && d >= 0 {
+		cfg.ShutdownGracePeriod = d
+	}
+	return cfg
+}
+
+// SetConfig installs the configuration used by tool factories and handlers.
+// It may be called again at any time to swap in a new configuration atomically.
+func SetConfig(cfg *Config) {
+	activeConfig.Store(cfg)
+}
+
+// CurrentConfig returns the installed configuration. When SetConfig has not been called, the
+// first call resolves one from the environment and installs it, so later calls return the same
+// snapshot.
+func CurrentConfig() *Config {
+	if cfg := activeConfig.Load(); cfg != nil {
+		return cfg
+	}
+	activeConfig.CompareAndSwap(nil, LoadConfig())
+	return activeConfig.Load()
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envReferencePattern matches ${VAR} and ${VAR:-default} references in config files,
+// and $${ as an escaped literal ${
+var envReferencePattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// readConfigFile reads a JSON config file and expands environment variable references in it,
+// so one file can be shared between environments that inject URLs, tokens and tenants
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(expandPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return expandEnvReferences(data)
+}
+
+// expandEnvReferences replaces ${VAR} with the value of VAR and ${VAR:-default} with the value of
+// VAR, or default when VAR is unset or empty. Values are escaped for use inside JSON strings.
+// A reference to an unset variable without a default is an error rather than an empty value.
+func expandEnvReferences(data []byte) ([]byte, error) {
+	var missing []string
+	expanded := envReferencePattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if string(ref) == "$${" {
+			return []byte("${")
+		}
+		m := envReferencePattern.FindSubmatch(ref)
+		value, ok := os.LookupEnv(string(m[1]))
+		if m[2] != nil && value == "" {
+			value, ok = string(m[2]), true
+		}
+		if !ok {
+			missing = append(missing, string(m[1]))
+			return ref
+		}
+		quoted, _ := json.Marshal(value)
+		return quoted[1 : len(quoted)-1]
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variables: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv sets an environment variable for the test and drops the installed configuration, so the
+// next CurrentConfig call resolves the environment again
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	t.Setenv(key, value)
+	activeConfig.Store(nil)
+	t.Cleanup(func() { activeConfig.Store(nil) })
+}
+
+// TestLoadConfig tests resolving the configuration from environment variables
+func TestLoadConfig(t *testing.T) {
+	cfg := LoadConfig()
+	if cfg.LokiURL != DefaultLokiURL || cfg.MaxURLLength != DefaultLokiMaxURLLength || cfg.ShutdownGracePeriod != DefaultShutdownGracePeriod {
+		t.Errorf("Expected defaults, but got %+v", cfg)
+	}
+
+	t.Setenv(EnvLokiURL, "http://loki:3100")
+	t.Setenv(EnvLokiMaxURLLength, "100")
+	t.Setenv(EnvLokiAllowedOrgs, "team-a, team-b,")
+	t.Setenv(EnvShutdownGracePeriod, "5s")
+	cfg = LoadConfig()
+	if cfg.LokiURL != "http://loki:3100" || cfg.MaxURLLength != 100 || cfg.ShutdownGracePeriod != 5*time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+	if len(cfg.AllowedOrgs) != 2 || cfg.AllowedOrgs[1] != "team-b" {
+		t.Errorf("Expected 2 allowed orgs, but got %v", cfg.AllowedOrgs)
+	}
+}
+
+// TestSetConfig tests that an installed configuration is used instead of the environment
+func TestSetConfig(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+
+	SetConfig(&Config{LokiURL: "http://snapshot:3100", DisabledTools: "loki_query"})
+	t.Setenv(EnvLokiURL, "http://env:3100")
+
+	if conn := ResolveLokiConnection(map[string]any{}); conn.URL != "http://snapshot:3100" {
+		t.Errorf("Expected the installed URL, but got %s", conn.URL)
+	}
+	if ToolEnabled("loki_query") {
+		t.Error("Expected loki_query to be disabled by the installed config")
+	}
+
+	activeConfig.Store(nil)
+	if conn := ResolveLokiConnection(map[string]any{}); conn.URL != "http://env:3100" {
+		t.Errorf("Expected the environment URL without an installed config, but got %s", conn.URL)
+	}
+}
+
+// TestReadConfigFile tests expanding environment variable references in config files
+func TestReadConfigFile(t *testing.T) {
+	t.Setenv("TEST_LOKI_URL", "http://prod:3100")
+	t.Setenv("TEST_LOKI_TOKEN", `se"cret`)
+	t.Setenv("TEST_LOKI_EMPTY", "")
+	path := filepath.Join(t.TempDir(), "datasources.json")
+	os.WriteFile(path, []byte(`[{"name": "prod", "url": "${TEST_LOKI_URL}", "token": "${TEST_LOKI_TOKEN}", `+
+		`"org_id": "${TEST_LOKI_EMPTY:-tenant}", "username": "${TEST_LOKI_UNSET:-}", "password": "$${literal}"}]`), 0o644)
+
+	datasources, err := LoadDatasources(path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expected := Datasource{Name: "prod", URL: "http://prod:3100", Token: `se"cret`, OrgID: "tenant", Password: "${literal}"}
+	if datasources[0] != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, datasources[0])
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "prod", "url": "${TEST_LOKI_UNSET}"}]`), 0o644)
+	if _, err := LoadDatasources(path); err == nil || !strings.Contains(err.Error(), "undefined environment variables: TEST_LOKI_UNSET") {
+		t.Errorf("Expected an undefined variable error, but got %v", err)
+	}
+}
+
+// TestCurrentConfig tests that the configuration resolved from the environment is kept as a snapshot
+func TestCurrentConfig(t *testing.T) {
+	setenv(t, EnvLokiURL, "http://first:3100")
+	cfg := CurrentConfig()
+	t.Setenv(EnvLokiURL, "http://second:3100")
+	if again := CurrentConfig(); again != cfg || again.LokiURL != "http://first:3100" {
+		t.Errorf("Expected the same snapshot, but got %s", again.LokiURL)
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Correlation settings
+const (
+	// maxCorrelationLag is how many buckets one query is shifted against the other to find a lead or lag
+	maxCorrelationLag = 3
+	// spikeDeviations is how many standard deviations above its mean a bucket count must be to be a spike
+	spikeDeviations = 2.0
+)
+
+// correlationBucket holds the counts of both queries in one time bucket
+type correlationBucket struct {
+	Start  time.Time `json:"start"`
+	CountA float64   `json:"count_a"`
+	CountB float64   `json:"count_b"`
+	SpikeA bool      `json:"spike_a,omitempty"`
+	SpikeB bool      `json:"spike_b,omitempty"`
+}
+
+// correlationReport describes how the counts of two queries move together over time
+type correlationReport struct {
+	QueryA      string              `json:"query_a"`
+	QueryB      string              `json:"query_b"`
+	Bucket      string              `json:"bucket"`
+	TotalA      float64             `json:"total_a"`
+	TotalB      float64             `json:"total_b"`
+	Correlation *float64            `json:"correlation"`          // Pearson correlation, nil when a query's counts are constant
+	BestLag     int                 `json:"best_lag"`             // buckets B follows A by at the strongest correlation, negative when B leads
+	LagCorr     *float64            `json:"best_lag_correlation"` // correlation at the best lag
+	SpikesA     int                 `json:"spikes_a"`
+	SpikesB     int                 `json:"spikes_b"`
+	SpikesBoth  int                 `json:"spikes_both"`   // buckets where both queries spike
+	Overlap     float64             `json:"spike_overlap"` // spikes_both over buckets where either spikes
+	Buckets     []correlationBucket `json:"buckets"`
+}
+
+// NewLokiCorrelateTool creates and returns a tool for correlating the counts of two queries over time
+func NewLokiCorrelateTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Count the lines matching two LogQL log queries per time bucket and report how they correlate, " +
+			"whether one leads the other by a few buckets, and how much their spikes overlap, e.g. to check whether payment " +
+			"errors line up with gateway timeouts."),
+		mcp.WithString("query_a",
+			mcp.Required(),
+			mcp.Description("First LogQL log query, e.g. {app=\"payments\"} |= \"error\""),
+		),
+		mcp.WithString("query_b",
+			mcp.Required(),
+			mcp.Description("Second LogQL log query, e.g. {app=\"gateway\"} |= \"timeout\""),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("step",
+			mcp.Description(fmt.Sprintf("Bucket size, e.g. 5m (default: chosen for about %d buckets)", reportBuckets)),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_correlate", opts...)
+}
+
+// HandleLokiCorrelate handles Loki correlate tool requests
+func HandleLokiCorrelate(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	queryA, _ := params.Args["query_a"].(string)
+	queryB, _ := params.Args["query_b"].(string)
+	if queryA == "" || queryB == "" {
+		return nil, fmt.Errorf("query_a and query_b are required")
+	}
+	queryA, queryB = applySessionSelector(ctx, queryA), applySessionSelector(ctx, queryB)
+
+	step, err := durationArg(params.Args, "step", reportStep(params.End.Sub(params.Start)))
+	if err != nil {
+		return nil, err
+	}
+	if buckets := params.End.Sub(params.Start) / step; buckets < 3 {
+		return nil, fmt.Errorf("step %s gives %d buckets, at least 3 are needed to correlate: use a smaller step", formatLogQLDuration(step), buckets)
+	}
+
+	countsA, err := runBucketedQuery(ctx, params.Conn, queryA, params.Start, params.End, step)
+	if err != nil {
+		return nil, err
+	}
+	countsB, err := runBucketedQuery(ctx, params.Conn, queryB, params.Start, params.End, step)
+	if err != nil {
+		return nil, err
+	}
+
+	report := correlateBuckets(countsA, countsB)
+	formattedResult, err := formatCorrelation(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return newResultMetadata(params).attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// correlateBuckets compares the bucket counts of two queries over the same buckets
+func correlateBuckets(a, b bucketReport) correlationReport {
+	report := correlationReport{QueryA: a.Query, QueryB: b.Query, Bucket: a.Bucket, TotalA: a.Total, TotalB: b.Total}
+	n := min(len(a.Buckets), len(b.Buckets))
+	countsA, countsB := make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		countsA[i], countsB[i] = a.Buckets[i].Count, b.Buckets[i].Count
+	}
+
+	report.Correlation = pearson(countsA, countsB)
+	for lag := -maxCorrelationLag; lag <= maxCorrelationLag; lag++ {
+		// A positive lag pairs each count of A with the count of B lag buckets later
+		var r *float64
+		if lag >= 0 {
+			r = pearson(countsA[:n-min(lag, n)], countsB[min(lag, n):])
+		} else {
+			r = pearson(countsA[min(-lag, n):], countsB[:n-min(-lag, n)])
+		}
+		if r != nil && (report.LagCorr == nil || *r > *report.LagCorr+1e-9 || (math.Abs(*r-*report.LagCorr) <= 1e-9 && abs(lag) < abs(report.BestLag))) {
+			report.LagCorr, report.BestLag = r, lag
+		}
+	}
+
+	spikesA, spikesB := spikes(countsA), spikes(countsB)
+	for i := 0; i < n; i++ {
+		bucket := correlationBucket{Start: a.Buckets[i].Start, CountA: countsA[i], CountB: countsB[i], SpikeA: spikesA[i], SpikeB: spikesB[i]}
+		report.Buckets = append(report.Buckets, bucket)
+		if bucket.SpikeA {
+			report.SpikesA++
+		}
+		if bucket.SpikeB {
+			report.SpikesB++
+		}
+		if bucket.SpikeA && bucket.SpikeB {
+			report.SpikesBoth++
+		}
+	}
+	if either := report.SpikesA + report.SpikesB - report.SpikesBoth; either > 0 {
+		report.Overlap = float64(report.SpikesBoth) / float64(either)
+	}
+	return report
+}
+
+// pearson returns the Pearson correlation of two equally long series, or nil when either is constant
+func pearson(x, y []float64) *float64 {
+	if len(x) < 2 || len(x) != len(y) {
+		return nil
+	}
+	meanX, meanY := mean(x), mean(y)
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil
+	}
+	r := cov / math.Sqrt(varX*varY)
+	return &r
+}
+
+// spikes marks the counts more than spikeDeviations standard deviations above the mean
+func spikes(counts []float64) []bool {
+	marks := make([]bool, len(counts))
+	if len(counts) == 0 {
+		return marks
+	}
+	m := mean(counts)
+	var variance float64
+	for _, c := range counts {
+		variance += (c - m) * (c - m)
+	}
+	sd := math.Sqrt(variance / float64(len(counts)))
+	if sd == 0 {
+		return marks
+	}
+	for i, c := range counts {
+		marks[i] = c > m+spikeDeviations*sd
+	}
+	return marks
+}
+
+// mean returns the average of the values
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// describeCorrelation names the strength of a correlation coefficient
+func describeCorrelation(r float64) string {
+	strength := "no"
+	switch a := math.Abs(r); {
+	case a >= 0.7:
+		strength = "strong"
+	case a >= 0.4:
+		strength = "moderate"
+	case a >= 0.2:
+		strength = "weak"
+	}
+	if strength == "no" {
+		return "no correlation"
+	}
+	if r < 0 {
+		return strength + " negative correlation"
+	}
+	return strength + " positive correlation"
+}
+
+// formatCorrelation formats the correlation report into a readable string
+func formatCorrelation(report correlationReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "A: %s (%s lines)\nB: %s (%s lines)\n", report.QueryA, formatCount(report.TotalA), report.QueryB, formatCount(report.TotalB))
+		if report.Correlation == nil {
+			fmt.Fprintf(&b, "Correlation over %d buckets of %s: undefined, as the counts of a query do not vary\n", len(report.Buckets), report.Bucket)
+		} else {
+			fmt.Fprintf(&b, "Correlation over %d buckets of %s: %.2f (%s)\n", len(report.Buckets), report.Bucket, *report.Correlation, describeCorrelation(*report.Correlation))
+		}
+		if report.LagCorr != nil && report.BestLag != 0 {
+			leader, follower, lag := "A", "B", report.BestLag
+			if lag < 0 {
+				leader, follower, lag = "B", "A", -lag
+			}
+			fmt.Fprintf(&b, "Strongest when %s follows %s by %d bucket(s): %.2f\n", follower, leader, lag, *report.LagCorr)
+		}
+		fmt.Fprintf(&b, "Spikes: %d in A, %d in B, %d together (%.0f%% overlap)\n", report.SpikesA, report.SpikesB, report.SpikesBoth, report.Overlap*100)
+		for _, bucket := range report.Buckets {
+			if !bucket.SpikeA && !bucket.SpikeB {
+				continue
+			}
+			spiking := "A and B"
+			if !bucket.SpikeB {
+				spiking = "A"
+			} else if !bucket.SpikeA {
+				spiking = "B"
+			}
+			fmt.Fprintf(&b, "  %s  A=%s B=%s  spike in %s\n", bucket.Start.Format(time.RFC3339), formatCount(bucket.CountA), formatCount(bucket.CountB), spiking)
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// correlationTestReport builds a bucket report with one-minute buckets of the given counts
+func correlationTestReport(query string, counts ...float64) bucketReport {
+	report := bucketReport{Query: query, Bucket: "1m"}
+	for i, c := range counts {
+		report.Buckets = append(report.Buckets, bucketCount{Start: time.Unix(int64(i*60), 0).UTC(), Count: c})
+		report.Total += c
+	}
+	return report
+}
+
+// TestCorrelateBuckets tests the correlation, lag and spike overlap of two count series
+func TestCorrelateBuckets(t *testing.T) {
+	a := correlationTestReport("a", 1, 1, 1, 1, 1, 1, 1, 1, 20, 1, 1, 1)
+	b := correlationTestReport("b", 2, 2, 2, 2, 2, 2, 2, 2, 2, 30, 2, 2)
+	report := correlateBuckets(a, b)
+	if report.Correlation == nil || *report.Correlation > 0 {
+		t.Errorf("Expected no positive correlation without a lag, but got %v", report.Correlation)
+	}
+	if report.BestLag != 1 || report.LagCorr == nil || *report.LagCorr < 0.99 {
+		t.Errorf("Expected B to follow A by 1 bucket, but got lag %d (%v)", report.BestLag, report.LagCorr)
+	}
+	if report.SpikesA != 1 || report.SpikesB != 1 || report.SpikesBoth != 0 {
+		t.Errorf("Unexpected spikes: %+v", report)
+	}
+
+	report = correlateBuckets(a, correlationTestReport("b", 0, 0, 0, 0, 0, 0, 0, 0, 15, 0, 0, 0))
+	if report.Correlation == nil || *report.Correlation < 0.99 || report.BestLag != 0 || report.Overlap != 1 {
+		t.Errorf("Expected aligned spikes, but got %+v", report)
+	}
+	text, err := formatCorrelation(report, "text")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.Contains(text, "(strong positive correlation)") || !strings.Contains(text, "1970-01-01T00:08:00Z  A=20 B=15  spike in A and B") {
+		t.Errorf("Unexpected text: %s", text)
+	}
+
+	// Constant counts have no defined correlation
+	report = correlateBuckets(a, correlationTestReport("b", 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3))
+	if report.Correlation != nil {
+		t.Errorf("Expected an undefined correlation, but got %v", *report.Correlation)
+	}
+}
+
+// TestHandleLokiCorrelate_TooFewBuckets tests rejecting steps that leave too few buckets to correlate
+func TestHandleLokiCorrelate_TooFewBuckets(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query_a": `{app="a"}`, "query_b": `{app="b"}`, "since": "1h", "step": "30m"}
+	if _, err := HandleLokiCorrelate(context.Background(), request); err == nil || !strings.Contains(err.Error(), "at least 3") {
+		t.Errorf("Expected a step error, but got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// countReport is the number of log lines matching a query over a time range
+type countReport struct {
+	Query string    `json:"query"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count float64   `json:"count"`
+}
+
+// countOnlyOption returns the tool option for returning only the number of matching lines
+func countOnlyOption() mcp.ToolOption {
+	return mcp.WithBoolean("count_only",
+		mcp.Description("Instead of log lines, return only the number of matching lines over the time range, "+
+			"counted by Loki with count_over_time, e.g. how many 500s in the last hour. Other result options are ignored"),
+	)
+}
+
+// runCountQuery counts the lines matching a log query over the time range with one count_over_time evaluation at its end
+func runCountQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (countReport, error) {
+	report := countReport{Query: query, Start: start.UTC(), End: end.UTC()}
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return report, fmt.Errorf("count_only requires a log query, e.g. {app=\"api\"} |= \"500\", not a metric query")
+	}
+	window := end.Sub(start).Truncate(time.Second)
+	if window < time.Second {
+		return report, fmt.Errorf("count_only requires a time range of at least one second")
+	}
+
+	expr := fmt.Sprintf("sum(count_over_time(%s [%s]))", strings.TrimSpace(query), formatLogQLDuration(window))
+	result, err := runLokiMetricQuery(ctx, conn, expr, end, end, window)
+	if err != nil {
+		return report, err
+	}
+
+	// A single evaluation covers the whole range; sum whatever samples Loki returned
+	for _, sum := range result.sumByTime() {
+		report.Count += sum
+	}
+	return report, nil
+}
+
+// formatCountReport renders a count report as JSON or as one line of text
+func formatCountReport(report countReport, format string) (string, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return fmt.Sprintf("%s lines matching %s from %s to %s\n", formatCount(report.Count), report.Query,
+		report.Start.Format(time.RFC3339), report.End.Format(time.RFC3339)), nil
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestHandleLokiQuery_CountOnly tests counting matching lines with a single count_over_time evaluation
+func TestHandleLokiQuery_CountOnly(t *testing.T) {
+	var query, start, end string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, start, end = r.URL.Query().Get("query"), r.URL.Query().Get("start"), r.URL.Query().Get("end")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1705316400,"42"]]}]}}`))
+	}))
+	defer server.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"query": `{app="api"} |= "500"`, "url": server.URL, "count_only": true,
+		"start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z",
+	}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if query != `sum(count_over_time({app="api"} |= "500" [1h]))` {
+		t.Errorf("Unexpected query: %s", query)
+	}
+	if start != end {
+		t.Errorf("Expected a single evaluation at the end of the range, but got %s to %s", start, end)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if text != "42 lines matching {app=\"api\"} |= \"500\" from 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z\n" {
+		t.Errorf("Unexpected result: %q", text)
+	}
+
+	request.Params.Arguments = map[string]any{"query": `rate({app="api"}[1m])`, "url": server.URL, "count_only": true}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "requires a log query") {
+		t.Errorf("Expected a metric query error, but got %v", err)
+	}
+}
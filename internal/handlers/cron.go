@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField describes the allowed range of one field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+// cronFields lists the five fields of a cron expression in order
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cronMacros are the shorthand schedules accepted in place of five fields
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// cronSchedule is a parsed five-field cron expression
+type cronSchedule struct {
+	fields [5]map[int]bool
+	// Day of month and day of week match if either does when both are restricted
+	domRestricted, dowRestricted bool
+}
+
+// parseCron parses a cron expression such as "0 9 * * 1-5" or "*/15 * * * *".
+// Each field accepts *, single values, ranges, comma-separated lists and /step suffixes.
+func parseCron(spec string) (cronSchedule, error) {
+	var schedule cronSchedule
+	expr := strings.TrimSpace(spec)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return schedule, fmt.Errorf("invalid cron expression %q: expected 5 fields (minute hour day-of-month month day-of-week)", spec)
+	}
+
+	for i, part := range parts {
+		values, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return schedule, fmt.Errorf("invalid cron expression %q: %v", spec, err)
+		}
+		schedule.fields[i] = values
+	}
+	schedule.domRestricted = parts[2] != "*"
+	schedule.dowRestricted = parts[4] != "*"
+	return schedule, nil
+}
+
+// parseCronField parses a single cron field into the set of values it matches
+func parseCronField(part string, field cronField) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, item := range strings.Split(part, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q in %s field", stepPart, field.name)
+			}
+			step = n
+		}
+
+		lo, hi := field.min, field.max
+		if rangePart != "*" {
+			loStr, hiStr, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return nil, fmt.Errorf("invalid value %q in %s field", loStr, field.name)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return nil, fmt.Errorf("invalid value %q in %s field", hiStr, field.name)
+				}
+			} else if hasStep {
+				hi = field.max
+			}
+		}
+
+		// Sunday may be written as 7
+		if field.name == "day of week" && hi == 7 {
+			values[0] = true
+			if lo == 7 {
+				continue
+			}
+			hi = 6
+		}
+		if lo < field.min || hi > field.max || lo > hi {
+			return nil, fmt.Errorf("%s field value %s out of range %d-%d", field.name, rangePart, field.min, field.max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// matches reports whether the schedule fires at the minute containing t
+func (c cronSchedule) matches(t time.Time) bool {
+	return c.fields[0][t.Minute()] && c.fields[1][t.Hour()] && c.fields[3][int(t.Month())] && c.matchesDay(t)
+}
+
+// next returns the first time after t at which the schedule fires, or the zero time
+// when it never fires within the next four years (e.g. February 30th)
+func (c cronSchedule) next(t time.Time) time.Time {
+	candidate := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+	limit := t.AddDate(4, 0, 0)
+	for candidate.Before(limit) {
+		switch {
+		case !c.fields[3][int(candidate.Month())]:
+			candidate = time.Date(candidate.Year(), candidate.Month()+1, 1, 0, 0, 0, 0, candidate.Location())
+		case !c.matchesDay(candidate):
+			candidate = time.Date(candidate.Year(), candidate.Month(), candidate.Day()+1, 0, 0, 0, 0, candidate.Location())
+		case !c.fields[1][candidate.Hour()]:
+			candidate = time.Date(candidate.Year(), candidate.Month(), candidate.Day(), candidate.Hour()+1, 0, 0, 0, candidate.Location())
+		case !c.fields[0][candidate.Minute()]:
+			candidate = candidate.Add(time.Minute)
+		default:
+			return candidate
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether the schedule fires on the day containing t
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := c.fields[2][t.Day()], c.fields[4][int(t.Weekday())]
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseCron_Invalid tests rejecting malformed cron expressions
+func TestParseCron_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * * 8"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+// TestCronSchedule_Next tests finding the next run time
+func TestCronSchedule_Next(t *testing.T) {
+	from := time.Date(2024, 3, 15, 10, 30, 20, 0, time.UTC) // a Friday
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)},
+		{"30 8 1 * *", time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 20 * 6", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tc := range testCases {
+		schedule, err := parseCron(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.spec, err)
+		}
+		if next := schedule.next(from); !next.Equal(tc.expected) {
+			t.Errorf("%s: expected %v, but got %v", tc.spec, tc.expected, next)
+		}
+		if !tc.expected.IsZero() && !schedule.matches(tc.expected) {
+			t.Errorf("%s: expected the schedule to match %v", tc.spec, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Environment variable name for the JSON file defining named Loki datasources
+const EnvLokiDatasourcesFile = "LOKI_DATASOURCES_FILE"
+
+// LabelProfile maps the concepts used by the convenience tools to the label names of a
+// cluster, since clusters name their labels differently (app, service_name, k8s_container_name, ...)
+type LabelProfile struct {
+	Service   string `json:"service,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Level     string `json:"level,omitempty"`
+}
+
+// defaultLabelProfile is used for anything a datasource's profile does not set
+var defaultLabelProfile = LabelProfile{
+	Service:   "app",
+	Namespace: "namespace",
+	Pod:       "pod",
+	Container: "container",
+	Level:     "level",
+}
+
+// Datasource is a named Loki endpoint with its credentials, default tenant and label profile
+type Datasource struct {
+	Name     string       `json:"name"`
+	URL      string       `json:"url"`
+	OrgID    string       `json:"org_id,omitempty"` // default tenant
+	Username string       `json:"username,omitempty"`
+	Password string       `json:"password,omitempty"`
+	Token    string       `json:"token,omitempty"`
+	Labels   LabelProfile `json:"labels,omitempty"`
+	// Anonymize names the anonymization profile applied to every result from the datasource
+	Anonymize string `json:"anonymize,omitempty"`
+	// Default makes the datasource apply to tool calls that do not name one
+	Default bool `json:"default,omitempty"`
+	// Backend is the log store behind the URL: loki (default), victorialogs, elasticsearch, or a
+	// backend registered with RegisterBackend
+	Backend string `json:"backend,omitempty"`
+}
+
+// withDefaults fills the labels the profile does not set from the default profile
+func (p LabelProfile) withDefaults() LabelProfile {
+	if p.Service == "" {
+		p.Service = defaultLabelProfile.Service
+	}
+	if p.Namespace == "" {
+		p.Namespace = defaultLabelProfile.Namespace
+	}
+	if p.Pod == "" {
+		p.Pod = defaultLabelProfile.Pod
+	}
+	if p.Container == "" {
+		p.Container = defaultLabelProfile.Container
+	}
+	if p.Level == "" {
+		p.Level = defaultLabelProfile.Level
+	}
+	return p
+}
+
+// LoadDatasources reads datasource definitions from a JSON file containing an array of datasources
+func LoadDatasources(path string) ([]Datasource, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read datasources file: %w", err)
+	}
+	var datasources []Datasource
+	if err := json.Unmarshal(data, &datasources); err != nil {
+		return nil, fmt.Errorf("failed to parse datasources file %s: %w", path, err)
+	}
+	if err := validateDatasources(datasources); err != nil {
+		return nil, fmt.Errorf("invalid datasources file %s: %w", path, err)
+	}
+	return datasources, nil
+}
+
+// validateDatasources checks that datasources are named uniquely, have a URL, map to valid
+// label names, and that at most one is the default
+func validateDatasources(datasources []Datasource) error {
+	names := make(map[string]bool)
+	hasDefault := false
+	for i, ds := range datasources {
+		if ds.Name == "" {
+			return fmt.Errorf("datasource %d: name is required", i+1)
+		}
+		if names[ds.Name] {
+			return fmt.Errorf("datasource %s: duplicate name", ds.Name)
+		}
+		names[ds.Name] = true
+		if ds.URL == "" {
+			return fmt.Errorf("datasource %s: url is required", ds.Name)
+		}
+		if _, ok := lookupBackend(ds.Backend); !ok {
+			return fmt.Errorf("datasource %s: unknown backend %s. Registered backends: %s", ds.Name, ds.Backend, strings.Join(backendNames(), ", "))
+		}
+		if ds.Default {
+			if hasDefault {
+				return fmt.Errorf("datasource %s: only one datasource may be the default", ds.Name)
+			}
+			hasDefault = true
+		}
+		for _, label := range []string{ds.Labels.Service, ds.Labels.Namespace, ds.Labels.Pod, ds.Labels.Container, ds.Labels.Level} {
+			if label != "" && !labelNamePattern.MatchString(label) {
+				return fmt.Errorf("datasource %s: invalid label name: %s", ds.Name, label)
+			}
+		}
+	}
+	return nil
+}
+
+// findDatasource returns the configured datasource with the given name, or the default
+// datasource when the name is empty
+func findDatasource(cfg *Config, name string) (Datasource, bool) {
+	for _, ds := range cfg.Datasources {
+		if (name != "" && ds.Name == name) || (name == "" && ds.Default) {
+			return ds, true
+		}
+	}
+	return Datasource{}, false
+}
+
+// datasourceNames lists the names of the configured datasources
+func datasourceNames(cfg *Config) []string {
+	names := make([]string, 0, len(cfg.Datasources))
+	for _, ds := range cfg.Datasources {
+		names = append(names, ds.Name)
+	}
+	return names
+}
+
+// describeDatasources lists the configured datasources for tool descriptions
+func describeDatasources(cfg *Config) string {
+	return strings.Join(datasourceNames(cfg), ", ")
+}
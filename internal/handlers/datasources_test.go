@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestDatasources installs a configuration with a default and a second datasource
+func setTestDatasources(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	cfg := LoadConfig()
+	cfg.LokiURL = "http://env:3100"
+	cfg.Datasources = []Datasource{
+		{Name: "prod", URL: "http://prod:3100", OrgID: "tenant-prod", Default: true},
+		{Name: "otel", URL: "http://otel:3100", Token: "otel-token",
+			Labels: LabelProfile{Service: "service_name", Container: "k8s_container_name", Level: "detected_level"}},
+	}
+	SetConfig(cfg)
+}
+
+// TestLoadDatasources tests reading and validating a datasources file
+func TestLoadDatasources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datasources.json")
+	os.WriteFile(path, []byte(`[{"name": "prod", "url": "http://prod:3100", "org_id": "tenant", "labels": {"service": "service_name"}}]`), 0o644)
+	datasources, err := LoadDatasources(path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(datasources) != 1 || datasources[0].Labels.Service != "service_name" || datasources[0].OrgID != "tenant" {
+		t.Errorf("Unexpected datasources: %+v", datasources)
+	}
+
+	invalid := map[string][]Datasource{
+		"missing name":    {{URL: "http://a"}},
+		"missing url":     {{Name: "a"}},
+		"duplicate":       {{Name: "a", URL: "http://a"}, {Name: "a", URL: "http://b"}},
+		"two defaults":    {{Name: "a", URL: "http://a", Default: true}, {Name: "b", URL: "http://b", Default: true}},
+		"invalid label":   {{Name: "a", URL: "http://a", Labels: LabelProfile{Pod: "k8s.pod"}}},
+		"unknown backend": {{Name: "a", URL: "http://a", Backend: "splunk"}},
+	}
+	for name, datasources := range invalid {
+		if err := validateDatasources(datasources); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestResolveLokiConnection_Datasource tests selecting a named or the default datasource
+func TestResolveLokiConnection_Datasource(t *testing.T) {
+	setTestDatasources(t)
+
+	conn := ResolveLokiConnection(map[string]any{})
+	if conn.URL != "http://prod:3100" || conn.OrgID != "tenant-prod" || conn.Datasource != "prod" {
+		t.Errorf("Expected the default datasource, but got %+v", conn)
+	}
+	if conn.Labels != defaultLabelProfile {
+		t.Errorf("Expected the default label profile, but got %+v", conn.Labels)
+	}
+
+	// The url parameter's default does not override the datasource, but explicit parameters do
+	conn = ResolveLokiConnection(map[string]any{"datasource": "otel", "url": "http://env:3100", "org": "tenant-b"})
+	if conn.URL != "http://otel:3100" || conn.Token != "otel-token" || conn.OrgID != "tenant-b" {
+		t.Errorf("Expected the otel datasource with the explicit org, but got %+v", conn)
+	}
+	if conn.Labels.Service != "service_name" || conn.Labels.Namespace != "namespace" {
+		t.Errorf("Expected the otel profile with defaults, but got %+v", conn.Labels)
+	}
+
+	conn = ResolveLokiConnection(map[string]any{"datasource": "staging"})
+	_, err := HTTPLokiClient{}.Labels(context.Background(), conn, time.Now().Add(-time.Hour), time.Now())
+	if err == nil || !strings.Contains(err.Error(), "unknown datasource: staging. Configured datasources: prod, otel") {
+		t.Errorf("Expected an unknown datasource error, but got %v", err)
+	}
+}
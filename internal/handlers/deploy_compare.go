@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxDeployMarkers is the most markers a single comparison accepts, as each costs two queries
+const maxDeployMarkers = 20
+
+// deployWindow holds the line and error counts of the window on one side of a marker
+type deployWindow struct {
+	Lines          float64 `json:"lines"`
+	Errors         float64 `json:"errors"`
+	LinesPerMinute float64 `json:"lines_per_minute"`
+	ErrorsPerMin   float64 `json:"errors_per_minute"`
+	ErrorRatio     float64 `json:"error_ratio"`
+}
+
+// deployComparison compares equal-sized windows before and after one marker
+type deployComparison struct {
+	Marker      string       `json:"marker"`
+	Window      string       `json:"window"`
+	Shortened   bool         `json:"shortened,omitempty"` // the window was cut to the time elapsed since the marker
+	Before      deployWindow `json:"before"`
+	After       deployWindow `json:"after"`
+	VolumeDelta string       `json:"volume_change"`
+	ErrorDelta  string       `json:"error_rate_change"`
+}
+
+// deployCompareReport holds the comparisons for all markers
+type deployCompareReport struct {
+	Selector     string             `json:"selector"`
+	ErrorPattern string             `json:"error_pattern"`
+	Markers      []deployComparison `json:"markers"`
+}
+
+// NewLokiDeployCompareTool creates and returns a tool for comparing log and error rates before and after deploys
+func NewLokiDeployCompareTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Compare log volume and error rates in equal-sized windows before and after one or more marker " +
+			"timestamps, such as deploys, to verify a release. Reports lines and errors per minute, the error ratio, and their change for each marker."),
+		mcp.WithString("markers",
+			mcp.Required(),
+			mcp.Description("Comma-separated marker timestamps, e.g. 2024-01-15T10:00:00Z,2024-01-15T14:30:00Z"),
+		),
+		mcp.WithString("service",
+			mcp.Description("Service to compare, matched with the datasource's service label (e.g. app or service_name)"),
+		),
+		mcp.WithString("namespace",
+			mcp.Description("Kubernetes namespace of the service"),
+		),
+		mcp.WithString("selector",
+			mcp.Description("Stream selector to compare instead of service and namespace, e.g. {app=\"checkout\"}"),
+		),
+		mcp.WithString("error_pattern",
+			mcp.Description(fmt.Sprintf("Regular expression identifying error lines (default: %s)", defaultErrorPattern)),
+		),
+		mcp.WithString("window",
+			mcp.Description("Size of the windows before and after each marker, e.g. 30m (default: 30m)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_deploy_compare", opts...)
+}
+
+// HandleLokiDeployCompare handles Loki deploy compare tool requests
+func HandleLokiDeployCompare(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	args := params.Args
+
+	markers, err := parseMarkers(args)
+	if err != nil {
+		return nil, err
+	}
+	window, err := durationArg(args, "window", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if window < time.Minute {
+		return nil, fmt.Errorf("window must be at least 1m")
+	}
+
+	selector, _ := args["selector"].(string)
+	if selector == "" {
+		service, _ := args["service"].(string)
+		namespace, _ := args["namespace"].(string)
+		if service == "" {
+			return nil, fmt.Errorf("service or selector is required")
+		}
+		selector, err = k8sLogsQuery(params.Conn.Labels, map[string]any{"service": service, "namespace": namespace})
+		if err != nil {
+			return nil, err
+		}
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	errorPattern := defaultErrorPattern
+	if patternArg, ok := args["error_pattern"].(string); ok && patternArg != "" {
+		errorPattern = patternArg
+	}
+
+	report := deployCompareReport{Selector: selector, ErrorPattern: errorPattern}
+	now := time.Now()
+	for _, marker := range markers {
+		comparison, err := compareAroundMarker(ctx, params.Conn, selector, errorPattern, marker, window, now)
+		if err != nil {
+			return nil, err
+		}
+		report.Markers = append(report.Markers, comparison)
+	}
+
+	formattedResult, err := formatDeployCompare(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return newResultMetadata(params).attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// parseMarkers extracts the comma-separated marker timestamps
+func parseMarkers(args map[string]any) ([]time.Time, error) {
+	raw, _ := args["markers"].(string)
+	var markers []time.Time
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		marker, err := parseTime(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid marker %s: %v", item, err)
+		}
+		markers = append(markers, marker)
+	}
+	if len(markers) == 0 {
+		return nil, fmt.Errorf("markers is required")
+	}
+	if len(markers) > maxDeployMarkers {
+		return nil, fmt.Errorf("at most %d markers are supported, got %d", maxDeployMarkers, len(markers))
+	}
+	return markers, nil
+}
+
+// compareAroundMarker counts lines and errors in the windows before and after a marker. Each count
+// query is evaluated at the marker and one window later, so one query covers both windows. Windows
+// reaching past now are cut to the time elapsed since the marker, on both sides to keep them equal.
+func compareAroundMarker(ctx context.Context, conn LokiConnection, selector, errorPattern string, marker time.Time, window time.Duration, now time.Time) (deployComparison, error) {
+	comparison := deployComparison{Marker: marker.UTC().Format(time.RFC3339)}
+	if elapsed := now.Sub(marker).Truncate(time.Second); elapsed < window {
+		if elapsed < time.Minute {
+			return comparison, fmt.Errorf("marker %s is less than a minute ago, so there is nothing to compare after it", comparison.Marker)
+		}
+		window, comparison.Shortened = elapsed, true
+	}
+	rangeStr := formatLogQLDuration(window)
+	comparison.Window = rangeStr
+
+	errorSelector := fmt.Sprintf("%s |~ %s", selector, quoteLogQLString(errorPattern))
+	counts := func(query string) (before, after float64, err error) {
+		expr := fmt.Sprintf("sum(count_over_time(%s [%s]))", query, rangeStr)
+		result, err := runLokiMetricQuery(ctx, conn, expr, marker, marker.Add(window), window)
+		if err != nil {
+			return 0, 0, err
+		}
+		sums := result.sumByTime()
+		return sums[marker.Unix()], sums[marker.Add(window).Unix()], nil
+	}
+	linesBefore, linesAfter, err := counts(selector)
+	if err != nil {
+		return comparison, err
+	}
+	errorsBefore, errorsAfter, err := counts(errorSelector)
+	if err != nil {
+		return comparison, err
+	}
+
+	comparison.Before = newDeployWindow(linesBefore, errorsBefore, window)
+	comparison.After = newDeployWindow(linesAfter, errorsAfter, window)
+	comparison.VolumeDelta = formatRateChange(linesBefore, linesAfter)
+	comparison.ErrorDelta = formatRateChange(errorsBefore, errorsAfter)
+	return comparison, nil
+}
+
+// newDeployWindow computes the rates of a window's counts
+func newDeployWindow(lines, errors float64, window time.Duration) deployWindow {
+	w := deployWindow{Lines: lines, Errors: errors, LinesPerMinute: lines / window.Minutes(), ErrorsPerMin: errors / window.Minutes()}
+	if lines > 0 {
+		w.ErrorRatio = errors / lines
+	}
+	return w
+}
+
+// formatRateChange describes the relative change between two counts of equal-sized windows
+func formatRateChange(before, after float64) string {
+	switch {
+	case before == 0 && after == 0:
+		return "none"
+	case before == 0:
+		return "new"
+	case after == 0:
+		return "stopped"
+	default:
+		return fmt.Sprintf("%+.0f%%", (after-before)/before*100)
+	}
+}
+
+// formatDeployCompare formats the deploy comparison report into a readable string
+func formatDeployCompare(report deployCompareReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Before vs. after %d markers for %s, errors matching %s\n", len(report.Markers), report.Selector, report.ErrorPattern)
+		for _, c := range report.Markers {
+			fmt.Fprintf(&b, "\nMarker %s, %s windows", c.Marker, c.Window)
+			if c.Shortened {
+				b.WriteString(" (shortened to the time elapsed since the marker)")
+			}
+			b.WriteString(":\n")
+			fmt.Fprintf(&b, "  Lines/min:   %10.1f -> %10.1f  (%s)\n", c.Before.LinesPerMinute, c.After.LinesPerMinute, c.VolumeDelta)
+			fmt.Fprintf(&b, "  Errors/min:  %10.1f -> %10.1f  (%s)\n", c.Before.ErrorsPerMin, c.After.ErrorsPerMin, c.ErrorDelta)
+			fmt.Fprintf(&b, "  Error ratio: %9.2f%% -> %9.2f%%\n", c.Before.ErrorRatio*100, c.After.ErrorRatio*100)
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// deployLokiClient returns line and error counts for the windows before and after a marker
+type deployLokiClient struct {
+	fakeLokiClient
+	lines, errors [2]string // counts before and after
+}
+
+func (f *deployLokiClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	counts := f.lines
+	if strings.Contains(query, "|~") {
+		counts = f.errors
+	}
+	return &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "matrix", Result: []LokiMetricSeries{
+		{Metric: map[string]string{}, Values: [][]any{{float64(start.Unix()), counts[0]}, {float64(end.Unix()), counts[1]}}},
+	}}}, nil
+}
+
+// TestHandleLokiDeployCompare tests comparing the windows before and after markers
+func TestHandleLokiDeployCompare(t *testing.T) {
+	SetLokiClient(&deployLokiClient{lines: [2]string{"3000", "3300"}, errors: [2]string{"30", "0"}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"selector": `{app="api"}`, "markers": "2024-01-15T10:00:00Z, 2024-01-15T14:00:00Z", "format": "json",
+	}
+	result, err := HandleLokiDeployCompare(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var report deployCompareReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Expected a JSON report, but got %v", err)
+	}
+	if len(report.Markers) != 2 {
+		t.Fatalf("Expected 2 markers, but got %d", len(report.Markers))
+	}
+	c := report.Markers[0]
+	if c.Window != "30m" || c.Before.LinesPerMinute != 100 || c.After.LinesPerMinute != 110 || c.Before.ErrorRatio != 0.01 {
+		t.Errorf("Unexpected comparison: %+v", c)
+	}
+	if c.VolumeDelta != "+10%" || c.ErrorDelta != "stopped" {
+		t.Errorf("Unexpected changes: %s, %s", c.VolumeDelta, c.ErrorDelta)
+	}
+
+	request.Params.Arguments = map[string]any{"selector": `{app="api"}`, "markers": "2024-01-15T10:00:00Z", "format": "text"}
+	result, err = HandleLokiDeployCompare(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "Errors/min:         1.0 ->        0.0  (stopped)") {
+		t.Errorf("Unexpected text: %s", text)
+	}
+}
+
+// TestCompareAroundMarker_Recent tests shortening both windows for a marker less than a window ago
+func TestCompareAroundMarker_Recent(t *testing.T) {
+	SetLokiClient(&deployLokiClient{lines: [2]string{"10", "10"}, errors: [2]string{"0", "5"}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	now := time.Date(2024, 1, 15, 10, 10, 0, 0, time.UTC)
+	c, err := compareAroundMarker(context.Background(), LokiConnection{}, `{app="api"}`, "error", now.Add(-10*time.Minute), 30*time.Minute, now)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !c.Shortened || c.Window != "10m" || c.ErrorDelta != "new" {
+		t.Errorf("Unexpected comparison: %+v", c)
+	}
+	if _, err := compareAroundMarker(context.Background(), LokiConnection{}, `{app="api"}`, "error", now, 30*time.Minute, now); err == nil {
+		t.Error("Expected an error for a marker at now")
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// LokiDetectedFieldsResult represents the structure of the Loki detected_fields response
+type LokiDetectedFieldsResult struct {
+	Fields []LokiDetectedField `json:"fields"`
+}
+
+// LokiDetectedField describes a field Loki detected in the log lines of a query
+type LokiDetectedField struct {
+	Label       string   `json:"label"`
+	Type        string   `json:"type"` // string, int, float, boolean, duration or bytes
+	Cardinality int      `json:"cardinality"`
+	Parsers     []string `json:"parsers"`
+}
+
+// numeric reports whether the field can be unwrapped into a sample value
+func (f LokiDetectedField) numeric() bool {
+	switch f.Type {
+	case "int", "float", "duration", "bytes":
+		return true
+	}
+	return false
+}
+
+// buildLokiDetectedFieldsURL constructs the Loki detected_fields URL
+func buildLokiDetectedFieldsURL(baseURL, query string, start, end int64) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki detected_fields API
+	setLokiAPIPath(u, "detected_fields")
+
+	// Add query parameters
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", fmt.Sprintf("%d", start))
+	q.Set("end", fmt.Sprintf("%d", end))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiDetectedFieldsQuery sends the HTTP request to Loki detected_fields endpoint
+func executeLokiDetectedFieldsQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiDetectedFieldsResult, error) {
+	body, err := executeLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiDetectedFieldsResult
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
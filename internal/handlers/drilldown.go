@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Default lookback window for a new drilldown session
+const defaultDrilldownWindow = time.Hour
+
+// drilldownStep is a single refinement applied to a drilldown session
+type drilldownStep struct {
+	Kind        string        // "line", "label" or "window"
+	Label       string        // label name for "label" steps
+	Op          string        // LogQL operator, e.g. "|=", "!=", "=~"
+	Value       string        // filter text or label value
+	Window      time.Duration // lookback window for "window" steps
+	Description string        // refinement as entered by the caller
+}
+
+// drilldownSession tracks the evolving LogQL query for one MCP session
+type drilldownSession struct {
+	Selector string
+	Window   time.Duration
+	Steps    []drilldownStep
+}
+
+// drilldownStore holds drilldown sessions keyed by MCP session ID
+type drilldownStore struct {
+	sessions sessionStates[*drilldownSession]
+}
+
+var drilldowns = &drilldownStore{}
+
+// negatedMatchers maps each label matcher operator to its opposite, so excluding pod=~"api-.*"
+// keeps the regex
+var negatedMatchers = map[string]string{"=": "!=", "!=": "=", "=~": "!~", "!~": "=~"}
+
+var (
+	labelNamePattern    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	labelMatcherPattern = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+)
+
+// defaultSessionKey is the session key of calls without an MCP session, such as stdio calls
+const defaultSessionKey = "default"
+
+// WithSessionKey sets the session whose per-session state, such as the session context and
+// drilldown query, the tool calls made with the context use. It is for transports without MCP
+// client sessions, such as gRPC.
+func WithSessionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, resumedSessionKey{}, key)
+}
+
+// SessionKey returns the ID of the MCP session the request belongs to, whose per-session state it
+// uses, preferring a resumed session or one set with WithSessionKey
+func SessionKey(ctx context.Context) string {
+	if id, ok := ctx.Value(resumedSessionKey{}).(string); ok {
+		return id
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return defaultSessionKey
+}
+
+// NewLokiDrilldownTool creates and returns a tool for iteratively refining a Loki query
+func NewLokiDrilldownTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Iteratively refine a Loki search. Start with a broad selector, then apply refinements such as " +
+			"\"add filter error\", \"exclude pod api-1\", \"add label namespace=prod\" or \"narrow to last 15m\". " +
+			"The evolving LogQL query is remembered for the current session."),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action to perform: start, refine, undo, run, show, or reset"),
+			mcp.Enum("start", "refine", "undo", "run", "show", "reset"),
+		),
+		mcp.WithString("selector",
+			mcp.Description("Stream selector to start from, e.g. {app=\"api\"} (required for start)"),
+		),
+		mcp.WithString("refinement",
+			mcp.Description("Refinement to apply (required for refine), e.g. \"add filter timeout\", \"exclude filter healthcheck\", "+
+				"\"exclude pod api-1\", \"add label level=error\", \"regex status=5..\", \"narrow to last 15m\""),
+		),
+		mcp.WithString("since",
+			mcp.Description("Initial lookback window for start (default: 1h)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return (default: 100)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_drilldown", opts...)
+}
+
+// HandleLokiDrilldown handles Loki drilldown tool requests
+func HandleLokiDrilldown(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	action, _ := args["action"].(string)
+	key := SessionKey(ctx)
+
+	var session *drilldownSession
+	switch action {
+	case "start":
+		selector, _ := args["selector"].(string)
+		if strings.TrimSpace(selector) == "" {
+			return nil, fmt.Errorf("selector is required to start a drilldown")
+		}
+		if _, _, err := splitStreamSelector(selector); err != nil {
+			return nil, err
+		}
+
+		window := defaultDrilldownWindow
+		if sinceStr, ok := args["since"].(string); ok && sinceStr != "" {
+			d, err := parseRelativeDuration(sinceStr)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid since duration: %s", sinceStr)
+			}
+			window = d
+		}
+
+		session = &drilldownSession{Selector: strings.TrimSpace(selector), Window: window}
+		drilldowns.set(key, session)
+
+	case "refine":
+		current := drilldowns.get(key)
+		if current == nil {
+			return nil, fmt.Errorf("no drilldown in progress; use action=start first")
+		}
+		refinement, _ := args["refinement"].(string)
+		step, err := parseDrilldownRefinement(refinement, current.labelLookup(ctx, ResolveLokiConnection(args)))
+		if err != nil {
+			return nil, err
+		}
+		session, err = drilldowns.update(key, func(s *drilldownSession) {
+			s.Steps = append(s.Steps, step)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case "undo":
+		var err error
+		session, err = drilldowns.update(key, func(s *drilldownSession) {
+			if len(s.Steps) > 0 {
+				s.Steps = s.Steps[:len(s.Steps)-1]
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case "run", "show":
+		session = drilldowns.get(key)
+		if session == nil {
+			return nil, fmt.Errorf("no drilldown in progress; use action=start first")
+		}
+
+	case "reset":
+		drilldowns.delete(key)
+		return mcp.NewToolResultText("Drilldown session cleared"), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported action: %s. Supported actions: start, refine, undo, run, show, reset", action)
+	}
+
+	summary := session.describe()
+	if action == "show" {
+		return mcp.NewToolResultText(summary), nil
+	}
+
+	limit := 100
+	if limitVal, ok := args["limit"].(float64); ok {
+		limit = int(limitVal)
+	}
+
+	format := formatArg(args)
+
+	conn := ResolveLokiConnection(args)
+	end := time.Now()
+	start := end.Add(-session.window())
+
+	result, err := runLokiQuery(ctx, conn, applySessionSelector(ctx, session.query()), start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	lineOptions{}.apply(result)
+
+	formattedResult, err := formatLokiResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(summary + "\n" + formattedResult), nil
+}
+
+func (d *drilldownStore) get(key string) *drilldownSession {
+	if s, ok := d.sessions.get(key); ok {
+		return s.clone()
+	}
+	return nil
+}
+
+func (d *drilldownStore) set(key string, s *drilldownSession) {
+	d.sessions.set(key, s.clone())
+}
+
+func (d *drilldownStore) delete(key string) {
+	d.sessions.delete(key)
+}
+
+// update applies fn to the stored session and returns a copy of the result
+func (d *drilldownStore) update(key string, fn func(*drilldownSession)) (*drilldownSession, error) {
+	var result *drilldownSession
+	if !d.sessions.update(key, func(s *drilldownSession) {
+		fn(s)
+		result = s.clone()
+	}) {
+		return nil, fmt.Errorf("no drilldown in progress; use action=start first")
+	}
+	return result, nil
+}
+
+func (s *drilldownSession) clone() *drilldownSession {
+	c := *s
+	c.Steps = append([]drilldownStep(nil), s.Steps...)
+	return &c
+}
+
+// window returns the lookback window after applying all refinements
+func (s *drilldownSession) window() time.Duration {
+	window := s.Window
+	for _, step := range s.Steps {
+		if step.Kind == "window" {
+			window = step.Window
+		}
+	}
+	return window
+}
+
+// query builds the LogQL query for the session's current state
+func (s *drilldownSession) query() string {
+	selector, pipeline, err := splitStreamSelector(s.Selector)
+	if err != nil {
+		return s.Selector
+	}
+
+	var matchers, filters []string
+	for _, step := range s.Steps {
+		switch step.Kind {
+		case "label":
+			matchers = append(matchers, fmt.Sprintf("%s%s%s", step.Label, step.Op, quoteLogQLString(step.Value)))
+		case "line":
+			filters = append(filters, fmt.Sprintf("%s %s", step.Op, quoteLogQLString(step.Value)))
+		}
+	}
+
+	if len(matchers) > 0 {
+		inner := strings.TrimSpace(selector[1 : len(selector)-1])
+		if inner != "" {
+			matchers = append([]string{inner}, matchers...)
+		}
+		selector = "{" + strings.Join(matchers, ", ") + "}"
+	}
+
+	query := selector
+	if pipeline != "" {
+		query += " " + pipeline
+	}
+	if len(filters) > 0 {
+		query += " " + strings.Join(filters, " ")
+	}
+	return query
+}
+
+// labelLookup reports whether a name is a label of the session's streams: a label of its
+// selector or refinements, or else one of the label names Loki knows for the session's window,
+// fetched at most once
+func (s *drilldownSession) labelLookup(ctx context.Context, conn LokiConnection) func(string) bool {
+	known := make(map[string]bool)
+	if selector, _, err := splitStreamSelector(s.Selector); err == nil {
+		for _, part := range splitOutsideQuotes(selector[1:len(selector)-1], ',') {
+			if label, _, _, err := parseLabelMatcher(part); err == nil {
+				known[label] = true
+			}
+		}
+	}
+	for _, step := range s.Steps {
+		if step.Kind == "label" {
+			known[step.Label] = true
+		}
+	}
+
+	fetched := false
+	return func(name string) bool {
+		if known[name] {
+			return true
+		}
+		if !fetched {
+			fetched = true
+			end := time.Now()
+			if result, err := CurrentLokiClient().Labels(ctx, conn, end.Add(-s.window()), end); err == nil {
+				for _, label := range result.Data {
+					known[label] = true
+				}
+			}
+		}
+		return known[name]
+	}
+}
+
+// describe renders the current query, window and refinement history
+func (s *drilldownSession) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Drilldown query: %s\n", s.query())
+	fmt.Fprintf(&b, "Window: last %s\n", s.window())
+	if len(s.Steps) > 0 {
+		b.WriteString("Refinements:\n")
+		for i, step := range s.Steps {
+			fmt.Fprintf(&b, "  %d. %s\n", i+1, step.Description)
+		}
+	}
+	return b.String()
+}
+
+// splitStreamSelector splits a LogQL query into its stream selector and the remaining pipeline
+func splitStreamSelector(query string) (string, string, error) {
+	query = strings.TrimSpace(query)
+	if !strings.HasPrefix(query, "{") {
+		return "", "", fmt.Errorf("invalid selector: %s (must start with '{')", query)
+	}
+
+	var quote rune
+	escaped := false
+	for i, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == '}':
+			return query[:i+1], strings.TrimSpace(query[i+1:]), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("invalid selector: %s (missing closing '}')", query)
+}
+
+// parseDrilldownRefinement turns a refinement phrase into a drilldown step. isLabel reports
+// whether a word names a label, to tell "exclude pod api-1" from "exclude connection refused".
+func parseDrilldownRefinement(refinement string, isLabel func(string) bool) (drilldownStep, error) {
+	text := strings.TrimSpace(refinement)
+	if text == "" {
+		return drilldownStep{}, fmt.Errorf("refinement is required")
+	}
+	step := drilldownStep{Description: text}
+	lower := strings.ToLower(text)
+
+	// rest returns the text following the first matching prefix
+	rest := func(prefixes ...string) (string, bool) {
+		for _, p := range prefixes {
+			if strings.HasPrefix(lower, p) {
+				return unquoteRefinement(text[len(p):]), true
+			}
+		}
+		return "", false
+	}
+
+	if v, ok := rest("narrow to last ", "widen to last ", "narrow to ", "widen to ", "last ", "since "); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return drilldownStep{}, fmt.Errorf("invalid time window in refinement: %s", text)
+		}
+		step.Kind, step.Window = "window", d
+		return step, nil
+	}
+
+	if v, ok := rest("add label ", "label "); ok {
+		label, op, value, err := parseLabelMatcher(v)
+		if err != nil {
+			return drilldownStep{}, err
+		}
+		step.Kind, step.Label, step.Op, step.Value = "label", label, op, value
+		return step, nil
+	}
+
+	if v, ok := rest("with ", "only "); ok {
+		// "with level=error" and "only pod api-1" select a label value, anything else falls
+		// through to the line filters below
+		if label, op, value, err := parseLabelMatcher(v); err == nil {
+			step.Kind, step.Label, step.Op, step.Value = "label", label, op, value
+			return step, nil
+		}
+		if fields := strings.Fields(v); len(fields) == 2 && labelNamePattern.MatchString(fields[0]) && isLabel(fields[0]) {
+			step.Kind, step.Label, step.Op, step.Value = "label", fields[0], "=", unquoteRefinement(fields[1])
+			return step, nil
+		}
+	}
+
+	if v, ok := rest("exclude label "); ok {
+		label, op, value, err := parseLabelMatcher(v)
+		if err != nil {
+			return drilldownStep{}, err
+		}
+		step.Kind, step.Label, step.Op, step.Value = "label", label, negatedMatchers[op], value
+		return step, nil
+	}
+
+	if v, ok := rest("exclude filter ", "exclude line ", "exclude text "); ok {
+		step.Kind, step.Op, step.Value = "line", "!=", v
+		return step, nil
+	}
+
+	if v, ok := rest("exclude regex "); ok {
+		step.Kind, step.Op, step.Value = "line", "!~", v
+		return step, nil
+	}
+
+	if v, ok := rest("exclude "); ok {
+		// "exclude pod api-1" and "exclude pod=api-1" exclude a label value when pod is a known
+		// label, anything else excludes lines containing the text
+		if label, op, value, err := parseLabelMatcher(v); err == nil {
+			step.Kind, step.Label, step.Op, step.Value = "label", label, negatedMatchers[op], value
+			return step, nil
+		}
+		if fields := strings.Fields(v); len(fields) == 2 && labelNamePattern.MatchString(fields[0]) && isLabel(fields[0]) {
+			step.Kind, step.Label, step.Op, step.Value = "label", fields[0], "!=", unquoteRefinement(fields[1])
+			return step, nil
+		}
+		step.Kind, step.Op, step.Value = "line", "!=", v
+		return step, nil
+	}
+
+	if v, ok := rest("add regex ", "regex "); ok {
+		step.Kind, step.Op, step.Value = "line", "|~", v
+		return step, nil
+	}
+
+	if v, ok := rest("add filter ", "filter ", "include ", "contains ", "with ", "only "); ok {
+		step.Kind, step.Op, step.Value = "line", "|=", v
+		return step, nil
+	}
+
+	return drilldownStep{}, fmt.Errorf("unrecognized refinement: %q. Examples: \"add filter error\", \"exclude pod api-1\", "+
+		"\"add label level=error\", \"narrow to last 15m\"", text)
+}
+
+// parseLabelMatcher parses a matcher such as app=api, pod!=x, or status=~"5.."
+func parseLabelMatcher(s string) (string, string, string, error) {
+	m := labelMatcherPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", "", "", fmt.Errorf("invalid label matcher: %s (expected label=value)", s)
+	}
+	return m[1], m[2], unquoteRefinement(m[3]), nil
+}
+
+// unquoteRefinement trims whitespace and surrounding quotes from a refinement value
+func unquoteRefinement(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 {
+		if s[0] == '"' && s[len(s)-1] == '"' {
+			if unquoted, err := strconv.Unquote(s); err == nil {
+				return unquoted
+			}
+			return s[1 : len(s)-1]
+		}
+		if (s[0] == '\'' && s[len(s)-1] == '\'') || (s[0] == '`' && s[len(s)-1] == '`') {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// knownLabels reports the pod and level labels as known
+func knownLabels(name string) bool {
+	return name == "pod" || name == "level"
+}
+
+// TestParseDrilldownRefinement tests that refinement phrases map to the expected steps
+func TestParseDrilldownRefinement(t *testing.T) {
+	testCases := []struct {
+		refinement string
+		expected   drilldownStep
+	}{
+		{"add filter error", drilldownStep{Kind: "line", Op: "|=", Value: "error"}},
+		{"filter \"connection refused\"", drilldownStep{Kind: "line", Op: "|=", Value: "connection refused"}},
+		{"exclude filter healthcheck", drilldownStep{Kind: "line", Op: "!=", Value: "healthcheck"}},
+		{"exclude healthcheck", drilldownStep{Kind: "line", Op: "!=", Value: "healthcheck"}},
+		{"exclude pod api-1", drilldownStep{Kind: "label", Label: "pod", Op: "!=", Value: "api-1"}},
+		{"exclude pod=api-1", drilldownStep{Kind: "label", Label: "pod", Op: "!=", Value: "api-1"}},
+		{"exclude connection refused", drilldownStep{Kind: "line", Op: "!=", Value: "connection refused"}},
+		{"exclude label pod=~\"api-.*\"", drilldownStep{Kind: "label", Label: "pod", Op: "!~", Value: "api-.*"}},
+		{"exclude pod=~api-.*", drilldownStep{Kind: "label", Label: "pod", Op: "!~", Value: "api-.*"}},
+		{"exclude label pod!=api-1", drilldownStep{Kind: "label", Label: "pod", Op: "=", Value: "api-1"}},
+		{"add label level=error", drilldownStep{Kind: "label", Label: "level", Op: "=", Value: "error"}},
+		{"with level=error", drilldownStep{Kind: "label", Label: "level", Op: "=", Value: "error"}},
+		{"only pod api-1", drilldownStep{Kind: "label", Label: "pod", Op: "=", Value: "api-1"}},
+		{"only timeout", drilldownStep{Kind: "line", Op: "|=", Value: "timeout"}},
+		{"with connection refused", drilldownStep{Kind: "line", Op: "|=", Value: "connection refused"}},
+		{"add label status=~\"5..\"", drilldownStep{Kind: "label", Label: "status", Op: "=~", Value: "5.."}},
+		{"regex status=5\\d\\d", drilldownStep{Kind: "line", Op: "|~", Value: "status=5\\d\\d"}},
+		{"narrow to last 15m", drilldownStep{Kind: "window", Window: 15 * time.Minute}},
+		{"Last 2h", drilldownStep{Kind: "window", Window: 2 * time.Hour}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.refinement, func(t *testing.T) {
+			step, err := parseDrilldownRefinement(tc.refinement, knownLabels)
+			if err != nil {
+				t.Fatalf("parseDrilldownRefinement failed: %v", err)
+			}
+			tc.expected.Description = tc.refinement
+			if step != tc.expected {
+				t.Errorf("Expected %+v, but got %+v", tc.expected, step)
+			}
+		})
+	}
+}
+
+// TestParseDrilldownRefinement_Invalid tests that unknown refinements are rejected
+func TestParseDrilldownRefinement_Invalid(t *testing.T) {
+	for _, refinement := range []string{"", "make it better", "narrow to last forever"} {
+		if _, err := parseDrilldownRefinement(refinement, knownLabels); err == nil {
+			t.Errorf("Expected error for refinement %q", refinement)
+		}
+	}
+}
+
+// TestDrilldownSession_Query tests that refinements accumulate into a single LogQL query
+func TestDrilldownSession_Query(t *testing.T) {
+	session := &drilldownSession{Selector: `{app="api"} | json`, Window: time.Hour}
+	for _, refinement := range []string{"add filter error", "exclude pod api-1", "narrow to last 15m", "exclude filter healthcheck"} {
+		step, err := parseDrilldownRefinement(refinement, knownLabels)
+		if err != nil {
+			t.Fatalf("parseDrilldownRefinement failed: %v", err)
+		}
+		session.Steps = append(session.Steps, step)
+	}
+
+	expected := `{app="api", pod!="api-1"} | json |= "error" != "healthcheck"`
+	if query := session.query(); query != expected {
+		t.Errorf("Expected query '%s', but got '%s'", expected, query)
+	}
+	if window := session.window(); window != 15*time.Minute {
+		t.Errorf("Expected window 15m, but got %s", window)
+	}
+}
+
+// TestDrilldownSession_EmptySelector tests that matchers are added to an empty selector
+func TestDrilldownSession_EmptySelector(t *testing.T) {
+	session := &drilldownSession{
+		Selector: "{}",
+		Steps:    []drilldownStep{{Kind: "label", Label: "namespace", Op: "=", Value: "prod"}},
+	}
+
+	expected := `{namespace="prod"}`
+	if query := session.query(); query != expected {
+		t.Errorf("Expected query '%s', but got '%s'", expected, query)
+	}
+}
+
+// TestSplitStreamSelector tests splitting a query into selector and pipeline
+func TestSplitStreamSelector(t *testing.T) {
+	selector, pipeline, err := splitStreamSelector(`{app="a}b"} |= "x"`)
+	if err != nil {
+		t.Fatalf("splitStreamSelector failed: %v", err)
+	}
+	if selector != `{app="a}b"}` {
+		t.Errorf("Unexpected selector: %s", selector)
+	}
+	if pipeline != `|= "x"` {
+		t.Errorf("Unexpected pipeline: %s", pipeline)
+	}
+
+	if _, _, err := splitStreamSelector(`app="a"`); err == nil {
+		t.Error("Expected error for selector without braces")
+	}
+	if _, _, err := splitStreamSelector(`{app="a"`); err == nil {
+		t.Error("Expected error for unterminated selector")
+	}
+}
+
+// TestDrilldownSession_LabelLookup tests that labels of the selector, refinements and Loki are known
+func TestDrilldownSession_LabelLookup(t *testing.T) {
+	SetLokiClient(&fakeLokiClient{labels: []string{"app", "pod"}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	session := &drilldownSession{
+		Selector: `{namespace="prod"} | json`,
+		Steps:    []drilldownStep{{Kind: "label", Label: "level", Op: "=", Value: "error"}},
+	}
+	isLabel := session.labelLookup(context.Background(), LokiConnection{})
+	for name, want := range map[string]bool{"namespace": true, "level": true, "pod": true, "connection": false} {
+		if got := isLabel(name); got != want {
+			t.Errorf("isLabel(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
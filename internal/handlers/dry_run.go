@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// errDryRun stops a tool call at the first request that would be sent to Loki
+var errDryRun = errors.New("dry run: request not sent")
+
+// dryRunKey is the context key for the dry-run recorder of a tool call
+type dryRunKey struct{}
+
+// dryRunRequest records the HTTP request a tool call would have sent to Loki
+type dryRunRequest struct {
+	Method  string
+	URL     string
+	Params  url.Values
+	Headers http.Header
+}
+
+// dryRunOption returns the dry_run tool option shared by every tool that talks to Loki
+func dryRunOption() mcp.ToolOption {
+	return mcp.WithBoolean("dry_run",
+		mcp.Description("Return the HTTP request that would be sent to Loki (URL, parameters and redacted headers) without executing it"),
+	)
+}
+
+// dryRunFromContext returns the dry-run recorder of the current tool call, or nil when requests should be sent
+func dryRunFromContext(ctx context.Context) *dryRunRequest {
+	rec, _ := ctx.Value(dryRunKey{}).(*dryRunRequest)
+	return rec
+}
+
+// record captures a request with its parameters and credentials redacted
+func (r *dryRunRequest) record(req *http.Request, requestURL string) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		r.URL = requestURL
+	} else {
+		r.Params = u.Query()
+		u.RawQuery = ""
+		r.URL = u.Redacted()
+	}
+	r.Method = req.Method
+
+	r.Headers = req.Header.Clone()
+	if auth := r.Headers.Get("Authorization"); auth != "" {
+		scheme, _, _ := strings.Cut(auth, " ")
+		r.Headers.Set("Authorization", scheme+" [REDACTED]")
+	}
+}
+
+// DryRunMiddleware handles the dry_run argument of every tool. The tool runs as usual until it
+// would send its first request to Loki, which is returned instead of being executed.
+func DryRunMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if dryRun, _ := request.GetArguments()["dry_run"].(bool); !dryRun {
+			return next(ctx, request)
+		}
+
+		rec := &dryRunRequest{}
+		result, err := next(context.WithValue(ctx, dryRunKey{}, rec), request)
+		if rec.Method == "" {
+			// The tool completed without contacting Loki
+			return result, err
+		}
+		return mcp.NewToolResultText(formatDryRunRequest(rec)), nil
+	}
+}
+
+// formatDryRunRequest formats a recorded request into a readable string
+func formatDryRunRequest(rec *dryRunRequest) string {
+	var b strings.Builder
+	b.WriteString("Dry run: no request was sent to Loki.\n\n")
+	fmt.Fprintf(&b, "%s %s\n", rec.Method, rec.URL)
+
+	if len(rec.Params) > 0 {
+		b.WriteString("\nParameters:\n")
+		for _, name := range sortedKeys(rec.Params) {
+			for _, value := range rec.Params[name] {
+				fmt.Fprintf(&b, "  %s: %s\n", name, value)
+			}
+		}
+	}
+
+	if len(rec.Headers) > 0 {
+		b.WriteString("\nHeaders:\n")
+		for _, name := range sortedKeys(rec.Headers) {
+			fmt.Fprintf(&b, "  %s: %s\n", name, strings.Join(rec.Headers[name], ", "))
+		}
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[M ~map[string]V, V any](m M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
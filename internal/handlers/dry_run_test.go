@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestDryRunMiddleware tests that dry runs return the constructed request without sending it
+func TestDryRunMiddleware(t *testing.T) {
+	handler := DryRunMiddleware(HandleLokiQuery)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"query":   `{job="varlogs"} |= "error"`,
+		"url":     "http://127.0.0.1:1",
+		"token":   "secret-token",
+		"org":     "tenant-a",
+		"limit":   float64(10),
+		"dry_run": true,
+	}
+
+	result, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output := result.Content[0].(mcp.TextContent).Text
+
+	expected := []string{
+		"GET http://127.0.0.1:1/loki/api/v1/query_range",
+		`query: {job="varlogs"} |= "error"`,
+		"limit: 10",
+		"Authorization: Bearer [REDACTED]",
+		"X-Scope-Orgid: tenant-a",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected output to contain %q, but got:\n%s", e, output)
+		}
+	}
+	if strings.Contains(output, "secret-token") {
+		t.Errorf("Token was not redacted:\n%s", output)
+	}
+}
+
+// TestDryRunMiddleware_Disabled tests that calls without dry_run are passed through unchanged
+func TestDryRunMiddleware_Disabled(t *testing.T) {
+	called := false
+	handler := DryRunMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		if dryRunFromContext(ctx) != nil {
+			t.Error("Expected no dry-run recorder in context")
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	if _, err := handler(context.Background(), mcp.CallToolRequest{}); err != nil || !called {
+		t.Errorf("Expected handler to be called without error, got %v", err)
+	}
+}
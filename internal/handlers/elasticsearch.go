@@ -0,0 +1,612 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of the log documents the elasticsearch backend reads, as named by the Elastic Common Schema
+const (
+	elasticsearchTimeField    = "@timestamp"
+	elasticsearchMessageField = "message"
+)
+
+// defaultElasticsearchIndex is the index pattern searched when the connection has no org ID,
+// matching the log data streams of Elastic Agent and Filebeat
+const defaultElasticsearchIndex = "logs-*"
+
+// maxElasticsearchBuckets is the number of streams, series or label values an aggregation returns
+const maxElasticsearchBuckets = 1000
+
+// ElasticsearchClient is the LokiClient of the elasticsearch backend. It translates the LogQL of
+// the tools to the Elasticsearch Query DSL and calls the search and field capabilities APIs, with
+// the same failover, query policy and dry run handling as Loki requests.
+//
+// The org ID selects the index or index pattern searched. Labels are the keyword fields of the
+// index, with the dots of field names written as double underscores, e.g. service__name for
+// service.name. Log queries support a stream selector, the |= and != line filters on the message
+// field and label filters; the json and logfmt parsers are accepted and do nothing, since documents
+// are parsed when they are indexed. Metric queries support count_over_time and rate, optionally
+// summed by labels.
+type ElasticsearchClient struct{}
+
+// elasticsearchIndexPattern matches index names and patterns, e.g. logs-* or logs-app,logs-web
+var elasticsearchIndexPattern = regexp.MustCompile(`^[^/\\?#"<>| ]+$`)
+
+// elasticsearchQuery is a LogQL log query translated to the Query DSL
+type elasticsearchQuery struct {
+	filter  []any
+	mustNot []any
+	labels  []string // labels of the stream selector, which make up the streams of the entries
+}
+
+// Query implements LokiClient
+func (ElasticsearchClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	query, start, err := enforceElasticsearchPolicy(ctx, conn, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	translated, err := translateLogQLToElasticsearch(query)
+	if err != nil {
+		return nil, err
+	}
+	order := "desc"
+	if QueryDirection(ctx) == DirectionForward {
+		order = "asc"
+	}
+	fields := []any{map[string]any{"field": elasticsearchTimeField, "format": "strict_date_optional_time_nanos"}, elasticsearchMessageField}
+	for _, label := range translated.labels {
+		fields = append(fields, elasticsearchField(label))
+	}
+	search := map[string]any{
+		"query":   translated.boolQuery(start, end),
+		"sort":    []any{map[string]any{elasticsearchTimeField: map[string]any{"order": order}}},
+		"_source": false,
+		"fields":  fields,
+	}
+	if limit > 0 {
+		search["size"] = limit
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Fields map[string][]any `json:"fields"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := executeElasticsearchSearch(ctx, conn, search, &response); err != nil {
+		return nil, err
+	}
+
+	// Group the entries into streams of their selector labels, in the order they were returned
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{}}}
+	index := make(map[string]int)
+	for _, hit := range response.Hits.Hits {
+		ts, err := time.Parse(time.RFC3339Nano, elasticsearchFieldValue(hit.Fields[elasticsearchTimeField]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Elasticsearch response: invalid %s: %v", elasticsearchTimeField, err)
+		}
+		stream := make(map[string]string)
+		for _, label := range translated.labels {
+			if values := hit.Fields[elasticsearchField(label)]; len(values) > 0 {
+				stream[label] = elasticsearchFieldValue(values)
+			}
+		}
+		key := formatStreamLabels(stream)
+		i, ok := index[key]
+		if !ok {
+			i = len(result.Data.Result)
+			index[key] = i
+			result.Data.Result = append(result.Data.Result, LokiEntry{Stream: stream})
+		}
+		entry := []string{strconv.FormatInt(ts.UnixNano(), 10), elasticsearchFieldValue(hit.Fields[elasticsearchMessageField])}
+		result.Data.Result[i].Values = append(result.Data.Result[i].Values, entry)
+	}
+	return result, nil
+}
+
+// MetricQuery implements LokiClient. Counts are taken per step instead of over the range of the
+// query, and rates divide them by the step. Queries that aren't summed count per stream of the
+// selector labels.
+func (ElasticsearchClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	query, start, err := enforceElasticsearchPolicy(ctx, conn, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	m := victoriaLogsMetricPattern.FindStringSubmatch(query)
+	if m == nil || (m[1] == "") != (m[6] == "") || (m[2] != "" && m[7] != "") {
+		return nil, fmt.Errorf("the elasticsearch backend supports count_over_time and rate metric queries, optionally summed by labels: %s", query)
+	}
+	translated, err := translateLogQLToElasticsearch(m[4])
+	if err != nil {
+		return nil, err
+	}
+	by := translated.labels
+	if m[1] != "" {
+		by = nil
+		for _, label := range strings.Split(m[2]+m[7], ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				by = append(by, label)
+			}
+		}
+	}
+	if step <= 0 {
+		step = time.Minute
+	}
+
+	histogram := map[string]any{"date_histogram": map[string]any{
+		"field":           elasticsearchTimeField,
+		"fixed_interval":  strconv.FormatInt(int64(step/time.Second), 10) + "s",
+		"min_doc_count":   0,
+		"extended_bounds": map[string]any{"min": start.UnixMilli(), "max": end.UnixMilli()},
+	}}
+	aggs := map[string]any{"over_time": histogram}
+	if len(by) > 0 {
+		aggs = map[string]any{"series": elasticsearchComposite(by, map[string]any{"over_time": histogram})}
+	}
+	search := map[string]any{"query": translated.boolQuery(start, end), "size": 0, "aggs": aggs}
+
+	type histogramBuckets struct {
+		Buckets []struct {
+			Key      float64 `json:"key"`
+			DocCount int64   `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	var response struct {
+		Aggregations struct {
+			OverTime histogramBuckets `json:"over_time"`
+			Series   struct {
+				Buckets []struct {
+					Key      map[string]any   `json:"key"`
+					OverTime histogramBuckets `json:"over_time"`
+				} `json:"buckets"`
+			} `json:"series"`
+		} `json:"aggregations"`
+	}
+	if err := executeElasticsearchSearch(ctx, conn, search, &response); err != nil {
+		return nil, err
+	}
+
+	samples := func(h histogramBuckets) [][]any {
+		values := make([][]any, 0, len(h.Buckets))
+		for _, bucket := range h.Buckets {
+			value := float64(bucket.DocCount)
+			if m[3] == "rate" {
+				value /= step.Seconds()
+			}
+			values = append(values, []any{bucket.Key / 1000, strconv.FormatFloat(value, 'f', -1, 64)})
+		}
+		return values
+	}
+	result := &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "matrix", Result: []LokiMetricSeries{}}}
+	if len(by) == 0 {
+		result.Data.Result = append(result.Data.Result, LokiMetricSeries{Metric: map[string]string{}, Values: samples(response.Aggregations.OverTime)})
+		return result, nil
+	}
+	for _, bucket := range response.Aggregations.Series.Buckets {
+		result.Data.Result = append(result.Data.Result, LokiMetricSeries{Metric: elasticsearchBucketLabels(bucket.Key), Values: samples(bucket.OverTime)})
+	}
+	return result, nil
+}
+
+// Labels implements LokiClient, listing the keyword fields of the index. The index mapping has
+// no time range, so the window is not applied.
+func (ElasticsearchClient) Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	fields, err := elasticsearchFieldTypes(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	for field, fieldType := range fields {
+		if fieldType == "keyword" || fieldType == "constant_keyword" {
+			labels = append(labels, elasticsearchLabel(field))
+		}
+	}
+	sort.Strings(labels)
+	return &LokiLabelsResult{Status: "success", Data: labels}, nil
+}
+
+// LabelValues implements LokiClient, listing the most frequent values of a field in the window
+func (ElasticsearchClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	query, start, err := enforceElasticsearchPolicy(ctx, conn, "", start, end)
+	if err != nil {
+		return nil, err
+	}
+	translated, err := translateLogQLToElasticsearch(query)
+	if err != nil {
+		return nil, err
+	}
+	search := map[string]any{
+		"query": translated.boolQuery(start, end),
+		"size":  0,
+		"aggs": map[string]any{"values": map[string]any{
+			"terms": map[string]any{"field": elasticsearchField(label), "size": maxElasticsearchBuckets},
+		}},
+	}
+	var response struct {
+		Aggregations struct {
+			Values struct {
+				Buckets []struct {
+					Key any `json:"key"`
+				} `json:"buckets"`
+			} `json:"values"`
+		} `json:"aggregations"`
+	}
+	if err := executeElasticsearchSearch(ctx, conn, search, &response); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(response.Aggregations.Values.Buckets))
+	for _, bucket := range response.Aggregations.Values.Buckets {
+		values = append(values, elasticsearchFieldValue([]any{bucket.Key}))
+	}
+	return &LokiLabelValuesResult{Status: "success", Data: values}, nil
+}
+
+// Series implements LokiClient, listing the combinations of values the selector labels take in
+// the matching documents
+func (ElasticsearchClient) Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	selector, start, err := enforceElasticsearchPolicy(ctx, conn, selector, start, end)
+	if err != nil {
+		return nil, err
+	}
+	translated, err := translateLogQLToElasticsearch(selector)
+	if err != nil {
+		return nil, err
+	}
+	search := map[string]any{
+		"query": translated.boolQuery(start, end),
+		"size":  0,
+		"aggs":  map[string]any{"streams": elasticsearchComposite(translated.labels, nil)},
+	}
+	var response struct {
+		Aggregations struct {
+			Streams struct {
+				Buckets []struct {
+					Key map[string]any `json:"key"`
+				} `json:"buckets"`
+			} `json:"streams"`
+		} `json:"aggregations"`
+	}
+	if err := executeElasticsearchSearch(ctx, conn, search, &response); err != nil {
+		return nil, err
+	}
+	result := &LokiSeriesResult{Status: "success", Data: make([]map[string]string, 0, len(response.Aggregations.Streams.Buckets))}
+	for _, bucket := range response.Aggregations.Streams.Buckets {
+		result.Data = append(result.Data, elasticsearchBucketLabels(bucket.Key))
+	}
+	return result, nil
+}
+
+// DetectedFields implements LokiClient, listing the fields of the index other than the keyword
+// fields serving as labels, with their mapped types. Elasticsearch reports no cardinality.
+func (ElasticsearchClient) DetectedFields(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (*LokiDetectedFieldsResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	fields, err := elasticsearchFieldTypes(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	result := &LokiDetectedFieldsResult{}
+	for field, fieldType := range fields {
+		detected := LokiDetectedField{Label: elasticsearchLabel(field), Type: "string"}
+		switch fieldType {
+		case "keyword", "constant_keyword", "date", "date_nanos", "object", "nested", "alias":
+			continue
+		case "long", "integer", "short", "byte", "unsigned_long":
+			detected.Type = "int"
+		case "double", "float", "half_float", "scaled_float":
+			detected.Type = "float"
+		case "boolean":
+			detected.Type = "boolean"
+		}
+		if field == elasticsearchMessageField {
+			continue
+		}
+		result.Fields = append(result.Fields, detected)
+	}
+	sort.Slice(result.Fields, func(i, j int) bool { return result.Fields[i].Label < result.Fields[j].Label })
+	return result, nil
+}
+
+// enforceElasticsearchPolicy applies the query policy, the access scope and the time range limits
+// to the LogQL of a call before it is translated, since the search request sent to Elasticsearch
+// carries no LogQL for executeLokiRequest to check. Calls without LogQL, such as label value
+// lookups, are restricted to the labels of the caller's role. It returns the rewritten query and
+// start of the window.
+func enforceElasticsearchPolicy(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (string, time.Time, error) {
+	if query == "" {
+		if scope := accessScopeFromContext(ctx); scope != nil && len(scope.Labels) > 0 {
+			query = "{" + strings.Join(scope.scopeMatchers(), ", ") + "}"
+		}
+	}
+	params := url.Values{"start": {strconv.FormatInt(start.UnixNano(), 10)}, "end": {strconv.FormatInt(end.UnixNano(), 10)}}
+	if query != "" {
+		params.Set("query", query)
+	}
+	checked, err := enforceQueryPolicy(ctx, "?"+params.Encode(), conn.OrgID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	checked, err = enforceTimeLimits(ctx, checked)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	u, err := url.Parse(checked)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if limited, _, ok := parseLokiTimestamp(u.Query().Get("start")); ok {
+		start = limited
+	}
+	return u.Query().Get("query"), start, nil
+}
+
+// translateLogQLToElasticsearch translates a LogQL log query to the clauses of a bool query: the
+// stream selector and label filters to field queries, and line filters to phrase queries on the
+// message field. An empty query matches every document.
+func translateLogQLToElasticsearch(query string) (*elasticsearchQuery, error) {
+	translated := &elasticsearchQuery{}
+	rest := strings.TrimSpace(query)
+	if rest == "" {
+		return translated, nil
+	}
+	end := selectorEnd(rest)
+	if end < 0 {
+		return nil, fmt.Errorf("the elasticsearch backend needs a query starting with a stream selector: %s", query)
+	}
+	for _, part := range splitOutsideQuotes(rest[1:end], ',') {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		label, op, value, err := parseLabelMatcher(part)
+		if err != nil {
+			return nil, err
+		}
+		translated.addFieldFilter(label, op, value)
+		if !slices.Contains(translated.labels, label) {
+			translated.labels = append(translated.labels, label)
+		}
+	}
+	if len(translated.labels) == 0 {
+		return nil, fmt.Errorf("invalid selector: %s (expected label matchers such as namespace=\"prod\")", rest[:end+1])
+	}
+
+	for rest = strings.TrimSpace(rest[end+1:]); rest != ""; rest = strings.TrimSpace(rest) {
+		if op := rest[:min(2, len(rest))]; op == "|=" || op == "!=" || op == "|~" || op == "!~" {
+			if op[1] == '~' {
+				return nil, fmt.Errorf("the elasticsearch backend supports the |= and != line filters only: %s", rest)
+			}
+			quoted, err := strconv.QuotedPrefix(strings.TrimSpace(rest[2:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid line filter %s: expected a quoted string", rest)
+			}
+			value, _ := strconv.Unquote(quoted)
+			rest = strings.TrimSpace(rest[2:])[len(quoted):]
+			if value == "" {
+				continue
+			}
+			phrase := map[string]any{"match_phrase": map[string]any{elasticsearchMessageField: value}}
+			if op[0] == '!' {
+				translated.mustNot = append(translated.mustNot, phrase)
+			} else {
+				translated.filter = append(translated.filter, phrase)
+			}
+			continue
+		}
+		if rest[0] != '|' {
+			return nil, fmt.Errorf("unsupported LogQL for the elasticsearch backend: %s", rest)
+		}
+
+		// Documents are parsed when they are indexed, so parsers have nothing to do
+		rest = strings.TrimSpace(rest[1:])
+		if parser := victoriaLogsParserPattern.FindString(rest); parser != "" {
+			rest = rest[len(parser):]
+			continue
+		}
+		stage := splitOutsideQuotes(rest, '|')[0]
+		rest = rest[len(stage):]
+		if err := translated.addLabelFilter(strings.TrimSpace(stage)); err != nil {
+			return nil, err
+		}
+	}
+	return translated, nil
+}
+
+// addLabelFilter translates a LogQL label filter stage to a field query
+func (q *elasticsearchQuery) addLabelFilter(stage string) error {
+	m := victoriaLogsLabelFilterPattern.FindStringSubmatch(stage)
+	if m == nil {
+		return fmt.Errorf("LogQL stage | %s is not supported by the elasticsearch backend", stage)
+	}
+	label, op, value := m[1], m[2], strings.TrimSpace(m[3])
+	switch op {
+	case ">", ">=", "<", "<=":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("the elasticsearch backend supports numeric comparisons only: | %s", stage)
+		}
+		bound := map[string]string{">": "gt", ">=": "gte", "<": "lt", "<=": "lte"}[op]
+		q.filter = append(q.filter, map[string]any{"range": map[string]any{elasticsearchField(label): map[string]any{bound: n}}})
+		return nil
+	case "==":
+		op = "="
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return fmt.Errorf("invalid label filter | %s: expected a quoted string", stage)
+	}
+	q.addFieldFilter(label, op, unquoted)
+	return nil
+}
+
+// addFieldFilter adds the field query of a label matcher. Regular expressions match the whole
+// value like in LogQL, but use the Lucene syntax of Elasticsearch.
+func (q *elasticsearchQuery) addFieldFilter(label, op, value string) {
+	clause := map[string]any{"term": map[string]any{elasticsearchField(label): value}}
+	if op == "=~" || op == "!~" {
+		clause = map[string]any{"regexp": map[string]any{elasticsearchField(label): value}}
+	}
+	if op[0] == '!' {
+		q.mustNot = append(q.mustNot, clause)
+	} else {
+		q.filter = append(q.filter, clause)
+	}
+}
+
+// boolQuery returns the bool query matching the translated query in a window, excluding its end
+// like Loki
+func (q *elasticsearchQuery) boolQuery(start, end time.Time) map[string]any {
+	window := map[string]any{"range": map[string]any{elasticsearchTimeField: map[string]any{
+		"gte":    start.UTC().Format(time.RFC3339Nano),
+		"lt":     end.UTC().Format(time.RFC3339Nano),
+		"format": "strict_date_optional_time_nanos",
+	}}}
+	clauses := map[string]any{"filter": append([]any{window}, q.filter...)}
+	if len(q.mustNot) > 0 {
+		clauses["must_not"] = q.mustNot
+	}
+	return map[string]any{"bool": clauses}
+}
+
+// elasticsearchComposite returns a composite aggregation over the values of labels, with optional
+// sub-aggregations. Documents missing a label are counted with the others.
+func elasticsearchComposite(labels []string, aggs map[string]any) map[string]any {
+	sources := make([]any, 0, len(labels))
+	for _, label := range labels {
+		sources = append(sources, map[string]any{label: map[string]any{
+			"terms": map[string]any{"field": elasticsearchField(label), "missing_bucket": true},
+		}})
+	}
+	composite := map[string]any{"composite": map[string]any{"size": maxElasticsearchBuckets, "sources": sources}}
+	if aggs != nil {
+		composite["aggs"] = aggs
+	}
+	return composite
+}
+
+// elasticsearchBucketLabels returns the labels of a composite aggregation bucket key, leaving out
+// the labels the documents were missing
+func elasticsearchBucketLabels(key map[string]any) map[string]string {
+	labels := make(map[string]string, len(key))
+	for label, value := range key {
+		if value != nil {
+			labels[label] = elasticsearchFieldValue([]any{value})
+		}
+	}
+	return labels
+}
+
+// elasticsearchFieldTypes returns the type of each field of the index, leaving out the metadata
+// fields and fields mapped to different types in different indices
+func elasticsearchFieldTypes(ctx context.Context, conn LokiConnection) (map[string]string, error) {
+	body, err := executeElasticsearchRequest(ctx, conn, "_field_caps", url.Values{"fields": {"*"}})
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Fields map[string]map[string]json.RawMessage `json:"fields"`
+	}
+	if err := decodeLokiResponse(ctx, body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse Elasticsearch response: %v", err)
+	}
+	types := make(map[string]string, len(response.Fields))
+	for field, caps := range response.Fields {
+		if strings.HasPrefix(field, "_") || len(caps) != 1 {
+			continue
+		}
+		for fieldType := range caps {
+			types[field] = fieldType
+		}
+	}
+	return types, nil
+}
+
+// executeElasticsearchSearch runs a search of the connection's index and decodes the response
+func executeElasticsearchSearch(ctx context.Context, conn LokiConnection, search map[string]any, response any) error {
+	source, err := json.Marshal(search)
+	if err != nil {
+		return fmt.Errorf("failed to build Elasticsearch search: %v", err)
+	}
+	params := url.Values{"source": {string(source)}, "source_content_type": {"application/json"}}
+	body, err := executeElasticsearchRequest(ctx, conn, "_search", params)
+	if err != nil {
+		return err
+	}
+	if err := decodeLokiResponse(ctx, body, response); err != nil {
+		return fmt.Errorf("failed to parse Elasticsearch response: %v", err)
+	}
+	return nil
+}
+
+// executeElasticsearchRequest sends a GET request to an API of the index the org ID names, by
+// default logs-*. The org ID is checked against the access policy like a Loki tenant, and not sent
+// as a header.
+func executeElasticsearchRequest(ctx context.Context, conn LokiConnection, endpoint string, params url.Values) ([]byte, error) {
+	index := conn.OrgID
+	if index == "" {
+		index = defaultElasticsearchIndex
+	}
+	if !elasticsearchIndexPattern.MatchString(index) {
+		return nil, fmt.Errorf("invalid Elasticsearch index %q: the org ID must be an index name or pattern, e.g. logs-*", index)
+	}
+	ctx = context.WithValue(ctx, tenantHeadersKey{}, http.Header{})
+	u, err := url.Parse(conn.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Elasticsearch URL: %v", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + index + "/" + endpoint
+	u.RawQuery = params.Encode()
+	return executeLokiRequest(ctx, u.String(), conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// elasticsearchField returns the field a label names, e.g. service.name for service__name
+func elasticsearchField(label string) string {
+	return strings.ReplaceAll(label, "__", ".")
+}
+
+// elasticsearchLabel returns the label naming a field, e.g. service__name for service.name
+func elasticsearchLabel(field string) string {
+	return strings.ReplaceAll(field, ".", "__")
+}
+
+// elasticsearchFieldValue formats the first value of a field returned by a search
+func elasticsearchFieldValue(values []any) string {
+	if len(values) == 0 {
+		return ""
+	}
+	switch v := values[0].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(values[0])
+}
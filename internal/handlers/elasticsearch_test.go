@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestTranslateLogQLToElasticsearch tests translating LogQL log queries to Query DSL clauses
+func TestTranslateLogQLToElasticsearch(t *testing.T) {
+	for query, want := range map[string]string{
+		`{app="api"}`: `{"filter":[{"term":{"app":"api"}}],"labels":["app"]}`,
+		`{service__name="api", env=~"prod|staging"} |= "timeout"`: `{"filter":[{"term":{"service.name":"api"}},{"regexp":{"env":"prod|staging"}},` +
+			`{"match_phrase":{"message":"timeout"}}],"labels":["service__name","env"]}`,
+		`{app="api", pod!="api-1"} != "GET /health" | json | status >= 500`: `{"filter":[{"term":{"app":"api"}},{"range":{"status":{"gte":500}}}],` +
+			`"labels":["app","pod"],"must_not":[{"term":{"pod":"api-1"}},{"match_phrase":{"message":"GET /health"}}]}`,
+		"{app=\"api\"} | logfmt | level==\"error\" | path!~`/health.*`": `{"filter":[{"term":{"app":"api"}},{"term":{"level":"error"}}],` +
+			`"labels":["app"],"must_not":[{"regexp":{"path":"/health.*"}}]}`,
+	} {
+		translated, err := translateLogQLToElasticsearch(query)
+		if err != nil {
+			t.Errorf("translateLogQLToElasticsearch(%s): %v", query, err)
+			continue
+		}
+		clauses := map[string]any{"filter": translated.filter, "labels": translated.labels}
+		if len(translated.mustNot) > 0 {
+			clauses["must_not"] = translated.mustNot
+		}
+		if got, _ := json.Marshal(clauses); string(got) != want {
+			t.Errorf("translateLogQLToElasticsearch(%s) = %s, want %s", query, got, want)
+		}
+	}
+
+	for query, want := range map[string]string{
+		`app="api"`:                          "needs a query starting with a stream selector",
+		`{app="api"} |~ "5\\d\\d"`:           "supports the |= and != line filters only",
+		`{app="api"} | line_format "{{.x}}"`: "is not supported by the elasticsearch backend",
+		`{app="api"} | json | latency > 1s`:  "numeric comparisons only",
+	} {
+		if _, err := translateLogQLToElasticsearch(query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("translateLogQLToElasticsearch(%s) = %v, want an error containing %q", query, err, want)
+		}
+	}
+}
+
+// setElasticsearchDatasource installs a default elasticsearch datasource served by handler
+func setElasticsearchDatasource(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	SetConfig(&Config{LokiURL: DefaultLokiURL, Datasources: []Datasource{
+		{Name: "es", URL: server.URL, Backend: BackendElasticsearch, Default: true},
+	}})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+}
+
+// decodeElasticsearchSearch decodes the search a request sent in its source parameter
+func decodeElasticsearchSearch(t *testing.T, r *http.Request) map[string]any {
+	var search map[string]any
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("source")), &search); err != nil {
+		t.Errorf("Expected a JSON search, but got %v", err)
+	}
+	return search
+}
+
+// TestElasticsearchClient_Query tests running a log query as a search of the default index
+func TestElasticsearchClient_Query(t *testing.T) {
+	var search map[string]any
+	setElasticsearchDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs-*/_search" || r.Header.Get("X-Scope-OrgID") != "" {
+			t.Errorf("Unexpected request: %s %v", r.URL.Path, r.Header)
+		}
+		search = decodeElasticsearchSearch(t, r)
+		w.Write([]byte(`{"hits":{"hits":[` +
+			`{"fields":{"@timestamp":["2024-05-01T10:00:02.000000001Z"],"message":["upstream timeout"],"app":["api"]}},` +
+			`{"fields":{"@timestamp":["2024-05-01T10:00:01Z"],"message":["retrying timeout"],"app":["api"]}}]}}`))
+	})
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"} |= "timeout"`, "limit": float64(10), "format": "json"}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if search["size"] != float64(10) {
+		t.Errorf("Expected a size of 10, but got %v", search["size"])
+	}
+	if sort, _ := json.Marshal(search["sort"]); string(sort) != `[{"@timestamp":{"order":"desc"}}]` {
+		t.Errorf("Expected the newest entries first, but got %s", sort)
+	}
+	query, _ := json.Marshal(search["query"])
+	for _, want := range []string{`{"term":{"app":"api"}}`, `{"match_phrase":{"message":"timeout"}}`, `"format":"strict_date_optional_time_nanos"`} {
+		if !strings.Contains(string(query), want) {
+			t.Errorf("Expected %s in the query %s", want, query)
+		}
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{`"app": "api"`, "upstream timeout", "retrying timeout", "1714557602000000001"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in:\n%s", want, text)
+		}
+	}
+}
+
+// TestElasticsearchClient_MetricQuery tests running count_over_time and rate queries as date
+// histograms
+func TestElasticsearchClient_MetricQuery(t *testing.T) {
+	var search map[string]any
+	setElasticsearchDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		search = decodeElasticsearchSearch(t, r)
+		w.Write([]byte(`{"aggregations":{"series":{"buckets":[{"key":{"level":"error"},"over_time":{"buckets":[` +
+			`{"key":1714557540000,"doc_count":120},{"key":1714557600000,"doc_count":0}]}}]}}}`))
+	})
+
+	client := ElasticsearchClient{}
+	conn := ResolveLokiConnection(map[string]any{})
+	end := time.Unix(1714557600, 0)
+	result, err := client.MetricQuery(context.Background(), conn, `sum by (level) (rate({app="api"} | json [5m]))`, end.Add(-time.Hour), end, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	aggs, _ := json.Marshal(search["aggs"])
+	for _, want := range []string{`"field":"level"`, `"fixed_interval":"60s"`, `"min_doc_count":0`} {
+		if !strings.Contains(string(aggs), want) {
+			t.Errorf("Expected %s in the aggregations %s", want, aggs)
+		}
+	}
+	series := result.Data.Result[0]
+	if series.Metric["level"] != "error" || len(series.Values) != 2 || series.Values[0][0] != float64(1714557540) || series.Values[0][1] != "2" {
+		t.Errorf("Expected a rate of 2 per second for level=error, but got %+v", series)
+	}
+
+	if _, err := client.MetricQuery(context.Background(), conn, `topk(5, count_over_time({app="api"}[5m]))`, end.Add(-time.Hour), end, time.Minute); err == nil {
+		t.Error("Expected an error for an unsupported metric query")
+	}
+}
+
+// TestElasticsearchClient_Labels tests listing the keyword fields of an index as labels and their
+// values
+func TestElasticsearchClient_Labels(t *testing.T) {
+	var search map[string]any
+	setElasticsearchDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logs-app/_field_caps":
+			w.Write([]byte(`{"fields":{"_id":{"_id":{}},"app":{"keyword":{}},"service.name":{"keyword":{}},` +
+				`"message":{"text":{}},"status":{"long":{}},"@timestamp":{"date":{}}}}`))
+		case "/logs-app/_search":
+			search = decodeElasticsearchSearch(t, r)
+			w.Write([]byte(`{"aggregations":{"values":{"buckets":[{"key":"api","doc_count":3},{"key":"web","doc_count":1}]}}}`))
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	client := ElasticsearchClient{}
+	conn := ResolveLokiConnection(map[string]any{"org": "logs-app"})
+	now := time.Now()
+	labels, err := client.Labels(context.Background(), conn, now.Add(-time.Hour), now)
+	if err != nil || strings.Join(labels.Data, ",") != "app,service__name" {
+		t.Errorf("Unexpected labels: %+v, %v", labels, err)
+	}
+	fields, err := client.DetectedFields(context.Background(), conn, `{app="api"}`, now.Add(-time.Hour), now)
+	if err != nil || len(fields.Fields) != 1 || fields.Fields[0].Label != "status" || fields.Fields[0].Type != "int" {
+		t.Errorf("Unexpected detected fields: %+v, %v", fields, err)
+	}
+
+	// Values of a restricted role only come from the streams it may read
+	ctx := context.WithValue(context.Background(), accessScopeKey{}, &AccessRole{Labels: map[string]string{"namespace": "team-a-.*"}})
+	values, err := client.LabelValues(ctx, conn, "service__name", now.Add(-time.Hour), now)
+	if err != nil || strings.Join(values.Data, ",") != "api,web" {
+		t.Errorf("Unexpected label values: %+v, %v", values, err)
+	}
+	aggs, _ := json.Marshal(search["aggs"])
+	query, _ := json.Marshal(search["query"])
+	if !strings.Contains(string(aggs), `"field":"service.name"`) || !strings.Contains(string(query), `{"regexp":{"namespace":"team-a-.*"}}`) {
+		t.Errorf("Expected the values of service.name in team-a namespaces, but got %s %s", aggs, query)
+	}
+
+	if _, err := client.Labels(context.Background(), ResolveLokiConnection(map[string]any{"org": "../_cluster"}), now.Add(-time.Hour), now); err == nil ||
+		!strings.Contains(err.Error(), "invalid Elasticsearch index") {
+		t.Errorf("Expected an invalid index error, but got %v", err)
+	}
+}
+
+// TestElasticsearchClient_AccessScope tests restricting the searches of a role to its streams
+func TestElasticsearchClient_AccessScope(t *testing.T) {
+	var search map[string]any
+	setElasticsearchDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		search = decodeElasticsearchSearch(t, r)
+		w.Write([]byte(`{"hits":{"hits":[]}}`))
+	})
+
+	ctx := context.WithValue(context.Background(), accessScopeKey{}, &AccessRole{Labels: map[string]string{"namespace": "team-a-.*"}})
+	conn := ResolveLokiConnection(map[string]any{})
+	now := time.Now()
+	if _, err := (ElasticsearchClient{}).Query(ctx, conn, `{app="api"}`, now.Add(-time.Hour), now, 10); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if query, _ := json.Marshal(search["query"]); !strings.Contains(string(query), `{"regexp":{"namespace":"team-a-.*"}}`) {
+		t.Errorf("Expected the query to be restricted to team-a namespaces, but got %s", query)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// EnvLokiGeoIPFile sets the path of an ip2asn TSV database used to add the country and ASN of IP addresses
+const EnvLokiGeoIPFile = "LOKI_GEOIP_FILE"
+
+// IP enrichment limits
+const (
+	maxEnrichedIPs  = 50 // most frequent addresses looked up per result
+	rdnsConcurrency = 8
+	rdnsTimeout     = 2 * time.Second
+	rdnsCacheTTL    = 10 * time.Minute
+)
+
+// lookupAddr resolves the reverse DNS names of an address; replaced in tests
+var lookupAddr = net.DefaultResolver.LookupAddr
+
+// rdnsCache holds reverse DNS names, including failed lookups, keyed by address
+var rdnsCache = struct {
+	sync.Mutex
+	entries map[netip.Addr]rdnsEntry
+}{entries: make(map[netip.Addr]rdnsEntry)}
+
+type rdnsEntry struct {
+	name    string
+	fetched time.Time
+}
+
+// ipEnrichment describes an IP address found in a query result
+type ipEnrichment struct {
+	IP      string `json:"ip"`
+	Count   int    `json:"count"` // lines containing the address
+	Name    string `json:"rdns,omitempty"`
+	Country string `json:"country,omitempty"`
+	ASN     uint32 `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+// geoIPRange is one range of addresses of an ip2asn database
+type geoIPRange struct {
+	Start, End netip.Addr
+	ASN        uint32
+	Country    string
+	ASOrg      string
+}
+
+// geoIPDB is an ip2asn database, with ranges sorted by address
+type geoIPDB struct {
+	ranges []geoIPRange
+}
+
+// geoIPCache holds the database loaded from a path, reloaded when the file changes
+var geoIPCache = struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	db      *geoIPDB
+}{}
+
+// enrichOption returns the tool option for appending details of the IP addresses in the result
+func enrichOption() mcp.ToolOption {
+	return mcp.WithBoolean("enrich_ips",
+		mcp.Description(fmt.Sprintf("Append a table of the IP addresses found in the returned lines with the number of lines "+
+			"containing each, their reverse DNS name and, when a GeoIP database is configured with %s, their country and ASN, "+
+			"e.g. for access log investigations. At most %d addresses are looked up (default: false)", EnvLokiGeoIPFile, maxEnrichedIPs)),
+	)
+}
+
+// enrichRequested reports whether IP enrichment was requested for a tool call
+func enrichRequested(args map[string]any) bool {
+	enrich, _ := args["enrich_ips"].(bool)
+	return enrich
+}
+
+// enrichIPs finds the IP addresses in the result's lines and looks up the most frequent ones
+func enrichIPs(ctx context.Context, result *LokiResult, geoIPFile string) ([]ipEnrichment, error) {
+	counts := make(map[netip.Addr]int)
+	for _, stream := range result.Data.Result {
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				continue
+			}
+			for addr := range findIPs(value[1]) {
+				counts[addr]++
+			}
+		}
+	}
+	addrs := make([]netip.Addr, 0, len(counts))
+	for addr := range counts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if counts[addrs[i]] != counts[addrs[j]] {
+			return counts[addrs[i]] > counts[addrs[j]]
+		}
+		return addrs[i].Less(addrs[j])
+	})
+	if len(addrs) > maxEnrichedIPs {
+		addrs = addrs[:maxEnrichedIPs]
+	}
+
+	var db *geoIPDB
+	if geoIPFile != "" {
+		var err error
+		if db, err = loadGeoIPDB(geoIPFile); err != nil {
+			return nil, err
+		}
+	}
+
+	enrichments := make([]ipEnrichment, len(addrs))
+	sem := make(chan struct{}, rdnsConcurrency)
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		enrichments[i] = ipEnrichment{IP: addr.String(), Count: counts[addr]}
+		if db != nil {
+			if r, ok := db.lookup(addr); ok {
+				enrichments[i].Country, enrichments[i].ASN, enrichments[i].ASOrg = r.Country, r.ASN, r.ASOrg
+			}
+		}
+		wg.Add(1)
+		go func(e *ipEnrichment, addr netip.Addr) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			e.Name = reverseDNS(ctx, addr)
+		}(&enrichments[i], addr)
+	}
+	wg.Wait()
+	return enrichments, nil
+}
+
+// findIPs returns the valid IP addresses in a line
+func findIPs(line string) map[netip.Addr]struct{} {
+	found := make(map[netip.Addr]struct{})
+	for _, pattern := range []*regexp.Regexp{ipv4Pattern, ipv6Pattern} {
+		for _, candidate := range pattern.FindAllString(line, -1) {
+			if addr, err := netip.ParseAddr(candidate); err == nil {
+				found[addr.Unmap()] = struct{}{}
+			}
+		}
+	}
+	return found
+}
+
+// reverseDNS returns the first reverse DNS name of an address, or an empty string when it has none
+func reverseDNS(ctx context.Context, addr netip.Addr) string {
+	rdnsCache.Lock()
+	entry, ok := rdnsCache.entries[addr]
+	rdnsCache.Unlock()
+	if ok && time.Since(entry.fetched) < rdnsCacheTTL {
+		return entry.name
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, rdnsTimeout)
+	defer cancel()
+	names, err := lookupAddr(lookupCtx, addr.String())
+	if ctx.Err() != nil {
+		return ""
+	}
+	entry = rdnsEntry{fetched: time.Now()}
+	if err == nil && len(names) > 0 {
+		entry.name = strings.TrimSuffix(names[0], ".")
+	}
+
+	rdnsCache.Lock()
+	rdnsCache.entries[addr] = entry
+	rdnsCache.Unlock()
+	return entry.name
+}
+
+// loadGeoIPDB returns the database at the path, reading it again only when the file changed
+func loadGeoIPDB(path string) (*geoIPDB, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %v", err)
+	}
+	geoIPCache.Lock()
+	defer geoIPCache.Unlock()
+	if geoIPCache.db != nil && geoIPCache.path == path && geoIPCache.modTime.Equal(info.ModTime()) {
+		return geoIPCache.db, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %v", err)
+	}
+	defer file.Close()
+	db, err := parseGeoIPDB(bufio.NewScanner(file))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoIP database %s: %v", path, err)
+	}
+	geoIPCache.path, geoIPCache.modTime, geoIPCache.db = path, info.ModTime(), db
+	return db, nil
+}
+
+// parseGeoIPDB reads an ip2asn TSV database: range_start, range_end, AS_number, country_code and
+// AS_description separated by tabs. Ranges with AS number 0 are unrouted and left out.
+func parseGeoIPDB(scanner *bufio.Scanner) (*geoIPDB, error) {
+	db := &geoIPDB{}
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected range_start, range_end, AS_number, country_code and AS_description", lineNo)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid AS number %s", lineNo, fields[2])
+		}
+		if asn == 0 {
+			continue
+		}
+		r := geoIPRange{Start: start.Unmap(), End: end.Unmap(), ASN: uint32(asn), Country: fields[3]}
+		if len(fields) > 4 {
+			r.ASOrg = fields[4]
+		}
+		db.ranges = append(db.ranges, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].Start.Less(db.ranges[j].Start) })
+	return db, nil
+}
+
+// lookup returns the range containing an address
+func (db *geoIPDB) lookup(addr netip.Addr) (geoIPRange, bool) {
+	// The last range starting at or before the address is the only one that can contain it
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].Start) }) - 1
+	if i < 0 || db.ranges[i].End.Less(addr) || db.ranges[i].Start.BitLen() != addr.BitLen() {
+		return geoIPRange{}, false
+	}
+	return db.ranges[i], true
+}
+
+// describeEnrichments renders the IP enrichment table appended to a query result
+func describeEnrichments(enrichments []ipEnrichment) string {
+	if len(enrichments) == 0 {
+		return "No IP addresses found in the returned lines"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "IP addresses in the returned lines (%d):", len(enrichments))
+	for _, e := range enrichments {
+		fmt.Fprintf(&b, "\n  %s  lines=%d", e.IP, e.Count)
+		if e.Name != "" {
+			fmt.Fprintf(&b, "  rdns=%s", e.Name)
+		}
+		if e.Country != "" {
+			fmt.Fprintf(&b, "  country=%s", e.Country)
+		}
+		if e.ASN != 0 {
+			fmt.Fprintf(&b, "  asn=AS%d", e.ASN)
+			if e.ASOrg != "" {
+				fmt.Fprintf(&b, " (%s)", e.ASOrg)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// stubReverseDNS replaces reverse DNS lookups with a fixed table for the test
+func stubReverseDNS(t *testing.T, names map[string]string) {
+	original := lookupAddr
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		if name, ok := names[addr]; ok {
+			return []string{name + "."}, nil
+		}
+		return nil, fmt.Errorf("no PTR record for %s", addr)
+	}
+	t.Cleanup(func() {
+		lookupAddr = original
+		rdnsCache.Lock()
+		defer rdnsCache.Unlock()
+		clear(rdnsCache.entries)
+	})
+}
+
+const testGeoIPDB = "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"10.0.0.0\t10.255.255.255\t0\tNone\tNot routed\n" +
+	"2001:db8::\t2001:db8::ffff\t64500\tDE\tEXAMPLE-AS\n" +
+	"203.0.113.0\t203.0.113.255\t64501\tJP\tDOC-NET\n"
+
+// TestParseGeoIPDB tests looking up addresses in an ip2asn database
+func TestParseGeoIPDB(t *testing.T) {
+	db, err := parseGeoIPDB(bufio.NewScanner(strings.NewReader(testGeoIPDB)))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for addr, want := range map[string]string{
+		"1.0.0.1":      "US AS13335",
+		"203.0.113.77": "JP AS64501",
+		"2001:db8::1":  "DE AS64500",
+		"10.1.2.3":     "",
+		"1.0.1.0":      "",
+		"::1":          "",
+	} {
+		r, ok := db.lookup(mustParseAddr(t, addr))
+		got := ""
+		if ok {
+			got = fmt.Sprintf("%s AS%d", r.Country, r.ASN)
+		}
+		if got != want {
+			t.Errorf("lookup(%s) = %q, want %q", addr, got, want)
+		}
+	}
+
+	if _, err := parseGeoIPDB(bufio.NewScanner(strings.NewReader("1.0.0.0\tnot-an-ip\t1\tUS\n"))); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected a parse error, but got %v", err)
+	}
+}
+
+// TestHandleLokiQuery_EnrichIPs tests appending the IP addresses of the returned lines with their details
+func TestHandleLokiQuery_EnrichIPs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if err := os.WriteFile(path, []byte(testGeoIPDB), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(&Config{LokiURL: DefaultLokiURL, GeoIPFile: path})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	stubReverseDNS(t, map[string]string{"1.0.0.1": "one.one.one.one"})
+	query := `{app="nginx"}`
+	SetLokiClient(&cannedQueryLokiClient{lines: map[string][]string{query: {
+		`1.0.0.1 - - "GET / HTTP/1.1" 200`,
+		`1.0.0.1 - - "GET /login HTTP/1.1" 401`,
+		`203.0.113.77 - - "GET / HTTP/1.1" 200 via 2001:db8::1`,
+		`999.1.1.1 is not an address`,
+	}}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": query, "enrich_ips": true}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+	want := "IP addresses in the returned lines (3):\n" +
+		"  1.0.0.1  lines=2  rdns=one.one.one.one  country=US  asn=AS13335 (CLOUDFLARENET)\n" +
+		"  203.0.113.77  lines=1  country=JP  asn=AS64501 (DOC-NET)\n" +
+		"  2001:db8::1  lines=1  country=DE  asn=AS64500 (EXAMPLE-AS)"
+	if text != want {
+		t.Errorf("Unexpected enrichment:\n%s\nwant:\n%s", text, want)
+	}
+	if ips, _ := result.Meta["ips"].([]ipEnrichment); len(ips) != 3 {
+		t.Errorf("Expected the addresses in the metadata, but got %v", result.Meta["ips"])
+	}
+}
+
+// mustParseAddr parses an IP address or fails the test
+func mustParseAddr(t *testing.T, s string) netip.Addr {
+	t.Helper()
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// resultMetadata is the machine-readable metadata returned in the _meta field of tool results,
+// so clients don't have to parse the formatted text
+type resultMetadata struct {
+	EntryCount  int
+	Truncated   bool
+	Start       time.Time
+	End         time.Time
+	Conn        LokiConnection
+	NextCursor  string            // end time to pass to fetch the next, older page of a truncated result
+	Suggestions []string          // selector corrections suggested for an empty result
+	Sample      *sampleSummary    // entries returned out of those fetched, when sampling
+	Groups      []streamGroup     // line and stream counts per group_by value, when grouping
+	Budget      *budgetAdjustment // how the limit was reduced to fit the output budget
+	Partial     *sliceCoverage    // the part of the time range a sliced query covered before timing out
+	IPs         []ipEnrichment    // IP addresses in the returned lines, when enriching
+	Pods        []podEnrichment   // Kubernetes metadata of the returned streams' pods, when enriching
+	Multiline   *multilineSummary // continuation lines joined into multi-line entries
+}
+
+// newResultMetadata describes the time range and datasource a tool call used
+func newResultMetadata(params toolParams) resultMetadata {
+	return resultMetadata{Start: params.Start, End: params.End, Conn: params.Conn}
+}
+
+// withEntries records the number of log entries in a query result, and the cursor
+// for the next page when the result was truncated at limit
+func (m resultMetadata) withEntries(result *LokiResult, limit int) resultMetadata {
+	var oldest int64
+	for _, stream := range result.Data.Result {
+		for _, value := range stream.Values {
+			m.EntryCount++
+			if len(value) == 0 {
+				continue
+			}
+			if ts, err := strconv.ParseInt(value[0], 10, 64); err == nil && (oldest == 0 || ts < oldest) {
+				oldest = ts
+			}
+		}
+	}
+
+	m.Truncated = limit > 0 && m.EntryCount >= limit
+	if m.Truncated && oldest > 0 {
+		m.NextCursor = time.Unix(0, oldest).UTC().Format(time.RFC3339Nano)
+	}
+	return m
+}
+
+// attach adds the metadata to the _meta field of a tool result
+func (m resultMetadata) attach(result *mcp.CallToolResult) *mcp.CallToolResult {
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["entry_count"] = m.EntryCount
+	result.Meta["truncated"] = m.Truncated
+	result.Meta["start"] = m.Start.UTC().Format(time.RFC3339)
+	result.Meta["end"] = m.End.UTC().Format(time.RFC3339)
+	result.Meta["datasource"] = redactURL(m.Conn.URL)
+	if m.Conn.OrgID != "" {
+		result.Meta["org"] = m.Conn.OrgID
+	}
+	if m.NextCursor != "" {
+		result.Meta["next_cursor"] = m.NextCursor
+	}
+	if len(m.Suggestions) > 0 {
+		result.Meta["suggestions"] = m.Suggestions
+	}
+	if m.Sample != nil {
+		result.Meta["sampled"] = m.Sample.Returned
+		result.Meta["sample_skipped"] = m.Sample.Total - m.Sample.Returned
+	}
+	if m.Groups != nil {
+		result.Meta["groups"] = m.Groups
+	}
+	if m.Partial != nil {
+		result.Meta["partial"] = true
+		result.Meta["covered"] = m.Partial.Covered
+	}
+	if m.Budget != nil {
+		result.Meta["limit_adjusted"] = m.Budget.meta()
+	}
+	if m.IPs != nil {
+		result.Meta["ips"] = m.IPs
+	}
+	if m.Pods != nil {
+		result.Meta["pods"] = m.Pods
+	}
+	if m.Multiline != nil {
+		result.Meta["multiline_joined"] = m.Multiline.Joined
+	}
+	return result
+}
+
+// attachJSONOption returns the tool option for attaching the full JSON result as an embedded resource
+func attachJSONOption() mcp.ToolOption {
+	return mcp.WithBoolean("attach_json",
+		mcp.Description("Also return the full result as JSON in an embedded resource, alongside the formatted text (default: false)"),
+	)
+}
+
+// attachJSONRequested reports whether the JSON result should be attached. It is redundant
+// when the formatted text is already JSON.
+func attachJSONRequested(params toolParams) bool {
+	attach, _ := params.Args["attach_json"].(bool)
+	return attach && params.Format != "json"
+}
+
+// attachJSONResource appends the JSON rendering of a result to a tool result as an embedded
+// resource, so a human reads the formatted text while an agent still has the full data
+func attachJSONResource(ctx context.Context, result *mcp.CallToolResult, jsonText string) *mcp.CallToolResult {
+	uri := "loki://result.json"
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		uri = "loki://result/" + requestID + ".json"
+	}
+	result.Content = append(result.Content, mcp.NewEmbeddedResource(mcp.TextResourceContents{
+		URI:      uri,
+		MIMEType: "application/json",
+		Text:     jsonText,
+	}))
+	return result
+}
+
+// redactURL hides any password in a URL's user info
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
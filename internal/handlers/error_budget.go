@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Default pattern identifying error lines for the error budget tool
+const defaultErrorPattern = `(?i)(error|exception|fatal|panic)`
+
+// errorBucket holds the line counts for one time bucket
+type errorBucket struct {
+	Start  string  `json:"start"`
+	Total  float64 `json:"total"`
+	Errors float64 `json:"errors"`
+	Ratio  float64 `json:"error_ratio"`
+}
+
+// errorBudgetReport summarizes error ratios and SLO burn for a selector
+type errorBudgetReport struct {
+	TotalQuery  string        `json:"total_query"`
+	ErrorQuery  string        `json:"error_query"`
+	Step        string        `json:"step"`
+	SLO         float64       `json:"slo_percent"`
+	Buckets     []errorBucket `json:"buckets"`
+	Total       float64       `json:"total"`
+	Errors      float64       `json:"errors"`
+	Ratio       float64       `json:"error_ratio"`
+	BurnRate    float64       `json:"burn_rate"`
+	Assessment  string        `json:"assessment"`
+	WorstBucket *errorBucket  `json:"worst_bucket,omitempty"`
+}
+
+// NewLokiErrorBudgetTool creates and returns a tool for computing error ratios and SLO burn from logs
+func NewLokiErrorBudgetTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Compute the error ratio over time from logs (lines matching an error pattern divided by all lines " +
+			"for a selector), bucketed by interval, and assess the error budget burn rate against an SLO target."),
+		mcp.WithString("selector",
+			mcp.Required(),
+			mcp.Description("Stream selector, optionally with filters, e.g. {app=\"api\"} or {app=\"api\"} |= \"HTTP\""),
+		),
+		mcp.WithString("error_pattern",
+			mcp.Description(fmt.Sprintf("Regular expression identifying error lines (default: %s)", defaultErrorPattern)),
+		),
+		mcp.WithString("step",
+			mcp.Description("Bucket size, e.g. 5m or 1h (default: 5m)"),
+		),
+		mcp.WithNumber("slo",
+			mcp.Description("SLO target as a percentage of good lines, e.g. 99.9 (default: 99.9)"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the analysis (default: 6h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the analysis (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+		chartOption(),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_error_budget", opts...)
+}
+
+// HandleLokiErrorBudget handles Loki error budget tool requests
+func HandleLokiErrorBudget(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	selector, _ := args["selector"].(string)
+	if selector == "" {
+		return nil, fmt.Errorf("selector is required")
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	errorPattern := defaultErrorPattern
+	if patternArg, ok := args["error_pattern"].(string); ok && patternArg != "" {
+		errorPattern = patternArg
+	}
+
+	step, err := durationArg(args, "step", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	slo := 99.9
+	if sloVal, ok := args["slo"].(float64); ok {
+		if sloVal <= 0 || sloVal >= 100 {
+			return nil, fmt.Errorf("slo must be between 0 and 100 (exclusive)")
+		}
+		slo = sloVal
+	}
+
+	start, end, err := parseTimeRange(args, 6*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	format := formatArg(args)
+
+	rangeStr := formatLogQLDuration(step)
+	totalQuery := fmt.Sprintf("sum(count_over_time(%s [%s]))", selector, rangeStr)
+	errorQuery := fmt.Sprintf("sum(count_over_time(%s |~ %s [%s]))", selector, quoteLogQLString(errorPattern), rangeStr)
+
+	conn := ResolveLokiConnection(args)
+	totalResult, err := runLokiMetricQuery(ctx, conn, totalQuery, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	errorResult, err := runLokiMetricQuery(ctx, conn, errorQuery, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	report := computeErrorBudget(totalResult.sumByTime(), errorResult.sumByTime(), slo)
+	report.TotalQuery = totalQuery
+	report.ErrorQuery = errorQuery
+	report.Step = rangeStr
+
+	formattedResult, err := formatErrorBudget(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	if chart, _ := args["chart"].(bool); chart {
+		return attachChart(mcp.NewToolResultText(formattedResult), []chartSeries{
+			sumsChartSeries("all lines", totalResult.sumByTime()),
+			sumsChartSeries("error lines", errorResult.sumByTime()),
+		})
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// computeErrorBudget builds per-bucket error ratios and the overall burn assessment
+func computeErrorBudget(totals, errors map[int64]float64, slo float64) errorBudgetReport {
+	report := errorBudgetReport{SLO: slo, Buckets: []errorBucket{}}
+
+	timestamps := make([]int64, 0, len(totals))
+	for ts := range totals {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	for _, ts := range timestamps {
+		bucket := errorBucket{
+			Start:  time.Unix(ts, 0).Format(time.RFC3339),
+			Total:  totals[ts],
+			Errors: errors[ts],
+		}
+		if bucket.Total > 0 {
+			bucket.Ratio = bucket.Errors / bucket.Total
+		}
+		report.Buckets = append(report.Buckets, bucket)
+		report.Total += bucket.Total
+		report.Errors += bucket.Errors
+
+		if report.WorstBucket == nil || bucket.Ratio > report.WorstBucket.Ratio {
+			worst := bucket
+			report.WorstBucket = &worst
+		}
+	}
+
+	if report.Total > 0 {
+		report.Ratio = report.Errors / report.Total
+	}
+	budget := 1 - slo/100
+	report.BurnRate = report.Ratio / budget
+	report.Assessment = assessBurnRate(report.BurnRate, report.Total)
+
+	return report
+}
+
+// assessBurnRate describes a burn rate using the common multi-window alerting thresholds
+func assessBurnRate(burnRate, total float64) string {
+	switch {
+	case total == 0:
+		return "no data: no log lines matched the selector"
+	case burnRate >= 14.4:
+		return "critical: burning error budget at page-worthy speed (>= 14.4x)"
+	case burnRate >= 6:
+		return "high: burning error budget fast (>= 6x)"
+	case burnRate >= 1:
+		return "elevated: burning error budget faster than the SLO allows (>= 1x)"
+	default:
+		return "ok: within error budget"
+	}
+}
+
+// formatErrorBudget formats the error budget report into a readable string
+func formatErrorBudget(report errorBudgetReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		output := fmt.Sprintf("Error ratio per %s bucket:\n\n", report.Step)
+		output += fmt.Sprintf("%-25s %10s %10s %8s\n", "Bucket", "Total", "Errors", "Error %")
+		for _, b := range report.Buckets {
+			output += fmt.Sprintf("%-25s %10.0f %10.0f %7.2f%%\n", b.Start, b.Total, b.Errors, b.Ratio*100)
+		}
+		output += fmt.Sprintf("\nOverall: %.0f errors out of %.0f lines (%.3f%%)\n", report.Errors, report.Total, report.Ratio*100)
+		if report.WorstBucket != nil {
+			output += fmt.Sprintf("Worst bucket: %s (%.2f%%)\n", report.WorstBucket.Start, report.WorstBucket.Ratio*100)
+		}
+		output += fmt.Sprintf("SLO target: %g%% (error budget %.3g%%), burn rate: %.2fx\n", report.SLO, 100-report.SLO, report.BurnRate)
+		output += fmt.Sprintf("Assessment: %s\n", report.Assessment)
+		if format == "text" {
+			output += fmt.Sprintf("\nQueries used:\n  %s\n  %s\n", report.TotalQuery, report.ErrorQuery)
+		}
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestComputeErrorBudget tests per-bucket ratios and the burn rate assessment
+func TestComputeErrorBudget(t *testing.T) {
+	totals := map[int64]float64{1705312200: 1000, 1705312500: 1000}
+	errors := map[int64]float64{1705312200: 2, 1705312500: 18}
+
+	report := computeErrorBudget(totals, errors, 99.9)
+
+	if len(report.Buckets) != 2 {
+		t.Fatalf("Expected 2 buckets, but got %d", len(report.Buckets))
+	}
+	if report.Buckets[0].Ratio != 0.002 || report.Buckets[1].Ratio != 0.018 {
+		t.Errorf("Unexpected bucket ratios: %+v", report.Buckets)
+	}
+	if report.Ratio != 0.01 {
+		t.Errorf("Expected overall ratio 0.01, but got %v", report.Ratio)
+	}
+	// 1% errors against a 0.1% budget burns at 10x
+	if report.BurnRate < 9.99 || report.BurnRate > 10.01 {
+		t.Errorf("Expected burn rate 10, but got %v", report.BurnRate)
+	}
+	if !strings.HasPrefix(report.Assessment, "high") {
+		t.Errorf("Expected high burn assessment, but got %s", report.Assessment)
+	}
+	if report.WorstBucket == nil || report.WorstBucket.Ratio != 0.018 {
+		t.Errorf("Unexpected worst bucket: %+v", report.WorstBucket)
+	}
+}
+
+// TestComputeErrorBudget_NoData tests the assessment when no lines matched
+func TestComputeErrorBudget_NoData(t *testing.T) {
+	report := computeErrorBudget(map[int64]float64{}, map[int64]float64{}, 99.9)
+	if !strings.HasPrefix(report.Assessment, "no data") {
+		t.Errorf("Expected no data assessment, but got %s", report.Assessment)
+	}
+}
+
+// TestLokiMetricSeries_Samples tests parsing of matrix values as decoded from JSON
+func TestLokiMetricSeries_Samples(t *testing.T) {
+	var series LokiMetricSeries
+	if err := json.Unmarshal([]byte(`{"metric":{},"values":[[1705312500,"3"],[1705312200,"1.5"],[1705312800,"bad"]]}`), &series); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	samples := series.samples()
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 valid samples, but got %d", len(samples))
+	}
+	if samples[0].Time.Unix() != 1705312200 || samples[0].Value != 1.5 {
+		t.Errorf("Unexpected first sample: %+v", samples[0])
+	}
+}
+
+// TestFormatLogQLDuration tests compact duration rendering for range selectors
+func TestFormatLogQLDuration(t *testing.T) {
+	for d, expected := range map[string]string{"5m": "5m", "1h": "1h", "90s": "90s", "1h30m": "90m"} {
+		duration, _ := durationArg(map[string]any{"d": d}, "d", 0)
+		if output := formatLogQLDuration(duration); output != expected {
+			t.Errorf("formatLogQLDuration(%s): expected %s, but got %s", d, expected, output)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Maximum length of an error message taken from a Loki response body
+const maxErrorMessageLength = 500
+
+// Kinds of errors reported by Loki and its query frontend
+const (
+	LokiErrorMaxEntries   = "max_entries_limit"
+	LokiErrorQueryLength  = "query_too_long"
+	LokiErrorMaxSeries    = "max_series_limit"
+	LokiErrorQueryBytes   = "max_query_bytes"
+	LokiErrorResolution   = "max_resolution"
+	LokiErrorRateLimited  = "rate_limited"
+	LokiErrorTimeout      = "timeout"
+	LokiErrorParse        = "parse_error"
+	LokiErrorNoOrgID      = "missing_org_id"
+	LokiErrorUnauthorized = "unauthorized"
+	LokiErrorNotFound     = "not_found"
+	LokiErrorUnknown      = "unknown"
+)
+
+// LokiError is an error response from Loki classified into a known kind with a remediation hint
+type LokiError struct {
+	StatusCode int
+	Kind       string
+	Message    string
+	Hint       string
+}
+
+// Error implements the error interface
+func (e *LokiError) Error() string {
+	msg := fmt.Sprintf("loki error (HTTP %d): %s", e.StatusCode, e.Message)
+	if e.StatusCode == 0 {
+		msg = fmt.Sprintf("loki error: %s", e.Message)
+	}
+	if e.Hint != "" {
+		msg += ". Hint: " + e.Hint
+	}
+	return msg
+}
+
+// lokiErrorRule maps a message pattern to an error kind and remediation hint
+type lokiErrorRule struct {
+	pattern *regexp.Regexp
+	kind    string
+	hint    string
+}
+
+// lokiErrorRules classifies the error messages returned by Loki's querier and query frontend
+var lokiErrorRules = []lokiErrorRule{
+	{regexp.MustCompile(`(?i)max entries limit`), LokiErrorMaxEntries,
+		"lower the limit parameter or narrow the time range"},
+	{regexp.MustCompile(`(?i)query time range exceeds the limit|query length .* limit|query too long`), LokiErrorQueryLength,
+		"narrow the time range between start and end"},
+	{regexp.MustCompile(`(?i)maximum (number )?of (unique )?series|max(imum)? series`), LokiErrorMaxSeries,
+		"add label matchers or aggregate with sum by (...) to reduce the number of series"},
+	{regexp.MustCompile(`(?i)would read too many bytes|max_query_bytes|query bytes`), LokiErrorQueryBytes,
+		"use a more selective stream selector or a shorter time range"},
+	{regexp.MustCompile(`(?i)exceeded maximum resolution`), LokiErrorResolution,
+		"use a larger step or a shorter time range"},
+	{regexp.MustCompile(`(?i)too many (outstanding )?requests|rate limit`), LokiErrorRateLimited,
+		"wait a moment before retrying, or reduce the number of parallel queries"},
+	{regexp.MustCompile(`(?i)deadline exceeded|timeout|timed out`), LokiErrorTimeout,
+		"narrow the time range or add line filters so the query scans less data"},
+	{regexp.MustCompile(`(?i)parse error|syntax error|unexpected`), LokiErrorParse,
+		"check the LogQL syntax of the query"},
+	{regexp.MustCompile(`(?i)no org ?id`), LokiErrorNoOrgID,
+		"set the org parameter or the LOKI_ORG_ID environment variable"},
+}
+
+// htmlTagPattern matches HTML tags in error pages returned by proxies and gateways
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// newLokiError classifies an error response body returned by Loki with the given HTTP status
+func newLokiError(statusCode int, body []byte) *LokiError {
+	e := &LokiError{
+		StatusCode: statusCode,
+		Kind:       LokiErrorUnknown,
+		Message:    extractErrorMessage(body),
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+
+	for _, rule := range lokiErrorRules {
+		if rule.pattern.MatchString(e.Message) {
+			e.Kind = rule.kind
+			e.Hint = rule.hint
+			return e
+		}
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		e.Kind = LokiErrorUnauthorized
+		e.Hint = "check the username/password or token"
+	case http.StatusNotFound:
+		e.Kind = LokiErrorNotFound
+		e.Hint = "check that the URL points at a Loki server and that the endpoint is supported by its version"
+	case http.StatusTooManyRequests:
+		e.Kind = LokiErrorRateLimited
+		e.Hint = "wait a moment before retrying, or reduce the number of parallel queries"
+	case http.StatusGatewayTimeout:
+		e.Kind = LokiErrorTimeout
+		e.Hint = "narrow the time range or add line filters so the query scans less data"
+	}
+	return e
+}
+
+// extractErrorMessage returns the human-readable message from a JSON, HTML or plain text error body
+func extractErrorMessage(body []byte) string {
+	text := strings.TrimSpace(string(body))
+
+	var structured struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if strings.HasPrefix(text, "{") && json.Unmarshal(body, &structured) == nil {
+		if structured.Error != "" {
+			text = structured.Error
+		} else if structured.Message != "" {
+			text = structured.Message
+		}
+	}
+
+	if strings.HasPrefix(text, "<") {
+		text = htmlTagPattern.ReplaceAllString(text, " ")
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	if len(text) > maxErrorMessageLength {
+		text = truncateLine(text, maxErrorMessageLength)
+	}
+	return text
+}
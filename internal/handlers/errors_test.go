@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestNewLokiError tests classification of common Loki and gateway error responses
+func TestNewLokiError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statusCode int
+		body       string
+		kind       string
+		message    string
+	}{
+		{
+			name:       "Max entries limit",
+			statusCode: 400,
+			body:       "max entries limit per query exceeded, limit > max_entries_limit (10000 > 5000)\n",
+			kind:       LokiErrorMaxEntries,
+			message:    "max entries limit per query exceeded, limit > max_entries_limit (10000 > 5000)",
+		},
+		{
+			name:       "Query too long",
+			statusCode: 400,
+			body:       "the query time range exceeds the limit (query length: 800h0m0s, limit: 721h0m0s)",
+			kind:       LokiErrorQueryLength,
+		},
+		{
+			name:       "JSON error body",
+			statusCode: 400,
+			body:       `{"status":"error","errorType":"bad_data","error":"parse error at line 1, col 5: syntax error: unexpected IDENTIFIER"}`,
+			kind:       LokiErrorParse,
+			message:    "parse error at line 1, col 5: syntax error: unexpected IDENTIFIER",
+		},
+		{
+			name:       "HTML gateway page",
+			statusCode: 504,
+			body:       "<html><head><title>504 Gateway Time-out</title></head>\n<body><h1>504 Gateway Time-out</h1></body></html>",
+			kind:       LokiErrorTimeout,
+			message:    "504 Gateway Time-out 504 Gateway Time-out",
+		},
+		{
+			name:       "Missing tenant",
+			statusCode: 401,
+			body:       "no org id",
+			kind:       LokiErrorNoOrgID,
+		},
+		{
+			name:       "Unauthorized without body",
+			statusCode: 401,
+			body:       "",
+			kind:       LokiErrorUnauthorized,
+			message:    "Unauthorized",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newLokiError(tc.statusCode, []byte(tc.body))
+			if e.Kind != tc.kind {
+				t.Errorf("Expected kind %s, but got %s (%s)", tc.kind, e.Kind, e.Message)
+			}
+			if tc.message != "" && e.Message != tc.message {
+				t.Errorf("Expected message %q, but got %q", tc.message, e.Message)
+			}
+			if e.Hint == "" {
+				t.Error("Expected a remediation hint")
+			}
+		})
+	}
+}
+
+// TestLokiError_Error tests the rendered error string and unwrapping with errors.As
+func TestLokiError_Error(t *testing.T) {
+	var err error = newLokiError(400, []byte("max entries limit per query exceeded"))
+
+	if !strings.HasPrefix(err.Error(), "loki error (HTTP 400): max entries limit per query exceeded. Hint: ") {
+		t.Errorf("Unexpected error string: %s", err.Error())
+	}
+
+	var lokiErr *LokiError
+	if !errors.As(err, &lokiErr) || lokiErr.Kind != LokiErrorMaxEntries {
+		t.Errorf("Expected errors.As to find a max entries LokiError")
+	}
+}
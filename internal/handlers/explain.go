@@ -0,0 +1,862 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// logQLToken is a lexical token of a LogQL expression
+type logQLToken struct {
+	kind  string // "ident", "string", "number" or "op"
+	text  string
+	start int
+	end   int
+}
+
+// explainStep describes one part of a LogQL expression in evaluation order
+type explainStep struct {
+	Kind        string `json:"kind"`
+	Expression  string `json:"expression"`
+	Description string `json:"description"`
+	Depth       int    `json:"depth,omitempty"`
+}
+
+// queryExplanation is the structured explanation of a LogQL expression
+type queryExplanation struct {
+	Query string        `json:"query"`
+	Type  string        `json:"type"` // "log" or "metric"
+	Steps []explainStep `json:"steps"`
+	Notes []string      `json:"notes,omitempty"`
+}
+
+// logQLParser is a recursive descent parser producing explanation steps
+type logQLParser struct {
+	query  string
+	tokens []logQLToken
+	pos    int
+	depth  int
+	steps  []explainStep
+	notes  []string
+	metric bool
+}
+
+// Multi-character operators, longest first
+var logQLOperators = []string{"|=", "|~", "!=", "!~", "=~", "==", ">=", "<=", "{", "}", "(", ")", "[", "]", ",", "|", "=", ">", "<", "+", "-", "*", "/", "%", "^"}
+
+// Range aggregations and the description of what they compute
+var rangeAggregations = map[string]string{
+	"count_over_time":    "Count the log lines of each stream",
+	"rate":               "Compute the per-second rate of log lines (or of the unwrapped value) for each stream",
+	"bytes_over_time":    "Sum the bytes of the log lines of each stream",
+	"bytes_rate":         "Compute the per-second rate of log bytes for each stream",
+	"absent_over_time":   "Return 1 when no log lines exist",
+	"avg_over_time":      "Average the unwrapped values",
+	"sum_over_time":      "Sum the unwrapped values",
+	"min_over_time":      "Take the minimum of the unwrapped values",
+	"max_over_time":      "Take the maximum of the unwrapped values",
+	"stddev_over_time":   "Compute the standard deviation of the unwrapped values",
+	"stdvar_over_time":   "Compute the variance of the unwrapped values",
+	"quantile_over_time": "Compute a quantile of the unwrapped values",
+	"first_over_time":    "Take the first unwrapped value",
+	"last_over_time":     "Take the last unwrapped value",
+	"rate_counter":       "Compute the per-second rate of the unwrapped counter values",
+}
+
+// Vector aggregations and the description of how they combine series
+var vectorAggregations = map[string]string{
+	"sum":       "Sum the series",
+	"avg":       "Average the series",
+	"min":       "Take the minimum across series",
+	"max":       "Take the maximum across series",
+	"count":     "Count the series",
+	"stddev":    "Compute the standard deviation across series",
+	"stdvar":    "Compute the variance across series",
+	"topk":      "Keep the series with the highest values",
+	"bottomk":   "Keep the series with the lowest values",
+	"sort":      "Sort the series by value, ascending",
+	"sort_desc": "Sort the series by value, descending",
+}
+
+// Binary operators and their meaning
+var binaryOperators = map[string]string{
+	"+": "added to", "-": "minus", "*": "multiplied by", "/": "divided by", "%": "modulo", "^": "to the power of",
+	"==": "where equal to", "!=": "where not equal to", ">": "where greater than", "<": "where less than",
+	">=": "where greater than or equal to", "<=": "where less than or equal to",
+	"and": "intersected with", "or": "combined with", "unless": "excluding series in",
+}
+
+// Matcher operators and their meaning
+var matcherDescriptions = map[string]string{
+	"=": "equals", "!=": "does not equal", "=~": "matches regex", "!~": "does not match regex",
+}
+
+// NewLokiExplainQueryTool creates and returns a tool for explaining LogQL queries
+func NewLokiExplainQueryTool() mcp.Tool {
+	return mcp.NewTool("loki_explain_query",
+		mcp.WithDescription("Explain a LogQL query in plain English: its stream selector, line filters, parser stages, "+
+			"label filters, and aggregations, in the order Loki evaluates them. Does not contact Loki."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL query to explain"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiExplainQuery handles Loki explain query tool requests
+func HandleLokiExplainQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	format := formatArg(args)
+
+	explanation, err := explainLogQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	formattedResult, err := formatQueryExplanation(explanation, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// explainLogQL parses a LogQL expression and explains each part in evaluation order
+func explainLogQL(query string) (*queryExplanation, error) {
+	tokens, err := tokenizeLogQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &logQLParser{query: query, tokens: tokens}
+	if err := p.parseExpr(); err != nil {
+		return nil, fmt.Errorf("invalid LogQL: %v", err)
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("invalid LogQL: unexpected %q at offset %d", p.peek().text, p.peek().start)
+	}
+
+	explanation := &queryExplanation{Query: query, Type: "log", Steps: p.steps, Notes: p.notes}
+	if p.metric {
+		explanation.Type = "metric"
+	}
+	return explanation, nil
+}
+
+// tokenizeLogQL splits a LogQL expression into tokens
+func tokenizeLogQL(query string) ([]logQLToken, error) {
+	var tokens []logQLToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"' || c == '`':
+			end := i + 1
+			for end < len(query) && query[end] != c {
+				if c == '"' && query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("invalid LogQL: unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, logQLToken{kind: "string", text: query[i : end+1], start: i, end: end + 1})
+			i = end + 1
+
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(query) && (isIdentChar(query[end]) || query[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, logQLToken{kind: "number", text: query[i:end], start: i, end: end})
+			i = end
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			// Parser flags such as logfmt --strict
+			end := i + 2
+			for end < len(query) && (isIdentChar(query[end]) || query[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, logQLToken{kind: "ident", text: query[i:end], start: i, end: end})
+			i = end
+
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			end := i
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			tokens = append(tokens, logQLToken{kind: "ident", text: query[i:end], start: i, end: end})
+			i = end
+
+		default:
+			matched := false
+			for _, op := range logQLOperators {
+				if strings.HasPrefix(query[i:], op) {
+					tokens = append(tokens, logQLToken{kind: "op", text: op, start: i, end: i + len(op)})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("invalid LogQL: unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// isIdentChar reports whether c may appear in an identifier
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// done reports whether all tokens have been consumed
+func (p *logQLParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// peek returns the current token, or an empty token at the end of input
+func (p *logQLParser) peek() logQLToken {
+	if p.done() {
+		return logQLToken{start: len(p.query), end: len(p.query)}
+	}
+	return p.tokens[p.pos]
+}
+
+// peekAt returns the token n positions ahead of the current one
+func (p *logQLParser) peekAt(n int) logQLToken {
+	if p.pos+n >= len(p.tokens) {
+		return logQLToken{start: len(p.query), end: len(p.query)}
+	}
+	return p.tokens[p.pos+n]
+}
+
+// is reports whether the current token has the given text
+func (p *logQLParser) is(text string) bool {
+	return !p.done() && p.tokens[p.pos].text == text && p.tokens[p.pos].kind != "string"
+}
+
+// expect consumes a token with the given text or returns an error
+func (p *logQLParser) expect(text string) (logQLToken, error) {
+	if !p.is(text) {
+		if p.done() {
+			return logQLToken{}, fmt.Errorf("expected %q but the query ended", text)
+		}
+		return logQLToken{}, fmt.Errorf("expected %q but found %q at offset %d", text, p.peek().text, p.peek().start)
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+// next consumes and returns the current token
+func (p *logQLParser) next() logQLToken {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+// text returns the query text between the start of token from and the end of the previous token
+func (p *logQLParser) text(from int) string {
+	if from >= p.pos {
+		return ""
+	}
+	return p.query[p.tokens[from].start:p.tokens[p.pos-1].end]
+}
+
+// add appends an explanation step at the current nesting depth
+func (p *logQLParser) add(kind, expression, description string) {
+	p.steps = append(p.steps, explainStep{Kind: kind, Expression: expression, Description: description, Depth: p.depth})
+}
+
+// parseExpr parses an expression, explaining both operands of binary operations
+func (p *logQLParser) parseExpr() error {
+	start, from := len(p.steps), p.pos
+	if err := p.parseTerm(); err != nil {
+		return err
+	}
+
+	for !p.done() {
+		op := p.peek().text
+		desc, ok := binaryOperators[op]
+		if !ok || p.peek().kind == "string" {
+			return nil
+		}
+		p.pos++
+		if p.is("bool") {
+			p.pos++
+			desc += " (returning 0 or 1)"
+		}
+		p.metric = true
+
+		// Nest the left operand under a heading, followed by the right operand
+		for i := start; i < len(p.steps); i++ {
+			p.steps[i].Depth++
+		}
+		heading := explainStep{Kind: "binary_operation", Expression: p.text(from), Description: "Compute the left side:", Depth: p.depth}
+		p.steps = append(p.steps[:start], append([]explainStep{heading}, p.steps[start:]...)...)
+		p.add("binary_operation", op, strings.ToUpper(desc[:1])+desc[1:]+" the right side:")
+		p.depth++
+		if err := p.parseTerm(); err != nil {
+			return err
+		}
+		p.depth--
+	}
+	return nil
+}
+
+// parseTerm parses a literal, parenthesized expression, aggregation or log query
+func (p *logQLParser) parseTerm() error {
+	tok := p.peek()
+	switch {
+	case tok.kind == "number":
+		p.next()
+		p.metric = true
+		p.add("literal", tok.text, fmt.Sprintf("The constant %s", tok.text))
+		return nil
+	case tok.kind == "op" && tok.text == "(":
+		p.next()
+		if err := p.parseExpr(); err != nil {
+			return err
+		}
+		_, err := p.expect(")")
+		return err
+	case tok.kind == "op" && tok.text == "{":
+		return p.parseLogQuery()
+	case tok.kind == "ident":
+		if _, ok := rangeAggregations[tok.text]; ok {
+			return p.parseRangeAggregation()
+		}
+		if _, ok := vectorAggregations[tok.text]; ok {
+			return p.parseVectorAggregation()
+		}
+		if tok.text == "label_replace" || tok.text == "vector" {
+			return fmt.Errorf("function %s is not supported by the explainer", tok.text)
+		}
+	}
+	if p.done() {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %q at offset %d", tok.text, tok.start)
+}
+
+// parseLogQuery parses a stream selector followed by its pipeline
+func (p *logQLParser) parseLogQuery() error {
+	if err := p.parseSelector(); err != nil {
+		return err
+	}
+	return p.parseLogPipeline()
+}
+
+// parseSelector parses a stream selector such as {app="api", env=~"prod|staging"}
+func (p *logQLParser) parseSelector() error {
+	from := p.pos
+	if _, err := p.expect("{"); err != nil {
+		return err
+	}
+
+	var matchers []string
+	nonEmpty := false
+	for !p.is("}") {
+		if len(matchers) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return err
+			}
+		}
+		name := p.next()
+		if name.kind != "ident" {
+			return fmt.Errorf("expected a label name at offset %d", name.start)
+		}
+		op := p.next()
+		desc, ok := matcherDescriptions[op.text]
+		if !ok {
+			return fmt.Errorf("expected a matcher operator after %s at offset %d", name.text, op.start)
+		}
+		value := p.next()
+		if value.kind != "string" {
+			return fmt.Errorf("expected a quoted value for %s at offset %d", name.text, value.start)
+		}
+		unquoted := unquoteLogQLString(value.text)
+		matchers = append(matchers, fmt.Sprintf("%s %s %s", name.text, desc, strconv.Quote(unquoted)))
+		if (op.text == "=" && unquoted != "") || (op.text == "=~" && unquoted != "" && unquoted != ".*") {
+			nonEmpty = true
+		}
+	}
+	p.next()
+
+	if len(matchers) == 0 {
+		p.add("selector", p.text(from), "Select all streams")
+	} else {
+		p.add("selector", p.text(from), "Select log streams where "+strings.Join(matchers, " and "))
+	}
+	if !nonEmpty {
+		p.notes = append(p.notes, "Loki requires at least one label matcher that does not match the empty string, such as app=\"api\".")
+	}
+	return nil
+}
+
+// parseLogPipeline parses the line filters and pipeline stages following a selector
+func (p *logQLParser) parseLogPipeline() error {
+	sawFilter := false
+	for !p.done() {
+		from := p.pos
+		tok := p.peek()
+		if tok.kind != "op" {
+			return nil
+		}
+
+		switch tok.text {
+		case "|=", "!=", "|~", "!~":
+			if err := p.parseLineFilter(); err != nil {
+				return err
+			}
+			sawFilter = true
+
+		case "|":
+			p.next()
+			stage := p.peek()
+			if stage.kind != "ident" {
+				return fmt.Errorf("expected a pipeline stage after | at offset %d", stage.start)
+			}
+			if (stage.text == "json" || stage.text == "logfmt" || stage.text == "regexp" || stage.text == "pattern") && !sawFilter {
+				p.notes = append(p.notes, "Adding a line filter (|= or |~) before the parser reduces the number of lines Loki has to parse.")
+				sawFilter = true
+			}
+			if err := p.parseStage(from); err != nil {
+				return err
+			}
+
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseLineFilter parses a line filter, including chained alternatives such as |= "a" or "b"
+func (p *logQLParser) parseLineFilter() error {
+	from := p.pos
+	op := p.next()
+
+	var values []string
+	for {
+		value := p.next()
+		switch {
+		case value.kind == "string":
+			values = append(values, strconv.Quote(unquoteLogQLString(value.text)))
+		case value.kind == "ident" && value.text == "ip" && p.is("("):
+			p.next()
+			cidr := p.next()
+			if _, err := p.expect(")"); err != nil {
+				return err
+			}
+			values = append(values, "IP address in "+cidr.text)
+		default:
+			return fmt.Errorf("expected a string after %s at offset %d", op.text, value.start)
+		}
+		if !p.is("or") {
+			break
+		}
+		p.next()
+	}
+
+	alternatives := strings.Join(values, " or ")
+	var desc string
+	switch op.text {
+	case "|=":
+		desc = "Keep lines containing " + alternatives
+	case "!=":
+		desc = "Drop lines containing " + alternatives
+	case "|~":
+		desc = "Keep lines matching the regular expression " + alternatives
+	case "!~":
+		desc = "Drop lines matching the regular expression " + alternatives
+	}
+	p.add("line_filter", p.text(from), desc)
+	return nil
+}
+
+// parseStage parses a pipeline stage after its leading |
+func (p *logQLParser) parseStage(from int) error {
+	stage := p.next()
+	switch stage.text {
+	case "json", "logfmt":
+		var params, flags []string
+		for _, param := range p.parseStageParams() {
+			for _, field := range strings.Fields(param) {
+				if strings.HasPrefix(field, "--") {
+					flags = append(flags, field)
+					param = strings.TrimSpace(strings.Replace(param, field, "", 1))
+				}
+			}
+			if param != "" {
+				params = append(params, param)
+			}
+		}
+		name := "JSON"
+		if stage.text == "logfmt" {
+			name = "logfmt"
+		}
+		desc := fmt.Sprintf("Parse each line as %s and extract all fields as labels", name)
+		if len(params) > 0 {
+			desc = fmt.Sprintf("Parse each line as %s and extract %s as labels", name, strings.Join(params, ", "))
+		}
+		if len(flags) > 0 {
+			desc += fmt.Sprintf(" (flags: %s)", strings.Join(flags, " "))
+		}
+		p.add("parser", p.text(from), desc)
+
+	case "regexp", "pattern":
+		value := p.next()
+		if value.kind != "string" {
+			return fmt.Errorf("expected a string after %s at offset %d", stage.text, value.start)
+		}
+		p.add("parser", p.text(from), fmt.Sprintf("Extract labels from each line using the %s %s", stage.text, value.text))
+
+	case "unpack":
+		p.add("parser", p.text(from), "Unpack JSON lines written by Promtail's pack stage, restoring the embedded labels and line")
+
+	case "decolorize":
+		p.add("format", p.text(from), "Remove ANSI color codes from each line")
+
+	case "line_format":
+		value := p.next()
+		if value.kind != "string" {
+			return fmt.Errorf("expected a template after line_format at offset %d", value.start)
+		}
+		p.add("format", p.text(from), "Rewrite each line using the template "+value.text)
+
+	case "label_format":
+		params := p.parseStageParams()
+		p.add("format", p.text(from), "Set or rename labels: "+strings.Join(params, ", "))
+
+	case "drop", "keep":
+		params := p.parseStageParams()
+		verb := "Drop the labels"
+		if stage.text == "keep" {
+			verb = "Keep only the labels"
+		}
+		p.add("format", p.text(from), verb+" "+strings.Join(params, ", "))
+
+	case "unwrap":
+		field := p.next()
+		desc := fmt.Sprintf("Use the numeric value of label %s as the sample value", field.text)
+		if (field.text == "duration" || field.text == "duration_seconds" || field.text == "bytes") && p.is("(") {
+			p.next()
+			label := p.next()
+			if _, err := p.expect(")"); err != nil {
+				return err
+			}
+			desc = fmt.Sprintf("Use the value of label %s, converted from a %s string, as the sample value", label.text, strings.TrimSuffix(field.text, "_seconds"))
+		} else if field.kind != "ident" {
+			return fmt.Errorf("expected a label name after unwrap at offset %d", field.start)
+		}
+		p.metric = true
+		p.add("unwrap", p.text(from), desc)
+
+	default:
+		p.pos--
+		return p.parseLabelFilter(from)
+	}
+	return nil
+}
+
+// parseStageParams collects the comma-separated parameters of a stage such as json or label_format
+func (p *logQLParser) parseStageParams() []string {
+	var params []string
+	for !p.done() {
+		tok := p.peek()
+		if tok.kind == "op" && (tok.text == "|" || tok.text == "|=" || tok.text == "!=" || tok.text == "|~" ||
+			tok.text == "!~" || tok.text == "[" || tok.text == ")") {
+			break
+		}
+		from := p.pos
+		for !p.done() && !p.is(",") && !p.is("|") && !p.is("|=") && !p.is("!=") && !p.is("|~") && !p.is("!~") && !p.is("[") && !p.is(")") {
+			p.next()
+		}
+		if param := p.text(from); param != "" {
+			params = append(params, param)
+		}
+		if p.is(",") {
+			p.next()
+		}
+	}
+	return params
+}
+
+// parseLabelFilter parses a label filter expression such as status >= 500 and level="error"
+func (p *logQLParser) parseLabelFilter(from int) error {
+	var conditions []string
+	for {
+		name := p.next()
+		if name.kind != "ident" {
+			return fmt.Errorf("unknown pipeline stage %q at offset %d", name.text, name.start)
+		}
+		op := p.next()
+		value := p.next()
+		if op.kind != "op" || (value.kind != "string" && value.kind != "number") {
+			return fmt.Errorf("unknown pipeline stage %q at offset %d", name.text, name.start)
+		}
+
+		var cond string
+		switch {
+		case name.text == "__error__" && op.text == "=" && unquoteLogQLString(value.text) == "":
+			cond = "parsing and conversion succeeded (__error__ is empty)"
+		case name.text == "__error__" && op.text == "!=" && unquoteLogQLString(value.text) == "":
+			cond = "parsing or conversion failed (__error__ is set)"
+		default:
+			cond = describeLabelCondition(name.text, op.text, value.text)
+		}
+		if cond == "" {
+			return fmt.Errorf("unexpected operator %q in label filter at offset %d", op.text, op.start)
+		}
+		conditions = append(conditions, cond)
+
+		switch {
+		case p.is("and") || p.is(","):
+			p.next()
+			conditions = append(conditions, "and")
+		case p.is("or"):
+			p.next()
+			conditions = append(conditions, "or")
+		default:
+			p.add("label_filter", p.text(from), "Keep entries where "+strings.Join(conditions, " "))
+			return nil
+		}
+	}
+}
+
+// describeLabelCondition describes a single label filter comparison, or returns an empty string for unknown operators
+func describeLabelCondition(name, op, value string) string {
+	switch op {
+	case "=", "==":
+		return fmt.Sprintf("%s equals %s", name, value)
+	case "!=":
+		return fmt.Sprintf("%s does not equal %s", name, value)
+	case "=~":
+		return fmt.Sprintf("%s matches regex %s", name, value)
+	case "!~":
+		return fmt.Sprintf("%s does not match regex %s", name, value)
+	case ">", ">=", "<", "<=":
+		return fmt.Sprintf("%s %s %s", name, op, value)
+	}
+	return ""
+}
+
+// parseRangeAggregation parses a range aggregation such as rate({app="api"}[5m])
+func (p *logQLParser) parseRangeAggregation() error {
+	from := p.pos
+	fn := p.next()
+	p.metric = true
+	if _, err := p.expect("("); err != nil {
+		return err
+	}
+
+	param := ""
+	if fn.text == "quantile_over_time" {
+		tok := p.next()
+		if tok.kind != "number" {
+			return fmt.Errorf("expected a quantile for quantile_over_time at offset %d", tok.start)
+		}
+		param = tok.text
+		if _, err := p.expect(","); err != nil {
+			return err
+		}
+	}
+
+	if p.is("(") {
+		p.next()
+		if err := p.parseLogQuery(); err != nil {
+			return err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return err
+		}
+	} else if err := p.parseLogQuery(); err != nil {
+		return err
+	}
+
+	if _, err := p.expect("["); err != nil {
+		return err
+	}
+	window := p.next()
+	if window.kind != "number" {
+		return fmt.Errorf("expected a range duration at offset %d", window.start)
+	}
+	if _, err := p.expect("]"); err != nil {
+		return err
+	}
+
+	offset := ""
+	if p.is("offset") {
+		p.next()
+		offset = p.next().text
+	}
+	if _, err := p.expect(")"); err != nil {
+		return err
+	}
+	grouping, err := p.parseGrouping()
+	if err != nil {
+		return err
+	}
+
+	desc := rangeAggregations[fn.text]
+	if param != "" {
+		desc = fmt.Sprintf("Compute the %s quantile of the unwrapped values", param)
+	}
+	desc += fmt.Sprintf(" over each %s window", window.text)
+	if offset != "" {
+		desc += fmt.Sprintf(", shifted %s into the past", offset)
+	}
+	if grouping != "" {
+		desc += ", " + grouping
+	}
+	p.add("range_aggregation", p.text(from), desc)
+	return nil
+}
+
+// parseVectorAggregation parses a vector aggregation such as sum by (app) (...) or topk(5, ...)
+func (p *logQLParser) parseVectorAggregation() error {
+	from := p.pos
+	fn := p.next()
+	p.metric = true
+
+	grouping, err := p.parseGrouping()
+	if err != nil {
+		return err
+	}
+	if _, err := p.expect("("); err != nil {
+		return err
+	}
+
+	param := ""
+	if fn.text == "topk" || fn.text == "bottomk" {
+		tok := p.next()
+		if tok.kind != "number" {
+			return fmt.Errorf("expected a count for %s at offset %d", fn.text, tok.start)
+		}
+		param = tok.text
+		if _, err := p.expect(","); err != nil {
+			return err
+		}
+	}
+
+	if err := p.parseExpr(); err != nil {
+		return err
+	}
+	if _, err := p.expect(")"); err != nil {
+		return err
+	}
+	if grouping == "" {
+		if grouping, err = p.parseGrouping(); err != nil {
+			return err
+		}
+	}
+
+	desc := vectorAggregations[fn.text]
+	if param != "" {
+		desc = strings.Replace(desc, "the series", "the "+param+" series", 1)
+	}
+	if grouping != "" {
+		desc += ", " + grouping
+	} else if fn.text != "sort" && fn.text != "sort_desc" && param == "" {
+		desc += " into a single series"
+	}
+	p.add("vector_aggregation", p.text(from), desc)
+	return nil
+}
+
+// parseGrouping parses an optional by (...) or without (...) clause and describes it
+func (p *logQLParser) parseGrouping() (string, error) {
+	if !p.is("by") && !p.is("without") {
+		return "", nil
+	}
+	kind := p.next().text
+	if _, err := p.expect("("); err != nil {
+		return "", err
+	}
+	var labels []string
+	for !p.is(")") {
+		tok := p.next()
+		if tok.kind != "ident" && !(tok.kind == "op" && tok.text == ",") {
+			return "", fmt.Errorf("expected a label name in %s clause at offset %d", kind, tok.start)
+		}
+		if tok.kind == "ident" {
+			labels = append(labels, tok.text)
+		}
+	}
+	p.next()
+
+	if kind == "by" {
+		return "grouped by " + strings.Join(labels, ", "), nil
+	}
+	return "grouped by all labels except " + strings.Join(labels, ", "), nil
+}
+
+// unquoteLogQLString removes the quotes of a double-quoted or backtick string
+func unquoteLogQLString(s string) string {
+	if strings.HasPrefix(s, "`") {
+		return strings.Trim(s, "`")
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return strings.Trim(s, `"`)
+}
+
+// formatQueryExplanation formats the query explanation into a readable string
+func formatQueryExplanation(explanation *queryExplanation, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(explanation, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		var b strings.Builder
+		if format == "text" {
+			fmt.Fprintf(&b, "Query: %s\nType: %s query\n\n", explanation.Query, explanation.Type)
+		}
+		n := 0
+		for _, step := range explanation.Steps {
+			indent := strings.Repeat("   ", step.Depth)
+			if step.Kind == "binary_operation" {
+				fmt.Fprintf(&b, "%s%s\n", indent, step.Description)
+				continue
+			}
+			n++
+			fmt.Fprintf(&b, "%s%d. %s\n", indent, n, step.Description)
+			if format == "text" {
+				fmt.Fprintf(&b, "%s   %s\n", indent, step.Expression)
+			}
+		}
+		if len(explanation.Notes) > 0 {
+			b.WriteString("\nNotes:\n")
+			for _, note := range explanation.Notes {
+				fmt.Fprintf(&b, "- %s\n", note)
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestExplainLogQL_LogQuery tests explaining a log query with filters and pipeline stages
+func TestExplainLogQL_LogQuery(t *testing.T) {
+	explanation, err := explainLogQL(`{job="varlogs", env=~"prod.*"} |= "error" != "debug" | json | status >= 500 and method="GET" | line_format "{{.msg}}"`)
+	if err != nil {
+		t.Fatalf("explainLogQL failed: %v", err)
+	}
+	if explanation.Type != "log" {
+		t.Errorf("Expected log query, but got %s", explanation.Type)
+	}
+
+	expected := []struct {
+		kind        string
+		description string
+	}{
+		{"selector", `Select log streams where job equals "varlogs" and env matches regex "prod.*"`},
+		{"line_filter", `Keep lines containing "error"`},
+		{"line_filter", `Drop lines containing "debug"`},
+		{"parser", "Parse each line as JSON and extract all fields as labels"},
+		{"label_filter", `Keep entries where status >= 500 and method equals "GET"`},
+		{"format", `Rewrite each line using the template "{{.msg}}"`},
+	}
+	if len(explanation.Steps) != len(expected) {
+		t.Fatalf("Expected %d steps, but got %d: %+v", len(expected), len(explanation.Steps), explanation.Steps)
+	}
+	for i, e := range expected {
+		step := explanation.Steps[i]
+		if step.Kind != e.kind || step.Description != e.description {
+			t.Errorf("Step %d: expected %s %q, but got %s %q", i+1, e.kind, e.description, step.Kind, step.Description)
+		}
+	}
+	if len(explanation.Notes) != 0 {
+		t.Errorf("Expected no notes, but got %v", explanation.Notes)
+	}
+}
+
+// TestExplainLogQL_MetricQuery tests explaining unwrap, range and vector aggregations
+func TestExplainLogQL_MetricQuery(t *testing.T) {
+	explanation, err := explainLogQL(`topk(5, quantile_over_time(0.99, {app="api"} | logfmt --strict | unwrap duration(took) | __error__="" [1m]) by (route))`)
+	if err != nil {
+		t.Fatalf("explainLogQL failed: %v", err)
+	}
+	if explanation.Type != "metric" {
+		t.Errorf("Expected metric query, but got %s", explanation.Type)
+	}
+
+	descriptions := make([]string, len(explanation.Steps))
+	for i, step := range explanation.Steps {
+		descriptions[i] = step.Description
+	}
+	expected := []string{
+		`Select log streams where app equals "api"`,
+		"Parse each line as logfmt and extract all fields as labels (flags: --strict)",
+		"Use the value of label took, converted from a duration string, as the sample value",
+		"Keep entries where parsing and conversion succeeded (__error__ is empty)",
+		"Compute the 0.99 quantile of the unwrapped values over each 1m window, grouped by route",
+		"Keep the 5 series with the highest values",
+	}
+	if strings.Join(descriptions, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected steps:\n%s", strings.Join(descriptions, "\n"))
+	}
+	if len(explanation.Notes) != 1 || !strings.Contains(explanation.Notes[0], "line filter") {
+		t.Errorf("Expected a note about adding a line filter, but got %v", explanation.Notes)
+	}
+}
+
+// TestExplainLogQL_BinaryOperation tests that both operands of a binary operation are explained
+func TestExplainLogQL_BinaryOperation(t *testing.T) {
+	explanation, err := explainLogQL(`sum(count_over_time({app="api"} |= "error" [5m])) / sum(count_over_time({app="api"}[5m]))`)
+	if err != nil {
+		t.Fatalf("explainLogQL failed: %v", err)
+	}
+
+	output, err := formatQueryExplanation(explanation, "raw")
+	if err != nil {
+		t.Fatalf("formatQueryExplanation failed: %v", err)
+	}
+	expected := `Compute the left side:
+   1. Select log streams where app equals "api"
+   2. Keep lines containing "error"
+   3. Count the log lines of each stream over each 5m window
+   4. Sum the series into a single series
+Divided by the right side:
+   5. Select log streams where app equals "api"
+   6. Count the log lines of each stream over each 5m window
+   7. Sum the series into a single series
+`
+	if output != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, output)
+	}
+}
+
+// TestExplainLogQL_Invalid tests that malformed queries are rejected with a position
+func TestExplainLogQL_Invalid(t *testing.T) {
+	testCases := []string{
+		`{app="api"`,
+		`{app=api}`,
+		`rate({app="api"})`,
+		`{app="api"} |= "unterminated`,
+		`sum(rate({app="api"}[5m])) extra`,
+	}
+	for _, query := range testCases {
+		if _, err := explainLogQL(query); err == nil {
+			t.Errorf("Expected error for %s", query)
+		}
+	}
+}
+
+// TestExplainLogQL_EmptyMatcherNote tests the note about selectors that only match empty values
+func TestExplainLogQL_EmptyMatcherNote(t *testing.T) {
+	explanation, err := explainLogQL(`{namespace=~".*"} |= "x"`)
+	if err != nil {
+		t.Fatalf("explainLogQL failed: %v", err)
+	}
+	if len(explanation.Notes) != 1 || !strings.Contains(explanation.Notes[0], "at least one label matcher") {
+		t.Errorf("Expected a note about empty matchers, but got %v", explanation.Notes)
+	}
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Time after a connection failure before an endpoint is tried again
+const endpointRetryCooldown = 30 * time.Second
+
+// Timeout for a single endpoint health probe
+const endpointProbeTimeout = 5 * time.Second
+
+// endpointStatus tracks the health of a single Loki endpoint in a failover group
+type endpointStatus struct {
+	URL         string    `json:"url"`
+	Healthy     bool      `json:"healthy"`
+	Active      bool      `json:"active"`
+	Failures    int       `json:"consecutive_failures"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastChecked time.Time `json:"last_checked,omitzero"`
+	LatencyMs   int64     `json:"latency_ms,omitempty"`
+}
+
+// endpointGroup is an ordered list of equivalent Loki endpoints with one active endpoint
+type endpointGroup struct {
+	mu        sync.Mutex
+	endpoints []*endpointStatus
+	active    int
+}
+
+// endpointGroups holds the failover groups by their comma-separated URL list, and by the URL of
+// each of their endpoints to find the group a request URL belongs to
+var endpointGroups = struct {
+	sync.Mutex
+	groups     map[string]*endpointGroup
+	byEndpoint map[string]*endpointGroup
+}{groups: make(map[string]*endpointGroup), byEndpoint: make(map[string]*endpointGroup)}
+
+// splitLokiURLs splits a comma-separated list of Loki URLs, dropping empty entries and trailing slashes
+func splitLokiURLs(raw string) []string {
+	var urls []string
+	for _, u := range strings.Split(raw, ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// endpointGroupFor returns the failover group for a URL list, or nil for a single URL or a list
+// that is neither LOKI_URL nor the URL of a datasource. Groups keep state for the life of the
+// server, so lists sent by clients don't get one.
+func endpointGroupFor(raw string) *endpointGroup {
+	urls := splitLokiURLs(raw)
+	if len(urls) < 2 {
+		return nil
+	}
+	key := strings.Join(urls, ",")
+
+	endpointGroups.Lock()
+	defer endpointGroups.Unlock()
+	if group, ok := endpointGroups.groups[key]; ok {
+		return group
+	}
+	if !configuredEndpointList(key) {
+		return nil
+	}
+	group := &endpointGroup{}
+	for _, u := range urls {
+		group.endpoints = append(group.endpoints, &endpointStatus{URL: u, Healthy: true})
+		endpointGroups.byEndpoint[u] = group
+	}
+	endpointGroups.groups[key] = group
+	return group
+}
+
+// configuredEndpointList reports whether a normalized URL list is LOKI_URL or the URL of a datasource
+func configuredEndpointList(key string) bool {
+	cfg := CurrentConfig()
+	if strings.Join(splitLokiURLs(cfg.LokiURL), ",") == key {
+		return true
+	}
+	for _, ds := range cfg.Datasources {
+		if strings.Join(splitLokiURLs(ds.URL), ",") == key {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointGroupForRequest finds the failover group containing the endpoint a request URL was
+// built from, by looking up the URL and each of its parent paths
+func endpointGroupForRequest(requestURL string) (*endpointGroup, string) {
+	endpointGroups.Lock()
+	defer endpointGroups.Unlock()
+	if len(endpointGroups.byEndpoint) == 0 {
+		return nil, ""
+	}
+
+	base := requestURL
+	if i := strings.IndexAny(base, "?#"); i >= 0 {
+		base = base[:i]
+	}
+	for {
+		if group, ok := endpointGroups.byEndpoint[base]; ok {
+			return group, base
+		}
+		i := strings.LastIndexByte(base, '/')
+		if i <= 0 || base[i-1] == '/' {
+			return nil, ""
+		}
+		base = base[:i]
+	}
+}
+
+// urls returns the configured endpoint URLs in order
+func (g *endpointGroup) urls() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	urls := make([]string, len(g.endpoints))
+	for i, e := range g.endpoints {
+		urls[i] = e.URL
+	}
+	return urls
+}
+
+// activeURL returns the endpoint requests are currently sent to
+func (g *endpointGroup) activeURL() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.endpoints[g.active].URL
+}
+
+// candidates returns the endpoints to try for a request: the given endpoint first, then
+// the others in configured order, skipping endpoints that failed within the cooldown
+func (g *endpointGroup) candidates(first string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	candidates := []string{first}
+	for _, e := range g.endpoints {
+		if e.URL == first {
+			continue
+		}
+		if !e.Healthy && time.Since(e.LastChecked) < endpointRetryCooldown {
+			continue
+		}
+		candidates = append(candidates, e.URL)
+	}
+	return candidates
+}
+
+// markFailure records a connection failure for an endpoint
+func (g *endpointGroup) markFailure(endpoint string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, e := range g.endpoints {
+		if e.URL == endpoint {
+			e.Healthy = false
+			e.Failures++
+			e.LastError = err.Error()
+			e.LastChecked = time.Now()
+		}
+	}
+}
+
+// markSuccess records a successful response from an endpoint and makes it the active endpoint
+func (g *endpointGroup) markSuccess(endpoint string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, e := range g.endpoints {
+		if e.URL == endpoint {
+			e.Healthy = true
+			e.Failures = 0
+			e.LastError = ""
+			e.LastChecked = time.Now()
+			g.active = i
+		}
+	}
+}
+
+// failBack makes the first healthy endpoint in configured order the active endpoint
+func (g *endpointGroup) failBack() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, e := range g.endpoints {
+		if e.Healthy {
+			g.active = i
+			return
+		}
+	}
+}
+
+// snapshot returns a copy of the endpoint statuses
+func (g *endpointGroup) snapshot() []endpointStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	statuses := make([]endpointStatus, len(g.endpoints))
+	for i, e := range g.endpoints {
+		statuses[i] = *e
+		statuses[i].Active = i == g.active
+	}
+	return statuses
+}
+
+// isConnectionError reports whether a request failed before Loki produced a response,
+// as opposed to Loki rejecting the request or the caller cancelling it
+func isConnectionError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var lokiErr *LokiError
+	if errors.As(err, &lokiErr) {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// NewLokiEndpointHealthTool creates and returns a tool for reporting the health of the configured Loki endpoints
+func NewLokiEndpointHealthTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Check the health of the configured Loki endpoints. When the URL is a comma-separated list " +
+			"of endpoints, requests fail over between them on connection errors; this tool probes each endpoint's " +
+			"/ready endpoint and reports which one is active."),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_endpoint_health", opts...)
+}
+
+// HandleLokiEndpointHealth handles Loki endpoint health tool requests
+func HandleLokiEndpointHealth(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+
+	format := formatArg(args)
+
+	conn := ResolveLokiConnection(args)
+	group := endpointGroupFor(strings.Join(conn.Endpoints, ","))
+
+	var statuses []endpointStatus
+	if group == nil {
+		status := probeEndpoint(ctx, conn, conn.URL)
+		status.Active = true
+		statuses = []endpointStatus{status}
+	} else {
+		probes := make(map[string]endpointStatus)
+		for _, endpoint := range group.urls() {
+			probe := probeEndpoint(ctx, conn, endpoint)
+			if probe.Healthy {
+				group.markSuccess(endpoint)
+			} else {
+				group.markFailure(endpoint, errors.New(probe.LastError))
+			}
+			probes[endpoint] = probe
+		}
+		group.failBack()
+
+		statuses = group.snapshot()
+		for i := range statuses {
+			statuses[i].LatencyMs = probes[statuses[i].URL].LatencyMs
+		}
+	}
+
+	formattedResult, err := formatEndpointHealth(statuses, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// probeEndpoint checks an endpoint's /ready endpoint
+func probeEndpoint(ctx context.Context, conn LokiConnection, endpoint string) endpointStatus {
+	status := endpointStatus{URL: endpoint, LastChecked: time.Now()}
+
+	readyURL, err := buildLokiReadyURL(endpoint)
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err = sendLokiRequest(probeCtx, readyURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+	status.Healthy = true
+	return status
+}
+
+// buildLokiReadyURL constructs the URL of Loki's readiness endpoint, which lives outside the API path
+func buildLokiReadyURL(baseURL string) (string, error) {
+	return buildLokiRootURL(baseURL, "ready")
+}
+
+// formatEndpointHealth formats the endpoint statuses into a readable string
+func formatEndpointHealth(statuses []endpointStatus, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, s := range statuses {
+			state := "down"
+			if s.Healthy {
+				state = "up"
+			}
+			fmt.Fprintf(&b, "%s %s %dms", s.URL, state, s.LatencyMs)
+			if s.Active {
+				b.WriteString(" active")
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Loki endpoints (%d):\n\n", len(statuses))
+		for i, s := range statuses {
+			marker := " "
+			if s.Active {
+				marker = "*"
+			}
+			state := "healthy"
+			if !s.Healthy {
+				state = "unhealthy"
+			}
+			fmt.Fprintf(&b, "%s %d. %s - %s (%dms)\n", marker, i+1, s.URL, state, s.LatencyMs)
+			if s.LastError != "" {
+				fmt.Fprintf(&b, "     last error: %s\n", s.LastError)
+			}
+		}
+		b.WriteString("\n* active endpoint\n")
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestExecuteLokiRequest_Failover tests that connection errors fail over to the next endpoint
+func TestExecuteLokiRequest_Failover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":["job"]}`))
+	}))
+	defer server.Close()
+
+	// Nothing listens on the first endpoint, so connections are refused
+	down := "http://127.0.0.1:1"
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	setenv(t, EnvLokiURL, down+", "+server.URL+"/")
+	SetConfig(LoadConfig())
+	conn := ResolveLokiConnection(map[string]any{})
+	if conn.URL != down {
+		t.Fatalf("Expected first endpoint to be active, but got %s", conn.URL)
+	}
+	if len(conn.Endpoints) != 2 {
+		t.Fatalf("Expected 2 endpoints, but got %v", conn.Endpoints)
+	}
+
+	labelsURL, _ := buildLokiLabelsURL(conn.URL, 1, 2)
+	result, err := executeLokiLabelsQuery(context.Background(), labelsURL, "", "", "", "")
+	if err != nil {
+		t.Fatalf("Expected failover to succeed, but got %v", err)
+	}
+	if len(result.Data) != 1 || result.Data[0] != "job" {
+		t.Errorf("Unexpected result: %v", result.Data)
+	}
+
+	group := endpointGroupFor(down + "," + server.URL)
+	if group.activeURL() != server.URL {
+		t.Errorf("Expected %s to become active, but got %s", server.URL, group.activeURL())
+	}
+	statuses := group.snapshot()
+	if statuses[0].Healthy || statuses[0].Failures != 1 || !statuses[1].Healthy {
+		t.Errorf("Unexpected endpoint statuses: %+v", statuses)
+	}
+
+	// Later calls go straight to the healthy endpoint
+	if conn := ResolveLokiConnection(map[string]any{"url": down + "," + server.URL}); conn.URL != server.URL {
+		t.Errorf("Expected active endpoint %s, but got %s", server.URL, conn.URL)
+	}
+}
+
+// TestEndpointGroupFor_Unconfigured tests that failover lists sent by clients use their first
+// endpoint without creating a failover group
+func TestEndpointGroupFor_Unconfigured(t *testing.T) {
+	list := "http://loki-a:3100,http://loki-b:3100"
+	if group := endpointGroupFor(list); group != nil {
+		t.Fatalf("Expected no group for an unconfigured list, but got %v", group.urls())
+	}
+	if conn := ResolveLokiConnection(map[string]any{"url": list}); conn.URL != "http://loki-a:3100" || len(conn.Endpoints) != 0 {
+		t.Errorf("Expected the first endpoint without failover, but got %s %v", conn.URL, conn.Endpoints)
+	}
+	if group, _ := endpointGroupForRequest("http://loki-b:3100/loki/api/v1/labels"); group != nil {
+		t.Error("Expected no group for a request to an unconfigured endpoint")
+	}
+}
+
+// TestEndpointGroupForRequest tests finding the group of a request URL by its endpoint
+func TestEndpointGroupForRequest(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	setenv(t, EnvLokiURL, "http://gateway/loki-a,http://gateway/loki-b")
+	SetConfig(LoadConfig())
+	group := endpointGroupFor(CurrentConfig().LokiURL)
+
+	testCases := map[string]string{
+		"http://gateway/loki-b/loki/api/v1/query_range?query=x": "http://gateway/loki-b",
+		"http://gateway/loki-a?x=1":                             "http://gateway/loki-a",
+		"http://gateway/loki-ab/loki/api/v1/labels":             "",
+		"http://gateway/loki/api/v1/labels":                     "",
+	}
+	for requestURL, expected := range testCases {
+		found, base := endpointGroupForRequest(requestURL)
+		if base != expected || (expected != "" && found != group) {
+			t.Errorf("endpointGroupForRequest(%s) = %s, want %s", requestURL, base, expected)
+		}
+	}
+}
+
+// TestExecuteLokiRequest_NoFailoverOnHTTPError tests that error responses from Loki are returned as-is
+func TestExecuteLokiRequest_NoFailoverOnHTTPError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "parse error at line 1", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Backup endpoint should not be called")
+	}))
+	defer backup.Close()
+
+	conn := ResolveLokiConnection(map[string]any{"url": server.URL + "," + backup.URL})
+	labelsURL, _ := buildLokiLabelsURL(conn.URL, 1, 2)
+	if _, err := executeLokiLabelsQuery(context.Background(), labelsURL, "", "", "", ""); err == nil {
+		t.Fatal("Expected error from Loki")
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call to the primary endpoint, but got %d", calls)
+	}
+}
+
+// TestBuildLokiReadyURL tests that the readiness URL is built outside the API path
+func TestBuildLokiReadyURL(t *testing.T) {
+	testCases := map[string]string{
+		"http://loki:3100":                  "http://loki:3100/ready",
+		"http://gateway/loki-a/loki/api/v1": "http://gateway/loki-a/ready",
+		"https://loki.example.com/?x=1":     "https://loki.example.com/ready",
+	}
+	for base, expected := range testCases {
+		if readyURL, _ := buildLokiReadyURL(base); readyURL != expected {
+			t.Errorf("Expected %s, but got %s", expected, readyURL)
+		}
+	}
+}
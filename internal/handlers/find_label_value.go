@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// NewLokiFindLabelValueTool creates and returns a tool for finding label values by approximate spelling
+func NewLokiFindLabelValueTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Find the actual values of a label closest to an approximate value, matching case-insensitively, " +
+			"by substring, and by edit distance. Use it when the exact spelling of a pod, namespace or app is not known."),
+		mcp.WithString("label",
+			mcp.Required(),
+			mcp.Description("Label name to search, e.g. pod or namespace"),
+		),
+		mcp.WithString("value",
+			mcp.Required(),
+			mcp.Description("Approximate value to look for, e.g. payment"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the search (default: 24h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the search (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of matching values to return (default: 10)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_find_label_value", opts...)
+}
+
+// HandleLokiFindLabelValue handles Loki find label value tool requests
+func HandleLokiFindLabelValue(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	label, _ := params.Args["label"].(string)
+	if label == "" {
+		return nil, fmt.Errorf("label is required")
+	}
+	value, _ := params.Args["value"].(string)
+	if value == "" {
+		return nil, fmt.Errorf("value is required")
+	}
+
+	limit := 10
+	if limitVal, ok := params.Args["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	result, err := CurrentLokiClient().LabelValues(ctx, params.Conn, label, params.Start, params.End)
+	if err != nil {
+		return nil, fmt.Errorf("label values query execution failed: %w", err)
+	}
+
+	matches := rankSimilar(value, result.Data)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	formattedResult, err := formatLabelValueMatches(label, value, len(result.Data), matches, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	metadata := newResultMetadata(params)
+	metadata.EntryCount = len(matches)
+	return metadata.attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// formatLabelValueMatches formats the values matching an approximate label value into a readable string
+func formatLabelValueMatches(label, value string, searched int, matches []similarValue, format string) (string, error) {
+	if len(matches) == 0 {
+		message := fmt.Sprintf("No values of %s resemble %q (searched %d values)", label, value, searched)
+		switch format {
+		case "json":
+			jsonBytes, err := json.Marshal(map[string]string{"message": message})
+			if err != nil {
+				return "", fmt.Errorf("failed to marshal JSON: %v", err)
+			}
+			return string(jsonBytes), nil
+		case "raw", "text":
+			return message, nil
+		default:
+			return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+		}
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(map[string]any{
+			"label":    label,
+			"value":    value,
+			"searched": searched,
+			"matches":  matches,
+		}, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// One value per line with how it matched
+		var b strings.Builder
+		for _, m := range matches {
+			fmt.Fprintf(&b, "%s %s %d\n", m.Value, m.Match, m.Distance)
+		}
+		return b.String(), nil
+
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Values of %s closest to %q (%d of %d values match):\n\n", label, value, len(matches), searched)
+		for _, m := range matches {
+			fmt.Fprintf(&b, "  %s=%q (%s match", label, m.Value, m.Match)
+			if m.Match == "fuzzy" || m.Match == "substring" {
+				fmt.Fprintf(&b, ", distance %d", m.Distance)
+			}
+			b.WriteString(")\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
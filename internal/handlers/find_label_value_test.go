@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestRankSimilar tests ranking candidates by how closely they match
+func TestRankSimilar(t *testing.T) {
+	matches := rankSimilar("payment", []string{"checkout", "payment-api", "PAYMENT", "payment", "paymnet"})
+
+	expected := []similarValue{
+		{"payment", "exact", 0},
+		{"PAYMENT", "case", 0},
+		{"paymnet", "fuzzy", 2},
+		{"payment-api", "substring", 4},
+	}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected %d matches, but got %v", len(expected), matches)
+	}
+	for i, m := range matches {
+		if m != expected[i] {
+			t.Errorf("Expected match %d to be %v, but got %v", i, expected[i], m)
+		}
+	}
+}
+
+// TestHandleLokiFindLabelValue tests finding label values by approximate spelling
+func TestHandleLokiFindLabelValue(t *testing.T) {
+	fake := &emptyQueryLokiClient{values: map[string][]string{
+		"namespace": {"kube-system", "Payments-Prod", "payments-staging", "monitoring"},
+	}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"label": "namespace", "value": "payments", "format": "json"}
+	result, err := HandleLokiFindLabelValue(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var parsed struct {
+		Searched int            `json:"searched"`
+		Matches  []similarValue `json:"matches"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &parsed); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if parsed.Searched != 4 {
+		t.Errorf("Expected 4 values searched, but got %d", parsed.Searched)
+	}
+	if len(parsed.Matches) != 2 || parsed.Matches[0].Value != "Payments-Prod" {
+		t.Errorf("Expected Payments-Prod and payments-staging, but got %v", parsed.Matches)
+	}
+
+	request.Params.Arguments = map[string]any{"label": "namespace", "value": "zzz"}
+	result, err = HandleLokiFindLabelValue(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "No values of namespace") {
+		t.Errorf("Expected a no matches message, but got %s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"label": "namespace"}
+	if _, err := HandleLokiFindLabelValue(context.Background(), request); err == nil {
+		t.Error("Expected an error when value is missing")
+	}
+}
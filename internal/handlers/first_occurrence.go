@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// First occurrence search settings
+const (
+	// defaultFirstOccurrenceLookback is how far back the search starts when no start is given
+	defaultFirstOccurrenceLookback = 30 * 24 * time.Hour
+	// firstOccurrenceWindow is the window size at which the binary search stops and the
+	// oldest matching line is read with a forward query
+	firstOccurrenceWindow = 15 * time.Minute
+)
+
+// firstOccurrenceReport describes when lines matching a query first appeared
+type firstOccurrenceReport struct {
+	Query     string            `json:"query"`
+	Start     string            `json:"start"` // start of the searched range, after clamping to retention
+	End       string            `json:"end"`
+	Found     bool              `json:"found"`
+	Timestamp string            `json:"timestamp,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Line      string            `json:"line,omitempty"`
+	Probes    int               `json:"probes"` // queries sent to Loki
+}
+
+// NewLokiFirstOccurrenceTool creates and returns a tool for finding when lines matching a query first appeared
+func NewLokiFirstOccurrenceTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Find when lines matching a LogQL log query first appeared, e.g. when an error message started. " +
+			"Binary searches the time range with small queries instead of widening ranges iteratively, and returns the " +
+			"oldest matching line with its timestamp and labels, or that the query matched nothing."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL log query to search for, e.g. {app=\"api\"} |= \"connection refused\""),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start of the searched range (default: 30 days ago, or the start of retention if later)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End of the searched range (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_first_occurrence", opts...)
+}
+
+// HandleLokiFirstOccurrence handles Loki first occurrence tool requests
+func HandleLokiFirstOccurrence(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, defaultFirstOccurrenceLookback)
+	if err != nil {
+		return nil, err
+	}
+	query, _ := params.Args["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	query = applySessionSelector(ctx, query)
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return nil, fmt.Errorf("loki_first_occurrence requires a log query, not a metric query")
+	}
+
+	// Logs older than the retention period are gone, so there is no point searching them
+	start := params.Start
+	if retention, err := lookupRetention(ctx, params.Conn); err == nil && retention.Period > 0 {
+		if oldest := time.Now().Add(-retention.Period); start.Before(oldest) {
+			start = oldest
+		}
+	}
+	if !start.Before(params.End) {
+		return nil, fmt.Errorf("the time range ends before the start of retention")
+	}
+
+	report, err := findFirstOccurrence(ctx, params.Conn, query, start, params.End)
+	if err != nil {
+		return nil, err
+	}
+
+	formattedResult, err := formatFirstOccurrence(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return newResultMetadata(params).attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// findFirstOccurrence finds the oldest line matching a query in the time range. Whether any line
+// matches before a time only changes once, from no to yes, so the binary search checks the window
+// from the start up to the middle of the remaining range with a single-line query, until the range
+// is small enough to read its oldest line directly.
+func findFirstOccurrence(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (firstOccurrenceReport, error) {
+	report := firstOccurrenceReport{Query: query, Start: start.UTC().Format(time.RFC3339), End: end.UTC().Format(time.RFC3339)}
+	hasMatch := func(until time.Time) (bool, error) {
+		report.Probes++
+		result, err := runLokiQuery(ctx, conn, query, start, until, 1)
+		if err != nil {
+			return false, err
+		}
+		return len(sortedLogEntries(result)) > 0, nil
+	}
+
+	// The search keeps the first match after lo and at or before hi
+	lo, hi := start, end
+	if ok, err := hasMatch(hi); err != nil || !ok {
+		return report, err
+	}
+	for hi.Sub(lo) > firstOccurrenceWindow {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		ok, err := hasMatch(mid)
+		if err != nil {
+			return report, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	report.Probes++
+	result, err := runLokiQuery(withQueryDirection(ctx, DirectionForward), conn, query, lo, hi, 1)
+	if err != nil {
+		return report, err
+	}
+	entries := sortedLogEntries(result)
+	if len(entries) == 0 {
+		return report, fmt.Errorf("no line matched between %s and %s although an earlier query found one; the logs may have changed during the search",
+			lo.UTC().Format(time.RFC3339), hi.UTC().Format(time.RFC3339))
+	}
+	first := entries[0]
+	report.Found, report.Timestamp, report.Labels, report.Line = true, first.Timestamp, first.Labels, first.Line
+	return report, nil
+}
+
+// formatFirstOccurrence formats the first occurrence report into a readable string
+func formatFirstOccurrence(report firstOccurrenceReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		if !report.Found {
+			return fmt.Sprintf("No lines matching %s between %s and %s\n", report.Query, report.Start, report.End), nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "First line matching %s at %s (searched %s to %s in %d queries)\n",
+			report.Query, report.Timestamp, report.Start, report.End, report.Probes)
+		fmt.Fprintf(&b, "%s %s\n", formatStreamLabels(report.Labels), report.Line)
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timedLokiClient returns the lines logged at the given times within the queried window, honoring the limit and direction
+type timedLokiClient struct {
+	fakeLokiClient
+	times   []time.Time // in ascending order
+	queries int
+}
+
+func (f *timedLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	f.queries++
+	var values [][]string
+	for _, t := range f.times {
+		if !t.Before(start) && !t.After(end) {
+			values = append(values, []string{strconv.FormatInt(t.UnixNano(), 10), "error at " + t.UTC().Format(time.RFC3339)})
+		}
+	}
+	if QueryDirection(ctx) != DirectionForward {
+		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{{Stream: map[string]string{"app": "api"}, Values: values}}}}, nil
+}
+
+// TestFindFirstOccurrence tests binary searching for the oldest matching line
+func TestFindFirstOccurrence(t *testing.T) {
+	end := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	start := end.Add(-30 * 24 * time.Hour)
+	first := time.Date(2024, 1, 12, 7, 23, 45, 0, time.UTC)
+	fake := &timedLokiClient{times: []time.Time{first, first.Add(time.Hour), end.Add(-time.Minute)}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	report, err := findFirstOccurrence(context.Background(), LokiConnection{}, `{app="api"} |= "error"`, start, end)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !report.Found || report.Timestamp != "2024-01-12T07:23:45Z" || report.Labels["app"] != "api" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if report.Probes != fake.queries || report.Probes > 15 {
+		t.Errorf("Expected a logarithmic number of queries, but got %d", report.Probes)
+	}
+
+	text, err := formatFirstOccurrence(report, "text")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.HasPrefix(text, `First line matching {app="api"} |= "error" at 2024-01-12T07:23:45Z`) || !strings.Contains(text, `{app="api"} error at 2024-01-12T07:23:45Z`) {
+		t.Errorf("Unexpected text: %s", text)
+	}
+
+	// Nothing matching takes a single query
+	fake.times, fake.queries = nil, 0
+	report, err = findFirstOccurrence(context.Background(), LokiConnection{}, `{app="api"} |= "error"`, start, end)
+	if err != nil || report.Found || fake.queries != 1 {
+		t.Errorf("Expected no match after one query, but got %+v, %v", report, err)
+	}
+	if text, _ := formatFirstOccurrence(report, "raw"); !strings.HasPrefix(text, "No lines matching") {
+		t.Errorf("Unexpected text: %s", text)
+	}
+}
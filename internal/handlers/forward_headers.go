@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Environment variable name for the comma-separated request headers forwarded from MCP clients to
+// Loki, each as Header or Incoming:Outgoing, e.g. "Authorization" or "X-Loki-Token:Authorization"
+const EnvLokiForwardHeaders = "LOKI_FORWARD_HEADERS"
+
+// Environment variable name for rejecting HTTP tool calls that carry none of the forwarded
+// headers, instead of falling back to the configured credentials
+const EnvLokiForwardHeadersRequired = "LOKI_FORWARD_HEADERS_REQUIRED"
+
+// HeaderMapping forwards an incoming MCP request header to Loki under the same or another name
+type HeaderMapping struct {
+	From string
+	To   string
+}
+
+// forwardedHeadersKey is the context key for the headers forwarded from the MCP request
+type forwardedHeadersKey struct{}
+
+// parseHeaderMappings parses forwarded header mappings. The tenant header is never forwarded,
+// since tenants are chosen with the org parameter, which the query policy checks.
+func parseHeaderMappings(value string) []HeaderMapping {
+	var mappings []HeaderMapping
+	for _, item := range splitList(value) {
+		from, to, found := strings.Cut(item, ":")
+		if !found {
+			to = from
+		}
+		from, to = http.CanonicalHeaderKey(strings.TrimSpace(from)), http.CanonicalHeaderKey(strings.TrimSpace(to))
+		if from == "" || to == "" {
+			continue
+		}
+		mappings = append(mappings, HeaderMapping{From: from, To: to})
+	}
+	return mappings
+}
+
+// forwardHeaderProblems reports mappings that are ignored
+func forwardHeaderProblems(mappings []HeaderMapping) []string {
+	var problems []string
+	for _, m := range mappings {
+		if m.To == "X-Scope-Orgid" {
+			problems = append(problems, fmt.Sprintf("environment: %s cannot set X-Scope-OrgID; use the org parameter", EnvLokiForwardHeaders))
+		}
+	}
+	return problems
+}
+
+// ForwardHeadersContextFunc captures the configured headers of an HTTP transport request so Loki
+// requests made by the tool call use the client's own credentials
+func ForwardHeadersContextFunc(ctx context.Context, r *http.Request) context.Context {
+	mappings := CurrentConfig().ForwardHeaders
+	if len(mappings) == 0 {
+		return ctx
+	}
+	headers := http.Header{}
+	for _, m := range mappings {
+		if m.To == "X-Scope-Orgid" {
+			continue
+		}
+		if value := r.Header.Get(m.From); value != "" {
+			headers.Set(m.To, value)
+		}
+	}
+	return context.WithValue(ctx, forwardedHeadersKey{}, headers)
+}
+
+// applyForwardedHeaders sets the headers forwarded from the MCP request on a Loki request,
+// replacing the configured credentials. Calls over stdio have no forwarded headers.
+func applyForwardedHeaders(ctx context.Context, req *http.Request) error {
+	headers, ok := ctx.Value(forwardedHeadersKey{}).(http.Header)
+	if !ok {
+		return nil
+	}
+	if len(headers) == 0 && CurrentConfig().ForwardHeadersRequired {
+		var names []string
+		for _, m := range CurrentConfig().ForwardHeaders {
+			names = append(names, m.From)
+		}
+		return fmt.Errorf("missing credentials: send one of the %s headers", strings.Join(names, ", "))
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	return nil
+}
+
+// withoutClientCredentials removes the credentials taken from the MCP request from the context,
+// for requests that must use the server's own credentials
+func withoutClientCredentials(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, forwardedHeadersKey{}, nil)
+	return context.WithValue(ctx, oidcSubjectKey{}, nil)
+}
+
+// HTTPContextFunc prepares the context of tool calls received over the HTTP transports
+func HTTPContextFunc(ctx context.Context, r *http.Request) context.Context {
+	ctx = ResumeSessionContextFunc(ctx, r)
+	ctx = ForwardHeadersContextFunc(ctx, r)
+	ctx = ClientCredentialsContextFunc(ctx, r)
+	ctx = ClientAddressContextFunc(ctx, r)
+	return OIDCContextFunc(ctx, r)
+}
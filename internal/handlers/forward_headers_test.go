@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestParseHeaderMappings tests parsing forwarded header mappings
+func TestParseHeaderMappings(t *testing.T) {
+	mappings := parseHeaderMappings("authorization, X-Loki-Token : Authorization,,X-Scope-OrgID")
+	expected := []HeaderMapping{
+		{From: "Authorization", To: "Authorization"},
+		{From: "X-Loki-Token", To: "Authorization"},
+		{From: "X-Scope-Orgid", To: "X-Scope-Orgid"},
+	}
+	if len(mappings) != len(expected) {
+		t.Fatalf("Expected %v, but got %v", expected, mappings)
+	}
+	for i := range expected {
+		if mappings[i] != expected[i] {
+			t.Errorf("Expected %v, but got %v", expected[i], mappings[i])
+		}
+	}
+	if problems := forwardHeaderProblems(mappings); len(problems) != 1 {
+		t.Errorf("Expected the tenant header to be reported, but got %v", problems)
+	}
+}
+
+// TestForwardHeaders tests sending the MCP client's credentials to Loki instead of the configured ones
+func TestForwardHeaders(t *testing.T) {
+	var authorization, orgID string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization, orgID = r.Header.Get("Authorization"), r.Header.Get("X-Scope-OrgID")
+		w.Write([]byte(`{"status":"success","data":["app"]}`))
+	}))
+	t.Cleanup(loki.Close)
+	setenv(t, EnvLokiURL, loki.URL)
+	setenv(t, EnvLokiToken, "service-token")
+	setenv(t, EnvLokiOrgID, "tenant-a")
+	setenv(t, EnvLokiForwardHeaders, "X-Loki-Token:Authorization,X-Scope-OrgID")
+
+	incoming := httptest.NewRequest("POST", "/stream", nil)
+	incoming.Header.Set("X-Loki-Token", "Bearer user-token")
+	incoming.Header.Set("X-Scope-OrgID", "tenant-b")
+	ctx := HTTPContextFunc(context.Background(), incoming)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{}
+	if _, err := HandleLokiLabelNames(ctx, request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if authorization != "Bearer user-token" || orgID != "tenant-a" {
+		t.Errorf("Expected the forwarded token and the configured tenant, but got %q and %q", authorization, orgID)
+	}
+
+	// Calls without forwarded headers use the configured credentials unless they are required
+	ctx = HTTPContextFunc(context.Background(), httptest.NewRequest("POST", "/stream", nil))
+	if _, err := HandleLokiLabelNames(ctx, request); err != nil || authorization != "Bearer service-token" {
+		t.Errorf("Expected the service token, but got %q (%v)", authorization, err)
+	}
+	setenv(t, EnvLokiForwardHeadersRequired, "true")
+	if _, err := HandleLokiLabelNames(ctx, request); err == nil || !strings.Contains(err.Error(), "send one of the X-Loki-Token, X-Scope-Orgid headers") {
+		t.Errorf("Expected a missing credentials error, but got %v", err)
+	}
+
+	// Calls over stdio are not affected
+	if _, err := HandleLokiLabelNames(context.Background(), request); err != nil {
+		t.Errorf("Expected no error over stdio, but got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for enabling the annotation tool, which writes to Grafana
+const EnvGrafanaAnnotations = "GRAFANA_ANNOTATIONS"
+
+// annotationTag is added to every annotation created by the tool, so they can be found and cleaned up
+const annotationTag = "loki-mcp"
+
+// grafanaAnnotation is the body of a Grafana create annotation request
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`              // Unix milliseconds
+	TimeEnd      int64    `json:"timeEnd,omitempty"` // Unix milliseconds, for a region
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// annotationReport describes a created annotation
+type annotationReport struct {
+	ID           int64    `json:"id"`
+	DashboardUID string   `json:"dashboard_uid,omitempty"`
+	PanelID      int      `json:"panel_id,omitempty"`
+	Time         string   `json:"time"`
+	TimeEnd      string   `json:"time_end,omitempty"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// GrafanaAnnotationsEnabled reports whether the annotation tool should be registered
+func GrafanaAnnotationsEnabled() bool {
+	cfg := CurrentConfig()
+	return cfg.GrafanaURL != "" && cfg.GrafanaAnnotations
+}
+
+// NewLokiAnnotateTool creates and returns a tool for marking log findings on Grafana dashboards
+func NewLokiAnnotateTool() mcp.Tool {
+	return mcp.NewTool("loki_annotate",
+		mcp.WithDescription("Create a Grafana annotation marking a point or a time region found in the logs, such as an incident "+
+			"window, so the whole team sees it on their dashboards. Give time and time_end for a region. Annotations are tagged "+
+			annotationTag+"; only create them for findings the user asked to share."),
+		mcp.WithString("text",
+			mcp.Required(),
+			mcp.Description("Text of the annotation, e.g. \"Checkout 5xx spike: payment provider timeouts\""),
+		),
+		mcp.WithString("time",
+			mcp.Description("Time of the point, or start of the region: RFC3339, Unix timestamp, or relative such as -30m (default: now)"),
+		),
+		mcp.WithString("time_end",
+			mcp.Description("End of the region (default: a point annotation)"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Comma-separated tags, e.g. incident,checkout"),
+		),
+		mcp.WithString("dashboard_uid",
+			mcp.Description("UID of the dashboard to annotate (default: an organization annotation, shown on dashboards querying annotations by tag)"),
+		),
+		mcp.WithNumber("panel_id",
+			mcp.Description("ID of the panel of the dashboard to annotate (default: every panel of the dashboard)"),
+		),
+		mcp.WithString("query",
+			mcp.Description("LogQL query showing the finding, added to the text so others can look at the logs"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiAnnotate handles Loki annotate tool requests
+func HandleLokiAnnotate(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	annotation, err := parseAnnotation(args, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		ID int64 `json:"id"`
+	}
+	if _, err := grafanaRequest(ctx, http.MethodPost, "/api/annotations", annotation, &response); err != nil {
+		return nil, fmt.Errorf("failed to create annotation: %w", err)
+	}
+
+	report := annotationReport{
+		ID:           response.ID,
+		DashboardUID: annotation.DashboardUID,
+		PanelID:      annotation.PanelID,
+		Time:         time.UnixMilli(annotation.Time).UTC().Format(time.RFC3339),
+		Tags:         annotation.Tags,
+		Text:         annotation.Text,
+	}
+	if annotation.TimeEnd != 0 {
+		report.TimeEnd = time.UnixMilli(annotation.TimeEnd).UTC().Format(time.RFC3339)
+	}
+
+	formattedResult, err := formatAnnotationReport(report, formatArg(args))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// parseAnnotation builds the annotation described by the tool arguments
+func parseAnnotation(args map[string]any, now time.Time) (grafanaAnnotation, error) {
+	text, _ := args["text"].(string)
+	if strings.TrimSpace(text) == "" {
+		return grafanaAnnotation{}, fmt.Errorf("text is required")
+	}
+	if query, _ := args["query"].(string); query != "" {
+		text += "\n\nQuery: " + query
+	}
+
+	start := now
+	if s, _ := args["time"].(string); s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			return grafanaAnnotation{}, fmt.Errorf("invalid time: %v", err)
+		}
+		start = t
+	}
+	annotation := grafanaAnnotation{Time: start.UnixMilli(), Tags: []string{annotationTag}, Text: text}
+	if s, _ := args["time_end"].(string); s != "" {
+		end, err := parseTime(s)
+		if err != nil {
+			return grafanaAnnotation{}, fmt.Errorf("invalid time_end: %v", err)
+		}
+		if !end.After(start) {
+			return grafanaAnnotation{}, fmt.Errorf("time_end must be after time")
+		}
+		annotation.TimeEnd = end.UnixMilli()
+	}
+
+	if tags, _ := args["tags"].(string); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && tag != annotationTag {
+				annotation.Tags = append(annotation.Tags, tag)
+			}
+		}
+	}
+	annotation.DashboardUID, _ = args["dashboard_uid"].(string)
+	if panelID, ok := args["panel_id"].(float64); ok {
+		if annotation.DashboardUID == "" {
+			return grafanaAnnotation{}, fmt.Errorf("panel_id requires dashboard_uid")
+		}
+		annotation.PanelID = int(panelID)
+	}
+	return annotation, nil
+}
+
+// formatAnnotationReport formats the created annotation into a readable string
+func formatAnnotationReport(report annotationReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		return fmt.Sprintf("%d %s %s %s\n", report.ID, report.Time, report.TimeEnd, strings.Join(report.Tags, ",")), nil
+
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Created annotation %d", report.ID)
+		switch {
+		case report.PanelID != 0:
+			fmt.Fprintf(&b, " on panel %d of dashboard %s", report.PanelID, report.DashboardUID)
+		case report.DashboardUID != "":
+			fmt.Fprintf(&b, " on dashboard %s", report.DashboardUID)
+		default:
+			b.WriteString(" for the organization")
+		}
+		if report.TimeEnd != "" {
+			fmt.Fprintf(&b, ": region %s to %s", report.Time, report.TimeEnd)
+		} else {
+			fmt.Fprintf(&b, ": point at %s", report.Time)
+		}
+		fmt.Fprintf(&b, ", tags %s\n%s\n", strings.Join(report.Tags, ", "), report.Text)
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestHandleLokiAnnotate tests creating a region annotation on a dashboard panel
+func TestHandleLokiAnnotate(t *testing.T) {
+	var created grafanaAnnotation
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/annotations" || r.Header.Get("Authorization") != "Bearer grafana-token" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Errorf("Failed to decode annotation: %v", err)
+		}
+		w.Write([]byte(`{"message": "Annotation added", "id": 17}`))
+	}))
+	defer server.Close()
+	SetConfig(&Config{GrafanaURL: server.URL, GrafanaToken: "grafana-token", GrafanaAnnotations: true})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"text": "Checkout 5xx spike", "time": "2024-05-01T10:00:00Z", "time_end": "2024-05-01T10:20:00Z",
+		"tags": "incident, checkout", "dashboard_uid": "checkout", "panel_id": float64(2),
+		"query": `{app="checkout"} |= "status=5"`, "format": "text",
+	}
+	result, err := HandleLokiAnnotate(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if created.Time != start.UnixMilli() || created.TimeEnd != start.Add(20*time.Minute).UnixMilli() ||
+		created.DashboardUID != "checkout" || created.PanelID != 2 {
+		t.Errorf("Unexpected annotation: %+v", created)
+	}
+	if strings.Join(created.Tags, ",") != "loki-mcp,incident,checkout" || !strings.Contains(created.Text, `Query: {app="checkout"}`) {
+		t.Errorf("Unexpected tags or text: %v %q", created.Tags, created.Text)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if want := "Created annotation 17 on panel 2 of dashboard checkout: region 2024-05-01T10:00:00Z to 2024-05-01T10:20:00Z"; !strings.Contains(text, want) {
+		t.Errorf("Expected %q in:\n%s", want, text)
+	}
+}
+
+// TestParseAnnotation tests the defaults and checks of annotation arguments
+func TestParseAnnotation(t *testing.T) {
+	now := time.Now()
+	annotation, err := parseAnnotation(map[string]any{"text": "deploy"}, now)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if annotation.Time != now.UnixMilli() || annotation.TimeEnd != 0 || annotation.DashboardUID != "" {
+		t.Errorf("Expected an organization point annotation at now, but got %+v", annotation)
+	}
+
+	for name, args := range map[string]map[string]any{
+		"no text":            {"text": " "},
+		"end before start":   {"text": "x", "time": "2024-05-01T10:00:00Z", "time_end": "2024-05-01T09:00:00Z"},
+		"panel no dashboard": {"text": "x", "panel_id": float64(2)},
+		"invalid time":       {"text": "x", "time": "yesterday-ish"},
+	} {
+		if _, err := parseAnnotation(args, now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
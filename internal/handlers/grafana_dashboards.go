@@ -0,0 +1,597 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for the Grafana URL. The Grafana tools are only registered when it is set.
+const EnvGrafanaURL = "GRAFANA_URL"
+
+// Environment variable name for the Grafana service account token used by the Grafana tools
+const EnvGrafanaToken = "GRAFANA_TOKEN"
+
+// grafanaRequestTimeout bounds a Grafana API request
+const grafanaRequestTimeout = 15 * time.Second
+
+// grafanaVariablePattern matches the variable references of Grafana queries: $name, ${name},
+// ${name:format} and the deprecated [[name]]
+var grafanaVariablePattern = regexp.MustCompile(`\$(\w+)|\$\{(\w+)(?::(\w+))?\}|\[\[(\w+)(?::(\w+))?\]\]`)
+
+// grafanaDashboard is the part of a Grafana dashboard model holding the panel queries
+type grafanaDashboard struct {
+	UID        string         `json:"uid"`
+	Title      string         `json:"title"`
+	Panels     []grafanaPanel `json:"panels"`
+	Templating struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+}
+
+// grafanaPanel is a dashboard panel, or a collapsed row holding panels
+type grafanaPanel struct {
+	ID         int             `json:"id"`
+	Title      string          `json:"title"`
+	Type       string          `json:"type"`
+	Datasource json.RawMessage `json:"datasource"`
+	Targets    []grafanaTarget `json:"targets"`
+	Panels     []grafanaPanel  `json:"panels"`
+}
+
+// grafanaTarget is a query of a panel
+type grafanaTarget struct {
+	RefID      string          `json:"refId"`
+	Expr       string          `json:"expr"`
+	Datasource json.RawMessage `json:"datasource"`
+	Hide       bool            `json:"hide"`
+}
+
+// grafanaVariable is a template variable of a dashboard
+type grafanaVariable struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Query      json.RawMessage `json:"query"`
+	Multi      bool            `json:"multi"`
+	IncludeAll bool            `json:"includeAll"`
+	AllValue   string          `json:"allValue"`
+	Current    struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"current"`
+	Options []struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"options"`
+}
+
+// grafanaDatasourceRef is a reference to a datasource, by type and UID
+type grafanaDatasourceRef struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// dashboardQuery is a Loki query of a dashboard panel
+type dashboardQuery struct {
+	PanelID int    `json:"panel_id"`
+	Panel   string `json:"panel"`
+	Type    string `json:"type"`
+	RefID   string `json:"ref_id"`
+	Expr    string `json:"expr"`
+	Kind    string `json:"kind"` // log or metric
+	Hidden  bool   `json:"hidden,omitempty"`
+}
+
+// dashboardVariable is a dashboard variable with its current values
+type dashboardVariable struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// dashboardQueries lists the Loki queries of a dashboard
+type dashboardQueries struct {
+	UID       string              `json:"uid"`
+	Title     string              `json:"title"`
+	Variables []dashboardVariable `json:"variables"`
+	Queries   []dashboardQuery    `json:"queries"`
+}
+
+// GrafanaEnabled reports whether a Grafana URL is configured, so the dashboard tool should be registered
+func GrafanaEnabled() bool {
+	return CurrentConfig().GrafanaURL != ""
+}
+
+// NewLokiDashboardQueriesTool creates and returns a tool for listing and running the Loki panel queries of a Grafana dashboard
+func NewLokiDashboardQueriesTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("List the Loki queries of a Grafana dashboard's panels, or run the query of one panel with the " +
+			"dashboard's variables substituted, to answer questions such as \"what does the checkout errors panel show right now?\". " +
+			"Without panel, lists the panels, their queries and the current variable values."),
+		mcp.WithString("uid",
+			mcp.Required(),
+			mcp.Description("UID of the dashboard, as in its URL /d/<uid>/..."),
+		),
+		mcp.WithString("panel",
+			mcp.Description("Title or ID of the panel whose query to run (default: list the queries)"),
+		),
+		mcp.WithString("ref_id",
+			mcp.Description("Query of the panel to run, e.g. A, when the panel has several Loki queries"),
+		),
+		mcp.WithObject("variables",
+			mcp.Description("Variable values replacing the dashboard's current values, e.g. {\"env\": \"prod\", \"service\": [\"cart\", \"checkout\"]}"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return for log queries (default: 100)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+		chartOption(),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_dashboard_queries", opts...)
+}
+
+// HandleLokiDashboardQueries handles Loki dashboard queries tool requests
+func HandleLokiDashboardQueries(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	uid, _ := args["uid"].(string)
+	if uid == "" {
+		return nil, fmt.Errorf("uid is required")
+	}
+	overrides, ok := args["variables"].(map[string]any)
+	if !ok && args["variables"] != nil {
+		return nil, fmt.Errorf("variables must be an object of variable values by name")
+	}
+
+	dashboard, err := fetchGrafanaDashboard(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	queries := dashboard.lokiQueries()
+	variables, err := dashboard.variableValues(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	panel, _ := args["panel"].(string)
+	if panel == "" {
+		report := dashboardQueries{UID: uid, Title: dashboard.Title, Variables: variables, Queries: queries}
+		formattedResult, err := formatDashboardQueries(report, formatArg(args))
+		if err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+		return mcp.NewToolResultText(formattedResult), nil
+	}
+
+	refID, _ := args["ref_id"].(string)
+	query, err := selectDashboardQuery(queries, panel, refID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := parseTimeRange(args, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	step := reportStep(end.Sub(start))
+	expr := interpolateGrafanaQuery(query.Expr, dashboard.Templating.List, variables, end.Sub(start), step)
+	note := fmt.Sprintf("Panel %q (%d) query %s of dashboard %q: %s", query.Panel, query.PanelID, query.RefID, dashboard.Title, expr)
+
+	var result *mcp.CallToolResult
+	if query.Kind == "log" {
+		queryArgs := make(map[string]any, len(args))
+		for k, v := range request.GetArguments() {
+			switch k {
+			case "uid", "panel", "ref_id", "variables", "chart":
+			default:
+				queryArgs[k] = v
+			}
+		}
+		queryArgs["query"] = expr
+		request.Params.Arguments = queryArgs
+		if result, err = HandleLokiQuery(ctx, request); err != nil {
+			return nil, err
+		}
+	} else {
+		conn := ResolveLokiConnection(args)
+		metrics, err := runLokiMetricQuery(ctx, conn, expr, start, end, step)
+		if err != nil {
+			return nil, err
+		}
+		report := unwrapReport{Query: expr, Series: []unwrapSeries{}}
+		for _, series := range metrics.Data.Result {
+			s := unwrapSeries{Labels: formatStreamLabels(series.Metric)}
+			for _, sample := range series.samples() {
+				s.Values = append(s.Values, unwrapSample{Time: sample.Time.UTC().Format(time.RFC3339), Value: sample.Value})
+			}
+			report.Series = append(report.Series, s)
+		}
+		formattedResult, err := formatUnwrapReport(report, formatArg(args))
+		if err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+		result = mcp.NewToolResultText(formattedResult)
+		if chart, _ := args["chart"].(bool); chart {
+			if result, err = attachChart(result, metricChartSeries(metrics)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result.Content = append(result.Content, mcp.NewTextContent(note))
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["dashboard_panel"] = map[string]any{
+		"dashboard": uid, "panel": query.Panel, "panel_id": query.PanelID, "ref_id": query.RefID, "query": expr,
+	}
+	return result, nil
+}
+
+// fetchGrafanaDashboard reads a dashboard by UID from the Grafana API
+func fetchGrafanaDashboard(ctx context.Context, uid string) (*grafanaDashboard, error) {
+	var response struct {
+		Dashboard grafanaDashboard `json:"dashboard"`
+	}
+	status, err := grafanaRequest(ctx, http.MethodGet, "/api/dashboards/uid/"+url.PathEscape(uid), nil, &response)
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("dashboard %s not found", uid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &response.Dashboard, nil
+}
+
+// grafanaRequest sends a request with a JSON body, if any, to a Grafana API path and decodes the
+// response into v, returning the response status
+func grafanaRequest(ctx context.Context, method, path string, body, v any) (int, error) {
+	cfg := CurrentConfig()
+	if cfg.GrafanaURL == "" {
+		return 0, fmt.Errorf("the Grafana tools require %s to be set", EnvGrafanaURL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, grafanaRequestTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal Grafana request: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(cfg.GrafanaURL, "/")+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if cfg.GrafanaToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.GrafanaToken)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("grafana request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("grafana API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to parse Grafana response: %v", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// lokiQueries lists the queries of the dashboard's panels that use a Loki datasource, including
+// the panels of collapsed rows
+func (d *grafanaDashboard) lokiQueries() []dashboardQuery {
+	var queries []dashboardQuery
+	var walk func(panels []grafanaPanel)
+	walk = func(panels []grafanaPanel) {
+		for _, panel := range panels {
+			for _, target := range panel.Targets {
+				datasource := target.Datasource
+				if len(datasource) == 0 || string(datasource) == "null" {
+					datasource = panel.Datasource
+				}
+				if strings.TrimSpace(target.Expr) == "" || !d.isLokiDatasource(datasource) {
+					continue
+				}
+				kind := "metric"
+				if strings.HasPrefix(strings.TrimSpace(target.Expr), "{") {
+					kind = "log"
+				}
+				queries = append(queries, dashboardQuery{PanelID: panel.ID, Panel: panel.Title, Type: panel.Type,
+					RefID: target.RefID, Expr: target.Expr, Kind: kind, Hidden: target.Hide})
+			}
+			walk(panel.Panels)
+		}
+	}
+	walk(d.Panels)
+	return queries
+}
+
+// isLokiDatasource reports whether a datasource reference is a Loki datasource, directly or
+// through a datasource variable of type loki
+func (d *grafanaDashboard) isLokiDatasource(raw json.RawMessage) bool {
+	var ref grafanaDatasourceRef
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		// Dashboards from before Grafana 8 reference datasources by name
+		if err := json.Unmarshal(raw, &ref.UID); err != nil {
+			return false
+		}
+	}
+	if ref.Type == "loki" {
+		return true
+	}
+	name := grafanaVariablePattern.FindStringSubmatch(ref.UID)
+	if name == nil {
+		return false
+	}
+	for _, v := range d.Templating.List {
+		if v.Type == "datasource" && v.Name == name[1]+name[2]+name[4] {
+			var query string
+			json.Unmarshal(v.Query, &query)
+			return query == "loki"
+		}
+	}
+	return false
+}
+
+// variableValues returns the current values of the dashboard's variables, replaced by the
+// given overrides, in the order of the dashboard
+func (d *grafanaDashboard) variableValues(overrides map[string]any) ([]dashboardVariable, error) {
+	known := make(map[string]bool)
+	var variables []dashboardVariable
+	for _, v := range d.Templating.List {
+		if v.Type == "datasource" || v.Type == "adhoc" {
+			continue
+		}
+		known[v.Name] = true
+		values := grafanaValues(v.Current.Value)
+		if override, ok := overrides[v.Name]; ok {
+			parsed, err := parseVariableOverride(v.Name, override)
+			if err != nil {
+				return nil, err
+			}
+			values = parsed
+		}
+		variables = append(variables, dashboardVariable{Name: v.Name, Values: values})
+	}
+	for name := range overrides {
+		if !known[name] {
+			names := make([]string, 0, len(known))
+			for n := range known {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown dashboard variable: %s. Variables: %s", name, strings.Join(names, ", "))
+		}
+	}
+	return variables, nil
+}
+
+// parseVariableOverride parses a variable value given as a string or a list of strings
+func parseVariableOverride(name string, value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("variable %s must be a string or a list of strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("variable %s must be a string or a list of strings", name)
+	}
+}
+
+// grafanaValues decodes a variable value, which is a string or a list of strings
+func grafanaValues(raw json.RawMessage) []string {
+	var values []string
+	if err := json.Unmarshal(raw, &values); err == nil {
+		return values
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return []string{value}
+	}
+	return nil
+}
+
+// selectDashboardQuery finds the query of a panel, given by title or ID, and ref ID
+func selectDashboardQuery(queries []dashboardQuery, panel, refID string) (dashboardQuery, error) {
+	id, idErr := strconv.Atoi(panel)
+	var matches []dashboardQuery
+	titles := make(map[string]bool)
+	for _, q := range queries {
+		titles[q.Panel] = true
+		if (idErr == nil && q.PanelID == id) || strings.EqualFold(q.Panel, panel) {
+			matches = append(matches, q)
+		}
+	}
+	if len(matches) == 0 {
+		names := make([]string, 0, len(titles))
+		for title := range titles {
+			names = append(names, strconv.Quote(title))
+		}
+		sort.Strings(names)
+		return dashboardQuery{}, fmt.Errorf("no panel %q with a Loki query. Panels with Loki queries: %s", panel, strings.Join(names, ", "))
+	}
+
+	var visible []dashboardQuery
+	var refIDs []string
+	for _, q := range matches {
+		if refID != "" && q.RefID == refID {
+			return q, nil
+		}
+		refIDs = append(refIDs, q.RefID)
+		if !q.Hidden {
+			visible = append(visible, q)
+		}
+	}
+	if refID != "" {
+		return dashboardQuery{}, fmt.Errorf("panel %q has no Loki query %s. Queries: %s", panel, refID, strings.Join(refIDs, ", "))
+	}
+	if len(visible) != 1 {
+		return dashboardQuery{}, fmt.Errorf("panel %q has %d Loki queries (%s); choose one with ref_id", panel, len(matches), strings.Join(refIDs, ", "))
+	}
+	return visible[0], nil
+}
+
+// interpolateGrafanaQuery substitutes the dashboard variables and Grafana's interval and range
+// variables into a query. Values of multi-value and include-all variables are escaped and joined
+// into a regular expression, as the Grafana Loki datasource does. Unknown variables are left as they are.
+func interpolateGrafanaQuery(expr string, defs []grafanaVariable, variables []dashboardVariable, window, step time.Duration) string {
+	byName := make(map[string]grafanaVariable, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+	values := make(map[string][]string, len(variables))
+	for _, v := range variables {
+		values[v.Name] = v.Values
+	}
+	builtins := map[string]string{
+		"__interval":      formatLogQLDuration(step),
+		"__auto":          formatLogQLDuration(step),
+		"__rate_interval": formatLogQLDuration(4 * step),
+		"__interval_ms":   strconv.FormatInt(step.Milliseconds(), 10),
+		"__range":         formatLogQLDuration(window),
+		"__range_s":       strconv.FormatInt(int64(window.Seconds()), 10),
+		"__range_ms":      strconv.FormatInt(window.Milliseconds(), 10),
+	}
+
+	return grafanaVariablePattern.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := grafanaVariablePattern.FindStringSubmatch(ref)
+		name, format := m[1]+m[2]+m[4], m[3]+m[5]
+		if value, ok := builtins[name]; ok {
+			return value
+		}
+		current, ok := values[name]
+		if !ok {
+			return ref
+		}
+		def := byName[name]
+		if len(current) == 1 && current[0] == "$__all" {
+			if def.AllValue != "" {
+				return def.AllValue
+			}
+			current = nil
+			for _, option := range def.Options {
+				for _, value := range grafanaValues(option.Value) {
+					if value != "$__all" {
+						current = append(current, value)
+					}
+				}
+			}
+		}
+		return formatGrafanaValues(current, format, def.Multi || def.IncludeAll)
+	})
+}
+
+// formatGrafanaValues renders the values of a variable in a query, with an explicit format such
+// as ${name:csv} or as a regular expression for multi-value variables
+func formatGrafanaValues(values []string, format string, multi bool) string {
+	switch format {
+	case "raw", "csv":
+		return strings.Join(values, ",")
+	case "pipe":
+		return strings.Join(values, "|")
+	case "regex":
+		multi = true
+	}
+	if !multi {
+		return strings.Join(values, ",")
+	}
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		// Doubled backslashes, as the expression sits in a LogQL double-quoted string
+		escaped[i] = strings.ReplaceAll(regexp.QuoteMeta(value), `\`, `\\`)
+	}
+	if len(escaped) == 1 {
+		return escaped[0]
+	}
+	return "(" + strings.Join(escaped, "|") + ")"
+}
+
+// formatDashboardQueries formats the Loki queries of a dashboard into a readable string
+func formatDashboardQueries(report dashboardQueries, format string) (string, error) {
+	switch format {
+	case "json":
+		if report.Queries == nil {
+			report.Queries = []dashboardQuery{}
+		}
+		if report.Variables == nil {
+			report.Variables = []dashboardVariable{}
+		}
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, q := range report.Queries {
+			fmt.Fprintf(&b, "%d %s %s %s\n", q.PanelID, strconv.Quote(q.Panel), q.RefID, q.Expr)
+		}
+		return b.String(), nil
+
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Dashboard %q (%s): %d Loki queries\n", report.Title, report.UID, len(report.Queries))
+		if len(report.Variables) > 0 {
+			parts := make([]string, len(report.Variables))
+			for i, v := range report.Variables {
+				parts[i] = v.Name + "=" + strings.Join(v.Values, ",")
+			}
+			fmt.Fprintf(&b, "Variables: %s\n", strings.Join(parts, " "))
+		}
+		for _, q := range report.Queries {
+			fmt.Fprintf(&b, "  Panel %d %q (%s) %s, %s query", q.PanelID, q.Panel, q.Type, q.RefID, q.Kind)
+			if q.Hidden {
+				b.WriteString(", hidden")
+			}
+			fmt.Fprintf(&b, ": %s\n", q.Expr)
+		}
+		if len(report.Queries) > 0 {
+			b.WriteString("Run a panel's query with the panel parameter, e.g. panel=\"" + report.Queries[0].Panel + "\"\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
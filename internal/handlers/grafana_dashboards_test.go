@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// testDashboard has a Loki metric panel, a Loki logs panel in a collapsed row using a datasource
+// variable, and a Prometheus panel
+const testDashboard = `{"dashboard": {
+	"uid": "checkout", "title": "Checkout",
+	"templating": {"list": [
+		{"name": "ds", "type": "datasource", "query": "loki"},
+		{"name": "env", "type": "custom", "current": {"value": "prod"}},
+		{"name": "service", "type": "query", "multi": true, "includeAll": true, "current": {"value": ["cart", "checkout"]},
+			"options": [{"value": "$__all"}, {"value": "cart"}, {"value": "checkout"}, {"value": "pay.v2"}]}
+	]},
+	"panels": [
+		{"id": 2, "title": "Checkout errors", "type": "timeseries", "datasource": {"type": "loki", "uid": "P8E80F9AEF21F6940"},
+			"targets": [{"refId": "A", "expr": "sum(count_over_time({env=\"$env\", app=~\"$service\"} |= \"error\" [$__interval]))"}]},
+		{"id": 3, "title": "Logs", "type": "row", "collapsed": true, "panels": [
+			{"id": 4, "title": "Checkout logs", "type": "logs", "datasource": {"uid": "${ds}"},
+				"targets": [{"refId": "A", "expr": "{env=\"$env\", app=~\"$service\"}"}]}
+		]},
+		{"id": 5, "title": "CPU", "type": "timeseries", "datasource": {"type": "prometheus", "uid": "prom"},
+			"targets": [{"refId": "A", "expr": "rate(process_cpu_seconds_total[5m])"}]}
+	]
+}}`
+
+// metricQueryLokiClient records metric queries and returns a single series
+type metricQueryLokiClient struct {
+	fakeLokiClient
+	queries []string
+}
+
+func (f *metricQueryLokiClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	f.queries = append(f.queries, query)
+	return &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "matrix", Result: []LokiMetricSeries{
+		{Metric: map[string]string{}, Values: [][]any{{float64(end.Unix()), "42"}}},
+	}}}, nil
+}
+
+// setTestGrafana serves testDashboard from a fake Grafana API
+func setTestGrafana(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer grafana-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/dashboards/uid/checkout" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDashboard))
+	}))
+	t.Cleanup(server.Close)
+	SetConfig(&Config{LokiURL: DefaultLokiURL, GrafanaURL: server.URL + "/", GrafanaToken: "grafana-token"})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+}
+
+// TestHandleLokiDashboardQueries_List tests listing the Loki queries of a dashboard
+func TestHandleLokiDashboardQueries_List(t *testing.T) {
+	setTestGrafana(t)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"uid": "checkout", "format": "text"}
+	result, err := HandleLokiDashboardQueries(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{
+		`Dashboard "Checkout" (checkout): 2 Loki queries`,
+		"Variables: env=prod service=cart,checkout",
+		`Panel 2 "Checkout errors" (timeseries) A, metric query: sum(count_over_time(`,
+		`Panel 4 "Checkout logs" (logs) A, log query: {env="$env", app=~"$service"}`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "process_cpu_seconds_total") {
+		t.Errorf("Expected the Prometheus panel to be left out, but got:\n%s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"uid": "missing"}
+	if _, err := HandleLokiDashboardQueries(context.Background(), request); err == nil || !strings.Contains(err.Error(), "dashboard missing not found") {
+		t.Errorf("Expected a not found error, but got %v", err)
+	}
+}
+
+// TestHandleLokiDashboardQueries_Run tests running the query of a log panel and a metric panel
+func TestHandleLokiDashboardQueries_Run(t *testing.T) {
+	setTestGrafana(t)
+	query := `{env="staging", app=~"(cart|checkout)"}`
+	SetLokiClient(&cannedQueryLokiClient{lines: map[string][]string{query: {"order 17 placed"}}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"uid": "checkout", "panel": "checkout logs", "variables": map[string]any{"env": "staging"}}
+	result, err := HandleLokiDashboardQueries(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "order 17 placed") {
+		t.Errorf("Expected the panel's log lines, but got:\n%s", text)
+	}
+	note := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+	if !strings.Contains(note, `Panel "Checkout logs" (4) query A of dashboard "Checkout": `+query) {
+		t.Errorf("Unexpected note: %s", note)
+	}
+
+	metrics := &metricQueryLokiClient{}
+	SetLokiClient(metrics)
+	request.Params.Arguments = map[string]any{"uid": "checkout", "panel": "2", "format": "text"}
+	if result, err = HandleLokiDashboardQueries(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	want := `sum(count_over_time({env="prod", app=~"(cart|checkout)"} |= "error" [` + formatLogQLDuration(reportStep(time.Hour)) + `]))`
+	if len(metrics.queries) != 1 || metrics.queries[0] != want {
+		t.Errorf("Expected metric query %s, but got %v", want, metrics.queries)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "42") {
+		t.Errorf("Expected the series values, but got:\n%s", text)
+	}
+
+	for args, want := range map[string]map[string]any{
+		"no panel":         {"uid": "checkout", "panel": "CPU"},
+		"unknown variable": {"uid": "checkout", "panel": "2", "variables": map[string]any{"region": "eu"}},
+		"unknown ref_id":   {"uid": "checkout", "panel": "2", "ref_id": "B"},
+	} {
+		request.Params.Arguments = want
+		if _, err := HandleLokiDashboardQueries(context.Background(), request); err == nil {
+			t.Errorf("%s: expected an error", args)
+		}
+	}
+}
+
+// TestInterpolateGrafanaQuery tests substituting all values, formats and interval variables
+func TestInterpolateGrafanaQuery(t *testing.T) {
+	var defs []grafanaVariable
+	if err := json.Unmarshal([]byte(`[{"name": "service", "multi": true, "includeAll": true,
+		"options": [{"value": "$__all"}, {"value": "cart"}, {"value": "pay.v2"}]}, {"name": "host"}]`), &defs); err != nil {
+		t.Fatal(err)
+	}
+	variables := []dashboardVariable{{Name: "service", Values: []string{"$__all"}}, {Name: "host", Values: []string{"web-1"}}}
+
+	got := interpolateGrafanaQuery(`{app=~"$service", host="${host}", list="${service:csv}"} [$__range] $unknown`, defs, variables, 6*time.Hour, time.Minute)
+	want := `{app=~"(cart|pay\\.v2)", host="web-1", list="cart,pay.v2"} [6h] $unknown`
+	if got != want {
+		t.Errorf("Expected %s, but got %s", want, got)
+	}
+}
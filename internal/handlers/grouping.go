@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// streamGroup counts the log lines and streams sharing a value of the group_by label
+type streamGroup struct {
+	Value   string `json:"value"`
+	Lines   int    `json:"lines"`
+	Streams int    `json:"streams"`
+}
+
+// groupOptions controls how the streams of a result are organized
+type groupOptions struct {
+	Label    string // label whose values the streams are grouped by, empty for none
+	Collapse bool   // merge the streams of each group, or all streams, into one
+}
+
+// groupByOption returns the tool option for organizing results by a label
+func groupByOption() mcp.ToolOption {
+	return mcp.WithString("group_by",
+		mcp.Description("Organize results by this label rather than by stream, e.g. app to put all pods of a deployment "+
+			"together, busiest group first, with the number of lines and streams per group"),
+	)
+}
+
+// collapseStreamsOption returns the tool option for merging streams
+func collapseStreamsOption() mcp.ToolOption {
+	return mcp.WithBoolean("collapse_streams",
+		mcp.Description("Merge the streams of each group_by group, or all streams without group_by, into one stream "+
+			"in time order, keeping only the labels they share (default: false)"),
+	)
+}
+
+// parseGroupOptions extracts the grouping options from tool arguments
+func parseGroupOptions(args map[string]any) (groupOptions, error) {
+	var opts groupOptions
+	opts.Label, _ = args["group_by"].(string)
+	opts.Collapse, _ = args["collapse_streams"].(bool)
+	if opts.Label != "" && !labelNamePattern.MatchString(opts.Label) {
+		return opts, fmt.Errorf("invalid group_by label name: %s", opts.Label)
+	}
+	return opts, nil
+}
+
+// enabled reports whether grouping or collapsing was requested
+func (o groupOptions) enabled() bool {
+	return o.Label != "" || o.Collapse
+}
+
+// apply reorders the streams of a result in place so that streams sharing a value of the group_by
+// label are adjacent, busiest group first, merging each group's streams when collapsing. Without
+// group_by, all streams form one group. It returns the groups in output order.
+func (o groupOptions) apply(result *LokiResult) []streamGroup {
+	type group struct {
+		streamGroup
+		entries []LokiEntry
+	}
+	var groups []*group
+	byValue := make(map[string]*group)
+	for _, entry := range result.Data.Result {
+		value := ""
+		if o.Label != "" {
+			value = entry.Stream[o.Label]
+		}
+		g, ok := byValue[value]
+		if !ok {
+			g = &group{streamGroup: streamGroup{Value: value}}
+			byValue[value] = g
+			groups = append(groups, g)
+		}
+		g.entries = append(g.entries, entry)
+		g.Lines += len(entry.Values)
+		g.Streams++
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Lines != groups[j].Lines {
+			return groups[i].Lines > groups[j].Lines
+		}
+		return groups[i].Value < groups[j].Value
+	})
+
+	streams := make([]LokiEntry, 0, len(result.Data.Result))
+	summary := make([]streamGroup, 0, len(groups))
+	for _, g := range groups {
+		summary = append(summary, g.streamGroup)
+		if !o.Collapse {
+			sort.SliceStable(g.entries, func(i, j int) bool {
+				return formatStreamLabels(g.entries[i].Stream) < formatStreamLabels(g.entries[j].Stream)
+			})
+			streams = append(streams, g.entries...)
+			continue
+		}
+		streams = append(streams, collapseEntries(g.entries))
+	}
+	result.Data.Result = streams
+	return summary
+}
+
+// collapseEntries merges streams into one with the labels they all share and their entries in time order
+func collapseEntries(entries []LokiEntry) LokiEntry {
+	merged := LokiEntry{Stream: make(map[string]string)}
+	for name, value := range entries[0].Stream {
+		merged.Stream[name] = value
+	}
+	for _, entry := range entries {
+		for name, value := range merged.Stream {
+			if entry.Stream[name] != value {
+				delete(merged.Stream, name)
+			}
+		}
+		for _, val := range entry.Values {
+			if len(val) >= 2 {
+				merged.Values = append(merged.Values, val)
+			}
+		}
+	}
+	sort.SliceStable(merged.Values, func(i, j int) bool {
+		return compactNanos(merged.Values[i][0]) < compactNanos(merged.Values[j][0])
+	})
+	return merged
+}
+
+// describeGroups summarizes the line and stream counts of each group for the tool result
+func describeGroups(label string, groups []streamGroup) string {
+	if label == "" {
+		lines, streams := 0, 0
+		for _, g := range groups {
+			lines += g.Lines
+			streams += g.Streams
+		}
+		return fmt.Sprintf("Collapsed %d streams with %d lines into one", streams, lines)
+	}
+	parts := make([]string, 0, len(groups))
+	for _, g := range groups {
+		value := g.Value
+		if value == "" {
+			value = fmt.Sprintf("(no %s)", label)
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d lines in %d streams", value, g.Lines, g.Streams))
+	}
+	return fmt.Sprintf("Groups by %s:\n  %s", label, strings.Join(parts, "\n  "))
+}
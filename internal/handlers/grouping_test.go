@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// groupingTestResult returns streams of two apps, api with two pods and web with one
+func groupingTestResult() *LokiResult {
+	result := &LokiResult{}
+	result.Data.Result = []LokiEntry{
+		{Stream: map[string]string{"app": "web", "pod": "web-1"}, Values: [][]string{{"3000000000", "web 3"}}},
+		{Stream: map[string]string{"app": "api", "pod": "api-2"}, Values: [][]string{{"4000000000", "api 4"}, {"1000000000", "api 1"}}},
+		{Stream: map[string]string{"app": "api", "pod": "api-1"}, Values: [][]string{{"2000000000", "api 2"}}},
+		{Stream: map[string]string{"pod": "batch"}, Values: [][]string{{"5000000000", "batch 5"}}},
+	}
+	return result
+}
+
+// TestGroupOptions_Apply tests ordering streams by group and collapsing them
+func TestGroupOptions_Apply(t *testing.T) {
+	result := groupingTestResult()
+	groups := groupOptions{Label: "app"}.apply(result)
+	var order []string
+	for _, stream := range result.Data.Result {
+		order = append(order, stream.Stream["pod"])
+	}
+	if got := strings.Join(order, ","); got != "api-1,api-2,batch,web-1" {
+		t.Errorf("Expected streams grouped busiest first, but got %s", got)
+	}
+	if len(groups) != 3 || groups[0] != (streamGroup{Value: "api", Lines: 3, Streams: 2}) || groups[1].Value != "" {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+	if got := describeGroups("app", groups); !strings.Contains(got, "api: 3 lines in 2 streams\n  (no app): 1 lines in 1 streams") {
+		t.Errorf("Unexpected description: %s", got)
+	}
+
+	result = groupingTestResult()
+	groupOptions{Label: "app", Collapse: true}.apply(result)
+	api := result.Data.Result[0]
+	if len(result.Data.Result) != 3 || len(api.Stream) != 1 || api.Stream["app"] != "api" {
+		t.Fatalf("Expected one stream per app labeled only with the app, but got %+v", result.Data.Result)
+	}
+	if api.Values[0][1] != "api 1" || api.Values[2][1] != "api 4" {
+		t.Errorf("Expected merged entries in time order, but got %v", api.Values)
+	}
+
+	result = groupingTestResult()
+	groups = groupOptions{Collapse: true}.apply(result)
+	if len(result.Data.Result) != 1 || len(result.Data.Result[0].Values) != 5 || len(result.Data.Result[0].Stream) != 0 {
+		t.Errorf("Expected all streams collapsed into one without labels, but got %+v", result.Data.Result)
+	}
+	if got := describeGroups("", groups); got != "Collapsed 4 streams with 5 lines into one" {
+		t.Errorf("Unexpected description: %s", got)
+	}
+}
+
+// TestHandleLokiQuery_GroupBy tests the group counts returned with grouped results
+func TestHandleLokiQuery_GroupBy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"web","pod":"web-1"},"values":[["3000000000","web 3"]]},
+			{"stream":{"app":"api","pod":"api-1"},"values":[["2000000000","api 2"]]},
+			{"stream":{"app":"api","pod":"api-2"},"values":[["1000000000","api 1"]]}]}}`))
+	}))
+	defer server.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app=~".+"}`, "url": server.URL, "group_by": "app", "collapse_streams": true}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.HasPrefix(text, "1970-01-01T00:00:01Z {app=api} api 1\n") {
+		t.Errorf("Expected the api group first in time order, but got:\n%s", text)
+	}
+	if note := result.Content[1].(mcp.TextContent).Text; !strings.Contains(note, "api: 2 lines in 2 streams") {
+		t.Errorf("Unexpected group note: %s", note)
+	}
+	if groups, ok := result.Meta["groups"].([]streamGroup); !ok || len(groups) != 2 {
+		t.Errorf("Unexpected groups metadata: %v", result.Meta["groups"])
+	}
+
+	request.Params.Arguments = map[string]any{"query": `{app=~".+"}`, "group_by": "app-name"}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "invalid group_by label name") {
+		t.Errorf("Expected an invalid label error, but got %v", err)
+	}
+}
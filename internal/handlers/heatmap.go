@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Shades used for heatmap cells in the text grid, from no lines to the busiest cell
+var heatmapShades = []rune{' ', '░', '▒', '▓', '█'}
+
+// Heatmap image cell size limits in pixels
+const (
+	heatmapCellHeight = 20
+	heatmapMaxWidth   = 800
+)
+
+// heatmapRow holds the line counts per time bucket for one label value
+type heatmapRow struct {
+	Value  string    `json:"value"`
+	Total  float64   `json:"total"`
+	Counts []float64 `json:"counts"`
+}
+
+// heatmapReport is a time by label value matrix of log line counts
+type heatmapReport struct {
+	Selector string       `json:"selector"`
+	Label    string       `json:"label"`
+	Step     string       `json:"step"`
+	Buckets  []string     `json:"buckets"` // bucket timestamps
+	Rows     []heatmapRow `json:"rows"`
+	Max      float64      `json:"max"` // largest count of any cell
+}
+
+// NewLokiVolumeHeatmapTool creates and returns a tool for showing log volume by label value and time bucket
+func NewLokiVolumeHeatmapTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Show log volume as a heatmap of time buckets by label value, making it easy to see which " +
+			"component got noisy when during an incident window. Returns a text grid, optionally with a PNG image."),
+		mcp.WithString("selector",
+			mcp.Required(),
+			mcp.Description("Stream selector, optionally with filters, e.g. {namespace=\"prod\"} |= \"error\""),
+		),
+		mcp.WithString("label",
+			mcp.Required(),
+			mcp.Description("Label whose values form the rows, e.g. app or pod"),
+		),
+		mcp.WithString("step",
+			mcp.Description("Bucket size, e.g. 1m or 5m (default: 5m)"),
+		),
+		mcp.WithNumber("top",
+			mcp.Description("Number of busiest label values to show; the rest are combined into (other) (default: 10)"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the heatmap (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the heatmap (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+		mcp.WithBoolean("chart",
+			mcp.Description("Also return the heatmap as a PNG image, for clients that display images (default: false)"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_volume_heatmap", opts...)
+}
+
+// HandleLokiVolumeHeatmap handles Loki volume heatmap tool requests
+func HandleLokiVolumeHeatmap(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	selector, _ := params.Args["selector"].(string)
+	label, _ := params.Args["label"].(string)
+	if selector == "" || label == "" {
+		return nil, fmt.Errorf("selector and label are required")
+	}
+	if !labelNamePattern.MatchString(label) {
+		return nil, fmt.Errorf("invalid label name: %s", label)
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	step, err := durationArg(params.Args, "step", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	top := 10
+	if topVal, ok := params.Args["top"].(float64); ok && topVal > 0 {
+		top = int(topVal)
+	}
+
+	query := fmt.Sprintf("sum by (%s) (count_over_time(%s [%s]))", label, selector, formatLogQLDuration(step))
+	result, err := runLokiMetricQuery(ctx, params.Conn, query, params.Start, params.End, step)
+	if err != nil {
+		return nil, err
+	}
+
+	report := buildHeatmap(result, label, top)
+	report.Selector = selector
+	report.Step = formatLogQLDuration(step)
+
+	formattedResult, err := formatHeatmap(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	toolResult := mcp.NewToolResultText(formattedResult)
+	if chart, _ := params.Args["chart"].(bool); chart && len(report.Rows) > 0 {
+		content, err := pngImageContent(renderHeatmap(report))
+		if err != nil {
+			return nil, err
+		}
+		toolResult.Content = append(toolResult.Content, content, mcp.NewTextContent(fmt.Sprintf(
+			"Heatmap: rows top to bottom are %s; columns are %s buckets from %s to %s; darker red means more lines (max %s)",
+			strings.Join(rowValues(report.Rows), ", "), report.Step, report.Buckets[0], report.Buckets[len(report.Buckets)-1],
+			strconv.FormatFloat(report.Max, 'f', -1, 64))))
+	}
+	return toolResult, nil
+}
+
+// buildHeatmap arranges the series of a metric result, grouped by label, into a matrix of
+// counts per time bucket. Rows are ordered by total count, and rows beyond top are combined.
+func buildHeatmap(result *LokiMetricResult, label string, top int) heatmapReport {
+	report := heatmapReport{Label: label, Buckets: []string{}, Rows: []heatmapRow{}}
+
+	// Align every series on the union of their timestamps
+	index := make(map[int64]int)
+	var timestamps []int64
+	for _, series := range result.Data.Result {
+		for _, sample := range series.samples() {
+			if _, ok := index[sample.Time.Unix()]; !ok {
+				index[sample.Time.Unix()] = 0
+				timestamps = append(timestamps, sample.Time.Unix())
+			}
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	for i, ts := range timestamps {
+		index[ts] = i
+		report.Buckets = append(report.Buckets, time.Unix(ts, 0).UTC().Format(time.RFC3339))
+	}
+
+	rows := make(map[string]*heatmapRow)
+	for _, series := range result.Data.Result {
+		value := series.Metric[label]
+		if value == "" {
+			value = "(none)"
+		}
+		row, ok := rows[value]
+		if !ok {
+			row = &heatmapRow{Value: value, Counts: make([]float64, len(timestamps))}
+			rows[value] = row
+		}
+		for _, sample := range series.samples() {
+			row.Counts[index[sample.Time.Unix()]] += sample.Value
+			row.Total += sample.Value
+		}
+	}
+
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if report.Rows[i].Total != report.Rows[j].Total {
+			return report.Rows[i].Total > report.Rows[j].Total
+		}
+		return report.Rows[i].Value < report.Rows[j].Value
+	})
+
+	if len(report.Rows) > top {
+		other := heatmapRow{Value: "(other)", Counts: make([]float64, len(timestamps))}
+		for _, row := range report.Rows[top:] {
+			other.Total += row.Total
+			for i, count := range row.Counts {
+				other.Counts[i] += count
+			}
+		}
+		report.Rows = append(report.Rows[:top], other)
+	}
+
+	for _, row := range report.Rows {
+		for _, count := range row.Counts {
+			report.Max = max(report.Max, count)
+		}
+	}
+	return report
+}
+
+// rowValues returns the label values of heatmap rows in order
+func rowValues(rows []heatmapRow) []string {
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, row.Value)
+	}
+	return values
+}
+
+// heatmapShade returns the text grid character for a count relative to the busiest cell
+func heatmapShade(count, maxCount float64) rune {
+	if count <= 0 || maxCount <= 0 {
+		return heatmapShades[0]
+	}
+	i := 1 + int(count/maxCount*float64(len(heatmapShades)-2)+0.5)
+	return heatmapShades[min(i, len(heatmapShades)-1)]
+}
+
+// formatHeatmap formats the heatmap report into a readable string
+func formatHeatmap(report heatmapReport, format string) (string, error) {
+	if len(report.Rows) == 0 {
+		switch format {
+		case "json":
+			return "{\"message\": \"No logs found matching the selector\"}", nil
+		default:
+			return "No logs found matching the selector", nil
+		}
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// A header with the bucket timestamps, then one row per label value with its counts
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s\n", report.Label, strings.Join(report.Buckets, ","))
+		for _, row := range report.Rows {
+			counts := make([]string, len(row.Counts))
+			for i, count := range row.Counts {
+				counts[i] = strconv.FormatFloat(count, 'f', -1, 64)
+			}
+			fmt.Fprintf(&b, "%s %s\n", row.Value, strings.Join(counts, ","))
+		}
+		return b.String(), nil
+
+	case "text":
+		width := len(report.Label)
+		for _, row := range report.Rows {
+			width = max(width, len(row.Value))
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Log volume of %s by %s: %d buckets of %s from %s to %s\n",
+			report.Selector, report.Label, len(report.Buckets), report.Step, report.Buckets[0], report.Buckets[len(report.Buckets)-1])
+		fmt.Fprintf(&b, "Shades %q scale up to the busiest bucket (%s lines)\n\n",
+			string(heatmapShades), strconv.FormatFloat(report.Max, 'f', -1, 64))
+		for _, row := range report.Rows {
+			var cells strings.Builder
+			for _, count := range row.Counts {
+				cells.WriteRune(heatmapShade(count, report.Max))
+			}
+			fmt.Fprintf(&b, "%-*s |%s| %s\n", width, row.Value, cells.String(), strconv.FormatFloat(row.Total, 'f', -1, 64))
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
+
+// renderHeatmap draws the heatmap as a grid of cells shaded from white to red
+func renderHeatmap(report heatmapReport) *image.RGBA {
+	columns := max(len(report.Buckets), 1)
+	cellWidth := max(heatmapMaxWidth/columns, 2)
+	img := image.NewRGBA(image.Rect(0, 0, cellWidth*columns, heatmapCellHeight*len(report.Rows)))
+
+	hot := chartPalette[3].color
+	for r, row := range report.Rows {
+		for c, count := range row.Counts {
+			intensity := 0.0
+			if report.Max > 0 {
+				intensity = count / report.Max
+			}
+			shade := color.RGBA{
+				R: uint8(255 - intensity*float64(255-hot.R)),
+				G: uint8(255 - intensity*float64(255-hot.G)),
+				B: uint8(255 - intensity*float64(255-hot.B)),
+				A: 255,
+			}
+			for x := c * cellWidth; x < (c+1)*cellWidth; x++ {
+				// Leave a one pixel gap between rows
+				for y := r * heatmapCellHeight; y < (r+1)*heatmapCellHeight-1; y++ {
+					img.SetRGBA(x, y, shade)
+				}
+			}
+		}
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.SetRGBA(x, (r+1)*heatmapCellHeight-1, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	return img
+}
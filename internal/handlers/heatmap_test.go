@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// metricLokiClient returns a canned metric result and records the queries it receives
+type metricLokiClient struct {
+	fakeLokiClient
+	result  *LokiMetricResult
+	queries []string
+}
+
+func (f *metricLokiClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	f.queries = append(f.queries, query)
+	return f.result, nil
+}
+
+// heatmapTestResult returns counts for three apps over three one-minute buckets
+func heatmapTestResult() *LokiMetricResult {
+	return &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "matrix", Result: []LokiMetricSeries{
+		{Metric: map[string]string{"app": "api"}, Values: [][]any{{float64(1700000000), "10"}, {float64(1700000060), "40"}}},
+		{Metric: map[string]string{"app": "worker"}, Values: [][]any{{float64(1700000120), "2"}}},
+		{Metric: map[string]string{"app": "cron"}, Values: [][]any{{float64(1700000060), "1"}}},
+	}}}
+}
+
+// TestBuildHeatmap tests arranging series into a matrix of counts per bucket
+func TestBuildHeatmap(t *testing.T) {
+	report := buildHeatmap(heatmapTestResult(), "app", 10)
+	if len(report.Buckets) != 3 || report.Buckets[0] != "2023-11-14T22:13:20Z" {
+		t.Errorf("Unexpected buckets: %v", report.Buckets)
+	}
+	if report.Max != 40 {
+		t.Errorf("Expected a max of 40, but got %v", report.Max)
+	}
+	if values := strings.Join(rowValues(report.Rows), ","); values != "api,worker,cron" {
+		t.Errorf("Expected rows ordered by total, but got %s", values)
+	}
+	if counts := report.Rows[0].Counts; counts[0] != 10 || counts[1] != 40 || counts[2] != 0 {
+		t.Errorf("Unexpected counts for api: %v", counts)
+	}
+
+	// Rows beyond top are combined
+	report = buildHeatmap(heatmapTestResult(), "app", 1)
+	if len(report.Rows) != 2 || report.Rows[1].Value != "(other)" || report.Rows[1].Total != 3 {
+		t.Errorf("Expected api and (other) with 3 lines, but got %v", report.Rows)
+	}
+}
+
+// TestFormatHeatmap_Text tests the shaded text grid
+func TestFormatHeatmap_Text(t *testing.T) {
+	report := buildHeatmap(heatmapTestResult(), "app", 10)
+	report.Selector = `{namespace="prod"}`
+	report.Step = "1m"
+
+	output, err := formatHeatmap(report, "text")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, expected := range []string{"api    |▒█ | 50", "worker |  ░| 2", "cron   | ░ | 1"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in the output, but got:\n%s", expected, output)
+		}
+	}
+
+	if _, err := formatHeatmap(report, "csv"); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+// TestHandleLokiVolumeHeatmap tests the generated query and the heatmap image
+func TestHandleLokiVolumeHeatmap(t *testing.T) {
+	fake := &metricLokiClient{result: heatmapTestResult()}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"selector": `{namespace="prod"}`, "label": "app", "step": "1m", "format": "json", "chart": true}
+	result, err := HandleLokiVolumeHeatmap(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	expectedQuery := `sum by (app) (count_over_time({namespace="prod"} [1m]))`
+	if len(fake.queries) != 1 || fake.queries[0] != expectedQuery {
+		t.Errorf("Expected query %s, but got %v", expectedQuery, fake.queries)
+	}
+
+	var report heatmapReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if len(report.Rows) != 3 {
+		t.Errorf("Expected 3 rows, but got %d", len(report.Rows))
+	}
+	if len(result.Content) != 3 {
+		t.Fatalf("Expected text, image and legend, but got %d content items", len(result.Content))
+	}
+	if image, ok := result.Content[1].(mcp.ImageContent); !ok || image.MIMEType != "image/png" {
+		t.Errorf("Expected PNG image content, but got %v", result.Content[1])
+	}
+
+	request.Params.Arguments = map[string]any{"selector": `{namespace="prod"}`, "label": "app-name"}
+	if _, err := HandleLokiVolumeHeatmap(context.Background(), request); err == nil {
+		t.Error("Expected an error for an invalid label name")
+	}
+}
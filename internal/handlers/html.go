@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// htmlStyle styles the HTML fragment, scoped to its loki-results class so the page embedding it is not affected
+const htmlStyle = `<style>
+.loki-results{font-family:sans-serif;font-size:13px}
+.loki-results details{border:1px solid #d0d7de;border-radius:4px;margin:4px 0}
+.loki-results summary{cursor:pointer;padding:4px 8px;background:#f6f8fa}
+.loki-results summary code{font-family:monospace}
+.loki-results .loki-count{color:#57606a;margin-left:8px}
+.loki-results pre{font-family:monospace;white-space:pre-wrap;word-break:break-all;margin:0;padding:4px 8px}
+.loki-results time{color:#57606a;margin-right:8px}
+</style>
+`
+
+// formatLokiHTML renders query results as a self-contained HTML fragment for web clients, with a
+// collapsible section per stream listing its lines in monospace. Labels and lines are escaped, so
+// the fragment can be inserted into a page as it is.
+func formatLokiHTML(result *LokiResult) string {
+	var b strings.Builder
+	b.WriteString(htmlStyle)
+	b.WriteString(`<div class="loki-results">` + "\n")
+	if len(result.Data.Result) == 0 {
+		b.WriteString("<p>No logs found matching the query</p>\n</div>\n")
+		return b.String()
+	}
+
+	for _, stream := range result.Data.Result {
+		var lines int
+		for _, val := range stream.Values {
+			if len(val) >= 2 {
+				lines++
+			}
+		}
+		fmt.Fprintf(&b, `<details open><summary><code>%s</code><span class="loki-count">%d lines</span></summary>`+"\n",
+			html.EscapeString(formatStreamLabels(stream.Stream)), lines)
+		b.WriteString("<pre>")
+		for _, val := range stream.Values {
+			if len(val) < 2 {
+				continue
+			}
+			timestamp := html.EscapeString(val[0])
+			if ns, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				timestamp = time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+			}
+			fmt.Fprintf(&b, `<time datetime="%s">%s</time>%s`+"\n", timestamp, timestamp, html.EscapeString(val[1]))
+		}
+		b.WriteString("</pre>\n</details>\n")
+	}
+	b.WriteString("</div>\n")
+	return b.String()
+}
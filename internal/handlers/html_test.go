@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestFormatLokiHTML tests rendering a collapsible section per stream with escaped lines
+func TestFormatLokiHTML(t *testing.T) {
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{
+		{Stream: map[string]string{"app": "api"}, Values: [][]string{
+			{"1700000001000000000", `<script>alert("x")</script> & more`},
+			{"1700000002000000000", "request done"},
+		}},
+		{Stream: map[string]string{"app": "web"}, Values: [][]string{{"1700000003000000000", "page served"}}},
+	}}}
+
+	output := formatLokiHTML(result)
+	for _, want := range []string{
+		`<div class="loki-results">`,
+		`<details open><summary><code>{app=&#34;api&#34;}</code><span class="loki-count">2 lines</span></summary>`,
+		`<time datetime="2023-11-14T22:13:21Z">2023-11-14T22:13:21Z</time>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; more`,
+		`<span class="loki-count">1 lines</span>`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "<script>") {
+		t.Errorf("Expected the line to be escaped, but got:\n%s", output)
+	}
+	if strings.Count(output, "<details") != 2 || strings.Count(output, "</details>") != 2 {
+		t.Errorf("Expected a section per stream, but got:\n%s", output)
+	}
+
+	if empty := formatLokiHTML(&LokiResult{}); !strings.Contains(empty, "<p>No logs found matching the query</p>") {
+		t.Errorf("Unexpected empty result: %s", empty)
+	}
+}
+
+// TestHandleLokiQuery_HTML tests the html format of loki_query
+func TestHandleLokiQuery_HTML(t *testing.T) {
+	query := `{app="api"}`
+	SetLokiClient(&cannedQueryLokiClient{lines: map[string][]string{query: {"\x1b[31merror\x1b[0m in handler"}}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": query, "format": "html", "strip_ansi": true}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, `<details open>`) || !strings.Contains(text, "</time>error in handler") {
+		t.Errorf("Expected an HTML section with the ANSI codes stripped, but got:\n%s", text)
+	}
+}
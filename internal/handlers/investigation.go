@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Report timeline limits
+const (
+	reportBuckets    = 24  // target number of buckets when the step is chosen automatically
+	maxReportBuckets = 100 // the timeline table gets unreadable beyond this
+)
+
+// reportSteps are the bucket sizes an automatic report step is chosen from
+var reportSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// reportBucket holds the line and error counts of one timeline bucket
+type reportBucket struct {
+	Start  string  `json:"start"`
+	Lines  float64 `json:"lines"`
+	Errors float64 `json:"errors"`
+	time   time.Time
+}
+
+// reportQuery is a query the report ran, shown so its readers can rerun it
+type reportQuery struct {
+	Purpose string `json:"purpose"`
+	Query   string `json:"query"`
+}
+
+// investigationReport is the incident report section assembled by loki_report
+type investigationReport struct {
+	Title          string         `json:"title"`
+	Selector       string         `json:"selector"`
+	Start          time.Time      `json:"start"`
+	End            time.Time      `json:"end"`
+	Step           string         `json:"step"`
+	Lines          float64        `json:"lines"`
+	Errors         float64        `json:"errors"`
+	ErrorRatio     float64        `json:"error_ratio"`
+	FirstError     *reportBucket  `json:"first_error_bucket,omitempty"`
+	PeakError      *reportBucket  `json:"peak_error_bucket,omitempty"`
+	MedianErrors   float64        `json:"median_errors_per_bucket"`
+	Timeline       []reportBucket `json:"timeline"`
+	ErrorSampled   int            `json:"error_lines_sampled"`
+	ErrorPatterns  []patternCount `json:"error_patterns"`
+	LinesSampled   int            `json:"lines_sampled"`
+	TopPatterns    []patternCount `json:"top_patterns"`
+	Queries        []reportQuery  `json:"queries"`
+	timelineLayout string
+}
+
+// NewLokiReportTool creates and returns a tool for generating an investigation report for a service
+func NewLokiReportTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Generate a Markdown investigation report section for a service and time window, as a starting point " +
+			"for a postmortem. Runs several queries and assembles their results: log volume and error counts, a timeline of both, " +
+			"a summary of the most frequent error messages, the top log patterns, and the LogQL queries used so readers can rerun them."),
+		mcp.WithString("service",
+			mcp.Description("Service to report on, matched with the datasource's service label (e.g. app or service_name)"),
+		),
+		mcp.WithString("namespace",
+			mcp.Description("Kubernetes namespace of the service"),
+		),
+		mcp.WithString("selector",
+			mcp.Description("Stream selector to report on instead of service and namespace, e.g. {app=\"checkout\"}"),
+		),
+		mcp.WithString("error_pattern",
+			mcp.Description(fmt.Sprintf("Regular expression identifying error lines (default: %s)", defaultErrorPattern)),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time of the incident window (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time of the incident window (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("step",
+			mcp.Description(fmt.Sprintf("Timeline bucket size, e.g. 5m (default: chosen for about %d buckets)", reportBuckets)),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of lines sampled for the error summary and the top patterns (default: 1000)"),
+		),
+		mcp.WithNumber("top",
+			mcp.Description("Number of patterns listed in the error summary and the top patterns (default: 5)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: markdown (raw and text are the same) or json (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_report", opts...)
+}
+
+// HandleLokiReport handles Loki report tool requests
+func HandleLokiReport(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	args := params.Args
+
+	selector, _ := args["selector"].(string)
+	title := selector
+	if selector == "" {
+		service, _ := args["service"].(string)
+		namespace, _ := args["namespace"].(string)
+		if service == "" {
+			return nil, fmt.Errorf("service or selector is required")
+		}
+		selector, err = k8sLogsQuery(params.Conn.Labels, map[string]any{"service": service, "namespace": namespace})
+		if err != nil {
+			return nil, err
+		}
+		title = service
+		if namespace != "" {
+			title = namespace + "/" + service
+		}
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	errorPattern := defaultErrorPattern
+	if patternArg, ok := args["error_pattern"].(string); ok && patternArg != "" {
+		errorPattern = patternArg
+	}
+
+	step, err := durationArg(args, "step", reportStep(params.End.Sub(params.Start)))
+	if err != nil {
+		return nil, err
+	}
+	if buckets := params.End.Sub(params.Start) / step; buckets > maxReportBuckets {
+		return nil, fmt.Errorf("step %s gives %d timeline buckets, at most %d are supported: use a larger step", step, buckets, maxReportBuckets)
+	}
+
+	limit := 1000
+	if limitVal, ok := args["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+	top := 5
+	if topVal, ok := args["top"].(float64); ok && topVal > 0 {
+		top = int(topVal)
+	}
+
+	rangeStr := formatLogQLDuration(step)
+	errorSelector := fmt.Sprintf("%s |~ %s", selector, quoteLogQLString(errorPattern))
+	volumeQuery := fmt.Sprintf("sum(count_over_time(%s [%s]))", selector, rangeStr)
+	errorQuery := fmt.Sprintf("sum(count_over_time(%s [%s]))", errorSelector, rangeStr)
+
+	volume, err := runLokiMetricQuery(ctx, params.Conn, volumeQuery, params.Start, params.End, step)
+	if err != nil {
+		return nil, err
+	}
+	errorVolume, err := runLokiMetricQuery(ctx, params.Conn, errorQuery, params.Start, params.End, step)
+	if err != nil {
+		return nil, err
+	}
+	errorLines, err := runLokiQuery(ctx, params.Conn, errorSelector, params.Start, params.End, limit)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := runLokiQuery(ctx, params.Conn, selector, params.Start, params.End, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	report := buildInvestigationReport(volume.sumByTime(), errorVolume.sumByTime(), errorLines, lines, top)
+	report.Title = title
+	report.Selector = selector
+	report.Start = params.Start.UTC()
+	report.End = params.End.UTC()
+	report.Step = rangeStr
+	report.timelineLayout = coverageTimeLayout(params.Start, params.End)
+	report.Queries = []reportQuery{
+		{"Log volume over time", volumeQuery},
+		{"Errors over time", errorQuery},
+		{"Error lines", errorSelector},
+		{"All lines", selector},
+	}
+
+	formattedResult, err := formatInvestigationReport(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// reportStep returns the smallest report step that splits a window into at most reportBuckets buckets
+func reportStep(window time.Duration) time.Duration {
+	for _, step := range reportSteps {
+		if window/step <= reportBuckets {
+			return step
+		}
+	}
+	return reportSteps[len(reportSteps)-1]
+}
+
+// buildInvestigationReport combines the line and error counts per bucket with the patterns of the sampled lines
+func buildInvestigationReport(lines, errors map[int64]float64, errorLines, allLines *LokiResult, top int) investigationReport {
+	report := investigationReport{Timeline: []reportBucket{}}
+
+	timestamps := make([]int64, 0, len(lines))
+	for ts := range lines {
+		timestamps = append(timestamps, ts)
+	}
+	for ts := range errors {
+		if _, ok := lines[ts]; !ok {
+			timestamps = append(timestamps, ts)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	errorCounts := make([]float64, 0, len(timestamps))
+	for _, ts := range timestamps {
+		at := time.Unix(ts, 0).UTC()
+		bucket := reportBucket{Start: at.Format(time.RFC3339), Lines: lines[ts], Errors: errors[ts], time: at}
+		report.Timeline = append(report.Timeline, bucket)
+		report.Lines += bucket.Lines
+		report.Errors += bucket.Errors
+		errorCounts = append(errorCounts, bucket.Errors)
+	}
+	if report.Lines > 0 {
+		report.ErrorRatio = report.Errors / report.Lines
+	}
+
+	for i := range report.Timeline {
+		bucket := &report.Timeline[i]
+		if bucket.Errors == 0 {
+			continue
+		}
+		if report.FirstError == nil {
+			report.FirstError = bucket
+		}
+		if report.PeakError == nil || bucket.Errors > report.PeakError.Errors {
+			report.PeakError = bucket
+		}
+	}
+	if len(errorCounts) > 0 {
+		sort.Float64s(errorCounts)
+		report.MedianErrors = errorCounts[len(errorCounts)/2]
+	}
+
+	patterns := func(result *LokiResult) ([]patternCount, int) {
+		lineOptions{}.apply(result)
+		counts, total := countPatterns(result)
+		sorted := sortedPatterns(counts)
+		if len(sorted) > top {
+			sorted = sorted[:top]
+		}
+		return sorted, total
+	}
+	report.ErrorPatterns, report.ErrorSampled = patterns(errorLines)
+	report.TopPatterns, report.LinesSampled = patterns(allLines)
+	return report
+}
+
+// formatInvestigationReport formats the report as a Markdown section or as JSON
+func formatInvestigationReport(report investigationReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text", "markdown":
+		layout := report.timelineLayout
+		if layout == "" {
+			layout = coverageTimeLayout(report.Start, report.End)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "## Investigation: %s\n\n", report.Title)
+		fmt.Fprintf(&b, "**Window:** %s to %s UTC (timeline step %s)  \n",
+			report.Start.Format("2006-01-02 15:04:05"), report.End.Format("2006-01-02 15:04:05"), report.Step)
+		fmt.Fprintf(&b, "**Selector:** %s\n", markdownCode(report.Selector))
+
+		b.WriteString("\n### Summary\n\n")
+		fmt.Fprintf(&b, "- %.0f log lines, %.0f of them errors (%.2f%%)\n", report.Lines, report.Errors, report.ErrorRatio*100)
+		if report.FirstError == nil {
+			b.WriteString("- No error lines in the window\n")
+		} else {
+			fmt.Fprintf(&b, "- Errors first seen in the %s bucket\n", report.FirstError.time.Format(layout))
+			peak := fmt.Sprintf("- Errors peaked in the %s bucket with %.0f errors", report.PeakError.time.Format(layout), report.PeakError.Errors)
+			if report.MedianErrors > 0 {
+				peak += fmt.Sprintf(", %.1fx the median bucket", report.PeakError.Errors/report.MedianErrors)
+			}
+			b.WriteString(peak + "\n")
+		}
+		if report.Lines == 0 {
+			b.WriteString("- Warning: the service sent no logs in the window; check the service name and the time range\n")
+		}
+
+		b.WriteString("\n### Timeline\n\n")
+		if len(report.Timeline) == 0 {
+			b.WriteString("No log lines in the window.\n")
+		} else {
+			b.WriteString("| Time (UTC) | Lines | Errors | Error % |\n|---|---:|---:|---:|\n")
+			for _, bucket := range report.Timeline {
+				ratio := 0.0
+				if bucket.Lines > 0 {
+					ratio = bucket.Errors / bucket.Lines * 100
+				}
+				marker := ""
+				if report.PeakError != nil && bucket.Start == report.PeakError.Start {
+					marker = " (peak)"
+				}
+				fmt.Fprintf(&b, "| %s%s | %.0f | %.0f | %.1f%% |\n", bucket.time.Format(layout), marker, bucket.Lines, bucket.Errors, ratio)
+			}
+		}
+
+		patternTable := func(title, sample string, patterns []patternCount, sampled int) {
+			fmt.Fprintf(&b, "\n### %s\n\n", title)
+			if len(patterns) == 0 {
+				b.WriteString("None.\n")
+				return
+			}
+			fmt.Fprintf(&b, "Most frequent patterns in the %d most recent %s (numbers, IDs and addresses replaced by placeholders):\n\n", sampled, sample)
+			b.WriteString("| Count | Pattern |\n|---:|---|\n")
+			for _, pc := range patterns {
+				fmt.Fprintf(&b, "| %d | %s |\n", pc.Count, strings.ReplaceAll(markdownCode(pc.Pattern), "|", `\|`))
+			}
+		}
+		patternTable("Error Summary", "error lines", report.ErrorPatterns, report.ErrorSampled)
+		patternTable("Top Patterns", "lines", report.TopPatterns, report.LinesSampled)
+
+		b.WriteString("\n### Queries Used\n\n```logql\n")
+		for i, q := range report.Queries {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "# %s\n%s\n", q.Purpose, q.Query)
+		}
+		b.WriteString("```\n")
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text, markdown", format)
+	}
+}
+
+// markdownCode renders text as inline Markdown code, using a longer fence when the text contains backticks
+func markdownCode(text string) string {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		return fence + " " + text + " " + fence
+	}
+	return fence + text + fence
+}
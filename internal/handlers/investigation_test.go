@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// reportLokiClient returns canned log lines and metric results for each query
+type reportLokiClient struct {
+	cannedQueryLokiClient
+	metrics map[string]*LokiMetricResult
+	steps   []time.Duration
+}
+
+func (f *reportLokiClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	f.steps = append(f.steps, step)
+	if result, ok := f.metrics[query]; ok {
+		return result, nil
+	}
+	return &LokiMetricResult{Status: "success"}, nil
+}
+
+// reportMetric returns a single series with the given values at one-minute intervals
+func reportMetric(values ...string) *LokiMetricResult {
+	series := LokiMetricSeries{}
+	for i, v := range values {
+		series.Values = append(series.Values, []any{float64(1700000000 + 60*i), v})
+	}
+	return &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "matrix", Result: []LokiMetricSeries{series}}}
+}
+
+// TestReportStep tests choosing the timeline step from the window length
+func TestReportStep(t *testing.T) {
+	tests := map[time.Duration]time.Duration{
+		10 * time.Minute:    time.Minute,
+		time.Hour:           5 * time.Minute,
+		6 * time.Hour:       15 * time.Minute,
+		7 * 24 * time.Hour:  12 * time.Hour,
+		90 * 24 * time.Hour: 24 * time.Hour,
+	}
+	for window, expected := range tests {
+		if step := reportStep(window); step != expected {
+			t.Errorf("Expected step %s for a %s window, but got %s", expected, window, step)
+		}
+	}
+}
+
+// TestHandleLokiReport tests the queries run for a service and the assembled Markdown report
+func TestHandleLokiReport(t *testing.T) {
+	errorSelector := `{app="checkout"} |~ "(?i)(error|exception|fatal|panic)"`
+	fake := &reportLokiClient{
+		cannedQueryLokiClient: cannedQueryLokiClient{lines: map[string][]string{
+			errorSelector:      {"error: payment 42 declined", "error: payment 43 declined", "panic: nil map | in handler"},
+			`{app="checkout"}`: {"GET /cart 200", "GET /cart 200", "error: payment 42 declined"},
+		}},
+		metrics: map[string]*LokiMetricResult{
+			`sum(count_over_time({app="checkout"} [1m]))`:      reportMetric("100", "100", "100", "100"),
+			`sum(count_over_time(` + errorSelector + ` [1m]))`: reportMetric("0", "2", "20", "2"),
+		},
+	}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"service": "checkout", "start": "2023-11-14T22:13:00Z", "end": "2023-11-14T22:17:00Z"}
+	result, err := HandleLokiReport(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(fake.steps) != 2 || fake.steps[0] != time.Minute {
+		t.Errorf("Expected two metric queries with a 1m step, but got %v", fake.steps)
+	}
+
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, expected := range []string{
+		"## Investigation: checkout",
+		"- 400 log lines, 24 of them errors (6.00%)",
+		"- Errors first seen in the 22:14 bucket",
+		"- Errors peaked in the 22:15 bucket with 20 errors, 10.0x the median bucket",
+		"| 22:15 (peak) | 100 | 20 | 20.0% |",
+		"| 2 | `error: payment <num> declined` |",
+		"| 1 | `panic: nil map \\| in handler` |",
+		"Most frequent patterns in the 3 most recent error lines",
+		"# Errors over time\nsum(count_over_time(" + errorSelector + " [1m]))",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in the report, but got:\n%s", expected, text)
+		}
+	}
+
+	request.Params.Arguments = map[string]any{"selector": `{app="checkout"}`, "format": "json"}
+	result, err = HandleLokiReport(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var report investigationReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Expected a JSON report, but got %v", err)
+	}
+	if report.Title != `{app="checkout"}` || len(report.Queries) != 4 || len(report.TopPatterns) != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	request.Params.Arguments = map[string]any{"namespace": "shop"}
+	if _, err := HandleLokiReport(context.Background(), request); err == nil || !strings.Contains(err.Error(), "service or selector is required") {
+		t.Errorf("Expected a missing service error, but got %v", err)
+	}
+	request.Params.Arguments = map[string]any{"service": "checkout", "since": "24h", "step": "1m"}
+	if _, err := HandleLokiReport(context.Background(), request); err == nil || !strings.Contains(err.Error(), "use a larger step") {
+		t.Errorf("Expected a too many buckets error, but got %v", err)
+	}
+}
+
+// TestMarkdownCode tests inline code with backticks in the text
+func TestMarkdownCode(t *testing.T) {
+	tests := map[string]string{
+		"plain":             "`plain`",
+		"a `b` c":           "``a `b` c``",
+		"`starts with tick": "`` `starts with tick ``",
+	}
+	for text, expected := range tests {
+		if code := markdownCode(text); code != expected {
+			t.Errorf("Expected %s for %q, but got %s", expected, text, code)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// NewLokiK8sLogsTool creates and returns a tool for querying Kubernetes workload logs by
+// namespace, service, pod and container without knowing the cluster's label names
+func NewLokiK8sLogsTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Get the logs of a Kubernetes workload by namespace, service, pod or container, optionally " +
+			"filtered by log level and text. The stream selector is built from the datasource's label profile, so the " +
+			"same question works whether the cluster labels services as app, service_name or k8s_container_name."),
+		mcp.WithString("namespace",
+			mcp.Description("Kubernetes namespace"),
+		),
+		mcp.WithString("service",
+			mcp.Description("Service or app name"),
+		),
+		mcp.WithString("pod",
+			mcp.Description("Pod name or name prefix, e.g. api-7d9f or api"),
+		),
+		mcp.WithString("container",
+			mcp.Description("Container name"),
+		),
+		mcp.WithString("level",
+			mcp.Description("Comma-separated log levels to keep, e.g. error or error,warn (case-insensitive)"),
+		),
+		mcp.WithString("contains",
+			mcp.Description("Only return lines containing this text"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return (default: 100)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, text, ndjson, logfmt, or html (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+		positionOption(),
+		compactOption(),
+		relativeTimeOption(),
+		groupByOption(),
+		collapseStreamsOption(),
+		sampleOption(),
+		sampleRateOption(),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_k8s_logs", opts...)
+}
+
+// NewLokiServicesTool creates and returns a tool for listing the services logging to Loki
+func NewLokiServicesTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("List the services (apps) that sent logs, optionally within a namespace, using the " +
+			"datasource's label profile to find the service label"),
+		mcp.WithString("namespace",
+			mcp.Description("Only list services in this Kubernetes namespace"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_services", opts...)
+}
+
+// HandleLokiK8sLogs handles Loki Kubernetes logs tool requests by building the query
+// from the label profile and running it as loki_query
+func HandleLokiK8sLogs(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	conn := ResolveLokiConnection(applySessionContext(ctx, args))
+
+	query, err := k8sLogsQuery(conn.Labels, args)
+	if err != nil {
+		return nil, err
+	}
+
+	queryArgs := make(map[string]any, len(args)+1)
+	for k, v := range args {
+		queryArgs[k] = v
+	}
+	queryArgs["query"] = query
+	request.Params.Arguments = queryArgs
+	return HandleLokiQuery(ctx, request)
+}
+
+// HandleLokiServices handles Loki services tool requests
+func HandleLokiServices(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	label := params.Conn.Labels.Service
+	namespace, _ := params.Args["namespace"].(string)
+
+	var services []string
+	if namespace == "" {
+		result, err := CurrentLokiClient().LabelValues(ctx, params.Conn, label, params.Start, params.End)
+		if err != nil {
+			return nil, fmt.Errorf("label values query execution failed: %w", err)
+		}
+		services = result.Data
+	} else {
+		selector := fmt.Sprintf("{%s=%s}", params.Conn.Labels.Namespace, quoteLogQLString(namespace))
+		result, err := CurrentLokiClient().Series(ctx, params.Conn, applySessionSelector(ctx, selector), params.Start, params.End)
+		if err != nil {
+			return nil, fmt.Errorf("series query execution failed: %w", err)
+		}
+		seen := make(map[string]bool)
+		for _, series := range result.Data {
+			if value := series[label]; value != "" && !seen[value] {
+				seen[value] = true
+				services = append(services, value)
+			}
+		}
+		sort.Strings(services)
+	}
+
+	formattedResult, err := formatLokiLabelValuesResults(label, &LokiLabelValuesResult{Status: "success", Data: services}, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	metadata := newResultMetadata(params)
+	metadata.EntryCount = len(services)
+	return metadata.attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// k8sLogsQuery builds a LogQL query from the namespace, service, pod, container, level and
+// contains arguments, using the label names of the profile
+func k8sLogsQuery(labels LabelProfile, args map[string]any) (string, error) {
+	var matchers []string
+	for _, m := range []struct{ arg, label string }{
+		{"namespace", labels.Namespace}, {"service", labels.Service}, {"pod", labels.Pod}, {"container", labels.Container},
+	} {
+		value, ok := args[m.arg].(string)
+		if !ok || value == "" {
+			continue
+		}
+		// Pods are matched by prefix, so a deployment name matches all of its pods
+		op := "="
+		if m.arg == "pod" {
+			op, value = "=~", regexp.QuoteMeta(value)+".*"
+		}
+		matcher, err := logQLMatcher(m.label, op, value)
+		if err != nil {
+			return "", err
+		}
+		matchers = append(matchers, matcher)
+	}
+	if len(matchers) == 0 {
+		return "", fmt.Errorf("at least one of namespace, service, pod or container is required")
+	}
+
+	query := "{" + strings.Join(matchers, ", ") + "}"
+	if contains, ok := args["contains"].(string); ok && contains != "" {
+		query += " |= " + quoteLogQLString(contains)
+	}
+	if level, ok := args["level"].(string); ok && level != "" {
+		filter, err := logQLMatcher(labels.Level, "=~", "(?i)"+logQLRegexAlternation(splitList(level)))
+		if err != nil {
+			return "", err
+		}
+		query += " | " + filter
+	}
+	return query, nil
+}
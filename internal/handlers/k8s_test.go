@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestK8sLogsQuery tests building queries from the label profile
+func TestK8sLogsQuery(t *testing.T) {
+	testCases := []struct {
+		labels   LabelProfile
+		args     map[string]any
+		expected string
+	}{
+		{
+			defaultLabelProfile,
+			map[string]any{"namespace": "prod", "service": "api"},
+			`{namespace="prod", app="api"}`,
+		},
+		{
+			LabelProfile{Service: "service_name", Container: "k8s_container_name", Level: "detected_level"}.withDefaults(),
+			map[string]any{"service": "api", "container": "main", "level": "error, warn", "contains": "timeout"},
+			`{service_name="api", k8s_container_name="main"} |= "timeout" | detected_level=~"(?i)error|warn"`,
+		},
+		{
+			defaultLabelProfile,
+			map[string]any{"pod": "api-7d.9"},
+			`{pod=~"api-7d\\.9.*"}`,
+		},
+	}
+	for _, tc := range testCases {
+		query, err := k8sLogsQuery(tc.labels, tc.args)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if query != tc.expected {
+			t.Errorf("Expected %s, but got %s", tc.expected, query)
+		}
+	}
+
+	if _, err := k8sLogsQuery(defaultLabelProfile, map[string]any{"level": "error"}); err == nil {
+		t.Error("Expected an error without a workload")
+	}
+}
+
+// TestHandleLokiServices tests listing services with the datasource's service label
+func TestHandleLokiServices(t *testing.T) {
+	setTestDatasources(t)
+	fake := &fakeLokiClient{series: []map[string]string{
+		{"namespace": "prod", "service_name": "checkout"},
+		{"namespace": "prod", "service_name": "api"},
+		{"namespace": "prod", "service_name": "api"},
+		{"namespace": "prod"},
+	}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"datasource": "otel", "namespace": "prod", "format": "raw"}
+	result, err := HandleLokiServices(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(fake.selectors) != 1 || fake.selectors[0] != `{namespace="prod"}` {
+		t.Errorf("Unexpected series selectors: %v", fake.selectors)
+	}
+	expected, _ := formatLokiLabelValuesResults("service_name", &LokiLabelValuesResult{Data: []string{"api", "checkout"}}, "raw")
+	if text := result.Content[0].(mcp.TextContent).Text; text != expected {
+		t.Errorf("Expected %q, but got %q", expected, text)
+	}
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// EnvLokiK8sEnrich enables looking up the pods of query results in the Kubernetes API with the
+// in-cluster service account credentials
+const EnvLokiK8sEnrich = "LOKI_K8S_ENRICH"
+
+// Pod enrichment limits
+const (
+	maxEnrichedPods    = 20 // most pods looked up per result
+	kubeConcurrency    = 4
+	kubeRequestTimeout = 5 * time.Second
+)
+
+// kubeServiceAccountDir holds the in-cluster service account token and CA certificate
+var kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// newKubeClient creates the Kubernetes API client; replaced in tests
+var newKubeClient = inClusterKubeClient
+
+// kubeClient sends authenticated GET requests to the Kubernetes API
+type kubeClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// podEnrichment describes the pod of a stream in a query result
+type podEnrichment struct {
+	Namespace  string         `json:"namespace"`
+	Pod        string         `json:"pod"`
+	Owner      string         `json:"owner,omitempty"` // kind/name of the controller, e.g. Deployment/api
+	Node       string         `json:"node,omitempty"`
+	Phase      string         `json:"phase,omitempty"`
+	Restarts   int            `json:"restarts"`
+	Containers map[string]int `json:"container_restarts,omitempty"`
+	LastReason string         `json:"last_termination_reason,omitempty"` // e.g. OOMKilled
+	Error      string         `json:"error,omitempty"`
+}
+
+// kubeObjectMeta holds the fields read from the metadata of pods and replica sets
+type kubeObjectMeta struct {
+	OwnerReferences []struct {
+		Kind       string `json:"kind"`
+		Name       string `json:"name"`
+		Controller bool   `json:"controller"`
+	} `json:"ownerReferences"`
+}
+
+// kubePod holds the fields read from a pod
+type kubePod struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase             string `json:"phase"`
+		ContainerStatuses []struct {
+			Name         string `json:"name"`
+			RestartCount int    `json:"restartCount"`
+			LastState    struct {
+				Terminated *struct {
+					Reason string `json:"reason"`
+				} `json:"terminated"`
+			} `json:"lastState"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// errKubeNotFound is returned for objects that don't exist, such as pods deleted since they logged
+var errKubeNotFound = errors.New("not found")
+
+// enrichPodsOption returns the tool option for appending the Kubernetes metadata of the result's pods
+func enrichPodsOption() mcp.ToolOption {
+	return mcp.WithBoolean("enrich_pods",
+		mcp.Description(fmt.Sprintf("Append the Kubernetes metadata of the pods whose streams were returned: owner deployment, "+
+			"node, phase and restart count. Requires %s=true and in-cluster credentials. At most %d pods are looked up (default: false)",
+			EnvLokiK8sEnrich, maxEnrichedPods)),
+	)
+}
+
+// enrichPodsRequested reports whether pod enrichment was requested for a tool call
+func enrichPodsRequested(args map[string]any) bool {
+	enrich, _ := args["enrich_pods"].(bool)
+	return enrich
+}
+
+// inClusterKubeClient creates a client with the pod's service account, as client-go's in-cluster configuration does
+func inClusterKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("pod enrichment requires running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account token: %v", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid service account CA certificate")
+	}
+	return &kubeClient{
+		baseURL: "https://" + net.JoinHostPort(host, port),
+		token:   strings.TrimSpace(string(token)),
+		http:    &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+// get decodes the object at an API path
+func (c *kubeClient) get(ctx context.Context, path string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errKubeNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("kubernetes API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// controller returns the kind and name of the object's controlling owner
+func (m kubeObjectMeta) controller() (string, string, bool) {
+	for _, ref := range m.OwnerReferences {
+		if ref.Controller {
+			return ref.Kind, ref.Name, true
+		}
+	}
+	return "", "", false
+}
+
+// enrichPods looks up the pods of the result's streams, identified by the profile's namespace and pod labels
+func enrichPods(ctx context.Context, result *LokiResult, labels LabelProfile) ([]podEnrichment, error) {
+	if !CurrentConfig().K8sEnrich {
+		return nil, fmt.Errorf("pod enrichment is disabled: set %s=true and grant the service account get on pods and replicasets", EnvLokiK8sEnrich)
+	}
+	client, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[[2]string]bool)
+	var pods []podEnrichment
+	for _, stream := range result.Data.Result {
+		key := [2]string{stream.Stream[labels.Namespace], stream.Stream[labels.Pod]}
+		if key[0] == "" || key[1] == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pods = append(pods, podEnrichment{Namespace: key[0], Pod: key[1]})
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Pod < pods[j].Pod
+	})
+	if len(pods) > maxEnrichedPods {
+		pods = pods[:maxEnrichedPods]
+	}
+
+	sem := make(chan struct{}, kubeConcurrency)
+	var wg sync.WaitGroup
+	for i := range pods {
+		wg.Add(1)
+		go func(p *podEnrichment) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := client.describePod(ctx, p); err != nil {
+				p.Error = err.Error()
+			}
+		}(&pods[i])
+	}
+	wg.Wait()
+	return pods, nil
+}
+
+// describePod fills in the metadata of a pod, following a ReplicaSet owner to its Deployment
+func (c *kubeClient) describePod(ctx context.Context, p *podEnrichment) error {
+	var pod kubePod
+	err := c.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(p.Namespace), url.PathEscape(p.Pod)), &pod)
+	if errors.Is(err, errKubeNotFound) {
+		return fmt.Errorf("pod not found, it may have been deleted since it logged")
+	} else if err != nil {
+		return err
+	}
+
+	p.Node, p.Phase = pod.Spec.NodeName, pod.Status.Phase
+	for _, status := range pod.Status.ContainerStatuses {
+		p.Restarts += status.RestartCount
+		if status.RestartCount > 0 {
+			if p.Containers == nil {
+				p.Containers = make(map[string]int)
+			}
+			p.Containers[status.Name] = status.RestartCount
+		}
+		if t := status.LastState.Terminated; t != nil && t.Reason != "" && p.LastReason == "" {
+			p.LastReason = t.Reason
+		}
+	}
+
+	kind, name, ok := pod.Metadata.controller()
+	if !ok {
+		return nil
+	}
+	p.Owner = kind + "/" + name
+	if kind == "ReplicaSet" {
+		var rs struct {
+			Metadata kubeObjectMeta `json:"metadata"`
+		}
+		// Without permission to read replica sets the ReplicaSet is reported as the owner
+		rsPath := fmt.Sprintf("/apis/apps/v1/namespaces/%s/replicasets/%s", url.PathEscape(p.Namespace), url.PathEscape(name))
+		if err := c.get(ctx, rsPath, &rs); err == nil {
+			if kind, name, ok := rs.Metadata.controller(); ok {
+				p.Owner = kind + "/" + name
+			}
+		}
+	}
+	return nil
+}
+
+// describePods renders the pod metadata appended to a query result
+func describePods(pods []podEnrichment) string {
+	if len(pods) == 0 {
+		return "No pods found in the returned streams"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pods in the returned streams (%d):", len(pods))
+	for _, p := range pods {
+		fmt.Fprintf(&b, "\n  %s/%s", p.Namespace, p.Pod)
+		if p.Error != "" {
+			fmt.Fprintf(&b, "  %s", p.Error)
+			continue
+		}
+		if p.Owner != "" {
+			fmt.Fprintf(&b, "  owner=%s", p.Owner)
+		}
+		fmt.Fprintf(&b, "  node=%s  phase=%s  restarts=%d", p.Node, p.Phase, p.Restarts)
+		if len(p.Containers) > 1 {
+			names := make([]string, 0, len(p.Containers))
+			for name := range p.Containers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			parts := make([]string, len(names))
+			for i, name := range names {
+				parts[i] = fmt.Sprintf("%s=%d", name, p.Containers[name])
+			}
+			fmt.Fprintf(&b, " (%s)", strings.Join(parts, ", "))
+		}
+		if p.LastReason != "" {
+			fmt.Fprintf(&b, "  last_termination=%s", p.LastReason)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// streamsLokiClient returns one line for each of the given streams
+type streamsLokiClient struct {
+	fakeLokiClient
+	streams []map[string]string
+}
+
+func (f *streamsLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+	for _, stream := range f.streams {
+		result.Data.Result = append(result.Data.Result, LokiEntry{Stream: stream, Values: [][]string{{"1", "error"}}})
+	}
+	return result, nil
+}
+
+// TestHandleLokiQuery_EnrichPods tests appending the Kubernetes metadata of the returned streams' pods
+func TestHandleLokiQuery_EnrichPods(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/api/v1/namespaces/prod/pods/api-7d9f-abcde":
+			w.Write([]byte(`{"metadata":{"ownerReferences":[{"kind":"ReplicaSet","name":"api-7d9f","controller":true}]},
+				"spec":{"nodeName":"node-3"},"status":{"phase":"Running","containerStatuses":[
+				{"name":"api","restartCount":5,"lastState":{"terminated":{"reason":"OOMKilled"}}},
+				{"name":"sidecar","restartCount":0,"lastState":{}}]}}`))
+		case "/apis/apps/v1/namespaces/prod/replicasets/api-7d9f":
+			w.Write([]byte(`{"metadata":{"ownerReferences":[{"kind":"Deployment","name":"api","controller":true}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	original := newKubeClient
+	newKubeClient = func() (*kubeClient, error) {
+		return &kubeClient{baseURL: server.URL, token: "sa-token", http: server.Client()}, nil
+	}
+	t.Cleanup(func() { newKubeClient = original })
+	SetConfig(&Config{LokiURL: DefaultLokiURL, K8sEnrich: true})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	SetLokiClient(&streamsLokiClient{streams: []map[string]string{
+		{"namespace": "prod", "pod": "api-7d9f-abcde", "container": "api"},
+		{"namespace": "prod", "pod": "api-7d9f-abcde", "container": "sidecar"},
+		{"namespace": "prod", "pod": "worker-gone"},
+		{"app": "no-pod-labels"},
+	}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{namespace="prod"}`, "enrich_pods": true}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+	want := "Pods in the returned streams (2):\n" +
+		"  prod/api-7d9f-abcde  owner=Deployment/api  node=node-3  phase=Running  restarts=5  last_termination=OOMKilled\n" +
+		"  prod/worker-gone  pod not found, it may have been deleted since it logged"
+	if text != want {
+		t.Errorf("Unexpected enrichment:\n%s\nwant:\n%s", text, want)
+	}
+	if auth != "Bearer sa-token" {
+		t.Errorf("Expected the service account token, but got %q", auth)
+	}
+
+	// Enrichment must be enabled explicitly
+	SetConfig(&Config{LokiURL: DefaultLokiURL})
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), EnvLokiK8sEnrich) {
+		t.Errorf("Expected a disabled error, but got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Last occurrence search settings
+const (
+	// defaultLastOccurrenceLookback is how far back the search goes when no start is given
+	defaultLastOccurrenceLookback = 24 * time.Hour
+	// firstLastOccurrenceWindow is the most recent window searched first; each following window is
+	// lastOccurrenceGrowth times longer, so recent matches are found without scanning the whole range
+	firstLastOccurrenceWindow = 15 * time.Minute
+	lastOccurrenceGrowth      = 4
+)
+
+// lastOccurrenceReport describes when lines matching a query were last seen
+type lastOccurrenceReport struct {
+	Query     string            `json:"query"`
+	Start     string            `json:"start"`
+	End       string            `json:"end"`
+	Window    string            `json:"window"` // length of the searched range, e.g. 24h
+	Found     bool              `json:"found"`
+	Timestamp string            `json:"timestamp,omitempty"`
+	Ago       string            `json:"ago,omitempty"` // time between the line and now
+	Labels    map[string]string `json:"labels,omitempty"`
+	Line      string            `json:"line,omitempty"`
+	Probes    int               `json:"probes"` // queries sent to Loki
+}
+
+// NewLokiLastOccurrenceTool creates and returns a tool for finding when lines matching a query were last seen
+func NewLokiLastOccurrenceTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Find the most recent line matching a LogQL log query and how long ago it was logged, to answer " +
+			"whether something is still happening, e.g. after a fix was deployed. Answers \"not seen in the last N hours\" " +
+			"when nothing matched. Recent windows are searched first, so frequent matches cost one small query."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL log query to search for, e.g. {app=\"api\"} |= \"connection refused\""),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start of the searched range (default: 24h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End of the searched range (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_last_occurrence", opts...)
+}
+
+// HandleLokiLastOccurrence handles Loki last occurrence tool requests
+func HandleLokiLastOccurrence(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, defaultLastOccurrenceLookback)
+	if err != nil {
+		return nil, err
+	}
+	query, _ := params.Args["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	query = applySessionSelector(ctx, query)
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return nil, fmt.Errorf("loki_last_occurrence requires a log query, not a metric query")
+	}
+
+	report, err := findLastOccurrence(ctx, params.Conn, query, params.Start, params.End, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	formattedResult, err := formatLastOccurrence(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return newResultMetadata(params).attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// findLastOccurrence finds the newest line matching a query in the time range, searching windows
+// ending at the end of the range that grow until one has a match or the start is reached
+func findLastOccurrence(ctx context.Context, conn LokiConnection, query string, start, end, now time.Time) (lastOccurrenceReport, error) {
+	report := lastOccurrenceReport{
+		Query:  query,
+		Start:  start.UTC().Format(time.RFC3339),
+		End:    end.UTC().Format(time.RFC3339),
+		Window: formatLogQLDuration(end.Sub(start).Round(time.Second)),
+	}
+	for window := firstLastOccurrenceWindow; ; window *= lastOccurrenceGrowth {
+		from := end.Add(-window)
+		if from.Before(start) {
+			from = start
+		}
+		report.Probes++
+		result, err := runLokiQuery(withQueryDirection(ctx, DirectionBackward), conn, query, from, end, 1)
+		if err != nil {
+			return report, err
+		}
+		if entries := sortedLogEntries(result); len(entries) > 0 {
+			last := entries[len(entries)-1]
+			report.Found, report.Timestamp, report.Labels, report.Line = true, last.Timestamp, last.Labels, last.Line
+			if last.NS != 0 {
+				report.Ago = now.Sub(time.Unix(0, last.NS)).Round(time.Second).String()
+			}
+			return report, nil
+		}
+		if !from.After(start) {
+			return report, nil
+		}
+	}
+}
+
+// formatLastOccurrence formats the last occurrence report into a readable string
+func formatLastOccurrence(report lastOccurrenceReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		if !report.Found {
+			return fmt.Sprintf("Not seen in the last %s: no lines matching %s between %s and %s\n",
+				report.Window, report.Query, report.Start, report.End), nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Last seen %s ago at %s: line matching %s\n", report.Ago, report.Timestamp, report.Query)
+		fmt.Fprintf(&b, "%s %s\n", formatStreamLabels(report.Labels), report.Line)
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
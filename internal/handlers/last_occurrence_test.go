@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFindLastOccurrence tests searching growing windows for the newest matching line
+func TestFindLastOccurrence(t *testing.T) {
+	end := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-24 * time.Hour)
+	last := end.Add(-2 * time.Hour)
+	fake := &timedLokiClient{times: []time.Time{last.Add(-time.Hour), last}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	report, err := findLastOccurrence(context.Background(), LokiConnection{}, `{app="api"} |= "error"`, start, end, end)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	// The 15m and 1h windows are empty, the 4h window has the match
+	if !report.Found || report.Timestamp != "2024-01-31T10:00:00Z" || report.Ago != "2h0m0s" || report.Probes != 3 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	text, err := formatLastOccurrence(report, "text")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.HasPrefix(text, `Last seen 2h0m0s ago at 2024-01-31T10:00:00Z: line matching {app="api"} |= "error"`) {
+		t.Errorf("Unexpected text: %s", text)
+	}
+
+	// Without a match the whole range is searched, ending at its start
+	fake.times = []time.Time{start.Add(-time.Minute)}
+	report, err = findLastOccurrence(context.Background(), LokiConnection{}, `{app="api"} |= "error"`, start, end, end)
+	if err != nil || report.Found || report.Probes != 5 {
+		t.Errorf("Expected no match after 5 queries, but got %+v, %v", report, err)
+	}
+	if text, _ := formatLastOccurrence(report, "raw"); !strings.HasPrefix(text, `Not seen in the last 24h: no lines matching {app="api"} |= "error"`) {
+		t.Errorf("Unexpected text: %s", text)
+	}
+}
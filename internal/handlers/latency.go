@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// latencyStats summarizes the numeric values extracted from log lines
+type latencyStats struct {
+	Query   string  `json:"query"`
+	Field   string  `json:"field"`
+	Unit    string  `json:"unit,omitempty"`
+	Lines   int     `json:"lines"`
+	Count   int     `json:"count"`
+	Skipped int     `json:"skipped"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Avg     float64 `json:"avg"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	LogQL   string  `json:"equivalent_logql,omitempty"`
+}
+
+// fieldExtractor pulls a numeric value out of a log line
+type fieldExtractor struct {
+	parser string         // "json", "logfmt" or "regex"
+	field  string         // field name for json and logfmt
+	re     *regexp.Regexp // pattern with a capture group for regex
+}
+
+// NewLokiLatencyStatsTool creates and returns a tool for computing percentiles of a numeric log field
+func NewLokiLatencyStatsTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Extract a numeric field (such as a request duration) from matching log lines and compute " +
+			"min/max/avg/p50/p95/p99. Values can be extracted from JSON or logfmt fields, or with a regular expression " +
+			"capture group. Duration values such as 12ms or 1.5s are converted to milliseconds."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL log query selecting the lines, e.g. {app=\"nginx\"} |= \"GET /api\""),
+		),
+		mcp.WithString("parser",
+			mcp.Required(),
+			mcp.Description("How to extract the value: json, logfmt, or regex"),
+			mcp.Enum("json", "logfmt", "regex"),
+		),
+		mcp.WithString("field",
+			mcp.Description("Field name for json (dotted paths allowed) and logfmt parsers, e.g. duration_ms"),
+		),
+		mcp.WithString("pattern",
+			mcp.Description("Regular expression with one capture group for the regex parser, e.g. took=(\\S+)"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of lines to sample (default: 5000)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_latency_stats", opts...)
+}
+
+// HandleLokiLatencyStats handles Loki latency stats tool requests
+func HandleLokiLatencyStats(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	query, _ := args["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	parser, _ := args["parser"].(string)
+	field, _ := args["field"].(string)
+	pattern, _ := args["pattern"].(string)
+	extractor, err := newFieldExtractor(parser, field, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := parseTimeRange(args, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := 5000
+	if limitVal, ok := args["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	format := formatArg(args)
+
+	conn := ResolveLokiConnection(args)
+	result, err := runLokiQuery(ctx, conn, query, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := extractor.stats(result)
+	stats.Query = query
+	stats.LogQL = extractor.unwrapQuery(query, end.Sub(start))
+
+	formattedResult, err := formatLatencyStats(stats, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// newFieldExtractor validates the extraction parameters
+func newFieldExtractor(parser, field, pattern string) (*fieldExtractor, error) {
+	switch parser {
+	case "json", "logfmt":
+		if field == "" {
+			return nil, fmt.Errorf("field is required for the %s parser", parser)
+		}
+		return &fieldExtractor{parser: parser, field: field}, nil
+	case "regex":
+		if pattern == "" {
+			return nil, fmt.Errorf("pattern is required for the regex parser")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("pattern must contain a capture group")
+		}
+		return &fieldExtractor{parser: parser, field: pattern, re: re}, nil
+	default:
+		return nil, fmt.Errorf("unsupported parser: %s. Supported parsers: json, logfmt, regex", parser)
+	}
+}
+
+// extract returns the raw value of the field in a log line
+func (e *fieldExtractor) extract(line string) (any, bool) {
+	switch e.parser {
+	case "json":
+		var parsed map[string]any
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			return nil, false
+		}
+		return lookupJSONField(parsed, e.field)
+	case "logfmt":
+		fields, err := parseLogfmt(line)
+		if err != nil {
+			return nil, false
+		}
+		for _, f := range fields {
+			if f.Key == e.field {
+				return f.Value, true
+			}
+		}
+	case "regex":
+		if m := e.re.FindStringSubmatch(line); m != nil {
+			return m[1], true
+		}
+	}
+	return nil, false
+}
+
+// stats extracts values from every line of a result and summarizes them
+func (e *fieldExtractor) stats(result *LokiResult) latencyStats {
+	stats := latencyStats{Field: e.field}
+	var values []float64
+	durations := 0
+
+	for _, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			stats.Lines++
+			raw, ok := e.extract(val[1])
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			value, isDuration, ok := parseNumericValue(raw)
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			if isDuration {
+				durations++
+			}
+			values = append(values, value)
+		}
+	}
+
+	stats.Count = len(values)
+	if durations > 0 {
+		stats.Unit = "ms"
+	}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sort.Float64s(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	stats.Min = values[0]
+	stats.Max = values[len(values)-1]
+	stats.Avg = sum / float64(len(values))
+	stats.P50 = percentile(values, 0.50)
+	stats.P95 = percentile(values, 0.95)
+	stats.P99 = percentile(values, 0.99)
+	return stats
+}
+
+// unwrapQuery returns the equivalent LogQL metric query computing p95 server-side,
+// or an empty string when the value cannot be unwrapped by Loki
+func (e *fieldExtractor) unwrapQuery(query string, window time.Duration) string {
+	if e.parser == "regex" {
+		return ""
+	}
+	spec := unwrapQuerySpec{
+		Selector: query,
+		Function: "quantile_over_time",
+		Quantile: 0.95,
+		Parser:   e.parser,
+		Field:    invalidLabelChars.ReplaceAllString(e.field, "_"),
+		Range:    window.Round(time.Second),
+	}
+	logql, err := spec.build()
+	if err != nil {
+		return ""
+	}
+	return logql
+}
+
+// parseNumericValue converts an extracted value to a number. Duration strings such as
+// 12ms or 1.5s are converted to milliseconds and reported as durations.
+func parseNumericValue(raw any) (float64, bool, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, false, true
+	case string:
+		s := strings.TrimSpace(v)
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, false, true
+		}
+		if d, err := time.ParseDuration(s); err == nil {
+			return float64(d) / float64(time.Millisecond), true, true
+		}
+	}
+	return 0, false, false
+}
+
+// percentile returns the p-th quantile of sorted values using linear interpolation
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// formatLatencyStats formats the latency statistics into a readable string
+func formatLatencyStats(stats latencyStats, format string) (string, error) {
+	if stats.Count == 0 && format != "json" {
+		return fmt.Sprintf("No numeric values found for %s in %d matching lines", stats.Field, stats.Lines), nil
+	}
+
+	unit := ""
+	if stats.Unit != "" {
+		unit = " " + stats.Unit
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		return fmt.Sprintf("count=%d min=%g max=%g avg=%.3f p50=%g p95=%g p99=%g%s\n",
+			stats.Count, stats.Min, stats.Max, stats.Avg, stats.P50, stats.P95, stats.P99, unit), nil
+
+	case "text":
+		output := fmt.Sprintf("Statistics for %s over %d values (%d of %d lines skipped):\n\n",
+			stats.Field, stats.Count, stats.Skipped, stats.Lines)
+		output += fmt.Sprintf("  min: %g%s\n  max: %g%s\n  avg: %.3f%s\n", stats.Min, unit, stats.Max, unit, stats.Avg, unit)
+		output += fmt.Sprintf("  p50: %g%s\n  p95: %g%s\n  p99: %g%s\n", stats.P50, unit, stats.P95, unit, stats.P99, unit)
+		if stats.LogQL != "" {
+			output += fmt.Sprintf("\nEquivalent server-side query:\n  %s\n", stats.LogQL)
+		}
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
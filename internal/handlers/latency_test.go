@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFieldExtractor_Stats tests value extraction and percentile computation for each parser
+func TestFieldExtractor_Stats(t *testing.T) {
+	testCases := []struct {
+		name    string
+		parser  string
+		field   string
+		pattern string
+		lines   []string
+		unit    string
+	}{
+		{
+			name:   "JSON",
+			parser: "json",
+			field:  "http.duration",
+			lines:  []string{`{"http":{"duration":10}}`, `{"http":{"duration":20}}`, `{"http":{"duration":30}}`, `{"msg":"no field"}`},
+		},
+		{
+			name:   "Logfmt durations",
+			parser: "logfmt",
+			field:  "took",
+			lines:  []string{`took=10ms`, `took=0.02s`, `took=30ms`, `msg=missing`},
+			unit:   "ms",
+		},
+		{
+			name:    "Regex",
+			parser:  "regex",
+			pattern: `rt=(\d+)`,
+			lines:   []string{`GET / rt=10`, `GET / rt=20`, `GET / rt=30`, `GET / no timing`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			extractor, err := newFieldExtractor(tc.parser, tc.field, tc.pattern)
+			if err != nil {
+				t.Fatalf("newFieldExtractor failed: %v", err)
+			}
+
+			values := make([][]string, 0, len(tc.lines))
+			for _, line := range tc.lines {
+				values = append(values, []string{"1", line})
+			}
+			stats := extractor.stats(&LokiResult{Data: LokiData{Result: []LokiEntry{{Values: values}}}})
+
+			if stats.Count != 3 || stats.Skipped != 1 {
+				t.Errorf("Expected 3 values and 1 skipped, but got %d and %d", stats.Count, stats.Skipped)
+			}
+			if stats.Min != 10 || stats.Max != 30 || stats.Avg != 20 || stats.P50 != 20 {
+				t.Errorf("Unexpected stats: %+v", stats)
+			}
+			if stats.Unit != tc.unit {
+				t.Errorf("Expected unit %q, but got %q", tc.unit, stats.Unit)
+			}
+		})
+	}
+}
+
+// TestPercentile tests linear interpolation between ranks
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if p := percentile(values, 0.5); p != 5.5 {
+		t.Errorf("Expected p50 5.5, but got %v", p)
+	}
+	if p := percentile(values, 0.95); p < 9.54 || p > 9.56 {
+		t.Errorf("Expected p95 9.55, but got %v", p)
+	}
+	if p := percentile([]float64{42}, 0.99); p != 42 {
+		t.Errorf("Expected single value, but got %v", p)
+	}
+}
+
+// TestNewFieldExtractor_Invalid tests validation of extraction parameters
+func TestNewFieldExtractor_Invalid(t *testing.T) {
+	if _, err := newFieldExtractor("json", "", ""); err == nil {
+		t.Error("Expected error for missing field")
+	}
+	if _, err := newFieldExtractor("regex", "", `rt=\d+`); err == nil {
+		t.Error("Expected error for pattern without capture group")
+	}
+	if _, err := newFieldExtractor("xml", "a", ""); err == nil {
+		t.Error("Expected error for unsupported parser")
+	}
+}
+
+// TestFieldExtractor_UnwrapQuery tests generation of the equivalent server-side query
+func TestFieldExtractor_UnwrapQuery(t *testing.T) {
+	extractor, _ := newFieldExtractor("json", "http.duration", "")
+	expected := `quantile_over_time(0.95, {app="api"} | json | unwrap http_duration | __error__="" [1h])`
+	if query := extractor.unwrapQuery(`{app="api"}`, time.Hour); query != expected {
+		t.Errorf("Expected %s, but got %s", expected, query)
+	}
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// limitDescriptions explains the per-tenant limits most relevant to querying, in display order
+var limitDescriptions = []struct {
+	Name        string
+	Description string
+}{
+	{"max_query_length", "Widest time range a single query may cover"},
+	{"max_query_lookback", "How far back queries may reach"},
+	{"max_query_range", "Widest range of a range vector in metric queries, e.g. [1h]"},
+	{"max_entries_limit_per_query", "Maximum log lines a query may return"},
+	{"max_query_series", "Maximum series a metric query may return"},
+	{"max_query_parallelism", "Maximum subqueries run in parallel for a query"},
+	{"split_queries_by_interval", "Interval queries are split into before being run in parallel"},
+	{"query_timeout", "Time after which a query is cancelled"},
+	{"max_query_bytes_read", "Maximum bytes a query may read"},
+	{"max_querier_bytes_read", "Maximum bytes a subquery may read"},
+	{"max_chunks_per_query", "Maximum chunks a query may fetch"},
+	{"max_streams_matchers_per_query", "Maximum stream matchers per query"},
+	{"retention_period", "How long logs are kept before deletion"},
+	{"reject_old_samples_max_age", "Oldest age of logs accepted at ingestion"},
+	{"max_line_size", "Maximum size of a log line"},
+	{"ingestion_rate_mb", "Per-tenant ingestion rate limit in MB/s"},
+	{"ingestion_burst_size_mb", "Per-tenant ingestion burst size in MB"},
+	{"max_global_streams_per_user", "Maximum active streams per tenant"},
+	{"volume_enabled", "Whether the volume endpoints are enabled"},
+}
+
+// tenantLimit is a limit as it applies to a tenant
+type tenantLimit struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Default     string `json:"default,omitempty"` // the global value, when overridden for the tenant
+	Overridden  bool   `json:"overridden"`
+	Description string `json:"description,omitempty"`
+}
+
+// limitsReport lists the limits applying to a tenant
+type limitsReport struct {
+	Tenant             string        `json:"tenant,omitempty"`
+	Limits             []tenantLimit `json:"limits"`
+	ConfigError        string        `json:"config_error,omitempty"`
+	RuntimeConfigError string        `json:"runtime_config_error,omitempty"`
+}
+
+// yamlEntry is a scalar value in a YAML document with the path of keys leading to it
+type yamlEntry struct {
+	Path  []string
+	Value string
+}
+
+// NewLokiLimitsTool creates and returns a tool for reporting the limits Loki applies to a tenant
+func NewLokiLimitsTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Report the limits Loki applies to queries for a tenant, such as the maximum query length, " +
+			"maximum entries per query and retention period, read from Loki's /config and /runtime_config endpoints " +
+			"with per-tenant overrides applied. Use this to explain why a query was rejected and how to adapt it."),
+		mcp.WithBoolean("all",
+			mcp.Description("Include every limit in limits_config rather than only those relevant to querying (default: false)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_limits", opts...)
+}
+
+// HandleLokiLimits handles Loki limits tool requests
+func HandleLokiLimits(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	all, _ := args["all"].(bool)
+	format := formatArg(args)
+	conn := ResolveLokiConnection(args)
+	if err := requireLokiBackend(conn, "loki_limits"); err != nil {
+		return nil, err
+	}
+
+	report := limitsReport{Tenant: conn.OrgID}
+
+	config, runtimeConfig, configErr, runtimeErr := fetchLokiConfig(ctx, conn)
+	if errors.Is(configErr, errDryRun) {
+		return nil, configErr
+	}
+	if configErr != nil && runtimeErr != nil {
+		return nil, fmt.Errorf("failed to read Loki's configuration: /config: %v; /runtime_config: %v", configErr, runtimeErr)
+	}
+	if configErr != nil {
+		report.ConfigError = configErr.Error()
+	}
+	if runtimeErr != nil {
+		report.RuntimeConfigError = runtimeErr.Error()
+	}
+
+	report.Limits = tenantLimits(config, runtimeConfig, conn.OrgID, all)
+
+	formattedResult, err := formatLimits(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// fetchLokiConfig reads Loki's /config and /runtime_config endpoints, returning the error for each separately
+// since either may be disabled or protected in a deployment
+func fetchLokiConfig(ctx context.Context, conn LokiConnection) (config, runtimeConfig []yamlEntry, configErr, runtimeErr error) {
+	if conn.err != nil {
+		return nil, nil, conn.err, conn.err
+	}
+	fetch := func(endpoint string) ([]yamlEntry, error) {
+		configURL, err := buildLokiRootURL(conn.URL, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		body, err := executeLokiRequest(ctx, configURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		return parseYAMLScalars(string(body)), nil
+	}
+
+	config, configErr = fetch("config")
+	if errors.Is(configErr, errDryRun) {
+		return nil, nil, configErr, configErr
+	}
+	runtimeConfig, runtimeErr = fetch("runtime_config")
+	return config, runtimeConfig, configErr, runtimeErr
+}
+
+// tenantLimits combines the global limits_config with the tenant's runtime overrides
+func tenantLimits(config, runtimeConfig []yamlEntry, tenant string, all bool) []tenantLimit {
+	defaults := make(map[string]string)
+	var names []string
+	for _, entry := range config {
+		if len(entry.Path) == 2 && entry.Path[0] == "limits_config" {
+			defaults[entry.Path[1]] = entry.Value
+			names = append(names, entry.Path[1])
+		}
+	}
+	overrides := make(map[string]string)
+	for _, entry := range runtimeConfig {
+		if len(entry.Path) == 3 && entry.Path[0] == "overrides" && entry.Path[1] == tenant && tenant != "" {
+			overrides[entry.Path[2]] = entry.Value
+			if _, ok := defaults[entry.Path[2]]; !ok {
+				names = append(names, entry.Path[2])
+			}
+		}
+	}
+
+	descriptions := make(map[string]string)
+	if !all {
+		names = nil
+	}
+	for _, d := range limitDescriptions {
+		descriptions[d.Name] = d.Description
+		if !all {
+			names = append(names, d.Name)
+		}
+	}
+
+	var limits []tenantLimit
+	for _, name := range names {
+		value, hasDefault := defaults[name]
+		override, hasOverride := overrides[name]
+		if !hasDefault && !hasOverride {
+			continue
+		}
+		limit := tenantLimit{Name: name, Value: value, Description: descriptions[name]}
+		if hasOverride && override != value {
+			limit.Value = override
+			limit.Default = value
+			limit.Overridden = true
+		}
+		limits = append(limits, limit)
+	}
+	return limits
+}
+
+// buildLokiRootURL constructs the URL of a Loki endpoint that lives outside the API path, such as /config
+func buildLokiRootURL(baseURL, endpoint string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if i := strings.Index(u.Path, "/loki/api/v1"); i >= 0 {
+		u.Path = u.Path[:i]
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + endpoint
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// parseYAMLScalars extracts the scalar values of a block-style YAML document, as served by
+// Loki's /config and /runtime_config endpoints. Sequences are skipped.
+func parseYAMLScalars(doc string) []yamlEntry {
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	var entries []yamlEntry
+	sequenceIndent := -1
+
+	for _, line := range strings.Split(doc, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		// Skip sequence items and everything nested in them
+		if sequenceIndent >= 0 && (indent > sequenceIndent || (indent == sequenceIndent && strings.HasPrefix(trimmed, "-"))) {
+			continue
+		}
+		sequenceIndent = -1
+		if strings.HasPrefix(trimmed, "-") {
+			sequenceIndent = indent
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		key = unquoteYAML(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if value == "" {
+			stack = append(stack, level{indent: indent, key: key})
+			continue
+		}
+
+		path := make([]string, 0, len(stack)+1)
+		for _, l := range stack {
+			path = append(path, l.key)
+		}
+		entries = append(entries, yamlEntry{Path: append(path, key), Value: unquoteYAML(value)})
+	}
+	return entries
+}
+
+// unquoteYAML removes the quotes around a quoted YAML scalar
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// formatLimits formats the limits report into a readable string
+func formatLimits(report limitsReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, l := range report.Limits {
+			fmt.Fprintf(&b, "%s %s", l.Name, l.Value)
+			if l.Overridden {
+				fmt.Fprintf(&b, " (default %s)", l.Default)
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	case "text":
+		var b strings.Builder
+		if report.Tenant != "" {
+			fmt.Fprintf(&b, "Limits for tenant %s:\n", report.Tenant)
+		} else {
+			b.WriteString("Limits:\n")
+		}
+		if len(report.Limits) == 0 {
+			b.WriteString("  No limits found in Loki's configuration\n")
+		}
+		for _, l := range report.Limits {
+			fmt.Fprintf(&b, "  %s: %s", l.Name, l.Value)
+			if l.Overridden {
+				fmt.Fprintf(&b, " (overridden for this tenant, default %s)", l.Default)
+			}
+			if l.Description != "" {
+				fmt.Fprintf(&b, "\n    %s", l.Description)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("A value of 0 usually means the limit is disabled.\n")
+		if report.ConfigError != "" {
+			fmt.Fprintf(&b, "Could not read /config: %s\n", report.ConfigError)
+		}
+		if report.RuntimeConfigError != "" {
+			fmt.Fprintf(&b, "Could not read /runtime_config, so per-tenant overrides are not shown: %s\n", report.RuntimeConfigError)
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const testLokiConfig = `target: all
+server:
+  http_listen_port: 3100
+limits_config:
+  max_query_length: 721h
+  max_entries_limit_per_query: 5000
+  retention_period: 744h
+  retention_stream:
+  - selector: '{namespace="dev"}'
+    priority: 1
+    period: 24h
+  query_timeout: 1m
+  max_line_size: 256KB
+`
+
+const testLokiRuntimeConfig = `overrides:
+  "tenant-a":
+    max_entries_limit_per_query: 100
+    max_query_length: 721h
+  tenant-b:
+    retention_period: 24h
+`
+
+// TestParseYAMLScalars tests flattening Loki's YAML configuration
+func TestParseYAMLScalars(t *testing.T) {
+	entries := parseYAMLScalars(testLokiConfig)
+	values := make(map[string]string)
+	for _, entry := range entries {
+		values[strings.Join(entry.Path, ".")] = entry.Value
+	}
+
+	expected := map[string]string{
+		"target":                                    "all",
+		"server.http_listen_port":                   "3100",
+		"limits_config.max_query_length":            "721h",
+		"limits_config.max_entries_limit_per_query": "5000",
+		"limits_config.query_timeout":               "1m",
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected %s to be %s, but got %q", key, value, values[key])
+		}
+	}
+	if _, ok := values["limits_config.retention_stream.priority"]; ok {
+		t.Error("Expected sequence items to be skipped")
+	}
+	if len(entries) != 7 {
+		t.Errorf("Expected 7 entries, but got %d: %v", len(entries), entries)
+	}
+}
+
+// TestTenantLimits tests applying runtime overrides for a tenant
+func TestTenantLimits(t *testing.T) {
+	config, runtimeConfig := parseYAMLScalars(testLokiConfig), parseYAMLScalars(testLokiRuntimeConfig)
+
+	limits := tenantLimits(config, runtimeConfig, "tenant-a", false)
+	if len(limits) != 5 || limits[0].Name != "max_query_length" {
+		t.Fatalf("Expected the 5 configured query limits in display order, but got %+v", limits)
+	}
+	for _, limit := range limits {
+		switch limit.Name {
+		case "max_entries_limit_per_query":
+			if limit.Value != "100" || limit.Default != "5000" || !limit.Overridden {
+				t.Errorf("Expected an override of 100, but got %+v", limit)
+			}
+		case "max_query_length":
+			if limit.Overridden {
+				t.Errorf("Expected an override with the default value not to be reported, but got %+v", limit)
+			}
+		}
+	}
+
+	// Every limit, in configuration order
+	limits = tenantLimits(config, runtimeConfig, "tenant-b", true)
+	if len(limits) != 5 || limits[2].Name != "retention_period" || limits[2].Value != "24h" {
+		t.Errorf("Unexpected limits for tenant-b: %+v", limits)
+	}
+}
+
+// TestHandleLokiLimits tests reading the configuration from Loki
+func TestHandleLokiLimits(t *testing.T) {
+	var orgIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgIDs = append(orgIDs, r.Header.Get("X-Scope-OrgID"))
+		switch r.URL.Path {
+		case "/config":
+			w.Write([]byte(testLokiConfig))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"url": server.URL + "/loki/api/v1", "org": "tenant-a", "format": "json"}
+	result, err := HandleLokiLimits(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var report limitsReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if report.Tenant != "tenant-a" || len(report.Limits) != 5 || report.RuntimeConfigError == "" {
+		t.Errorf("Expected the global limits and a runtime config error, but got %+v", report)
+	}
+	if len(orgIDs) != 2 || orgIDs[0] != "tenant-a" {
+		t.Errorf("Expected both endpoints to be requested for the tenant, but got %v", orgIDs)
+	}
+
+	request.Params.Arguments = map[string]any{"url": server.URL + "/missing"}
+	server.Config.Handler = http.NotFoundHandler()
+	if _, err := HandleLokiLimits(context.Background(), request); err == nil {
+		t.Error("Expected an error when neither endpoint is accessible")
+	}
+}
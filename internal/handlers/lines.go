@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Marker wrapped around highlighted terms in log lines
+const highlightMarker = "**"
+
+// lineOptions controls how individual log lines are rendered before formatting
+type lineOptions struct {
+	Parse         string         // parser applied to each line: "", "json" or "logfmt"
+	Fields        []string       // fields to keep when parsing, all fields when empty
+	Highlight     *regexp.Regexp // terms to wrap in highlight markers, nil for none
+	MaxLineLength int            // maximum characters per line, 0 for no limit
+	StripANSI     bool           // remove ANSI escape sequences such as colors
+}
+
+// ansiEscapePattern matches ANSI CSI sequences (colors, cursor movement) and OSC sequences (titles, links)
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// lineFilterPattern matches positive line filters such as |= "timeout" or |~ `5\d\d`
+var lineFilterPattern = regexp.MustCompile("(\\|=|\\|~)\\s*(\"(?:[^\"\\\\]|\\\\.)*\"|`[^`]*`)")
+
+// parseLineOptions extracts the line rendering options from tool arguments
+func parseLineOptions(args map[string]any) (lineOptions, error) {
+	var opts lineOptions
+
+	if parse, ok := args["parse"].(string); ok && parse != "" {
+		switch parse {
+		case "json", "logfmt":
+			opts.Parse = parse
+		default:
+			return opts, fmt.Errorf("unsupported parser: %s. Supported parsers: json, logfmt", parse)
+		}
+	}
+
+	if fields, ok := args["fields"].(string); ok && fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				opts.Fields = append(opts.Fields, field)
+			}
+		}
+	}
+
+	if maxLen, ok := args["max_line_length"].(float64); ok {
+		if maxLen < 0 {
+			return opts, fmt.Errorf("max_line_length must not be negative")
+		}
+		opts.MaxLineLength = int(maxLen)
+	}
+
+	if stripANSI, ok := args["strip_ansi"].(bool); ok {
+		opts.StripANSI = stripANSI
+	}
+
+	// Highlight explicit terms, or the query's line filters when none are given, except in
+	// compact mode where the markers would cost tokens
+	highlight, _ := args["highlight"].(string)
+	switch highlight {
+	case "none":
+	case "":
+		if compactRequested(args) {
+			break
+		}
+		query, _ := args["query"].(string)
+		opts.Highlight = compileHighlight(lineFilterTerms(query))
+	default:
+		var patterns []string
+		for _, term := range strings.Split(highlight, ",") {
+			if term = strings.TrimSpace(term); term != "" {
+				patterns = append(patterns, regexp.QuoteMeta(term))
+			}
+		}
+		opts.Highlight = compileHighlight(patterns)
+	}
+
+	return opts, nil
+}
+
+// apply rewrites the log lines of a result in place according to the options.
+// Lines are always sanitized so that invalid UTF-8, control characters and
+// binary data never reach the tool response raw.
+func (o lineOptions) apply(result *LokiResult) {
+	for _, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			if o.StripANSI {
+				val[1] = ansiEscapePattern.ReplaceAllString(val[1], "")
+			}
+			val[1] = sanitizeLine(val[1])
+			if o.Parse != "" {
+				val[1] = prettyPrintLine(val[1], o.Parse, o.Fields)
+			}
+			if o.MaxLineLength > 0 {
+				val[1] = truncateLine(val[1], o.MaxLineLength)
+			}
+			if o.Highlight != nil {
+				val[1] = highlightLine(val[1], o.Highlight)
+			}
+		}
+	}
+}
+
+// lineFilterTerms returns regular expressions for the positive line filters in a LogQL query
+func lineFilterTerms(query string) []string {
+	var patterns []string
+	for _, m := range lineFilterPattern.FindAllStringSubmatch(query, -1) {
+		op, quoted := m[1], m[2]
+
+		var value string
+		if strings.HasPrefix(quoted, "`") {
+			value = quoted[1 : len(quoted)-1]
+		} else {
+			unquoted, err := strconv.Unquote(quoted)
+			if err != nil {
+				continue
+			}
+			value = unquoted
+		}
+		if value == "" {
+			continue
+		}
+
+		if op == "|~" {
+			patterns = append(patterns, value)
+		} else {
+			patterns = append(patterns, regexp.QuoteMeta(value))
+		}
+	}
+	return patterns
+}
+
+// compileHighlight combines patterns into a single expression, skipping invalid ones
+func compileHighlight(patterns []string) *regexp.Regexp {
+	var valid []string
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err == nil {
+			valid = append(valid, "(?:"+p+")")
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(strings.Join(valid, "|"))
+}
+
+// highlightLine wraps every non-empty match of re in highlight markers
+func highlightLine(line string, re *regexp.Regexp) string {
+	return re.ReplaceAllStringFunc(line, func(match string) string {
+		if match == "" {
+			return match
+		}
+		return highlightMarker + match + highlightMarker
+	})
+}
+
+// truncateLine shortens a line to at most maxLen characters, appending an ellipsis
+// and the number of bytes that were cut off
+func truncateLine(line string, maxLen int) string {
+	if utf8.RuneCountInString(line) <= maxLen {
+		return line
+	}
+
+	cut := 0
+	for i := range line {
+		if maxLen == 0 {
+			cut = i
+			break
+		}
+		maxLen--
+	}
+	return fmt.Sprintf("%s… [+%d bytes]", line[:cut], len(line)-cut)
+}
+
+// sanitizeLine replaces invalid UTF-8 sequences and escapes control characters other
+// than newlines and tabs. Lines that look like binary data are replaced by a placeholder.
+func sanitizeLine(line string) string {
+	if isBinaryLine(line) {
+		return fmt.Sprintf("[binary data omitted: %d bytes]", len(line))
+	}
+
+	clean := true
+	for _, r := range line {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\t') {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return line
+	}
+
+	// Ranging over the string yields utf8.RuneError for each invalid byte,
+	// which is written back out as the U+FFFD replacement character
+	var b strings.Builder
+	for _, r := range line {
+		switch {
+		case unicode.IsControl(r) && r != '\n' && r != '\t':
+			if r < 0x100 {
+				fmt.Fprintf(&b, "\\x%02x", r)
+			} else {
+				fmt.Fprintf(&b, "\\u%04x", r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isBinaryLine reports whether a line looks like binary data rather than text:
+// it contains NUL bytes or more than 10% invalid UTF-8 or control characters
+func isBinaryLine(line string) bool {
+	if strings.IndexByte(line, 0) >= 0 {
+		return true
+	}
+
+	total, suspicious := 0, 0
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if (r == utf8.RuneError && size == 1) || (unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r' && r != 0x1b) {
+			suspicious++
+		}
+		total++
+		i += size
+	}
+	return total > 0 && suspicious*10 > total
+}
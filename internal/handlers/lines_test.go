@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// TestLineFilterTerms tests extraction of positive line filters from LogQL queries
+func TestLineFilterTerms(t *testing.T) {
+	terms := lineFilterTerms(`{app="api"} |= "time.out" != "debug" |~ ` + "`5\\d\\d`" + ` | json`)
+	if len(terms) != 2 {
+		t.Fatalf("Expected 2 terms, but got %d: %v", len(terms), terms)
+	}
+	if terms[0] != `time\.out` {
+		t.Errorf("Expected literal filter to be escaped, but got %s", terms[0])
+	}
+	if terms[1] != `5\d\d` {
+		t.Errorf("Expected regex filter to be kept, but got %s", terms[1])
+	}
+}
+
+// TestParseLineOptions_Highlight tests explicit, automatic, and disabled highlighting
+func TestParseLineOptions_Highlight(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     map[string]any
+		line     string
+		expected string
+	}{
+		{
+			name:     "From query filter",
+			args:     map[string]any{"query": `{app="api"} |= "timeout"`},
+			line:     "request timeout after 30s",
+			expected: "request **timeout** after 30s",
+		},
+		{
+			name:     "From regex filter",
+			args:     map[string]any{"query": `{app="api"} |~ "status=5\\d\\d"`},
+			line:     "GET /api status=503",
+			expected: "GET /api **status=503**",
+		},
+		{
+			name:     "Explicit terms",
+			args:     map[string]any{"query": `{app="api"} |= "timeout"`, "highlight": "GET, 503"},
+			line:     "GET /api status=503 timeout",
+			expected: "**GET** /api status=**503** timeout",
+		},
+		{
+			name:     "Disabled",
+			args:     map[string]any{"query": `{app="api"} |= "timeout"`, "highlight": "none"},
+			line:     "request timeout",
+			expected: "request timeout",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseLineOptions(tc.args)
+			if err != nil {
+				t.Fatalf("parseLineOptions failed: %v", err)
+			}
+
+			result := &LokiResult{Data: LokiData{Result: []LokiEntry{{Values: [][]string{{"1", tc.line}}}}}}
+			opts.apply(result)
+
+			if output := result.Data.Result[0].Values[0][1]; output != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+// TestParseLineOptions_InvalidParser tests that unknown parsers are rejected
+func TestParseLineOptions_InvalidParser(t *testing.T) {
+	if _, err := parseLineOptions(map[string]any{"parse": "xml"}); err == nil {
+		t.Error("Expected error for unsupported parser")
+	}
+}
+
+// TestTruncateLine tests truncation on character boundaries with a byte count indicator
+func TestTruncateLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		maxLen   int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"this line is too long", 9, "this line… [+12 bytes]"},
+		{"héllo wörld", 7, "héllo w… [+5 bytes]"},
+	}
+
+	for _, tc := range testCases {
+		if output := truncateLine(tc.line, tc.maxLen); output != tc.expected {
+			t.Errorf("truncateLine(%q, %d): expected %q, but got %q", tc.line, tc.maxLen, tc.expected, output)
+		}
+	}
+}
+
+// TestLineOptions_StripANSI tests removal of color codes and OSC sequences
+func TestLineOptions_StripANSI(t *testing.T) {
+	opts := lineOptions{StripANSI: true, MaxLineLength: 12}
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{{Values: [][]string{
+		{"1", "\x1b[31mERROR\x1b[0m \x1b[1;33mdisk\x1b[0m full"},
+		{"2", "\x1b]0;title\x07plain"},
+	}}}}}
+	opts.apply(result)
+
+	if output := result.Data.Result[0].Values[0][1]; output != "ERROR disk f… [+3 bytes]" {
+		t.Errorf("Unexpected output: %q", output)
+	}
+	if output := result.Data.Result[0].Values[1][1]; output != "plain" {
+		t.Errorf("Unexpected output: %q", output)
+	}
+}
+
+// TestSanitizeLine tests replacement of invalid UTF-8 and escaping of control characters
+func TestSanitizeLine(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"Clean line", "plain\ttext\nwith newline", "plain\ttext\nwith newline"},
+		{"Invalid UTF-8", "caf\xe9 au lait is tasty", "caf� au lait is tasty"},
+		{"Control characters", "bell\a and carriage\r return here", `bell\x07 and carriage\x0d return here`},
+		{"Escape sequence", "\x1b[31mred text in this line\x1b[0m", `\x1b[31mred text in this line\x1b[0m`},
+		{"NUL bytes", "abc\x00def", "[binary data omitted: 7 bytes]"},
+		{"Mostly binary", "\xff\xfe\x01\x02\x03ab", "[binary data omitted: 7 bytes]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if output := sanitizeLine(tc.line); output != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, output)
+			}
+		})
+	}
+}
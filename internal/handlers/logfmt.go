@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields rendered first in logfmt output, in this order
+var leadingLogfmtFields = []string{"level", "msg"}
+
+// formatLokiLogfmt renders query results as one logfmt line per entry, e.g.
+// ts=2024-01-15T10:00:00Z level=error msg="request failed" app=api. Lines that are JSON
+// or logfmt contribute their fields; other lines become the msg field. Stream labels
+// follow the line's fields, skipping any the line already contains.
+func formatLokiLogfmt(result *LokiResult) string {
+	var b strings.Builder
+	for _, entry := range sortedLogEntries(result) {
+		pairs := []logField{{Key: "ts", Value: entry.Timestamp}}
+		pairs = append(pairs, lineLogfmtFields(entry.Line)...)
+
+		seen := make(map[string]bool, len(pairs))
+		for _, p := range pairs {
+			seen[p.Key] = true
+		}
+		for _, name := range sortedKeys(entry.Labels) {
+			if !seen[name] {
+				pairs = append(pairs, logField{Key: name, Value: entry.Labels[name]})
+			}
+		}
+
+		for i, p := range pairs {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(p.Key)
+			b.WriteByte('=')
+			b.WriteString(quoteLogfmtValue(p.Value))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// lineLogfmtFields extracts the fields of a JSON or logfmt line with level and msg first,
+// falling back to the whole line as msg
+func lineLogfmtFields(line string) []logField {
+	var fields []logField
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(line), &obj); err == nil && len(obj) > 0 {
+		for _, key := range sortedKeys(obj) {
+			fields = append(fields, logField{Key: key, Value: renderJSONValue(obj[key])})
+		}
+	} else if parsed, err := parseLogfmt(line); err == nil && isKeyValueLine(parsed) {
+		fields = parsed
+	} else {
+		return []logField{{Key: "msg", Value: line}}
+	}
+
+	// Move the leading fields to the front, keeping the order of the others
+	sort.SliceStable(fields, func(i, j int) bool {
+		return leadingFieldRank(fields[i].Key) < leadingFieldRank(fields[j].Key)
+	})
+	return fields
+}
+
+// isKeyValueLine reports whether parsed logfmt fields all have values, telling
+// real logfmt lines apart from plain text split on spaces
+func isKeyValueLine(fields []logField) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	for _, f := range fields {
+		if f.Value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// leadingFieldRank orders level and msg before all other fields
+func leadingFieldRank(key string) int {
+	for i, leading := range leadingLogfmtFields {
+		if key == leading {
+			return i
+		}
+	}
+	return len(leadingLogfmtFields)
+}
+
+// quoteLogfmtValue quotes a value when it is empty or contains spaces, quotes or equals signs
+func quoteLogfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
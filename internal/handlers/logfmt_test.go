@@ -0,0 +1,37 @@
+package handlers
+
+import "testing"
+
+// TestFormatLokiLogfmt tests rendering entries as logfmt lines
+func TestFormatLokiLogfmt(t *testing.T) {
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{
+		{Stream: map[string]string{"app": "api", "level": "info"}, Values: [][]string{
+			{"1700000003000000000", `{"msg":"request failed","level":"error","status":500}`},
+			{"1700000001000000000", `took=3ms level=debug msg="cache hit"`},
+			{"1700000002000000000", `plain text line`},
+		}},
+	}}}
+
+	expected := `ts=2023-11-14T22:13:21Z level=debug msg="cache hit" took=3ms app=api` + "\n" +
+		`ts=2023-11-14T22:13:22Z msg="plain text line" app=api level=info` + "\n" +
+		`ts=2023-11-14T22:13:23Z level=error msg="request failed" status=500 app=api` + "\n"
+	if output := formatLokiLogfmt(result); output != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, output)
+	}
+}
+
+// TestQuoteLogfmtValue tests quoting of values with special characters
+func TestQuoteLogfmtValue(t *testing.T) {
+	testCases := map[string]string{
+		"plain":     "plain",
+		"":          `""`,
+		"two words": `"two words"`,
+		`say "hi"`:  `"say \"hi\""`,
+		"key=value": `"key=value"`,
+	}
+	for input, expected := range testCases {
+		if output := quoteLogfmtValue(input); output != expected {
+			t.Errorf("Expected %s for %q, but got %s", expected, input, output)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// quoteLogQLString returns a value as a double-quoted LogQL string literal. Loki unquotes strings
+// with Go's rules, so escaping quotes, backslashes and control characters the same way means no
+// value can end the literal early and inject matchers or pipeline stages.
+func quoteLogQLString(value string) string {
+	return strconv.Quote(value)
+}
+
+// quoteLogQLRegex returns a LogQL string literal for a regular expression matching a value literally
+func quoteLogQLRegex(value string) string {
+	return quoteLogQLString(regexp.QuoteMeta(value))
+}
+
+// logQLMatcher builds a label matcher or label filter such as app="api", rejecting label names and
+// operators that are not valid LogQL so that neither can be used to rewrite the query
+func logQLMatcher(label, op, value string) (string, error) {
+	if !labelNamePattern.MatchString(label) {
+		return "", fmt.Errorf("invalid label name: %s", label)
+	}
+	if _, ok := matcherDescriptions[op]; !ok {
+		return "", fmt.Errorf("invalid label matcher operator: %s", op)
+	}
+	return label + op + quoteLogQLString(value), nil
+}
+
+// logQLRegexAlternation builds a regular expression matching any of the values literally
+func logQLRegexAlternation(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = regexp.QuoteMeta(value)
+	}
+	return strings.Join(quoted, "|")
+}
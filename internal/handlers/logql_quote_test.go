@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Values that would end a naively quoted string and rewrite the query
+var logQLInjectionValues = []string{
+	"",
+	"api",
+	`api"} | line_format "{{.password}}"`,
+	`api", app=~".+`,
+	`api\`,
+	`api\"`,
+	`\\"} or vector(1) #`,
+	"api`} |= `x",
+	"line\nbreak\r\ttab",
+	"nul\x00byte",
+	"bell\a and escape \x1b[31m",
+	"invalid utf-8 \xff\xfe",
+	"unicode ✓ ü 日本",
+	"{{.}} | json | __error__=\"\"",
+	`.*+?()[]{}|^$`,
+}
+
+// parseTestMatcher tokenizes a selector with a single matcher and returns its operator and unquoted value
+func parseTestMatcher(t *testing.T, selector string) (string, string) {
+	t.Helper()
+	tokens, err := tokenizeLogQL(selector)
+	if err != nil {
+		t.Fatalf("Expected %s to tokenize, but got %v", selector, err)
+	}
+	if len(tokens) != 5 || tokens[0].text != "{" || tokens[1].kind != "ident" || tokens[3].kind != "string" || tokens[4].text != "}" {
+		t.Fatalf("Expected exactly one matcher in %s, but got tokens %+v", selector, tokens)
+	}
+	unquoted, err := strconv.Unquote(tokens[3].text)
+	if err != nil {
+		t.Fatalf("Expected a valid string literal in %s, but got %v", selector, err)
+	}
+	return tokens[2].text, unquoted
+}
+
+// TestQuoteLogQLString tests that every value stays inside one string literal and round-trips
+func TestQuoteLogQLString(t *testing.T) {
+	for _, value := range logQLInjectionValues {
+		op, unquoted := parseTestMatcher(t, "{pod="+quoteLogQLString(value)+"}")
+		if op != "=" || unquoted != value {
+			t.Errorf("Expected %q to round-trip, but got %s %q", value, op, unquoted)
+		}
+	}
+}
+
+// TestQuoteLogQLRegex tests that regex literals match exactly the original value
+func TestQuoteLogQLRegex(t *testing.T) {
+	for _, value := range logQLInjectionValues {
+		_, unquoted := parseTestMatcher(t, "{pod=~"+quoteLogQLRegex(value)+"}")
+		if !utf8.ValidString(value) {
+			// Regular expressions match runes, so such values are quoted safely but cannot match
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + unquoted + ")$")
+		if err != nil {
+			t.Fatalf("Expected a valid regex for %q, but got %v", value, err)
+		}
+		if !re.MatchString(value) {
+			t.Errorf("Expected the regex for %q to match it", value)
+		}
+		if value != "" && re.MatchString(value+"x") {
+			t.Errorf("Expected the regex for %q to match only it", value)
+		}
+	}
+
+	re := regexp.MustCompile("^(?:" + logQLRegexAlternation([]string{"a.b", "c|d"}) + ")$")
+	for value, expected := range map[string]bool{"a.b": true, "c|d": true, "axb": false, "c": false, "d": false} {
+		if re.MatchString(value) != expected {
+			t.Errorf("Alternation match of %q: expected %v", value, expected)
+		}
+	}
+}
+
+// TestLogQLMatcher tests rejecting invalid label names and operators
+func TestLogQLMatcher(t *testing.T) {
+	for _, value := range logQLInjectionValues {
+		matcher, err := logQLMatcher("pod", "!=", value)
+		if err != nil {
+			t.Fatalf("Expected no error for %q, but got %v", value, err)
+		}
+		if op, unquoted := parseTestMatcher(t, "{"+matcher+"}"); op != "!=" || unquoted != value {
+			t.Errorf("Expected %q to round-trip, but got %s %q", value, op, unquoted)
+		}
+	}
+
+	for _, label := range []string{"", "1pod", "pod-name", `pod="x"} or {app`, "pod name", "pód"} {
+		if _, err := logQLMatcher(label, "=", "x"); err == nil || !strings.Contains(err.Error(), "invalid label name") {
+			t.Errorf("Expected an invalid label name error for %q, but got %v", label, err)
+		}
+	}
+	for _, op := range []string{"", "==", "|=", "=\"x\"} |= ", "~"} {
+		if _, err := logQLMatcher("pod", op, "x"); err == nil || !strings.Contains(err.Error(), "invalid label matcher operator") {
+			t.Errorf("Expected an invalid operator error for %q, but got %v", op, err)
+		}
+	}
+}
+
+// TestK8sLogsQuery_Escaping tests that pod, namespace, contains and level inputs cannot inject LogQL
+func TestK8sLogsQuery_Escaping(t *testing.T) {
+	labels := LabelProfile{}.withDefaults()
+	for _, value := range logQLInjectionValues[1:] {
+		query, err := k8sLogsQuery(labels, map[string]any{"namespace": value, "pod": value, "contains": value, "level": value + ",warn"})
+		if err != nil {
+			t.Fatalf("Expected no error for %q, but got %v", value, err)
+		}
+		tokens, err := tokenizeLogQL(query)
+		if err != nil {
+			t.Fatalf("Expected %s to tokenize, but got %v", query, err)
+		}
+		var strs []string
+		for _, token := range tokens {
+			if token.kind == "string" {
+				s, err := strconv.Unquote(token.text)
+				if err != nil {
+					t.Fatalf("Invalid string literal %s in %s", token.text, query)
+				}
+				strs = append(strs, s)
+			}
+		}
+		expected := []string{value, regexp.QuoteMeta(value) + ".*", value, "(?i)" + logQLRegexAlternation(splitList(value+",warn"))}
+		if len(tokens) != 15 || strings.Join(strs, "\x00") != strings.Join(expected, "\x00") {
+			t.Errorf("Unexpected query for %q: %s", value, query)
+		}
+	}
+
+	if _, err := k8sLogsQuery(LabelProfile{Namespace: `ns"} or {x`}.withDefaults(), map[string]any{"namespace": "prod"}); err == nil {
+		t.Error("Expected an error for an invalid label name in the profile")
+	}
+}
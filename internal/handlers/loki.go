@@ -3,36 +3,28 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/scottlepp/loki-mcp/pkg/lokiclient"
 )
 
 // LokiResult represents the structure of Loki query results
-type LokiResult struct {
-	Status string   `json:"status"`
-	Data   LokiData `json:"data"`
-	Error  string   `json:"error,omitempty"`
-}
+type LokiResult = lokiclient.QueryResult
 
 // LokiData represents the data portion of Loki results
-type LokiData struct {
-	ResultType string      `json:"resultType"`
-	Result     []LokiEntry `json:"result"`
-}
+type LokiData = lokiclient.QueryData
 
 // LokiEntry represents a single log entry from Loki
-type LokiEntry struct {
-	Stream map[string]string `json:"stream"`
-	Values [][]string        `json:"values"` // [timestamp, log line]
-}
+type LokiEntry = lokiclient.Stream
 
 // SSEEvent represents an event to be sent via SSE
 type SSEEvent struct {
@@ -57,9 +49,19 @@ const EnvLokiPassword = "LOKI_PASSWORD"
 // Environment variable name for Loki Token
 const EnvLokiToken = "LOKI_TOKEN"
 
+// Environment variable name for the URL length above which queries are sent as POST
+const EnvLokiMaxURLLength = "LOKI_MAX_URL_LENGTH"
+
+// Environment variable name for the path under the Loki URL where the API endpoints live
+const EnvLokiAPIPrefix = "LOKI_API_PREFIX"
+
 // Default Loki URL when environment variable is not set
 const DefaultLokiURL = "http://localhost:3100"
 
+// Default URL length above which queries are sent as POST form submissions,
+// safely below the 8KB request line limit of common proxies and gateways
+const DefaultLokiMaxURLLength = lokiclient.DefaultMaxURLLength
+
 // LokiLabelsResult represents the structure of Loki label names response
 type LokiLabelsResult struct {
 	Status string   `json:"status"`
@@ -76,19 +78,16 @@ type LokiLabelValuesResult struct {
 
 // NewLokiQueryTool creates and returns a tool for querying Grafana Loki
 func NewLokiQueryTool() mcp.Tool {
-	// Get Loki URL from environment variable or use default
-	lokiURL := os.Getenv(EnvLokiURL)
-	if lokiURL == "" {
-		lokiURL = DefaultLokiURL
-	}
+	cfg := CurrentConfig()
+	lokiURL := cfg.LokiURL
 
-	// Get Loki Org ID from environment variable if set
-	orgID := os.Getenv(EnvLokiOrgID)
+	// Get Loki Org ID from configuration if set
+	orgID := cfg.LokiOrgID
 
-	// Get authentication parameters from environment variables if set
-	username := os.Getenv(EnvLokiUsername)
-	password := os.Getenv(EnvLokiPassword)
-	token := os.Getenv(EnvLokiToken)
+	// Get authentication parameters from configuration if set
+	username := cfg.LokiUsername
+	password := cfg.LokiPassword
+	token := cfg.LokiToken
 
 	return mcp.NewTool("loki_query",
 		mcp.WithDescription("Run a query against Grafana Loki"),
@@ -115,6 +114,8 @@ func NewLokiQueryTool() mcp.Tool {
 		mcp.WithString("end",
 			mcp.Description("End time for the query (default: now)"),
 		),
+		sinceOption(),
+		untilOption(),
 		mcp.WithNumber("limit",
 			mcp.Description("Maximum number of entries to return (default: 100)"),
 		),
@@ -122,111 +123,332 @@ func NewLokiQueryTool() mcp.Tool {
 			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", orgID, EnvLokiOrgID)),
 		),
 		mcp.WithString("format",
-			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.Description("Output format: raw, json, text, ndjson with one JSON object per log entry, logfmt, or html with a collapsible section per stream (default: raw)"),
 			mcp.DefaultString("raw"),
 		),
+		mcp.WithString("parse",
+			mcp.Description("Parse each log line and pretty-print it indented: json or logfmt (raw and text formats; with ndjson the parsed fields are returned as metadata)"),
+			mcp.Enum("json", "logfmt"),
+		),
+		mcp.WithString("fields",
+			mcp.Description("Comma-separated fields to show when parse is set, e.g. level,msg,user.id (default: all fields)"),
+		),
+		mcp.WithString("highlight",
+			mcp.Description("Comma-separated terms to wrap in ** markers (raw and text formats only). "+
+				"Defaults to the query's line filters (|= and |~); use none to disable"),
+		),
+		mcp.WithNumber("max_line_length",
+			mcp.Description("Truncate log lines longer than this many characters, noting how many bytes were cut (default: no limit)"),
+		),
+		mcp.WithBoolean("strip_ansi",
+			mcp.Description("Remove ANSI escape codes such as terminal colors from log lines (default: false)"),
+		),
+		positionOption(),
+		splitOption(),
+		splitTimeoutOption(),
+		bucketOption(),
+		countOnlyOption(),
+		compactOption(),
+		relativeTimeOption(),
+		groupByOption(),
+		collapseStreamsOption(),
+		sampleOption(),
+		sampleRateOption(),
+		suggestOption(),
+		enrichOption(),
+		enrichPodsOption(),
+		sourceLinksOption(),
+		multilineOption(),
+		multilinePatternOption(),
+		maxOutputBytesOption(),
+		attachJSONOption(),
+		dryRunOption(),
+		verboseOption(),
 	)
 }
 
 // HandleLokiQuery handles Loki query tool requests
 func HandleLokiQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// Extract parameters
-	args := request.GetArguments()
-	queryString := args["query"].(string)
-
-	// Get Loki URL from request arguments, if not present check environment
-	var lokiURL string
-	if urlArg, ok := args["url"].(string); ok && urlArg != "" {
-		lokiURL = urlArg
-	} else {
-		// Fallback to environment variable
-		lokiURL = os.Getenv(EnvLokiURL)
-		if lokiURL == "" {
-			lokiURL = DefaultLokiURL
-		}
-	}
-
-	// Extract authentication parameters
-	var username, password, token, orgID string
-	if usernameArg, ok := args["username"].(string); ok && usernameArg != "" {
-		username = usernameArg
-	} else {
-		// Fallback to environment variable
-		username = os.Getenv(EnvLokiUsername)
-	}
-	if passwordArg, ok := args["password"].(string); ok && passwordArg != "" {
-		password = passwordArg
-	} else {
-		// Fallback to environment variable
-		password = os.Getenv(EnvLokiPassword)
-	}
-	if tokenArg, ok := args["token"].(string); ok && tokenArg != "" {
-		token = tokenArg
-	} else {
-		// Fallback to environment variable
-		token = os.Getenv(EnvLokiToken)
+	// Extract parameters, merging in any session context defaults
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
 	}
-	if orgIDArg, ok := args["org"].(string); ok && orgIDArg != "" {
-		orgID = orgIDArg
-	} else {
-		// Fallback to environment variable
-		orgID = os.Getenv(EnvLokiOrgID)
+	queryString, _ := params.Args["query"].(string)
+	if queryString == "" {
+		return nil, fmt.Errorf("query is required")
 	}
+	format := params.Format
 
-	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-	limit := 100
-
-	// Override defaults if parameters are provided
-	if startStr, ok := args["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+	// Count matching lines over the whole time range instead of returning them
+	if countOnly, _ := params.Args["count_only"].(bool); countOnly {
+		report, err := runCountQuery(ctx, params.Conn, queryString, params.Start, params.End)
+		if err != nil {
+			return nil, err
+		}
+		formattedResult, err := formatCountReport(report, format)
 		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+			return nil, fmt.Errorf("failed to format results: %v", err)
 		}
-		start = startTime.Unix()
+		return newResultMetadata(params).attach(mcp.NewToolResultText(formattedResult)), nil
 	}
 
-	if endStr, ok := args["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
+	// Count matching lines per time bucket instead of returning them
+	bucket, err := parseBucket(params.Args)
+	if err != nil {
+		return nil, err
+	}
+	if bucket > 0 {
+		report, err := runBucketedQuery(ctx, params.Conn, queryString, params.Start, params.End, bucket)
+		if err != nil {
+			return nil, err
+		}
+		formattedResult, err := formatBuckets(report, format)
 		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
+			return nil, fmt.Errorf("failed to format results: %v", err)
 		}
-		end = endTime.Unix()
+		return newResultMetadata(params).attach(mcp.NewToolResultText(formattedResult)), nil
+	}
+
+	position, err := parsePosition(params.Args)
+	if err != nil {
+		return nil, err
 	}
 
-	if limitVal, ok := args["limit"].(float64); ok {
+	// Sample from a bigger set of entries than a plain query returns
+	sampling, err := parseSampleOptions(params.Args)
+	if err != nil {
+		return nil, err
+	}
+	limit := 100
+	if sampling.enabled() {
+		limit = defaultSampleLimit
+	}
+	if limitVal, ok := params.Args["limit"].(float64); ok {
 		limit = int(limitVal)
 	}
 
-	// Extract format parameter
-	format := "raw" // default
-	if formatArg, ok := args["format"].(string); ok && formatArg != "" {
-		format = formatArg
+	grouping, err := parseGroupOptions(params.Args)
+	if err != nil {
+		return nil, err
+	}
+	budget, err := parseOutputBudget(params.Args)
+	if err != nil {
+		return nil, err
+	}
+	split, timeout, err := parseSplitOptions(params.Args, position)
+	if err != nil {
+		return nil, err
 	}
 
-	// Build query URL
-	queryURL, err := buildLokiQueryURL(lokiURL, queryString, start, end, limit)
+	// Extract line rendering options
+	lineOpts, err := parseLineOptions(params.Args)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query URL: %v", err)
+		return nil, err
+	}
+	multiline, err := parseMultilineRules(params.Args)
+	if err != nil {
+		return nil, err
 	}
 
-	// Execute query with authentication
-	result, err := executeLokiQuery(ctx, queryURL, username, password, token, orgID)
+	// Warn rather than quietly returning nothing when the range reaches past retention
+	warnIfBeforeRetention(ctx, params.Conn, params.Start)
+
+	// Re-run with a smaller limit while the formatted result exceeds the output budget, so it is
+	// cut at a whole entry with a cursor for the next page instead of mid-stream
+	opts := lokiQueryOptions{Query: queryString, Format: format, Limit: limit, Position: position,
+		Sampling: sampling, Grouping: grouping, Lines: lineOpts, Multiline: multiline, Split: split, Timeout: timeout}
+	var adjustment *budgetAdjustment
+	rendered, err := renderLokiQuery(ctx, params, opts)
+	for attempt := 1; err == nil && budget > 0 && rendered.Bytes > budget && attempt <= maxBudgetAttempts; attempt++ {
+		next := nextBudgetLimit(opts, rendered, budget)
+		if next < 1 {
+			break
+		}
+		if adjustment == nil {
+			adjustment = &budgetAdjustment{Budget: budget, OriginalLimit: limit, OriginalBytes: rendered.Bytes}
+		}
+		opts.Limit = next
+		rendered, err = renderLokiQuery(ctx, params, opts)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("query execution failed: %v", err)
+		return nil, err
+	}
+	toolResult, metadata := rendered.ToolResult, rendered.Metadata
+	if adjustment != nil {
+		adjustment.Limit, adjustment.Bytes = opts.Limit, rendered.Bytes
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(adjustment.String()))
+		metadata.Budget = adjustment
 	}
 
-	// Format results
-	formattedResult, err := formatLokiResults(result, format)
+	// Broadcast results to SSE clients if available
+	broadcastQueryResults(ctx, queryString, rendered.Result)
+
+	return metadata.attach(toolResult), nil
+}
+
+// lokiQueryOptions are the loki_query arguments that shape how a result is fetched and rendered
+type lokiQueryOptions struct {
+	Query     string
+	Format    string
+	Limit     int
+	Position  string
+	Sampling  sampleOptions
+	Grouping  groupOptions
+	Lines     lineOptions
+	Multiline []MultilineRule // join rules for continuation lines, none to leave entries as they are
+	Split     time.Duration   // slice duration of a sliced query, 0 to run it as one query
+	Timeout   time.Duration   // overall timeout of a sliced query, 0 for none
+}
+
+// renderedQuery is a formatted loki_query result
+type renderedQuery struct {
+	Result     *LokiResult
+	ToolResult *mcp.CallToolResult
+	Metadata   resultMetadata
+	Gap        bool // entries between the head and tail of the time range were omitted
+	Returned   int  // entries in the formatted result
+	Bytes      int  // size of the formatted result, including any attached JSON
+}
+
+// renderLokiQuery runs a log query and formats its result
+func renderLokiQuery(ctx context.Context, params toolParams, opts lokiQueryOptions) (*renderedQuery, error) {
+	queryString, format, limit, position := opts.Query, opts.Format, opts.Limit, opts.Position
+	sampling, grouping, lineOpts := opts.Sampling, opts.Grouping, opts.Lines
+
+	// Execute query with authentication, from the requested end of the time range
+	var result *LokiResult
+	var gap bool
+	var coverage *sliceCoverage
+	var err error
+	if opts.Split > 0 {
+		result, coverage, err = runSlicedQuery(ctx, params.Conn, queryString, params.Start, params.End, limit, position, opts.Split, opts.Timeout)
+	} else {
+		result, gap, err = runPositionedQuery(ctx, params.Conn, queryString, params.Start, params.End, limit, position)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe everything that matched before sampling keeps a subset of it. The cursor pages
+	// towards older entries, so it only applies to the newest entries.
+	metadata := newResultMetadata(params).withEntries(result, limit)
+	if position != PositionTail {
+		metadata.Truncated, metadata.NextCursor = gap || (position == PositionHead && metadata.Truncated), ""
+	}
+	if coverage != nil {
+		// Continue before the covered range when it reaches the end and the limit wasn't reached
+		metadata.Truncated, metadata.Partial = true, coverage
+		if covered := coverage.Covered; position == PositionTail && metadata.NextCursor == "" && len(covered) == 1 && covered[0].End.Equal(coverage.End) {
+			metadata.NextCursor = covered[0].Start.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	// Join continuation lines before sampling and grouping, which count the joined entries
+	var joined multilineSummary
+	if len(opts.Multiline) > 0 {
+		joined = applyMultiline(result, opts.Multiline)
+	}
+	var sample sampleSummary
+	if sampling.enabled() {
+		sample = sampling.apply(result)
+	}
+	var groups []streamGroup
+	if grouping.enabled() {
+		groups = grouping.apply(result)
+	}
+
+	// Render the attached JSON before the line rendering options rewrite the lines
+	var jsonResult string
+	if attachJSONRequested(params) {
+		lineOptions{StripANSI: lineOpts.StripANSI}.apply(result)
+		if jsonResult, err = formatLokiResults(result, "json"); err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+	}
+
+	// Sanitize log lines, applying the rendering options only for human-readable formats
+	parser, fields := lineOpts.Parse, lineOpts.Fields
+	if format == "json" || format == "ndjson" || format == "logfmt" || format == "html" {
+		lineOpts = lineOptions{StripANSI: lineOpts.StripANSI}
+	}
+	lineOpts.apply(result)
+	if (format == "raw" || format == "text") && sourceLinksEnabled(params.Args) {
+		applySourceLinks(result, CurrentConfig().SourceLinks)
+	}
+
+	// Format results, with the fields parsed from each line as ndjson metadata
+	var formattedResult string
+	if compactRequested(params.Args) && (format == "raw" || format == "text") {
+		formattedResult = formatLokiCompact(result)
+	} else if format == "ndjson" {
+		formattedResult, err = formatLokiNDJSON(result, parser, fields)
+	} else {
+		var now time.Time
+		if relativeTimeRequested(params.Args) {
+			now = time.Now()
+		}
+		formattedResult, err = formatLokiResultsAt(result, format, now)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to format results: %v", err)
 	}
 
-	// Broadcast results to SSE clients if available
-	broadcastQueryResults(ctx, queryString, result)
+	toolResult := mcp.NewToolResultText(formattedResult)
+	if jsonResult != "" {
+		toolResult = attachJSONResource(ctx, toolResult, jsonResult)
+	}
+	if gap {
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(fmt.Sprintf(
+			"Showing the first %d and last %d entries of the time range; entries in between may be omitted", limit, limit)))
+	}
+	if coverage != nil {
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(coverage.String()))
+	}
+	if joined.Joined > 0 {
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(joined.String()))
+		metadata.Multiline = &joined
+	}
+	if sampling.enabled() {
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(sample.String()))
+		metadata.Sample = &sample
+	}
+	if len(groups) > 0 {
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(describeGroups(grouping.Label, groups)))
+		if grouping.Label != "" {
+			metadata.Groups = groups
+		}
+	}
 
-	return mcp.NewToolResultText(formattedResult), nil
+	// Look up the IP addresses in the returned lines
+	if enrichRequested(params.Args) {
+		metadata.IPs, err = enrichIPs(ctx, result, CurrentConfig().GeoIPFile)
+		if err != nil {
+			return nil, err
+		}
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(describeEnrichments(metadata.IPs)))
+	}
+	if enrichPodsRequested(params.Args) {
+		metadata.Pods, err = enrichPods(ctx, result, params.Conn.Labels)
+		if err != nil {
+			return nil, err
+		}
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(describePods(metadata.Pods)))
+	}
+
+	// Suggest selector corrections to break out of empty-result loops
+	if metadata.EntryCount == 0 && suggestEnabled(params.Args) {
+		metadata.Suggestions = suggestSelectorCorrections(ctx, params.Conn, queryString, params.Start, params.End)
+		if len(metadata.Suggestions) > 0 {
+			toolResult.Content = append(toolResult.Content, mcp.NewTextContent("Suggestions:\n  "+strings.Join(metadata.Suggestions, "\n  ")))
+		}
+	}
+
+	returned := metadata.EntryCount
+	if sampling.enabled() {
+		returned = sample.Returned
+	}
+	return &renderedQuery{Result: result, ToolResult: toolResult, Metadata: metadata, Gap: gap,
+		Returned: returned, Bytes: len(formattedResult) + len(jsonResult)}, nil
 }
 
 // broadcastQueryResults sends the query results to all connected SSE clients
@@ -238,6 +460,198 @@ func broadcastQueryResults(ctx context.Context, queryString string, result *Loki
 	// or if you decide to implement custom broadcasting later
 }
 
+// LokiConnection holds the Loki endpoint and credentials resolved for a single tool call
+type LokiConnection struct {
+	URL      string
+	Username string
+	Password string
+	Token    string
+	OrgID    string
+
+	// Endpoints lists every configured URL when a comma-separated failover list was given
+	Endpoints []string
+
+	// Datasource is the name of the configured datasource used, if any
+	Datasource string
+	// Backend is the log backend of the datasource, empty for Loki
+	Backend string
+	// Labels maps the convenience tools' concepts to the datasource's label names
+	Labels LabelProfile
+	// Anonymize lists the anonymization profiles applied to log query results
+	Anonymize []string
+
+	// err reports an unknown datasource, failing every request made with the connection
+	err error
+}
+
+// ResolveLokiConnection extracts connection parameters from the tool arguments,
+// falling back to the named or default datasource and then to the configuration
+// for anything not provided
+func ResolveLokiConnection(args map[string]any) LokiConnection {
+	cfg := CurrentConfig()
+	conn := LokiConnection{
+		URL:      cfg.LokiURL,
+		Username: cfg.LokiUsername,
+		Password: cfg.LokiPassword,
+		Token:    cfg.LokiToken,
+		OrgID:    cfg.LokiOrgID,
+	}
+
+	name, _ := args["datasource"].(string)
+	ds, found := findDatasource(cfg, name)
+	if found {
+		conn = LokiConnection{
+			URL:        ds.URL,
+			Username:   ds.Username,
+			Password:   ds.Password,
+			Token:      ds.Token,
+			OrgID:      ds.OrgID,
+			Datasource: ds.Name,
+			Backend:    ds.Backend,
+			Labels:     ds.Labels,
+		}
+	} else if name != "" {
+		conn.err = fmt.Errorf("unknown datasource: %s. Configured datasources: %s", name, describeDatasources(cfg))
+	}
+	conn.Labels = conn.Labels.withDefaults()
+
+	requested, _ := args["anonymize"].(string)
+	var datasource *Datasource
+	if found {
+		datasource = &ds
+	}
+	profiles, err := resolveAnonymization(cfg, datasource, requested)
+	conn.Anonymize = profiles
+	if err != nil && conn.err == nil {
+		conn.err = err
+	}
+
+	// The url parameter defaults to LOKI_URL, which must not override a datasource
+	if urlArg, ok := args["url"].(string); ok && urlArg != "" && (conn.Datasource == "" || urlArg != cfg.LokiURL) {
+		conn.URL = urlArg
+	}
+	if usernameArg, ok := args["username"].(string); ok && usernameArg != "" {
+		conn.Username = usernameArg
+	}
+	if passwordArg, ok := args["password"].(string); ok && passwordArg != "" {
+		conn.Password = passwordArg
+	}
+	if tokenArg, ok := args["token"].(string); ok && tokenArg != "" {
+		conn.Token = tokenArg
+	}
+	if orgIDArg, ok := args["org"].(string); ok && orgIDArg != "" {
+		conn.OrgID = orgIDArg
+	}
+
+	// Use the active endpoint of a configured failover list, or the first endpoint of another list
+	if group := endpointGroupFor(conn.URL); group != nil {
+		conn.Endpoints = group.urls()
+		conn.URL = group.activeURL()
+	} else if urls := splitLokiURLs(conn.URL); len(urls) > 1 {
+		conn.URL = urls[0]
+	}
+
+	return conn
+}
+
+// runLokiQuery executes a LogQL range query over the given window using the resolved connection
+func runLokiQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	result, err := CurrentLokiClient().Query(ctx, conn, query, start, end, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+
+	return result, nil
+}
+
+// LokiConnectionOptions returns the tool options shared by every tool that talks to Loki
+func LokiConnectionOptions() []mcp.ToolOption {
+	cfg := CurrentConfig()
+	lokiURL := cfg.LokiURL
+
+	opts := []mcp.ToolOption{
+		mcp.WithString("url",
+			mcp.Description(fmt.Sprintf("Loki server URL (default: %s from %s env var)", lokiURL, EnvLokiURL)),
+			mcp.DefaultString(lokiURL),
+		),
+		mcp.WithString("username",
+			mcp.Description(fmt.Sprintf("Username for basic authentication (default: from %s env var)", EnvLokiUsername)),
+		),
+		mcp.WithString("password",
+			mcp.Description(fmt.Sprintf("Password for basic authentication (default: from %s env var)", EnvLokiPassword)),
+		),
+		mcp.WithString("token",
+			mcp.Description(fmt.Sprintf("Bearer token for authentication (default: from %s env var)", EnvLokiToken)),
+		),
+		mcp.WithString("org",
+			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", cfg.LokiOrgID, EnvLokiOrgID)),
+		),
+		dryRunOption(),
+		verboseOption(),
+	}
+	if len(cfg.Datasources) > 0 {
+		opts = append(opts, mcp.WithString("datasource",
+			mcp.Description("Name of the configured datasource to query, which sets the URL, credentials, default tenant "+
+				"and label names used by the convenience tools"),
+			mcp.Enum(datasourceNames(cfg)...),
+		))
+	}
+	if len(cfg.AnonymizationProfiles) > 0 {
+		opts = append(opts, mcp.WithString("anonymize",
+			mcp.Description("Anonymization profile applied to the returned log lines and labels, in addition to any "+
+				"profile of the datasource"),
+			mcp.Enum(anonymizationProfileNames(cfg)...),
+		))
+	}
+	return opts
+}
+
+// parseTimeRange extracts the start and end arguments, defaulting to the given lookback window ending now.
+// The relative since and until arguments take precedence over start and end.
+func parseTimeRange(args map[string]any, lookback time.Duration) (time.Time, time.Time, error) {
+	now := time.Now()
+	end := now
+	start := end.Add(-lookback)
+
+	if startStr, ok := args["start"].(string); ok && startStr != "" {
+		startTime, err := parseTime(startStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start time: %v", err)
+		}
+		start = startTime
+	}
+
+	if endStr, ok := args["end"].(string); ok && endStr != "" {
+		endTime, err := parseTime(endStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end time: %v", err)
+		}
+		end = endTime
+	}
+
+	if since, ok, err := relativeTimeArg(args, "since", now); err != nil {
+		return time.Time{}, time.Time{}, err
+	} else if ok {
+		start = since
+	}
+
+	if until, ok, err := relativeTimeArg(args, "until", now); err != nil {
+		return time.Time{}, time.Time{}, err
+	} else if ok {
+		end = until
+	}
+
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start time must be before end time")
+	}
+
+	if err := checkTimeLimits(start, end, now); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return start, end, nil
+}
+
 // parseTime parses a time string in various formats
 func parseTime(timeStr string) (time.Time, error) {
 	// Handle "now" keyword
@@ -276,7 +690,9 @@ func parseTime(timeStr string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("unsupported time format: %s", timeStr)
 }
 
-// buildLokiQueryURL constructs the Loki query URL
+// buildLokiQueryURL constructs the Loki query URL. start and end are Unix timestamps in seconds or
+// nanoseconds; log queries use nanoseconds so paging from a cursor doesn't skip entries logged in
+// the same second.
 func buildLokiQueryURL(baseURL, query string, start, end int64, limit int) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
@@ -284,18 +700,7 @@ func buildLokiQueryURL(baseURL, query string, start, end int64, limit int) (stri
 	}
 
 	// Add path for Loki query API only if not already included
-	if !strings.Contains(u.Path, "loki/api/v1") {
-		if u.Path == "" || u.Path == "/" {
-			u.Path = "/loki/api/v1/query_range"
-		} else {
-			u.Path = fmt.Sprintf("%s/loki/api/v1/query_range", u.Path)
-		}
-	} else {
-		// If path already contains loki/api/v1, just append query_range if not present
-		if !strings.HasSuffix(u.Path, "query_range") {
-			u.Path = fmt.Sprintf("%s/query_range", u.Path)
-		}
-	}
+	setLokiAPIPath(u, "query_range")
 
 	// Add query parameters
 	q := u.Query()
@@ -308,69 +713,222 @@ func buildLokiQueryURL(baseURL, query string, start, end int64, limit int) (stri
 	return u.String(), nil
 }
 
+// setLokiAPIPath points u at a Loki API endpoint such as "query_range", using the
+// path prefix configured in LOKI_API_PREFIX when set
+func setLokiAPIPath(u *url.URL, endpoint string) {
+	lokiclient.SetAPIPath(u, endpoint, CurrentConfig().APIPrefix)
+}
+
 // executeLokiQuery sends the HTTP request to Loki
 func executeLokiQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiResult, error) {
+	body, err := executeLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiResult
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, newLokiError(0, []byte(result.Error))
+	}
+
+	return &result, nil
+}
+
+// executeLokiRequest sends an authenticated request to a Loki API endpoint and returns the response body.
+// Requests to an endpoint of a failover group are retried on the other endpoints after connection errors.
+func executeLokiRequest(ctx context.Context, requestURL string, username, password, token, orgID string) ([]byte, error) {
+	requestURL, err := enforceQueryPolicy(ctx, requestURL, orgID)
+	if err != nil {
+		return nil, err
+	}
+	requestURL, err = enforceTimeLimits(ctx, requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	group, base := endpointGroupForRequest(requestURL)
+	if group == nil {
+		body, err := sendLokiRequest(ctx, requestURL, username, password, token, orgID)
+		if err == nil {
+			clearStartupFailure(requestURL)
+		}
+		return body, err
+	}
+
+	var lastErr error
+	for _, endpoint := range group.candidates(base) {
+		body, err := sendLokiRequest(ctx, endpoint+strings.TrimPrefix(requestURL, base), username, password, token, orgID)
+		if errors.Is(err, errDryRun) {
+			return nil, err
+		}
+		if err != nil && isConnectionError(ctx, err) {
+			group.markFailure(endpoint, err)
+			lastErr = err
+			continue
+		}
+		group.markSuccess(endpoint)
+		if err == nil {
+			clearStartupFailure(endpoint)
+		}
+		return body, err
+	}
+	return nil, lastErr
+}
+
+// sendLokiRequest sends a single authenticated request to a Loki API URL and returns the response body
+func sendLokiRequest(ctx context.Context, requestURL string, username, password, token, orgID string) ([]byte, error) {
 	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	req, err := newLokiRequest(ctx, requestURL)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add authentication if provided
-	if token != "" {
-		// Bearer token authentication
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		// Basic authentication
-		req.SetBasicAuth(username, password)
+	// Add authentication and orgid if provided
+	lokiclient.Credentials{Username: username, Password: password, Token: token, OrgID: orgID}.Apply(req)
+	applyTenantHeaders(ctx, req)
+
+	// Use the MCP client's own credentials when headers are forwarded from the HTTP request
+	if err := applyForwardedHeaders(ctx, req); err != nil {
+		return nil, err
+	}
+	if err := applyExchangedToken(ctx, req); err != nil {
+		return nil, err
+	}
+
+	// Propagate the tool call's request ID for correlation with Loki's logs
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	// Return the request instead of sending it in dry-run mode
+	if rec := dryRunFromContext(ctx); rec != nil {
+		rec.record(req, requestURL)
+		return nil, errDryRun
+	}
+
+	// Record the request in the timing breakdown of verbose tool calls
+	var timing *requestTiming
+	if rec := verboseFromContext(ctx); rec != nil {
+		ctx, timing = rec.startRequest(ctx, req.Method, requestURL)
+	}
+
+	// Serve responses for past time ranges from the cache when enabled
+	cacheKey, cacheable := responseCacheKey(req, requestURL)
+	if cacheable {
+		if body, ok := cachedResponseBody(cacheKey); ok {
+			if timing != nil {
+				verboseFromContext(ctx).update(func() { timing.Cached = true })
+			}
+			return body, nil
+		}
+	}
+
+	// Reject requests of callers that used up their daily quota; cached responses are free
+	refund, err := checkQuota(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Identical concurrent requests share one response from Loki, accounted to each caller. Verbose
+	// callers send their own request, so its timing breakdown is theirs.
+	key := requestKey(req, requestURL)
+	if timing != nil {
+		key = fmt.Sprintf("%s/%p", key, timing)
+	}
+	sent := time.Now()
+	body, err := coalesceRequest(ctx, key, func(sendCtx context.Context) ([]byte, error) {
+		return doLokiRequest(req.WithContext(sendCtx))
+	})
+	accountResponse(req, body, err, sent)
+	if err != nil {
+		refund()
+		return nil, err
 	}
+	warnIfClockSkewed(ctx, req.URL)
 
-	// Add orgid if provided
-	if orgID != "" {
-		req.Header.Add("X-Scope-OrgID", orgID)
+	if cacheable {
+		storeResponse(cacheKey, requestURL, body)
 	}
+	return body, nil
+}
+
+// accountResponse records a response from Loki for the caller whose request got it, whether it
+// sent the request or shared another caller's: in the slow query log when the caller waited longer
+// than the threshold, and in its usage. Requests that got no response aren't recorded.
+func accountResponse(req *http.Request, body []byte, err error, sent time.Time) {
+	status := http.StatusOK
+	var lokiErr *LokiError
+	switch {
+	case errors.As(err, &lokiErr):
+		status = lokiErr.StatusCode
+	case err != nil:
+		return
+	}
+	recordSlowQuery(req, status, body, sent, time.Since(sent))
+	recordUsage(req, status, body)
+}
 
-	// Execute request
+// doLokiRequest sends a request to Loki and returns the response body, or an error for any status but 200
+func doLokiRequest(req *http.Request) ([]byte, error) {
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 	}
-	resp, err := client.Do(req)
+	ctx, traced := traceRequest(trackConnections(req.Context()))
+	connectionStats.requests.Add(1)
+	connectionStats.inFlight.Add(1)
+	defer connectionStats.inFlight.Add(-1)
+	sent := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
+		connectionStats.failed.Add(1)
+		traced(0, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	recordClockSkew(req.URL, resp.Header.Get("Date"), sent, time.Now())
 
 	// Read response
 	body, err := io.ReadAll(resp.Body)
+	traced(resp.StatusCode, err)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check for HTTP errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
-	// Parse JSON response
-	var result LokiResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	// Check for Loki errors
-	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
+		return nil, newLokiError(resp.StatusCode, body)
 	}
+	return body, nil
+}
 
-	return &result, nil
+// newLokiRequest creates a GET request for a Loki API URL. Query endpoints whose URL
+// exceeds the maximum length are sent as a POST with a form-encoded body instead.
+func newLokiRequest(ctx context.Context, requestURL string) (*http.Request, error) {
+	return lokiclient.NewRequest(ctx, requestURL, CurrentConfig().MaxURLLength)
 }
 
 // formatLokiResults formats the Loki query results into a readable string
 func formatLokiResults(result *LokiResult, format string) (string, error) {
+	return formatLokiResultsAt(result, format, time.Time{})
+}
+
+// formatLokiResultsAt formats the Loki query results, appending to the timestamps of the raw
+// and text formats how long before now each entry was logged unless now is zero
+func formatLokiResultsAt(result *LokiResult, format string, now time.Time) (string, error) {
 	if len(result.Data.Result) == 0 {
 		switch format {
 		case "json":
 			return "{\"message\": \"No logs found matching the query\"}", nil
+		case "ndjson", "logfmt":
+			return "", nil
+		case "html":
+			return formatLokiHTML(result), nil
 		default:
 			return "No logs found matching the query", nil
 		}
@@ -407,7 +965,7 @@ func formatLokiResults(result *LokiResult, format string) (string, error) {
 					if err == nil {
 						// Convert to time - Loki returns timestamps in nanoseconds
 						t := time.Unix(0, int64(ts))
-						timestamp = t.Format(time.RFC3339)
+						timestamp = formatEntryTime(t, now)
 					} else {
 						timestamp = val[0]
 					}
@@ -449,7 +1007,7 @@ func formatLokiResults(result *LokiResult, format string) (string, error) {
 					if err == nil {
 						// Convert to time - Loki returns timestamps in nanoseconds already
 						timestamp := time.Unix(0, int64(ts))
-						output += fmt.Sprintf("[%s] %s\n", timestamp.Format(time.RFC3339), val[1])
+						output += fmt.Sprintf("[%s] %s\n", formatEntryTime(timestamp, now), val[1])
 					} else {
 						output += fmt.Sprintf("[%s] %s\n", val[0], val[1])
 					}
@@ -459,24 +1017,30 @@ func formatLokiResults(result *LokiResult, format string) (string, error) {
 		}
 		return output, nil
 
+	case "ndjson":
+		return formatLokiNDJSON(result, "", nil)
+
+	case "logfmt":
+		return formatLokiLogfmt(result), nil
+
+	case "html":
+		return formatLokiHTML(result), nil
+
 	default:
-		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text, ndjson, logfmt, html", format)
 	}
 }
 
 // NewLokiLabelNamesTool creates and returns a tool for getting all label names from Grafana Loki
 func NewLokiLabelNamesTool() mcp.Tool {
-	// Get Loki URL from environment variable or use default
-	lokiURL := os.Getenv(EnvLokiURL)
-	if lokiURL == "" {
-		lokiURL = DefaultLokiURL
-	}
+	cfg := CurrentConfig()
+	lokiURL := cfg.LokiURL
 
-	// Get authentication parameters from environment variables if set
-	username := os.Getenv(EnvLokiUsername)
-	password := os.Getenv(EnvLokiPassword)
-	token := os.Getenv(EnvLokiToken)
-	orgID := os.Getenv(EnvLokiOrgID)
+	// Get authentication parameters from configuration if set
+	username := cfg.LokiUsername
+	password := cfg.LokiPassword
+	token := cfg.LokiToken
+	orgID := cfg.LokiOrgID
 
 	return mcp.NewTool("loki_label_names",
 		mcp.WithDescription("Get all label names from Grafana Loki"),
@@ -499,6 +1063,8 @@ func NewLokiLabelNamesTool() mcp.Tool {
 		mcp.WithString("end",
 			mcp.Description("End time for the query (default: now)"),
 		),
+		sinceOption(),
+		untilOption(),
 		mcp.WithString("org",
 			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", orgID, EnvLokiOrgID)),
 		),
@@ -506,22 +1072,22 @@ func NewLokiLabelNamesTool() mcp.Tool {
 			mcp.Description("Output format: raw, json, or text (default: raw)"),
 			mcp.DefaultString("raw"),
 		),
+		attachJSONOption(),
+		dryRunOption(),
+		verboseOption(),
 	)
 }
 
 // NewLokiLabelValuesTool creates and returns a tool for getting values for a specific label from Grafana Loki
 func NewLokiLabelValuesTool() mcp.Tool {
-	// Get Loki URL from environment variable or use default
-	lokiURL := os.Getenv(EnvLokiURL)
-	if lokiURL == "" {
-		lokiURL = DefaultLokiURL
-	}
+	cfg := CurrentConfig()
+	lokiURL := cfg.LokiURL
 
-	// Get authentication parameters from environment variables if set
-	username := os.Getenv(EnvLokiUsername)
-	password := os.Getenv(EnvLokiPassword)
-	token := os.Getenv(EnvLokiToken)
-	orgID := os.Getenv(EnvLokiOrgID)
+	// Get authentication parameters from configuration if set
+	username := cfg.LokiUsername
+	password := cfg.LokiPassword
+	token := cfg.LokiToken
+	orgID := cfg.LokiOrgID
 
 	return mcp.NewTool("loki_label_values",
 		mcp.WithDescription("Get all values for a specific label from Grafana Loki"),
@@ -548,6 +1114,8 @@ func NewLokiLabelValuesTool() mcp.Tool {
 		mcp.WithString("end",
 			mcp.Description("End time for the query (default: now)"),
 		),
+		sinceOption(),
+		untilOption(),
 		mcp.WithString("org",
 			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", orgID, EnvLokiOrgID)),
 		),
@@ -555,184 +1123,82 @@ func NewLokiLabelValuesTool() mcp.Tool {
 			mcp.Description("Output format: raw, json, or text (default: raw)"),
 			mcp.DefaultString("raw"),
 		),
+		attachJSONOption(),
+		dryRunOption(),
+		verboseOption(),
 	)
 }
 
 // HandleLokiLabelNames handles Loki label names tool requests
 func HandleLokiLabelNames(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// Extract parameters
-	args := request.GetArguments()
-
-	// Get Loki URL from request arguments, if not present check environment
-	var lokiURL string
-	if urlArg, ok := args["url"].(string); ok && urlArg != "" {
-		lokiURL = urlArg
-	} else {
-		// Fallback to environment variable
-		lokiURL = os.Getenv(EnvLokiURL)
-		if lokiURL == "" {
-			lokiURL = DefaultLokiURL
-		}
-	}
-
-	// Extract authentication parameters
-	var username, password, token, orgID string
-	if usernameArg, ok := args["username"].(string); ok && usernameArg != "" {
-		username = usernameArg
-	} else {
-		username = os.Getenv(EnvLokiUsername)
-	}
-	if passwordArg, ok := args["password"].(string); ok && passwordArg != "" {
-		password = passwordArg
-	} else {
-		password = os.Getenv(EnvLokiPassword)
-	}
-	if tokenArg, ok := args["token"].(string); ok && tokenArg != "" {
-		token = tokenArg
-	} else {
-		token = os.Getenv(EnvLokiToken)
-	}
-	if orgIDArg, ok := args["org"].(string); ok && orgIDArg != "" {
-		orgID = orgIDArg
-	} else {
-		orgID = os.Getenv(EnvLokiOrgID)
-	}
-
-	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-
-	// Override defaults if parameters are provided
-	if startStr, ok := args["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
-		}
-		start = startTime.Unix()
-	}
-
-	if endStr, ok := args["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
-		}
-		end = endTime.Unix()
-	}
-
-	// Extract format parameter
-	format := "raw" // default
-	if formatArg, ok := args["format"].(string); ok && formatArg != "" {
-		format = formatArg
-	}
-
-	// Build labels URL
-	labelsURL, err := buildLokiLabelsURL(lokiURL, start, end)
+	// Extract parameters, merging in any session context defaults
+	params, err := parseToolParams(ctx, request, time.Hour)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build labels URL: %v", err)
+		return nil, err
 	}
 
 	// Execute labels request
-	result, err := executeLokiLabelsQuery(ctx, labelsURL, username, password, token, orgID)
+	result, err := CurrentLokiClient().Labels(ctx, params.Conn, params.Start, params.End)
 	if err != nil {
-		return nil, fmt.Errorf("labels query execution failed: %v", err)
+		return nil, fmt.Errorf("labels query execution failed: %w", err)
 	}
 
 	// Format results
-	formattedResult, err := formatLokiLabelsResults(result, format)
+	formattedResult, err := formatLokiLabelsResults(result, params.Format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to format results: %v", err)
 	}
 
-	return mcp.NewToolResultText(formattedResult), nil
-}
-
-// HandleLokiLabelValues handles Loki label values tool requests
-func HandleLokiLabelValues(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// Extract parameters
-	args := request.GetArguments()
-	labelName := args["label"].(string)
-
-	// Get Loki URL from request arguments, if not present check environment
-	var lokiURL string
-	if urlArg, ok := args["url"].(string); ok && urlArg != "" {
-		lokiURL = urlArg
-	} else {
-		// Fallback to environment variable
-		lokiURL = os.Getenv(EnvLokiURL)
-		if lokiURL == "" {
-			lokiURL = DefaultLokiURL
-		}
-	}
-
-	// Extract authentication parameters
-	var username, password, token, orgID string
-	if usernameArg, ok := args["username"].(string); ok && usernameArg != "" {
-		username = usernameArg
-	} else {
-		username = os.Getenv(EnvLokiUsername)
-	}
-	if passwordArg, ok := args["password"].(string); ok && passwordArg != "" {
-		password = passwordArg
-	} else {
-		password = os.Getenv(EnvLokiPassword)
-	}
-	if tokenArg, ok := args["token"].(string); ok && tokenArg != "" {
-		token = tokenArg
-	} else {
-		token = os.Getenv(EnvLokiToken)
-	}
-	if orgIDArg, ok := args["org"].(string); ok && orgIDArg != "" {
-		orgID = orgIDArg
-	} else {
-		orgID = os.Getenv(EnvLokiOrgID)
-	}
-
-	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-
-	// Override defaults if parameters are provided
-	if startStr, ok := args["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+	toolResult := mcp.NewToolResultText(formattedResult)
+	if attachJSONRequested(params) {
+		jsonResult, err := formatLokiLabelsResults(result, "json")
 		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+			return nil, fmt.Errorf("failed to format results: %v", err)
 		}
-		start = startTime.Unix()
+		toolResult = attachJSONResource(ctx, toolResult, jsonResult)
 	}
 
-	if endStr, ok := args["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
-		}
-		end = endTime.Unix()
-	}
-
-	// Extract format parameter
-	format := "raw" // default
-	if formatArg, ok := args["format"].(string); ok && formatArg != "" {
-		format = formatArg
-	}
+	metadata := newResultMetadata(params)
+	metadata.EntryCount = len(result.Data)
+	return metadata.attach(toolResult), nil
+}
 
-	// Build label values URL
-	labelValuesURL, err := buildLokiLabelValuesURL(lokiURL, labelName, start, end)
+// HandleLokiLabelValues handles Loki label values tool requests
+func HandleLokiLabelValues(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// Extract parameters, merging in any session context defaults
+	params, err := parseToolParams(ctx, request, time.Hour)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build label values URL: %v", err)
+		return nil, err
+	}
+	labelName, _ := params.Args["label"].(string)
+	if labelName == "" {
+		return nil, fmt.Errorf("label is required")
 	}
 
 	// Execute label values request
-	result, err := executeLokiLabelValuesQuery(ctx, labelValuesURL, username, password, token, orgID)
+	result, err := CurrentLokiClient().LabelValues(ctx, params.Conn, labelName, params.Start, params.End)
 	if err != nil {
-		return nil, fmt.Errorf("label values query execution failed: %v", err)
+		return nil, fmt.Errorf("label values query execution failed: %w", err)
 	}
 
 	// Format results
-	formattedResult, err := formatLokiLabelValuesResults(labelName, result, format)
+	formattedResult, err := formatLokiLabelValuesResults(labelName, result, params.Format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to format results: %v", err)
 	}
 
-	return mcp.NewToolResultText(formattedResult), nil
+	toolResult := mcp.NewToolResultText(formattedResult)
+	if attachJSONRequested(params) {
+		jsonResult, err := formatLokiLabelValuesResults(labelName, result, "json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+		toolResult = attachJSONResource(ctx, toolResult, jsonResult)
+	}
+
+	metadata := newResultMetadata(params)
+	metadata.EntryCount = len(result.Data)
+	return metadata.attach(toolResult), nil
 }
 
 // buildLokiLabelsURL constructs the Loki labels URL
@@ -743,18 +1209,7 @@ func buildLokiLabelsURL(baseURL string, start, end int64) (string, error) {
 	}
 
 	// Add path for Loki labels API
-	if !strings.Contains(u.Path, "loki/api/v1") {
-		if u.Path == "" || u.Path == "/" {
-			u.Path = "/loki/api/v1/labels"
-		} else {
-			u.Path = fmt.Sprintf("%s/loki/api/v1/labels", u.Path)
-		}
-	} else {
-		// If path already contains loki/api/v1, just append labels if not present
-		if !strings.HasSuffix(u.Path, "labels") {
-			u.Path = fmt.Sprintf("%s/labels", u.Path)
-		}
-	}
+	setLokiAPIPath(u, "labels")
 
 	// Add query parameters
 	q := u.Query()
@@ -773,18 +1228,7 @@ func buildLokiLabelValuesURL(baseURL, labelName string, start, end int64) (strin
 	}
 
 	// Add path for Loki label values API
-	if !strings.Contains(u.Path, "loki/api/v1") {
-		if u.Path == "" || u.Path == "/" {
-			u.Path = fmt.Sprintf("/loki/api/v1/label/%s/values", url.PathEscape(labelName))
-		} else {
-			u.Path = fmt.Sprintf("%s/loki/api/v1/label/%s/values", u.Path, url.PathEscape(labelName))
-		}
-	} else {
-		// If path already contains loki/api/v1, just append label values path
-		if !strings.Contains(u.Path, "/label/") {
-			u.Path = fmt.Sprintf("%s/label/%s/values", u.Path, url.PathEscape(labelName))
-		}
-	}
+	setLokiAPIPath(u, "label/"+labelName+"/values")
 
 	// Add query parameters
 	q := u.Query()
@@ -797,54 +1241,20 @@ func buildLokiLabelValuesURL(baseURL, labelName string, start, end int64) (strin
 
 // executeLokiLabelsQuery sends the HTTP request to Loki labels endpoint
 func executeLokiLabelsQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiLabelsResult, error) {
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	body, err := executeLokiRequest(ctx, queryURL, username, password, token, orgID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add authentication if provided
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		req.SetBasicAuth(username, password)
-	}
-
-	// Add orgid if provided
-	if orgID != "" {
-		req.Header.Add("X-Scope-OrgID", orgID)
-	}
-
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
 	// Parse JSON response
 	var result LokiLabelsResult
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
 		return nil, err
 	}
 
 	// Check for Loki errors
 	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
+		return nil, newLokiError(0, []byte(result.Error))
 	}
 
 	return &result, nil
@@ -852,54 +1262,20 @@ func executeLokiLabelsQuery(ctx context.Context, queryURL string, username, pass
 
 // executeLokiLabelValuesQuery sends the HTTP request to Loki label values endpoint
 func executeLokiLabelValuesQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiLabelValuesResult, error) {
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	body, err := executeLokiRequest(ctx, queryURL, username, password, token, orgID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add authentication if provided
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		req.SetBasicAuth(username, password)
-	}
-
-	// Add orgid if provided
-	if orgID != "" {
-		req.Header.Add("X-Scope-OrgID", orgID)
-	}
-
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
 	// Parse JSON response
 	var result LokiLabelValuesResult
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
 		return nil, err
 	}
 
 	// Check for Loki errors
 	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
+		return nil, newLokiError(0, []byte(result.Error))
 	}
 
 	return &result, nil
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"io"
 	"strconv"
 	"strings"
 	"testing"
@@ -35,7 +37,7 @@ func TestFormatLokiResults_TimestampParsing(t *testing.T) {
 	}
 
 	// Format the results
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -83,7 +85,7 @@ func TestFormatLokiResults_MultipleTimestamps(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -119,7 +121,7 @@ func TestFormatLokiResults_InvalidTimestamp(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -145,7 +147,7 @@ func TestFormatLokiResults_EmptyResult(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -180,7 +182,7 @@ func TestFormatLokiResults_RecentTimestamp(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -241,7 +243,7 @@ func TestFormatLokiResults_NoYear2262Bug(t *testing.T) {
 				},
 			}
 
-			output, err := formatLokiResults(result)
+			output, err := formatLokiResults(result, "text")
 			if err != nil {
 				t.Fatalf("formatLokiResults failed: %v", err)
 			}
@@ -258,3 +260,92 @@ func TestFormatLokiResults_NoYear2262Bug(t *testing.T) {
 		})
 	}
 }
+
+// TestNewLokiRequest_LongQueryUsesPost tests that long query URLs are sent as form-encoded POST requests
+func TestNewLokiRequest_LongQueryUsesPost(t *testing.T) {
+	ctx := context.Background()
+
+	shortURL, _ := buildLokiQueryURL("http://localhost:3100", `{job="varlogs"}`, 1, 2, 10)
+	req, err := newLokiRequest(ctx, shortURL)
+	if err != nil {
+		t.Fatalf("newLokiRequest failed: %v", err)
+	}
+	if req.Method != "GET" {
+		t.Errorf("Expected GET for short query, but got %s", req.Method)
+	}
+
+	longQuery := `{job="varlogs"} |~ "` + strings.Repeat("a", DefaultLokiMaxURLLength) + `"`
+	longURL, _ := buildLokiQueryURL("http://localhost:3100", longQuery, 1, 2, 10)
+	req, err = newLokiRequest(ctx, longURL)
+	if err != nil {
+		t.Fatalf("newLokiRequest failed: %v", err)
+	}
+	if req.Method != "POST" {
+		t.Fatalf("Expected POST for long query, but got %s", req.Method)
+	}
+	if req.URL.RawQuery != "" {
+		t.Errorf("Expected no query string on POST request, but got %d bytes", len(req.URL.RawQuery))
+	}
+	if req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("Unexpected content type: %s", req.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(req.Body)
+	if !strings.Contains(string(body), "limit=10") {
+		t.Errorf("Expected form-encoded parameters in body, but got %.80s", body)
+	}
+
+	// Endpoints without POST support keep using GET
+	labelsURL := "http://localhost:3100/loki/api/v1/labels?x=" + strings.Repeat("a", DefaultLokiMaxURLLength)
+	req, _ = newLokiRequest(ctx, labelsURL)
+	if req.Method != "GET" {
+		t.Errorf("Expected GET for labels endpoint, but got %s", req.Method)
+	}
+}
+
+// TestSetLokiAPIPath tests building endpoint URLs under a configured API prefix or path template
+func TestSetLokiAPIPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prefix   string
+		build    func() (string, error)
+		expected string
+	}{
+		{
+			name:   "Prefix under a gateway",
+			prefix: "/api/datasources/proxy/uid/abc/loki/api/v1",
+			build: func() (string, error) {
+				return buildLokiLabelsURL("https://grafana.example.com/", 1, 2)
+			},
+			expected: "https://grafana.example.com/api/datasources/proxy/uid/abc/loki/api/v1/labels?end=2&start=1",
+		},
+		{
+			name:   "Template with endpoint placeholder",
+			prefix: "/proxy/{endpoint}/tenant-a",
+			build: func() (string, error) {
+				return buildLokiSeriesURL("http://gateway", `{job="x"}`, 1, 2)
+			},
+			expected: "http://gateway/proxy/series/tenant-a?end=2&match%5B%5D=%7Bjob%3D%22x%22%7D&start=1",
+		},
+		{
+			name:   "Label values keep the base path",
+			prefix: "loki/api/v1/",
+			build: func() (string, error) {
+				return buildLokiLabelValuesURL("http://gateway/loki-a", "app", 1, 2)
+			},
+			expected: "http://gateway/loki-a/loki/api/v1/label/app/values?end=2&start=1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setenv(t, EnvLokiAPIPrefix, tc.prefix)
+			output, err := tc.build()
+			if err != nil {
+				t.Fatalf("Failed to build URL: %v", err)
+			}
+			if output != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LokiMetricResult represents the structure of Loki metric (matrix or vector) query results
+type LokiMetricResult struct {
+	Status string         `json:"status"`
+	Data   LokiMetricData `json:"data"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// LokiMetricData represents the data portion of Loki metric results
+type LokiMetricData struct {
+	ResultType string             `json:"resultType"`
+	Result     []LokiMetricSeries `json:"result"`
+}
+
+// LokiMetricSeries represents a single series from a Loki metric query
+type LokiMetricSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]any           `json:"values,omitempty"` // [unix seconds, "value"] for matrix results
+	Value  []any             `json:"value,omitempty"`  // [unix seconds, "value"] for vector results
+}
+
+// metricSample is a single parsed sample of a metric series
+type metricSample struct {
+	Time  time.Time
+	Value float64
+}
+
+// buildLokiMetricQueryURL constructs the Loki query_range URL for a metric query evaluated at the given step
+func buildLokiMetricQueryURL(baseURL, query string, start, end int64, step time.Duration) (string, error) {
+	queryURL, err := buildLokiQueryURL(baseURL, query, start, end, 0)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Limit does not apply to metric queries
+	q := u.Query()
+	q.Del("limit")
+	q.Set("step", fmt.Sprintf("%d", int64(step.Seconds())))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiMetricQuery sends the HTTP request for a metric query to Loki
+func executeLokiMetricQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiMetricResult, error) {
+	body, err := executeLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiMetricResult
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, newLokiError(0, []byte(result.Error))
+	}
+
+	if result.Data.ResultType != "matrix" && result.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("expected a metric query result, got %s (use a metric query such as count_over_time)", result.Data.ResultType)
+	}
+
+	return &result, nil
+}
+
+// runLokiMetricQuery executes a LogQL metric query over the given window using the resolved connection
+func runLokiMetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	result, err := CurrentLokiClient().MetricQuery(ctx, conn, query, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+
+	return result, nil
+}
+
+// samples parses the series values into time-ordered samples, skipping malformed pairs
+func (s LokiMetricSeries) samples() []metricSample {
+	pairs := s.Values
+	if len(pairs) == 0 && len(s.Value) == 2 {
+		pairs = [][]any{s.Value}
+	}
+
+	samples := make([]metricSample, 0, len(pairs))
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			continue
+		}
+		ts, ok := pair[0].(float64)
+		if !ok {
+			continue
+		}
+		str, ok := pair[1].(string)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, metricSample{
+			Time:  time.Unix(0, int64(ts*float64(time.Second))),
+			Value: value,
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples
+}
+
+// sumByTime adds up the samples of all series at each timestamp
+func (r *LokiMetricResult) sumByTime() map[int64]float64 {
+	sums := make(map[int64]float64)
+	for _, series := range r.Data.Result {
+		for _, sample := range series.samples() {
+			sums[sample.Time.Unix()] += sample.Value
+		}
+	}
+	return sums
+}
+
+// formatLogQLDuration renders a duration in the compact form used by LogQL range selectors, e.g. 5m or 1h
+func formatLogQLDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
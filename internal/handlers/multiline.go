@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for the JSON file defining multiline join rules
+const EnvLokiMultilineFile = "LOKI_MULTILINE_FILE"
+
+// Multiline join defaults, as in the multiline stage of Promtail
+const (
+	// defaultContinuationPattern matches indented lines and the "Caused by:" and "... N more" lines
+	// of Java stack traces, and the indented frames of Python tracebacks
+	defaultContinuationPattern = `^(?:\s|Caused by:|\.\.\. \d+ more)`
+	defaultMultilineMaxLines   = 128
+	defaultMultilineMaxWait    = 3 * time.Second
+)
+
+// MultilineRule joins the continuation lines of matching streams to the entry before them, so an
+// exception logged without a multiline stage reads as one entry instead of one per frame
+type MultilineRule struct {
+	Name string `json:"name"`
+	// Labels are the stream labels a stream must have for the rule to apply (default: all streams)
+	Labels map[string]string `json:"labels,omitempty"`
+	// Continuation matches lines that continue the entry before them (default: indented lines,
+	// "Caused by:" and "... N more")
+	Continuation string `json:"continuation,omitempty"`
+	// MaxLines is the most lines joined into one entry, including the first (default: 128)
+	MaxLines int `json:"max_lines,omitempty"`
+	// MaxWait is the longest time between a line and its continuation, e.g. 500ms (default: 3s)
+	MaxWait string `json:"max_wait,omitempty"`
+
+	continuation *regexp.Regexp
+	maxWait      time.Duration
+}
+
+// multilineSummary describes the entries joined in a result
+type multilineSummary struct {
+	Entries int // multi-line entries the lines were joined into
+	Joined  int // continuation lines joined to the entry before them
+}
+
+// LoadMultilineRules reads multiline join rules from a JSON file containing an array of rules
+func LoadMultilineRules(path string) ([]MultilineRule, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multiline file: %w", err)
+	}
+	var rules []MultilineRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse multiline file %s: %w", path, err)
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid multiline file %s: rule %d (%s): %w", path, i+1, rules[i].Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// compile checks the rule, compiles its pattern and applies the defaults
+func (r *MultilineRule) compile() error {
+	pattern := r.Continuation
+	if pattern == "" {
+		pattern = defaultContinuationPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid continuation pattern: %v", err)
+	}
+	if r.MaxLines < 0 || r.MaxLines == 1 {
+		return fmt.Errorf("max_lines must be at least 2")
+	}
+	if r.MaxLines == 0 {
+		r.MaxLines = defaultMultilineMaxLines
+	}
+	r.maxWait = defaultMultilineMaxWait
+	if r.MaxWait != "" {
+		if r.maxWait, err = time.ParseDuration(r.MaxWait); err != nil || r.maxWait <= 0 {
+			return fmt.Errorf("max_wait must be a positive duration such as 500ms or 3s")
+		}
+	}
+	r.continuation = re
+	return nil
+}
+
+// matches reports whether the rule applies to a stream
+func (r *MultilineRule) matches(labels map[string]string) bool {
+	for name, value := range r.Labels {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// join joins the continuation lines among a stream's values to the entry before them, in time
+// order, keeping the timestamp of the first line. The values are returned in their original direction.
+func (r *MultilineRule) join(values [][]string, summary *multilineSummary) [][]string {
+	type timedValue struct {
+		ts    int64
+		value []string
+	}
+	timed := make([]timedValue, 0, len(values))
+	for _, value := range values {
+		if len(value) < 2 {
+			continue
+		}
+		ts, _ := strconv.ParseInt(value[0], 10, 64)
+		timed = append(timed, timedValue{ts, value})
+	}
+	backward := len(timed) > 1 && timed[0].ts > timed[len(timed)-1].ts
+	sort.SliceStable(timed, func(i, j int) bool { return timed[i].ts < timed[j].ts })
+
+	joined := make([][]string, 0, len(timed))
+	var lines []string
+	var last int64
+	flush := func(first []string) {
+		if len(lines) > 1 {
+			summary.Entries++
+			summary.Joined += len(lines) - 1
+		}
+		if first != nil {
+			value := append([]string(nil), first...)
+			value[1] = strings.Join(lines, "\n")
+			joined = append(joined, value)
+		}
+	}
+	var first []string
+	for _, t := range timed {
+		if first != nil && len(lines) < r.MaxLines && time.Duration(t.ts-last) <= r.maxWait && r.continuation.MatchString(t.value[1]) {
+			lines = append(lines, t.value[1])
+			last = t.ts
+			continue
+		}
+		flush(first)
+		first, lines, last = t.value, []string{t.value[1]}, t.ts
+	}
+	flush(first)
+
+	if backward {
+		for i, j := 0, len(joined)-1; i < j; i, j = i+1, j-1 {
+			joined[i], joined[j] = joined[j], joined[i]
+		}
+	}
+	return joined
+}
+
+// multilineOption returns the tool option for turning off joining multi-line entries
+func multilineOption() mcp.ToolOption {
+	return mcp.WithBoolean("multiline",
+		mcp.Description(fmt.Sprintf("Join continuation lines, such as the frames of a stack trace logged as separate entries, "+
+			"to the entry before them, as configured in %s (default: true when rules are configured)", EnvLokiMultilineFile)),
+	)
+}
+
+// multilinePatternOption returns the tool option for joining continuation lines matching a pattern
+func multilinePatternOption() mcp.ToolOption {
+	return mcp.WithString("multiline_pattern",
+		mcp.Description("Regular expression matching continuation lines, joining them in every stream instead of the configured rules, "+
+			"e.g. ^\\s+at\\s for the frames of Java stack traces (default: the configured rules)"),
+	)
+}
+
+// parseMultilineRules returns the join rules applying to a tool call: a rule for multiline_pattern,
+// or the configured rules unless multiline=false
+func parseMultilineRules(args map[string]any) ([]MultilineRule, error) {
+	if enabled, ok := args["multiline"].(bool); ok && !enabled {
+		return nil, nil
+	}
+	if pattern, _ := args["multiline_pattern"].(string); pattern != "" {
+		rule := MultilineRule{Name: "multiline_pattern", Continuation: pattern}
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid multiline_pattern: %v", err)
+		}
+		return []MultilineRule{rule}, nil
+	}
+	return CurrentConfig().Multiline, nil
+}
+
+// applyMultiline joins the continuation lines of each stream with the first rule matching it
+func applyMultiline(result *LokiResult, rules []MultilineRule) multilineSummary {
+	var summary multilineSummary
+	for i := range result.Data.Result {
+		stream := &result.Data.Result[i]
+		for j := range rules {
+			if rules[j].continuation != nil && rules[j].matches(stream.Stream) {
+				stream.Values = rules[j].join(stream.Values, &summary)
+				break
+			}
+		}
+	}
+	return summary
+}
+
+// String describes the joined entries
+func (s multilineSummary) String() string {
+	return fmt.Sprintf("Joined %d continuation lines into %d multi-line entries", s.Joined, s.Entries)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestLoadMultilineRules tests reading and checking multiline join rules
+func TestLoadMultilineRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "multiline.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	rules, err := LoadMultilineRules(write(`[{"name": "java", "labels": {"app": "checkout"}, "max_wait": "500ms"}]`))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(rules) != 1 || rules[0].MaxLines != defaultMultilineMaxLines || rules[0].maxWait != 500*time.Millisecond ||
+		rules[0].continuation.String() != defaultContinuationPattern {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+
+	for content, want := range map[string]string{
+		`[{"name": "a", "continuation": "(["}]`: "invalid continuation pattern",
+		`[{"name": "a", "max_lines": 1}]`:       "max_lines must be at least 2",
+		`[{"name": "a", "max_wait": "soon"}]`:   "max_wait must be a positive duration",
+	} {
+		if _, err := LoadMultilineRules(write(content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadMultilineRules(%s) = %v, want an error containing %q", content, err, want)
+		}
+	}
+}
+
+// TestMultilineRule_Join tests joining continuation lines within the line and time limits
+func TestMultilineRule_Join(t *testing.T) {
+	rule := MultilineRule{MaxLines: 3, MaxWait: "1s"}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+	ms := func(n int) string { return strconv.FormatInt(int64(n)*int64(time.Millisecond), 10) }
+	// Newest first, as Loki returns them by default
+	values := [][]string{
+		{ms(5000), "\tat Main.main(Main.java:3)"},
+		{ms(2300), "\tat Cart.total(Cart.java:12)"},
+		{ms(2200), "\tat Cart.add(Cart.java:42)"},
+		{ms(2100), "\tat Cart.check(Cart.java:7)"},
+		{ms(2000), "java.lang.NullPointerException: item"},
+		{ms(1000), "request started"},
+	}
+
+	var summary multilineSummary
+	joined := rule.join(values, &summary)
+	want := [][]string{
+		{ms(5000), "\tat Main.main(Main.java:3)"},   // more than a second after the line before it
+		{ms(2300), "\tat Cart.total(Cart.java:12)"}, // beyond max_lines
+		{ms(2000), "java.lang.NullPointerException: item\n\tat Cart.check(Cart.java:7)\n\tat Cart.add(Cart.java:42)"},
+		{ms(1000), "request started"},
+	}
+	if len(joined) != len(want) {
+		t.Fatalf("Expected %d entries, but got %d: %q", len(want), len(joined), joined)
+	}
+	for i := range want {
+		if joined[i][0] != want[i][0] || joined[i][1] != want[i][1] {
+			t.Errorf("Entry %d: expected %q, but got %q", i, want[i], joined[i])
+		}
+	}
+	if summary.Entries != 1 || summary.Joined != 2 {
+		t.Errorf("Expected 2 lines joined into 1 entry, but got %+v", summary)
+	}
+}
+
+// TestHandleLokiQuery_Multiline tests joining stack trace lines with configured rules and an ad-hoc pattern
+func TestHandleLokiQuery_Multiline(t *testing.T) {
+	rules := []MultilineRule{{Name: "java", Labels: map[string]string{"query": `{app="checkout"}`}}}
+	if err := rules[0].compile(); err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(&Config{LokiURL: DefaultLokiURL, Multiline: rules})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	query := `{app="checkout"}`
+	SetLokiClient(&cannedQueryLokiClient{lines: map[string][]string{query: {
+		"java.lang.IllegalStateException: cart closed",
+		"    at Cart.add(Cart.java:42)",
+		"Caused by: java.io.IOException: reset",
+		"    ... 12 more",
+		"request done",
+	}}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": query, "format": "text"}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	want := "java.lang.IllegalStateException: cart closed\n    at Cart.add(Cart.java:42)\nCaused by: java.io.IOException: reset\n    ... 12 more"
+	if !strings.Contains(text, want) {
+		t.Errorf("Expected the joined stack trace, but got:\n%s", text)
+	}
+	if result.Meta["multiline_joined"] != 3 || result.Meta["entry_count"] != 5 {
+		t.Errorf("Unexpected metadata: %v", result.Meta)
+	}
+	if note := result.Content[1].(mcp.TextContent).Text; note != "Joined 3 continuation lines into 1 multi-line entries" {
+		t.Errorf("Unexpected note: %s", note)
+	}
+
+	request.Params.Arguments = map[string]any{"query": query, "format": "text", "multiline": false}
+	if result, err = HandleLokiQuery(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, ok := result.Meta["multiline_joined"]; ok {
+		t.Errorf("Expected no lines joined with multiline=false, but got %v", result.Meta)
+	}
+
+	// An ad-hoc pattern replaces the configured rules
+	request.Params.Arguments = map[string]any{"query": query, "format": "text", "multiline_pattern": `^\s+at\s`}
+	if result, err = HandleLokiQuery(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if result.Meta["multiline_joined"] != 1 {
+		t.Errorf("Expected 1 line joined, but got %v", result.Meta["multiline_joined"])
+	}
+
+	request.Params.Arguments = map[string]any{"query": query, "multiline_pattern": "(["}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "invalid multiline_pattern") {
+		t.Errorf("Expected an invalid pattern error, but got %v", err)
+	}
+}
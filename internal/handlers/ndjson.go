@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ndjsonEntry is a single log entry of the ndjson output format
+type ndjsonEntry struct {
+	Timestamp string            `json:"ts"`
+	Labels    map[string]string `json:"labels"`
+	Line      string            `json:"line"`
+	Metadata  map[string]any    `json:"metadata,omitempty"` // fields parsed from the line with the parse option
+}
+
+// logEntry is a single log entry with the labels of its stream
+type logEntry struct {
+	NS        int64 // timestamp in nanoseconds, 0 when unparsable
+	Timestamp string
+	Labels    map[string]string
+	Line      string
+}
+
+// sortedLogEntries flattens query results into entries ordered by timestamp and then by
+// labels, so that output built from them is deterministic
+func sortedLogEntries(result *LokiResult) []logEntry {
+	type sortableEntry struct {
+		labels string
+		entry  logEntry
+	}
+
+	var entries []sortableEntry
+	for _, stream := range result.Data.Result {
+		labels := stream.Stream
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labelKey := formatStreamLabels(labels)
+
+		for _, val := range stream.Values {
+			if len(val) < 2 {
+				continue
+			}
+			entry := logEntry{Timestamp: val[0], Labels: labels, Line: val[1]}
+			if ns, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				entry.NS = ns
+				entry.Timestamp = time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+			}
+			entries = append(entries, sortableEntry{labels: labelKey, entry: entry})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].entry.NS != entries[j].entry.NS {
+			return entries[i].entry.NS < entries[j].entry.NS
+		}
+		return entries[i].labels < entries[j].labels
+	})
+
+	flat := make([]logEntry, len(entries))
+	for i, e := range entries {
+		flat[i] = e.entry
+	}
+	return flat
+}
+
+// formatLokiNDJSON renders query results as newline-delimited JSON, one object per log entry,
+// ordered by timestamp and then by labels. When parser is set, the fields parsed from each
+// line are included as metadata.
+func formatLokiNDJSON(result *LokiResult, parser string, fields []string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	for _, e := range sortedLogEntries(result) {
+		entry := ndjsonEntry{Timestamp: e.Timestamp, Labels: e.Labels, Line: e.Line}
+		if parser != "" {
+			entry.Metadata = parseLineFields(e.Line, parser, fields)
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestFormatLokiNDJSON tests rendering one JSON object per entry in timestamp order
+func TestFormatLokiNDJSON(t *testing.T) {
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{
+		{Stream: map[string]string{"app": "web"}, Values: [][]string{{"1700000002000000000", `level=error msg="boom"`}}},
+		{Stream: map[string]string{"app": "api"}, Values: [][]string{{"1700000001000000000", `level=info msg=ok`}}},
+	}}}
+
+	output, err := formatLokiNDJSON(result, "", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expected := `{"ts":"2023-11-14T22:13:21Z","labels":{"app":"api"},"line":"level=info msg=ok"}` + "\n" +
+		`{"ts":"2023-11-14T22:13:22Z","labels":{"app":"web"},"line":"level=error msg=\"boom\""}` + "\n"
+	if output != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, output)
+	}
+
+	output, _ = formatLokiNDJSON(result, "logfmt", []string{"level"})
+	if !strings.Contains(output, `"metadata":{"level":"error"}`) {
+		t.Errorf("Expected parsed fields as metadata, but got %s", output)
+	}
+}
+
+// TestFormatLokiResults_NDJSONEmpty tests that empty results produce no ndjson lines
+func TestFormatLokiResults_NDJSONEmpty(t *testing.T) {
+	output, err := formatLokiResults(&LokiResult{}, "ndjson")
+	if err != nil || output != "" {
+		t.Errorf("Expected empty output, but got %q (%v)", output, err)
+	}
+}
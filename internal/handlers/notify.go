@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification sink types
+const (
+	SinkWebhook   = "webhook"
+	SinkSlack     = "slack"
+	SinkPagerDuty = "pagerduty"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint used when a sink has no URL
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// maxNotificationLines caps the matched lines included in a notification
+const maxNotificationLines = 5
+
+// notificationClient sends notifications to all sinks
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// NotificationSink is a destination for watch and scheduled report notifications
+type NotificationSink struct {
+	Type       string `json:"type,omitempty"`        // webhook (default), slack or pagerduty
+	URL        string `json:"url,omitempty"`         // required except for pagerduty
+	RoutingKey string `json:"routing_key,omitempty"` // PagerDuty integration key
+	// Go text/template rendered with the notification. It replaces the whole body for
+	// webhooks, the message text for Slack and the event summary for PagerDuty.
+	Template string `json:"template,omitempty"`
+}
+
+// notification is a watch or report event delivered to sinks
+type notification struct {
+	Source    string   `json:"source"` // "watch" or "report"
+	ID        string   `json:"id"`
+	Name      string   `json:"name,omitempty"`
+	Query     string   `json:"query,omitempty"`
+	State     string   `json:"state,omitempty"`
+	Condition string   `json:"condition,omitempty"`
+	Threshold float64  `json:"threshold,omitempty"`
+	Value     float64  `json:"value"`
+	Count     int      `json:"count"`
+	Lines     []string `json:"lines,omitempty"`
+	Content   string   `json:"content,omitempty"`
+	Time      string   `json:"time"`
+}
+
+// templateFuncs are available to sink templates
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+}
+
+// validate checks the sink's type and destination
+func (s *NotificationSink) validate() error {
+	if s.Type == "" {
+		s.Type = SinkWebhook
+	}
+	switch s.Type {
+	case SinkWebhook, SinkSlack:
+		if s.URL == "" {
+			return fmt.Errorf("%s sink requires a URL", s.Type)
+		}
+	case SinkPagerDuty:
+		if s.RoutingKey == "" {
+			return fmt.Errorf("pagerduty sink requires a routing key")
+		}
+	default:
+		return fmt.Errorf("unsupported sink type: %s. Supported types: webhook, slack, pagerduty", s.Type)
+	}
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s URL: %s", s.Type, s.URL)
+		}
+	}
+	if s.Template != "" {
+		if _, err := template.New("sink").Funcs(templateFuncs).Parse(s.Template); err != nil {
+			return fmt.Errorf("invalid %s template: %v", s.Type, err)
+		}
+	}
+	return nil
+}
+
+// String describes the sink without credentials, for listings
+func (s NotificationSink) String() string {
+	if s.URL == "" {
+		return s.Type
+	}
+	return s.Type + " " + redactURL(s.URL)
+}
+
+// send delivers the notification to the sink
+func (s NotificationSink) send(ctx context.Context, n notification) error {
+	body, err := s.body(n)
+	if err != nil {
+		return err
+	}
+	target := s.URL
+	if target == "" && s.Type == SinkPagerDuty {
+		target = pagerDutyEventsURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notificationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s sink returned status %d", s.Type, resp.StatusCode)
+	}
+	return nil
+}
+
+// body builds the request body for the sink's type
+func (s NotificationSink) body(n notification) ([]byte, error) {
+	text := ""
+	if s.Template != "" {
+		tmpl, err := template.New("sink").Funcs(templateFuncs).Parse(s.Template)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, n); err != nil {
+			return nil, fmt.Errorf("failed to render %s template: %v", s.Type, err)
+		}
+		text = b.String()
+	}
+
+	switch s.Type {
+	case SinkSlack:
+		if text == "" {
+			text = n.message()
+		}
+		return json.Marshal(map[string]string{"text": text})
+	case SinkPagerDuty:
+		if text == "" {
+			text = n.summary()
+		}
+		action, severity := "trigger", "warning"
+		if n.State == watchResolved {
+			action, severity = "resolve", "info"
+		}
+		// PagerDuty limits summaries to 1024 characters
+		if len(text) > 1024 {
+			text = text[:1021] + "..."
+		}
+		return json.Marshal(map[string]any{
+			"routing_key":  s.RoutingKey,
+			"event_action": action,
+			"dedup_key":    "loki-mcp/" + n.Source + "/" + n.ID,
+			"payload": map[string]any{
+				"summary":        text,
+				"source":         "loki-mcp",
+				"severity":       severity,
+				"timestamp":      n.Time,
+				"custom_details": n,
+			},
+		})
+	default:
+		if text != "" {
+			return []byte(text), nil
+		}
+		return json.Marshal(n)
+	}
+}
+
+// summary describes the notification in one line
+func (n notification) summary() string {
+	name := n.Name
+	if name == "" {
+		name = n.ID
+	}
+	if n.Source == "report" {
+		return fmt.Sprintf("Report %s (%d lines)", name, n.Count)
+	}
+	return fmt.Sprintf("[%s] %s: %s %s %s (value: %s)", strings.ToUpper(n.State), name, n.Query, n.Condition,
+		strconv.FormatFloat(n.Threshold, 'f', -1, 64), strconv.FormatFloat(n.Value, 'f', -1, 64))
+}
+
+// message describes the notification for chat, including the report content or matched lines
+func (n notification) message() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* (%s)", n.summary(), n.Time)
+	details := n.Content
+	if details == "" && len(n.Lines) > 0 {
+		details = strings.Join(n.Lines, "\n")
+	}
+	if details != "" {
+		fmt.Fprintf(&b, "\n```\n%s\n```", details)
+	}
+	return b.String()
+}
+
+// sendNotifications delivers the notification to every sink, logging and returning any failures
+func sendNotifications(ctx context.Context, sinks []NotificationSink, n notification) error {
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.send(ctx, n); err != nil {
+			slog.Warn("notification failed", "source", n.Source, "id", n.ID, "sink", sink.Type, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
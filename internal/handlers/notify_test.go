@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testNotification returns a firing watch notification with matched lines
+func testNotification() notification {
+	return notification{
+		Source:    "watch",
+		ID:        "watch-1",
+		Name:      "api errors",
+		Query:     `sum(count_over_time({app="api"} |= "error" [5m]))`,
+		State:     watchFiring,
+		Condition: ">",
+		Threshold: 10,
+		Value:     25,
+		Count:     25,
+		Lines:     []string{"error: timeout", "error: refused"},
+		Time:      "2024-03-15T09:00:00Z",
+	}
+}
+
+// TestNotificationSink_Validate tests rejecting incomplete sinks
+func TestNotificationSink_Validate(t *testing.T) {
+	testCases := map[string]NotificationSink{
+		"missing URL":      {Type: SinkSlack},
+		"missing key":      {Type: SinkPagerDuty},
+		"unsupported type": {Type: "email", URL: "https://example.com"},
+		"bad URL":          {URL: "example.com/hook"},
+		"bad template":     {URL: "https://example.com", Template: "{{.Name"},
+	}
+	for name, sink := range testCases {
+		if err := sink.validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	sink := NotificationSink{URL: "https://example.com"}
+	if err := sink.validate(); err != nil || sink.Type != SinkWebhook {
+		t.Errorf("Expected a webhook sink by default, but got %q (%v)", sink.Type, err)
+	}
+}
+
+// TestNotificationSink_Body tests the payloads built for each sink type
+func TestNotificationSink_Body(t *testing.T) {
+	n := testNotification()
+
+	body, err := NotificationSink{Type: SinkSlack, URL: "https://hooks.slack.com/x"}.body(n)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var slack map[string]string
+	json.Unmarshal(body, &slack)
+	if !strings.HasPrefix(slack["text"], "*[FIRING] api errors: ") || !strings.Contains(slack["text"], "error: timeout\nerror: refused") {
+		t.Errorf("Unexpected Slack message: %s", slack["text"])
+	}
+
+	body, err = NotificationSink{Type: SinkPagerDuty, RoutingKey: "key"}.body(n)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var event struct {
+		RoutingKey  string `json:"routing_key"`
+		EventAction string `json:"event_action"`
+		DedupKey    string `json:"dedup_key"`
+		Payload     struct {
+			Summary       string       `json:"summary"`
+			Severity      string       `json:"severity"`
+			CustomDetails notification `json:"custom_details"`
+		} `json:"payload"`
+	}
+	json.Unmarshal(body, &event)
+	if event.RoutingKey != "key" || event.EventAction != "trigger" || event.DedupKey != "loki-mcp/watch/watch-1" || event.Payload.Severity != "warning" {
+		t.Errorf("Unexpected PagerDuty event: %+v", event)
+	}
+	if event.Payload.CustomDetails.Count != 25 {
+		t.Errorf("Expected the notification in the custom details, but got %+v", event.Payload.CustomDetails)
+	}
+
+	n.State = watchResolved
+	body, _ = NotificationSink{Type: SinkPagerDuty, RoutingKey: "key"}.body(n)
+	json.Unmarshal(body, &event)
+	if event.EventAction != "resolve" {
+		t.Errorf("Expected a resolve event, but got %s", event.EventAction)
+	}
+
+	sink := NotificationSink{Type: SinkWebhook, URL: "https://example.com", Template: `{"alert": {{json .Name}}, "lines": {{len .Lines}}}`}
+	body, err = sink.body(n)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if string(body) != `{"alert": "api errors", "lines": 2}` {
+		t.Errorf("Unexpected templated body: %s", body)
+	}
+}
+
+// TestSendNotifications tests delivering to several sinks and reporting failures
+func TestSendNotifications(t *testing.T) {
+	var received []string
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload["name"].(string))
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	sinks := []NotificationSink{{Type: SinkWebhook, URL: failing.URL}, {Type: SinkWebhook, URL: ok.URL}}
+	err := sendNotifications(context.Background(), sinks, testNotification())
+	if err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Errorf("Expected the failing sink's error, but got %v", err)
+	}
+	if len(received) != 1 || received[0] != "api errors" {
+		t.Errorf("Expected the other sink to be notified, but got %v", received)
+	}
+}
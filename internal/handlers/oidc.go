@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variable names for exchanging the MCP client's OIDC token for a Loki token
+const (
+	// EnvLokiOIDCIssuer is the OIDC issuer URL, used to discover the token endpoint
+	EnvLokiOIDCIssuer = "LOKI_OIDC_ISSUER"
+	// EnvLokiOIDCTokenURL is the token endpoint, when it is not discovered from the issuer
+	EnvLokiOIDCTokenURL = "LOKI_OIDC_TOKEN_URL"
+	// EnvLokiOIDCClientID and EnvLokiOIDCClientSecret authenticate the server to the token endpoint
+	EnvLokiOIDCClientID     = "LOKI_OIDC_CLIENT_ID"
+	EnvLokiOIDCClientSecret = "LOKI_OIDC_CLIENT_SECRET"
+	// EnvLokiOIDCAudience is the audience of the exchanged token, i.e. the Loki gateway
+	EnvLokiOIDCAudience = "LOKI_OIDC_AUDIENCE"
+	// EnvLokiOIDCScope is the space-separated scope of the exchanged token
+	EnvLokiOIDCScope = "LOKI_OIDC_SCOPE"
+	// EnvLokiOIDCSubjectHeader is the request header carrying the user's token (default: Authorization)
+	EnvLokiOIDCSubjectHeader = "LOKI_OIDC_SUBJECT_HEADER"
+)
+
+// Token types and grant type of OAuth 2.0 token exchange (RFC 8693)
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// Exchanged tokens are renewed this long before they expire, and cached this long when the
+// token endpoint does not say when they expire
+const (
+	exchangedTokenExpiryMargin = 30 * time.Second
+	exchangedTokenDefaultTTL   = 5 * time.Minute
+)
+
+// OIDCConfig configures the exchange of users' OIDC tokens for tokens accepted by Loki
+type OIDCConfig struct {
+	Issuer        string
+	TokenURL      string
+	ClientID      string
+	ClientSecret  string // or read from LOKI_OIDC_CLIENT_SECRET_FILE
+	Audience      string
+	Scope         string
+	SubjectHeader string
+}
+
+// Enabled reports whether token exchange is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" || c.TokenURL != ""
+}
+
+// oidcSubjectKey is the context key for the user's token taken from the MCP request
+type oidcSubjectKey struct{}
+
+// exchangedToken is a cached token exchange result
+type exchangedToken struct {
+	token   string
+	expires time.Time
+}
+
+// oidcState caches the discovered endpoints by issuer and field, and the exchanged tokens by subject token hash
+var oidcState = struct {
+	sync.Mutex
+	endpoints map[string]string
+	tokens    map[[sha256.Size]byte]exchangedToken
+}{endpoints: make(map[string]string), tokens: make(map[[sha256.Size]byte]exchangedToken)}
+
+// OIDCContextFunc captures the user's token from an HTTP transport request when token exchange is enabled
+func OIDCContextFunc(ctx context.Context, r *http.Request) context.Context {
+	cfg := CurrentConfig().OIDC
+	if !cfg.Enabled() {
+		return ctx
+	}
+	value := r.Header.Get(cfg.SubjectHeader)
+	if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+		value = token
+	}
+	return context.WithValue(ctx, oidcSubjectKey{}, strings.TrimSpace(value))
+}
+
+// applyExchangedToken authenticates a Loki request with a token exchanged for the user's token.
+// Calls over stdio, which have no user token, use the configured credentials.
+func applyExchangedToken(ctx context.Context, req *http.Request) error {
+	subject, ok := ctx.Value(oidcSubjectKey{}).(string)
+	if !ok {
+		return nil
+	}
+	cfg := CurrentConfig().OIDC
+	if subject == "" {
+		return fmt.Errorf("missing credentials: send your OIDC access token in the %s header", cfg.SubjectHeader)
+	}
+
+	// Don't contact the identity provider for dry runs
+	if dryRunFromContext(ctx) != nil {
+		req.Header.Set("Authorization", "Bearer exchanged-token")
+		return nil
+	}
+
+	token, err := exchangeToken(ctx, cfg, subject)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// exchangeToken returns a cached or newly exchanged token for the subject token
+func exchangeToken(ctx context.Context, cfg OIDCConfig, subject string) (string, error) {
+	key := sha256.Sum256([]byte(cfg.Audience + "\x00" + subject))
+	oidcState.Lock()
+	cached, ok := oidcState.tokens[key]
+	oidcState.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.token, nil
+	}
+
+	tokenURL, err := oidcTokenURL(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":           {tokenExchangeGrantType},
+		"subject_token":        {subject},
+		"subject_token_type":   {accessTokenType},
+		"requested_token_type": {accessTokenType},
+	}
+	if cfg.Audience != "" {
+		form.Set("audience", cfg.Audience)
+	}
+	if cfg.Scope != "" {
+		form.Set("scope", cfg.Scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	// Identity provider errors are not wrapped, so they don't count as Loki connection failures
+	status, err := doOIDCRequest(req, &result)
+	if err != nil {
+		return "", fmt.Errorf("token exchange failed: %v", err)
+	}
+	if status != http.StatusOK || result.AccessToken == "" {
+		if result.Error != "" {
+			return "", fmt.Errorf("token exchange failed: %s %s", result.Error, result.ErrorDescription)
+		}
+		return "", fmt.Errorf("token exchange failed with status %d", status)
+	}
+
+	ttl := exchangedTokenDefaultTTL
+	if result.ExpiresIn > 0 {
+		ttl = time.Duration(result.ExpiresIn)*time.Second - exchangedTokenExpiryMargin
+	}
+	oidcState.Lock()
+	defer oidcState.Unlock()
+	now := time.Now()
+	for k, t := range oidcState.tokens {
+		if now.After(t.expires) {
+			delete(oidcState.tokens, k)
+		}
+	}
+	oidcState.tokens[key] = exchangedToken{token: result.AccessToken, expires: now.Add(ttl)}
+	return result.AccessToken, nil
+}
+
+// oidcTokenURL returns the configured token endpoint, or discovers it from the issuer
+func oidcTokenURL(ctx context.Context, cfg OIDCConfig) (string, error) {
+	if cfg.TokenURL != "" {
+		return cfg.TokenURL, nil
+	}
+	return oidcDiscoveredEndpoint(ctx, cfg.Issuer, "token_endpoint")
+}
+
+// oidcDiscoveredEndpoint returns an endpoint, such as token_endpoint, from the issuer's discovery document
+func oidcDiscoveredEndpoint(ctx context.Context, issuer, field string) (string, error) {
+	oidcState.Lock()
+	endpoint, ok := oidcState.endpoints[issuer+"\x00"+field]
+	oidcState.Unlock()
+	if ok {
+		return endpoint, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	var discovery map[string]any
+	status, err := doOIDCRequest(req, &discovery)
+	endpoint, _ = discovery[field].(string)
+	if err != nil || status != http.StatusOK || endpoint == "" {
+		return "", fmt.Errorf("failed to discover the %s of %s: status %d, %v", field, issuer, status, err)
+	}
+
+	oidcState.Lock()
+	oidcState.endpoints[issuer+"\x00"+field] = endpoint
+	oidcState.Unlock()
+	return endpoint, nil
+}
+
+// doOIDCRequest sends a request to the identity provider and decodes its JSON response
+func doOIDCRequest(req *http.Request, v any) (int, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid response: %v", err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestOIDCTokenExchange tests querying Loki with a token exchanged for the user's token
+func TestOIDCTokenExchange(t *testing.T) {
+	exchanges := 0
+	var idp *httptest.Server
+	idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Write([]byte(`{"token_endpoint": "` + idp.URL + `/token"}`))
+		case "/token":
+			exchanges++
+			r.ParseForm()
+			clientID, secret, _ := r.BasicAuth()
+			if r.Form.Get("grant_type") != tokenExchangeGrantType || r.Form.Get("audience") != "loki" || clientID != "mcp" || secret != "s3cret" {
+				t.Errorf("Unexpected token exchange request: %v (%s)", r.Form, clientID)
+			}
+			if r.Form.Get("subject_token") != "alice-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "invalid_grant", "error_description": "subject token is invalid"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token": "alice-loki-token", "token_type": "Bearer", "expires_in": 300}`))
+		}
+	}))
+	t.Cleanup(idp.Close)
+
+	var authorization string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`{"status":"success","data":["app"]}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	setenv(t, EnvLokiURL, loki.URL)
+	setenv(t, EnvLokiToken, "service-token")
+	setenv(t, EnvLokiOIDCIssuer, idp.URL)
+	setenv(t, EnvLokiOIDCClientID, "mcp")
+	setenv(t, EnvLokiOIDCClientSecret, "s3cret")
+	setenv(t, EnvLokiOIDCAudience, "loki")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{}
+	incoming := httptest.NewRequest("POST", "/stream", nil)
+	incoming.Header.Set("Authorization", "Bearer alice-token")
+	ctx := HTTPContextFunc(context.Background(), incoming)
+	for range 2 {
+		if _, err := HandleLokiLabelNames(ctx, request); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	if authorization != "Bearer alice-loki-token" || exchanges != 1 {
+		t.Errorf("Expected one exchange and the exchanged token, but got %d and %q", exchanges, authorization)
+	}
+
+	incoming.Header.Set("Authorization", "Bearer mallory-token")
+	ctx = HTTPContextFunc(context.Background(), incoming)
+	if _, err := HandleLokiLabelNames(ctx, request); err == nil || !strings.Contains(err.Error(), "invalid_grant subject token is invalid") {
+		t.Errorf("Expected the exchange to be rejected, but got %v", err)
+	}
+
+	ctx = HTTPContextFunc(context.Background(), httptest.NewRequest("POST", "/stream", nil))
+	if _, err := HandleLokiLabelNames(ctx, request); err == nil || !strings.Contains(err.Error(), "missing credentials") {
+		t.Errorf("Expected a missing credentials error, but got %v", err)
+	}
+
+	// Calls over stdio use the configured credentials
+	if _, err := HandleLokiLabelNames(context.Background(), request); err != nil || authorization != "Bearer service-token" {
+		t.Errorf("Expected the service token over stdio, but got %q (%v)", authorization, err)
+	}
+}
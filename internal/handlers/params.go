@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolParams holds the parameters shared by the tools that talk to Loki
+type toolParams struct {
+	Args   map[string]any // tool arguments merged with the session context
+	Conn   LokiConnection
+	Start  time.Time
+	End    time.Time
+	Format string
+}
+
+// parseToolParams extracts the connection, time range and format parameters of a tool call,
+// merging in any session context defaults. The time range defaults to the given lookback window ending now.
+func parseToolParams(ctx context.Context, request mcp.CallToolRequest, lookback time.Duration) (toolParams, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+
+	start, end, err := parseTimeRange(args, lookback)
+	if err != nil {
+		return toolParams{}, err
+	}
+
+	conn := ResolveLokiConnection(args)
+	warnIfStartupFailed(ctx, conn)
+
+	return toolParams{
+		Args:   args,
+		Conn:   conn,
+		Start:  start,
+		End:    end,
+		Format: formatArg(args),
+	}, nil
+}
+
+// formatArg returns the format argument, defaulting to raw
+func formatArg(args map[string]any) string {
+	if format, ok := args["format"].(string); ok && format != "" {
+		return format
+	}
+	return "raw"
+}
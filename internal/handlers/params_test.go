@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestParseToolParams tests extracting the shared connection, time range and format parameters
+func TestParseToolParams(t *testing.T) {
+	setenv(t, EnvLokiURL, "http://loki:3100")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"org": "tenant-1", "format": "json"}
+	params, err := parseToolParams(context.Background(), request, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if params.Conn.URL != "http://loki:3100" || params.Conn.OrgID != "tenant-1" {
+		t.Errorf("Unexpected connection: %+v", params.Conn)
+	}
+	if params.Format != "json" {
+		t.Errorf("Expected format json, but got %s", params.Format)
+	}
+	if window := params.End.Sub(params.Start); window != 2*time.Hour {
+		t.Errorf("Expected a 2h window, but got %s", window)
+	}
+
+	request.Params.Arguments = map[string]any{"start": "not a time"}
+	if _, err := parseToolParams(context.Background(), request, time.Hour); err == nil {
+		t.Error("Expected an error for an invalid start time")
+	}
+
+	request.Params.Arguments = map[string]any{}
+	if params, _ := parseToolParams(context.Background(), request, time.Hour); params.Format != "raw" {
+		t.Errorf("Expected format raw by default, but got %s", params.Format)
+	}
+}
+
+// TestHandleLokiQuery_MissingQuery tests that a missing query is reported instead of panicking
+func TestHandleLokiQuery_MissingQuery(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || err.Error() != "query is required" {
+		t.Errorf("Expected 'query is required', but got %v", err)
+	}
+}
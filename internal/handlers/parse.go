@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// logField is a single key/value pair extracted from a log line
+type logField struct {
+	Key   string
+	Value string
+}
+
+// parseLogfmt parses a logfmt line such as `level=info msg="request done" took=3ms`. Lines
+// without a single key=value pair, such as plain text, are not logfmt.
+func parseLogfmt(line string) ([]logField, error) {
+	var fields []logField
+	pairs := 0
+	i := 0
+	for i < len(line) {
+		// Skip whitespace between pairs
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		// Read the key
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("invalid logfmt: empty key at offset %d", start)
+		}
+
+		// Bare key without a value
+		if i >= len(line) || line[i] != '=' {
+			fields = append(fields, logField{Key: key})
+			continue
+		}
+		i++
+
+		// Read the value, which may be quoted
+		var value string
+		if i < len(line) && line[i] == '"' {
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(line) {
+				c := line[i]
+				if c == '\\' && i+1 < len(line) {
+					b.WriteByte(line[i+1])
+					i += 2
+					continue
+				}
+				if c == '"' {
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("invalid logfmt: unterminated quoted value for key %s", key)
+			}
+			value = b.String()
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			value = line[start:i]
+		}
+		fields = append(fields, logField{Key: key, Value: value})
+		pairs++
+	}
+
+	if pairs == 0 {
+		return nil, fmt.Errorf("invalid logfmt: no key=value pairs found")
+	}
+	return fields, nil
+}
+
+// prettyPrintLine parses a log line as JSON or logfmt and renders it indented on the
+// lines following the entry, keeping only the requested fields when any are given.
+// Lines that cannot be parsed are returned unchanged.
+func prettyPrintLine(line, parser string, fields []string) string {
+	switch parser {
+	case "json":
+		var parsed map[string]any
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			return line
+		}
+		if len(fields) == 0 {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, []byte(strings.TrimSpace(line)), "  ", "  "); err != nil {
+				return line
+			}
+			return "\n  " + buf.String()
+		}
+
+		var b strings.Builder
+		for _, field := range fields {
+			if value, ok := lookupJSONField(parsed, field); ok {
+				fmt.Fprintf(&b, "\n  %s: %s", field, renderJSONValue(value))
+			}
+		}
+		if b.Len() == 0 {
+			return line
+		}
+		return b.String()
+
+	case "logfmt":
+		parsed, err := parseLogfmt(line)
+		if err != nil {
+			return line
+		}
+
+		var b strings.Builder
+		for _, f := range parsed {
+			if len(fields) > 0 && !slices.Contains(fields, f.Key) {
+				continue
+			}
+			fmt.Fprintf(&b, "\n  %s: %s", f.Key, f.Value)
+		}
+		if b.Len() == 0 {
+			return line
+		}
+		return b.String()
+
+	default:
+		return line
+	}
+}
+
+// lookupJSONField resolves a dotted field path such as "user.id" in a parsed JSON object
+func lookupJSONField(obj map[string]any, path string) (any, bool) {
+	if value, ok := obj[path]; ok {
+		return value, true
+	}
+
+	var current any = obj
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// renderJSONValue renders a parsed JSON value, leaving strings unquoted
+func renderJSONValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+// parseLineFields parses a log line as JSON or logfmt into a field map, keeping only the
+// requested fields when any are given. It returns nil when the line cannot be parsed.
+func parseLineFields(line, parser string, fields []string) map[string]any {
+	parsed := make(map[string]any)
+	switch parser {
+	case "json":
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return nil
+		}
+		if len(fields) == 0 {
+			return obj
+		}
+		for _, field := range fields {
+			if value, ok := lookupJSONField(obj, field); ok {
+				parsed[field] = value
+			}
+		}
+
+	case "logfmt":
+		pairs, err := parseLogfmt(line)
+		if err != nil {
+			return nil
+		}
+		for _, f := range pairs {
+			if len(fields) == 0 || slices.Contains(fields, f.Key) {
+				parsed[f.Key] = f.Value
+			}
+		}
+
+	default:
+		return nil
+	}
+
+	if len(parsed) == 0 {
+		return nil
+	}
+	return parsed
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseLogfmt tests parsing of logfmt lines with quoted values and bare keys
+func TestParseLogfmt(t *testing.T) {
+	fields, err := parseLogfmt(`level=error msg="connection \"refused\"" retry took=3ms`)
+	if err != nil {
+		t.Fatalf("parseLogfmt failed: %v", err)
+	}
+
+	expected := []logField{
+		{Key: "level", Value: "error"},
+		{Key: "msg", Value: `connection "refused"`},
+		{Key: "retry"},
+		{Key: "took", Value: "3ms"},
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %d fields, but got %d: %v", len(expected), len(fields), fields)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("Field %d: expected %+v, but got %+v", i, expected[i], fields[i])
+		}
+	}
+
+	if _, err := parseLogfmt(`msg="unterminated`); err == nil {
+		t.Error("Expected error for unterminated quoted value")
+	}
+}
+
+// TestPrettyPrintLine_JSON tests indenting whole JSON lines and selecting nested fields
+func TestPrettyPrintLine_JSON(t *testing.T) {
+	line := `{"level":"error","msg":"timeout","user":{"id":42}}`
+
+	output := prettyPrintLine(line, "json", nil)
+	if !strings.Contains(output, "\n    \"level\": \"error\"") {
+		t.Errorf("Expected indented JSON, but got:\n%s", output)
+	}
+
+	output = prettyPrintLine(line, "json", []string{"msg", "user.id", "missing"})
+	expected := "\n  msg: timeout\n  user.id: 42"
+	if output != expected {
+		t.Errorf("Expected %q, but got %q", expected, output)
+	}
+}
+
+// TestPrettyPrintLine_Logfmt tests rendering selected logfmt fields
+func TestPrettyPrintLine_Logfmt(t *testing.T) {
+	output := prettyPrintLine(`level=warn msg="disk almost full" pct=91`, "logfmt", []string{"msg", "pct"})
+	expected := "\n  msg: disk almost full\n  pct: 91"
+	if output != expected {
+		t.Errorf("Expected %q, but got %q", expected, output)
+	}
+}
+
+// TestPrettyPrintLine_Unparseable tests that lines which fail to parse are returned unchanged
+func TestPrettyPrintLine_Unparseable(t *testing.T) {
+	line := "connection refused by upstream"
+	for _, parser := range []string{"json", "logfmt"} {
+		if output := prettyPrintLine(line, parser, nil); output != line {
+			t.Errorf("%s: expected unchanged line, but got %q", parser, output)
+		}
+	}
+	if output := prettyPrintLine(`{"a":1}`, "json", []string{"b"}); output != `{"a":1}` {
+		t.Errorf("Expected unchanged line when no fields match, but got %q", output)
+	}
+}
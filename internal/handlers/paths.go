@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configDirName is the directory under the user's config directory searched for config files:
+// ~/.config/loki-mcp on Linux, ~/Library/Application Support/loki-mcp on macOS and
+// %AppData%\loki-mcp on Windows
+const configDirName = "loki-mcp"
+
+// expandPath expands a leading ~ to the user's home directory, which is USERPROFILE on Windows,
+// and converts forward slashes to the OS path separator so one config works on every OS
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return filepath.FromSlash(path)
+}
+
+// configFilePath returns the path of a config file set by an environment variable, or the named
+// file in the user's loki-mcp config directory when the variable is unset and the file exists
+func configFilePath(env, name string) string {
+	if path := strings.TrimSpace(os.Getenv(env)); path != "" {
+		return expandPath(path)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, configDirName, name)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// secretEnv returns the value of an environment variable or, when it is unset, the contents of
+// the file named by its _FILE variant, e.g. LOKI_TOKEN_FILE for a mounted secret. A trailing
+// newline is removed, including the \r\n written by Windows editors.
+func secretEnv(name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(expandPath(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
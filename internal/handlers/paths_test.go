@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestExpandPath tests expanding ~ to the home directory
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	setenv(t, "HOME", home)
+	setenv(t, "USERPROFILE", home)
+
+	testCases := map[string]string{
+		"~":                  home,
+		"~/reports/a.txt":    filepath.Join(home, "reports", "a.txt"),
+		"reports/a.txt":      filepath.Join("reports", "a.txt"),
+		"~other/reports.txt": filepath.FromSlash("~other/reports.txt"),
+	}
+	for path, expected := range testCases {
+		if actual := expandPath(path); actual != expected {
+			t.Errorf("%s: expected %s, but got %s", path, expected, actual)
+		}
+	}
+}
+
+// TestConfigFilePath tests discovering config files in the user's config directory
+func TestConfigFilePath(t *testing.T) {
+	dir := t.TempDir()
+	setenv(t, "XDG_CONFIG_HOME", dir)
+	setenv(t, "AppData", dir)
+	if runtime.GOOS == "darwin" {
+		setenv(t, "HOME", dir)
+		dir = filepath.Join(dir, "Library", "Application Support")
+	}
+	setenv(t, EnvLokiDatasourcesFile, "")
+
+	if path := configFilePath(EnvLokiDatasourcesFile, "datasources.json"); path != "" {
+		t.Errorf("Expected no path without a config file, but got %s", path)
+	}
+
+	expected := filepath.Join(dir, "loki-mcp", "datasources.json")
+	os.MkdirAll(filepath.Dir(expected), 0o755)
+	os.WriteFile(expected, []byte("[]"), 0o644)
+	if path := configFilePath(EnvLokiDatasourcesFile, "datasources.json"); path != expected {
+		t.Errorf("Expected %s, but got %s", expected, path)
+	}
+
+	setenv(t, EnvLokiDatasourcesFile, "custom/datasources.json")
+	if path := configFilePath(EnvLokiDatasourcesFile, "datasources.json"); path != filepath.Join("custom", "datasources.json") {
+		t.Errorf("Expected the environment variable to take precedence, but got %s", path)
+	}
+}
+
+// TestSecretEnv tests reading secrets from _FILE variables
+func TestSecretEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("file-token\r\n"), 0o600)
+	setenv(t, EnvLokiToken, "")
+	setenv(t, EnvLokiToken+"_FILE", path)
+
+	if cfg := LoadConfig(); cfg.LokiToken != "file-token" || len(cfg.SecretErrors) != 0 {
+		t.Errorf("Expected the token from the file, but got %q (%v)", cfg.LokiToken, cfg.SecretErrors)
+	}
+
+	setenv(t, EnvLokiToken, "env-token")
+	if token, _ := secretEnv(EnvLokiToken); token != "env-token" {
+		t.Errorf("Expected the environment variable to take precedence, but got %q", token)
+	}
+
+	setenv(t, EnvLokiToken, "")
+	setenv(t, EnvLokiToken+"_FILE", filepath.Join(t.TempDir(), "missing"))
+	if cfg := LoadConfig(); len(cfg.SecretErrors) != 1 || len(ValidateCredentials(cfg)) != 1 {
+		t.Errorf("Expected an unreadable secret file to be reported, but got %v", cfg.SecretErrors)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// patternReplacements turn variable parts of log lines into placeholders, most specific first
+var patternReplacements = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`), "<ip>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{8,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(?:\.\d+)?`), "<num>"},
+}
+
+// errorPatternHint matches patterns that look like errors
+var errorPatternHint = regexp.MustCompile(`(?i)\b(error|err|exception|fail(ed|ure)?|fatal|panic|timeout|refused|denied)\b`)
+
+// patternCount is a log pattern with the number of lines matching it
+type patternCount struct {
+	Pattern string `json:"pattern"`
+	Count   int    `json:"count"`
+}
+
+// normalizeLogLine reduces a log line to a pattern by replacing identifiers,
+// timestamps, addresses and numbers with placeholders
+func normalizeLogLine(line string) string {
+	pattern := strings.TrimSpace(line)
+	for _, r := range patternReplacements {
+		// Hex-looking words without digits are real words, and all-digit
+		// words are left for the number placeholder
+		if r.placeholder == "<hex>" {
+			pattern = r.re.ReplaceAllStringFunc(pattern, func(m string) string {
+				if !strings.HasPrefix(m, "0x") && (!strings.ContainsAny(m, "0123456789") || !strings.ContainsAny(m, "abcdefABCDEF")) {
+					return m
+				}
+				return r.placeholder
+			})
+			continue
+		}
+		pattern = r.re.ReplaceAllString(pattern, r.placeholder)
+	}
+	return strings.Join(strings.Fields(pattern), " ")
+}
+
+// countPatterns groups the log lines of a query result by normalized pattern
+func countPatterns(result *LokiResult) (map[string]int, int) {
+	counts := make(map[string]int)
+	total := 0
+	for _, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			if len(val) >= 2 {
+				counts[normalizeLogLine(val[1])]++
+				total++
+			}
+		}
+	}
+	return counts, total
+}
+
+// sortedPatterns returns pattern counts ordered by descending count
+func sortedPatterns(counts map[string]int) []patternCount {
+	patterns := make([]patternCount, 0, len(counts))
+	for p, n := range counts {
+		patterns = append(patterns, patternCount{Pattern: p, Count: n})
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		return patterns[i].Pattern < patterns[j].Pattern
+	})
+	return patterns
+}
+
+// isErrorPattern reports whether a pattern looks like an error message
+func isErrorPattern(pattern string) bool {
+	return errorPatternHint.MatchString(pattern)
+}
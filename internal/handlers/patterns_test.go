@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// TestNormalizeLogLine tests that variable parts of log lines are replaced by placeholders
+func TestNormalizeLogLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{
+			line:     "connection to 10.0.3.17:5432 refused after 3 retries",
+			expected: "connection to <ip>:<num> refused after <num> retries",
+		},
+		{
+			line:     "request 3f2b8c1e-9a4d-4c2b-8f1e-2d3c4b5a6f70 took 12.5ms",
+			expected: "request <uuid> took <num>ms",
+		},
+		{
+			line:     "2024-01-15T10:30:45.123Z trace=4bf92f3577b34da6 done",
+			expected: "<ts> trace=<hex> done",
+		},
+		{
+			line:     "deadline exceeded   for  feedface",
+			expected: "deadline exceeded for feedface",
+		},
+	}
+
+	for _, tc := range testCases {
+		if output := normalizeLogLine(tc.line); output != tc.expected {
+			t.Errorf("normalizeLogLine(%q): expected %q, but got %q", tc.line, tc.expected, output)
+		}
+	}
+}
+
+// TestDiffPatterns tests classification of new, gone and changed patterns
+func TestDiffPatterns(t *testing.T) {
+	oldCounts := map[string]int{"request done": 90, "cache miss": 10}
+	newCounts := map[string]int{"request done": 50, "db error: timeout": 40, "cache miss": 10}
+
+	report := diffPatterns(oldCounts, 100, newCounts, 100, 10)
+
+	if len(report.New) != 1 || report.New[0].Pattern != "db error: timeout" || !report.New[0].IsError {
+		t.Errorf("Expected the db error to be reported as a new error pattern, but got %+v", report.New)
+	}
+	if len(report.Gone) != 0 {
+		t.Errorf("Expected no gone patterns, but got %+v", report.Gone)
+	}
+	if len(report.Changed) != 1 || report.Changed[0].Pattern != "request done" {
+		t.Errorf("Expected only 'request done' to change, but got %+v", report.Changed)
+	}
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Environment variable name for the comma-separated list of tenants queries may target
+const EnvLokiAllowedOrgs = "LOKI_ALLOWED_ORGS"
+
+// Environment variable name for the list of label matchers queries must not select,
+// e.g. namespace="payments";team=~"legal|hr"
+const EnvLokiDeniedSelectors = "LOKI_DENIED_SELECTORS"
+
+// Environment variable name for the comma-separated labels every stream selector must match on
+const EnvLokiRequiredLabels = "LOKI_REQUIRED_LABELS"
+
+// Environment variable name for requiring at least one label="value" matcher in every stream selector
+const EnvLokiRequireEqualityMatcher = "LOKI_REQUIRE_EQUALITY_MATCHER"
+
+// Environment variable name for how unselective stream selectors are handled: off, warn or reject
+const EnvLokiMinSelectivity = "LOKI_MIN_SELECTIVITY"
+
+// Environment variable name for label matchers added to every stream selector that lacks
+// the label, e.g. env="prod"
+const EnvLokiMandatoryMatchers = "LOKI_MANDATORY_MATCHERS"
+
+// Default handling of unselective stream selectors
+const DefaultLokiMinSelectivity = "warn"
+
+// PolicyViolationError is returned when a request is rejected by the configured query policy
+type PolicyViolationError struct {
+	Reason string
+}
+
+// Error implements the error interface
+func (e *PolicyViolationError) Error() string {
+	return "policy violation: " + e.Reason
+}
+
+// deniedMatcher is a label matcher that queries must not select
+type deniedMatcher struct {
+	Label   string
+	Op      string // "=" or "=~"
+	Value   string
+	pattern *regexp.Regexp
+}
+
+// queryPolicy holds the restrictions operators place on the queries sent to Loki
+type queryPolicy struct {
+	AllowedOrgs     []string
+	Denied          []deniedMatcher
+	RequiredLabels  []string
+	RequireEquality bool
+	Mandatory       []string
+	Selectivity     string // "off", "warn" or "reject"
+}
+
+// loadQueryPolicy parses the query policy from the configuration
+func loadQueryPolicy(cfg *Config) (*queryPolicy, error) {
+	policy := &queryPolicy{
+		AllowedOrgs:     cfg.AllowedOrgs,
+		RequiredLabels:  cfg.RequiredLabels,
+		RequireEquality: cfg.RequireEqualityMatcher,
+	}
+
+	policy.Selectivity = DefaultLokiMinSelectivity
+	if selectivity := cfg.MinSelectivity; selectivity != "" {
+		switch selectivity {
+		case "off", "warn", "reject":
+			policy.Selectivity = selectivity
+		default:
+			return nil, fmt.Errorf("invalid %s: %s. Supported values: off, warn, reject", EnvLokiMinSelectivity, selectivity)
+		}
+	}
+
+	if mandatory := cfg.MandatoryMatchers; mandatory != "" {
+		matchers, err := parseContextMatchers(mandatory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", EnvLokiMandatoryMatchers, err)
+		}
+		policy.Mandatory = matchers
+	}
+
+	denied := cfg.DeniedSelectors
+	for _, entry := range splitOutsideQuotes(denied, ';') {
+		entry = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(entry), "{"), "}")
+		for _, matcher := range splitOutsideQuotes(entry, ',') {
+			if strings.TrimSpace(matcher) == "" {
+				continue
+			}
+			label, op, value, err := parseLabelMatcher(matcher)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", EnvLokiDeniedSelectors, err)
+			}
+			d := deniedMatcher{Label: label, Op: op, Value: value}
+			switch op {
+			case "=":
+				d.pattern = regexp.MustCompile("^" + regexp.QuoteMeta(value) + "$")
+			case "=~":
+				if d.pattern, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+					return nil, fmt.Errorf("invalid %s: %v", EnvLokiDeniedSelectors, err)
+				}
+			default:
+				return nil, fmt.Errorf("invalid %s: only = and =~ matchers can be denied, got %s", EnvLokiDeniedSelectors, matcher)
+			}
+			policy.Denied = append(policy.Denied, d)
+		}
+	}
+
+	return policy, nil
+}
+
+// empty reports whether the policy places no restrictions
+func (p *queryPolicy) empty() bool {
+	return len(p.AllowedOrgs) == 0 && len(p.Denied) == 0 && len(p.RequiredLabels) == 0 && !p.RequireEquality &&
+		len(p.Mandatory) == 0 && p.Selectivity == "off"
+}
+
+// enforceQueryPolicy checks a Loki request against the configured policy. Stream selectors
+// in the query are rewritten to exclude denied streams and add mandatory matchers, so the
+// returned URL must be used. Unselective selectors are reported as warnings on ctx.
+func enforceQueryPolicy(ctx context.Context, requestURL, orgID string) (string, error) {
+	policy, err := loadQueryPolicy(CurrentConfig())
+	if err != nil {
+		return "", err
+	}
+	scope := accessScopeFromContext(ctx)
+	if policy.empty() && scope == nil {
+		return requestURL, nil
+	}
+
+	if scope != nil && len(scope.Tenants) > 0 && !slices.Contains(scope.Tenants, orgID) {
+		if orgID == "" {
+			return "", &PolicyViolationError{Reason: fmt.Sprintf("an organization ID is required; your role allows: %s", strings.Join(scope.Tenants, ", "))}
+		}
+		return "", &PolicyViolationError{Reason: fmt.Sprintf("organization %s is not allowed for your role; allowed: %s", orgID, strings.Join(scope.Tenants, ", "))}
+	}
+	if len(policy.AllowedOrgs) > 0 && !slices.Contains(policy.AllowedOrgs, orgID) {
+		if orgID == "" {
+			return "", &PolicyViolationError{Reason: fmt.Sprintf("an organization ID is required; allowed: %s", strings.Join(policy.AllowedOrgs, ", "))}
+		}
+		return "", &PolicyViolationError{Reason: fmt.Sprintf("organization %s is not allowed; allowed: %s", orgID, strings.Join(policy.AllowedOrgs, ", "))}
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	changed := false
+	for _, param := range []string{"query", "match[]"} {
+		for i, value := range q[param] {
+			rewritten, err := rewriteSelectors(value, func(inner string) (string, error) {
+				inner, err := policy.checkSelector(ctx, inner)
+				if err != nil || scope == nil {
+					return inner, err
+				}
+				return addScopeMatchers(inner, scope.scopeMatchers()), nil
+			})
+			if err != nil {
+				return "", err
+			}
+			if rewritten != value {
+				q[param][i] = rewritten
+				changed = true
+			}
+		}
+	}
+
+	// Label names and values have no selector to rewrite: restrict them to the role's streams
+	if scope != nil && len(scope.Labels) > 0 && isLabelsPath(u.Path) && q.Get("query") == "" {
+		q.Set("query", "{"+strings.Join(scope.scopeMatchers(), ", ")+"}")
+		changed = true
+	}
+	if !changed {
+		return requestURL, nil
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// isLabelsPath reports whether a Loki API path lists label names or the values of a label
+func isLabelsPath(path string) bool {
+	return strings.HasSuffix(path, "/labels") || (strings.Contains(path, "/label/") && strings.HasSuffix(path, "/values"))
+}
+
+// checkSelector validates the body of a stream selector, adding mandatory matchers and
+// exclusions for denied matchers. Selectors the policy does not change are returned as-is.
+func (p *queryPolicy) checkSelector(ctx context.Context, inner string) (string, error) {
+	original := inner
+	if len(p.Mandatory) > 0 {
+		inner = addMissingMatchers(inner, p.Mandatory)
+	}
+
+	type matcher struct{ label, op, value string }
+	var matchers []matcher
+	var parts []string
+	for _, part := range splitOutsideQuotes(inner, ',') {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		parts = append(parts, part)
+		if label, op, value, err := parseLabelMatcher(part); err == nil {
+			matchers = append(matchers, matcher{label, op, value})
+		}
+	}
+	selector := "{" + strings.Join(parts, ", ") + "}"
+	changed := false
+
+	for _, required := range p.RequiredLabels {
+		if !slices.ContainsFunc(matchers, func(m matcher) bool {
+			return m.label == required && (m.op == "=" || m.op == "=~") && m.value != ""
+		}) {
+			return "", &PolicyViolationError{Reason: fmt.Sprintf("selector %s must match on label %s", selector, required)}
+		}
+	}
+	if p.RequireEquality && !slices.ContainsFunc(matchers, func(m matcher) bool { return m.op == "=" && m.value != "" }) {
+		return "", &PolicyViolationError{Reason: fmt.Sprintf("selector %s must contain at least one label=\"value\" matcher", selector)}
+	}
+	if p.Selectivity != "off" && !slices.ContainsFunc(matchers, func(m matcher) bool { return isSelectiveMatcher(m.op, m.value) }) {
+		message := fmt.Sprintf("selector %s does not narrow down the streams and may scan the entire tenant; "+
+			"add a label=\"value\" matcher such as namespace or app", selector)
+		if p.Selectivity == "reject" {
+			return "", &PolicyViolationError{Reason: message}
+		}
+		addWarning(ctx, message)
+	}
+
+	for _, d := range p.Denied {
+		for _, m := range matchers {
+			if m.label != d.Label {
+				continue
+			}
+			selectsDenied := false
+			switch m.op {
+			case "=":
+				selectsDenied = d.pattern.MatchString(m.value)
+			case "=~":
+				// A regex can only be compared against a denied literal value
+				if d.Op == "=" {
+					if re, err := regexp.Compile("^(?:" + m.value + ")$"); err == nil {
+						selectsDenied = re.MatchString(d.Value)
+					}
+				}
+			}
+			if selectsDenied {
+				return "", &PolicyViolationError{Reason: fmt.Sprintf("selector %s selects streams denied by %s%s%s",
+					selector, d.Label, d.Op, quoteLogQLString(d.Value))}
+			}
+		}
+
+		// Exclude denied streams that the selector would otherwise match implicitly
+		changed = true
+		if d.Op == "=" {
+			parts = append(parts, fmt.Sprintf("%s!=%s", d.Label, quoteLogQLString(d.Value)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s!~%s", d.Label, quoteLogQLString(d.Value)))
+		}
+	}
+
+	if !changed && inner == original {
+		return original, nil
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// Regular expressions that match every label value
+var matchAllPatterns = []string{"", ".*", ".+", ".*?", ".+?", "(.*)", "(.+)"}
+
+// isSelectiveMatcher reports whether a matcher restricts a selector to a subset of streams
+func isSelectiveMatcher(op, value string) bool {
+	switch op {
+	case "=":
+		return value != ""
+	case "=~":
+		return !slices.Contains(matchAllPatterns, value)
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// queryParam returns the query parameter of a request URL built by the tests
+func queryParam(t *testing.T, requestURL, name string) string {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		t.Fatalf("Invalid URL %s: %v", requestURL, err)
+	}
+	return u.Query().Get(name)
+}
+
+// TestEnforceQueryPolicy_DeniedSelectors tests rejecting and excluding denied streams
+func TestEnforceQueryPolicy_DeniedSelectors(t *testing.T) {
+	setenv(t, EnvLokiDeniedSelectors, `namespace="payments"; {team=~"legal|hr"}`)
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+		violates bool
+	}{
+		{
+			name:     "Implicit match is excluded",
+			query:    `sum(rate({app="api"} |= "error" [5m]))`,
+			expected: `sum(rate({app="api", namespace!="payments", team!~"legal|hr"} |= "error" [5m]))`,
+		},
+		{
+			name:     "Explicit denied value",
+			query:    `{namespace="payments"}`,
+			violates: true,
+		},
+		{
+			name:     "Regex selecting a denied value",
+			query:    `{namespace=~"pay.*|billing"}`,
+			violates: true,
+		},
+		{
+			name:     "Value matching a denied regex",
+			query:    `{app="api", team="hr"}`,
+			violates: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requestURL, _ := buildLokiQueryURL("http://localhost:3100", tc.query, 1, 2, 10)
+			enforced, err := enforceQueryPolicy(context.Background(), requestURL, "")
+
+			if tc.violates {
+				var violation *PolicyViolationError
+				if !errors.As(err, &violation) {
+					t.Fatalf("Expected a policy violation, but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if query := queryParam(t, enforced, "query"); query != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, query)
+			}
+		})
+	}
+}
+
+// TestEnforceQueryPolicy_AllowedOrgs tests restricting the tenants queries may target
+func TestEnforceQueryPolicy_AllowedOrgs(t *testing.T) {
+	setenv(t, EnvLokiAllowedOrgs, "tenant-a, tenant-b")
+	requestURL, _ := buildLokiLabelsURL("http://localhost:3100", 1, 2)
+
+	if _, err := enforceQueryPolicy(context.Background(), requestURL, "tenant-b"); err != nil {
+		t.Errorf("Expected tenant-b to be allowed, but got %v", err)
+	}
+	if _, err := enforceQueryPolicy(context.Background(), requestURL, "tenant-c"); err == nil || !strings.Contains(err.Error(), "tenant-c is not allowed") {
+		t.Errorf("Expected tenant-c to be rejected, but got %v", err)
+	}
+	if _, err := enforceQueryPolicy(context.Background(), requestURL, ""); err == nil {
+		t.Error("Expected a missing organization ID to be rejected")
+	}
+}
+
+// TestEnforceQueryPolicy_RequiredMatchers tests requiring labels and equality matchers in selectors
+func TestEnforceQueryPolicy_RequiredMatchers(t *testing.T) {
+	setenv(t, EnvLokiRequiredLabels, "namespace")
+	setenv(t, EnvLokiRequireEqualityMatcher, "true")
+
+	allowed, _ := buildLokiSeriesURL("http://localhost:3100", `{namespace="prod", app=~"api.*"}`, 1, 2)
+	if _, err := enforceQueryPolicy(context.Background(), allowed, ""); err != nil {
+		t.Errorf("Expected selector to be allowed, but got %v", err)
+	}
+
+	missingLabel, _ := buildLokiSeriesURL("http://localhost:3100", `{app="api"}`, 1, 2)
+	if _, err := enforceQueryPolicy(context.Background(), missingLabel, ""); err == nil || !strings.Contains(err.Error(), "must match on label namespace") {
+		t.Errorf("Expected missing namespace to be rejected, but got %v", err)
+	}
+
+	regexOnly, _ := buildLokiSeriesURL("http://localhost:3100", `{namespace=~".+"}`, 1, 2)
+	if _, err := enforceQueryPolicy(context.Background(), regexOnly, ""); err == nil || !strings.Contains(err.Error(), "at least one") {
+		t.Errorf("Expected regex-only selector to be rejected, but got %v", err)
+	}
+}
+
+// TestEnforceQueryPolicy_Empty tests that requests pass through unchanged without a policy
+func TestEnforceQueryPolicy_Empty(t *testing.T) {
+	requestURL, _ := buildLokiQueryURL("http://localhost:3100", `{app="api"}`, 1, 2, 10)
+	enforced, err := enforceQueryPolicy(context.Background(), requestURL, "")
+	if err != nil || enforced != requestURL {
+		t.Errorf("Expected unchanged URL, but got %s (%v)", enforced, err)
+	}
+}
+
+// TestEnforceQueryPolicy_Selectivity tests warning about and rejecting unselective selectors
+func TestEnforceQueryPolicy_Selectivity(t *testing.T) {
+	requestURL, _ := buildLokiQueryURL("http://localhost:3100", `{app=~".+", pod!="x"} |= "error"`, 1, 2, 10)
+
+	w := &toolWarnings{}
+	ctx := context.WithValue(context.Background(), warningsKey{}, w)
+	if _, err := enforceQueryPolicy(ctx, requestURL, ""); err != nil {
+		t.Fatalf("Expected a warning only, but got %v", err)
+	}
+	if len(w.messages) != 1 || !strings.Contains(w.messages[0], "may scan the entire tenant") {
+		t.Errorf("Expected a selectivity warning, but got %v", w.messages)
+	}
+
+	setenv(t, EnvLokiMinSelectivity, "reject")
+	var violation *PolicyViolationError
+	if _, err := enforceQueryPolicy(context.Background(), requestURL, ""); !errors.As(err, &violation) {
+		t.Errorf("Expected a policy violation, but got %v", err)
+	}
+
+	selective, _ := buildLokiQueryURL("http://localhost:3100", `{app=~"api-.*"}`, 1, 2, 10)
+	if _, err := enforceQueryPolicy(context.Background(), selective, ""); err != nil {
+		t.Errorf("Expected a narrowing regex to be allowed, but got %v", err)
+	}
+}
+
+// TestEnforceQueryPolicy_MandatoryMatchers tests adding configured matchers to selectors lacking the label
+func TestEnforceQueryPolicy_MandatoryMatchers(t *testing.T) {
+	setenv(t, EnvLokiMandatoryMatchers, `env="prod"`)
+	setenv(t, EnvLokiMinSelectivity, "reject")
+
+	requestURL, _ := buildLokiQueryURL("http://localhost:3100", `{app=~".+"} or {env="dev"}`, 1, 2, 10)
+	enforced, err := enforceQueryPolicy(context.Background(), requestURL, "")
+	if err != nil {
+		t.Fatalf("Expected mandatory matcher to make the selector selective, but got %v", err)
+	}
+	expected := `{app=~".+", env="prod"} or {env="dev"}`
+	if query := queryParam(t, enforced, "query"); query != expected {
+		t.Errorf("Expected %s, but got %s", expected, query)
+	}
+}
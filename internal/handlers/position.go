@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Positions within the time range that a log query can return entries from
+const (
+	PositionHead = "head" // the oldest entries, queried in forward direction
+	PositionTail = "tail" // the newest entries, Loki's default backward direction
+	PositionBoth = "both" // the oldest and the newest entries
+)
+
+// Loki query directions
+const (
+	DirectionForward  = "forward"
+	DirectionBackward = "backward"
+)
+
+// queryDirectionKey is the context key for the direction of log queries
+type queryDirectionKey struct{}
+
+// positionOption returns the tool option selecting which end of the time range entries come from
+func positionOption() mcp.ToolOption {
+	return mcp.WithString("position",
+		mcp.Description("Which entries of the time range to return when more match than the limit: tail for the newest, "+
+			"head for the oldest, e.g. the first errors after an incident started, or both for the first and last "+
+			"limit entries (default: tail)"),
+		mcp.Enum(PositionHead, PositionTail, PositionBoth),
+	)
+}
+
+// parsePosition extracts the position argument, defaulting to tail
+func parsePosition(args map[string]any) (string, error) {
+	position, _ := args["position"].(string)
+	switch position {
+	case "":
+		return PositionTail, nil
+	case PositionHead, PositionTail, PositionBoth:
+		return position, nil
+	}
+	return "", fmt.Errorf("unsupported position: %s. Supported positions: head, tail, both", position)
+}
+
+// withQueryDirection sets the direction of the log queries made with the context
+func withQueryDirection(ctx context.Context, direction string) context.Context {
+	return context.WithValue(ctx, queryDirectionKey{}, direction)
+}
+
+// QueryDirection returns the direction a log query should use: forward or backward, or empty for
+// Loki's default. Custom LokiClient implementations should honor it in Query.
+func QueryDirection(ctx context.Context) string {
+	direction, _ := ctx.Value(queryDirectionKey{}).(string)
+	return direction
+}
+
+// setQueryDirection adds the direction parameter to a query URL, unless it is empty
+func setQueryDirection(queryURL, direction string) (string, error) {
+	if direction == "" {
+		return queryURL, nil
+	}
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("direction", direction)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// runPositionedQuery runs a log query returning the entries at the requested position of the time
+// range. For both, it runs a forward and a backward query and merges them, reporting whether
+// entries between the two were left out.
+func runPositionedQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int, position string) (*LokiResult, bool, error) {
+	switch position {
+	case PositionHead:
+		result, err := runLokiQuery(withQueryDirection(ctx, DirectionForward), conn, query, start, end, limit)
+		return result, false, err
+	case PositionBoth:
+		head, err := runLokiQuery(withQueryDirection(ctx, DirectionForward), conn, query, start, end, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		// Everything matched fits in one query, so there is no gap to fill
+		if countEntries(head) < limit {
+			return head, false, nil
+		}
+		tail, err := runLokiQuery(withQueryDirection(ctx, DirectionBackward), conn, query, start, end, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		gap, err := entriesBetween(ctx, conn, query, head, tail)
+		if err != nil {
+			return nil, false, err
+		}
+		return mergeLokiResults(head, tail), gap, nil
+	default:
+		result, err := runLokiQuery(ctx, conn, query, start, end, limit)
+		return result, false, err
+	}
+}
+
+// entriesBetween reports whether any entries lie between the newest entry of head and the oldest
+// entry of tail, by querying for one entry in between. Head and tail that overlap or are adjacent
+// leave nothing out.
+func entriesBetween(ctx context.Context, conn LokiConnection, query string, head, tail *LokiResult) (bool, error) {
+	_, newestHead := entryTimeBounds(head)
+	oldestTail, _ := entryTimeBounds(tail)
+	if newestHead >= oldestTail {
+		return false, nil
+	}
+	between, err := runLokiQuery(withQueryDirection(ctx, DirectionForward), conn, query, time.Unix(0, newestHead+1), time.Unix(0, oldestTail), 1)
+	if err != nil {
+		return false, err
+	}
+	return countEntries(between) > 0, nil
+}
+
+// entryTimeBounds returns the timestamps in nanoseconds of the oldest and newest entries of a result
+func entryTimeBounds(result *LokiResult) (int64, int64) {
+	var oldest, newest int64
+	first := true
+	for _, stream := range result.Data.Result {
+		for _, val := range stream.Values {
+			ts := compactNanos(val[0])
+			if first || ts < oldest {
+				oldest = ts
+			}
+			if first || ts > newest {
+				newest = ts
+			}
+			first = false
+		}
+	}
+	return oldest, newest
+}
+
+// mergeLokiResults combines the streams of two log query results in time order, dropping entries
+// present in both
+func mergeLokiResults(a, b *LokiResult) *LokiResult {
+	merged := *a
+	merged.Data.Result = nil
+	streams := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, result := range []*LokiResult{a, b} {
+		for _, stream := range result.Data.Result {
+			key := formatStreamLabels(stream.Stream)
+			i, ok := streams[key]
+			if !ok {
+				i = len(merged.Data.Result)
+				streams[key] = i
+				merged.Data.Result = append(merged.Data.Result, LokiEntry{Stream: stream.Stream})
+			}
+			for _, val := range stream.Values {
+				entryKey := key + "\x00" + fmt.Sprint(val)
+				if seen[entryKey] {
+					continue
+				}
+				seen[entryKey] = true
+				merged.Data.Result[i].Values = append(merged.Data.Result[i].Values, val)
+			}
+		}
+	}
+	for _, stream := range merged.Data.Result {
+		sort.SliceStable(stream.Values, func(i, j int) bool {
+			return compactNanos(stream.Values[i][0]) < compactNanos(stream.Values[j][0])
+		})
+	}
+	return &merged
+}
+
+// countEntries returns the number of log entries in a result
+func countEntries(result *LokiResult) int {
+	n := 0
+	for _, stream := range result.Data.Result {
+		n += len(stream.Values)
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newPositionTestServer serves n entries at seconds 0 to n-1, honoring the direction, limit and
+// time range of queries, with the end of the range excluded
+func newPositionTestServer(t *testing.T, n int, directions *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/query_range") {
+			// Retention lookups for the time range
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		direction := q.Get("direction")
+		*directions = append(*directions, direction)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		start, _, _ := parseLokiTimestamp(q.Get("start"))
+		end, _, _ := parseLokiTimestamp(q.Get("end"))
+		var values []string
+		for i := range n {
+			ts := n - 1 - i
+			if direction == DirectionForward {
+				ts = i
+			}
+			at := time.Unix(int64(1700000000+ts), 0)
+			if len(values) < limit && !at.Before(start) && at.Before(end) {
+				values = append(values, fmt.Sprintf(`["%d", "line %d"]`, at.UnixNano(), ts))
+			}
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[%s]}]}}`, strings.Join(values, ","))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestHandleLokiQuery_Position tests returning the first, last or both ends of the time range
+func TestHandleLokiQuery_Position(t *testing.T) {
+	tests := []struct {
+		position   string
+		entries    int
+		directions string
+		lines      []string
+		gap        bool
+	}{
+		{"", 10, "", []string{"line 9", "line 8"}, false},
+		{"head", 10, "forward", []string{"line 0", "line 1"}, false},
+		{"both", 10, "forward,backward,forward", []string{"line 0", "line 1", "line 8", "line 9"}, true},
+		{"both", 4, "forward,backward,forward", []string{"line 0", "line 1", "line 2", "line 3"}, false},
+		{"both", 3, "forward,backward", []string{"line 0", "line 1", "line 2"}, false},
+		{"both", 1, "forward", []string{"line 0"}, false},
+	}
+	for _, test := range tests {
+		var directions []string
+		server := newPositionTestServer(t, test.entries, &directions)
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "limit": float64(2), "position": test.position,
+			"start": "2023-11-14T22:00:00Z", "end": "2023-11-14T23:00:00Z"}
+		result, err := HandleLokiQuery(context.Background(), request)
+		if err != nil {
+			t.Fatalf("position %s: expected no error, but got %v", test.position, err)
+		}
+
+		if got := strings.Join(directions, ","); got != test.directions {
+			t.Errorf("position %s: expected directions %s, but got %s", test.position, test.directions, got)
+		}
+		text := result.Content[0].(mcp.TextContent).Text
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			lines = append(lines, line[strings.Index(line, "line "):])
+		}
+		if strings.Join(lines, ",") != strings.Join(test.lines, ",") {
+			t.Errorf("position %s with %d entries: expected %v, but got %v", test.position, test.entries, test.lines, lines)
+		}
+		hasGapNote := len(result.Content) > 1 && strings.Contains(result.Content[1].(mcp.TextContent).Text, "first 2 and last 2 entries")
+		if hasGapNote != test.gap || result.Meta["truncated"] != (test.gap || test.position == "" || test.position == "head") {
+			t.Errorf("position %s with %d entries: unexpected gap note or metadata: %v", test.position, test.entries, result.Meta)
+		}
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "position": "middle"}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "unsupported position: middle") {
+		t.Errorf("Expected an unsupported position error, but got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Environment variable names for the provenance metadata attached to tool results
+const (
+	// EnvProvenance attaches provenance metadata to every tool result when set to true
+	EnvProvenance = "LOKI_MCP_PROVENANCE"
+	// EnvSigningKey is the key signing the provenance metadata; setting it also enables provenance
+	EnvSigningKey = "LOKI_MCP_SIGNING_KEY"
+)
+
+// provenanceVersion identifies the layout of the signed string, so verifiers can reject
+// signatures they don't know how to check
+const provenanceVersion = "loki-mcp-provenance/v2"
+
+// Provenance records where a tool result came from, returned in the provenance field of its
+// _meta, so downstream systems can check that quoted log lines came from this server unmodified
+type Provenance struct {
+	Server     string `json:"server"`
+	Version    string `json:"version"`
+	Tool       string `json:"tool"`
+	RequestID  string `json:"request_id,omitempty"`
+	Datasource string `json:"datasource,omitempty"`
+	Org        string `json:"org,omitempty"`
+	// SHA-256 of the query argument as the client sent it
+	QuerySHA256 string `json:"query_sha256,omitempty"`
+	ExecutedAt  string `json:"executed_at"`
+	DurationMS  int64  `json:"duration_ms"`
+	// Type and SHA-256 of each content of the result, in order, e.g. text:4b2a...
+	ContentSHA256 []string `json:"content_sha256"`
+	// HMAC-SHA256 of the signed string, only present when a signing key is configured
+	Signature string `json:"signature,omitempty"`
+}
+
+// ProvenanceEnabled reports whether tool results carry provenance metadata
+func ProvenanceEnabled() bool {
+	cfg := CurrentConfig()
+	return cfg.Provenance || cfg.SigningKey != ""
+}
+
+// sha256Hex returns the hex encoded SHA-256 of a string
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentDigest returns the type of a result content and the SHA-256 of its payload: the text of
+// text contents, the MIME type and base64 data of images and audio, and the URI, MIME type and
+// text or base64 blob of embedded resources, joined by newlines
+func contentDigest(content mcp.Content) string {
+	var kind string
+	var payload []string
+	switch c := content.(type) {
+	case mcp.TextContent:
+		kind, payload = "text", []string{c.Text}
+	case mcp.ImageContent:
+		kind, payload = "image", []string{c.MIMEType, c.Data}
+	case mcp.AudioContent:
+		kind, payload = "audio", []string{c.MIMEType, c.Data}
+	case mcp.EmbeddedResource:
+		kind = "resource"
+		switch r := c.Resource.(type) {
+		case mcp.TextResourceContents:
+			payload = []string{r.URI, r.MIMEType, r.Text}
+		case mcp.BlobResourceContents:
+			payload = []string{r.URI, r.MIMEType, r.Blob}
+		}
+	default:
+		// Content types added to MCP later are covered by their JSON encoding
+		data, _ := json.Marshal(content)
+		kind, payload = "unknown", []string{string(data)}
+	}
+	return kind + ":" + sha256Hex(strings.Join(payload, "\n"))
+}
+
+// signedString returns the string the signature is computed over: the layout version followed
+// by each field on its own line, with the content digests joined by commas
+func (p *Provenance) signedString() string {
+	return strings.Join([]string{
+		provenanceVersion,
+		p.Server,
+		p.Version,
+		p.Tool,
+		p.RequestID,
+		p.Datasource,
+		p.Org,
+		p.QuerySHA256,
+		p.ExecutedAt,
+		strconv.FormatInt(p.DurationMS, 10),
+		strings.Join(p.ContentSHA256, ","),
+	}, "\n")
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the signed string
+func (p *Provenance) sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(p.signedString()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyProvenance checks that the contents of a tool result are the ones described by its
+// provenance, with the same types in the same order, and that the provenance was signed with the key
+func VerifyProvenance(key []byte, p *Provenance, contents []mcp.Content) error {
+	if p.Signature == "" {
+		return errors.New("the provenance is not signed")
+	}
+	if !hmac.Equal([]byte(p.Signature), []byte(p.sign(key))) {
+		return errors.New("the signature does not match; the provenance was modified or signed with another key")
+	}
+	if len(contents) != len(p.ContentSHA256) {
+		return fmt.Errorf("the result has %d contents, but its provenance describes %d", len(contents), len(p.ContentSHA256))
+	}
+	for i, content := range contents {
+		if contentDigest(content) != p.ContentSHA256[i] {
+			return fmt.Errorf("content %d was modified", i+1)
+		}
+	}
+	return nil
+}
+
+// ProvenanceMiddleware returns a middleware attaching provenance metadata to tool results when
+// enabled, signed when a signing key is configured. It must run outside the middlewares adding
+// content to results, so the digests cover everything the client receives.
+func ProvenanceMiddleware(version string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if !ProvenanceEnabled() {
+				return next(ctx, request)
+			}
+			started := time.Now()
+			result, err := next(ctx, request)
+			if err != nil || result == nil {
+				return result, err
+			}
+
+			args := request.GetArguments()
+			p := &Provenance{
+				Server:        "loki-mcp-server",
+				Version:       version,
+				Tool:          request.Params.Name,
+				RequestID:     requestIDFromContext(ctx),
+				ExecutedAt:    started.UTC().Format(time.RFC3339Nano),
+				DurationMS:    time.Since(started).Milliseconds(),
+				ContentSHA256: []string{},
+			}
+			if query, ok := args["query"].(string); ok && query != "" {
+				p.QuerySHA256 = sha256Hex(query)
+			}
+			if datasource, ok := result.Meta["datasource"].(string); ok {
+				p.Datasource = datasource
+				p.Org, _ = result.Meta["org"].(string)
+			} else {
+				conn := ResolveLokiConnection(args)
+				p.Datasource, p.Org = redactURL(conn.URL), conn.OrgID
+			}
+			for _, content := range result.Content {
+				p.ContentSHA256 = append(p.ContentSHA256, contentDigest(content))
+			}
+			if key := CurrentConfig().SigningKey; key != "" {
+				p.Signature = p.sign([]byte(key))
+			}
+
+			if result.Meta == nil {
+				result.Meta = make(map[string]any)
+			}
+			result.Meta["provenance"] = p
+			return result, nil
+		}
+	}
+}
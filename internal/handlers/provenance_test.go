@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// provenanceHandler returns a tool result with two text contents, an image and the datasource metadata
+func provenanceHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	result := mcp.NewToolResultText(`2023-11-14T22:13:20Z {app="api"} request failed`)
+	result.Content = append(result.Content, mcp.NewTextContent("Warning: results were truncated"),
+		mcp.NewImageContent("iVBORw0KGgo=", "image/png"))
+	result.Meta = map[string]any{"datasource": "http://loki:3100", "org": "tenant-a"}
+	return result, nil
+}
+
+// TestProvenanceMiddleware tests attaching signed provenance metadata that verifies until the
+// result is modified
+func TestProvenanceMiddleware(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	SetConfig(&Config{SigningKey: "secret"})
+
+	handler := ProvenanceMiddleware("1.2.3")(provenanceHandler)
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "loki_query"
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`}
+	result, err := handler(withRequestID(context.Background(), "req-1"), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// Round-trip the metadata through JSON, as a downstream system receives it
+	data, err := json.Marshal(result.Meta["provenance"])
+	if err != nil {
+		t.Fatalf("Expected the provenance to marshal, but got %v", err)
+	}
+	var p Provenance
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("Expected the provenance to unmarshal, but got %v", err)
+	}
+	if p.Server != "loki-mcp-server" || p.Version != "1.2.3" || p.Tool != "loki_query" || p.RequestID != "req-1" ||
+		p.Datasource != "http://loki:3100" || p.Org != "tenant-a" || p.QuerySHA256 != sha256Hex(`{app="api"}`) ||
+		p.ExecutedAt == "" || len(p.ContentSHA256) != 3 || len(p.Signature) != 64 {
+		t.Errorf("Unexpected provenance: %+v", p)
+	}
+	if !strings.HasPrefix(p.ContentSHA256[0], "text:") || !strings.HasPrefix(p.ContentSHA256[2], "image:") {
+		t.Errorf("Expected the digests to carry the content types, but got %v", p.ContentSHA256)
+	}
+
+	contents := result.Content
+	if err := VerifyProvenance([]byte("secret"), &p, contents); err != nil {
+		t.Errorf("Expected the result to verify, but got %v", err)
+	}
+	if err := VerifyProvenance([]byte("other"), &p, contents); err == nil || !strings.Contains(err.Error(), "signature does not match") {
+		t.Errorf("Expected a signature mismatch with another key, but got %v", err)
+	}
+	modified := []mcp.Content{mcp.NewTextContent(`2023-11-14T22:13:20Z {app="api"} request succeeded`), contents[1], contents[2]}
+	if err := VerifyProvenance([]byte("secret"), &p, modified); err == nil || err.Error() != "content 1 was modified" {
+		t.Errorf("Expected a modified content, but got %v", err)
+	}
+	replaced := []mcp.Content{contents[0], contents[1], mcp.NewImageContent("iVBORw0KGgo=", "image/jpeg")}
+	if err := VerifyProvenance([]byte("secret"), &p, replaced); err == nil || err.Error() != "content 3 was modified" {
+		t.Errorf("Expected a modified image, but got %v", err)
+	}
+	reordered := []mcp.Content{contents[1], contents[0], contents[2]}
+	if err := VerifyProvenance([]byte("secret"), &p, reordered); err == nil {
+		t.Error("Expected an error for reordered contents")
+	}
+	retyped := []mcp.Content{contents[0], contents[1], mcp.NewEmbeddedResource(mcp.BlobResourceContents{Blob: "iVBORw0KGgo=", MIMEType: "image/png"})}
+	if err := VerifyProvenance([]byte("secret"), &p, retyped); err == nil {
+		t.Error("Expected an error for a content of another type")
+	}
+	if err := VerifyProvenance([]byte("secret"), &p, contents[:1]); err == nil {
+		t.Error("Expected an error for a missing content")
+	}
+	tampered := p
+	tampered.Datasource = "http://other:3100"
+	if err := VerifyProvenance([]byte("secret"), &tampered, contents); err == nil {
+		t.Error("Expected an error for modified provenance")
+	}
+}
+
+// TestProvenanceMiddleware_Unsigned tests attaching provenance without a signature, and passing
+// results through unchanged when provenance is disabled
+func TestProvenanceMiddleware_Unsigned(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	SetConfig(&Config{})
+	handler := ProvenanceMiddleware("1.2.3")(provenanceHandler)
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, ok := result.Meta["provenance"]; ok {
+		t.Error("Expected no provenance when disabled")
+	}
+
+	SetConfig(&Config{Provenance: true})
+	result, err = handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	p, ok := result.Meta["provenance"].(*Provenance)
+	if !ok || p.Signature != "" || len(p.ContentSHA256) != 3 {
+		t.Fatalf("Expected unsigned provenance, but got %+v", result.Meta["provenance"])
+	}
+	if err := VerifyProvenance([]byte("secret"), p, nil); err == nil || err.Error() != "the provenance is not signed" {
+		t.Errorf("Expected an unsigned provenance error, but got %v", err)
+	}
+}
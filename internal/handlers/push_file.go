@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/loki-mcp/pkg/lokiclient"
+)
+
+// EnvLokiPushDir is the directory loki_push_file may read files from. The tool is only registered when it is set.
+const EnvLokiPushDir = "LOKI_PUSH_DIR"
+
+// Push limits
+const (
+	maxPushFileBytes   = 64 << 20
+	defaultPushBatch   = 1000
+	maxPushBatch       = 5000
+	maxPushBatchBytes  = 1 << 20 // Loki rejects push requests over its grpc message size, 4MB by default
+	pushRequestTimeout = 30 * time.Second
+	maxPushLineBytes   = 1 << 20
+)
+
+// pushTimestampFields are the JSON fields looked up for the timestamp of a JSON Lines entry
+var pushTimestampFields = []string{"time", "timestamp", "ts", "@timestamp"}
+
+// leadingTimestampPattern matches a timestamp at the start of a plain text line, optionally in brackets
+var leadingTimestampPattern = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)`)
+
+// pushReport describes the lines pushed from a file
+type pushReport struct {
+	File       string            `json:"file"`
+	FileType   string            `json:"file_type"`
+	Labels     map[string]string `json:"labels"`
+	Selector   string            `json:"selector"`
+	Fields     map[string]int    `json:"label_fields,omitempty"` // distinct values of each label taken from a field
+	Streams    int               `json:"streams"`
+	Lines      int               `json:"lines"`
+	Skipped    int               `json:"skipped_empty_lines"`
+	Untimed    int               `json:"lines_without_timestamp"` // given the timestamp of the line before them
+	Batches    int               `json:"batches"`
+	Start      string            `json:"start,omitempty"`
+	End        string            `json:"end,omitempty"`
+	Datasource string            `json:"datasource"`
+}
+
+// pushEntry is a line of a file with its timestamp, zero when the line has none
+type pushEntry struct {
+	ts     time.Time
+	line   string
+	labels map[string]string // labels taken from the line's fields
+}
+
+// PushEnabled reports whether a push directory is configured, so loki_push_file should be registered
+func PushEnabled() bool {
+	return CurrentConfig().PushDir != ""
+}
+
+// NewLokiPushFileTool creates and returns a tool for loading a local log file into Loki
+func NewLokiPushFileTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription(fmt.Sprintf("Push the lines of a local log file, such as one from a support bundle, to Loki in batches, "+
+			"so they can be queried alongside everything else. Reads JSON Lines or plain text files from the directory set in %s. "+
+			"Timestamps are taken from each line when present.", EnvLokiPushDir)),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Path of the file, relative to %s, e.g. bundle-1234/app.log", EnvLokiPushDir)),
+		),
+		mcp.WithString("labels",
+			mcp.Required(),
+			mcp.Description("Labels of the pushed stream, e.g. {job=\"support-bundle\", ticket=\"1234\"}. A filename label with "+
+				"the file's name is added unless given"),
+		),
+		mcp.WithString("file_type",
+			mcp.Description("Type of the file: jsonl, text, or auto to detect JSON Lines from the extension or first line (default: auto)"),
+			mcp.Enum("auto", "jsonl", "text"),
+		),
+		mcp.WithString("timestamp_field",
+			mcp.Description("Field holding the timestamp of JSON Lines entries, as RFC3339 or Unix seconds, milliseconds or nanoseconds "+
+				"(default: the first of time, timestamp, ts and @timestamp)"),
+		),
+		labelFieldsOption(),
+		maxLabelValuesOption(),
+		mcp.WithNumber("batch_size",
+			mcp.Description(fmt.Sprintf("Lines per push request, at most %d (default: %d)", maxPushBatch, defaultPushBatch)),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_push_file", opts...)
+}
+
+// HandleLokiPushFile handles Loki push file tool requests
+func HandleLokiPushFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	dir := CurrentConfig().PushDir
+	if dir == "" {
+		return nil, fmt.Errorf("pushing files is disabled: set %s to the directory files may be read from", EnvLokiPushDir)
+	}
+	path, _ := args["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	labelsArg, _ := args["labels"].(string)
+	labels, err := parsePushLabels(labelsArg)
+	if err != nil {
+		return nil, err
+	}
+	fileType := "auto"
+	if t, ok := args["file_type"].(string); ok && t != "" {
+		fileType = t
+	}
+	if fileType != "auto" && fileType != "jsonl" && fileType != "text" {
+		return nil, fmt.Errorf("unsupported file_type: %s. Supported types: auto, jsonl, text", fileType)
+	}
+	timestampField, _ := args["timestamp_field"].(string)
+	fieldsArg, _ := args["label_fields"].(string)
+	fields, err := parseLabelFields(fieldsArg, labels)
+	if err != nil {
+		return nil, err
+	}
+	maxValues := defaultMaxLabelValues
+	if n, ok := args["max_label_values"].(float64); ok {
+		if n < 1 || n > maxMaxLabelValues || n != math.Trunc(n) {
+			return nil, fmt.Errorf("max_label_values must be a whole number between 1 and %d", maxMaxLabelValues)
+		}
+		maxValues = int(n)
+	}
+	batchSize := defaultPushBatch
+	if n, ok := args["batch_size"].(float64); ok {
+		if n < 1 || n > maxPushBatch || n != math.Trunc(n) {
+			return nil, fmt.Errorf("batch_size must be a whole number between 1 and %d", maxPushBatch)
+		}
+		batchSize = int(n)
+	}
+	format := formatArg(args)
+
+	resolved, err := resolvePushPath(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	entries, fileType, skipped, err := readPushFile(resolved, fileType, timestampField, fields)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := labels["filename"]; !ok && !slices.ContainsFunc(fields, func(f labelField) bool { return f.Label == "filename" }) {
+		labels["filename"] = filepath.Base(resolved)
+	}
+	untimed := fillPushTimestamps(entries, time.Now())
+
+	// Check the label fields before pushing anything, so a high-cardinality field creates no streams
+	fieldCounts, streams, err := checkLabelCardinality(entries, fields, maxValues)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := ResolveLokiConnection(args)
+	if err := requireLokiBackend(conn, "loki_push_file"); err != nil {
+		return nil, err
+	}
+	report := pushReport{
+		File:       path,
+		FileType:   fileType,
+		Labels:     labels,
+		Selector:   formatPushSelector(labels),
+		Fields:     fieldCounts,
+		Streams:    streams,
+		Skipped:    skipped,
+		Untimed:    untimed,
+		Datasource: redactURL(conn.URL),
+	}
+	if len(entries) > 0 {
+		report.Start = entries[0].ts.UTC().Format(time.RFC3339Nano)
+		report.End = entries[len(entries)-1].ts.UTC().Format(time.RFC3339Nano)
+	}
+	for _, batch := range pushBatches(entries, batchSize) {
+		if err := pushLokiStreams(ctx, conn, groupPushStreams(batch, labels)); err != nil {
+			if report.Lines == 0 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("pushed %d of %d lines before failing: %w", report.Lines, len(entries), err)
+		}
+		report.Lines += len(batch)
+		report.Batches++
+	}
+
+	formattedResult, err := formatPushReport(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// parsePushLabels parses the labels of a pushed stream, given as a selector or a list of label=value pairs
+func parsePushLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	labels := make(map[string]string)
+	for _, part := range splitOutsideQuotes(s, ',') {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, op, value, err := parseLabelMatcher(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		if op != "=" {
+			return nil, fmt.Errorf("invalid label %s: labels must be given as name=value", part)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("label %s has an empty value", name)
+		}
+		labels[name] = value
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("labels are required, e.g. {job=\"support-bundle\"}")
+	}
+	return labels, nil
+}
+
+// resolvePushPath returns the absolute path of a file in the push directory, following symbolic
+// links, and rejects paths outside it
+func resolvePushPath(dir, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", EnvLokiPushDir, err)
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %s", path)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, EnvLokiPushDir)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	if info.Size() > maxPushFileBytes {
+		return "", fmt.Errorf("%s is %d bytes, more than the limit of %d", path, info.Size(), maxPushFileBytes)
+	}
+	return resolved, nil
+}
+
+// readPushFile reads the non-empty lines of a file with their timestamps and label fields, detecting
+// JSON Lines files for the auto type. It returns the entries, the type used and the number of empty lines.
+func readPushFile(path, fileType, timestampField string, fields []labelField) ([]pushEntry, string, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(file, maxPushFileBytes))
+	scanner.Buffer(make([]byte, 64*1024), maxPushLineBytes)
+	var entries []pushEntry
+	skipped := 0
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			skipped++
+			continue
+		}
+		if fileType == "auto" {
+			fileType = detectPushFileType(path, line)
+		}
+		entry := pushEntry{line: line}
+		if fileType == "jsonl" {
+			var parsed map[string]any
+			if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+				return nil, "", 0, fmt.Errorf("line %d is not a JSON object: %v. Use file_type text to push it as plain text", lineNo, err)
+			}
+			entry.ts = jsonLineTimestamp(parsed, timestampField)
+			entry.labels = extractLabelFields(fields, parsed)
+		} else if len(fields) > 0 {
+			return nil, "", 0, fmt.Errorf("label_fields requires a JSON Lines file, but %s is plain text", filepath.Base(path))
+		} else if m := leadingTimestampPattern.FindStringSubmatch(line); m != nil {
+			entry.ts, _ = parsePushTimestamp(m[1])
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", 0, fmt.Errorf("failed to read %s: %v", filepath.Base(path), err)
+	}
+	if fileType == "auto" {
+		fileType = "text"
+	}
+	return entries, fileType, skipped, nil
+}
+
+// detectPushFileType returns jsonl for files with a JSON Lines extension or whose first line is a JSON object
+func detectPushFileType(path, firstLine string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	if strings.HasPrefix(strings.TrimSpace(firstLine), "{") && json.Valid([]byte(firstLine)) {
+		return "jsonl"
+	}
+	return "text"
+}
+
+// jsonLineTimestamp returns the timestamp of a JSON Lines entry, or the zero time when it has none
+func jsonLineTimestamp(fields map[string]any, field string) time.Time {
+	names := pushTimestampFields
+	if field != "" {
+		names = []string{field}
+	}
+	for _, name := range names {
+		switch v := fields[name].(type) {
+		case string:
+			if ts, ok := parsePushTimestamp(v); ok {
+				return ts
+			}
+		case float64:
+			return unixTimestamp(v)
+		}
+	}
+	return time.Time{}
+}
+
+// parsePushTimestamp parses an RFC3339 or similar timestamp, or a Unix timestamp given as a string.
+// Timestamps without a time zone are taken as UTC.
+func parsePushTimestamp(s string) (time.Time, bool) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return unixTimestamp(n), true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z0700", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"} {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// unixTimestamp converts a Unix timestamp in seconds, milliseconds, microseconds or nanoseconds,
+// told apart by magnitude, to a time
+func unixTimestamp(n float64) time.Time {
+	switch {
+	case n > 1e17:
+		return time.Unix(0, int64(n))
+	case n > 1e14:
+		return time.UnixMicro(int64(n))
+	case n > 1e11:
+		return time.UnixMilli(int64(n))
+	default:
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+}
+
+// fillPushTimestamps gives lines without a timestamp the timestamp of the line before them, or of
+// the first timestamped line for the lines before it, and sorts the entries by time. A file without
+// any timestamps is pushed at now, a nanosecond apart to keep the lines in order. It returns the
+// number of lines without a timestamp.
+func fillPushTimestamps(entries []pushEntry, now time.Time) int {
+	var first time.Time
+	for _, entry := range entries {
+		if !entry.ts.IsZero() {
+			first = entry.ts
+			break
+		}
+	}
+	untimed := 0
+	for i := range entries {
+		if !entries[i].ts.IsZero() {
+			continue
+		}
+		untimed++
+		switch {
+		case first.IsZero():
+			entries[i].ts = now.Add(time.Duration(i-len(entries)+1) * time.Nanosecond)
+		case i == 0:
+			entries[i].ts = first
+		default:
+			entries[i].ts = entries[i-1].ts
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ts.Before(entries[j].ts) })
+	return untimed
+}
+
+// pushBatches splits entries into batches of at most size lines and about maxPushBatchBytes
+func pushBatches(entries []pushEntry, size int) [][]pushEntry {
+	var batches [][]pushEntry
+	start, bytes := 0, 0
+	for i, entry := range entries {
+		if i > start && (i-start >= size || bytes+len(entry.line) > maxPushBatchBytes) {
+			batches = append(batches, entries[start:i])
+			start, bytes = i, 0
+		}
+		bytes += len(entry.line)
+	}
+	if start < len(entries) {
+		batches = append(batches, entries[start:])
+	}
+	return batches
+}
+
+// pushLokiStreams sends streams to the push API of the connection's Loki
+func pushLokiStreams(ctx context.Context, conn LokiConnection, streams []lokiclient.PushStream) error {
+	if conn.err != nil {
+		return conn.err
+	}
+	u, err := url.Parse(conn.URL)
+	if err != nil {
+		return fmt.Errorf("failed to build push URL: %v", err)
+	}
+	setLokiAPIPath(u, "push")
+	pushURL, err := enforceQueryPolicy(ctx, u.String(), conn.OrgID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(lokiclient.PushRequest{Streams: streams})
+	if err != nil {
+		return fmt.Errorf("failed to marshal push request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pushURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	lokiclient.Credentials{Username: conn.Username, Password: conn.Password, Token: conn.Token, OrgID: conn.OrgID}.Apply(req)
+	if err := applyForwardedHeaders(ctx, req); err != nil {
+		return err
+	}
+	if err := applyExchangedToken(ctx, req); err != nil {
+		return err
+	}
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	if rec := dryRunFromContext(ctx); rec != nil {
+		rec.record(req, pushURL)
+		return errDryRun
+	}
+
+	resp, err := (&http.Client{Timeout: pushRequestTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return newLokiError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// formatPushSelector renders labels as a stream selector for querying the pushed lines
+func formatPushSelector(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matchers := make([]string, len(names))
+	for i, name := range names {
+		matchers[i] = name + "=" + quoteLogQLString(labels[name])
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// formatPushReport formats the push report into a readable string
+func formatPushReport(report pushReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		if report.Lines == 0 {
+			return fmt.Sprintf("No lines to push in %s", report.File), nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Pushed %d lines from %s (%s) to %s in %d batches\n", report.Lines, report.File, report.FileType, report.Datasource, report.Batches)
+		fmt.Fprintf(&b, "  Time range: %s to %s\n", report.Start, report.End)
+		if report.Untimed == report.Lines {
+			b.WriteString("  No timestamps were found, so the lines were pushed at the current time\n")
+		} else if report.Untimed > 0 {
+			fmt.Fprintf(&b, "  %d lines without a timestamp were given the timestamp of the line before them\n", report.Untimed)
+		}
+		if report.Skipped > 0 {
+			fmt.Fprintf(&b, "  %d empty lines were skipped\n", report.Skipped)
+		}
+		if len(report.Fields) > 0 {
+			fmt.Fprintf(&b, "  Labels from fields: %s, making %d streams\n", describeLabelFields(report.Fields), report.Streams)
+		}
+		fmt.Fprintf(&b, "Query them with %s", report.Selector)
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/loki-mcp/pkg/lokiclient"
+)
+
+// TestHandleLokiPushFile tests pushing a JSON Lines file in batches
+func TestHandleLokiPushFile(t *testing.T) {
+	var pushes []lokiclient.PushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/loki/api/v1/push" || r.Header.Get("X-Scope-OrgID") != "support" {
+			t.Errorf("Unexpected request: %s %s org=%s", r.Method, r.URL.Path, r.Header.Get("X-Scope-OrgID"))
+		}
+		var push lokiclient.PushRequest
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			t.Errorf("Failed to decode push request: %v", err)
+		}
+		pushes = append(pushes, push)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "bundle-1234"), 0o755)
+	os.WriteFile(filepath.Join(dir, "bundle-1234", "app.log"), []byte(
+		`{"ts": "2024-05-01T10:00:02Z", "level": "error", "msg": "disk full"}`+"\n"+
+			`{"ts": 1714557600, "level": "info", "msg": "started"}`+"\n\n"+
+			`{"level": "info", "msg": "no timestamp"}`+"\n"), 0o644)
+	SetConfig(&Config{LokiURL: server.URL, PushDir: dir})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"path": "bundle-1234/app.log", "labels": `{job="support-bundle", ticket="1234"}`, "batch_size": float64(2), "org": "support",
+	}
+	result, err := HandleLokiPushFile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if len(pushes) != 2 || len(pushes[0].Streams[0].Values) != 2 || len(pushes[1].Streams[0].Values) != 1 {
+		t.Fatalf("Expected batches of 2 and 1 lines, but got %+v", pushes)
+	}
+	stream := pushes[0].Streams[0]
+	if stream.Stream["job"] != "support-bundle" || stream.Stream["ticket"] != "1234" || stream.Stream["filename"] != "app.log" {
+		t.Errorf("Unexpected labels: %v", stream.Stream)
+	}
+	// Sorted by time, with the untimed line given the timestamp of the line before it
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).UnixNano()
+	if stream.Values[0][0] != strconv.FormatInt(started, 10) || !strings.Contains(stream.Values[0][1], "started") {
+		t.Errorf("Expected the started line first, but got %v", stream.Values[0])
+	}
+	if untimed := stream.Values[1]; untimed[0] != stream.Values[0][0] || !strings.Contains(untimed[1], "no timestamp") {
+		t.Errorf("Expected the untimed line at the timestamp of the line before it, but got %v", untimed)
+	}
+	if last := pushes[1].Streams[0].Values[0]; !strings.Contains(last[1], "disk full") {
+		t.Errorf("Expected the disk full line last, but got %v", last)
+	}
+
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{
+		"Pushed 3 lines from bundle-1234/app.log (jsonl)",
+		"in 2 batches",
+		"Time range: 2024-05-01T10:00:00Z to 2024-05-01T10:00:02Z",
+		"1 lines without a timestamp",
+		"1 empty lines were skipped",
+		`Query them with {filename="app.log", job="support-bundle", ticket="1234"}`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in:\n%s", want, text)
+		}
+	}
+}
+
+// TestResolvePushPath tests rejecting files outside the push directory
+func TestResolvePushPath(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "push")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644)
+	os.WriteFile(filepath.Join(dir, "app.log"), []byte("line"), 0o644)
+	os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "link.log"))
+
+	if _, err := resolvePushPath(dir, "app.log"); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+	for _, path := range []string{"../secret.txt", filepath.Join(root, "secret.txt"), "link.log"} {
+		if _, err := resolvePushPath(dir, path); err == nil || !strings.Contains(err.Error(), "outside LOKI_PUSH_DIR") {
+			t.Errorf("resolvePushPath(%s) = %v, want an outside error", path, err)
+		}
+	}
+	if _, err := resolvePushPath(dir, "."); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Expected a not a regular file error, but got %v", err)
+	}
+}
+
+// TestReadPushFile_Text tests reading timestamps at the start of plain text lines
+func TestReadPushFile_Text(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.log")
+	os.WriteFile(path, []byte("2024-05-01 10:00:00,250 ERROR deadlock detected\n"+
+		"\tat Pool.acquire\n"+
+		"[2024-05-01T12:00:01+02:00] WARN slow query\n"), 0o644)
+
+	entries, fileType, _, err := readPushFile(path, "auto", "", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if fileType != "text" || len(entries) != 3 {
+		t.Fatalf("Expected 3 text entries, but got %s %+v", fileType, entries)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 250e6, time.UTC); !entries[0].ts.Equal(want) {
+		t.Errorf("Expected %s, but got %s", want, entries[0].ts)
+	}
+	if !entries[1].ts.IsZero() {
+		t.Errorf("Expected no timestamp for the continuation line, but got %s", entries[1].ts)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC); !entries[2].ts.Equal(want) {
+		t.Errorf("Expected %s, but got %s", want, entries[2].ts)
+	}
+
+	if _, err := parsePushLabels(`job=~"x"`); err == nil {
+		t.Error("Expected an error for a regex matcher")
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/loki-mcp/pkg/lokiclient"
+)
+
+// Label field limits, keeping fields such as user IDs from creating a stream per value
+const (
+	defaultMaxLabelValues = 20
+	maxMaxLabelValues     = 100
+	maxPushStreams        = 200
+)
+
+// invalidLabelNameChars matches the characters of a field name not allowed in label names
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labelField maps a field of JSON Lines entries to a label of the pushed streams
+type labelField struct {
+	Label string
+	Field string // field name, or a dotted path into nested objects
+}
+
+// labelFieldsOption returns the tool option for labels taken from fields of JSON Lines entries
+func labelFieldsOption() mcp.ToolOption {
+	return mcp.WithString("label_fields",
+		mcp.Description("Comma-separated fields of JSON Lines entries to use as labels, as field or label=field with dotted paths "+
+			"into nested objects, e.g. level,service=kubernetes.labels.app. Entries without the field are pushed without the label. "+
+			"Fields with more distinct values than max_label_values are rejected; keep such fields in the line and filter with | json"),
+	)
+}
+
+// maxLabelValuesOption returns the tool option for the cardinality limit of label fields
+func maxLabelValuesOption() mcp.ToolOption {
+	return mcp.WithNumber("max_label_values",
+		mcp.Description(fmt.Sprintf("Most distinct values a label field may have, at most %d (default: %d)", maxMaxLabelValues, defaultMaxLabelValues)),
+	)
+}
+
+// parseLabelFields parses the label_fields argument, rejecting labels that clash with the static labels
+func parseLabelFields(s string, static map[string]string) ([]labelField, error) {
+	var fields []labelField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		label, field, ok := strings.Cut(part, "=")
+		if !ok {
+			field = label
+			label = invalidLabelNameChars.ReplaceAllString(field, "_")
+			if label != "" && label[0] >= '0' && label[0] <= '9' {
+				label = "_" + label
+			}
+		}
+		label, field = strings.TrimSpace(label), strings.TrimSpace(field)
+		if !labelNamePattern.MatchString(label) {
+			return nil, fmt.Errorf("invalid label name in label_fields: %s", label)
+		}
+		if field == "" {
+			return nil, fmt.Errorf("label %s in label_fields has no field", label)
+		}
+		if _, ok := static[label]; ok || seen[label] {
+			return nil, fmt.Errorf("label %s is given more than once", label)
+		}
+		seen[label] = true
+		fields = append(fields, labelField{Label: label, Field: field})
+	}
+	return fields, nil
+}
+
+// extractLabelFields returns the labels taken from the fields of a JSON Lines entry
+func extractLabelFields(fields []labelField, entry map[string]any) map[string]string {
+	var labels map[string]string
+	for _, f := range fields {
+		value, ok := labelFieldValue(entry, f.Field)
+		if !ok {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(fields))
+		}
+		labels[f.Label] = value
+	}
+	return labels
+}
+
+// labelFieldValue looks up a field by its name, or by a dotted path into nested objects, and
+// returns it as a label value. Objects, arrays, nulls and empty strings have no value.
+func labelFieldValue(entry map[string]any, path string) (string, bool) {
+	value, ok := entry[path]
+	if !ok {
+		var current any = entry
+		for _, key := range strings.Split(path, ".") {
+			object, isObject := current.(map[string]any)
+			if !isObject {
+				return "", false
+			}
+			if current, ok = object[key]; !ok {
+				return "", false
+			}
+		}
+		value = current
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// checkLabelCardinality counts the distinct values of each label field and rejects fields with
+// more than max values, and label sets making more than maxPushStreams streams
+func checkLabelCardinality(entries []pushEntry, fields []labelField, max int) (map[string]int, int, error) {
+	values := make(map[string]map[string]bool, len(fields))
+	for _, f := range fields {
+		values[f.Label] = make(map[string]bool)
+	}
+	streams := make(map[string]bool)
+	for _, entry := range entries {
+		for label, value := range entry.labels {
+			values[label][value] = true
+		}
+		streams[formatPushSelector(entry.labels)] = true
+	}
+
+	counts := make(map[string]int, len(fields))
+	for _, f := range fields {
+		counts[f.Label] = len(values[f.Label])
+		if counts[f.Label] > max {
+			return nil, 0, fmt.Errorf("label field %s has %d distinct values, more than the limit of %d. "+
+				"Keep it in the line and filter with | json instead, or raise max_label_values", f.Field, counts[f.Label], max)
+		}
+	}
+	if len(streams) > maxPushStreams {
+		return nil, 0, fmt.Errorf("label_fields would create %d streams, more than the limit of %d. Use fewer label fields", len(streams), maxPushStreams)
+	}
+	return counts, len(streams), nil
+}
+
+// groupPushStreams groups a batch of entries into streams by their labels, added to the static labels
+func groupPushStreams(batch []pushEntry, static map[string]string) []lokiclient.PushStream {
+	index := make(map[string]int)
+	var streams []lokiclient.PushStream
+	for _, entry := range batch {
+		key := formatPushSelector(entry.labels)
+		i, ok := index[key]
+		if !ok {
+			labels := make(map[string]string, len(static)+len(entry.labels))
+			for name, value := range static {
+				labels[name] = value
+			}
+			for name, value := range entry.labels {
+				labels[name] = value
+			}
+			i = len(streams)
+			index[key] = i
+			streams = append(streams, lokiclient.PushStream{Stream: labels})
+		}
+		streams[i].Values = append(streams[i].Values, [2]string{strconv.FormatInt(entry.ts.UnixNano(), 10), entry.line})
+	}
+	return streams
+}
+
+// describeLabelFields renders the number of values of each label field
+func describeLabelFields(counts map[string]int) string {
+	labels := make([]string, 0, len(counts))
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = fmt.Sprintf("%s (%d values)", label, counts[label])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/loki-mcp/pkg/lokiclient"
+)
+
+// TestHandleLokiPushFile_LabelFields tests pushing a stream per value of the label fields
+func TestHandleLokiPushFile_LabelFields(t *testing.T) {
+	var streams []lokiclient.PushStream
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var push lokiclient.PushRequest
+		json.NewDecoder(r.Body).Decode(&push)
+		streams = append(streams, push.Streams...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.jsonl"), []byte(
+		`{"ts": 1714557600, "level": "error", "kubernetes": {"labels": {"app": "api"}}, "user": "u1"}`+"\n"+
+			`{"ts": 1714557601, "level": "info", "kubernetes": {"labels": {"app": "api"}}, "user": "u2"}`+"\n"+
+			`{"ts": 1714557602, "level": "error", "kubernetes": {"labels": {"app": "worker"}}, "user": "u3"}`+"\n"+
+			`{"ts": 1714557603, "msg": "no level"}`+"\n"), 0o644)
+	SetConfig(&Config{LokiURL: server.URL, PushDir: dir})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"path": "app.jsonl", "labels": "job=bundle", "label_fields": "level, service=kubernetes.labels.app"}
+	result, err := HandleLokiPushFile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	selectors := make(map[string]int)
+	for _, stream := range streams {
+		selectors[formatPushSelector(stream.Stream)] += len(stream.Values)
+	}
+	want := map[string]int{
+		`{filename="app.jsonl", job="bundle", level="error", service="api"}`:    1,
+		`{filename="app.jsonl", job="bundle", level="info", service="api"}`:     1,
+		`{filename="app.jsonl", job="bundle", level="error", service="worker"}`: 1,
+		`{filename="app.jsonl", job="bundle"}`:                                  1,
+	}
+	if len(selectors) != len(want) {
+		t.Fatalf("Expected streams %v, but got %v", want, selectors)
+	}
+	for selector, n := range want {
+		if selectors[selector] != n {
+			t.Errorf("Expected %d lines in %s, but got %d", n, selector, selectors[selector])
+		}
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "Labels from fields: level (2 values), service (2 values), making 4 streams") {
+		t.Errorf("Unexpected result:\n%s", text)
+	}
+
+	// A field with more values than the limit is rejected before anything is pushed
+	streams = nil
+	request.Params.Arguments = map[string]any{"path": "app.jsonl", "labels": "job=bundle", "label_fields": "user", "max_label_values": float64(2)}
+	if _, err := HandleLokiPushFile(context.Background(), request); err == nil || !strings.Contains(err.Error(), "label field user has 3 distinct values") {
+		t.Errorf("Expected a cardinality error, but got %v", err)
+	}
+	if len(streams) != 0 {
+		t.Errorf("Expected nothing pushed, but got %v", streams)
+	}
+}
+
+// TestParseLabelFields tests deriving label names from fields and rejecting clashes
+func TestParseLabelFields(t *testing.T) {
+	fields, err := parseLabelFields("log.level, svc=service.name, 2xx", map[string]string{"job": "bundle"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	want := []labelField{{"log_level", "log.level"}, {"svc", "service.name"}, {"_2xx", "2xx"}}
+	if len(fields) != len(want) {
+		t.Fatalf("Expected %v, but got %v", want, fields)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("Field %d: expected %v, but got %v", i, want[i], fields[i])
+		}
+	}
+
+	for arg, want := range map[string]string{
+		"job":         "label job is given more than once",
+		"level,level": "label level is given more than once",
+		"bad-name=x":  "invalid label name",
+		"level=":      "has no field",
+	} {
+		if _, err := parseLabelFields(arg, map[string]string{"job": "bundle"}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseLabelFields(%s) = %v, want an error containing %q", arg, err, want)
+		}
+	}
+
+	if value, ok := labelFieldValue(map[string]any{"status": float64(503)}, "status"); !ok || value != strconv.Itoa(503) {
+		t.Errorf("Expected 503, but got %q", value)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// exclusivePattern is a log pattern seen in the results of only one of two queries
+type exclusivePattern struct {
+	Pattern string `json:"pattern"`
+	Count   int    `json:"count"`
+	Example string `json:"example"` // first line seen with the pattern
+}
+
+// queryDiffReport is the result of comparing the log lines of two queries
+type queryDiffReport struct {
+	QueryA string             `json:"query_a"`
+	QueryB string             `json:"query_b"`
+	LinesA int                `json:"lines_a"`
+	LinesB int                `json:"lines_b"`
+	Common int                `json:"common_patterns"`
+	OnlyA  []exclusivePattern `json:"only_in_a"`
+	OnlyB  []exclusivePattern `json:"only_in_b"`
+}
+
+// NewLokiQueryDiffTool creates and returns a tool for comparing the log lines of two queries
+func NewLokiQueryDiffTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Run two LogQL queries over the same window and report the lines present in one but not the other. " +
+			"Lines are compared by normalized message (numbers, IDs and addresses replaced by placeholders), which answers " +
+			"questions such as what replica A logs that replica B doesn't."),
+		mcp.WithString("query_a",
+			mcp.Required(),
+			mcp.Description("First LogQL query, e.g. {app=\"api\", pod=\"api-1\"}"),
+		),
+		mcp.WithString("query_b",
+			mcp.Required(),
+			mcp.Description("Second LogQL query, e.g. {app=\"api\", pod=\"api-2\"}"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for both queries (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for both queries (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of lines to sample per query (default: 1000)"),
+		),
+		mcp.WithNumber("top",
+			mcp.Description("Maximum number of patterns to show per side (default: 20)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_query_diff", opts...)
+}
+
+// HandleLokiQueryDiff handles Loki query diff tool requests
+func HandleLokiQueryDiff(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	queryA, _ := params.Args["query_a"].(string)
+	queryB, _ := params.Args["query_b"].(string)
+	if queryA == "" || queryB == "" {
+		return nil, fmt.Errorf("query_a and query_b are required")
+	}
+	queryA = applySessionSelector(ctx, queryA)
+	queryB = applySessionSelector(ctx, queryB)
+
+	limit := 1000
+	if limitVal, ok := params.Args["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	top := 20
+	if topVal, ok := params.Args["top"].(float64); ok && topVal > 0 {
+		top = int(topVal)
+	}
+
+	fetch := func(query string) (*LokiResult, error) {
+		result, err := runLokiQuery(ctx, params.Conn, query, params.Start, params.End, limit)
+		if err != nil {
+			return nil, err
+		}
+		lineOptions{}.apply(result)
+		return result, nil
+	}
+
+	resultA, err := fetch(queryA)
+	if err != nil {
+		return nil, err
+	}
+	resultB, err := fetch(queryB)
+	if err != nil {
+		return nil, err
+	}
+
+	report := diffQueryResults(resultA, resultB, top)
+	report.QueryA = queryA
+	report.QueryB = queryB
+
+	formattedResult, err := formatQueryDiff(report, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// diffQueryResults compares two query results by normalized message, listing the patterns
+// only one side has, most frequent first
+func diffQueryResults(resultA, resultB *LokiResult, top int) queryDiffReport {
+	countsA, linesA := countPatterns(resultA)
+	countsB, linesB := countPatterns(resultB)
+	report := queryDiffReport{LinesA: linesA, LinesB: linesB}
+
+	for pattern := range countsA {
+		if countsB[pattern] > 0 {
+			report.Common++
+		}
+	}
+
+	exclusive := func(counts, other map[string]int, result *LokiResult) []exclusivePattern {
+		examples := patternExamples(result)
+		var patterns []exclusivePattern
+		for _, pc := range sortedPatterns(counts) {
+			if other[pc.Pattern] > 0 {
+				continue
+			}
+			if len(patterns) == top {
+				break
+			}
+			patterns = append(patterns, exclusivePattern{Pattern: pc.Pattern, Count: pc.Count, Example: examples[pc.Pattern]})
+		}
+		return patterns
+	}
+	report.OnlyA = exclusive(countsA, countsB, resultA)
+	report.OnlyB = exclusive(countsB, countsA, resultB)
+
+	return report
+}
+
+// patternExamples returns the first log line seen for each normalized pattern in a query result
+func patternExamples(result *LokiResult) map[string]string {
+	examples := make(map[string]string)
+	for _, entry := range sortedLogEntries(result) {
+		pattern := normalizeLogLine(entry.Line)
+		if _, ok := examples[pattern]; !ok {
+			examples[pattern] = entry.Line
+		}
+	}
+	return examples
+}
+
+// formatQueryDiff formats the query diff report into a readable string
+func formatQueryDiff(report queryDiffReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		output := fmt.Sprintf("A: %s (%d lines)\nB: %s (%d lines)\n%d patterns in common\n",
+			report.QueryA, report.LinesA, report.QueryB, report.LinesB, report.Common)
+		if report.LinesA == 0 || report.LinesB == 0 {
+			output += "Warning: one of the queries has no logs in the selected window\n"
+		}
+
+		section := func(title string, patterns []exclusivePattern) {
+			output += fmt.Sprintf("\n%s (%d):\n", title, len(patterns))
+			if len(patterns) == 0 {
+				output += "  none\n"
+				return
+			}
+			for _, p := range patterns {
+				output += fmt.Sprintf("  %d  %s\n", p.Count, p.Pattern)
+				if format == "text" && p.Example != p.Pattern {
+					output += fmt.Sprintf("      e.g. %s\n", p.Example)
+				}
+			}
+		}
+		section("Only in A", report.OnlyA)
+		section("Only in B", report.OnlyB)
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
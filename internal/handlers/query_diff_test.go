@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// cannedQueryLokiClient returns canned log lines for each query
+type cannedQueryLokiClient struct {
+	fakeLokiClient
+	lines map[string][]string
+}
+
+func (f *cannedQueryLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	stream := LokiEntry{Stream: map[string]string{"query": query}}
+	for i, line := range f.lines[query] {
+		stream.Values = append(stream.Values, []string{strconv.Itoa(i + 1), line})
+	}
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{stream}}}, nil
+}
+
+// TestDiffQueryResults tests comparing two results by normalized message
+func TestDiffQueryResults(t *testing.T) {
+	resultA := &LokiResult{Data: LokiData{Result: []LokiEntry{{Values: [][]string{
+		{"1", "request 1 done in 12ms"},
+		{"2", "request 2 done in 8ms"},
+		{"3", "cache miss for key 42"},
+	}}}}}
+	resultB := &LokiResult{Data: LokiData{Result: []LokiEntry{{Values: [][]string{
+		{"1", "request 7 done in 3ms"},
+		{"2", "connection refused to 10.0.0.1"},
+	}}}}}
+
+	report := diffQueryResults(resultA, resultB, 20)
+	if report.LinesA != 3 || report.LinesB != 2 {
+		t.Errorf("Expected 3 and 2 lines, but got %d and %d", report.LinesA, report.LinesB)
+	}
+	if report.Common != 1 {
+		t.Errorf("Expected 1 common pattern, but got %d", report.Common)
+	}
+	if len(report.OnlyA) != 1 || report.OnlyA[0].Pattern != "cache miss for key <num>" || report.OnlyA[0].Example != "cache miss for key 42" {
+		t.Errorf("Unexpected patterns only in A: %v", report.OnlyA)
+	}
+	if len(report.OnlyB) != 1 || report.OnlyB[0].Pattern != "connection refused to <ip>" {
+		t.Errorf("Unexpected patterns only in B: %v", report.OnlyB)
+	}
+
+	if report := diffQueryResults(resultA, resultB, 0); len(report.OnlyA) != 0 {
+		t.Errorf("Expected no patterns with top 0, but got %v", report.OnlyA)
+	}
+}
+
+// TestHandleLokiQueryDiff tests running and comparing two queries
+func TestHandleLokiQueryDiff(t *testing.T) {
+	fake := &cannedQueryLokiClient{lines: map[string][]string{
+		`{pod="api-1"}`: {"started worker 1", "retrying upstream call"},
+		`{pod="api-2"}`: {"started worker 2"},
+	}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query_a": `{pod="api-1"}`, "query_b": `{pod="api-2"}`, "format": "json"}
+	result, err := HandleLokiQueryDiff(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var report queryDiffReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if len(report.OnlyA) != 1 || report.OnlyA[0].Pattern != "retrying upstream call" {
+		t.Errorf("Expected the retry line only in A, but got %v", report.OnlyA)
+	}
+	if len(report.OnlyB) != 0 {
+		t.Errorf("Expected nothing only in B, but got %v", report.OnlyB)
+	}
+
+	request.Params.Arguments = map[string]any{"query_a": `{pod="api-1"}`}
+	if _, err := HandleLokiQueryDiff(context.Background(), request); err == nil {
+		t.Error("Expected an error when query_b is missing")
+	}
+}
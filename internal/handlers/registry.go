@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// RegisteredTool is a tool and its handler added to a ToolRegistry
+type RegisteredTool struct {
+	Tool    mcp.Tool
+	Handler server.ToolHandlerFunc
+}
+
+// ToolRegistry collects custom tools and tool middleware to serve alongside the built-in Loki tools.
+//
+// Forks add their own tools without patching main() by registering them with DefaultRegistry
+// from an init function. Custom tools can reuse the shared configuration and authentication
+// with LokiConnectionOptions, ResolveLokiConnection, CurrentConfig and CurrentLokiClient.
+type ToolRegistry struct {
+	mu         sync.Mutex
+	tools      []RegisteredTool
+	middleware []server.ToolHandlerMiddleware
+}
+
+// DefaultRegistry is the registry served by the MCP server
+var DefaultRegistry = NewToolRegistry()
+
+// NewToolRegistry creates an empty tool registry
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{}
+}
+
+// AddTool registers a tool. A tool with the same name as a built-in tool replaces it.
+func (r *ToolRegistry) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools = append(r.tools, RegisteredTool{Tool: tool, Handler: handler})
+}
+
+// Use registers middleware wrapping every tool call, built-in tools included.
+// Middleware runs inside the built-in middleware, in the order it was registered.
+func (r *ToolRegistry) Use(middleware ...server.ToolHandlerMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Tools returns the registered tools in registration order
+func (r *ToolRegistry) Tools() []RegisteredTool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RegisteredTool(nil), r.tools...)
+}
+
+// ServerOptions returns the MCP server options installing the registered middleware
+func (r *ToolRegistry) ServerOptions() []server.ServerOption {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	opts := make([]server.ServerOption, 0, len(r.middleware))
+	for _, mw := range r.middleware {
+		opts = append(opts, server.WithToolHandlerMiddleware(mw))
+	}
+	return opts
+}
+
+// RegisterTool registers a tool with DefaultRegistry
+func RegisterTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	DefaultRegistry.AddTool(tool, handler)
+}
+
+// RegisterMiddleware registers tool middleware with DefaultRegistry
+func RegisterMiddleware(middleware ...server.ToolHandlerMiddleware) {
+	DefaultRegistry.Use(middleware...)
+}
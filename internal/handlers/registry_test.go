@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// TestToolRegistry tests registering custom tools and middleware
+func TestToolRegistry(t *testing.T) {
+	registry := NewToolRegistry()
+
+	var calls []string
+	registry.Use(func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls = append(calls, "middleware:"+request.Params.Name)
+			return next(ctx, request)
+		}
+	})
+	registry.AddTool(mcp.NewTool("acme_runbook", mcp.WithDescription("Show the runbook for a service")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls = append(calls, "handler")
+			return mcp.NewToolResultText("runbook"), nil
+		})
+
+	tools := registry.Tools()
+	if len(tools) != 1 || tools[0].Tool.Name != "acme_runbook" {
+		t.Fatalf("Expected the acme_runbook tool, but got %v", tools)
+	}
+
+	s := server.NewMCPServer("test", "0.0.0", registry.ServerOptions()...)
+	for _, reg := range tools {
+		s.AddTool(reg.Tool, reg.Handler)
+	}
+	s.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"acme_runbook"}}`))
+
+	if len(calls) != 2 || calls[0] != "middleware:acme_runbook" || calls[1] != "handler" {
+		t.Errorf("Expected the middleware to wrap the handler, but got %v", calls)
+	}
+}
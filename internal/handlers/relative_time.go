@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// relativeTimeOption returns the tool option for appending relative times to timestamps
+func relativeTimeOption() mcp.ToolOption {
+	return mcp.WithBoolean("relative_time",
+		mcp.Description("Append how long ago each entry was logged to its timestamp, such as (3m ago) or (2h 14m ago), "+
+			"to make the output easier to scan (raw and text formats; default: false)"),
+	)
+}
+
+// relativeTimeRequested reports whether relative times were requested for a tool call
+func relativeTimeRequested(args map[string]any) bool {
+	relative, _ := args["relative_time"].(bool)
+	return relative
+}
+
+// formatEntryTime formats the timestamp of an entry as RFC 3339, followed by how long before
+// now it was logged unless now is zero
+func formatEntryTime(t, now time.Time) string {
+	if now.IsZero() {
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(time.RFC3339) + " (" + humanizeAgo(now.Sub(t)) + ")"
+}
+
+// humanizeAgo renders the time elapsed since an event with its two largest units, such as
+// 45s ago, 3m ago, 2h 14m ago or 3d 4h ago. Events in the future are rendered as in 5m.
+func humanizeAgo(d time.Duration) string {
+	if d > -time.Second && d < time.Second {
+		return "just now"
+	}
+	if d < 0 {
+		return "in " + humanizeDuration(-d)
+	}
+	return humanizeDuration(d) + " ago"
+}
+
+// humanizeDuration renders a duration of at least a second with its two largest units,
+// leaving out a zero second unit
+func humanizeDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	units := []struct {
+		size time.Duration
+		name string
+	}{{day, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}}
+
+	for i, unit := range units {
+		if d < unit.size {
+			continue
+		}
+		s := fmt.Sprintf("%d%s", d/unit.size, unit.name)
+		if i+1 < len(units) {
+			next := units[i+1]
+			if n := (d % unit.size) / next.size; n > 0 {
+				s += fmt.Sprintf(" %d%s", n, next.name)
+			}
+		}
+		return s
+	}
+	return "0s"
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestHumanizeAgo tests rendering elapsed times with their two largest units
+func TestHumanizeAgo(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{500 * time.Millisecond, "just now"},
+		{45 * time.Second, "45s ago"},
+		{3 * time.Minute, "3m ago"},
+		{3*time.Minute + 20*time.Second, "3m 20s ago"},
+		{2*time.Hour + 14*time.Minute + 59*time.Second, "2h 14m ago"},
+		{2 * time.Hour, "2h ago"},
+		{76*time.Hour + 30*time.Minute, "3d 4h ago"},
+		{-5 * time.Minute, "in 5m"},
+	}
+	for _, tt := range tests {
+		if got := humanizeAgo(tt.d); got != tt.want {
+			t.Errorf("humanizeAgo(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// TestFormatLokiResultsAt tests appending relative times to the raw and text formats
+func TestFormatLokiResultsAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	logged := now.Add(-(2*time.Hour + 14*time.Minute))
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{{
+		Stream: map[string]string{"app": "api"},
+		Values: [][]string{{strconv.FormatInt(logged.UnixNano(), 10), "request failed"}},
+	}}}}
+	timestamp := logged.Local().Format(time.RFC3339)
+
+	for _, format := range []string{"raw", "text"} {
+		output, err := formatLokiResultsAt(result, format, now)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if !strings.Contains(output, timestamp+" (2h 14m ago)") {
+			t.Errorf("Expected a relative time in the %s format, but got:\n%s", format, output)
+		}
+
+		plain, err := formatLokiResults(result, format)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if strings.Contains(plain, "ago") {
+			t.Errorf("Expected no relative time without a reference time, but got:\n%s", plain)
+		}
+	}
+}
+
+// TestHandleLokiQuery_RelativeTime tests the relative_time option of loki_query
+func TestHandleLokiQuery_RelativeTime(t *testing.T) {
+	query := `{app="api"}`
+	SetLokiClient(&cannedQueryLokiClient{lines: map[string][]string{query: {"request failed"}}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": query, "relative_time": true}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !regexp.MustCompile(`\(\d+d( \d+h)? ago\) \{query=`).MatchString(text) {
+		t.Errorf("Expected a relative time before the labels, but got:\n%s", text)
+	}
+}
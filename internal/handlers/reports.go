@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Environment variable name for the JSON file defining scheduled reports
+const EnvLokiReportsFile = "LOKI_REPORTS_FILE"
+
+// ReportConfig defines a report produced by calling a tool on a cron schedule
+type ReportConfig struct {
+	Name      string             `json:"name"`
+	Schedule  string             `json:"schedule"`  // cron expression, e.g. "0 9 * * *"
+	Tool      string             `json:"tool"`      // tool to call, e.g. loki_query
+	Arguments map[string]any     `json:"arguments"` // tool arguments, e.g. {"query": "...", "since": "24h"}
+	File      string             `json:"file,omitempty"`
+	Webhook   string             `json:"webhook,omitempty"` // shorthand for a webhook sink
+	Sinks     []NotificationSink `json:"sinks,omitempty"`
+}
+
+// scheduledReport is a report with its parsed schedule
+type scheduledReport struct {
+	ReportConfig
+	schedule cronSchedule
+	next     time.Time
+}
+
+// ReportScheduler runs configured reports on their schedules
+type ReportScheduler struct {
+	reports []*scheduledReport
+	tools   map[string]server.ToolHandlerFunc
+}
+
+// LoadReports reads report definitions from a JSON file containing an array of reports
+func LoadReports(path string) ([]ReportConfig, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reports file: %w", err)
+	}
+	var reports []ReportConfig
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, fmt.Errorf("failed to parse reports file %s: %w", path, err)
+	}
+	return reports, nil
+}
+
+// NewReportScheduler validates the reports against the available tools and returns a scheduler for them
+func NewReportScheduler(reports []ReportConfig, tools map[string]server.ToolHandlerFunc) (*ReportScheduler, error) {
+	s := &ReportScheduler{tools: tools}
+	for _, r := range reports {
+		if r.Name == "" {
+			return nil, fmt.Errorf("report name is required")
+		}
+		schedule, err := parseCron(r.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("report %s: %v", r.Name, err)
+		}
+		if _, ok := tools[r.Tool]; !ok {
+			return nil, fmt.Errorf("report %s: unknown or disabled tool %q", r.Name, r.Tool)
+		}
+		if r.Webhook != "" {
+			r.Sinks = append(slices.Clip(r.Sinks), NotificationSink{Type: SinkWebhook, URL: r.Webhook})
+		}
+		for i := range r.Sinks {
+			if err := r.Sinks[i].validate(); err != nil {
+				return nil, fmt.Errorf("report %s: %v", r.Name, err)
+			}
+		}
+		if r.File == "" && len(r.Sinks) == 0 {
+			return nil, fmt.Errorf("report %s: a file or sink is required", r.Name)
+		}
+		s.reports = append(s.reports, &scheduledReport{ReportConfig: r, schedule: schedule})
+	}
+	return s, nil
+}
+
+// Run runs the reports on their schedules until the context is cancelled
+func (s *ReportScheduler) Run(ctx context.Context) {
+	now := time.Now()
+	for _, r := range s.reports {
+		r.next = r.schedule.next(now)
+	}
+
+	for {
+		var due time.Time
+		for _, r := range s.reports {
+			if !r.next.IsZero() && (due.IsZero() || r.next.Before(due)) {
+				due = r.next
+			}
+		}
+		if due.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, r := range s.reports {
+			if r.next.IsZero() || r.next.After(due) {
+				continue
+			}
+			go func(r ReportConfig, at time.Time) {
+				if err := s.runReport(ctx, r, at); err != nil {
+					slog.Warn("scheduled report failed", "report", r.Name, "error", err)
+				}
+			}(r.ReportConfig, r.next)
+			r.next = r.schedule.next(r.next)
+		}
+	}
+}
+
+// runReport calls the report's tool and delivers the result. Tool errors are delivered
+// as the report content, so that a broken report is noticed by its readers.
+func (s *ReportScheduler) runReport(ctx context.Context, r ReportConfig, at time.Time) error {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = r.Tool
+	request.Params.Arguments = r.Arguments
+
+	content, err := toolResultText(s.tools[r.Tool](ctx, request))
+	if err != nil {
+		content = fmt.Sprintf("Report %s failed: %v", r.Name, err)
+	}
+
+	if r.File != "" {
+		if err := writeReportFile(expandReportPath(r.File, at), content); err != nil {
+			return err
+		}
+	}
+	return sendNotifications(ctx, r.Sinks, reportNotification(r, at, content))
+}
+
+// reportNotification describes a report run for its sinks
+func reportNotification(r ReportConfig, at time.Time, content string) notification {
+	n := notification{
+		Source:  "report",
+		ID:      r.Name,
+		Name:    r.Name,
+		Content: content,
+		Time:    at.UTC().Format(time.RFC3339),
+	}
+	n.Query, _ = r.Arguments["query"].(string)
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n.Count++
+		if len(n.Lines) < maxNotificationLines {
+			n.Lines = append(n.Lines, line)
+		}
+	}
+	return n
+}
+
+// toolResultText joins the text content of a tool result
+func toolResultText(result *mcp.CallToolResult, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	text := strings.Join(parts, "\n\n")
+	if result.IsError {
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+// expandReportPath replaces the {date} and {time} placeholders in a report file path and expands
+// a leading ~. Neither placeholder produces characters that are invalid in Windows file names.
+func expandReportPath(path string, at time.Time) string {
+	return expandPath(strings.NewReplacer("{date}", at.Format("2006-01-02"), "{time}", at.Format("150405")).Replace(path))
+}
+
+// writeReportFile writes report content to a file, creating its directory if needed
+func writeReportFile(path, content string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
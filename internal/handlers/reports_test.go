@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// echoReportTool returns the query argument of the request as text
+func echoReportTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, _ := request.GetArguments()["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	return mcp.NewToolResultText("ran " + query), nil
+}
+
+// TestLoadReports tests reading and validating a reports file
+func TestLoadReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports.json")
+	os.WriteFile(path, []byte(`[{"name": "daily", "schedule": "@daily", "tool": "loki_query", "arguments": {"query": "{app=\"api\"}"}, "file": "out.txt"}]`), 0o644)
+
+	reports, err := LoadReports(path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(reports) != 1 || reports[0].Arguments["query"] != `{app="api"}` {
+		t.Fatalf("Unexpected reports: %+v", reports)
+	}
+
+	tools := map[string]server.ToolHandlerFunc{"loki_query": echoReportTool}
+	if _, err := NewReportScheduler(reports, tools); err != nil {
+		t.Errorf("Expected a valid report, but got %v", err)
+	}
+
+	invalid := map[string]ReportConfig{
+		"bad schedule": {Name: "r", Schedule: "daily", Tool: "loki_query", File: "out.txt"},
+		"unknown tool": {Name: "r", Schedule: "@daily", Tool: "loki_nope", File: "out.txt"},
+		"no output":    {Name: "r", Schedule: "@daily", Tool: "loki_query"},
+		"no name":      {Schedule: "@daily", Tool: "loki_query", File: "out.txt"},
+	}
+	for name, report := range invalid {
+		if _, err := NewReportScheduler([]ReportConfig{report}, tools); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestRunReport tests delivering a report to a file and a webhook
+func TestRunReport(t *testing.T) {
+	var payload map[string]any
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	report := ReportConfig{
+		Name:      "daily errors",
+		Schedule:  "@daily",
+		Tool:      "loki_query",
+		Arguments: map[string]any{"query": `{app="api"}`},
+		File:      filepath.Join(dir, "reports", "errors-{date}.txt"),
+		Webhook:   webhook.URL,
+	}
+	scheduler, err := NewReportScheduler([]ReportConfig{report}, map[string]server.ToolHandlerFunc{"loki_query": echoReportTool})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	at := time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC)
+	report = scheduler.reports[0].ReportConfig
+	if err := scheduler.runReport(context.Background(), report, at); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "reports", "errors-2024-03-15.txt"))
+	if err != nil {
+		t.Fatalf("Expected the report file to be written: %v", err)
+	}
+	if string(content) != `ran {app="api"}` {
+		t.Errorf("Unexpected report content: %s", content)
+	}
+	if payload["name"] != "daily errors" || payload["source"] != "report" || payload["content"] != `ran {app="api"}` || payload["time"] != "2024-03-15T09:00:00Z" {
+		t.Errorf("Unexpected webhook payload: %v", payload)
+	}
+
+	// A failing tool call delivers the error
+	report.Arguments = nil
+	if err := scheduler.runReport(context.Background(), report, at); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "reports", "errors-2024-03-15.txt"))
+	if string(content) != "Report daily errors failed: query parameter is required" {
+		t.Errorf("Expected the error in the report, but got %s", content)
+	}
+}
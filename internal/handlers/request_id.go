@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Header carrying the request ID on requests sent to Loki
+const RequestIDHeader = "X-Request-Id"
+
+// requestIDKey is the context key for the request ID of a tool call
+type requestIDKey struct{}
+
+// withRequestID returns a context carrying the given request ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// toolNameKey is the context key for the name of the tool being called
+type toolNameKey struct{}
+
+// toolNameFromContext returns the name of the tool being called, or an empty string
+func toolNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(toolNameKey{}).(string)
+	return name
+}
+
+// requestIDFromContext returns the request ID of the current tool call, or an empty string
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware assigns a request ID to every tool call. The ID is sent to Loki in the
+// X-Request-Id header, logged with the call, and returned in the result metadata or error,
+// so agent behavior can be correlated with Loki's query logs.
+func RequestIDMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id := uuid.NewString()
+		ctx = context.WithValue(withRequestID(ctx, id), toolNameKey{}, request.Params.Name)
+		started := time.Now()
+
+		result, err := next(ctx, request)
+
+		attrs := []any{
+			"tool", request.Params.Name,
+			"request_id", id,
+			"duration_ms", time.Since(started).Milliseconds(),
+		}
+		if err != nil {
+			slog.Error("tool call failed", append(attrs, "error", err)...)
+			return nil, fmt.Errorf("%w (request_id: %s)", err, id)
+		}
+		slog.Info("tool call", attrs...)
+
+		if result != nil {
+			if result.Meta == nil {
+				result.Meta = make(map[string]any)
+			}
+			result.Meta["request_id"] = id
+		}
+		return result, nil
+	}
+}
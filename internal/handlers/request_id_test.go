@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestRequestIDMiddleware tests that each call gets a request ID in its context, result metadata and errors
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		seen = requestIDFromContext(ctx)
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if seen == "" {
+		t.Fatal("Expected a request ID in the handler context")
+	}
+	if result.Meta["request_id"] != seen {
+		t.Errorf("Expected request_id %s in result metadata, but got %v", seen, result.Meta["request_id"])
+	}
+
+	failing := RequestIDMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		seen = requestIDFromContext(ctx)
+		return nil, errors.New("boom")
+	})
+	_, err = failing(context.Background(), mcp.CallToolRequest{})
+	if err == nil || !strings.Contains(err.Error(), "request_id: "+seen) {
+		t.Errorf("Expected error to carry the request ID, but got %v", err)
+	}
+}
+
+// TestSendLokiRequest_RequestIDHeader tests that the request ID is sent to Loki
+func TestSendLokiRequest_RequestIDHeader(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(RequestIDHeader)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	ctx := withRequestID(context.Background(), "abc-123")
+	if _, err := executeLokiRequest(ctx, server.URL, "", "", "", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if header != "abc-123" {
+		t.Errorf("Expected %s header abc-123, but got %q", RequestIDHeader, header)
+	}
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Retention lookup settings
+const (
+	// minRetention is the shortest retention period Loki supports, so queries
+	// starting more recently are never checked against retention
+	minRetention = 24 * time.Hour
+	// retentionCacheTTL is how long a tenant's retention read from Loki's configuration is reused
+	retentionCacheTTL = 10 * time.Minute
+	// defaultProbeMaxAge is how far back the oldest data is searched for when the retention is unknown
+	defaultProbeMaxAge = 365 * 24 * time.Hour
+)
+
+// Where a tenant's retention is enforced
+const (
+	retentionCompactor    = "compactor"
+	retentionTableManager = "table_manager"
+	retentionNone         = "none"
+)
+
+// tenantRetention is the retention Loki enforces for a tenant
+type tenantRetention struct {
+	Period  time.Duration // 0 when logs are kept forever
+	Source  string        // retentionCompactor, retentionTableManager or retentionNone
+	fetched time.Time
+	err     error
+}
+
+// retentionCache holds tenant retentions keyed by Loki URL and tenant
+var retentionCache = struct {
+	sync.Mutex
+	entries map[string]tenantRetention
+}{entries: make(map[string]tenantRetention)}
+
+// retentionReport describes how far back a tenant's logs are available
+type retentionReport struct {
+	Tenant             string `json:"tenant,omitempty"`
+	RetentionPeriod    string `json:"retention_period,omitempty"` // empty when logs are kept forever
+	EnforcedBy         string `json:"enforced_by"`
+	OldestAvailable    string `json:"oldest_available,omitempty"` // now minus the retention period
+	Selector           string `json:"selector,omitempty"`
+	OldestData         string `json:"oldest_data,omitempty"` // start of the oldest day with matching logs
+	ProbedBack         string `json:"probed_back,omitempty"`
+	RuntimeConfigError string `json:"runtime_config_error,omitempty"`
+}
+
+// NewLokiRetentionTool creates and returns a tool for reporting how far back a tenant's logs are available
+func NewLokiRetentionTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Report the retention period Loki enforces for a tenant, and so the oldest time logs can be " +
+			"queried from, read from Loki's /config and /runtime_config endpoints. With a selector, also probe Loki " +
+			"for the oldest day that has matching logs, which works when the configuration is not accessible."),
+		mcp.WithString("selector",
+			mcp.Description("Stream selector to probe for the oldest available logs, e.g. {app=\"api\"}"),
+		),
+		mcp.WithString("max_age",
+			mcp.Description("How far back to probe, e.g. 90d (default: the retention period, or 365d when unknown)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_retention", opts...)
+}
+
+// HandleLokiRetention handles Loki retention tool requests
+func HandleLokiRetention(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	selector, _ := args["selector"].(string)
+	format := formatArg(args)
+	conn := ResolveLokiConnection(args)
+	now := time.Now()
+
+	report := retentionReport{Tenant: conn.OrgID, EnforcedBy: "unknown"}
+
+	config, runtimeConfig, configErr, runtimeErr := fetchLokiConfig(ctx, conn)
+	if errors.Is(configErr, errDryRun) {
+		return nil, configErr
+	}
+	if configErr != nil && selector == "" {
+		return nil, fmt.Errorf("failed to read Loki's configuration, pass a selector to probe for the oldest logs instead: %v", configErr)
+	}
+	var retention tenantRetention
+	if configErr == nil {
+		retention = retentionFromConfig(config, runtimeConfig, conn.OrgID)
+		report.EnforcedBy = retention.Source
+		if retention.Period > 0 {
+			report.RetentionPeriod = formatLogQLDuration(retention.Period)
+			report.OldestAvailable = now.Add(-retention.Period).UTC().Format(time.RFC3339)
+		}
+		if runtimeErr != nil {
+			report.RuntimeConfigError = runtimeErr.Error()
+		}
+	}
+
+	if selector != "" {
+		maxAge := defaultProbeMaxAge
+		if retention.Period > 0 {
+			maxAge = retention.Period
+		}
+		maxAge, err := durationArg(args, "max_age", maxAge)
+		if err != nil {
+			return nil, err
+		}
+		selector = applySessionSelector(ctx, selector)
+		report.Selector = selector
+		report.ProbedBack = formatLogQLDuration(maxAge)
+
+		oldest, found, err := probeOldestData(ctx, conn, selector, now, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			report.OldestData = oldest.UTC().Format(time.RFC3339)
+		}
+	}
+
+	formattedResult, err := formatRetention(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// retentionFromConfig determines the retention Loki enforces for a tenant. Retention is applied by the
+// compactor when retention_enabled is set, or by the table manager when retention deletes are enabled.
+func retentionFromConfig(config, runtimeConfig []yamlEntry, tenant string) tenantRetention {
+	values := make(map[string]string)
+	for _, entry := range config {
+		values[strings.Join(entry.Path, ".")] = entry.Value
+	}
+
+	switch {
+	case values["compactor.retention_enabled"] == "true":
+		retention := tenantRetention{Source: retentionCompactor}
+		for _, limit := range tenantLimits(config, runtimeConfig, tenant, true) {
+			if limit.Name == "retention_period" {
+				retention.Period, _ = parseLokiDuration(limit.Value)
+			}
+		}
+		return retention
+	case values["table_manager.retention_deletes_enabled"] == "true":
+		period, _ := parseLokiDuration(values["table_manager.retention_period"])
+		return tenantRetention{Period: period, Source: retentionTableManager}
+	default:
+		return tenantRetention{Source: retentionNone}
+	}
+}
+
+// lookupRetention returns the tenant's retention, reading Loki's configuration at most once per
+// retentionCacheTTL. Failures are cached too, so that inaccessible endpoints are not retried on every query.
+func lookupRetention(ctx context.Context, conn LokiConnection) (tenantRetention, error) {
+	key := conn.URL + "\x00" + conn.OrgID
+	retentionCache.Lock()
+	cached, ok := retentionCache.entries[key]
+	retentionCache.Unlock()
+	if ok && time.Since(cached.fetched) < retentionCacheTTL {
+		return cached, cached.err
+	}
+
+	retention := tenantRetention{}
+	config, runtimeConfig, configErr, _ := fetchLokiConfig(ctx, conn)
+	if ctx.Err() != nil {
+		return retention, ctx.Err()
+	}
+	if configErr != nil {
+		retention.err = configErr
+	} else {
+		retention = retentionFromConfig(config, runtimeConfig, conn.OrgID)
+	}
+	retention.fetched = time.Now()
+
+	retentionCache.Lock()
+	retentionCache.entries[key] = retention
+	retentionCache.Unlock()
+	return retention, retention.err
+}
+
+// warnIfBeforeRetention adds a warning to the tool result when the query starts before the tenant's
+// retention period, since Loki then quietly returns fewer or no logs
+func warnIfBeforeRetention(ctx context.Context, conn LokiConnection, start time.Time) {
+	now := time.Now()
+	if !start.Before(now.Add(-minRetention)) {
+		return
+	}
+	retention, err := lookupRetention(ctx, conn)
+	if err != nil || retention.Period <= 0 {
+		return
+	}
+	if oldest := now.Add(-retention.Period); start.Before(oldest) {
+		addWarning(ctx, fmt.Sprintf("The requested start %s precedes the %s retention period, so logs before %s have been deleted and results may be incomplete",
+			start.UTC().Format(time.RFC3339), formatLogQLDuration(retention.Period), oldest.UTC().Format(time.RFC3339)))
+	}
+}
+
+// probeOldestData finds the start of the oldest day within maxAge that has logs matching the selector.
+// It binary searches over days, assuming logs exist every day from the oldest one on, and so sends
+// about log2(days) queries.
+func probeOldestData(ctx context.Context, conn LokiConnection, selector string, now time.Time, maxAge time.Duration) (time.Time, bool, error) {
+	const day = 24 * time.Hour
+	dayStart := func(daysAgo int) time.Time {
+		return now.Add(-time.Duration(daysAgo+1) * day)
+	}
+	hasLogs := func(daysAgo int) (bool, error) {
+		start := dayStart(daysAgo)
+		result, err := runLokiQuery(ctx, conn, selector, start, start.Add(day), 1)
+		if err != nil {
+			return false, err
+		}
+		return len(sortedLogEntries(result)) > 0, nil
+	}
+
+	// The search keeps lo as a day with logs and hi as a day without
+	lo, hi := 0, max(int(maxAge/day)-1, 0)
+	if ok, err := hasLogs(lo); err != nil || !ok {
+		return time.Time{}, false, err
+	}
+	ok, err := hasLogs(hi)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if ok {
+		return dayStart(hi), true, nil
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err := hasLogs(mid)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return dayStart(lo), true, nil
+}
+
+// parseLokiDuration parses a duration as rendered in Loki's configuration, such as 744h, 31d or 1y4w
+func parseLokiDuration(value string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"y":  365 * 24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+		"d":  24 * time.Hour,
+		"h":  time.Hour,
+		"m":  time.Minute,
+		"s":  time.Second,
+		"ms": time.Millisecond,
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "0" {
+		return 0, nil
+	}
+	if value == "" {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	var total time.Duration
+	rest := value
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+		rest = rest[i:]
+		j := strings.IndexFunc(rest, func(r rune) bool { return r >= '0' && r <= '9' })
+		if j < 0 {
+			j = len(rest)
+		}
+		unit, ok := units[rest[:j]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+		total += time.Duration(n) * unit
+		rest = rest[j:]
+	}
+	return total, nil
+}
+
+// formatRetention formats the retention report into a readable string
+func formatRetention(report retentionReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		period := report.RetentionPeriod
+		if period == "" {
+			period = "-"
+		}
+		line := fmt.Sprintf("retention %s %s", period, report.EnforcedBy)
+		if report.OldestAvailable != "" {
+			line += " " + report.OldestAvailable
+		}
+		if report.Selector != "" {
+			oldest := report.OldestData
+			if oldest == "" {
+				oldest = "-"
+			}
+			line += fmt.Sprintf("\noldest_data %s %s", oldest, report.Selector)
+		}
+		return line + "\n", nil
+
+	case "text":
+		var b strings.Builder
+		tenant := ""
+		if report.Tenant != "" {
+			tenant = " for tenant " + report.Tenant
+		}
+		switch {
+		case report.EnforcedBy == "unknown":
+			fmt.Fprintf(&b, "Retention%s is unknown because Loki's configuration is not accessible\n", tenant)
+		case report.RetentionPeriod == "":
+			fmt.Fprintf(&b, "No retention is enforced%s: logs are kept until deleted by other means\n", tenant)
+		default:
+			fmt.Fprintf(&b, "Retention%s: %s (enforced by the %s)\n", tenant, report.RetentionPeriod, strings.ReplaceAll(report.EnforcedBy, "_", " "))
+			fmt.Fprintf(&b, "Oldest queryable time: %s\n", report.OldestAvailable)
+		}
+		if report.RuntimeConfigError != "" {
+			fmt.Fprintf(&b, "Per-tenant overrides could not be read from /runtime_config: %s\n", report.RuntimeConfigError)
+		}
+		if report.Selector != "" {
+			if report.OldestData != "" {
+				fmt.Fprintf(&b, "Oldest logs for %s: day starting %s (probed back %s)\n", report.Selector, report.OldestData, report.ProbedBack)
+			} else {
+				fmt.Fprintf(&b, "No logs for %s in the last 24 hours, so the oldest logs could not be probed\n", report.Selector)
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
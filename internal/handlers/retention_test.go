@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestParseLokiDuration tests parsing durations rendered by Loki's configuration
+func TestParseLokiDuration(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"744h":  744 * time.Hour,
+		"31d":   31 * 24 * time.Hour,
+		"1y4w":  (365 + 28) * 24 * time.Hour,
+		"1h30m": 90 * time.Minute,
+		"500ms": 500 * time.Millisecond,
+		"0s":    0,
+		"0":     0,
+	}
+	for value, expected := range testCases {
+		if d, err := parseLokiDuration(value); err != nil || d != expected {
+			t.Errorf("%s: expected %v, but got %v (%v)", value, expected, d, err)
+		}
+	}
+	for _, value := range []string{"", "h", "10x", "1.5h"} {
+		if _, err := parseLokiDuration(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+// TestRetentionFromConfig tests which component enforces retention and the tenant's period
+func TestRetentionFromConfig(t *testing.T) {
+	config := parseYAMLScalars(testLokiConfig + "compactor:\n  retention_enabled: true\n")
+	runtimeConfig := parseYAMLScalars(testLokiRuntimeConfig)
+
+	if retention := retentionFromConfig(config, runtimeConfig, "tenant-a"); retention.Source != retentionCompactor || retention.Period != 744*time.Hour {
+		t.Errorf("Expected the global 744h retention, but got %+v", retention)
+	}
+	if retention := retentionFromConfig(config, runtimeConfig, "tenant-b"); retention.Period != 24*time.Hour {
+		t.Errorf("Expected the tenant's 24h override, but got %+v", retention)
+	}
+
+	config = parseYAMLScalars(testLokiConfig + "table_manager:\n  retention_deletes_enabled: true\n  retention_period: 2w\n")
+	if retention := retentionFromConfig(config, nil, ""); retention.Source != retentionTableManager || retention.Period != 14*24*time.Hour {
+		t.Errorf("Expected the table manager's 2w retention, but got %+v", retention)
+	}
+
+	if retention := retentionFromConfig(parseYAMLScalars(testLokiConfig), nil, ""); retention.Source != retentionNone || retention.Period != 0 {
+		t.Errorf("Expected no retention without the compactor, but got %+v", retention)
+	}
+}
+
+// oldestDataLokiClient has logs from a fixed time onwards and counts the queries it receives
+type oldestDataLokiClient struct {
+	fakeLokiClient
+	oldest  time.Time
+	queries int
+}
+
+func (f *oldestDataLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	f.queries++
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+	if end.After(f.oldest) {
+		result.Data.Result = []LokiEntry{{Stream: map[string]string{"app": "api"}, Values: [][]string{{"1", "line"}}}}
+	}
+	return result, nil
+}
+
+// TestProbeOldestData tests binary searching for the oldest day with logs
+func TestProbeOldestData(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := &oldestDataLokiClient{oldest: now.Add(-40*24*time.Hour - time.Hour)}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	oldest, found, err := probeOldestData(context.Background(), LokiConnection{}, `{app="api"}`, now, 365*24*time.Hour)
+	if err != nil || !found {
+		t.Fatalf("Expected the oldest data to be found, but got %v (%v)", found, err)
+	}
+	if expected := now.Add(-41 * 24 * time.Hour); !oldest.Equal(expected) {
+		t.Errorf("Expected the day starting %v, but got %v", expected, oldest)
+	}
+	if fake.queries > 11 {
+		t.Errorf("Expected about log2(365) queries, but got %d", fake.queries)
+	}
+
+	// No recent logs
+	fake.oldest = now
+	if _, found, _ := probeOldestData(context.Background(), LokiConnection{}, `{app="api"}`, now, 365*24*time.Hour); found {
+		t.Error("Expected no data to be found")
+	}
+}
+
+// TestHandleLokiQuery_RetentionWarning tests warning when a query starts before the retention period
+func TestHandleLokiQuery_RetentionWarning(t *testing.T) {
+	var configRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config":
+			configRequests++
+			w.Write([]byte(testLokiConfig + "compactor:\n  retention_enabled: true\n"))
+		case "/runtime_config":
+			w.Write([]byte(testLokiRuntimeConfig))
+		default:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+		}
+	}))
+	defer server.Close()
+
+	handler := WarningsMiddleware(HandleLokiQuery)
+	query := func(since, org string) string {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "since": since, "org": org}
+		result, err := handler(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		var texts []string
+		for _, content := range result.Content {
+			texts = append(texts, content.(mcp.TextContent).Text)
+		}
+		return strings.Join(texts, "\n")
+	}
+
+	if output := query("40d", "tenant-a"); !strings.Contains(output, "precedes the 744h retention period") {
+		t.Errorf("Expected a retention warning, but got %s", output)
+	}
+	if output := query("7d", "tenant-a"); strings.Contains(output, "retention") {
+		t.Errorf("Expected no warning within retention, but got %s", output)
+	}
+	if output := query("2d", "tenant-b"); !strings.Contains(output, "precedes the 24h retention period") {
+		t.Errorf("Expected a warning for the tenant's override, but got %s", output)
+	}
+	if configRequests != 2 {
+		t.Errorf("Expected the configuration to be read once per tenant, but got %d requests", configRequests)
+	}
+}
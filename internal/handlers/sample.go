@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Default number of entries fetched when sampling, so the sample is drawn from a bigger set than it returns
+const defaultSampleLimit = 1000
+
+// sampleOptions controls how many of the fetched log entries are returned
+type sampleOptions struct {
+	Size int     // number of entries to keep, 0 when unset
+	Rate float64 // fraction of entries to keep, 0 when unset
+}
+
+// sampleSummary describes a sampled result
+type sampleSummary struct {
+	Total    int // entries fetched
+	Returned int // entries kept
+}
+
+// sampleOption returns the tool option for sampling a number of the matching lines
+func sampleOption() mcp.ToolOption {
+	return mcp.WithNumber("sample",
+		mcp.Description(fmt.Sprintf("Return only this many of the matching lines: the oldest, the newest and lines spread evenly "+
+			"in between, with a count of the lines skipped. The limit defaults to %d when sampling", defaultSampleLimit)),
+	)
+}
+
+// sampleRateOption returns the tool option for sampling a fraction of the matching lines
+func sampleRateOption() mcp.ToolOption {
+	return mcp.WithNumber("sample_rate",
+		mcp.Description("Return this fraction of the matching lines, e.g. 0.1, spread like sample. Alternative to sample"),
+	)
+}
+
+// parseSampleOptions extracts the sampling options from tool arguments
+func parseSampleOptions(args map[string]any) (sampleOptions, error) {
+	var opts sampleOptions
+	size, hasSize := args["sample"].(float64)
+	rate, hasRate := args["sample_rate"].(float64)
+	if hasSize && hasRate {
+		return opts, fmt.Errorf("sample and sample_rate cannot be used together")
+	}
+	if hasSize {
+		if size < 1 || size != math.Trunc(size) {
+			return opts, fmt.Errorf("sample must be a positive whole number")
+		}
+		opts.Size = int(size)
+	}
+	if hasRate {
+		if rate <= 0 || rate > 1 {
+			return opts, fmt.Errorf("sample_rate must be greater than 0 and at most 1")
+		}
+		opts.Rate = rate
+	}
+	return opts, nil
+}
+
+// enabled reports whether sampling was requested
+func (o sampleOptions) enabled() bool {
+	return o.Size > 0 || o.Rate > 0
+}
+
+// apply keeps a spread subset of a result's entries in place: the oldest, the newest and entries
+// evenly distributed in time order between them. Streams left without entries are removed.
+func (o sampleOptions) apply(result *LokiResult) sampleSummary {
+	type ref struct {
+		stream, value int
+		ns            int64
+	}
+	var refs []ref
+	for i, stream := range result.Data.Result {
+		for j, val := range stream.Values {
+			var ns int64
+			if len(val) > 0 {
+				ns, _ = strconv.ParseInt(val[0], 10, 64)
+			}
+			refs = append(refs, ref{stream: i, value: j, ns: ns})
+		}
+	}
+	summary := sampleSummary{Total: len(refs), Returned: len(refs)}
+
+	size := o.Size
+	if o.Rate > 0 {
+		size = int(math.Ceil(o.Rate * float64(len(refs))))
+	}
+	if size >= len(refs) {
+		return summary
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].ns < refs[j].ns })
+
+	// Evenly spaced positions, including the first and the last entry
+	keep := make(map[[2]int]bool, size)
+	for i := range size {
+		pos := 0
+		if size > 1 {
+			pos = int(math.Round(float64(i) * float64(len(refs)-1) / float64(size-1)))
+		}
+		keep[[2]int{refs[pos].stream, refs[pos].value}] = true
+	}
+
+	streams := result.Data.Result[:0]
+	for i, stream := range result.Data.Result {
+		var values [][]string
+		for j, val := range stream.Values {
+			if keep[[2]int{i, j}] {
+				values = append(values, val)
+			}
+		}
+		if len(values) > 0 {
+			stream.Values = values
+			streams = append(streams, stream)
+		}
+	}
+	result.Data.Result = streams
+	summary.Returned = len(keep)
+	return summary
+}
+
+// String describes the sample for the tool result
+func (s sampleSummary) String() string {
+	skipped := s.Total - s.Returned
+	switch {
+	case skipped == 0:
+		return fmt.Sprintf("Sample: all %d matching lines returned", s.Total)
+	case s.Returned == 1:
+		return fmt.Sprintf("Sample: the oldest of %d lines returned, %d skipped", s.Total, skipped)
+	}
+	gaps := s.Returned - 1
+	return fmt.Sprintf("Sample: %d of %d lines returned, spread evenly from the oldest to the newest; %d skipped "+
+		"(about %d between consecutive lines)", s.Returned, s.Total, skipped, (skipped+gaps/2)/gaps)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sampleTestResult returns a result with two streams of interleaved entries at seconds 0 to n-1
+func sampleTestResult(n int) *LokiResult {
+	result := &LokiResult{}
+	result.Data.Result = []LokiEntry{{Stream: map[string]string{"pod": "a"}}, {Stream: map[string]string{"pod": "b"}}}
+	for i := range n {
+		stream := &result.Data.Result[i%2]
+		stream.Values = append(stream.Values, []string{fmt.Sprintf("%d", int64(i)*1000000000), fmt.Sprintf("line %d", i)})
+	}
+	return result
+}
+
+// TestSampleOptions_Apply tests keeping the oldest, the newest and evenly spread entries
+func TestSampleOptions_Apply(t *testing.T) {
+	result := sampleTestResult(101)
+	summary := sampleOptions{Size: 5}.apply(result)
+	if summary.Total != 101 || summary.Returned != 5 {
+		t.Fatalf("Unexpected summary: %+v", summary)
+	}
+	var lines []string
+	for _, entry := range sortedLogEntries(result) {
+		lines = append(lines, entry.Line)
+	}
+	if got := strings.Join(lines, ","); got != "line 0,line 25,line 50,line 75,line 100" {
+		t.Errorf("Expected evenly spread lines, but got %s", got)
+	}
+	if !strings.Contains(summary.String(), "5 of 101 lines returned") || !strings.Contains(summary.String(), "96 skipped (about 24 between") {
+		t.Errorf("Unexpected description: %s", summary)
+	}
+
+	// A stream left without entries is removed
+	result = sampleTestResult(3)
+	if summary := (sampleOptions{Size: 1}).apply(result); summary.Returned != 1 || len(result.Data.Result) != 1 {
+		t.Errorf("Expected one entry in one stream, but got %+v with %d streams", summary, len(result.Data.Result))
+	}
+
+	result = sampleTestResult(10)
+	if summary := (sampleOptions{Rate: 0.25}).apply(result); summary.Returned != 3 {
+		t.Errorf("Expected 3 entries for a 0.25 rate, but got %+v", summary)
+	}
+	if summary := (sampleOptions{Size: 20}).apply(sampleTestResult(10)); summary.Returned != 10 || summary.String() != "Sample: all 10 matching lines returned" {
+		t.Errorf("Expected all entries, but got %+v", summary)
+	}
+}
+
+// TestParseSampleOptions tests validating the sampling arguments
+func TestParseSampleOptions(t *testing.T) {
+	invalid := map[string]map[string]any{
+		"cannot be used together":   {"sample": float64(10), "sample_rate": 0.1},
+		"positive whole number":     {"sample": float64(0)},
+		"at most 1":                 {"sample_rate": 1.5},
+		"greater than 0":            {"sample_rate": float64(0)},
+		"sample must be a positive": {"sample": 2.5},
+	}
+	for expected, args := range invalid {
+		if _, err := parseSampleOptions(args); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q for %v, but got %v", expected, args, err)
+		}
+	}
+}
+
+// TestHandleLokiQuery_Sample tests sampling query results and reporting what was skipped
+func TestHandleLokiQuery_Sample(t *testing.T) {
+	var limit string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit = r.URL.Query().Get("limit")
+		var values []string
+		for i := range 50 {
+			values = append(values, fmt.Sprintf(`["%d", "line %d"]`, int64(1700000000+i)*1000000000, i))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[%s]}]}}`, strings.Join(values, ","))
+	}))
+	defer server.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "sample": float64(3)}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if limit != fmt.Sprint(defaultSampleLimit) {
+		t.Errorf("Expected the sampling limit, but got %s", limit)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if strings.Count(text, "\n") != 3 || !strings.Contains(text, "line 0") || !strings.Contains(text, "line 49") {
+		t.Errorf("Expected the oldest, middle and newest lines, but got:\n%s", text)
+	}
+	if note := result.Content[1].(mcp.TextContent).Text; !strings.Contains(note, "3 of 50 lines returned") {
+		t.Errorf("Unexpected sample note: %s", note)
+	}
+	if result.Meta["entry_count"] != 50 || result.Meta["sampled"] != 3 || result.Meta["sample_skipped"] != 47 {
+		t.Errorf("Unexpected metadata: %v", result.Meta)
+	}
+}
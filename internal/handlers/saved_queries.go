@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for the JSON file defining saved queries
+const EnvLokiSavedQueriesFile = "LOKI_SAVED_QUERIES_FILE"
+
+// Types of saved query parameters. Each type is validated and substituted so that a value, for
+// example one chosen by a model, can only fill in its placeholder and never change the query.
+const (
+	// ParamLabelValue is any string, substituted as a quoted LogQL string, or a regular expression
+	// matching it literally after =~, !~ or |~
+	ParamLabelValue = "label_value"
+	// ParamDuration is a LogQL duration such as 5m or 1h30m
+	ParamDuration = "duration"
+	// ParamNumber is a finite number, optionally limited by min and max
+	ParamNumber = "number"
+	// ParamEnum is one of the values listed in the parameter, substituted as is
+	ParamEnum = "enum"
+)
+
+// Longest label_value parameter accepted
+const maxLabelValueLength = 1024
+
+var (
+	// logQLDurationPattern matches LogQL durations, e.g. 5m, 1h30m or 7d
+	logQLDurationPattern = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+$`)
+	// regexOperatorPattern matches the operators whose right-hand side is a regular expression
+	regexOperatorPattern = regexp.MustCompile(`(=~|!~|\|~)\s*$`)
+)
+
+// SavedQuery is a named LogQL log query with typed parameters referenced as $name
+type SavedQuery struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Query       string                `json:"query"` // e.g. {app=$app} |= "error"
+	Parameters  []SavedQueryParameter `json:"parameters,omitempty"`
+	// Baseline and Remediation are runbook notes returned with the results, so answers include team knowledge
+	Baseline    string `json:"baseline,omitempty"`    // what normal results look like, e.g. "an error rate under 0.1% is normal"
+	Remediation string `json:"remediation,omitempty"` // what to do when the results are not normal
+
+	placeholders []queryPlaceholder
+}
+
+// SavedQueryParameter is a typed parameter of a saved query
+type SavedQueryParameter struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // label_value, duration, number or enum
+	Description string   `json:"description,omitempty"`
+	Values      []string `json:"values,omitempty"` // allowed values of enum parameters
+	Min         *float64 `json:"min,omitempty"`    // lowest value of number parameters
+	Max         *float64 `json:"max,omitempty"`    // highest value of number parameters
+	// ValuesFrom limits label_value parameters to the values a label currently has in Loki
+	ValuesFrom *LabelValuesSource `json:"values_from,omitempty"`
+	// Default is used when the parameter is not given. Parameters without a default are required.
+	Default any `json:"default,omitempty"`
+}
+
+// queryPlaceholder is a $name reference in a saved query
+type queryPlaceholder struct {
+	name       string
+	start, end int
+	inString   bool // inside a quoted string
+	regex      bool // the right-hand side of a regular expression operator
+}
+
+// LoadSavedQueries reads saved queries from a JSON file containing an array of queries
+func LoadSavedQueries(path string) ([]SavedQuery, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved queries file: %w", err)
+	}
+	var queries []SavedQuery
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("failed to parse saved queries file %s: %w", path, err)
+	}
+	if err := compileSavedQueries(queries); err != nil {
+		return nil, fmt.Errorf("invalid saved queries file %s: %w", path, err)
+	}
+	return queries, nil
+}
+
+// compileSavedQueries checks saved queries and finds the placeholders in them
+func compileSavedQueries(queries []SavedQuery) error {
+	seen := make(map[string]bool)
+	for i := range queries {
+		q := &queries[i]
+		if q.Name == "" {
+			return fmt.Errorf("saved query name is required")
+		}
+		if seen[q.Name] {
+			return fmt.Errorf("duplicate saved query %s", q.Name)
+		}
+		seen[q.Name] = true
+		if err := q.compile(); err != nil {
+			return fmt.Errorf("saved query %s: %w", q.Name, err)
+		}
+	}
+	return nil
+}
+
+// compile checks the parameters of a saved query and how its placeholders use them
+func (q *SavedQuery) compile() error {
+	if !strings.HasPrefix(strings.TrimSpace(q.Query), "{") {
+		return fmt.Errorf("query must be a log query starting with a stream selector")
+	}
+	params := make(map[string]*SavedQueryParameter)
+	for i := range q.Parameters {
+		p := &q.Parameters[i]
+		if !labelNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name: %q", p.Name)
+		}
+		if params[p.Name] != nil {
+			return fmt.Errorf("duplicate parameter %s", p.Name)
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		params[p.Name] = p
+	}
+
+	q.placeholders = scanPlaceholders(q.Query)
+	used := make(map[string]bool)
+	for _, ph := range q.placeholders {
+		p := params[ph.name]
+		if p == nil {
+			return fmt.Errorf("query references undeclared parameter $%s", ph.name)
+		}
+		if p.Type == ParamLabelValue && ph.inString {
+			return fmt.Errorf("remove the quotes around $%s: label_value parameters are quoted when substituted", ph.name)
+		}
+		used[ph.name] = true
+	}
+	for _, p := range q.Parameters {
+		if !used[p.Name] {
+			return fmt.Errorf("parameter %s is not used in the query", p.Name)
+		}
+	}
+	return nil
+}
+
+// validate checks a parameter's type, constraints and default
+func (p *SavedQueryParameter) validate() error {
+	switch p.Type {
+	case ParamLabelValue, ParamDuration, ParamNumber:
+		if len(p.Values) > 0 {
+			return fmt.Errorf("values are only allowed for enum parameters")
+		}
+	case ParamEnum:
+		if len(p.Values) == 0 {
+			return fmt.Errorf("enum parameters need values")
+		}
+		// Enum values are substituted as is, so they must not end a string or span lines
+		for _, v := range p.Values {
+			if v == "" || strings.ContainsAny(v, "\"`\\\n\r") {
+				return fmt.Errorf("invalid enum value %q: values must not be empty or contain quotes, backslashes or line breaks", v)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %q. Supported types: %s, %s, %s, %s", p.Type, ParamLabelValue, ParamDuration, ParamNumber, ParamEnum)
+	}
+	if (p.Min != nil || p.Max != nil) && p.Type != ParamNumber {
+		return fmt.Errorf("min and max are only allowed for number parameters")
+	}
+	if p.ValuesFrom != nil {
+		if p.Type != ParamLabelValue {
+			return fmt.Errorf("values_from is only allowed for label_value parameters")
+		}
+		if err := p.ValuesFrom.validate(); err != nil {
+			return fmt.Errorf("values_from: %w", err)
+		}
+	}
+	if p.Default != nil {
+		if _, err := p.parse(p.Default, false); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+	return nil
+}
+
+// parse validates a parameter value and returns its LogQL form: a quoted string for label values,
+// or a regular expression matching the value literally when regex is set
+func (p *SavedQueryParameter) parse(value any, regex bool) (string, error) {
+	switch p.Type {
+	case ParamLabelValue:
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a string")
+		}
+		if len(s) > maxLabelValueLength {
+			return "", fmt.Errorf("value is longer than %d characters", maxLabelValueLength)
+		}
+		if regex {
+			return quoteLogQLRegex(s), nil
+		}
+		return quoteLogQLString(s), nil
+
+	case ParamDuration:
+		s, ok := value.(string)
+		if !ok || !logQLDurationPattern.MatchString(s) || !strings.ContainsAny(s, "123456789") {
+			return "", fmt.Errorf("expected a duration such as 5m or 1h30m")
+		}
+		return s, nil
+
+	case ParamNumber:
+		var n float64
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return "", fmt.Errorf("expected a number")
+			}
+			n = parsed
+		default:
+			return "", fmt.Errorf("expected a number")
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", fmt.Errorf("expected a finite number")
+		}
+		if p.Min != nil && n < *p.Min {
+			return "", fmt.Errorf("must be at least %s", strconv.FormatFloat(*p.Min, 'f', -1, 64))
+		}
+		if p.Max != nil && n > *p.Max {
+			return "", fmt.Errorf("must be at most %s", strconv.FormatFloat(*p.Max, 'f', -1, 64))
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+
+	case ParamEnum:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(p.Values, s) {
+			return "", fmt.Errorf("expected one of %s", strings.Join(p.Values, ", "))
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported type %q", p.Type)
+}
+
+// scanPlaceholders finds the $name references in a query, noting which are inside quoted strings
+// and which follow a regular expression operator
+func scanPlaceholders(query string) []queryPlaceholder {
+	var placeholders []queryPlaceholder
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+			continue
+		case quote != 0 && c == quote:
+			quote = 0
+			continue
+		case quote == 0 && (c == '"' || c == '`'):
+			quote = c
+			continue
+		case c != '$' || i+1 >= len(query):
+			continue
+		}
+		if next := query[i+1]; next != '_' && (next < 'a' || next > 'z') && (next < 'A' || next > 'Z') {
+			continue
+		}
+		end := i + 1
+		for end < len(query) && isIdentChar(query[end]) {
+			end++
+		}
+		placeholders = append(placeholders, queryPlaceholder{
+			name:     query[i+1 : end],
+			start:    i,
+			end:      end,
+			inString: quote != 0,
+			regex:    quote == 0 && regexOperatorPattern.MatchString(query[:i]),
+		})
+		i = end - 1
+	}
+	return placeholders
+}
+
+// render validates the given parameter values and substitutes them into the query
+func (q *SavedQuery) render(values map[string]any) (string, error) {
+	params := make(map[string]*SavedQueryParameter, len(q.Parameters))
+	for i := range q.Parameters {
+		params[q.Parameters[i].Name] = &q.Parameters[i]
+	}
+	for _, name := range sortedKeys(values) {
+		if params[name] == nil {
+			return "", fmt.Errorf("unknown parameter %s for saved query %s. Parameters: %s", name, q.Name, q.describeParameters())
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, ph := range q.placeholders {
+		p := params[ph.name]
+		value, ok := values[ph.name]
+		if !ok || value == nil {
+			value = p.Default
+		}
+		if value == nil {
+			return "", fmt.Errorf("parameter %s is required for saved query %s", ph.name, q.Name)
+		}
+		rendered, err := p.parse(value, ph.regex)
+		if err != nil {
+			return "", fmt.Errorf("invalid parameter %s: %v", ph.name, err)
+		}
+		b.WriteString(q.Query[last:ph.start])
+		b.WriteString(rendered)
+		last = ph.end
+	}
+	b.WriteString(q.Query[last:])
+	return b.String(), nil
+}
+
+// describeParameters lists the parameters of a saved query with their types
+func (q *SavedQuery) describeParameters() string {
+	if len(q.Parameters) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(q.Parameters))
+	for _, p := range q.Parameters {
+		part := p.Name + " (" + p.Type
+		if p.Type == ParamEnum {
+			part += ": " + strings.Join(p.Values, "|")
+		}
+		if p.ValuesFrom != nil {
+			part += " from " + p.ValuesFrom.String()
+		}
+		if p.Default != nil {
+			part += fmt.Sprintf(", default %v", p.Default)
+		}
+		parts = append(parts, part+")")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hasLabelValuesSource reports whether any parameter of a saved query takes its values from a label
+func (q *SavedQuery) hasLabelValuesSource() bool {
+	return slices.ContainsFunc(q.Parameters, func(p SavedQueryParameter) bool { return p.ValuesFrom != nil })
+}
+
+// findSavedQuery returns the saved query with the given name
+func findSavedQuery(cfg *Config, name string) (*SavedQuery, bool) {
+	for i := range cfg.SavedQueries {
+		if cfg.SavedQueries[i].Name == name {
+			return &cfg.SavedQueries[i], true
+		}
+	}
+	return nil, false
+}
+
+// NewLokiSavedQueryTool creates and returns a tool for running the configured saved queries
+func NewLokiSavedQueryTool() mcp.Tool {
+	cfg := CurrentConfig()
+	names := make([]string, 0, len(cfg.SavedQueries))
+	var catalog strings.Builder
+	for _, q := range cfg.SavedQueries {
+		names = append(names, q.Name)
+		fmt.Fprintf(&catalog, "\n- %s: parameters %s", q.Name, q.describeParameters())
+		if q.Description != "" {
+			catalog.WriteString(". " + q.Description)
+		}
+	}
+
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Run a saved LogQL query by name, filling in its typed parameters. Parameter values are " +
+			"validated and quoted, so they can only fill in the query and never change it. Results include the team's runbook " +
+			"notes for the query, such as its expected baseline and remediation hints; take them into account when interpreting " +
+			"the results. Saved queries:" + catalog.String()),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the saved query"),
+			mcp.Enum(names...),
+		),
+		mcp.WithObject("parameters",
+			mcp.Description("Parameter values by name, e.g. {\"app\": \"api\", \"window\": \"5m\"}"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return (default: 100)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, text, ndjson, logfmt, or html (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+		positionOption(),
+		bucketOption(),
+		compactOption(),
+		relativeTimeOption(),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_saved_query", opts...)
+}
+
+// HandleLokiSavedQuery handles saved query tool requests by rendering the query and running it with loki_query
+func HandleLokiSavedQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	name, _ := args["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	q, ok := findSavedQuery(CurrentConfig(), name)
+	if !ok {
+		return nil, fmt.Errorf("unknown saved query: %s", name)
+	}
+	values, ok := args["parameters"].(map[string]any)
+	if !ok && args["parameters"] != nil {
+		return nil, fmt.Errorf("parameters must be an object of parameter values by name")
+	}
+	query, err := q.render(values)
+	if err != nil {
+		return nil, err
+	}
+	if q.hasLabelValuesSource() {
+		params, err := parseToolParams(ctx, request, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.checkLabelValues(ctx, params, values); err != nil {
+			return nil, err
+		}
+	}
+
+	queryArgs := make(map[string]any, len(args))
+	for k, v := range args {
+		if k != "name" && k != "parameters" {
+			queryArgs[k] = v
+		}
+	}
+	queryArgs["query"] = query
+	request.Params.Arguments = queryArgs
+	result, err := HandleLokiQuery(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return q.annotate(result), nil
+}
+
+// annotate adds the runbook notes of a saved query to its results, as text and in the _meta field
+func (q *SavedQuery) annotate(result *mcp.CallToolResult) *mcp.CallToolResult {
+	if q.Description == "" && q.Baseline == "" && q.Remediation == "" {
+		return result
+	}
+	notes := []string{"Runbook notes for saved query " + q.Name + ":"}
+	meta := map[string]any{"name": q.Name}
+	for _, note := range []struct{ key, title, text string }{
+		{"description", "About", q.Description},
+		{"baseline", "Expected baseline", q.Baseline},
+		{"remediation", "Remediation", q.Remediation},
+	} {
+		if note.text != "" {
+			notes = append(notes, "  "+note.title+": "+note.text)
+			meta[note.key] = note.text
+		}
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(strings.Join(notes, "\n")))
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["saved_query"] = meta
+	return result
+}
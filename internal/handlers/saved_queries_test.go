@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// savedQueryTestFile defines saved queries using each parameter type
+const savedQueryTestFile = `[
+	{
+		"name": "errors",
+		"description": "Errors of an app",
+		"baseline": "An error rate under 0.1% is normal",
+		"remediation": "Check the latest deploy and roll back if errors started with it",
+		"query": "{namespace=$namespace, app=~$app} |~ $text | level=$level | duration > $slow [$window]",
+		"parameters": [
+			{"name": "namespace", "type": "label_value", "default": "prod"},
+			{"name": "app", "type": "label_value"},
+			{"name": "text", "type": "label_value", "default": "error"},
+			{"name": "level", "type": "enum", "values": ["error", "warn"], "default": "error"},
+			{"name": "slow", "type": "number", "min": 0, "max": 60000, "default": 500},
+			{"name": "window", "type": "duration", "default": "5m"}
+		]
+	}
+]`
+
+// loadSavedQueryTest loads the test saved queries
+func loadSavedQueryTest(t *testing.T) *SavedQuery {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "saved-queries.json")
+	os.WriteFile(path, []byte(savedQueryTestFile), 0o644)
+	queries, err := LoadSavedQueries(path)
+	if err != nil || len(queries) != 1 {
+		t.Fatalf("Unexpected saved queries: %v (%v)", queries, err)
+	}
+	return &queries[0]
+}
+
+// TestSavedQuery_Render tests substituting typed parameters and their defaults
+func TestSavedQuery_Render(t *testing.T) {
+	q := loadSavedQueryTest(t)
+	query, err := q.render(map[string]any{"app": "api.v2", "slow": "1500", "window": "1h30m"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expected := `{namespace="prod", app=~"api\\.v2"} |~ "error" | level=error | duration > 1500 [1h30m]`
+	if query != expected {
+		t.Errorf("Expected %s, but got %s", expected, query)
+	}
+
+	invalid := []struct {
+		values   map[string]any
+		expected string
+	}{
+		{map[string]any{}, "parameter app is required"},
+		{map[string]any{"app": "api", "env": "prod"}, "unknown parameter env for saved query errors"},
+		{map[string]any{"app": 5.0}, "invalid parameter app: expected a string"},
+		{map[string]any{"app": "api", "level": "error} or vector(1)"}, "invalid parameter level: expected one of error, warn"},
+		{map[string]any{"app": "api", "slow": "1e3 or vector(1)"}, "invalid parameter slow: expected a number"},
+		{map[string]any{"app": "api", "slow": 1e9}, "invalid parameter slow: must be at most 60000"},
+		{map[string]any{"app": "api", "slow": -1.0}, "invalid parameter slow: must be at least 0"},
+		{map[string]any{"app": "api", "window": "5m]) or vector(1) #"}, "invalid parameter window: expected a duration"},
+		{map[string]any{"app": "api", "window": "0m"}, "invalid parameter window: expected a duration"},
+	}
+	for _, test := range invalid {
+		if _, err := q.render(test.values); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected %q for %v, but got %v", test.expected, test.values, err)
+		}
+	}
+}
+
+// TestSavedQuery_RenderInjection tests that label values cannot change the structure of the query
+func TestSavedQuery_RenderInjection(t *testing.T) {
+	q := loadSavedQueryTest(t)
+	for _, value := range logQLInjectionValues {
+		query, err := q.render(map[string]any{"namespace": value, "app": value, "text": value})
+		if err != nil {
+			t.Fatalf("Expected no error for %q, but got %v", value, err)
+		}
+		tokens, err := tokenizeLogQL(query)
+		if err != nil {
+			t.Fatalf("Expected %s to tokenize, but got %v", query, err)
+		}
+		var strs []string
+		for _, token := range tokens {
+			if token.kind == "string" {
+				strs = append(strs, token.text)
+			}
+		}
+		if len(tokens) != 22 || len(strs) != 3 || strs[0] != quoteLogQLString(value) || strs[1] != quoteLogQLRegex(value) || strs[2] != quoteLogQLRegex(value) {
+			t.Errorf("Unexpected query for %q: %s", value, query)
+		}
+	}
+}
+
+// TestCompileSavedQueries tests rejecting parameters and placeholders that could be misused
+func TestCompileSavedQueries(t *testing.T) {
+	invalid := map[string]SavedQuery{
+		"undeclared parameter $app": {Name: "q", Query: `{app=$app}`},
+		"remove the quotes around $app": {Name: "q", Query: `{app="$app"}`,
+			Parameters: []SavedQueryParameter{{Name: "app", Type: ParamLabelValue}}},
+		"parameter env is not used": {Name: "q", Query: `{app="api"}`,
+			Parameters: []SavedQueryParameter{{Name: "env", Type: ParamLabelValue}}},
+		"unsupported type \"string\"": {Name: "q", Query: `{app=$app}`,
+			Parameters: []SavedQueryParameter{{Name: "app", Type: "string"}}},
+		"invalid enum value": {Name: "q", Query: `{app="$app"}`,
+			Parameters: []SavedQueryParameter{{Name: "app", Type: ParamEnum, Values: []string{`api"} or {x="`}}}},
+		"invalid default: expected a duration": {Name: "q", Query: `{app="api"} [$w]`,
+			Parameters: []SavedQueryParameter{{Name: "w", Type: ParamDuration, Default: "soon"}}},
+		"must be a log query": {Name: "q", Query: `rate({app="api"}[5m])`},
+	}
+	for expected, q := range invalid {
+		if err := compileSavedQueries([]SavedQuery{q}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q, but got %v", expected, err)
+		}
+	}
+
+	// Dollar signs in strings are not placeholders, e.g. regex anchors
+	queries := []SavedQuery{{Name: "q", Query: "{app=$app} |~ \"done$\" |= `$5`",
+		Parameters: []SavedQueryParameter{{Name: "app", Type: ParamLabelValue}}}}
+	if err := compileSavedQueries(queries); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(queries[0].placeholders) != 1 {
+		t.Errorf("Expected only $app as a placeholder, but got %+v", queries[0].placeholders)
+	}
+}
+
+// TestHandleLokiSavedQuery tests running a saved query with loki_query
+func TestHandleLokiSavedQuery(t *testing.T) {
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	var query string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	t.Cleanup(loki.Close)
+	SetConfig(&Config{LokiURL: loki.URL, SavedQueries: []SavedQuery{*loadSavedQueryTest(t)}})
+
+	tool := NewLokiSavedQueryTool()
+	if !strings.Contains(tool.Description, "- errors: parameters namespace (label_value, default prod), app (label_value)") {
+		t.Errorf("Expected the saved queries in the description, but got %s", tool.Description)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"name": "errors", "parameters": map[string]any{"app": "api"}, "limit": float64(5)}
+	result, err := HandleLokiSavedQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.HasPrefix(query, `{namespace="prod", app=~"api"}`) {
+		t.Errorf("Unexpected query: %s", query)
+	}
+
+	// The runbook notes are returned with the results
+	notes := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+	expected := "Runbook notes for saved query errors:\n  About: Errors of an app\n  Expected baseline: An error rate under 0.1% is normal\n" +
+		"  Remediation: Check the latest deploy and roll back if errors started with it"
+	if notes != expected {
+		t.Errorf("Expected the runbook notes, but got %q", notes)
+	}
+	if meta, _ := result.Meta["saved_query"].(map[string]any); meta["baseline"] != "An error rate under 0.1% is normal" {
+		t.Errorf("Expected the runbook notes in the metadata, but got %v", result.Meta["saved_query"])
+	}
+
+	request.Params.Arguments = map[string]any{"name": "missing"}
+	if _, err := HandleLokiSavedQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "unknown saved query: missing") {
+		t.Errorf("Expected an unknown saved query error, but got %v", err)
+	}
+}
+
+// TestValidateSavedQueriesFile tests reporting schema and parameter problems
+func TestValidateSavedQueriesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "saved-queries.json")
+	os.WriteFile(path, []byte(savedQueryTestFile), 0o644)
+	if problems := ValidateSavedQueriesFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, but got %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "q", "query": "{app=$app}", "parameters": [{"name": "app", "type": "text"}]}]`), 0o644)
+	problems := ValidateSavedQueriesFile(path)
+	if len(problems) != 1 || !strings.Contains(problems[0], "$[0].parameters[0].type: must be one of label_value, duration, number, enum") {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// LabelValuesSource resolves the allowed values of a saved query parameter from the values
+// of a label, like a Grafana label_values(selector, label) template variable
+type LabelValuesSource struct {
+	Label    string `json:"label"`              // e.g. app
+	Selector string `json:"selector,omitempty"` // only values of streams matching it, e.g. {namespace="prod"}
+}
+
+// savedQueryOption lists the valid values of a saved query parameter
+type savedQueryOption struct {
+	Parameter   string   `json:"parameter"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Source      string   `json:"source,omitempty"` // where dynamic values come from
+	Values      []string `json:"values,omitempty"`
+	Default     any      `json:"default,omitempty"`
+}
+
+// validate checks the label name and selector of a label values source
+func (s *LabelValuesSource) validate() error {
+	if !labelNamePattern.MatchString(s.Label) {
+		return fmt.Errorf("invalid label name: %q", s.Label)
+	}
+	if s.Selector != "" && !strings.HasPrefix(strings.TrimSpace(s.Selector), "{") {
+		return fmt.Errorf("selector must be a stream selector, e.g. {namespace=\"prod\"}")
+	}
+	return nil
+}
+
+// String describes the source like a Grafana template variable query
+func (s *LabelValuesSource) String() string {
+	if s.Selector == "" {
+		return fmt.Sprintf("label_values(%s)", s.Label)
+	}
+	return fmt.Sprintf("label_values(%s, %s)", s.Selector, s.Label)
+}
+
+// resolve returns the sorted values of the source's label in the given window
+func (s *LabelValuesSource) resolve(ctx context.Context, conn LokiConnection, start, end time.Time) ([]string, error) {
+	if s.Selector == "" {
+		result, err := CurrentLokiClient().LabelValues(ctx, conn, s.Label, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("label values query execution failed: %w", err)
+		}
+		values := slices.Clone(result.Data)
+		sort.Strings(values)
+		return values, nil
+	}
+
+	result, err := CurrentLokiClient().Series(ctx, conn, applySessionSelector(ctx, s.Selector), start, end)
+	if err != nil {
+		return nil, fmt.Errorf("series query execution failed: %w", err)
+	}
+	seen := make(map[string]bool)
+	var values []string
+	for _, series := range result.Data {
+		if value := series[s.Label]; value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// checkLabelValues checks that the given values of parameters with a label values source
+// are values the label has in the window. Defaults are trusted, as the team chose them.
+func (q *SavedQuery) checkLabelValues(ctx context.Context, params toolParams, values map[string]any) error {
+	for _, p := range q.Parameters {
+		value, ok := values[p.Name].(string)
+		if !ok || p.ValuesFrom == nil {
+			continue
+		}
+		allowed, err := p.ValuesFrom.resolve(ctx, params.Conn, params.Start, params.End)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the values of parameter %s: %w", p.Name, err)
+		}
+		if !slices.Contains(allowed, value) {
+			return fmt.Errorf("invalid parameter %s: %q is not a value of %s in the selected time range. "+
+				"Use loki_saved_query_options to list the valid values", p.Name, value, p.ValuesFrom)
+		}
+	}
+	return nil
+}
+
+// NewLokiSavedQueryOptionsTool creates and returns a tool for listing the valid parameter values of saved queries
+func NewLokiSavedQueryOptionsTool() mcp.Tool {
+	cfg := CurrentConfig()
+	names := make([]string, 0, len(cfg.SavedQueries))
+	for _, q := range cfg.SavedQueries {
+		names = append(names, q.Name)
+	}
+
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("List the valid values of the parameters of a saved query, to pick values for loki_saved_query. " +
+			"Parameters whose values come from a label are resolved from the label values Loki has in the time range, " +
+			"like Grafana template variables; loki_saved_query rejects other values for them."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the saved query"),
+			mcp.Enum(names...),
+		),
+		mcp.WithString("parameter",
+			mcp.Description("Only list the values of this parameter (default: all parameters)"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for resolving label values (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for resolving label values (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_saved_query_options", opts...)
+}
+
+// HandleLokiSavedQueryOptions handles saved query options tool requests
+func HandleLokiSavedQueryOptions(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := params.Args["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	q, ok := findSavedQuery(CurrentConfig(), name)
+	if !ok {
+		return nil, fmt.Errorf("unknown saved query: %s", name)
+	}
+	parameter, _ := params.Args["parameter"].(string)
+
+	var options []savedQueryOption
+	for _, p := range q.Parameters {
+		if parameter != "" && p.Name != parameter {
+			continue
+		}
+		option := savedQueryOption{Parameter: p.Name, Type: p.Type, Description: p.Description, Default: p.Default}
+		switch {
+		case p.ValuesFrom != nil:
+			option.Source = p.ValuesFrom.String()
+			if option.Values, err = p.ValuesFrom.resolve(ctx, params.Conn, params.Start, params.End); err != nil {
+				return nil, fmt.Errorf("failed to resolve the values of parameter %s: %w", p.Name, err)
+			}
+		case p.Type == ParamEnum:
+			option.Values = p.Values
+		}
+		options = append(options, option)
+	}
+	if parameter != "" && len(options) == 0 {
+		return nil, fmt.Errorf("unknown parameter %s for saved query %s. Parameters: %s", parameter, q.Name, q.describeParameters())
+	}
+
+	formattedResult, err := formatSavedQueryOptions(q.Name, options, params.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	metadata := newResultMetadata(params)
+	metadata.EntryCount = len(options)
+	return metadata.attach(mcp.NewToolResultText(formattedResult)), nil
+}
+
+// formatSavedQueryOptions formats the parameter options of a saved query into a readable string
+func formatSavedQueryOptions(name string, options []savedQueryOption, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(options, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		if len(options) == 0 {
+			return fmt.Sprintf("Saved query %s has no parameters", name), nil
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Parameters of saved query %s:\n", name)
+		for _, o := range options {
+			fmt.Fprintf(&b, "\n%s (%s)", o.Parameter, o.Type)
+			if o.Default != nil {
+				fmt.Fprintf(&b, ", default %v", o.Default)
+			}
+			if o.Description != "" {
+				b.WriteString(": " + o.Description)
+			}
+			b.WriteString("\n")
+			switch {
+			case o.Source != "" && len(o.Values) == 0:
+				fmt.Fprintf(&b, "  No values of %s in the selected time range\n", o.Source)
+			case o.Source != "":
+				fmt.Fprintf(&b, "  %d values of %s: %s\n", len(o.Values), o.Source, strings.Join(o.Values, ", "))
+			case len(o.Values) > 0:
+				fmt.Fprintf(&b, "  One of: %s\n", strings.Join(o.Values, ", "))
+			default:
+				fmt.Fprintf(&b, "  Any %s\n", strings.ReplaceAll(o.Type, "_", " "))
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
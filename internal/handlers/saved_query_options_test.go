@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// labelValuesLokiClient returns canned label values and series and records the calls it receives
+type labelValuesLokiClient struct {
+	fakeLokiClient
+	values map[string][]string
+	labels []string
+}
+
+func (f *labelValuesLokiClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	f.labels = append(f.labels, label)
+	return &LokiLabelValuesResult{Status: "success", Data: f.values[label]}, nil
+}
+
+// savedQueryOptionsTestFile defines a saved query with parameters resolved from label values
+const savedQueryOptionsTestFile = `[
+	{
+		"name": "errors",
+		"query": "{namespace=$namespace, app=$app} |= $text | level=$level",
+		"parameters": [
+			{"name": "namespace", "type": "label_value", "values_from": {"label": "namespace"}, "default": "prod"},
+			{"name": "app", "type": "label_value", "description": "App name", "values_from": {"label": "app", "selector": "{namespace=\"prod\"}"}},
+			{"name": "text", "type": "label_value", "default": "error"},
+			{"name": "level", "type": "enum", "values": ["error", "warn"], "default": "error"}
+		]
+	}
+]`
+
+// setSavedQueryOptionsTest configures the test saved queries and a fake Loki client
+func setSavedQueryOptionsTest(t *testing.T, lokiURL string) *labelValuesLokiClient {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "saved-queries.json")
+	os.WriteFile(path, []byte(savedQueryOptionsTestFile), 0o644)
+	queries, err := LoadSavedQueries(path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if problems := ValidateSavedQueriesFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, but got %v", problems)
+	}
+	SetConfig(&Config{LokiURL: lokiURL, SavedQueries: queries})
+	fake := &labelValuesLokiClient{
+		fakeLokiClient: fakeLokiClient{series: []map[string]string{
+			{"namespace": "prod", "app": "checkout"}, {"namespace": "prod", "app": "api"}, {"namespace": "prod", "app": "api", "pod": "api-2"},
+		}},
+		values: map[string][]string{"namespace": {"staging", "prod"}},
+	}
+	SetLokiClient(fake)
+	t.Cleanup(func() {
+		activeConfig.Store(nil)
+		SetLokiClient(nil)
+	})
+	return fake
+}
+
+// TestHandleLokiSavedQueryOptions tests listing static and resolved parameter values
+func TestHandleLokiSavedQueryOptions(t *testing.T) {
+	fake := setSavedQueryOptionsTest(t, "http://unreachable.invalid")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"name": "errors"}
+	result, err := HandleLokiSavedQueryOptions(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, expected := range []string{
+		"namespace (label_value), default prod\n  2 values of label_values(namespace): prod, staging",
+		"app (label_value): App name\n  2 values of label_values({namespace=\"prod\"}, app): api, checkout",
+		"text (label_value), default error\n  Any label value",
+		"level (enum), default error\n  One of: error, warn",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in the output, but got:\n%s", expected, text)
+		}
+	}
+	if len(fake.selectors) != 1 || fake.selectors[0] != `{namespace="prod"}` {
+		t.Errorf("Expected one series call for the app selector, but got %v", fake.selectors)
+	}
+
+	request.Params.Arguments = map[string]any{"name": "errors", "parameter": "app", "format": "json"}
+	result, err = HandleLokiSavedQueryOptions(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var options []savedQueryOption
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &options); err != nil {
+		t.Fatalf("Expected JSON options, but got %v", err)
+	}
+	if len(options) != 1 || options[0].Parameter != "app" || len(options[0].Values) != 2 {
+		t.Errorf("Unexpected options: %v", options)
+	}
+
+	request.Params.Arguments = map[string]any{"name": "errors", "parameter": "missing"}
+	if _, err := HandleLokiSavedQueryOptions(context.Background(), request); err == nil || !strings.Contains(err.Error(), "unknown parameter missing") {
+		t.Errorf("Expected an unknown parameter error, but got %v", err)
+	}
+}
+
+// TestHandleLokiSavedQuery_LabelValues tests rejecting parameter values the label doesn't have
+func TestHandleLokiSavedQuery_LabelValues(t *testing.T) {
+	var query string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	t.Cleanup(loki.Close)
+	fake := setSavedQueryOptionsTest(t, loki.URL)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"name": "errors", "parameters": map[string]any{"app": "checkout"}}
+	if _, err := HandleLokiSavedQuery(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.HasPrefix(query, `{namespace="prod", app="checkout"}`) {
+		t.Errorf("Unexpected query: %s", query)
+	}
+	// The default namespace is not checked
+	if len(fake.labels) != 0 {
+		t.Errorf("Expected no label values calls, but got %v", fake.labels)
+	}
+
+	request.Params.Arguments = map[string]any{"name": "errors", "parameters": map[string]any{"app": "checkout", "namespace": "dev"}}
+	_, err := HandleLokiSavedQuery(context.Background(), request)
+	if err == nil || !strings.Contains(err.Error(), `invalid parameter namespace: "dev" is not a value of label_values(namespace)`) {
+		t.Errorf("Expected an invalid namespace error, but got %v", err)
+	}
+}
+
+// TestLabelValuesSource_Validate tests rejecting invalid label values sources
+func TestLabelValuesSource_Validate(t *testing.T) {
+	invalid := map[string]string{
+		`{"name": "app", "type": "enum", "values": ["a"], "values_from": {"label": "app"}}`:          "values_from is only allowed for label_value parameters",
+		`{"name": "app", "type": "label_value", "values_from": {"label": "a-b"}}`:                    `values_from: invalid label name: "a-b"`,
+		`{"name": "app", "type": "label_value", "values_from": {"label": "app", "selector": "app"}}`: "values_from: selector must be a stream selector",
+	}
+	for param, expected := range invalid {
+		var p SavedQueryParameter
+		if err := json.Unmarshal([]byte(param), &p); err != nil {
+			t.Fatalf("Invalid test parameter %s: %v", param, err)
+		}
+		if err := p.validate(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q, but got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/scottlepp/loki-mcp/pkg/lokiclient"
+)
+
+// LokiSeriesResult represents the structure of Loki series response
+type LokiSeriesResult = lokiclient.SeriesResult
+
+// buildLokiSeriesURL constructs the Loki series URL
+func buildLokiSeriesURL(baseURL, selector string, start, end int64) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki series API
+	setLokiAPIPath(u, "series")
+
+	// Add query parameters
+	q := u.Query()
+	q.Set("match[]", selector)
+	q.Set("start", fmt.Sprintf("%d", start))
+	q.Set("end", fmt.Sprintf("%d", end))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiSeriesQuery sends the HTTP request to Loki series endpoint
+func executeLokiSeriesQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiSeriesResult, error) {
+	body, err := executeLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiSeriesResult
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, newLokiError(0, []byte(result.Error))
+	}
+
+	return &result, nil
+}
+
+// formatStreamLabels renders a label set as a LogQL-style selector with labels sorted by name
+func formatStreamLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, quoteLogQLString(labels[name])))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sessionContext holds defaults that are merged into every query made by an MCP session
+type sessionContext struct {
+	Matchers []string // label matchers added to stream selectors, e.g. namespace="prod"
+	OrgID    string
+	Start    string
+	End      string
+}
+
+// sessionContextStore holds session contexts keyed by MCP session ID, expiring idle sessions
+type sessionContextStore struct {
+	contexts sessionStates[sessionContext]
+}
+
+var sessionContexts = &sessionContextStore{}
+
+func (s *sessionContextStore) get(key string) (sessionContext, bool) {
+	c, ok := s.contexts.get(key)
+	c.Matchers = append([]string(nil), c.Matchers...)
+	return c, ok
+}
+
+func (s *sessionContextStore) set(key string, c sessionContext) {
+	s.contexts.set(key, c)
+}
+
+func (s *sessionContextStore) delete(key string) {
+	s.contexts.delete(key)
+}
+
+// NewLokiSetContextTool creates and returns a tool for setting session-wide query defaults
+func NewLokiSetContextTool() mcp.Tool {
+	return mcp.NewTool("loki_set_context",
+		mcp.WithDescription("Set defaults for the current session that are merged into every subsequent Loki query: "+
+			"label matchers added to stream selectors, the tenant, and the time range. Explicit tool parameters always win."),
+		mcp.WithString("selector",
+			mcp.Description("Label matchers to add to every stream selector, e.g. namespace=\"prod\", app=\"api\""),
+		),
+		mcp.WithString("org",
+			mcp.Description("Default organization ID (tenant) for queries"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Default start time for queries, e.g. -6h or 2024-01-15T10:00:00Z"),
+		),
+		mcp.WithString("end",
+			mcp.Description("Default end time for queries, e.g. now"),
+		),
+		mcp.WithBoolean("clear",
+			mcp.Description("Clear the existing context before applying the new values (default: false)"),
+		),
+	)
+}
+
+// NewLokiGetContextTool creates and returns a tool for showing the session-wide query defaults
+func NewLokiGetContextTool() mcp.Tool {
+	return mcp.NewTool("loki_get_context",
+		mcp.WithDescription("Show the defaults set with loki_set_context for the current session, and the token to resume "+
+			"the session's state after reconnecting"),
+	)
+}
+
+// HandleLokiSetContext handles Loki set context tool requests
+func HandleLokiSetContext(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	key := SessionKey(ctx)
+
+	current, _ := sessionContexts.get(key)
+	if clear, ok := args["clear"].(bool); ok && clear {
+		current = sessionContext{}
+	}
+
+	if selector, ok := args["selector"].(string); ok && selector != "" {
+		matchers, err := parseContextMatchers(selector)
+		if err != nil {
+			return nil, err
+		}
+		current.Matchers = matchers
+	}
+	if orgID, ok := args["org"].(string); ok && orgID != "" {
+		current.OrgID = orgID
+	}
+	if startStr, ok := args["start"].(string); ok && startStr != "" {
+		if _, err := parseTime(startStr); err != nil {
+			return nil, fmt.Errorf("invalid start time: %v", err)
+		}
+		current.Start = startStr
+	}
+	if endStr, ok := args["end"].(string); ok && endStr != "" {
+		if _, err := parseTime(endStr); err != nil {
+			return nil, fmt.Errorf("invalid end time: %v", err)
+		}
+		current.End = endStr
+	}
+
+	if current.isEmpty() {
+		sessionContexts.delete(key)
+	} else {
+		sessionContexts.set(key, current)
+	}
+
+	return mcp.NewToolResultText(current.describe()), nil
+}
+
+// HandleLokiGetContext handles Loki get context tool requests
+func HandleLokiGetContext(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	current, _ := sessionContexts.get(SessionKey(ctx))
+	text := current.describe()
+	if token := resumeToken(ctx); token != "" {
+		text += fmt.Sprintf("\nResume token: %s (send it in the %s header or the %s parameter of /sse to keep this session's state after reconnecting)\n",
+			token, ResumeSessionHeader, ResumeSessionParam)
+	}
+	return mcp.NewToolResultText(text), nil
+}
+
+func (c sessionContext) isEmpty() bool {
+	return len(c.Matchers) == 0 && c.OrgID == "" && c.Start == "" && c.End == ""
+}
+
+// describe renders the session context for display
+func (c sessionContext) describe() string {
+	if c.isEmpty() {
+		return "No session context set"
+	}
+
+	var b strings.Builder
+	b.WriteString("Session context:\n")
+	if len(c.Matchers) > 0 {
+		fmt.Fprintf(&b, "  Selector: {%s}\n", strings.Join(c.Matchers, ", "))
+	}
+	if c.OrgID != "" {
+		fmt.Fprintf(&b, "  Org: %s\n", c.OrgID)
+	}
+	if c.Start != "" {
+		fmt.Fprintf(&b, "  Start: %s\n", c.Start)
+	}
+	if c.End != "" {
+		fmt.Fprintf(&b, "  End: %s\n", c.End)
+	}
+	return b.String()
+}
+
+// applySessionContext returns a copy of the tool arguments with the session context merged in.
+// Arguments given explicitly by the caller take precedence over the session defaults.
+func applySessionContext(ctx context.Context, args map[string]any) map[string]any {
+	merged := make(map[string]any, len(args))
+	for k, v := range args {
+		merged[k] = v
+	}
+
+	c, ok := sessionContexts.get(SessionKey(ctx))
+	if !ok {
+		return merged
+	}
+
+	setDefault := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if existing, ok := merged[name].(string); ok && existing != "" {
+			return
+		}
+		merged[name] = value
+	}
+	setDefault("org", c.OrgID)
+	setDefault("start", c.Start)
+	setDefault("end", c.End)
+
+	if query, ok := merged["query"].(string); ok && query != "" && len(c.Matchers) > 0 {
+		merged["query"] = mergeSelectorMatchers(query, c.Matchers)
+	}
+
+	return merged
+}
+
+// applySessionSelector adds the session's default label matchers to a LogQL query
+func applySessionSelector(ctx context.Context, query string) string {
+	c, ok := sessionContexts.get(SessionKey(ctx))
+	if !ok || len(c.Matchers) == 0 {
+		return query
+	}
+	return mergeSelectorMatchers(query, c.Matchers)
+}
+
+// parseContextMatchers parses a list of label matchers, with or without surrounding braces
+func parseContextMatchers(selector string) ([]string, error) {
+	selector = strings.TrimSpace(selector)
+	if strings.HasPrefix(selector, "{") && strings.HasSuffix(selector, "}") {
+		selector = selector[1 : len(selector)-1]
+	}
+
+	var matchers []string
+	for _, part := range splitOutsideQuotes(selector, ',') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		label, op, value, err := parseLabelMatcher(part)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, label+op+quoteLogQLString(value))
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("invalid selector: %s (expected label matchers such as namespace=\"prod\")", selector)
+	}
+	return matchers, nil
+}
+
+// mergeSelectorMatchers adds matchers to every stream selector in a LogQL query,
+// skipping labels that a selector already matches on
+func mergeSelectorMatchers(query string, matchers []string) string {
+	merged, _ := rewriteSelectors(query, func(inner string) (string, error) {
+		return addMissingMatchers(inner, matchers), nil
+	})
+	return merged
+}
+
+// rewriteSelectors replaces the body of every stream selector in a LogQL query with the
+// result of rewrite, leaving braces inside quoted strings untouched
+func rewriteSelectors(query string, rewrite func(inner string) (string, error)) (string, error) {
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	depth := 0
+	selectorStart := -1
+
+	for i, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == '{':
+			if depth == 0 {
+				selectorStart = i
+			}
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+			if depth == 0 && selectorStart >= 0 {
+				inner, err := rewrite(query[selectorStart+1 : i])
+				if err != nil {
+					return "", err
+				}
+				b.WriteString("{" + inner + "}")
+				selectorStart = -1
+				continue
+			}
+		}
+		if selectorStart < 0 {
+			b.WriteRune(r)
+		}
+	}
+
+	// Unterminated selector, leave the remainder untouched
+	if selectorStart >= 0 {
+		b.WriteString(query[selectorStart:])
+	}
+	return b.String(), nil
+}
+
+// addMissingMatchers appends matchers whose label is not already used in the selector body
+func addMissingMatchers(inner string, matchers []string) string {
+	present := make(map[string]bool)
+	var parts []string
+	for _, part := range splitOutsideQuotes(inner, ',') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if label, _, _, err := parseLabelMatcher(part); err == nil {
+			present[label] = true
+		}
+		parts = append(parts, part)
+	}
+
+	for _, m := range matchers {
+		if label, _, _, err := parseLabelMatcher(m); err == nil && !present[label] {
+			parts = append(parts, m)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// splitOutsideQuotes splits s on sep, ignoring separators inside quoted strings
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	var quote rune
+	escaped := false
+	last := 0
+
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == sep:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestMergeSelectorMatchers tests that context matchers are merged into every stream selector
+func TestMergeSelectorMatchers(t *testing.T) {
+	matchers := []string{`namespace="prod"`, `app="api"`}
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "Simple selector",
+			query:    `{job="varlogs"} |= "error"`,
+			expected: `{job="varlogs", namespace="prod", app="api"} |= "error"`,
+		},
+		{
+			name:     "Existing label wins",
+			query:    `{app="web"}`,
+			expected: `{app="web", namespace="prod"}`,
+		},
+		{
+			name:     "Metric query",
+			query:    `sum(count_over_time({job="x"}[5m]))`,
+			expected: `sum(count_over_time({job="x", namespace="prod", app="api"}[5m]))`,
+		},
+		{
+			name:     "Braces in strings are untouched",
+			query:    `{job="x"} | line_format "{{.msg}}"`,
+			expected: `{job="x", namespace="prod", app="api"} | line_format "{{.msg}}"`,
+		},
+		{
+			name:     "Empty selector",
+			query:    `{}`,
+			expected: `{namespace="prod", app="api"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if output := mergeSelectorMatchers(tc.query, matchers); output != tc.expected {
+				t.Errorf("Expected '%s', but got '%s'", tc.expected, output)
+			}
+		})
+	}
+}
+
+// TestParseContextMatchers tests parsing of selector fragments with and without braces
+func TestParseContextMatchers(t *testing.T) {
+	matchers, err := parseContextMatchers(`{namespace="prod", pod=~"api-.*"}`)
+	if err != nil {
+		t.Fatalf("parseContextMatchers failed: %v", err)
+	}
+	if len(matchers) != 2 || matchers[0] != `namespace="prod"` || matchers[1] != `pod=~"api-.*"` {
+		t.Errorf("Unexpected matchers: %v", matchers)
+	}
+
+	matchers, err = parseContextMatchers(`service=checkout`)
+	if err != nil {
+		t.Fatalf("parseContextMatchers failed: %v", err)
+	}
+	if len(matchers) != 1 || matchers[0] != `service="checkout"` {
+		t.Errorf("Unexpected matchers: %v", matchers)
+	}
+
+	if _, err := parseContextMatchers(`not a matcher`); err == nil {
+		t.Error("Expected error for invalid matcher")
+	}
+}
+
+// TestApplySessionContext tests that session defaults fill in only missing arguments
+func TestApplySessionContext(t *testing.T) {
+	ctx := context.Background()
+	key := SessionKey(ctx)
+	sessionContexts.set(key, sessionContext{
+		Matchers: []string{`namespace="prod"`},
+		OrgID:    "tenant-1",
+		Start:    "-6h",
+	})
+	defer sessionContexts.delete(key)
+
+	args := map[string]any{
+		"query": `{app="api"}`,
+		"start": "-1h",
+	}
+	merged := applySessionContext(ctx, args)
+
+	if merged["query"] != `{app="api", namespace="prod"}` {
+		t.Errorf("Unexpected query: %v", merged["query"])
+	}
+	if merged["org"] != "tenant-1" {
+		t.Errorf("Expected org from session context, got %v", merged["org"])
+	}
+	if merged["start"] != "-1h" {
+		t.Errorf("Expected explicit start to win, got %v", merged["start"])
+	}
+	if args["query"] != `{app="api"}` {
+		t.Errorf("Original arguments were modified: %v", args["query"])
+	}
+}
+
+// TestSessionContexts_Expire tests that the defaults of idle sessions are dropped
+func TestSessionContexts_Expire(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	sessionStateNow = func() time.Time { return now }
+	t.Cleanup(func() { sessionStateNow = time.Now })
+
+	sessionContexts.set("idle", sessionContext{OrgID: "tenant-1"})
+	defer sessionContexts.delete("idle")
+	if c, ok := sessionContexts.get("idle"); !ok || c.OrgID != "tenant-1" {
+		t.Fatalf("Expected the context to be kept, but got %+v", c)
+	}
+	now = now.Add(sessionStateTTL + time.Minute)
+	if c, ok := sessionContexts.get("idle"); ok {
+		t.Errorf("Expected the idle context to expire, but got %+v", c)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ResumeSessionParam is the query parameter of the SSE endpoint carrying the resume token of the
+// session to resume after a reconnect
+const ResumeSessionParam = "resume_session"
+
+// ResumeSessionHeader is the request header carrying the resume token of the session to resume
+// after a reconnect
+const ResumeSessionHeader = "Mcp-Resume-Session"
+
+// resumedSessionKey is the context key for the session a reconnecting client resumes
+type resumedSessionKey struct{}
+
+// resumeBindingKey is the context key for the fingerprint of the credentials an HTTP transport
+// request presented, which resume tokens are bound to
+type resumeBindingKey struct{}
+
+// validSessionID matches the session IDs generated by the MCP transports
+var validSessionID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// resumeSecret signs resume tokens. It is generated at startup, since the state they resume is
+// only kept in memory.
+var resumeSecret = func() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}()
+
+// ResumeSessionContextFunc lets reconnecting clients keep their session context, drilldown
+// query and other per-session state. Clients pass the resume token loki_get_context reported in
+// the Mcp-Resume-Session header or the resume_session query parameter of the SSE endpoint, which
+// is carried over to the message endpoint. Tokens are signed by the server and only resume the
+// session for a client presenting the same credentials as the one the token was issued to.
+func ResumeSessionContextFunc(ctx context.Context, r *http.Request) context.Context {
+	binding := credentialsFingerprint(r)
+	ctx = context.WithValue(ctx, resumeBindingKey{}, binding)
+
+	token := r.Header.Get(ResumeSessionHeader)
+	if token == "" {
+		token = r.URL.Query().Get(ResumeSessionParam)
+	}
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || !validSessionID.MatchString(id) || id == defaultSessionKey {
+		return ctx
+	}
+	if !hmac.Equal([]byte(signature), []byte(resumeSignature(id, binding))) {
+		return ctx
+	}
+	return context.WithValue(ctx, resumedSessionKey{}, id)
+}
+
+// resumeToken returns the token resuming the session of a tool call, or an empty string for calls
+// that are not made over an HTTP transport session
+func resumeToken(ctx context.Context) string {
+	binding, ok := ctx.Value(resumeBindingKey{}).(string)
+	id := SessionKey(ctx)
+	if !ok || id == defaultSessionKey || !validSessionID.MatchString(id) {
+		return ""
+	}
+	return id + "." + resumeSignature(id, binding)
+}
+
+// resumeSignature signs a session ID for the credentials fingerprint of a client
+func resumeSignature(id, binding string) string {
+	mac := hmac.New(sha256.New, resumeSecret)
+	mac.Write([]byte(id))
+	mac.Write([]byte{0})
+	mac.Write([]byte(binding))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// credentialsFingerprint hashes the transport and access policy credentials of a request
+func credentialsFingerprint(r *http.Request) string {
+	sum := sha256.Sum256([]byte(r.Header.Get("Authorization") + "\n" + r.Header.Get(APIKeyHeader)))
+	return hex.EncodeToString(sum[:])
+}
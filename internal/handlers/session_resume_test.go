@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestResumeSessionContextFunc tests that reconnecting clients resume their previous session with
+// a token bound to their credentials
+func TestResumeSessionContextFunc(t *testing.T) {
+	// The token is issued to a client with its credentials
+	issued := httptest.NewRequest("POST", "/mcp", nil)
+	issued.Header.Set(APIKeyHeader, "alice-key")
+	binding := ResumeSessionContextFunc(context.Background(), issued).Value(resumeBindingKey{}).(string)
+	token := "old-session." + resumeSignature("old-session", binding)
+
+	testCases := []struct {
+		name     string
+		url      string
+		header   string
+		apiKey   string
+		expected string
+	}{
+		{"No resume", "/mcp?sessionId=new", "", "alice-key", "default"},
+		{"Query parameter", "/mcp?sessionId=new&resume_session=" + url.QueryEscape(token), "", "alice-key", "old-session"},
+		{"Header", "/mcp", token, "alice-key", "old-session"},
+		{"Other credentials", "/mcp", token, "mallory-key", "default"},
+		{"Unsigned session ID", "/mcp?resume_session=old-session", "", "alice-key", "default"},
+		{"Forged signature", "/mcp", "old-session." + strings.Repeat("0", 64), "alice-key", "default"},
+		{"Default session", "/mcp", "default." + resumeSignature("default", binding), "alice-key", "default"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tc.url, nil)
+			req.Header.Set(APIKeyHeader, tc.apiKey)
+			if tc.header != "" {
+				req.Header.Set(ResumeSessionHeader, tc.header)
+			}
+			ctx := ResumeSessionContextFunc(context.Background(), req)
+			if key := SessionKey(ctx); key != tc.expected {
+				t.Errorf("Expected session key %q, but got %q", tc.expected, key)
+			}
+		})
+	}
+}
+
+// TestHandleLokiGetContext_ResumeToken tests that the resume token is reported to HTTP clients and
+// resumes their session
+func TestHandleLokiGetContext_ResumeToken(t *testing.T) {
+	req := httptest.NewRequest("POST", "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	// A client that resumed a session gets a token for the same session
+	ctx := context.WithValue(ResumeSessionContextFunc(context.Background(), req), resumedSessionKey{}, "session-1")
+	result, err := HandleLokiGetContext(ctx, mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	_, after, ok := strings.Cut(text, "Resume token: ")
+	if !ok {
+		t.Fatalf("Expected a resume token, but got %s", text)
+	}
+	token, _, _ := strings.Cut(after, " ")
+
+	reconnect := httptest.NewRequest("GET", "/sse?resume_session="+url.QueryEscape(token), nil)
+	reconnect.Header.Set("Authorization", "Bearer secret")
+	if key := SessionKey(ResumeSessionContextFunc(context.Background(), reconnect)); key != "session-1" {
+		t.Errorf("Expected the token to resume session-1, but got %s", key)
+	}
+
+	// Calls without a session, such as stdio calls, get no token
+	result, err = HandleLokiGetContext(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; strings.Contains(text, "Resume token") {
+		t.Errorf("Expected no resume token without a session, but got %s", text)
+	}
+}
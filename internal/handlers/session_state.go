@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits of the per-session state kept by tools such as loki_drilldown. Clients disconnect without
+// notice and may resume their session later, so state is expired after it was last used rather
+// than removed when a transport session ends.
+const (
+	// sessionStateTTL is how long a session's state is kept after it was last used
+	sessionStateTTL = 24 * time.Hour
+	// maxSessionStates is the number of sessions a store keeps state for; the least recently used
+	// is dropped to make room for a new one
+	maxSessionStates = 10000
+)
+
+// sessionStateNow returns the current time, replaced in tests
+var sessionStateNow = time.Now
+
+// sessionStates holds a value per session key, expiring values that were not used for
+// sessionStateTTL and keeping at most maxSessionStates
+type sessionStates[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*sessionState[T]
+}
+
+// sessionState is a stored value and when it was last used
+type sessionState[T any] struct {
+	value T
+	used  time.Time
+}
+
+// get returns the value of a session and marks it used
+func (s *sessionStates[T]) get(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entry(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set stores the value of a session, dropping expired and least recently used sessions to stay
+// within maxSessionStates
+func (s *sessionStates[T]) set(key string, value T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]*sessionState[T])
+	}
+	if _, ok := s.entries[key]; !ok {
+		s.prune()
+	}
+	s.entries[key] = &sessionState[T]{value: value, used: sessionStateNow()}
+}
+
+// update calls fn with the value of a session under the store's lock, reporting whether the
+// session has a value
+func (s *sessionStates[T]) update(key string, fn func(T)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entry(key)
+	if ok {
+		fn(entry.value)
+	}
+	return ok
+}
+
+// delete removes the value of a session
+func (s *sessionStates[T]) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// entry returns the unexpired entry of a session and marks it used. The store must be locked.
+func (s *sessionStates[T]) entry(key string) (*sessionState[T], bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	now := sessionStateNow()
+	if now.Sub(entry.used) > sessionStateTTL {
+		delete(s.entries, key)
+		return nil, false
+	}
+	entry.used = now
+	return entry, true
+}
+
+// prune drops expired entries, and the least recently used one when the store is full. The store
+// must be locked.
+func (s *sessionStates[T]) prune() {
+	now := sessionStateNow()
+	oldestKey, oldest := "", now
+	for key, entry := range s.entries {
+		if now.Sub(entry.used) > sessionStateTTL {
+			delete(s.entries, key)
+			continue
+		}
+		if !entry.used.After(oldest) {
+			oldestKey, oldest = key, entry.used
+		}
+	}
+	if len(s.entries) >= maxSessionStates {
+		delete(s.entries, oldestKey)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSessionStates tests expiring idle sessions and bounding the number of sessions kept
+func TestSessionStates(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	sessionStateNow = func() time.Time { return now }
+	t.Cleanup(func() { sessionStateNow = time.Now })
+
+	var states sessionStates[int]
+	states.set("a", 1)
+	states.set("b", 2)
+
+	// Using a session keeps it alive past the TTL of its creation
+	now = now.Add(sessionStateTTL - time.Minute)
+	if v, ok := states.get("a"); !ok || v != 1 {
+		t.Fatalf("Expected a=1, but got %d, %v", v, ok)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := states.get("b"); ok {
+		t.Error("Expected b to expire")
+	}
+	if !states.update("a", func(int) {}) {
+		t.Error("Expected a to be kept")
+	}
+
+	// A full store drops the least recently used session
+	for i := range maxSessionStates - 1 {
+		now = now.Add(time.Millisecond)
+		states.set(strconv.Itoa(i), i)
+	}
+	if len(states.entries) != maxSessionStates {
+		t.Fatalf("Expected %d sessions, but got %d", maxSessionStates, len(states.entries))
+	}
+	states.set("new", 0)
+	if _, ok := states.get("a"); ok || len(states.entries) != maxSessionStates {
+		t.Errorf("Expected the oldest session to be dropped, but got %d sessions", len(states.entries))
+	}
+	if _, ok := states.get("new"); !ok {
+		t.Error("Expected the new session to be kept")
+	}
+}
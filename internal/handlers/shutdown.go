@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Environment variable name for how long shutdown waits for in-flight tool calls, e.g. 25s
+const EnvShutdownGracePeriod = "MCP_SHUTDOWN_GRACE_PERIOD"
+
+// DefaultShutdownGracePeriod stays below the default Kubernetes termination grace period of 30s
+const DefaultShutdownGracePeriod = 25 * time.Second
+
+// errShuttingDown is returned for tool calls received after shutdown started
+var errShuttingDown = errors.New("server is shutting down, retry the request against another instance")
+
+// callTracker tracks in-flight tool calls so they can be drained on shutdown
+type callTracker struct {
+	mu       sync.Mutex
+	draining bool
+	nextID   int
+	cancels  map[int]context.CancelFunc
+	idle     chan struct{}
+}
+
+// inFlightCalls tracks the tool calls handled by this process
+var inFlightCalls = &callTracker{}
+
+// start registers a tool call and returns its cancellable context, or false while draining
+func (t *callTracker) start(ctx context.Context) (context.Context, int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return ctx, 0, false
+	}
+	if t.cancels == nil {
+		t.cancels = map[int]context.CancelFunc{}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t.nextID++
+	t.cancels[t.nextID] = cancel
+	return ctx, t.nextID, true
+}
+
+// finish unregisters a tool call and signals when the last call of a drain completes
+func (t *callTracker) finish(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cancel, ok := t.cancels[id]; ok {
+		cancel()
+		delete(t.cancels, id)
+	}
+	if t.draining && len(t.cancels) == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// drain stops accepting tool calls and waits for in-flight ones, cancelling them when ctx expires
+func (t *callTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	if len(t.cancels) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		for _, cancel := range t.cancels {
+			cancel()
+		}
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// InFlightMiddleware tracks tool calls and rejects new ones once shutdown has started
+func InFlightMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, id, ok := inFlightCalls.start(ctx)
+		if !ok {
+			return nil, errShuttingDown
+		}
+		defer inFlightCalls.finish(id)
+		return next(ctx, request)
+	}
+}
+
+// DrainInFlight stops accepting tool calls and waits for in-flight ones to finish.
+// Calls still running when ctx expires are cancelled and ctx.Err() is returned.
+func DrainInFlight(ctx context.Context) error {
+	return inFlightCalls.drain(ctx)
+}
+
+// Ready reports whether the server accepts tool calls, which stops once shutdown has started
+func Ready() bool {
+	inFlightCalls.mu.Lock()
+	defer inFlightCalls.mu.Unlock()
+	return !inFlightCalls.draining
+}
+
+// ShutdownGracePeriod returns the configured shutdown grace period
+func ShutdownGracePeriod() time.Duration {
+	return CurrentConfig().ShutdownGracePeriod
+}
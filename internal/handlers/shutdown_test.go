@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestCallTracker_DrainWaitsForInFlightCalls tests that draining waits for running calls and rejects new ones
+func TestCallTracker_DrainWaitsForInFlightCalls(t *testing.T) {
+	tracker := &callTracker{}
+	_, id, ok := tracker.start(context.Background())
+	if !ok {
+		t.Fatal("Expected the call to start")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- tracker.drain(context.Background()) }()
+
+	time.Sleep(10 * time.Millisecond)
+	if _, _, ok := tracker.start(context.Background()); ok {
+		t.Error("Expected new calls to be rejected while draining")
+	}
+
+	tracker.finish(id)
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Errorf("Expected drain to succeed, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected drain to return after the call finished")
+	}
+}
+
+// TestCallTracker_DrainCancelsAfterGracePeriod tests that calls still running after the grace period are cancelled
+func TestCallTracker_DrainCancelsAfterGracePeriod(t *testing.T) {
+	tracker := &callTracker{}
+	callCtx, id, _ := tracker.start(context.Background())
+	defer tracker.finish(id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, but got %v", err)
+	}
+	if callCtx.Err() == nil {
+		t.Error("Expected the in-flight call to be cancelled")
+	}
+}
+
+// TestInFlightMiddleware_RejectsDuringShutdown tests that the middleware rejects calls after draining starts
+func TestInFlightMiddleware_RejectsDuringShutdown(t *testing.T) {
+	original := inFlightCalls
+	inFlightCalls = &callTracker{}
+	defer func() { inFlightCalls = original }()
+
+	handler := InFlightMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	if _, err := handler(context.Background(), mcp.CallToolRequest{}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !Ready() {
+		t.Error("Expected the server to be ready before shutdown")
+	}
+
+	if err := DrainInFlight(context.Background()); err != nil {
+		t.Fatalf("Expected drain to succeed, but got %v", err)
+	}
+	if _, err := handler(context.Background(), mcp.CallToolRequest{}); !errors.Is(err, errShuttingDown) {
+		t.Errorf("Expected shutdown error, but got %v", err)
+	}
+	if Ready() {
+		t.Error("Expected the server not to be ready during shutdown")
+	}
+}
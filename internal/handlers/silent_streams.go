@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// silentStreamsReport lists the streams or groups that logged in the baseline window but not recently
+type silentStreamsReport struct {
+	Selector      string   `json:"selector"`
+	GroupBy       string   `json:"group_by,omitempty"`
+	BaselineStart string   `json:"baseline_start"`
+	RecentStart   string   `json:"recent_start"`
+	BaselineCount int      `json:"baseline_count"`
+	RecentCount   int      `json:"recent_count"`
+	Silent        []string `json:"silent"`
+}
+
+// NewLokiSilentStreamsTool creates and returns a tool for detecting streams that stopped logging
+func NewLokiSilentStreamsTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Find streams or services that stopped logging: compares the streams present in a baseline " +
+			"window with those present in the recent window and lists the ones that went silent. " +
+			"A common early indicator of crashed workloads."),
+		mcp.WithString("selector",
+			mcp.Required(),
+			mcp.Description("Stream selector to check, e.g. {namespace=\"prod\"}"),
+		),
+		mcp.WithString("recent",
+			mcp.Description("Length of the recent window ending now (default: 15m)"),
+		),
+		mcp.WithString("baseline",
+			mcp.Description("Length of the baseline window immediately before the recent window (default: 1h)"),
+		),
+		mcp.WithString("group_by",
+			mcp.Description("Label to group streams by, e.g. app or service_name; a group is silent when none of its streams logged recently"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_silent_streams", opts...)
+}
+
+// HandleLokiSilentStreams handles Loki silent streams tool requests
+func HandleLokiSilentStreams(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	selector, _ := args["selector"].(string)
+	if selector == "" {
+		return nil, fmt.Errorf("selector is required")
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	recent, err := durationArg(args, "recent", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := durationArg(args, "baseline", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	groupBy, _ := args["group_by"].(string)
+
+	format := formatArg(args)
+
+	now := time.Now()
+	recentStart := now.Add(-recent)
+	baselineStart := recentStart.Add(-baseline)
+
+	conn := ResolveLokiConnection(args)
+	fetch := func(start, end time.Time) ([]map[string]string, error) {
+		result, err := CurrentLokiClient().Series(ctx, conn, selector, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("series query execution failed: %w", err)
+		}
+		return result.Data, nil
+	}
+
+	baselineSeries, err := fetch(baselineStart, recentStart)
+	if err != nil {
+		return nil, err
+	}
+	recentSeries, err := fetch(recentStart, now)
+	if err != nil {
+		return nil, err
+	}
+
+	report := findSilentStreams(baselineSeries, recentSeries, groupBy)
+	report.Selector = selector
+	report.BaselineStart = baselineStart.Format(time.RFC3339)
+	report.RecentStart = recentStart.Format(time.RFC3339)
+
+	formattedResult, err := formatSilentStreams(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// durationArg parses a positive Go duration argument, returning def when it is absent
+func durationArg(args map[string]any, name string, def time.Duration) (time.Duration, error) {
+	value, ok := args[name].(string)
+	if !ok || value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s duration: %s", name, value)
+	}
+	return d, nil
+}
+
+// findSilentStreams returns the streams, or values of the group_by label, present in
+// the baseline series but absent from the recent series
+func findSilentStreams(baseline, recent []map[string]string, groupBy string) silentStreamsReport {
+	key := func(labels map[string]string) (string, bool) {
+		if groupBy == "" {
+			return formatStreamLabels(labels), true
+		}
+		value, ok := labels[groupBy]
+		return value, ok
+	}
+
+	collect := func(series []map[string]string) map[string]bool {
+		keys := make(map[string]bool)
+		for _, labels := range series {
+			if k, ok := key(labels); ok {
+				keys[k] = true
+			}
+		}
+		return keys
+	}
+
+	baselineKeys := collect(baseline)
+	recentKeys := collect(recent)
+
+	report := silentStreamsReport{
+		GroupBy:       groupBy,
+		BaselineCount: len(baselineKeys),
+		RecentCount:   len(recentKeys),
+		Silent:        []string{},
+	}
+	for k := range baselineKeys {
+		if !recentKeys[k] {
+			report.Silent = append(report.Silent, k)
+		}
+	}
+	sort.Strings(report.Silent)
+	return report
+}
+
+// formatSilentStreams formats the silent streams report into a readable string
+func formatSilentStreams(report silentStreamsReport, format string) (string, error) {
+	what := "streams"
+	if report.GroupBy != "" {
+		what = fmt.Sprintf("%s values", report.GroupBy)
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// Return the silent streams or group values only, one per line
+		if len(report.Silent) == 0 {
+			return fmt.Sprintf("No silent %s found", what), nil
+		}
+		var output string
+		for _, s := range report.Silent {
+			output += s + "\n"
+		}
+		return output, nil
+
+	case "text":
+		output := fmt.Sprintf("Baseline window (from %s): %d %s\nRecent window (from %s): %d %s\n\n",
+			report.BaselineStart, report.BaselineCount, what, report.RecentStart, report.RecentCount, what)
+		if len(report.Silent) == 0 {
+			return output + fmt.Sprintf("No silent %s found", what), nil
+		}
+		output += fmt.Sprintf("%d %s stopped logging:\n", len(report.Silent), what)
+		for i, s := range report.Silent {
+			output += fmt.Sprintf("%d. %s\n", i+1, s)
+		}
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestFindSilentStreams tests detection of streams missing from the recent window
+func TestFindSilentStreams(t *testing.T) {
+	baseline := []map[string]string{
+		{"app": "api", "pod": "api-1"},
+		{"app": "api", "pod": "api-2"},
+		{"app": "worker", "pod": "worker-1"},
+	}
+	recent := []map[string]string{
+		{"app": "api", "pod": "api-1"},
+		{"app": "web", "pod": "web-1"},
+	}
+
+	report := findSilentStreams(baseline, recent, "")
+	expected := []string{`{app="api", pod="api-2"}`, `{app="worker", pod="worker-1"}`}
+	if strings.Join(report.Silent, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected silent streams %v, but got %v", expected, report.Silent)
+	}
+	if report.BaselineCount != 3 || report.RecentCount != 2 {
+		t.Errorf("Unexpected counts: baseline=%d recent=%d", report.BaselineCount, report.RecentCount)
+	}
+
+	// Grouped by app, api still has a live stream so only worker is silent
+	report = findSilentStreams(baseline, recent, "app")
+	if len(report.Silent) != 1 || report.Silent[0] != "worker" {
+		t.Errorf("Expected only worker to be silent, but got %v", report.Silent)
+	}
+}
+
+// TestFormatSilentStreams tests the text output when nothing went silent
+func TestFormatSilentStreams(t *testing.T) {
+	report := findSilentStreams([]map[string]string{{"app": "api"}}, []map[string]string{{"app": "api"}}, "app")
+
+	output, err := formatSilentStreams(report, "text")
+	if err != nil {
+		t.Fatalf("formatSilentStreams failed: %v", err)
+	}
+	if !strings.Contains(output, "No silent app values found") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
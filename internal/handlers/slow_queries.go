@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// EnvSlowQueryThreshold is the environment variable name for the duration above which requests to
+// Loki are kept in the slow query log. The log and the loki_mcp_slow_queries tool are only
+// enabled when it is set.
+const EnvSlowQueryThreshold = "LOKI_MCP_SLOW_QUERY_THRESHOLD"
+
+// Number of slow queries kept in the log, dropping the oldest
+const slowQueryLogSize = 200
+
+// slowQuery is a request to Loki that took longer than the slow query threshold
+type slowQuery struct {
+	Time          time.Time         `json:"time"`
+	DurationMS    int64             `json:"duration_ms"`
+	Tool          string            `json:"tool,omitempty"`
+	RequestID     string            `json:"request_id,omitempty"`
+	Endpoint      string            `json:"endpoint"`
+	URL           string            `json:"url"`
+	Org           string            `json:"org,omitempty"`
+	Query         string            `json:"query,omitempty"`
+	Start         *time.Time        `json:"start,omitempty"`
+	End           *time.Time        `json:"end,omitempty"`
+	Status        int               `json:"status"`
+	ResponseBytes int               `json:"response_bytes"`
+	Stats         *lokiStatsSummary `json:"stats,omitempty"`
+}
+
+// lokiStatsSummary is the summary of the statistics Loki returns with query results
+type lokiStatsSummary struct {
+	ExecTime             float64 `json:"execTime"`
+	QueueTime            float64 `json:"queueTime"`
+	TotalBytesProcessed  int64   `json:"totalBytesProcessed"`
+	TotalLinesProcessed  int64   `json:"totalLinesProcessed"`
+	TotalEntriesReturned int64   `json:"totalEntriesReturned"`
+}
+
+// parseStatsSummary returns the statistics summary of a query response, or nil when it has none
+func parseStatsSummary(body []byte) *lokiStatsSummary {
+	var response struct {
+		Data struct {
+			Stats struct {
+				Summary *lokiStatsSummary `json:"summary"`
+			} `json:"stats"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
+	}
+	return response.Data.Stats.Summary
+}
+
+// slowQueries is the slow query log, oldest first
+var slowQueries = struct {
+	sync.Mutex
+	queries []slowQuery
+}{}
+
+// connectionStats counts the connections of the requests sent to Loki by this process
+var connectionStats struct {
+	requests atomic.Int64
+	inFlight atomic.Int64
+	opened   atomic.Int64
+	reused   atomic.Int64
+	idle     atomic.Int64 // reused connections that were idle in the pool
+	failed   atomic.Int64 // requests that got no response
+}
+
+// connectionPoolStats is a snapshot of connectionStats
+type connectionPoolStats struct {
+	Requests int64 `json:"requests"`
+	InFlight int64 `json:"in_flight"`
+	Opened   int64 `json:"connections_opened"`
+	Reused   int64 `json:"connections_reused"`
+	Idle     int64 `json:"reused_from_idle"`
+	Failed   int64 `json:"failed"`
+}
+
+// slowQueryReport is the result of the loki_mcp_slow_queries tool
+type slowQueryReport struct {
+	Threshold string              `json:"threshold"`
+	Pool      connectionPoolStats `json:"connection_pool"`
+	Recorded  int                 `json:"recorded"`
+	Queries   []slowQuery         `json:"queries"`
+}
+
+// SlowQueryLogEnabled reports whether a slow query threshold is configured, so the slow query
+// log is kept and the loki_mcp_slow_queries tool should be registered
+func SlowQueryLogEnabled() bool {
+	return CurrentConfig().SlowQueryThreshold > 0
+}
+
+// trackConnections returns a context counting whether a request to Loki opened a new connection
+// or reused one from the pool
+func trackConnections(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				connectionStats.opened.Add(1)
+				return
+			}
+			connectionStats.reused.Add(1)
+			if info.WasIdle {
+				connectionStats.idle.Add(1)
+			}
+		},
+	})
+}
+
+// recordSlowQuery adds a request to the slow query log when it took longer than the threshold,
+// with the statistics summary of query responses
+func recordSlowQuery(req *http.Request, status int, body []byte, sent time.Time, duration time.Duration) {
+	threshold := CurrentConfig().SlowQueryThreshold
+	if threshold <= 0 || duration < threshold {
+		return
+	}
+
+	ctx := req.Context()
+	u := *req.URL
+	params := u.Query()
+	if req.Method == http.MethodPost && req.GetBody != nil {
+		// Long queries are sent form-encoded in the body
+		if rc, err := req.GetBody(); err == nil {
+			form, _ := io.ReadAll(rc)
+			rc.Close()
+			if values, err := url.ParseQuery(string(form)); err == nil {
+				params = values
+			}
+		}
+	}
+	u.RawQuery, u.Path = "", ""
+
+	q := slowQuery{
+		Time:          sent.UTC(),
+		DurationMS:    duration.Milliseconds(),
+		Tool:          toolNameFromContext(ctx),
+		RequestID:     requestIDFromContext(ctx),
+		Endpoint:      req.URL.Path,
+		URL:           u.Redacted(),
+		Org:           req.Header.Get("X-Scope-OrgID"),
+		Query:         params.Get("query"),
+		Status:        status,
+		ResponseBytes: len(body),
+	}
+	for name, field := range map[string]**time.Time{"start": &q.Start, "end": &q.End} {
+		if t, _, ok := parseLokiTimestamp(params.Get(name)); ok {
+			t = t.UTC()
+			*field = &t
+		}
+	}
+	if status == http.StatusOK {
+		q.Stats = parseStatsSummary(body)
+	}
+
+	slowQueries.Lock()
+	slowQueries.queries = append(slowQueries.queries, q)
+	if n := len(slowQueries.queries); n > slowQueryLogSize {
+		// Copy the kept entries so the dropped ones can be garbage collected
+		slowQueries.queries = slices.Clone(slowQueries.queries[n-slowQueryLogSize:])
+	}
+	slowQueries.Unlock()
+
+	slog.Warn("slow Loki query", "endpoint", q.Endpoint, "duration_ms", q.DurationMS, "tool", q.Tool, "request_id", q.RequestID)
+}
+
+// NewLokiMCPSlowQueriesTool creates and returns a tool for reading the slow query log
+func NewLokiMCPSlowQueriesTool() mcp.Tool {
+	return mcp.NewTool("loki_mcp_slow_queries",
+		mcp.WithDescription(fmt.Sprintf("List the requests this server sent to Loki that took longer than %s, with the tool and "+
+			"request ID that sent them, the query, time range and the statistics Loki returned, and the connection pool "+
+			"statistics of the requests sent to Loki. Shows what AI-driven load looks like to operators.",
+			CurrentConfig().SlowQueryThreshold)),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of slow queries to return, out of the last %d kept (default: 20)", slowQueryLogSize)),
+		),
+		mcp.WithString("sort",
+			mcp.Description("Order of the slow queries: recent for the newest first, or duration for the slowest first (default: recent)"),
+			mcp.Enum("recent", "duration"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiMCPSlowQueries handles slow query log tool requests
+func HandleLokiMCPSlowQueries(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	format := formatArg(args)
+	limit := 20
+	if n, ok := args["limit"].(float64); ok && n > 0 {
+		limit = int(n)
+	}
+	order, _ := args["sort"].(string)
+	if order != "" && order != "recent" && order != "duration" {
+		return nil, fmt.Errorf("unsupported sort: %s. Supported orders: recent, duration", order)
+	}
+
+	slowQueries.Lock()
+	queries := make([]slowQuery, len(slowQueries.queries))
+	for i, q := range slowQueries.queries {
+		queries[len(queries)-1-i] = q
+	}
+	slowQueries.Unlock()
+	if order == "duration" {
+		sort.SliceStable(queries, func(i, j int) bool { return queries[i].DurationMS > queries[j].DurationMS })
+	}
+
+	report := slowQueryReport{
+		Threshold: CurrentConfig().SlowQueryThreshold.String(),
+		Pool:      currentConnectionPoolStats(),
+		Recorded:  len(queries),
+		Queries:   queries[:min(limit, len(queries))],
+	}
+	formattedResult, err := formatSlowQueryReport(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// currentConnectionPoolStats returns a snapshot of the connection statistics
+func currentConnectionPoolStats() connectionPoolStats {
+	return connectionPoolStats{
+		Requests: connectionStats.requests.Load(),
+		InFlight: connectionStats.inFlight.Load(),
+		Opened:   connectionStats.opened.Load(),
+		Reused:   connectionStats.reused.Load(),
+		Idle:     connectionStats.idle.Load(),
+		Failed:   connectionStats.failed.Load(),
+	}
+}
+
+// String summarizes the connection statistics on one line
+func (s connectionPoolStats) String() string {
+	reuse := ""
+	if total := s.Opened + s.Reused; total > 0 {
+		reuse = fmt.Sprintf(" (%.0f%% reused)", float64(s.Reused)*100/float64(total))
+	}
+	return fmt.Sprintf("%d requests to Loki, %d in flight, %d failed; %d connections opened, %d reused%s, %d of them idle in the pool",
+		s.Requests, s.InFlight, s.Failed, s.Opened, s.Reused, reuse, s.Idle)
+}
+
+// formatSlowQueryReport formats the slow query log into a readable string
+func formatSlowQueryReport(report slowQueryReport, format string) (string, error) {
+	switch format {
+	case "json":
+		if report.Queries == nil {
+			report.Queries = []slowQuery{}
+		}
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		fmt.Fprintf(&b, "pool %s\n", report.Pool)
+		for _, q := range report.Queries {
+			fmt.Fprintf(&b, "%s %dms %s %s %s\n", q.Time.Format(time.RFC3339), q.DurationMS, q.Endpoint, q.Tool, q.Query)
+		}
+		return b.String(), nil
+
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Connection pool: %s\n", report.Pool)
+		if len(report.Queries) == 0 {
+			fmt.Fprintf(&b, "No Loki requests took longer than %s", report.Threshold)
+			return b.String(), nil
+		}
+		fmt.Fprintf(&b, "Showing %d of %d Loki requests that took longer than %s:\n", len(report.Queries), report.Recorded, report.Threshold)
+		for _, q := range report.Queries {
+			fmt.Fprintf(&b, "\n%s %s %s, status %d, %d bytes\n", q.Time.Format(time.RFC3339), time.Duration(q.DurationMS)*time.Millisecond, q.Endpoint, q.Status, q.ResponseBytes)
+			var source []string
+			for _, part := range []struct{ name, value string }{{"tool", q.Tool}, {"request_id", q.RequestID}, {"org", q.Org}} {
+				if part.value != "" {
+					source = append(source, part.name+" "+part.value)
+				}
+			}
+			fmt.Fprintf(&b, "  %s", q.URL)
+			if len(source) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(source, ", "))
+			}
+			b.WriteString("\n")
+			if q.Query != "" {
+				fmt.Fprintf(&b, "  query: %s\n", q.Query)
+			}
+			if q.Start != nil && q.End != nil {
+				fmt.Fprintf(&b, "  range: %s to %s (%s)\n", q.Start.Format(time.RFC3339), q.End.Format(time.RFC3339), humanizeDuration(q.End.Sub(*q.Start)))
+			}
+			if s := q.Stats; s != nil {
+				fmt.Fprintf(&b, "  stats: exec %.3fs, queue %.3fs, %d bytes and %d lines processed, %d entries returned\n",
+					s.ExecTime, s.QueueTime, s.TotalBytesProcessed, s.TotalLinesProcessed, s.TotalEntriesReturned)
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestSlowQueryLog tests recording slow requests to Loki with their statistics and listing them
+func TestSlowQueryLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loki/api/v1/labels" {
+			w.Write([]byte(`{"status": "success", "data": []}`))
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"status": "success", "data": {"resultType": "streams", "result": [], "stats": {"summary": ` +
+			`{"execTime": 0.02, "queueTime": 0.001, "totalBytesProcessed": 1048576, "totalLinesProcessed": 5000, "totalEntriesReturned": 0}}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Cleanup(func() {
+		activeConfig.Store(nil)
+		slowQueries.Lock()
+		slowQueries.queries = nil
+		slowQueries.Unlock()
+	})
+	cfg := LoadConfig()
+	cfg.SlowQueryThreshold = 10 * time.Millisecond
+	SetConfig(cfg)
+	if !SlowQueryLogEnabled() {
+		t.Fatal("Expected the slow query log to be enabled")
+	}
+
+	ctx := context.WithValue(withRequestID(context.Background(), "req-1"), toolNameKey{}, "loki_query")
+	queryURL := server.URL + "/loki/api/v1/query_range?" + url.Values{
+		"query": {`{app="api"} |= "error"`}, "start": {"1700000000"}, "end": {"1700003600"},
+	}.Encode()
+	if _, err := executeLokiRequest(ctx, queryURL, "", "", "", "tenant-a"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := executeLokiRequest(ctx, server.URL+"/loki/api/v1/labels", "", "", "", ""); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"format": "text"}
+	result, err := HandleLokiMCPSlowQueries(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{
+		"Connection pool: ",
+		"Showing 1 of 1 Loki requests that took longer than 10ms:",
+		"/loki/api/v1/query_range, status 200",
+		"(tool loki_query, request_id req-1, org tenant-a)",
+		`query: {app="api"} |= "error"`,
+		"range: 2023-11-14T22:13:20Z to 2023-11-14T23:13:20Z (1h)",
+		"stats: exec 0.020s, queue 0.001s, 1048576 bytes and 5000 lines processed, 0 entries returned",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in:\n%s", want, text)
+		}
+	}
+
+	request.Params.Arguments = map[string]any{"format": "json"}
+	result, err = HandleLokiMCPSlowQueries(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var report slowQueryReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Expected JSON, but got %v", err)
+	}
+	if report.Recorded != 1 || report.Pool.Requests < 2 || report.Pool.Opened+report.Pool.Reused < 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	request.Params.Arguments = map[string]any{"sort": "oldest"}
+	if _, err := HandleLokiMCPSlowQueries(context.Background(), request); err == nil {
+		t.Error("Expected an error for an unsupported sort")
+	}
+}
+
+// TestSlowQueryLog_Order tests listing slow queries newest or slowest first
+func TestSlowQueryLog_Order(t *testing.T) {
+	t.Cleanup(func() {
+		activeConfig.Store(nil)
+		slowQueries.Lock()
+		slowQueries.queries = nil
+		slowQueries.Unlock()
+	})
+	SetConfig(&Config{SlowQueryThreshold: time.Second})
+	slowQueries.Lock()
+	slowQueries.queries = []slowQuery{{Query: "first", DurationMS: 5000}, {Query: "second", DurationMS: 2000}, {Query: "third", DurationMS: 3000}}
+	slowQueries.Unlock()
+
+	for order, want := range map[string]string{"recent": "third,second", "duration": "first,third"} {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"format": "json", "sort": order, "limit": float64(2)}
+		result, err := HandleLokiMCPSlowQueries(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		var report slowQueryReport
+		json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report)
+		var got []string
+		for _, q := range report.Queries {
+			got = append(got, q.Query)
+		}
+		if strings.Join(got, ",") != want || report.Recorded != 3 {
+			t.Errorf("Expected %s for sort=%s, but got %v of %d", want, order, got, report.Recorded)
+		}
+	}
+}
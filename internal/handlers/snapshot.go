@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Snapshot limits. The oldest snapshots are evicted to stay within them.
+const (
+	defaultSnapshotLimit = 1000
+	maxSnapshotLimit     = 5000
+	maxSnapshots         = 50
+	maxSnapshotBytes     = 64 << 20 // approximate size of all stored results
+)
+
+// snapshot is a query result stored for later reference
+type snapshot struct {
+	ID         string
+	Name       string
+	Query      string
+	Start      time.Time
+	End        time.Time
+	Captured   time.Time
+	EntryCount int
+	Truncated  bool
+	Datasource string
+	conn       LokiConnection // connection the query ran with, to rerun it for a diff
+	limit      int
+	result     *LokiResult
+	bytes      int
+	sessionID  string // session that took the snapshot, the only one that may read it
+}
+
+// snapshotStatus describes a snapshot without its result
+type snapshotStatus struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Query      string `json:"query"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Captured   string `json:"captured_at"`
+	Age        string `json:"age"`
+	EntryCount int    `json:"entry_count"`
+	Truncated  bool   `json:"truncated"`
+	Datasource string `json:"datasource"`
+}
+
+// snapshotStore holds the snapshots in the order they were taken
+type snapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+	order     []string
+	bytes     int
+	nextID    int
+}
+
+var snapshots = &snapshotStore{snapshots: make(map[string]*snapshot)}
+
+// add stores a snapshot, evicting the oldest snapshots beyond the limits
+func (s *snapshotStore) add(snap *snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	snap.ID = fmt.Sprintf("snap-%d", s.nextID)
+	s.snapshots[snap.ID] = snap
+	s.order = append(s.order, snap.ID)
+	s.bytes += snap.bytes
+	for len(s.order) > 1 && (len(s.order) > maxSnapshots || s.bytes > maxSnapshotBytes) {
+		oldest := s.snapshots[s.order[0]]
+		s.bytes -= oldest.bytes
+		delete(s.snapshots, oldest.ID)
+		s.order = s.order[1:]
+	}
+}
+
+// get returns a snapshot if it was taken by the given session
+func (s *snapshotStore) get(id, sessionID string) (*snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[id]
+	if !ok || snap.sessionID != sessionID {
+		return nil, false
+	}
+	return snap, true
+}
+
+// list returns the snapshots taken by the given session, oldest first
+func (s *snapshotStore) list(sessionID string) []*snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*snapshot
+	for _, id := range s.order {
+		if snap := s.snapshots[id]; snap.sessionID == sessionID {
+			list = append(list, snap)
+		}
+	}
+	return list
+}
+
+// NewLokiSnapshotTool creates and returns a tool for storing a query result for later reference
+func NewLokiSnapshotTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Run a LogQL log query and store its full result server-side under an ID, to compare with later " +
+			"during an evolving incident, e.g. now vs. the snapshot from 20 minutes ago. Retrieve it with loki_snapshot_get " +
+			"and list snapshots with loki_snapshot_list."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL log query to snapshot, e.g. {app=\"api\"} |= \"error\""),
+		),
+		mcp.WithString("name",
+			mcp.Description("Name describing the snapshot, e.g. before-rollback"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of entries to store, at most %d (default: %d)", maxSnapshotLimit, defaultSnapshotLimit)),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_snapshot", opts...)
+}
+
+// NewLokiSnapshotGetTool creates and returns a tool for retrieving a stored query result
+func NewLokiSnapshotGetTool() mcp.Tool {
+	return mcp.NewTool("loki_snapshot_get",
+		mcp.WithDescription("Retrieve the result stored by loki_snapshot, with when it was taken"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the snapshot, e.g. snap-1"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, text, or ndjson (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// NewLokiSnapshotListTool creates and returns a tool for listing the stored query results
+func NewLokiSnapshotListTool() mcp.Tool {
+	return mcp.NewTool("loki_snapshot_list",
+		mcp.WithDescription("List the snapshots taken with loki_snapshot, with their query, time range, age and entry count"),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiSnapshot handles Loki snapshot tool requests
+func HandleLokiSnapshot(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	params, err := parseToolParams(ctx, request, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	query, _ := params.Args["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	query = applySessionSelector(ctx, query)
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return nil, fmt.Errorf("only log queries can be snapshotted, not metric queries")
+	}
+	limit := defaultSnapshotLimit
+	if n, ok := params.Args["limit"].(float64); ok {
+		if n < 1 || n > maxSnapshotLimit || n != math.Trunc(n) {
+			return nil, fmt.Errorf("limit must be a whole number between 1 and %d", maxSnapshotLimit)
+		}
+		limit = int(n)
+	}
+	name, _ := params.Args["name"].(string)
+
+	result, err := runLokiQuery(ctx, params.Conn, query, params.Start, params.End, limit)
+	if err != nil {
+		return nil, err
+	}
+	lineOptions{}.apply(result)
+
+	metadata := newResultMetadata(params).withEntries(result, limit)
+	snap := &snapshot{
+		Name:       name,
+		Query:      query,
+		Start:      params.Start.UTC(),
+		End:        params.End.UTC(),
+		Captured:   time.Now().UTC(),
+		EntryCount: metadata.EntryCount,
+		Truncated:  metadata.Truncated,
+		Datasource: redactURL(params.Conn.URL),
+		conn:       params.Conn,
+		limit:      limit,
+		result:     result,
+		bytes:      resultSize(result),
+		sessionID:  SessionKey(ctx),
+	}
+	snapshots.add(snap)
+
+	text := fmt.Sprintf("Saved %s: %d entries of %s from %s to %s. Retrieve it with loki_snapshot_get",
+		snap.ID, snap.EntryCount, query, snap.Start.Format(time.RFC3339), snap.End.Format(time.RFC3339))
+	if snap.Truncated {
+		text += fmt.Sprintf(". The result was truncated at the limit of %d entries", limit)
+	}
+	toolResult := metadata.attach(mcp.NewToolResultText(text))
+	toolResult.Meta["snapshot_id"] = snap.ID
+	return toolResult, nil
+}
+
+// HandleLokiSnapshotGet handles Loki snapshot get tool requests
+func HandleLokiSnapshotGet(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	id, _ := args["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	snap, ok := snapshots.get(id, SessionKey(ctx))
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s not found. It may have been evicted to make room for newer snapshots", id)
+	}
+
+	format := formatArg(args)
+	var formattedResult string
+	var err error
+	if format == "ndjson" {
+		formattedResult, err = formatLokiNDJSON(snap.result, "", nil)
+	} else {
+		formattedResult, err = formatLokiResults(snap.result, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	status := snap.status(time.Now())
+	toolResult := mcp.NewToolResultText(formattedResult)
+	toolResult.Content = append(toolResult.Content, mcp.NewTextContent(fmt.Sprintf(
+		"Snapshot %s of %s, taken %s ago at %s, covering %s to %s", status.label(), snap.Query, status.Age, status.Captured, status.Start, status.End)))
+	toolResult.Meta = map[string]any{
+		"snapshot_id": snap.ID,
+		"captured_at": status.Captured,
+		"entry_count": snap.EntryCount,
+		"truncated":   snap.Truncated,
+		"start":       status.Start,
+		"end":         status.End,
+		"datasource":  snap.Datasource,
+	}
+	return toolResult, nil
+}
+
+// HandleLokiSnapshotList handles Loki snapshot list tool requests
+func HandleLokiSnapshotList(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	format := formatArg(request.GetArguments())
+
+	now := time.Now()
+	statuses := []snapshotStatus{}
+	for _, snap := range snapshots.list(SessionKey(ctx)) {
+		statuses = append(statuses, snap.status(now))
+	}
+
+	formattedResult, err := formatSnapshotList(statuses, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// status describes a snapshot, with its age at the given time
+func (s *snapshot) status(now time.Time) snapshotStatus {
+	return snapshotStatus{
+		ID:         s.ID,
+		Name:       s.Name,
+		Query:      s.Query,
+		Start:      s.Start.Format(time.RFC3339),
+		End:        s.End.Format(time.RFC3339),
+		Captured:   s.Captured.Format(time.RFC3339),
+		Age:        now.Sub(s.Captured).Round(time.Second).String(),
+		EntryCount: s.EntryCount,
+		Truncated:  s.Truncated,
+		Datasource: s.Datasource,
+	}
+}
+
+// label returns the ID of a snapshot with its name
+func (s snapshotStatus) label() string {
+	if s.Name == "" {
+		return s.ID
+	}
+	return s.ID + " (" + s.Name + ")"
+}
+
+// formatSnapshotList formats the snapshot list into a readable string
+func formatSnapshotList(statuses []snapshotStatus, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		if len(statuses) == 0 {
+			return "No snapshots taken", nil
+		}
+		var b strings.Builder
+		for _, s := range statuses {
+			if format == "raw" {
+				fmt.Fprintf(&b, "%s %s %d %s\n", s.ID, s.Captured, s.EntryCount, s.Query)
+				continue
+			}
+			fmt.Fprintf(&b, "%s: taken %s ago at %s\n  %s from %s to %s\n  %d entries", s.label(), s.Age, s.Captured, s.Query, s.Start, s.End, s.EntryCount)
+			if s.Truncated {
+				b.WriteString(", truncated at the limit")
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
+
+// resultSize approximates the memory used by a query result from the size of its lines and labels
+func resultSize(result *LokiResult) int {
+	size := 0
+	for _, stream := range result.Data.Result {
+		for k, v := range stream.Stream {
+			size += len(k) + len(v)
+		}
+		for _, value := range stream.Values {
+			for _, field := range value {
+				size += len(field)
+			}
+		}
+	}
+	return size
+}
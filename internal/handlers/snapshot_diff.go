@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// snapshotDiffReport compares a snapshot with a current run of its query
+type snapshotDiffReport struct {
+	Snapshot      string        `json:"snapshot"`
+	Query         string        `json:"query"`
+	Captured      string        `json:"snapshot_captured_at"`
+	SnapshotStart string        `json:"snapshot_start"`
+	SnapshotEnd   string        `json:"snapshot_end"`
+	Start         string        `json:"start"`
+	End           string        `json:"end"`
+	SnapshotLines int           `json:"snapshot_lines"`
+	Lines         int           `json:"lines"`
+	SnapshotRate  float64       `json:"snapshot_lines_per_minute"`
+	Rate          float64       `json:"lines_per_minute"`
+	Truncated     bool          `json:"truncated"` // either side reached the limit, so counts are lower bounds
+	New           []patternDiff `json:"new_patterns"`
+	Gone          []patternDiff `json:"gone_patterns"`
+	Changed       []patternDiff `json:"changed_patterns"`
+}
+
+// NewLokiSnapshotDiffTool creates and returns a tool for comparing a snapshot with the current logs
+func NewLokiSnapshotDiffTool() mcp.Tool {
+	return mcp.NewTool("loki_snapshot_diff",
+		mcp.WithDescription("Compare a snapshot taken with loki_snapshot with a current run of its query, e.g. to check whether "+
+			"an error stopped since a rollback. Lines are grouped into patterns (numbers, IDs and addresses replaced by placeholders) "+
+			"and reported as new, gone, or changed in frequency versus the snapshot, with the line rate of both."),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the snapshot, e.g. snap-1"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time of the current run (default: a window as long as the snapshot's, ending now)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time of the current run (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("top",
+			mcp.Description("Maximum number of patterns to show per section (default: 20)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiSnapshotDiff handles Loki snapshot diff tool requests
+func HandleLokiSnapshotDiff(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	id, _ := args["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	snap, ok := snapshots.get(id, SessionKey(ctx))
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s not found. It may have been evicted to make room for newer snapshots", id)
+	}
+
+	start, end, err := parseTimeRange(args, snap.End.Sub(snap.Start))
+	if err != nil {
+		return nil, err
+	}
+	top := 20
+	if topVal, ok := args["top"].(float64); ok && topVal > 0 {
+		top = int(topVal)
+	}
+	format := formatArg(args)
+
+	result, err := runLokiQuery(ctx, snap.conn, snap.Query, start, end, snap.limit)
+	if err != nil {
+		return nil, err
+	}
+	lineOptions{}.apply(result)
+
+	oldCounts, oldTotal := countPatterns(snap.result)
+	newCounts, newTotal := countPatterns(result)
+	diff := diffPatterns(oldCounts, oldTotal, newCounts, newTotal, top)
+	report := snapshotDiffReport{
+		Snapshot:      snapshotStatus{ID: snap.ID, Name: snap.Name}.label(),
+		Query:         snap.Query,
+		Captured:      snap.Captured.Format(time.RFC3339),
+		SnapshotStart: snap.Start.Format(time.RFC3339),
+		SnapshotEnd:   snap.End.Format(time.RFC3339),
+		Start:         start.UTC().Format(time.RFC3339),
+		End:           end.UTC().Format(time.RFC3339),
+		SnapshotLines: oldTotal,
+		Lines:         newTotal,
+		SnapshotRate:  linesPerMinute(oldTotal, snap.End.Sub(snap.Start)),
+		Rate:          linesPerMinute(newTotal, end.Sub(start)),
+		Truncated:     snap.Truncated || newTotal >= snap.limit,
+		New:           diff.New,
+		Gone:          diff.Gone,
+		Changed:       diff.Changed,
+	}
+
+	formattedResult, err := formatSnapshotDiff(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// linesPerMinute returns the rate of lines over a window
+func linesPerMinute(lines int, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	return float64(lines) / window.Minutes()
+}
+
+// formatSnapshotDiff formats the snapshot diff report into a readable string
+func formatSnapshotDiff(report snapshotDiffReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Comparing snapshot %s of %s\n", report.Snapshot, report.Query)
+		fmt.Fprintf(&b, "  Snapshot: %d lines (%.1f/min) from %s to %s\n", report.SnapshotLines, report.SnapshotRate, report.SnapshotStart, report.SnapshotEnd)
+		fmt.Fprintf(&b, "  Now:      %d lines (%.1f/min) from %s to %s\n", report.Lines, report.Rate, report.Start, report.End)
+		if report.Truncated {
+			b.WriteString("Warning: a side reached the limit of the snapshot, so its counts are lower bounds\n")
+		}
+
+		section := func(title string, diffs []patternDiff) {
+			fmt.Fprintf(&b, "\n%s (%d):\n", title, len(diffs))
+			if len(diffs) == 0 {
+				b.WriteString("  none\n")
+				return
+			}
+			for _, d := range diffs {
+				marker := "  "
+				if d.IsError {
+					marker = "! "
+				}
+				fmt.Fprintf(&b, "%ssnapshot=%d (%.1f%%) now=%d (%.1f%%)  %s\n",
+					marker, d.OldCount, d.OldShare*100, d.NewCount, d.NewShare*100, d.Pattern)
+			}
+		}
+		section("New patterns since the snapshot", report.New)
+		section("Patterns gone since the snapshot", report.Gone)
+		section("Patterns with changed frequency", report.Changed)
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
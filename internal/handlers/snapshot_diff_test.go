@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestLokiSnapshotDiff tests comparing a snapshot with the current lines of its query
+func TestLokiSnapshotDiff(t *testing.T) {
+	resetSnapshots(t)
+	query := `{app="api"}`
+	fake := &cannedQueryLokiClient{lines: map[string][]string{query: {
+		"error: connection refused to db-1",
+		"error: connection refused to db-2",
+		"request 1 served",
+	}}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": query, "since": "15m"}
+	result, err := HandleLokiSnapshot(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	id, _ := result.Meta["snapshot_id"].(string)
+
+	fake.lines = map[string][]string{query: {"request 1 served", "request 2 served", "cache warmed"}}
+	request.Params.Arguments = map[string]any{"id": id, "format": "json"}
+	result, err = HandleLokiSnapshotDiff(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var report snapshotDiffReport
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report); err != nil {
+		t.Fatalf("Expected a JSON report, but got %v", err)
+	}
+	if report.SnapshotLines != 3 || report.Lines != 3 || report.Truncated {
+		t.Errorf("Unexpected line counts: %+v", report)
+	}
+	if len(report.Gone) != 1 || !report.Gone[0].IsError || report.Gone[0].OldCount != 2 {
+		t.Errorf("Expected the error pattern to be gone, but got %+v", report.Gone)
+	}
+	if len(report.New) != 1 || !strings.Contains(report.New[0].Pattern, "cache warmed") {
+		t.Errorf("Expected the new pattern, but got %+v", report.New)
+	}
+
+	request.Params.Arguments = map[string]any{"id": id, "format": "text"}
+	result, err = HandleLokiSnapshotDiff(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "Patterns gone since the snapshot (1):\n! snapshot=2") {
+		t.Errorf("Expected the gone error pattern to be marked, but got %s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"id": "snap-0"}
+	if _, err := HandleLokiSnapshotDiff(context.Background(), request); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, but got %v", err)
+	}
+}
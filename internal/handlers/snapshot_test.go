@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// resetSnapshots empties the snapshot store when the test ends
+func resetSnapshots(t *testing.T) {
+	t.Cleanup(func() {
+		snapshots.mu.Lock()
+		defer snapshots.mu.Unlock()
+		snapshots.snapshots, snapshots.order, snapshots.bytes = make(map[string]*snapshot), nil, 0
+	})
+}
+
+// TestLokiSnapshot tests storing a result and retrieving and listing it later
+func TestLokiSnapshot(t *testing.T) {
+	resetSnapshots(t)
+	fake := &cannedQueryLokiClient{lines: map[string][]string{`{app="api"} |= "error"`: {"error: timeout", "error: refused"}}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"} |= "error"`, "name": "before-rollback", "since": "15m"}
+	result, err := HandleLokiSnapshot(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	id, _ := result.Meta["snapshot_id"].(string)
+	if !strings.HasPrefix(result.Content[0].(mcp.TextContent).Text, "Saved "+id+": 2 entries") {
+		t.Errorf("Unexpected result: %v", result.Content)
+	}
+
+	// The stored result is returned even though Loki now has other lines
+	fake.lines = nil
+	request.Params.Arguments = map[string]any{"id": id, "format": "text"}
+	result, err = HandleLokiSnapshotGet(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "error: timeout") || !strings.Contains(text, "error: refused") {
+		t.Errorf("Expected the stored lines, but got %s", text)
+	}
+	if note := result.Content[1].(mcp.TextContent).Text; !strings.HasPrefix(note, "Snapshot "+id+` (before-rollback) of {app="api"} |= "error", taken 0s ago`) {
+		t.Errorf("Unexpected note: %s", note)
+	}
+	if result.Meta["entry_count"] != 2 {
+		t.Errorf("Unexpected metadata: %v", result.Meta)
+	}
+
+	request.Params.Arguments = map[string]any{"format": "json"}
+	result, err = HandleLokiSnapshotList(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var statuses []snapshotStatus
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &statuses); err != nil {
+		t.Fatalf("Expected a JSON list, but got %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ID != id || statuses[0].Name != "before-rollback" || statuses[0].EntryCount != 2 {
+		t.Errorf("Unexpected snapshots: %+v", statuses)
+	}
+
+	request.Params.Arguments = map[string]any{"query": `rate({app="api"}[1m])`}
+	if _, err := HandleLokiSnapshot(context.Background(), request); err == nil || !strings.Contains(err.Error(), "only log queries") {
+		t.Errorf("Expected a metric query error, but got %v", err)
+	}
+	request.Params.Arguments = map[string]any{"id": "snap-0"}
+	if _, err := HandleLokiSnapshotGet(context.Background(), request); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, but got %v", err)
+	}
+}
+
+// TestSnapshotStore_Eviction tests evicting the oldest snapshots beyond the limits and scoping them to sessions
+func TestSnapshotStore_Eviction(t *testing.T) {
+	resetSnapshots(t)
+	for i := 0; i < maxSnapshots+2; i++ {
+		snapshots.add(&snapshot{sessionID: "a", bytes: 1})
+	}
+	if list := snapshots.list("a"); len(list) != maxSnapshots || list[0].ID == "snap-1" {
+		t.Errorf("Expected the %d newest snapshots, but got %d starting at %s", maxSnapshots, len(list), list[0].ID)
+	}
+
+	big := &snapshot{sessionID: "b", bytes: maxSnapshotBytes}
+	snapshots.add(big)
+	if list := snapshots.list("a"); len(list) != 0 {
+		t.Errorf("Expected the older snapshots to be evicted for a large one, but got %d", len(list))
+	}
+	if _, ok := snapshots.get(big.ID, "b"); !ok {
+		t.Error("Expected the large snapshot to be kept")
+	}
+	if _, ok := snapshots.get(big.ID, "a"); ok {
+		t.Error("Expected other sessions not to see the snapshot")
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for the JSON file defining source link rules
+const EnvLokiSourceLinksFile = "LOKI_SOURCE_LINKS_FILE"
+
+// defaultSourcePattern matches file:line references of common languages in stack traces, e.g.
+// /app/internal/cart.go:42, checkout/views.py:118 or CartService.java:87
+const defaultSourcePattern = `(?P<path>[\w./-]+\.(?:go|py|java|kt|scala|js|mjs|ts|tsx|jsx|rb|php|cs|rs|swift|c|cc|cpp|h|hpp|ex|exs)):(?P<line>\d+)`
+
+// SourceLinkRule rewrites file:line references in the log lines of matching streams to repository URLs
+type SourceLinkRule struct {
+	Name string `json:"name"`
+	// Labels are the stream labels a stream must have for the rule to apply (default: all streams)
+	Labels map[string]string `json:"labels,omitempty"`
+	// Pattern finds references, with named groups path and line (default: file:line for common languages)
+	Pattern string `json:"pattern,omitempty"`
+	// StripPrefix is removed from the start of paths, e.g. the source directory in the container
+	// image. When set, paths without it, such as those of the standard library, are not linked.
+	StripPrefix string `json:"strip_prefix,omitempty"`
+	// URL is the link template, e.g. https://github.com/acme/checkout/blob/{ref}/{path}#L{line}
+	URL string `json:"url"`
+	// Ref is the branch, tag or commit substituted for {ref} (default: main), unless the stream
+	// has the label named by RefLabel, such as a version or commit label
+	Ref      string `json:"ref,omitempty"`
+	RefLabel string `json:"ref_label,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// LoadSourceLinks reads source link rules from a JSON file containing an array of rules
+func LoadSourceLinks(path string) ([]SourceLinkRule, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source links file: %w", err)
+	}
+	var rules []SourceLinkRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse source links file %s: %w", path, err)
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid source links file %s: rule %d (%s): %w", path, i+1, rules[i].Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// compile checks the rule and compiles its pattern
+func (r *SourceLinkRule) compile() error {
+	if r.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if !strings.Contains(r.URL, "{path}") {
+		return fmt.Errorf("url must contain {path}")
+	}
+	if u, err := url.Parse(strings.NewReplacer("{path}", "p", "{line}", "1", "{ref}", "r").Replace(r.URL)); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("url must be an http or https URL template")
+	}
+	pattern := r.Pattern
+	if pattern == "" {
+		pattern = defaultSourcePattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+	if re.SubexpIndex("path") < 0 {
+		return fmt.Errorf("pattern must have a named group path, e.g. (?P<path>...)")
+	}
+	if strings.Contains(r.URL, "{line}") && re.SubexpIndex("line") < 0 {
+		return fmt.Errorf("url uses {line} but the pattern has no named group line")
+	}
+	r.pattern = re
+	if r.Ref == "" {
+		r.Ref = "main"
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a stream
+func (r *SourceLinkRule) matches(labels map[string]string) bool {
+	for name, value := range r.Labels {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// link rewrites the references in a line of a stream to Markdown links
+func (r *SourceLinkRule) link(line string, labels map[string]string) string {
+	ref := r.Ref
+	if value := labels[r.RefLabel]; r.RefLabel != "" && value != "" {
+		ref = value
+	}
+	pathIndex, lineIndex := r.pattern.SubexpIndex("path"), r.pattern.SubexpIndex("line")
+
+	var b strings.Builder
+	last := 0
+	for _, m := range r.pattern.FindAllStringSubmatchIndex(line, -1) {
+		// Skip references already linked by an earlier rule
+		if m[0] > 0 && line[m[0]-1] == '[' {
+			continue
+		}
+		path := line[m[2*pathIndex]:m[2*pathIndex+1]]
+		if r.StripPrefix != "" {
+			if !strings.HasPrefix(path, r.StripPrefix) {
+				continue
+			}
+			path = strings.TrimPrefix(path, r.StripPrefix)
+		}
+		lineNo := ""
+		if lineIndex >= 0 && m[2*lineIndex] >= 0 {
+			lineNo = line[m[2*lineIndex]:m[2*lineIndex+1]]
+		}
+		target := strings.NewReplacer(
+			"{path}", escapeURLPath(strings.TrimPrefix(path, "/")),
+			"{line}", lineNo,
+			"{ref}", escapeURLPath(ref),
+		).Replace(r.URL)
+		b.WriteString(line[last:m[0]])
+		fmt.Fprintf(&b, "[%s](%s)", line[m[0]:m[1]], target)
+		last = m[1]
+	}
+	if last == 0 {
+		return line
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// escapeURLPath escapes each segment of a slash-separated path
+func escapeURLPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sourceLinksOption returns the tool option for turning off source links
+func sourceLinksOption() mcp.ToolOption {
+	return mcp.WithBoolean("source_links",
+		mcp.Description(fmt.Sprintf("Rewrite file:line references in stack traces to Markdown links to the repository, "+
+			"as configured in %s (raw and text formats; default: true when rules are configured)", EnvLokiSourceLinksFile)),
+	)
+}
+
+// sourceLinksEnabled reports whether source links apply to a tool call
+func sourceLinksEnabled(args map[string]any) bool {
+	if enabled, ok := args["source_links"].(bool); ok && !enabled {
+		return false
+	}
+	return len(CurrentConfig().SourceLinks) > 0
+}
+
+// applySourceLinks rewrites the file:line references in the result's lines with each rule matching
+// the stream, in order. References linked by an earlier rule are left alone, so a general rule can
+// follow specific ones.
+func applySourceLinks(result *LokiResult, rules []SourceLinkRule) {
+	for i := range result.Data.Result {
+		stream := &result.Data.Result[i]
+		var matching []*SourceLinkRule
+		for j := range rules {
+			if rules[j].pattern != nil && rules[j].matches(stream.Stream) {
+				matching = append(matching, &rules[j])
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				continue
+			}
+			for _, rule := range matching {
+				value[1] = rule.link(value[1], stream.Stream)
+			}
+		}
+	}
+}
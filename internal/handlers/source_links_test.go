@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestLoadSourceLinks tests reading and checking source link rules
+func TestLoadSourceLinks(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "source-links.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	rules, err := LoadSourceLinks(write(`[{"name": "checkout", "labels": {"app": "checkout"}, "url": "https://github.com/acme/checkout/blob/{ref}/{path}#L{line}"}]`))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(rules) != 1 || rules[0].Ref != "main" || rules[0].pattern == nil {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+
+	for content, want := range map[string]string{
+		`[{"name": "a"}]`: "url is required",
+		`[{"name": "a", "url": "https://github.com/acme/a"}]`:                                  "must contain {path}",
+		`[{"name": "a", "url": "file:///{path}"}]`:                                             "http or https",
+		`[{"name": "a", "url": "https://x/{path}", "pattern": "(["}]`:                          "invalid pattern",
+		`[{"name": "a", "url": "https://x/{path}#L{line}", "pattern": "(?P<path>\\S+\\.go)"}]`: "no named group line",
+		`[{"name": "a", "url": "https://x/{path}", "pattern": "\\S+\\.go"}]`:                   "named group path",
+	} {
+		if _, err := LoadSourceLinks(write(content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadSourceLinks(%s) = %v, want an error containing %q", content, err, want)
+		}
+	}
+}
+
+// TestHandleLokiQuery_SourceLinks tests rewriting stack trace references of matching streams to repository links
+func TestHandleLokiQuery_SourceLinks(t *testing.T) {
+	rules := []SourceLinkRule{
+		{Name: "checkout", Labels: map[string]string{"query": `{app="checkout"}`}, StripPrefix: "/app/", RefLabel: "version",
+			URL: "https://github.com/acme/checkout/blob/{ref}/{path}#L{line}"},
+		{Name: "gitlab", URL: "https://gitlab.example.com/acme/shared/-/blob/{ref}/{path}#L{line}", Ref: "release"},
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SetConfig(&Config{LokiURL: DefaultLokiURL, SourceLinks: rules})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	query := `{app="checkout"}`
+	SetLokiClient(&cannedQueryLokiClient{lines: map[string][]string{query: {
+		"panic: nil map at /app/internal/cart.go:42 called from /usr/local/go/src/runtime/panic.go:770",
+	}}})
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": query, "format": "text"}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	// The checkout rule links its own path and skips the runtime's, which the general rule then links
+	want := "panic: nil map at [/app/internal/cart.go:42](https://github.com/acme/checkout/blob/main/internal/cart.go#L42) " +
+		"called from [/usr/local/go/src/runtime/panic.go:770](https://gitlab.example.com/acme/shared/-/blob/release/usr/local/go/src/runtime/panic.go#L770)"
+	if !strings.Contains(text, want) {
+		t.Errorf("Expected the linked line, but got:\n%s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"query": query, "format": "text", "source_links": false}
+	result, err = HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; strings.Contains(text, "](") {
+		t.Errorf("Expected no links with source_links=false, but got:\n%s", text)
+	}
+}
+
+// TestSourceLinkRule_RefLabel tests linking to the version a stream is labeled with
+func TestSourceLinkRule_RefLabel(t *testing.T) {
+	rule := SourceLinkRule{URL: "https://github.com/acme/api/blob/{ref}/{path}#L{line}", RefLabel: "commit"}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+	got := rule.link(`File "api/views.py", line 3 in api/views.py:118`, map[string]string{"commit": "3f2c1ab"})
+	if want := `File "api/views.py", line 3 in [api/views.py:118](https://github.com/acme/api/blob/3f2c1ab/api/views.py#L118)`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
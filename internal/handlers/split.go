@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// maxSplitSlices is the number of slices a time range may be split into
+	maxSplitSlices = 100
+	// splitParallelism is the number of slices queried at the same time
+	splitParallelism = 4
+)
+
+// timeSlice is a part of a query's time range
+type timeSlice struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// sliceCoverage describes the parts of the time range a sliced query returned, when it timed out
+// before every slice completed
+type sliceCoverage struct {
+	Start   time.Time // requested time range
+	End     time.Time
+	Covered []timeSlice // completed slices, merged where adjacent, in time order
+}
+
+// splitOption returns the tool option for running a query as one subquery per slice of the time range
+func splitOption() mcp.ToolOption {
+	return mcp.WithString("split",
+		mcp.Description(fmt.Sprintf("Split the time range into slices of this duration, e.g. 1h, queried %d at a time starting "+
+			"from the returned end of the range and merged, so a long range doesn't fail as one query. With timeout, the "+
+			"slices that completed are returned when time runs out (at most %d slices; not with position both)", splitParallelism, maxSplitSlices)),
+	)
+}
+
+// splitTimeoutOption returns the tool option for the overall timeout of a sliced query
+func splitTimeoutOption() mcp.ToolOption {
+	return mcp.WithString("timeout",
+		mcp.Description("Overall time allowed for a query with split, e.g. 30s. When it runs out, the slices that completed "+
+			"are returned with a note of the part of the time range they cover (default: no timeout)"),
+	)
+}
+
+// parseSplitOptions extracts the slice duration and overall timeout from tool arguments
+func parseSplitOptions(args map[string]any, position string) (time.Duration, time.Duration, error) {
+	split, err := durationArg(args, "split", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	timeout, err := durationArg(args, "timeout", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if split > 0 && position == PositionBoth {
+		return 0, 0, fmt.Errorf("split cannot be used with position both")
+	}
+	if timeout > 0 && split == 0 {
+		return 0, 0, fmt.Errorf("timeout requires split")
+	}
+	return split, timeout, nil
+}
+
+// splitTimeRange splits a time range into slices of a duration, ordered from the end the entries are
+// returned from: the newest first for tail, the oldest first for head
+func splitTimeRange(start, end time.Time, split time.Duration, position string) ([]timeSlice, error) {
+	n := int((end.Sub(start) + split - 1) / split)
+	if n > maxSplitSlices {
+		return nil, fmt.Errorf("split %s divides the time range into %d slices; use a split of at least %s",
+			formatLogQLDuration(split), n, formatLogQLDuration((end.Sub(start)/maxSplitSlices).Truncate(time.Second)+time.Second))
+	}
+	slices := make([]timeSlice, 0, n)
+	for s := start; s.Before(end); s = s.Add(split) {
+		e := s.Add(split)
+		if e.After(end) {
+			e = end
+		}
+		slices = append(slices, timeSlice{Start: s, End: e})
+	}
+	if position != PositionHead {
+		for i, j := 0, len(slices)-1; i < j; i, j = i+1, j-1 {
+			slices[i], slices[j] = slices[j], slices[i]
+		}
+	}
+	return slices, nil
+}
+
+// runSlicedQuery runs a log query as one subquery per slice of the time range and merges the
+// results, keeping the limit entries at the requested position. Slices are no longer started once
+// those ahead of them hold limit entries. When the timeout runs out, the slices that completed are
+// returned with their coverage; when none did, or a slice fails, the call fails.
+func runSlicedQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int, position string, split, timeout time.Duration) (*LokiResult, *sliceCoverage, error) {
+	slices, err := splitTimeRange(start, end, split, position)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(slices) == 0 {
+		result, err := runLokiQuery(ctx, conn, query, start, end, limit)
+		return result, nil, err
+	}
+	sliceCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		sliceCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if position == PositionHead {
+		sliceCtx = withQueryDirection(sliceCtx, DirectionForward)
+	}
+
+	results := make([]*LokiResult, len(slices))
+	errs := make([]error, len(slices))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan int)
+	enough := func() bool {
+		// Whether the completed slices at the front already hold limit entries
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, result := range results {
+			if result == nil {
+				return false
+			}
+			if n += countEntries(result); n >= limit {
+				return true
+			}
+		}
+		return false
+	}
+	for range min(splitParallelism, len(slices)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				result, err := runLokiQuery(sliceCtx, conn, query, slices[i].Start, slices[i].End, limit)
+				mu.Lock()
+				results[i], errs[i] = result, err
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range slices {
+		if enough() || sliceCtx.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var merged *LokiResult
+	var completed []timeSlice
+	timedOut := false
+	for i, result := range results {
+		if err := errs[i]; err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				timedOut = true
+				continue
+			}
+			return nil, nil, err
+		}
+		if result == nil {
+			// Not started: either enough entries were found ahead of it, or time ran out
+			timedOut = timedOut || sliceCtx.Err() != nil && !enough()
+			continue
+		}
+		completed = append(completed, slices[i])
+		if merged == nil {
+			merged = result
+		} else {
+			merged = mergeLokiResults(merged, result)
+		}
+	}
+	if merged == nil {
+		return nil, nil, fmt.Errorf("query timed out after %s before any slice of the time range completed; "+
+			"use a longer timeout or a smaller split", timeout)
+	}
+	keepEntries(merged, limit, position)
+	if !timedOut {
+		return merged, nil, nil
+	}
+	return merged, &sliceCoverage{Start: start, End: end, Covered: mergeTimeSlices(completed)}, nil
+}
+
+// keepEntries keeps the limit newest entries of a result, or the oldest for head, removing streams left empty
+func keepEntries(result *LokiResult, limit int, position string) {
+	var timestamps []int64
+	for _, stream := range result.Data.Result {
+		for _, val := range stream.Values {
+			timestamps = append(timestamps, compactNanos(val[0]))
+		}
+	}
+	if limit <= 0 || len(timestamps) <= limit {
+		return
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	// Entries sharing the cutoff timestamp are kept in stream order until the limit is reached
+	cutoff, newest := timestamps[len(timestamps)-limit], position != PositionHead
+	if !newest {
+		cutoff = timestamps[limit-1]
+	}
+	beyond := 0
+	for _, ts := range timestamps {
+		if newest && ts > cutoff || !newest && ts < cutoff {
+			beyond++
+		}
+	}
+	atCutoff := limit - beyond
+
+	streams := result.Data.Result[:0]
+	for _, stream := range result.Data.Result {
+		values := stream.Values[:0]
+		for _, val := range stream.Values {
+			ts := compactNanos(val[0])
+			keep := newest && ts > cutoff || !newest && ts < cutoff
+			if ts == cutoff && atCutoff > 0 {
+				keep = true
+				atCutoff--
+			}
+			if keep {
+				values = append(values, val)
+			}
+		}
+		if len(values) > 0 {
+			stream.Values = values
+			streams = append(streams, stream)
+		}
+	}
+	result.Data.Result = streams
+}
+
+// mergeTimeSlices sorts slices by time and merges adjacent ones
+func mergeTimeSlices(slices []timeSlice) []timeSlice {
+	sort.Slice(slices, func(i, j int) bool { return slices[i].Start.Before(slices[j].Start) })
+	var merged []timeSlice
+	for _, s := range slices {
+		if n := len(merged); n > 0 && !s.Start.After(merged[n-1].End) {
+			merged[n-1].End = maxTime(merged[n-1].End, s.End)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// maxTime returns the later of two times
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// String describes the coverage of a partial result, e.g.
+// "Partial results: covered 14:00–16:30 of requested 14:00–20:00"
+func (c *sliceCoverage) String() string {
+	layout := coverageTimeLayout(c.Start, c.End)
+	formatRange := func(start, end time.Time) string {
+		return start.UTC().Format(layout) + "–" + end.UTC().Format(layout)
+	}
+	covered := make([]string, len(c.Covered))
+	for i, s := range c.Covered {
+		covered[i] = formatRange(s.Start, s.End)
+	}
+	return fmt.Sprintf("Partial results: covered %s of requested %s (UTC); the query timed out before the rest of the time range completed",
+		strings.Join(covered, ", "), formatRange(c.Start, c.End))
+}
+
+// coverageTimeLayout returns the shortest layout that tells apart the times of a range
+func coverageTimeLayout(start, end time.Time) string {
+	layout := "15:04"
+	if start.Second() != 0 || end.Second() != 0 {
+		layout = "15:04:05"
+	}
+	if start.UTC().YearDay() != end.UTC().YearDay() || start.UTC().Year() != end.UTC().Year() {
+		layout = "2006-01-02 " + layout
+	}
+	return layout
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newSplitTestServer returns a Loki server answering each slice with entries at its start and
+// 30 minutes in, and never answering slices starting before slow
+func newSplitTestServer(t *testing.T, slow time.Time) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/query_range") {
+			http.NotFound(w, r)
+			return
+		}
+		start, _, _ := parseLokiTimestamp(r.URL.Query().Get("start"))
+		if start.Before(slow) {
+			<-release
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[["%d","at %s"],["%d","at %s"]]}]}}`,
+			start.UnixNano(), start.Format("15:04"), start.Add(30*time.Minute).UnixNano(), start.Add(30*time.Minute).Format("15:04"))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return server
+}
+
+// TestHandleLokiQuery_SplitPartial tests returning the completed slices when the timeout runs out
+func TestHandleLokiQuery_SplitPartial(t *testing.T) {
+	server := newSplitTestServer(t, time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC))
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "format": "text",
+		"start": "2024-01-15T14:00:00Z", "end": "2024-01-15T20:00:00Z", "split": "1h", "timeout": "200ms"}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "at 16:00") || !strings.Contains(text, "at 19:30") || strings.Contains(text, "at 15:") {
+		t.Errorf("Expected the entries of the completed slices, but got %s", text)
+	}
+	note := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+	if !strings.HasPrefix(note, "Partial results: covered 16:00–20:00 of requested 14:00–20:00 (UTC)") {
+		t.Errorf("Expected a partial results notice, but got %s", note)
+	}
+	covered, _ := result.Meta["covered"].([]timeSlice)
+	if result.Meta["partial"] != true || len(covered) != 1 || result.Meta["truncated"] != true || result.Meta["next_cursor"] != "2024-01-15T16:00:00Z" {
+		t.Errorf("Unexpected metadata: %v", result.Meta)
+	}
+}
+
+// TestHandleLokiQuery_SplitTimeoutNothingCompleted tests failing when no slice completes in time
+func TestHandleLokiQuery_SplitTimeoutNothingCompleted(t *testing.T) {
+	server := newSplitTestServer(t, time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC))
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL,
+		"start": "2024-01-15T14:00:00Z", "end": "2024-01-15T20:00:00Z", "split": "1h", "timeout": "100ms"}
+	if _, err := HandleLokiQuery(context.Background(), request); err == nil || !strings.Contains(err.Error(), "before any slice of the time range completed") {
+		t.Errorf("Expected a timeout error, but got %v", err)
+	}
+}
+
+// TestHandleLokiQuery_SplitLimit tests keeping the limit entries at the requested position
+func TestHandleLokiQuery_SplitLimit(t *testing.T) {
+	server := newSplitTestServer(t, time.Time{})
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "format": "text", "limit": float64(3),
+		"position": "head", "start": "2024-01-15T14:00:00Z", "end": "2024-01-15T20:00:00Z", "split": "1h"}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, line := range []string{"at 14:00", "at 14:30", "at 15:00"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("Expected %q in the oldest entries, but got %s", line, text)
+		}
+	}
+	if strings.Contains(text, "at 15:30") || result.Meta["entry_count"] != 3 || result.Meta["partial"] != nil {
+		t.Errorf("Expected only the 3 oldest entries, but got %s (%v)", text, result.Meta)
+	}
+}
+
+// TestSplitTimeRange tests slicing a time range from the end entries are returned from
+func TestSplitTimeRange(t *testing.T) {
+	start := time.Date(2024, 1, 15, 14, 0, 0, 0, time.UTC)
+	slices, err := splitTimeRange(start, start.Add(150*time.Minute), time.Hour, PositionTail)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(slices) != 3 || !slices[0].Start.Equal(start.Add(2*time.Hour)) || !slices[0].End.Equal(start.Add(150*time.Minute)) || !slices[2].Start.Equal(start) {
+		t.Errorf("Unexpected slices: %+v", slices)
+	}
+
+	if _, err := splitTimeRange(start, start.Add(24*time.Hour), time.Minute, PositionHead); err == nil || !strings.Contains(err.Error(), "use a split of at least 865s") {
+		t.Errorf("Expected a too many slices error, but got %v", err)
+	}
+	if _, _, err := parseSplitOptions(map[string]any{"split": "1h"}, PositionBoth); err == nil {
+		t.Error("Expected an error for split with position both")
+	}
+	if _, _, err := parseSplitOptions(map[string]any{"timeout": "30s"}, PositionTail); err == nil {
+		t.Error("Expected an error for timeout without split")
+	}
+}
+
+// TestSliceCoverage_String tests describing the covered parts of the time range
+func TestSliceCoverage_String(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	coverage := &sliceCoverage{Start: day.Add(20 * time.Hour), End: day.Add(28 * time.Hour), Covered: mergeTimeSlices([]timeSlice{
+		{day.Add(26 * time.Hour), day.Add(28 * time.Hour)},
+		{day.Add(20 * time.Hour), day.Add(21 * time.Hour)},
+		{day.Add(25 * time.Hour), day.Add(26 * time.Hour)},
+	})}
+	expected := "Partial results: covered 2024-01-15 20:00–2024-01-15 21:00, 2024-01-16 01:00–2024-01-16 04:00 of requested 2024-01-15 20:00–2024-01-16 04:00 (UTC)"
+	if !strings.HasPrefix(coverage.String(), expected) {
+		t.Errorf("Expected %s, but got %s", expected, coverage.String())
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Environment variable names for the startup connectivity probe
+const (
+	// EnvStartupProbe enables probing every datasource at startup, continuing when some are unreachable
+	EnvStartupProbe = "LOKI_MCP_STARTUP_PROBE"
+	// EnvStrictStartup probes every datasource at startup and exits when any is unreachable
+	EnvStrictStartup = "LOKI_MCP_STRICT_STARTUP"
+)
+
+// StartupProbeResult is the outcome of probing a datasource at startup
+type StartupProbeResult struct {
+	Datasource string // empty for the connection configured by LOKI_URL
+	URL        string
+	Healthy    bool
+	Error      string
+}
+
+// startupFailures holds the datasources that failed the startup probe by name, until a
+// request to one of their endpoints succeeds
+var startupFailures = struct {
+	sync.Mutex
+	failures map[string]StartupProbeResult
+}{failures: make(map[string]StartupProbeResult)}
+
+// ProbeDatasources checks the /ready endpoint of every configured datasource, and of the LOKI_URL
+// connection when no datasource is the default. A datasource with several failover endpoints is
+// healthy when any endpoint is. Unhealthy datasources are remembered so tool calls using them
+// report a warning.
+func ProbeDatasources(ctx context.Context) []StartupProbeResult {
+	cfg := CurrentConfig()
+	names := datasourceNames(cfg)
+	if _, ok := findDatasource(cfg, ""); !ok {
+		names = append([]string{""}, names...)
+	}
+
+	results := make([]StartupProbeResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probeDatasource(ctx, name)
+		}()
+	}
+	wg.Wait()
+
+	startupFailures.Lock()
+	defer startupFailures.Unlock()
+	clear(startupFailures.failures)
+	for _, result := range results {
+		if !result.Healthy {
+			startupFailures.failures[result.Datasource] = result
+		}
+	}
+	return results
+}
+
+// probeDatasource probes each endpoint of a datasource, updating the failover group's health
+func probeDatasource(ctx context.Context, name string) StartupProbeResult {
+	conn := ResolveLokiConnection(map[string]any{"datasource": name})
+	endpoints := conn.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{conn.URL}
+	}
+	group := endpointGroupFor(strings.Join(endpoints, ","))
+
+	result := StartupProbeResult{Datasource: name, URL: strings.Join(endpoints, ",")}
+	var errs []string
+	for _, endpoint := range endpoints {
+		probe := probeEndpoint(ctx, conn, endpoint)
+		if group != nil {
+			if probe.Healthy {
+				group.markSuccess(endpoint)
+			} else {
+				group.markFailure(endpoint, errors.New(probe.LastError))
+			}
+		}
+		if probe.Healthy {
+			result.Healthy = true
+		} else if len(endpoints) > 1 {
+			errs = append(errs, fmt.Sprintf("%s: %s", endpoint, probe.LastError))
+		} else {
+			errs = append(errs, probe.LastError)
+		}
+	}
+	if group != nil {
+		group.failBack()
+	}
+	if !result.Healthy {
+		result.Error = strings.Join(errs, "; ")
+	}
+	return result
+}
+
+// warnIfStartupFailed adds a warning when the connection's datasource failed the startup probe
+// and has not answered a request since
+func warnIfStartupFailed(ctx context.Context, conn LokiConnection) {
+	startupFailures.Lock()
+	result, ok := startupFailures.failures[conn.Datasource]
+	startupFailures.Unlock()
+	if !ok {
+		return
+	}
+	name := result.Datasource
+	if name == "" {
+		name = EnvLokiURL
+	}
+	addWarning(ctx, fmt.Sprintf("datasource %s was unreachable at startup (%s); results may be unavailable", name, result.Error))
+}
+
+// clearStartupFailure forgets the startup probe failure of datasources with an endpoint
+// serving the request URL, once a request to it succeeded
+func clearStartupFailure(requestURL string) {
+	startupFailures.Lock()
+	defer startupFailures.Unlock()
+	for name, result := range startupFailures.failures {
+		for _, endpoint := range splitLokiURLs(result.URL) {
+			if strings.HasPrefix(requestURL, endpoint) {
+				delete(startupFailures.failures, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestProbeDatasources tests recording unreachable datasources and warning about them until they answer
+func TestProbeDatasources(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ready"))
+	}))
+	t.Cleanup(up.Close)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	t.Cleanup(func() { activeConfig.Store(nil) })
+	cfg := LoadConfig()
+	cfg.LokiURL = down.URL
+	cfg.Datasources = []Datasource{
+		{Name: "prod", URL: up.URL},
+		{Name: "failover", URL: down.URL + "," + up.URL},
+	}
+	SetConfig(cfg)
+
+	results := ProbeDatasources(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("Expected the LOKI_URL connection and 2 datasources, but got %+v", results)
+	}
+	if results[0].Datasource != "" || results[0].Healthy || results[0].Error == "" {
+		t.Errorf("Expected LOKI_URL to be unreachable, but got %+v", results[0])
+	}
+	if !results[1].Healthy || !results[2].Healthy {
+		t.Errorf("Expected the datasources to be healthy, but got %+v", results[1:])
+	}
+	if conn := ResolveLokiConnection(map[string]any{"datasource": "failover"}); conn.URL != up.URL {
+		t.Errorf("Expected the failover datasource to use the healthy endpoint, but got %s", conn.URL)
+	}
+
+	w := &toolWarnings{}
+	ctx := context.WithValue(context.Background(), warningsKey{}, w)
+	warnIfStartupFailed(ctx, ResolveLokiConnection(map[string]any{"datasource": "prod"}))
+	warnIfStartupFailed(ctx, ResolveLokiConnection(map[string]any{}))
+	if len(w.messages) != 1 || !strings.Contains(w.messages[0], "datasource LOKI_URL was unreachable at startup") {
+		t.Errorf("Expected a warning for LOKI_URL only, but got %v", w.messages)
+	}
+
+	clearStartupFailure(down.URL + "/loki/api/v1/labels")
+	w.messages = nil
+	warnIfStartupFailed(ctx, ResolveLokiConnection(map[string]any{}))
+	if len(w.messages) != 0 {
+		t.Errorf("Expected no warning once a request succeeded, but got %v", w.messages)
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for suggesting selector corrections when a query returns no logs (default: false)
+const EnvLokiSuggestSelectors = "LOKI_SUGGEST_SELECTORS"
+
+// Window searched for labels when suggesting selector corrections, at least
+const suggestionWindow = 24 * time.Hour
+
+// Maximum number of alternatives suggested for a single matcher
+const maxSuggestions = 3
+
+// identityLabels are the labels commonly used to name a service, searched for the value of
+// a matcher that matched nothing under its own label
+var identityLabels = []string{"app", "service_name", "service", "job", "container", "component", "namespace"}
+
+// suggestOption returns the tool option for suggesting selector corrections on empty results
+func suggestOption() mcp.ToolOption {
+	return mcp.WithBoolean("suggest",
+		mcp.Description(fmt.Sprintf("When the query returns no logs, look up nearby labels and suggest corrections "+
+			"to the stream selector (default: false, or %s env var)", EnvLokiSuggestSelectors)),
+	)
+}
+
+// suggestEnabled reports whether selector suggestions were requested for a tool call
+func suggestEnabled(args map[string]any) bool {
+	if suggest, ok := args["suggest"].(bool); ok {
+		return suggest
+	}
+	return CurrentConfig().SuggestSelectors
+}
+
+// suggestSelectorCorrections looks up the labels around the query window and suggests
+// alternatives for each equality matcher in the stream selector that selects no streams.
+// Lookups are best effort; failures produce no suggestions rather than an error.
+func suggestSelectorCorrections(ctx context.Context, conn LokiConnection, query string, start, end time.Time) []string {
+	selector, _, err := splitStreamSelector(query)
+	if err != nil {
+		return nil
+	}
+	if end.Sub(start) < suggestionWindow {
+		start = end.Add(-suggestionWindow)
+	}
+
+	client := CurrentLokiClient()
+	labelsResult, err := client.Labels(ctx, conn, start, end)
+	if err != nil {
+		return nil
+	}
+	labels := labelsResult.Data
+
+	// Label values are fetched at most once per label
+	values := make(map[string][]string)
+	valuesOf := func(label string) []string {
+		if v, ok := values[label]; ok {
+			return v
+		}
+		result, err := client.LabelValues(ctx, conn, label, start, end)
+		if err != nil {
+			values[label] = nil
+			return nil
+		}
+		values[label] = result.Data
+		return result.Data
+	}
+
+	var suggestions []string
+	for _, part := range splitOutsideQuotes(selector[1:len(selector)-1], ',') {
+		label, op, value, err := parseLabelMatcher(strings.TrimSpace(part))
+		if err != nil || op != "=" || value == "" {
+			continue
+		}
+
+		var alternatives []string
+		if !slices.Contains(labels, label) {
+			for _, similar := range similarStrings(label, labels) {
+				alternatives = append(alternatives, similar+"="+quoteLogQLString(value))
+			}
+		} else if slices.Contains(valuesOf(label), value) {
+			continue
+		} else {
+			for _, similar := range similarStrings(value, valuesOf(label)) {
+				alternatives = append(alternatives, label+"="+quoteLogQLString(similar))
+			}
+		}
+
+		// The value may belong under another label that names the service
+		for _, other := range identityLabels {
+			if len(alternatives) >= maxSuggestions {
+				break
+			}
+			if other == label || !slices.Contains(labels, other) {
+				continue
+			}
+			candidates := valuesOf(other)
+			found := value
+			if !slices.Contains(candidates, value) {
+				similar := similarStrings(value, candidates)
+				if len(similar) == 0 {
+					continue
+				}
+				found = similar[0]
+			}
+			if alternative := other + "=" + quoteLogQLString(found); !slices.Contains(alternatives, alternative) {
+				alternatives = append(alternatives, alternative)
+			}
+		}
+
+		message := fmt.Sprintf("no streams with %s=%s", label, quoteLogQLString(value))
+		if len(alternatives) > 0 {
+			message += "; did you mean " + strings.Join(alternatives, " or ") + "?"
+		}
+		suggestions = append(suggestions, message)
+	}
+	return suggestions
+}
+
+// similarValue is a candidate resembling a target string, with how it matched
+type similarValue struct {
+	Value    string `json:"value"`
+	Match    string `json:"match"` // exact, case, substring or fuzzy
+	Distance int    `json:"distance"`
+}
+
+// matchRank orders match kinds from the strongest to the weakest
+var matchRank = map[string]int{"exact": 0, "case": 1, "substring": 2, "fuzzy": 3}
+
+// rankSimilar returns the candidates resembling target, closest first. Candidates match when
+// they are equal, differ only in case, contain or are contained in the target, or are within
+// a small edit distance of it.
+func rankSimilar(target string, candidates []string) []similarValue {
+	lowerTarget := strings.ToLower(target)
+	maxDistance := max(1, len(target)/3)
+
+	var matches []similarValue
+	for _, candidate := range candidates {
+		lower := strings.ToLower(candidate)
+		distance := editDistance(lowerTarget, lower)
+		switch {
+		case candidate == target:
+			matches = append(matches, similarValue{candidate, "exact", 0})
+		case lower == lowerTarget:
+			matches = append(matches, similarValue{candidate, "case", 0})
+		case len(lowerTarget) >= 3 && (strings.Contains(lower, lowerTarget) || strings.Contains(lowerTarget, lower)):
+			matches = append(matches, similarValue{candidate, "substring", distance})
+		case distance <= maxDistance:
+			matches = append(matches, similarValue{candidate, "fuzzy", distance})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		if matchRank[matches[i].Match] != matchRank[matches[j].Match] {
+			return matchRank[matches[i].Match] < matchRank[matches[j].Match]
+		}
+		return matches[i].Value < matches[j].Value
+	})
+	return matches
+}
+
+// similarStrings returns up to maxSuggestions candidates resembling target other than target itself
+func similarStrings(target string, candidates []string) []string {
+	var similar []string
+	for _, match := range rankSimilar(target, candidates) {
+		if match.Match == "exact" {
+			continue
+		}
+		if len(similar) == maxSuggestions {
+			break
+		}
+		similar = append(similar, match.Value)
+	}
+	return similar
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// emptyQueryLokiClient returns no logs for every query and serves canned label values
+type emptyQueryLokiClient struct {
+	fakeLokiClient
+	values map[string][]string
+}
+
+func (f *emptyQueryLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	return &LokiResult{Status: "success"}, nil
+}
+
+func (f *emptyQueryLokiClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	return &LokiLabelValuesResult{Status: "success", Data: f.values[label]}, nil
+}
+
+// TestSimilarStrings tests matching candidates by case, containment and edit distance
+func TestSimilarStrings(t *testing.T) {
+	candidates := []string{"payments", "payment-api", "Payment", "checkout", "auth"}
+	similar := similarStrings("payment", candidates)
+	expected := []string{"Payment", "payments", "payment-api"}
+	if strings.Join(similar, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, but got %v", expected, similar)
+	}
+	if similar := similarStrings("zzz", candidates); len(similar) != 0 {
+		t.Errorf("Expected no similar strings, but got %v", similar)
+	}
+}
+
+// TestEditDistance tests the Levenshtein distance
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"api", "api", 0},
+		{"api", "apis", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, tc := range testCases {
+		if d := editDistance(tc.a, tc.b); d != tc.expected {
+			t.Errorf("Expected distance %d between %q and %q, but got %d", tc.expected, tc.a, tc.b, d)
+		}
+	}
+}
+
+// TestHandleLokiQuery_Suggest tests suggesting selector corrections when a query returns no logs
+func TestHandleLokiQuery_Suggest(t *testing.T) {
+	fake := &emptyQueryLokiClient{
+		fakeLokiClient: fakeLokiClient{labels: []string{"app", "service_name", "namespace"}},
+		values: map[string][]string{
+			"app":          {"payments", "checkout"},
+			"service_name": {"payment-api"},
+			"namespace":    {"prod"},
+		},
+	}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="payment", namespace="prod"}`, "suggest": true}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("Expected the result and suggestions, but got %d content items", len(result.Content))
+	}
+	expected := `no streams with app="payment"; did you mean app="payments" or service_name="payment-api"?`
+	if text := result.Content[1].(mcp.TextContent).Text; !strings.Contains(text, expected) {
+		t.Errorf("Expected %s in the suggestions, but got %s", expected, text)
+	}
+	if suggestions, ok := result.Meta["suggestions"].([]string); !ok || len(suggestions) != 1 {
+		t.Errorf("Expected one suggestion in the metadata, but got %v", result.Meta["suggestions"])
+	}
+
+	// A label that does not exist is matched against the known label names
+	request.Params.Arguments = map[string]any{"query": `{service="checkout"}`, "suggest": true}
+	result, err = HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[1].(mcp.TextContent).Text; !strings.Contains(text, `app="checkout"`) {
+		t.Errorf("Expected app=\"checkout\" to be suggested, but got %s", text)
+	}
+
+	// Suggestions are off by default
+	request.Params.Arguments = map[string]any{"query": `{app="payment"}`}
+	result, err = HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(result.Content) != 1 {
+		t.Errorf("Expected no suggestions by default, but got %d content items", len(result.Content))
+	}
+}
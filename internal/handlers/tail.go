@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Tail polling and buffering limits
+const (
+	defaultTailInterval = 2 * time.Second
+	minTailInterval     = time.Second
+	defaultTailBuffer   = 1000
+	maxTailBuffer       = 10000
+	tailPollLimit       = 1000
+	tailIdleTimeout     = 10 * time.Minute // tails not read for this long are stopped
+	maxTails            = 20
+)
+
+// What a tail does when its buffer is full
+const (
+	TailDropOldest = "drop_oldest" // keep polling, dropping the oldest buffered lines
+	TailPause      = "pause"       // stop polling until lines are read, resuming where it stopped
+)
+
+// tailEntry is a log line buffered by a tail
+type tailEntry struct {
+	labels map[string]string
+	value  []string
+}
+
+// tail follows a log query, buffering new lines until its client reads them
+type tail struct {
+	ID         string
+	Query      string
+	Interval   time.Duration
+	BufferSize int
+	Overflow   string
+	conn       LokiConnection
+	sessionID  string // session that started the tail, the only one that may read it
+	cancel     context.CancelFunc
+
+	mu           sync.Mutex
+	buffer       []tailEntry
+	cursor       int64 // timestamp in nanoseconds of the newest line fetched
+	received     int   // lines fetched in total
+	dropped      int   // lines dropped in total
+	droppedSince int   // lines dropped since the last read
+	paused       bool
+	lastRead     time.Time
+	lastError    string
+}
+
+// tailStore holds the active tails keyed by ID
+type tailStore struct {
+	mu     sync.Mutex
+	tails  map[string]*tail
+	nextID int
+}
+
+var tails = &tailStore{tails: make(map[string]*tail)}
+
+// add registers a tail and starts polling it with the caller's access scope and credentials
+func (s *tailStore) add(ctx context.Context, t *tail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.tails) >= maxTails {
+		return fmt.Errorf("too many tails (maximum %d); stop one with loki_tail_stop first", maxTails)
+	}
+	s.nextID++
+	t.ID = fmt.Sprintf("tail-%d", s.nextID)
+
+	ctx, cancel := context.WithCancel(detachedCallerContext(ctx))
+	t.cancel = cancel
+	s.tails[t.ID] = t
+	go t.run(ctx)
+	return nil
+}
+
+// get returns a tail started by the session, if any
+func (s *tailStore) get(id, sessionID string) (*tail, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tails[id]
+	if !ok || t.sessionID != sessionID {
+		return nil, false
+	}
+	return t, true
+}
+
+// remove stops and deletes a tail
+func (s *tailStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tails[id]; ok {
+		t.cancel()
+		delete(s.tails, id)
+	}
+}
+
+// StopTails stops polling all tails, for use at server shutdown
+func StopTails() {
+	tails.mu.Lock()
+	defer tails.mu.Unlock()
+	for id, t := range tails.tails {
+		t.cancel()
+		delete(tails.tails, id)
+	}
+}
+
+// NewLokiTailStartTool creates and returns a tool for following a log query
+func NewLokiTailStartTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Follow a log query like tail -f: the server polls Loki for new lines and buffers them for this " +
+			"session until they are read with loki_tail_read. The buffer is bounded, so a log flood doesn't grow server " +
+			"memory when lines are read slowly: when it is full, the oldest lines are dropped and counted, or polling pauses " +
+			"until lines are read. Stop following with loki_tail_stop; tails not read for 10 minutes are stopped."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL log query to follow, e.g. {app=\"api\"} |= \"error\""),
+		),
+		mcp.WithNumber("buffer",
+			mcp.Description(fmt.Sprintf("Maximum number of lines buffered until they are read, at most %d (default: %d)", maxTailBuffer, defaultTailBuffer)),
+		),
+		mcp.WithString("overflow",
+			mcp.Description("What to do when the buffer is full: drop_oldest keeps the newest lines and counts those dropped, "+
+				"pause stops polling until lines are read and then resumes where it stopped, so no line is lost (default: drop_oldest)"),
+			mcp.Enum(TailDropOldest, TailPause),
+		),
+		mcp.WithString("interval",
+			mcp.Description("How often to poll for new lines, at least 1s (default: 2s)"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_tail_start", opts...)
+}
+
+// NewLokiTailReadTool creates and returns a tool for reading the lines buffered by a tail
+func NewLokiTailReadTool() mcp.Tool {
+	return mcp.NewTool("loki_tail_read",
+		mcp.WithDescription("Read and remove the lines buffered by a tail started with loki_tail_start, oldest first, "+
+			"with the number of lines dropped since the last read"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the tail, e.g. tail-1"),
+		),
+		mcp.WithNumber("max_lines",
+			mcp.Description("Maximum number of lines to read; the rest stay buffered (default: all)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, text, or ndjson (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// NewLokiTailStopTool creates and returns a tool for stopping a tail
+func NewLokiTailStopTool() mcp.Tool {
+	return mcp.NewTool("loki_tail_stop",
+		mcp.WithDescription("Stop a tail started with loki_tail_start, discarding the lines it buffered"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the tail, e.g. tail-1"),
+		),
+	)
+}
+
+// HandleLokiTailStart handles Loki tail start tool requests
+func HandleLokiTailStart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	query, _ := args["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	query = applySessionSelector(ctx, query)
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return nil, fmt.Errorf("only log queries can be followed, not metric queries")
+	}
+
+	bufferSize := defaultTailBuffer
+	if size, ok := args["buffer"].(float64); ok {
+		if size < 1 || size > maxTailBuffer || size != math.Trunc(size) {
+			return nil, fmt.Errorf("buffer must be a whole number between 1 and %d", maxTailBuffer)
+		}
+		bufferSize = int(size)
+	}
+	overflow, _ := args["overflow"].(string)
+	switch overflow {
+	case "":
+		overflow = TailDropOldest
+	case TailDropOldest, TailPause:
+	default:
+		return nil, fmt.Errorf("unsupported overflow: %s. Supported values: drop_oldest, pause", overflow)
+	}
+	interval, err := durationArg(args, "interval", defaultTailInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval < minTailInterval {
+		return nil, fmt.Errorf("interval must be at least %s", minTailInterval)
+	}
+
+	t := &tail{
+		Query:      query,
+		Interval:   interval,
+		BufferSize: bufferSize,
+		Overflow:   overflow,
+		conn:       ResolveLokiConnection(args),
+		cursor:     time.Now().UnixNano(),
+		lastRead:   time.Now(),
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		t.sessionID = session.SessionID()
+	}
+
+	// Check the query up front so that invalid queries fail now rather than in the background
+	if _, err := runLokiQuery(ctx, t.conn, query, time.Now().Add(-time.Minute), time.Now(), 1); err != nil {
+		return nil, err
+	}
+	if err := tails.add(ctx, t); err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Started %s following %s, polled every %s. Read new lines with loki_tail_read "+
+		"(buffer: %d lines, overflow: %s)", t.ID, query, interval, bufferSize, overflow)), nil
+}
+
+// HandleLokiTailRead handles Loki tail read tool requests
+func HandleLokiTailRead(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	t, err := tailFromArgs(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	maxLines := 0
+	if n, ok := args["max_lines"].(float64); ok {
+		if n < 1 || n != math.Trunc(n) {
+			return nil, fmt.Errorf("max_lines must be a positive whole number")
+		}
+		maxLines = int(n)
+	}
+	format := formatArg(args)
+
+	read := t.read(maxLines)
+	var formattedResult string
+	if format == "ndjson" {
+		formattedResult, err = formatLokiNDJSON(read.result, "", nil)
+	} else {
+		formattedResult, err = formatLokiResults(read.result, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	toolResult := mcp.NewToolResultText(formattedResult)
+	if note := read.String(t); note != "" {
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(note))
+	}
+	toolResult.Meta = map[string]any{
+		"entry_count":   read.lines,
+		"remaining":     read.remaining,
+		"dropped":       read.dropped,
+		"dropped_total": read.droppedTotal,
+		"received":      read.received,
+		"paused":        read.paused,
+	}
+	return toolResult, nil
+}
+
+// HandleLokiTailStop handles Loki tail stop tool requests
+func HandleLokiTailStop(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	t, err := tailFromArgs(ctx, request.GetArguments())
+	if err != nil {
+		return nil, err
+	}
+	tails.remove(t.ID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return mcp.NewToolResultText(fmt.Sprintf("Stopped %s after %d lines, %d of them dropped, discarding %d unread lines",
+		t.ID, t.received, t.dropped, len(t.buffer))), nil
+}
+
+// tailFromArgs returns the tail named by the id argument, if the calling session started it
+func tailFromArgs(ctx context.Context, args map[string]any) (*tail, error) {
+	id, _ := args["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	sessionID := ""
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+	t, ok := tails.get(id, sessionID)
+	if !ok {
+		return nil, fmt.Errorf("tail %s not found", id)
+	}
+	return t, nil
+}
+
+// run polls the tail until its context is cancelled or it is no longer read
+func (t *tail) run(ctx context.Context) {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if t.idle() {
+				slog.Info("stopping unread tail", "tail", t.ID, "idle", tailIdleTimeout)
+				tails.remove(t.ID)
+				return
+			}
+			pollCtx, cancel := context.WithTimeout(ctx, t.Interval)
+			t.poll(pollCtx)
+			cancel()
+		}
+	}
+}
+
+// idle reports whether the tail has not been read for tailIdleTimeout
+func (t *tail) idle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.lastRead) > tailIdleTimeout
+}
+
+// poll fetches the lines after the cursor and buffers them. In pause mode, it fetches no more
+// lines than the buffer has room for, and none while it is full.
+func (t *tail) poll(ctx context.Context) {
+	t.mu.Lock()
+	limit := tailPollLimit
+	if t.Overflow == TailPause {
+		limit = min(limit, t.BufferSize-len(t.buffer))
+		t.paused = limit == 0
+	}
+	cursor := t.cursor
+	t.mu.Unlock()
+	if limit == 0 {
+		return
+	}
+
+	result, err := runLokiQuery(withQueryDirection(ctx, DirectionForward), t.conn, t.Query, time.Unix(0, cursor+1), time.Now(), limit)
+	if ctx.Err() != nil && err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.lastError = err.Error()
+		return
+	}
+	t.lastError = ""
+	for _, entry := range sortedLogEntries(result) {
+		t.buffer = append(t.buffer, tailEntry{labels: entry.Labels, value: []string{strconv.FormatInt(entry.NS, 10), entry.Line}})
+		t.cursor = max(t.cursor, entry.NS)
+		t.received++
+	}
+	if excess := len(t.buffer) - t.BufferSize; excess > 0 {
+		t.buffer = append(t.buffer[:0:0], t.buffer[excess:]...)
+		t.dropped += excess
+		t.droppedSince += excess
+	}
+}
+
+// tailRead is the outcome of reading a tail's buffer
+type tailRead struct {
+	result       *LokiResult
+	lines        int
+	remaining    int
+	dropped      int // since the previous read
+	droppedTotal int
+	received     int
+	paused       bool
+	lastError    string
+}
+
+// read removes up to maxLines of the oldest buffered lines, or all of them when maxLines is 0
+func (t *tail) read(maxLines int) tailRead {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.buffer)
+	if maxLines > 0 {
+		n = min(n, maxLines)
+	}
+	entries := t.buffer[:n]
+	t.buffer = append(t.buffer[:0:0], t.buffer[n:]...)
+
+	read := tailRead{
+		result:       &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}},
+		lines:        n,
+		remaining:    len(t.buffer),
+		dropped:      t.droppedSince,
+		droppedTotal: t.dropped,
+		received:     t.received,
+		paused:       t.paused,
+		lastError:    t.lastError,
+	}
+	streams := make(map[string]int)
+	for _, entry := range entries {
+		key := formatStreamLabels(entry.labels)
+		i, ok := streams[key]
+		if !ok {
+			i = len(read.result.Data.Result)
+			streams[key] = i
+			read.result.Data.Result = append(read.result.Data.Result, LokiEntry{Stream: entry.labels})
+		}
+		read.result.Data.Result[i].Values = append(read.result.Data.Result[i].Values, entry.value)
+	}
+	t.droppedSince, t.paused = 0, false
+	t.lastRead = time.Now()
+	return read
+}
+
+// String describes dropped lines, pauses and errors for the tool result
+func (r tailRead) String(t *tail) string {
+	var notes []string
+	if r.remaining > 0 {
+		notes = append(notes, fmt.Sprintf("%d more lines are buffered", r.remaining))
+	}
+	if r.dropped > 0 {
+		notes = append(notes, fmt.Sprintf("Dropped %d of the oldest lines since the last read because the buffer of %d lines was full "+
+			"(%d dropped in total); read more often, use a bigger buffer, or overflow pause", r.dropped, t.BufferSize, r.droppedTotal))
+	}
+	if r.paused {
+		notes = append(notes, fmt.Sprintf("Polling paused because the buffer of %d lines was full; it resumes now that lines were read", t.BufferSize))
+	}
+	if r.lastError != "" {
+		notes = append(notes, "Last poll failed: "+r.lastError)
+	}
+	return strings.Join(notes, "\n")
+}
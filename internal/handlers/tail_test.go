@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newTailTestServer returns a Loki server answering each query with up to flood new lines after its start
+func newTailTestServer(t *testing.T, flood *atomic.Int64) *httptest.Server {
+	t.Helper()
+	next := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, _, _ := parseLokiTimestamp(q.Get("start"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		var values []string
+		for i := range min(int(flood.Load()), limit) {
+			next++
+			values = append(values, fmt.Sprintf(`["%d", "line %d"]`, start.UnixNano()+int64(i), next))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[%s]}]}}`, strings.Join(values, ","))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// startTestTail starts a tail that only polls when the test calls poll
+func startTestTail(t *testing.T, url string, args map[string]any) *tail {
+	t.Helper()
+	t.Cleanup(StopTails)
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": url, "interval": "1h"}
+	for k, v := range args {
+		request.Params.Arguments.(map[string]any)[k] = v
+	}
+	result, err := HandleLokiTailStart(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	id := strings.Fields(result.Content[0].(mcp.TextContent).Text)[1]
+	tl, ok := tails.get(id, "")
+	if !ok {
+		t.Fatalf("Expected tail %s to be registered", id)
+	}
+	return tl
+}
+
+// readTestTail reads a tail with loki_tail_read
+func readTestTail(t *testing.T, id string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"id": id}
+	for k, v := range args {
+		request.Params.Arguments.(map[string]any)[k] = v
+	}
+	result, err := HandleLokiTailRead(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return result
+}
+
+// TestTail_DropOldest tests that a flood keeps the buffer bounded, dropping and counting the oldest lines
+func TestTail_DropOldest(t *testing.T) {
+	var flood atomic.Int64
+	server := newTailTestServer(t, &flood)
+	tl := startTestTail(t, server.URL, map[string]any{"buffer": float64(10)})
+
+	flood.Store(25)
+	tl.poll(context.Background())
+	if len(tl.buffer) != 10 {
+		t.Fatalf("Expected 10 buffered lines, but got %d", len(tl.buffer))
+	}
+
+	result := readTestTail(t, tl.ID, map[string]any{"max_lines": float64(4)})
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "line 16") || !strings.Contains(text, "line 19") || strings.Contains(text, "line 15") || strings.Contains(text, "line 20") {
+		t.Errorf("Expected lines 16 to 19, but got %s", text)
+	}
+	note := result.Content[1].(mcp.TextContent).Text
+	if !strings.Contains(note, "6 more lines are buffered") || !strings.Contains(note, "Dropped 15 of the oldest lines") {
+		t.Errorf("Unexpected note: %s", note)
+	}
+	if result.Meta["dropped"] != 15 || result.Meta["dropped_total"] != 15 || result.Meta["remaining"] != 6 || result.Meta["received"] != 25 {
+		t.Errorf("Unexpected metadata: %v", result.Meta)
+	}
+
+	// Drops are counted once per read, and polling continues from the newest line fetched
+	flood.Store(2)
+	tl.poll(context.Background())
+	result = readTestTail(t, tl.ID, nil)
+	if result.Meta["dropped"] != 0 || result.Meta["entry_count"] != 8 || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "line 27") {
+		t.Errorf("Unexpected read: %v %v", result.Content, result.Meta)
+	}
+}
+
+// TestTail_Pause tests that polling pauses while the buffer is full and loses no lines
+func TestTail_Pause(t *testing.T) {
+	var flood atomic.Int64
+	server := newTailTestServer(t, &flood)
+	tl := startTestTail(t, server.URL, map[string]any{"buffer": float64(10), "overflow": TailPause})
+
+	flood.Store(25)
+	tl.poll(context.Background())
+	tl.poll(context.Background())
+	if len(tl.buffer) != 10 || !tl.paused || tl.dropped != 0 {
+		t.Fatalf("Expected a full, paused buffer without drops, but got %d lines, paused %v, %d dropped", len(tl.buffer), tl.paused, tl.dropped)
+	}
+	result := readTestTail(t, tl.ID, map[string]any{"max_lines": float64(5)})
+	if result.Meta["paused"] != true || !strings.Contains(result.Content[1].(mcp.TextContent).Text, "Polling paused") {
+		t.Errorf("Expected the pause to be reported, but got %v", result.Content)
+	}
+
+	// Only as many lines as there is room for are fetched after a read
+	tl.poll(context.Background())
+	if len(tl.buffer) != 10 || tl.received != 15 {
+		t.Errorf("Expected the buffer to be refilled with 5 lines, but got %d buffered and %d received", len(tl.buffer), tl.received)
+	}
+}
+
+// TestTail_Stop tests stopping a tail and rejecting unknown tails and invalid arguments
+func TestTail_Stop(t *testing.T) {
+	var flood atomic.Int64
+	server := newTailTestServer(t, &flood)
+	tl := startTestTail(t, server.URL, nil)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"id": tl.ID}
+	if _, err := HandleLokiTailStop(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := HandleLokiTailStop(context.Background(), request); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, but got %v", err)
+	}
+
+	invalid := map[string]map[string]any{
+		"only log queries can be followed": {"query": `rate({app="api"}[1m])`},
+		"buffer must be a whole number":    {"query": `{app="api"}`, "buffer": float64(maxTailBuffer + 1)},
+		"unsupported overflow: block":      {"query": `{app="api"}`, "overflow": "block"},
+		"interval must be at least 1s":     {"query": `{app="api"}`, "interval": "100ms"},
+	}
+	for expected, args := range invalid {
+		request.Params.Arguments = args
+		args["url"] = server.URL
+		if _, err := HandleLokiTailStart(context.Background(), request); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q, but got %v", expected, err)
+		}
+	}
+}
+
+func TestTailPollsWithCallerScope(t *testing.T) {
+	t.Cleanup(StopTails)
+	queries := make(chan string, 10)
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case queries <- r.URL.Query().Get("query"):
+		default:
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	ctx := context.WithValue(context.Background(), accessScopeKey{}, &AccessRole{Labels: map[string]string{"namespace": "team-a-.*"}})
+	tl := &tail{
+		Query:      `{app="api"}`,
+		Interval:   10 * time.Millisecond,
+		BufferSize: defaultTailBuffer,
+		Overflow:   TailDropOldest,
+		conn:       LokiConnection{URL: loki.URL},
+		cursor:     time.Now().UnixNano(),
+		lastRead:   time.Now(),
+	}
+	if err := tails.add(ctx, tl); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	select {
+	case query := <-queries:
+		if !strings.Contains(query, `namespace=~"team-a-.*"`) {
+			t.Errorf("Expected the poll to be scoped to team-a, but got %s", query)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the tail to poll Loki")
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for how far back queries may reach, e.g. 30d (default: unlimited)
+const EnvLokiMaxLookback = "LOKI_MAX_LOOKBACK"
+
+// Environment variable name for the widest time window a single query may cover, e.g. 7d (default: unlimited)
+const EnvLokiMaxRange = "LOKI_MAX_RANGE"
+
+// Environment variable name for how requests exceeding LOKI_MAX_LOOKBACK or LOKI_MAX_RANGE are handled
+const EnvLokiRangeLimitMode = "LOKI_RANGE_LIMIT_MODE"
+
+// Range limit modes: reject the request with an error, or clamp its start time and warn
+const (
+	RangeLimitReject = "reject"
+	RangeLimitClamp  = "clamp"
+)
+
+// sinceOption returns the tool option for a start time relative to now
+func sinceOption() mcp.ToolOption {
+	return mcp.WithString("since",
+		mcp.Description("Start the query this long before now, e.g. 2h or 7d. Alternative to start"),
+	)
+}
+
+// untilOption returns the tool option for an end time relative to now
+func untilOption() mcp.ToolOption {
+	return mcp.WithString("until",
+		mcp.Description("End the query this long before now, e.g. 30m. Alternative to end"),
+	)
+}
+
+// parseRelativeDuration parses a duration such as 30m, 2h, 7d or 2w.
+// Days and weeks are supported in addition to the units of time.ParseDuration.
+func parseRelativeDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration: %s", value)
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// relativeTimeArg resolves a since or until argument to a time before now
+func relativeTimeArg(args map[string]any, name string, now time.Time) (time.Time, bool, error) {
+	value, ok := args[name].(string)
+	if !ok || value == "" {
+		return time.Time{}, false, nil
+	}
+	d, err := parseRelativeDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid %s: %s (use a duration such as 30m, 2h or 7d)", name, value)
+	}
+	return now.Add(-d), true, nil
+}
+
+// checkTimeLimits rejects time ranges starting further back than LOKI_MAX_LOOKBACK or
+// spanning more than LOKI_MAX_RANGE. In clamp mode the range is left for enforceTimeLimits
+// to narrow when the request is sent.
+func checkTimeLimits(start, end, now time.Time) error {
+	cfg := CurrentConfig()
+	if cfg.RangeLimitMode == RangeLimitClamp {
+		return nil
+	}
+	_, reason := limitTimeRange(cfg, start, end, now)
+	if reason != "" {
+		return fmt.Errorf("%s", reason)
+	}
+	return nil
+}
+
+// limitTimeRange returns the latest start time allowed for the range by the configured
+// limits, together with the reason it had to move. The reason is empty when the range is allowed.
+func limitTimeRange(cfg *Config, start, end, now time.Time) (time.Time, string) {
+	var reason string
+	if cfg.MaxLookback > 0 && start.Before(now.Add(-cfg.MaxLookback)) {
+		reason = fmt.Sprintf("start time %s is further back than the maximum lookback of %s (%s)",
+			start.UTC().Format(time.RFC3339), formatLogQLDuration(cfg.MaxLookback), EnvLokiMaxLookback)
+		start = now.Add(-cfg.MaxLookback)
+	}
+	if cfg.MaxRange > 0 && end.Sub(start) > cfg.MaxRange {
+		if reason == "" {
+			reason = fmt.Sprintf("time range of %s exceeds the maximum range of %s (%s)",
+				formatLogQLDuration(end.Sub(start).Round(time.Second)), formatLogQLDuration(cfg.MaxRange), EnvLokiMaxRange)
+		}
+		start = end.Add(-cfg.MaxRange)
+	}
+	return start, reason
+}
+
+// enforceTimeLimits applies LOKI_MAX_LOOKBACK and LOKI_MAX_RANGE to the start and end
+// parameters of a Loki API URL. Depending on LOKI_RANGE_LIMIT_MODE, offending requests are
+// rejected, or their start time is moved forward and a warning is added to the tool result.
+func enforceTimeLimits(ctx context.Context, requestURL string) (string, error) {
+	cfg := CurrentConfig()
+	if cfg.MaxLookback <= 0 && cfg.MaxRange <= 0 {
+		return requestURL, nil
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	start, nanos, ok := parseLokiTimestamp(q.Get("start"))
+	if !ok {
+		return requestURL, nil
+	}
+	now := time.Now()
+	end := now
+	if t, _, ok := parseLokiTimestamp(q.Get("end")); ok {
+		end = t
+	}
+
+	limited, reason := limitTimeRange(cfg, start, end, now)
+	if reason == "" {
+		return requestURL, nil
+	}
+	if cfg.RangeLimitMode != RangeLimitClamp {
+		return "", &PolicyViolationError{Reason: reason}
+	}
+	if !limited.Before(end) {
+		return "", &PolicyViolationError{Reason: fmt.Sprintf("time range ends at %s, outside the maximum lookback of %s (%s)",
+			end.UTC().Format(time.RFC3339), formatLogQLDuration(cfg.MaxLookback), EnvLokiMaxLookback)}
+	}
+
+	addWarning(ctx, fmt.Sprintf("%s; the query was narrowed to start at %s", reason, limited.UTC().Format(time.RFC3339)))
+	if nanos {
+		q.Set("start", strconv.FormatInt(limited.UnixNano(), 10))
+	} else {
+		q.Set("start", strconv.FormatInt(limited.Unix(), 10))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// parseLokiTimestamp parses a start or end URL parameter given in Unix seconds or nanoseconds,
+// reporting whether it was in nanoseconds
+func parseLokiTimestamp(value string) (time.Time, bool, bool) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	// Seconds would not reach 1e12 until the year 33658
+	if n > 1e12 {
+		return time.Unix(0, n), true, true
+	}
+	return time.Unix(n, 0), false, true
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestParseRelativeDuration tests durations with day and week units
+func TestParseRelativeDuration(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"30m":  30 * time.Minute,
+		"2h":   2 * time.Hour,
+		"7d":   7 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+	}
+	for input, expected := range testCases {
+		d, err := parseRelativeDuration(input)
+		if err != nil || d != expected {
+			t.Errorf("Expected %s for %s, but got %s (%v)", expected, input, d, err)
+		}
+	}
+	if _, err := parseRelativeDuration("xd"); err == nil {
+		t.Error("Expected an error for xd")
+	}
+}
+
+// TestParseTimeRange_SinceUntil tests the relative since and until parameters
+func TestParseTimeRange_SinceUntil(t *testing.T) {
+	start, end, err := parseTimeRange(map[string]any{"since": "2h", "until": "30m"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if window := end.Sub(start); window != 90*time.Minute {
+		t.Errorf("Expected a 90m window, but got %s", window)
+	}
+	if ago := time.Since(end); ago < 29*time.Minute || ago > 31*time.Minute {
+		t.Errorf("Expected the window to end 30m ago, but it ended %s ago", ago)
+	}
+
+	// since takes precedence over start
+	start, _, err = parseTimeRange(map[string]any{"start": "2020-01-01T00:00:00Z", "since": "1h"}, time.Hour)
+	if err != nil || time.Since(start) > 61*time.Minute {
+		t.Errorf("Expected since to override start, but got %s (%v)", start, err)
+	}
+
+	if _, _, err := parseTimeRange(map[string]any{"since": "30m", "until": "1h"}, time.Hour); err == nil {
+		t.Error("Expected an error for an empty window")
+	}
+	if _, _, err := parseTimeRange(map[string]any{"since": "yesterday"}, time.Hour); err == nil {
+		t.Error("Expected an error for an invalid since")
+	}
+}
+
+// TestParseTimeRange_MaxLookback tests rejecting windows beyond LOKI_MAX_LOOKBACK
+func TestParseTimeRange_MaxLookback(t *testing.T) {
+	setenv(t, EnvLokiMaxLookback, "7d")
+
+	if _, _, err := parseTimeRange(map[string]any{"since": "6d"}, time.Hour); err != nil {
+		t.Errorf("Expected 6d to be allowed, but got %v", err)
+	}
+	_, _, err := parseTimeRange(map[string]any{"since": "8d"}, time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "maximum lookback") {
+		t.Errorf("Expected a maximum lookback error, but got %v", err)
+	}
+}
+
+// TestParseTimeRange_MaxRange tests rejecting windows wider than LOKI_MAX_RANGE
+func TestParseTimeRange_MaxRange(t *testing.T) {
+	setenv(t, EnvLokiMaxRange, "1d")
+
+	if _, _, err := parseTimeRange(map[string]any{"since": "30d", "until": "29.5d"}, time.Hour); err != nil {
+		t.Errorf("Expected a 12h window to be allowed, but got %v", err)
+	}
+	_, _, err := parseTimeRange(map[string]any{"since": "2d"}, time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "maximum range") {
+		t.Errorf("Expected a maximum range error, but got %v", err)
+	}
+
+	// In clamp mode the range is narrowed when the request is sent instead
+	setenv(t, EnvLokiRangeLimitMode, "clamp")
+	if _, _, err := parseTimeRange(map[string]any{"since": "2d"}, time.Hour); err != nil {
+		t.Errorf("Expected no error in clamp mode, but got %v", err)
+	}
+}
+
+// TestEnforceTimeLimits_Reject tests rejecting requests beyond the limits at the API level
+func TestEnforceTimeLimits_Reject(t *testing.T) {
+	setenv(t, EnvLokiMaxRange, "1d")
+
+	now := time.Now()
+	requestURL := fmt.Sprintf("http://loki/loki/api/v1/query_range?query=%%7Bapp%%3D%%22x%%22%%7D&start=%d&end=%d",
+		now.Add(-48*time.Hour).UnixNano(), now.UnixNano())
+	_, err := enforceTimeLimits(context.Background(), requestURL)
+	var violation *PolicyViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("Expected a policy violation, but got %v", err)
+	}
+
+	allowed := fmt.Sprintf("http://loki/loki/api/v1/labels?start=%d&end=%d", now.Add(-time.Hour).Unix(), now.Unix())
+	if got, err := enforceTimeLimits(context.Background(), allowed); err != nil || got != allowed {
+		t.Errorf("Expected the URL to be unchanged, but got %s, %v", got, err)
+	}
+}
+
+// TestEnforceTimeLimits_Clamp tests narrowing requests beyond the limits with a warning
+func TestEnforceTimeLimits_Clamp(t *testing.T) {
+	setenv(t, EnvLokiMaxLookback, "7d")
+	setenv(t, EnvLokiMaxRange, "1d")
+	setenv(t, EnvLokiRangeLimitMode, "clamp")
+
+	now := time.Now()
+	var got string
+	handler := WarningsMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var err error
+		got, err = enforceTimeLimits(ctx, fmt.Sprintf("http://loki/loki/api/v1/labels?start=%d&end=%d",
+			now.Add(-30*24*time.Hour).Unix(), now.Add(-2*24*time.Hour).Unix()))
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	u, _ := url.Parse(got)
+	start, nanos, _ := parseLokiTimestamp(u.Query().Get("start"))
+	if nanos {
+		t.Errorf("Expected the start time to stay in seconds, but got %s", u.Query().Get("start"))
+	}
+	if expected := now.Add(-3 * 24 * time.Hour).Unix(); start.Unix() != expected {
+		t.Errorf("Expected start to be clamped to %d, but got %d", expected, start.Unix())
+	}
+	if len(result.Content) != 2 || !strings.Contains(result.Content[1].(mcp.TextContent).Text, "maximum lookback") {
+		t.Errorf("Expected a maximum lookback warning, but got %v", result.Content)
+	}
+
+	// A range ending before the maximum lookback cannot be narrowed
+	_, err = enforceTimeLimits(context.Background(), fmt.Sprintf("http://loki/loki/api/v1/labels?start=%d&end=%d",
+		now.Add(-30*24*time.Hour).Unix(), now.Add(-20*24*time.Hour).Unix()))
+	if err == nil {
+		t.Error("Expected an error for a range entirely outside the maximum lookback")
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+)
+
+// Environment variable name for the comma-separated tools to register, e.g. loki_query,loki_label_*
+const EnvLokiEnabledTools = "LOKI_ENABLED_TOOLS"
+
+// Environment variable name for the comma-separated tools not to register, e.g. loki_label_values
+const EnvLokiDisabledTools = "LOKI_DISABLED_TOOLS"
+
+// ToolEnabled reports whether a tool should be registered. When LOKI_ENABLED_TOOLS is set only
+// matching tools are enabled, and tools matching LOKI_DISABLED_TOOLS are always disabled.
+// Both lists accept glob patterns.
+func ToolEnabled(name string) bool {
+	cfg := CurrentConfig()
+	if enabled := cfg.EnabledTools; strings.TrimSpace(enabled) != "" && !matchesToolList(name, enabled) {
+		return false
+	}
+	return !matchesToolList(name, cfg.DisabledTools)
+}
+
+// matchesToolList reports whether a tool name matches any pattern in a comma-separated list
+func matchesToolList(name, list string) bool {
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
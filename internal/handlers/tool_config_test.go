@@ -0,0 +1,29 @@
+package handlers
+
+import "testing"
+
+// TestToolEnabled tests enabling and disabling tools with names and glob patterns
+func TestToolEnabled(t *testing.T) {
+	if !ToolEnabled("loki_query") {
+		t.Error("Expected tools to be enabled by default")
+	}
+
+	setenv(t, EnvLokiDisabledTools, "loki_label_values, loki_push*")
+	if ToolEnabled("loki_label_values") || ToolEnabled("loki_push_logs") {
+		t.Error("Expected disabled tools to be disabled")
+	}
+	if !ToolEnabled("loki_label_names") {
+		t.Error("Expected loki_label_names to stay enabled")
+	}
+
+	setenv(t, EnvLokiEnabledTools, "loki_query,loki_label_*")
+	if !ToolEnabled("loki_query") || !ToolEnabled("loki_label_names") {
+		t.Error("Expected allow-listed tools to be enabled")
+	}
+	if ToolEnabled("loki_cardinality") {
+		t.Error("Expected tools missing from the allow list to be disabled")
+	}
+	if ToolEnabled("loki_label_values") {
+		t.Error("Expected the deny list to win over the allow list")
+	}
+}
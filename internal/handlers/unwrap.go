@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// invalidLabelChars matches characters Loki replaces with underscores when extracting labels
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// unwrapQuerySpec describes an unwrapped range aggregation to generate
+type unwrapQuerySpec struct {
+	Selector   string
+	Function   string
+	Quantile   float64
+	Parser     string
+	Field      string
+	Conversion string // "", "duration" or "bytes"
+	Range      time.Duration
+	By         []string
+}
+
+// unwrapSeries is a single series of an unwrapped metric query result
+type unwrapSeries struct {
+	Labels string         `json:"labels"`
+	Values []unwrapSample `json:"values"`
+}
+
+// unwrapSample is a single timestamped value
+type unwrapSample struct {
+	Time  string  `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// unwrapReport is the result of an unwrapped metric query
+type unwrapReport struct {
+	Query  string         `json:"query"`
+	Series []unwrapSeries `json:"series"`
+}
+
+// NewLokiUnwrapQueryTool creates and returns a tool for building and running unwrapped range aggregations
+func NewLokiUnwrapQueryTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Compute a statistic (quantile, average, sum, min, max, standard deviation, rate) of a numeric " +
+			"field extracted from log lines. The LogQL unwrap query is generated for you, and the field is validated " +
+			"against the fields Loki detects in the selected logs."),
+		mcp.WithString("selector",
+			mcp.Required(),
+			mcp.Description("Stream selector, optionally with filters, e.g. {app=\"api\"} |= \"GET\""),
+		),
+		mcp.WithString("field",
+			mcp.Required(),
+			mcp.Description("Numeric field to unwrap, e.g. duration or http.status (nested fields are flattened with underscores)"),
+		),
+		mcp.WithString("function",
+			mcp.Description("Range aggregation to apply (default: quantile_over_time)"),
+			mcp.Enum("quantile_over_time", "avg_over_time", "sum_over_time", "min_over_time", "max_over_time", "stddev_over_time", "rate"),
+		),
+		mcp.WithNumber("quantile",
+			mcp.Description("Quantile for quantile_over_time between 0 and 1 (default: 0.95)"),
+		),
+		mcp.WithString("parser",
+			mcp.Description("Parser extracting the field: json or logfmt (default: detected by Loki)"),
+			mcp.Enum("json", "logfmt"),
+		),
+		mcp.WithString("range",
+			mcp.Description("Range window of the aggregation, e.g. 5m (default: 5m)"),
+		),
+		mcp.WithString("by",
+			mcp.Description("Comma-separated labels to group the result by, e.g. route,method"),
+		),
+		mcp.WithBoolean("validate",
+			mcp.Description("Check that the field exists and is numeric using Loki's detected fields (default: true)"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the query (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the query (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+		chartOption(),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_unwrap_query", opts...)
+}
+
+// HandleLokiUnwrapQuery handles Loki unwrap query tool requests
+func HandleLokiUnwrapQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	selector, _ := args["selector"].(string)
+	if selector == "" {
+		return nil, fmt.Errorf("selector is required")
+	}
+	field, _ := args["field"].(string)
+	if field == "" {
+		return nil, fmt.Errorf("field is required")
+	}
+
+	spec := unwrapQuerySpec{
+		Selector: applySessionSelector(ctx, selector),
+		Function: "quantile_over_time",
+		Quantile: 0.95,
+		Field:    invalidLabelChars.ReplaceAllString(field, "_"),
+	}
+	if function, ok := args["function"].(string); ok && function != "" {
+		spec.Function = function
+	}
+	if quantile, ok := args["quantile"].(float64); ok {
+		spec.Quantile = quantile
+	}
+	spec.Parser, _ = args["parser"].(string)
+	if by, ok := args["by"].(string); ok && by != "" {
+		for _, label := range strings.Split(by, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				spec.By = append(spec.By, label)
+			}
+		}
+	}
+
+	var err error
+	spec.Range, err = durationArg(args, "range", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := parseTimeRange(args, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	format := formatArg(args)
+
+	conn := ResolveLokiConnection(args)
+
+	validate := true
+	if validateArg, ok := args["validate"].(bool); ok {
+		validate = validateArg
+	}
+	if validate {
+		detected, err := CurrentLokiClient().DetectedFields(ctx, conn, spec.Selector, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("detected fields query failed: %w", err)
+		}
+		if err := spec.resolveField(detected.Fields); err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := spec.build()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := runLokiMetricQuery(ctx, conn, query, start, end, spec.Range)
+	if err != nil {
+		return nil, err
+	}
+
+	report := unwrapReport{Query: query, Series: []unwrapSeries{}}
+	for _, series := range result.Data.Result {
+		s := unwrapSeries{Labels: formatStreamLabels(series.Metric)}
+		for _, sample := range series.samples() {
+			s.Values = append(s.Values, unwrapSample{Time: sample.Time.UTC().Format(time.RFC3339), Value: sample.Value})
+		}
+		report.Series = append(report.Series, s)
+	}
+
+	formattedResult, err := formatUnwrapReport(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	if chart, _ := args["chart"].(bool); chart {
+		return attachChart(mcp.NewToolResultText(formattedResult), metricChartSeries(result))
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// resolveField checks the field against Loki's detected fields, filling in the parser
+// and unit conversion from the detected metadata
+func (s *unwrapQuerySpec) resolveField(fields []LokiDetectedField) error {
+	var numeric []string
+	for _, f := range fields {
+		if f.numeric() {
+			numeric = append(numeric, f.Label)
+		}
+		if f.Label != s.Field {
+			continue
+		}
+		if !f.numeric() {
+			return fmt.Errorf("field %s has type %s and cannot be unwrapped", s.Field, f.Type)
+		}
+		if s.Parser == "" && len(f.Parsers) > 0 {
+			s.Parser = f.Parsers[0]
+		}
+		if f.Type == "duration" || f.Type == "bytes" {
+			s.Conversion = f.Type
+		}
+		return nil
+	}
+
+	if len(numeric) == 0 {
+		return fmt.Errorf("field %s was not detected in the selected logs, which contain no numeric fields", s.Field)
+	}
+	return fmt.Errorf("field %s was not detected in the selected logs. Numeric fields: %s", s.Field, strings.Join(numeric, ", "))
+}
+
+// build renders the LogQL unwrap query
+func (s unwrapQuerySpec) build() (string, error) {
+	if !labelNamePattern.MatchString(s.Field) {
+		return "", fmt.Errorf("invalid field name: %s", s.Field)
+	}
+	for _, label := range s.By {
+		if !labelNamePattern.MatchString(label) {
+			return "", fmt.Errorf("invalid label name in by: %s", label)
+		}
+	}
+
+	parser := s.Parser
+	if parser == "" {
+		parser = "logfmt"
+	}
+	if parser != "json" && parser != "logfmt" {
+		return "", fmt.Errorf("unsupported parser: %s. Supported parsers: json, logfmt", parser)
+	}
+
+	unwrap := s.Field
+	if s.Conversion != "" {
+		unwrap = fmt.Sprintf("%s(%s)", s.Conversion, s.Field)
+	}
+	inner := fmt.Sprintf(`%s | %s | unwrap %s | __error__="" [%s]`, s.Selector, parser, unwrap, formatLogQLDuration(s.Range))
+
+	var query string
+	switch s.Function {
+	case "quantile_over_time":
+		if s.Quantile < 0 || s.Quantile > 1 {
+			return "", fmt.Errorf("quantile must be between 0 and 1")
+		}
+		query = fmt.Sprintf("quantile_over_time(%s, %s)", strconv.FormatFloat(s.Quantile, 'g', -1, 64), inner)
+	case "avg_over_time", "sum_over_time", "min_over_time", "max_over_time", "stddev_over_time", "rate":
+		query = fmt.Sprintf("%s(%s)", s.Function, inner)
+	default:
+		return "", fmt.Errorf("unsupported function: %s", s.Function)
+	}
+
+	if len(s.By) > 0 {
+		query += fmt.Sprintf(" by (%s)", strings.Join(s.By, ", "))
+	}
+	return query, nil
+}
+
+// formatUnwrapReport formats the unwrapped metric query results into a readable string
+func formatUnwrapReport(report unwrapReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, series := range report.Series {
+			fmt.Fprintf(&b, "%s\n", series.Labels)
+			for _, v := range series.Values {
+				fmt.Fprintf(&b, "  %s %g\n", v.Time, v.Value)
+			}
+		}
+		return b.String(), nil
+
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "Query: %s\n\n", report.Query)
+		if len(report.Series) == 0 {
+			b.WriteString("No data returned\n")
+			return b.String(), nil
+		}
+		for i, series := range report.Series {
+			fmt.Fprintf(&b, "Series %d: %s\n", i+1, series.Labels)
+			for _, v := range series.Values {
+				fmt.Fprintf(&b, "  [%s] %g\n", v.Time, v.Value)
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestUnwrapQuerySpec_Build tests generation of unwrapped range aggregations
+func TestUnwrapQuerySpec_Build(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     unwrapQuerySpec
+		expected string
+	}{
+		{
+			name: "Quantile with duration conversion",
+			spec: unwrapQuerySpec{
+				Selector:   `{app="api"}`,
+				Function:   "quantile_over_time",
+				Quantile:   0.99,
+				Parser:     "logfmt",
+				Field:      "took",
+				Conversion: "duration",
+				Range:      5 * time.Minute,
+				By:         []string{"route"},
+			},
+			expected: `quantile_over_time(0.99, {app="api"} | logfmt | unwrap duration(took) | __error__="" [5m]) by (route)`,
+		},
+		{
+			name: "Average of JSON field",
+			spec: unwrapQuerySpec{
+				Selector: `{app="api"} |= "GET"`,
+				Function: "avg_over_time",
+				Parser:   "json",
+				Field:    "bytes_sent",
+				Range:    time.Hour,
+			},
+			expected: `avg_over_time({app="api"} |= "GET" | json | unwrap bytes_sent | __error__="" [1h])`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.spec.build()
+			if err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+			if query != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, query)
+			}
+		})
+	}
+}
+
+// TestUnwrapQuerySpec_BuildInvalid tests validation of the generated query parts
+func TestUnwrapQuerySpec_BuildInvalid(t *testing.T) {
+	base := unwrapQuerySpec{Selector: `{app="api"}`, Function: "quantile_over_time", Quantile: 0.5, Field: "took", Range: time.Minute}
+
+	spec := base
+	spec.Quantile = 1.5
+	if _, err := spec.build(); err == nil {
+		t.Error("Expected error for out of range quantile")
+	}
+
+	spec = base
+	spec.By = []string{"bad-label"}
+	if _, err := spec.build(); err == nil {
+		t.Error("Expected error for invalid grouping label")
+	}
+
+	spec = base
+	spec.Function = "count_over_time"
+	if _, err := spec.build(); err == nil {
+		t.Error("Expected error for unsupported function")
+	}
+}
+
+// TestUnwrapQuerySpec_ResolveField tests validation against Loki's detected fields
+func TestUnwrapQuerySpec_ResolveField(t *testing.T) {
+	fields := []LokiDetectedField{
+		{Label: "took", Type: "duration", Parsers: []string{"logfmt"}},
+		{Label: "status", Type: "int", Parsers: []string{"logfmt"}},
+		{Label: "msg", Type: "string", Parsers: []string{"logfmt"}},
+	}
+
+	spec := unwrapQuerySpec{Field: "took"}
+	if err := spec.resolveField(fields); err != nil {
+		t.Fatalf("resolveField failed: %v", err)
+	}
+	if spec.Parser != "logfmt" || spec.Conversion != "duration" {
+		t.Errorf("Expected logfmt parser and duration conversion, but got %q and %q", spec.Parser, spec.Conversion)
+	}
+
+	spec = unwrapQuerySpec{Field: "msg"}
+	if err := spec.resolveField(fields); err == nil || !strings.Contains(err.Error(), "cannot be unwrapped") {
+		t.Errorf("Expected non-numeric field error, but got %v", err)
+	}
+
+	spec = unwrapQuerySpec{Field: "latency"}
+	if err := spec.resolveField(fields); err == nil || !strings.Contains(err.Error(), "took, status") {
+		t.Errorf("Expected error listing numeric fields, but got %v", err)
+	}
+}
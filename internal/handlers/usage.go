@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable names for the daily quotas of each caller, unless their access policy role
+// sets its own. Callers without an access policy subject are identified by their network address.
+const (
+	// EnvDailyQueryQuota is the number of queries a caller may send to Loki per UTC day
+	EnvDailyQueryQuota = "LOKI_MCP_DAILY_QUERY_QUOTA"
+	// EnvDailyBytesQuota is the number of bytes Loki may process for a caller per UTC day, e.g. 50GB
+	EnvDailyBytesQuota = "LOKI_MCP_DAILY_BYTES_QUOTA"
+)
+
+// Number of days of usage kept, enough for monthly chargeback
+const usageRetentionDays = 31
+
+// byteSizePattern matches a number of bytes with an optional decimal or binary unit
+var byteSizePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([KMGTP]i?B|B)?$`)
+
+// callerUsage is what a caller sent to Loki on a UTC day, with the quotas that applied to it
+type callerUsage struct {
+	Caller         string `json:"caller"`
+	Day            string `json:"day"`
+	Requests       int64  `json:"requests"`
+	Queries        int64  `json:"queries"`
+	BytesProcessed int64  `json:"bytes_processed"`
+	LinesProcessed int64  `json:"lines_processed"`
+	Rejected       int64  `json:"rejected"`
+	QueryQuota     int64  `json:"query_quota,omitempty"`
+	BytesQuota     int64  `json:"bytes_quota,omitempty"`
+}
+
+// usageLedger holds the usage of each caller by day and caller
+var usageLedger = struct {
+	sync.Mutex
+	days map[string]map[string]*callerUsage
+}{days: make(map[string]map[string]*callerUsage)}
+
+// usageNow returns the current time, replaced by tests crossing days
+var usageNow = time.Now
+
+// parseByteSize parses a number of bytes such as 1048576, 500MB or 1.5TiB. Units without i are
+// decimal, as Grafana Cloud bills them.
+func parseByteSize(value string) (int64, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid byte size %q, expected a number with an optional unit such as 500MB or 1.5TiB", value)
+	}
+	n, _ := strconv.ParseFloat(m[1], 64)
+	units := map[string]float64{
+		"": 1, "B": 1,
+		"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12, "PB": 1e15,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40, "PiB": 1 << 50,
+	}
+	return int64(n * units[m[2]]), nil
+}
+
+// formatByteSize renders a number of bytes with a decimal unit
+func formatByteSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	size, unit := float64(n), 0
+	for size >= 1000 && unit < len(units)-1 {
+		size /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// loadQuotaDefaults reads the default daily quotas from the environment into the configuration
+func loadQuotaDefaults(cfg *Config) {
+	if n, err := strconv.ParseInt(os.Getenv(EnvDailyQueryQuota), 10, 64); err == nil && n > 0 {
+		cfg.DailyQueryQuota = n
+	}
+	if n, err := parseByteSize(os.Getenv(EnvDailyBytesQuota)); err == nil && n > 0 {
+		cfg.DailyBytesQuota = n
+	}
+}
+
+// clientAddressKey is the context key for the network address of an HTTP transport client
+type clientAddressKey struct{}
+
+// ClientAddressContextFunc captures the network address of an HTTP transport request, which
+// accounts the usage of clients the access policy doesn't identify
+func ClientAddressContextFunc(ctx context.Context, r *http.Request) context.Context {
+	if r.RemoteAddr == "" {
+		return ctx
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return context.WithValue(ctx, clientAddressKey{}, host)
+}
+
+// callerFromContext identifies who a tool call is accounted to: the access policy subject the
+// client's credentials were verified as, else the network address of an HTTP client, which unlike
+// an API key or session ID it can't pick anew to start over with a fresh quota. Calls over stdio
+// are accounted to the local user.
+func callerFromContext(ctx context.Context) string {
+	if subject, _ := ctx.Value(accessSubjectKey{}).(string); subject != "" {
+		return "subject:" + subject
+	}
+	if address, _ := ctx.Value(clientAddressKey{}).(string); address != "" {
+		return "address:" + address
+	}
+	return "stdio"
+}
+
+// callerQuotas returns the daily query and byte quotas of a tool call, 0 for unlimited. A role of
+// the access policy with quotas overrides the defaults.
+func callerQuotas(ctx context.Context) (queries, bytes int64) {
+	cfg := CurrentConfig()
+	queries, bytes = cfg.DailyQueryQuota, cfg.DailyBytesQuota
+	if role := accessScopeFromContext(ctx); role != nil {
+		if role.DailyQueries > 0 {
+			queries = role.DailyQueries
+		}
+		if n, err := parseByteSize(role.DailyBytes); role.DailyBytes != "" && err == nil {
+			bytes = n
+		}
+	}
+	return queries, bytes
+}
+
+// todaysUsage returns the caller's usage for the current UTC day, creating it and dropping days
+// past the retention. The ledger must be locked.
+func todaysUsage(caller string) *callerUsage {
+	day := usageNow().UTC().Format(time.DateOnly)
+	callers, ok := usageLedger.days[day]
+	if !ok {
+		callers = make(map[string]*callerUsage)
+		usageLedger.days[day] = callers
+		oldest := usageNow().UTC().AddDate(0, 0, -usageRetentionDays+1).Format(time.DateOnly)
+		for d := range usageLedger.days {
+			if d < oldest {
+				delete(usageLedger.days, d)
+			}
+		}
+	}
+	usage, ok := callers[caller]
+	if !ok {
+		usage = &callerUsage{Caller: caller, Day: day}
+		callers[caller] = usage
+	}
+	return usage
+}
+
+// isQueryEndpoint reports whether a Loki API path runs a query, as opposed to metadata lookups.
+// Every Elasticsearch search runs a query.
+func isQueryEndpoint(urlPath string) bool {
+	endpoint := path.Base(urlPath)
+	return endpoint == "query" || endpoint == "query_range" || endpoint == "_search"
+}
+
+// checkQuota reserves a query of the caller's daily quota before a request is sent to Loki, so
+// that concurrent queries can't together overrun it, and returns a function giving the query back
+// when the request fails. It rejects the query when the caller has used up a daily quota. The
+// bytes a query processes are only known once it ran, so the query crossing the byte quota is
+// allowed. Metadata requests such as label lookups are never rejected.
+func checkQuota(ctx context.Context, req *http.Request) (refund func(), err error) {
+	if !isQueryEndpoint(req.URL.Path) {
+		return func() {}, nil
+	}
+	queries, bytes := callerQuotas(ctx)
+	caller := callerFromContext(ctx)
+
+	usageLedger.Lock()
+	defer usageLedger.Unlock()
+	usage := todaysUsage(caller)
+	usage.QueryQuota, usage.BytesQuota = queries, bytes
+	var exceeded string
+	switch {
+	case queries > 0 && usage.Queries >= queries:
+		exceeded = fmt.Sprintf("%d queries", queries)
+	case bytes > 0 && usage.BytesProcessed >= bytes:
+		exceeded = formatByteSize(bytes) + " processed"
+	default:
+		usage.Queries++
+		return func() {
+			usageLedger.Lock()
+			usage.Queries--
+			usageLedger.Unlock()
+		}, nil
+	}
+	usage.Rejected++
+	return nil, &PolicyViolationError{Reason: fmt.Sprintf("daily quota of %s exceeded for %s; it resets at 00:00 UTC", exceeded, caller)}
+}
+
+// recordUsage accounts a response from Loki to the caller of the tool call that sent it. Queries
+// are counted by checkQuota; only query endpoints report the bytes and lines they processed.
+func recordUsage(req *http.Request, status int, body []byte) {
+	ctx := req.Context()
+	caller := callerFromContext(ctx)
+	var stats *lokiStatsSummary
+	if isQueryEndpoint(req.URL.Path) && status == http.StatusOK {
+		stats = parseStatsSummary(body)
+	}
+
+	usageLedger.Lock()
+	defer usageLedger.Unlock()
+	usage := todaysUsage(caller)
+	usage.Requests++
+	if stats != nil {
+		usage.BytesProcessed += stats.TotalBytesProcessed
+		usage.LinesProcessed += stats.TotalLinesProcessed
+	}
+}
+
+// reportsAllUsage reports whether a tool call may see the usage of every caller: calls over stdio,
+// made by the server's operator, and HTTP clients whose role may call every tool on every stream.
+// Other clients only see their own usage.
+func reportsAllUsage(ctx context.Context) bool {
+	if _, ok := ctx.Value(clientCredentialsKey{}).(clientCredentials); !ok {
+		return true
+	}
+	role := accessScopeFromContext(ctx)
+	return role != nil && slices.Contains(role.Tools, "*") && len(role.Tenants) == 0 && len(role.Labels) == 0
+}
+
+// NewLokiMCPUsageTool creates and returns a tool for reporting the usage of each caller
+func NewLokiMCPUsageTool() mcp.Tool {
+	return mcp.NewTool("loki_mcp_usage",
+		mcp.WithDescription("Report the queries each caller sent to Loki through this server and the bytes Loki processed for them, "+
+			"per UTC day, with their daily quotas. Callers are access policy subjects, API keys or MCP sessions. "+
+			"Clients restricted by the access policy only see their own usage. Useful for chargeback when several teams share one deployment."),
+		mcp.WithString("caller",
+			mcp.Description("Only report this caller, e.g. subject:team-a (default: all callers the client may see)"),
+		),
+		mcp.WithNumber("days",
+			mcp.Description(fmt.Sprintf("Number of days to report, ending today (default: 1, at most %d)", usageRetentionDays)),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// HandleLokiMCPUsage handles usage tool requests
+func HandleLokiMCPUsage(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	format := formatArg(args)
+	caller, _ := args["caller"].(string)
+	if !reportsAllUsage(ctx) {
+		caller = callerFromContext(ctx)
+	}
+	days := 1
+	if n, ok := args["days"].(float64); ok && n > 0 {
+		days = min(int(n), usageRetentionDays)
+	}
+
+	oldest := usageNow().UTC().AddDate(0, 0, -days+1).Format(time.DateOnly)
+	var usages []callerUsage
+	usageLedger.Lock()
+	for day, callers := range usageLedger.days {
+		if day < oldest {
+			continue
+		}
+		for name, usage := range callers {
+			if caller == "" || name == caller {
+				usages = append(usages, *usage)
+			}
+		}
+	}
+	usageLedger.Unlock()
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Day != usages[j].Day {
+			return usages[i].Day > usages[j].Day
+		}
+		return usages[i].Caller < usages[j].Caller
+	})
+
+	formattedResult, err := formatUsage(usages, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// formatUsage formats the usage of callers into a readable string
+func formatUsage(usages []callerUsage, format string) (string, error) {
+	switch format {
+	case "json":
+		if usages == nil {
+			usages = []callerUsage{}
+		}
+		jsonBytes, err := json.MarshalIndent(usages, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		var b strings.Builder
+		for _, u := range usages {
+			fmt.Fprintf(&b, "%s %s queries=%d bytes_processed=%d requests=%d rejected=%d\n",
+				u.Day, u.Caller, u.Queries, u.BytesProcessed, u.Requests, u.Rejected)
+		}
+		return b.String(), nil
+
+	case "text":
+		if len(usages) == 0 {
+			return "No usage recorded", nil
+		}
+		var b strings.Builder
+		day := ""
+		for _, u := range usages {
+			if u.Day != day {
+				if day != "" {
+					b.WriteString("\n")
+				}
+				fmt.Fprintf(&b, "Usage on %s (UTC):\n", u.Day)
+				day = u.Day
+			}
+			fmt.Fprintf(&b, "  %s: %d queries", u.Caller, u.Queries)
+			if u.QueryQuota > 0 {
+				fmt.Fprintf(&b, " of %d", u.QueryQuota)
+			}
+			fmt.Fprintf(&b, ", %s processed", formatByteSize(u.BytesProcessed))
+			if u.BytesQuota > 0 {
+				fmt.Fprintf(&b, " of %s", formatByteSize(u.BytesQuota))
+			}
+			fmt.Fprintf(&b, ", %d lines, %d requests in total", u.LinesProcessed, u.Requests)
+			if u.Rejected > 0 {
+				fmt.Fprintf(&b, ", %d rejected by quota", u.Rejected)
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// resetUsage clears the usage recorded by other tests, and restores the clock and configuration
+// after the test
+func resetUsage(t *testing.T) {
+	clearLedger := func() {
+		usageLedger.Lock()
+		clear(usageLedger.days)
+		usageLedger.Unlock()
+	}
+	clearLedger()
+	t.Cleanup(func() {
+		activeConfig.Store(nil)
+		usageNow = time.Now
+		clearLedger()
+	})
+}
+
+// usageServer returns a Loki server reporting the given number of bytes processed by each query
+func usageServer(t *testing.T, bytes int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loki/api/v1/labels" {
+			w.Write([]byte(`{"status": "success", "data": ["app"]}`))
+			return
+		}
+		w.Write([]byte(`{"status": "success", "data": {"resultType": "streams", "result": [], "stats": {"summary": ` +
+			`{"totalBytesProcessed": ` + strconv.Itoa(bytes) + `, "totalLinesProcessed": 10}}}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestParseByteSize tests parsing byte sizes with decimal and binary units
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"1048576": 1048576,
+		"500MB":   500e6,
+		"50 GB":   50e9,
+		"1.5TiB":  3 << 39,
+		"2KiB":    2048,
+		"10B":     10,
+	}
+	for value, want := range tests {
+		if got, err := parseByteSize(value); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "10XB", "GB", "-5MB"} {
+		if _, err := parseByteSize(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+	if got := formatByteSize(1536e6); got != "1.5 GB" {
+		t.Errorf("formatByteSize = %s, want 1.5 GB", got)
+	}
+}
+
+// TestCallerFromContext tests identifying callers by verified subject and network address
+func TestCallerFromContext(t *testing.T) {
+	ctx := context.Background()
+	if got := callerFromContext(ctx); got != "stdio" {
+		t.Errorf("Expected the stdio caller, but got %s", got)
+	}
+
+	// Unverified API keys and resumed sessions don't change who an HTTP client is
+	req := httptest.NewRequest("POST", "/mcp", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set(APIKeyHeader, "random-key")
+	ctx = HTTPContextFunc(context.Background(), req)
+	ctx = context.WithValue(ctx, resumedSessionKey{}, "other-session")
+	if got := callerFromContext(ctx); got != "address:192.0.2.10" {
+		t.Errorf("Expected the client address, but got %s", got)
+	}
+
+	ctx = context.WithValue(ctx, accessSubjectKey{}, "team-a")
+	if got := callerFromContext(ctx); got != "subject:team-a" {
+		t.Errorf("Expected the subject, but got %s", got)
+	}
+}
+
+// TestQueryQuota tests rejecting queries past the daily query quota while metadata requests continue
+func TestQueryQuota(t *testing.T) {
+	resetUsage(t)
+	server := usageServer(t, 100)
+	cfg := LoadConfig()
+	cfg.DailyQueryQuota = 2
+	SetConfig(cfg)
+
+	ctx := context.WithValue(context.Background(), accessSubjectKey{}, "team-a")
+	queryURL := server.URL + "/loki/api/v1/query_range?query=%7Bapp%3D%22api%22%7D"
+	for i := 0; i < 2; i++ {
+		if _, err := executeLokiRequest(ctx, queryURL, "", "", "", ""); err != nil {
+			t.Fatalf("Expected query %d to be allowed, but got %v", i+1, err)
+		}
+	}
+	_, err := executeLokiRequest(ctx, queryURL, "", "", "", "")
+	var violation *PolicyViolationError
+	if !errors.As(err, &violation) || !strings.Contains(err.Error(), "daily quota of 2 queries exceeded for subject:team-a") {
+		t.Errorf("Expected a quota violation, but got %v", err)
+	}
+	if _, err := executeLokiRequest(ctx, server.URL+"/loki/api/v1/labels", "", "", "", ""); err != nil {
+		t.Errorf("Expected label requests past the quota to be allowed, but got %v", err)
+	}
+
+	// Other callers have their own quota
+	other := context.WithValue(context.Background(), accessSubjectKey{}, "team-b")
+	if _, err := executeLokiRequest(other, queryURL, "", "", "", ""); err != nil {
+		t.Errorf("Expected another caller to be allowed, but got %v", err)
+	}
+
+	// The quota resets the next UTC day
+	usageNow = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	if _, err := executeLokiRequest(ctx, queryURL, "", "", "", ""); err != nil {
+		t.Errorf("Expected the quota to reset the next day, but got %v", err)
+	}
+}
+
+// TestBytesQuota tests a role's byte quota overriding the default
+func TestBytesQuota(t *testing.T) {
+	resetUsage(t)
+	server := usageServer(t, 2000)
+	cfg := LoadConfig()
+	cfg.DailyBytesQuota = 1 << 30
+	SetConfig(cfg)
+
+	role := &AccessRole{Tools: []string{"*"}, DailyBytes: "3KB"}
+	ctx := context.WithValue(context.WithValue(context.Background(), accessSubjectKey{}, "team-a"), accessScopeKey{}, role)
+	queryURL := server.URL + "/loki/api/v1/query?query=%7Bapp%3D%22api%22%7D"
+	for i := 0; i < 2; i++ {
+		if _, err := executeLokiRequest(ctx, queryURL, "", "", "", ""); err != nil {
+			t.Fatalf("Expected query %d to be allowed, but got %v", i+1, err)
+		}
+	}
+	if _, err := executeLokiRequest(ctx, queryURL, "", "", "", ""); err == nil || !strings.Contains(err.Error(), "daily quota of 3.0 KB processed exceeded") {
+		t.Errorf("Expected a byte quota violation, but got %v", err)
+	}
+}
+
+// TestHandleLokiMCPUsage tests reporting the usage of each caller per day
+func TestHandleLokiMCPUsage(t *testing.T) {
+	resetUsage(t)
+	server := usageServer(t, 1500000)
+	cfg := LoadConfig()
+	cfg.DailyQueryQuota = 100
+	SetConfig(cfg)
+
+	queryURL := server.URL + "/loki/api/v1/query_range?query=%7Bapp%3D%22api%22%7D"
+	yesterday := time.Now().Add(-24 * time.Hour)
+	usageNow = func() time.Time { return yesterday }
+	teamA := context.WithValue(context.Background(), accessSubjectKey{}, "team-a")
+	executeLokiRequest(teamA, queryURL, "", "", "", "")
+	usageNow = time.Now
+	executeLokiRequest(teamA, queryURL, "", "", "", "")
+	executeLokiRequest(teamA, server.URL+"/loki/api/v1/labels", "", "", "", "")
+	executeLokiRequest(context.WithValue(context.Background(), accessSubjectKey{}, "team-b"), queryURL, "", "", "", "")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"format": "text"}
+	result, err := HandleLokiMCPUsage(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	today := time.Now().UTC().Format(time.DateOnly)
+	for _, want := range []string{
+		"Usage on " + today + " (UTC):\n",
+		"  subject:team-a: 1 queries of 100, 1.5 MB processed, 10 lines, 2 requests in total\n",
+		"  subject:team-b: 1 queries of 100, 1.5 MB processed",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, yesterday.UTC().Format(time.DateOnly)) {
+		t.Errorf("Expected only today by default, but got:\n%s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"caller": "subject:team-a", "days": float64(2)}
+	result, err = HandleLokiMCPUsage(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	raw := result.Content[0].(mcp.TextContent).Text
+	lines := strings.Split(strings.TrimSpace(raw), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], today+" subject:team-a queries=1 bytes_processed=1500000 requests=2") ||
+		!strings.HasPrefix(lines[1], yesterday.UTC().Format(time.DateOnly)+" subject:team-a queries=1") {
+		t.Errorf("Unexpected raw usage:\n%s", raw)
+	}
+}
+
+// TestQueryQuota_Concurrent tests that concurrent queries can't together overrun the quota, and
+// that failed queries are given back
+func TestQueryQuota_Concurrent(t *testing.T) {
+	resetUsage(t)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") == "fail" {
+			http.Error(w, "parse error", http.StatusBadRequest)
+			return
+		}
+		requests.Add(1)
+		<-release
+		w.Write([]byte(`{"status": "success", "data": {"resultType": "streams", "result": []}}`))
+	}))
+	t.Cleanup(server.Close)
+	cfg := LoadConfig()
+	cfg.DailyQueryQuota = 2
+	SetConfig(cfg)
+
+	ctx := context.WithValue(context.Background(), accessSubjectKey{}, "team-a")
+	if _, err := executeLokiRequest(ctx, server.URL+"/loki/api/v1/query_range?query=fail", "", "", "", ""); err == nil {
+		t.Fatal("Expected the failing query to return an error")
+	}
+
+	var wg sync.WaitGroup
+	var allowed, rejected atomic.Int32
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := executeLokiRequest(ctx, fmt.Sprintf("%s/loki/api/v1/query_range?query=q%d", server.URL, i), "", "", "", "")
+			var violation *PolicyViolationError
+			switch {
+			case err == nil:
+				allowed.Add(1)
+			case errors.As(err, &violation):
+				rejected.Add(1)
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); rejected.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if allowed.Load() != 2 || rejected.Load() != 2 || requests.Load() != 2 {
+		t.Errorf("Expected 2 queries allowed and 2 rejected, but got %d allowed, %d rejected and %d sent to Loki",
+			allowed.Load(), rejected.Load(), requests.Load())
+	}
+}
+
+// TestRecordUsage_Coalesced tests that every caller sharing a response is accounted for it
+func TestRecordUsage_Coalesced(t *testing.T) {
+	resetUsage(t)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"status": "success", "data": {"resultType": "streams", "result": [], "stats": {"summary": ` +
+			`{"totalBytesProcessed": 500, "totalLinesProcessed": 10}}}}`))
+	}))
+	t.Cleanup(server.Close)
+	SetConfig(LoadConfig())
+
+	queryURL := server.URL + "/loki/api/v1/query_range?query=%7Bapp%3D%22api%22%7D"
+	var wg sync.WaitGroup
+	for _, subject := range []string{"team-a", "team-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := executeLokiRequest(context.WithValue(context.Background(), accessSubjectKey{}, subject), queryURL, "", "", "", ""); err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+		}()
+	}
+	waitForCallers(t, 2)
+	close(release)
+	wg.Wait()
+
+	usageLedger.Lock()
+	defer usageLedger.Unlock()
+	for _, caller := range []string{"subject:team-a", "subject:team-b"} {
+		usage := todaysUsage(caller)
+		if usage.Queries != 1 || usage.Requests != 1 || usage.BytesProcessed != 500 {
+			t.Errorf("Expected %s to be accounted 1 query of 500 bytes, but got %+v", caller, *usage)
+		}
+	}
+}
+
+// TestHandleLokiMCPUsage_OwnUsage tests that clients restricted by the access policy only see their own usage
+func TestHandleLokiMCPUsage_OwnUsage(t *testing.T) {
+	resetUsage(t)
+	usageLedger.Lock()
+	todaysUsage("subject:team-a").Queries = 1
+	todaysUsage("subject:team-b").Queries = 2
+	usageLedger.Unlock()
+
+	report := func(role *AccessRole, caller string) string {
+		ctx := context.WithValue(context.Background(), clientCredentialsKey{}, clientCredentials{APIKey: "key-a"})
+		ctx = context.WithValue(context.WithValue(ctx, accessScopeKey{}, role), accessSubjectKey{}, "team-a")
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"caller": caller}
+		result, err := HandleLokiMCPUsage(ctx, request)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	analyst := &AccessRole{Tools: []string{"loki_*"}, Labels: map[string]string{"namespace": "team-a-.*"}}
+	for _, caller := range []string{"", "subject:team-b"} {
+		if text := report(analyst, caller); !strings.Contains(text, "subject:team-a") || strings.Contains(text, "team-b") {
+			t.Errorf("Expected only the caller's own usage for caller %q, but got:\n%s", caller, text)
+		}
+	}
+	if text := report(&AccessRole{Tools: []string{"*"}}, ""); !strings.Contains(text, "subject:team-b") {
+		t.Errorf("Expected full-access roles to see every caller, but got:\n%s", text)
+	}
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// configSchemas holds the published JSON schemas of the config files
+//
+//go:embed schemas/*.schema.json
+var configSchemas embed.FS
+
+// ConfigSchema returns the JSON schema of a config file: datasources, reports, access-policy, anonymization,
+// saved-queries, source-links or multiline
+func ConfigSchema(kind string) ([]byte, error) {
+	data, err := configSchemas.ReadFile("schemas/" + kind + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown config file kind: %s. Supported kinds: datasources, reports, access-policy, anonymization, saved-queries, source-links, multiline", kind)
+	}
+	return data, nil
+}
+
+// ValidateDatasourcesFile checks a datasources file against its schema, resolves its environment
+// variable references and credentials, and returns the problems found
+func ValidateDatasourcesFile(path string) []string {
+	data, problems := readAndValidateSchema("datasources", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var datasources []Datasource
+	if err := json.Unmarshal(data, &datasources); err != nil {
+		return append(problems, err.Error())
+	}
+	if err := validateDatasources(datasources); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, ds := range datasources {
+		problems = append(problems, credentialProblems("datasource "+ds.Name, ds.Username, ds.Password, ds.Token)...)
+	}
+	return problems
+}
+
+// ValidateReportsFile checks a reports file against its schema, resolves its environment variable
+// references, and checks schedules and sinks. Tool names are checked when the server starts,
+// since they depend on which tools are enabled.
+func ValidateReportsFile(path string) []string {
+	data, problems := readAndValidateSchema("reports", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var reports []ReportConfig
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return append(problems, err.Error())
+	}
+	for _, r := range reports {
+		if _, err := parseCron(r.Schedule); err != nil {
+			problems = append(problems, fmt.Sprintf("report %s: %v", r.Name, err))
+		}
+		sinks := slices.Clone(r.Sinks)
+		if r.Webhook != "" {
+			sinks = append(sinks, NotificationSink{Type: SinkWebhook, URL: r.Webhook})
+		}
+		for i := range sinks {
+			if err := sinks[i].validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("report %s: %v", r.Name, err))
+			}
+		}
+		if r.File == "" && len(sinks) == 0 {
+			problems = append(problems, fmt.Sprintf("report %s: a file or sink is required", r.Name))
+		}
+	}
+	return problems
+}
+
+// ValidateAccessPolicyFile checks an access policy file against its schema, resolves its
+// environment variable references and checks that subjects refer to defined roles
+func ValidateAccessPolicyFile(path string) []string {
+	data, problems := readAndValidateSchema("access-policy", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var policy AccessPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return append(problems, err.Error())
+	}
+	if err := policy.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if policy.UsesClaims() && policy.Issuer == "" && strings.TrimSpace(os.Getenv(EnvLokiOIDCIssuer)) == "" {
+		problems = append(problems, fmt.Sprintf("subjects match OIDC claims but neither issuer nor %s is set", EnvLokiOIDCIssuer))
+	}
+	return problems
+}
+
+// ValidateAnonymizationFile checks an anonymization file against its schema, resolves its
+// environment variable references and compiles its patterns
+func ValidateAnonymizationFile(path string) []string {
+	data, problems := readAndValidateSchema("anonymization", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var profiles map[string]*AnonymizationProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return append(problems, err.Error())
+	}
+	for _, name := range sortedKeys(profiles) {
+		if err := profiles[name].compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("profile %s: %v", name, err))
+		}
+	}
+	return problems
+}
+
+// ValidateSavedQueriesFile checks a saved queries file against its schema, resolves its
+// environment variable references and checks the parameters and placeholders of each query
+func ValidateSavedQueriesFile(path string) []string {
+	data, problems := readAndValidateSchema("saved-queries", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var queries []SavedQuery
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return append(problems, err.Error())
+	}
+	if err := compileSavedQueries(queries); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// ValidateSourceLinksFile checks a source links file against its schema, resolves its environment
+// variable references and checks the URL template and pattern of each rule
+func ValidateSourceLinksFile(path string) []string {
+	data, problems := readAndValidateSchema("source-links", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var rules []SourceLinkRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return append(problems, err.Error())
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): %v", i+1, rules[i].Name, err))
+		}
+	}
+	return problems
+}
+
+// ValidateMultilineFile checks a multiline rules file against its schema, resolves its environment
+// variable references and checks the continuation pattern and limits of each rule
+func ValidateMultilineFile(path string) []string {
+	data, problems := readAndValidateSchema("multiline", path)
+	if data == nil || len(problems) > 0 {
+		return problems
+	}
+	var rules []MultilineRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return append(problems, err.Error())
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): %v", i+1, rules[i].Name, err))
+		}
+	}
+	return problems
+}
+
+// ValidateCredentials returns the problems with the credentials set through environment variables
+func ValidateCredentials(cfg *Config) []string {
+	problems := append([]string(nil), cfg.SecretErrors...)
+	problems = append(problems, credentialProblems("environment", cfg.LokiUsername, cfg.LokiPassword, cfg.LokiToken)...)
+	problems = append(problems, forwardHeaderProblems(cfg.ForwardHeaders)...)
+	if cfg.OIDC.ClientSecret != "" && cfg.OIDC.ClientID == "" {
+		problems = append(problems, fmt.Sprintf("environment: %s is set without %s", EnvLokiOIDCClientSecret, EnvLokiOIDCClientID))
+	}
+	if (cfg.OIDC.ClientID != "" || cfg.OIDC.Audience != "") && !cfg.OIDC.Enabled() {
+		problems = append(problems, fmt.Sprintf("environment: OIDC settings are ignored without %s or %s", EnvLokiOIDCIssuer, EnvLokiOIDCTokenURL))
+	}
+	if cfg.AdminURL != "" && cfg.AdminToken == "" {
+		problems = append(problems, fmt.Sprintf("environment: %s is set without %s", EnvLokiAdminURL, EnvLokiAdminToken))
+	}
+	return problems
+}
+
+// credentialProblems reports incomplete or conflicting credentials
+func credentialProblems(source, username, password, token string) []string {
+	var problems []string
+	if (username == "") != (password == "") {
+		problems = append(problems, source+": username and password must be set together")
+	}
+	if token != "" && username != "" {
+		problems = append(problems, source+": both a token and basic auth credentials are set; the token is used")
+	}
+	return problems
+}
+
+// readAndValidateSchema reads a config file, expands its environment variable references and
+// validates it against the schema of its kind. It returns nil data when the file cannot be parsed.
+func readAndValidateSchema(kind, path string) ([]byte, []string) {
+	raw, err := os.ReadFile(expandPath(path))
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	// Report unresolved references, but keep validating the structure of the file
+	var problems []string
+	data, err := expandEnvReferences(raw)
+	if err != nil {
+		problems = append(problems, err.Error())
+		data = raw
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, append(problems, fmt.Sprintf("invalid JSON: %v", err))
+	}
+	schemaData, err := ConfigSchema(kind)
+	if err != nil {
+		return nil, append(problems, err.Error())
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return nil, append(problems, fmt.Sprintf("invalid %s schema: %v", kind, err))
+	}
+	validateSchema(schema, doc, "$", &problems)
+	return data, problems
+}
+
+// validateSchema validates a value against the subset of JSON schema used by the config
+// schemas: type, enum, minLength, properties, required, additionalProperties and items
+func validateSchema(schema map[string]any, value any, path string, problems *[]string) {
+	if typ, ok := schema["type"].(string); ok && !schemaTypeMatches(typ, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s", path, typ))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		var values []string
+		for _, v := range enum {
+			values = append(values, fmt.Sprint(v))
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: must be one of %s", path, strings.Join(values, ", ")))
+	}
+	if minLength, ok := schema["minLength"].(float64); ok {
+		if s, ok := value.(string); ok && len(s) < int(minLength) {
+			*problems = append(*problems, fmt.Sprintf("%s: must not be empty", path))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					*problems = append(*problems, fmt.Sprintf("%s: missing required field %s", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propSchema, ok := properties[key].(map[string]any); ok {
+				validateSchema(propSchema, v[key], path+"."+key, problems)
+			} else if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+				validateSchema(additional, v[key], path+"."+key, problems)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown key %s", path, key))
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+// schemaTypeMatches reports whether a decoded JSON value has the given JSON schema type
+func schemaTypeMatches(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	}
+	return true
+}
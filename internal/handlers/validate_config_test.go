@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidateDatasourcesFile tests reporting schema and credential problems
+func TestValidateDatasourcesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datasources.json")
+	os.WriteFile(path, []byte(`[{"name": "prod", "url": "http://prod:3100", "labels": {"service": "service_name"}}]`), 0o644)
+	if problems := ValidateDatasourcesFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, but got %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`[{"url": "${TEST_UNSET_URL}", "orgid": "tenant", "default": "yes", "labels": {"app": "x"}},
+		{"name": "b", "url": "http://b", "username": "user", "token": "t"}]`), 0o644)
+	expected := []string{
+		"undefined environment variables: TEST_UNSET_URL",
+		"$[0]: missing required field name",
+		"$[0].default: expected boolean",
+		"$[0].labels: unknown key app",
+		"$[0]: unknown key orgid",
+	}
+	if problems := ValidateDatasourcesFile(path); strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, but got %q", expected, problems)
+	}
+
+	// Credential problems are reported once the file matches the schema
+	os.WriteFile(path, []byte(`[{"name": "b", "url": "http://b", "username": "user", "token": "t"}]`), 0o644)
+	problems := ValidateDatasourcesFile(path)
+	if len(problems) != 2 || !strings.Contains(problems[0], "username and password must be set together") {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
+
+// TestValidateReportsFile tests checking report schedules and sinks
+func TestValidateReportsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports.json")
+	os.WriteFile(path, []byte(`[{"name": "daily", "schedule": "0 9 * * *", "tool": "loki_query", "file": "/tmp/r.txt",
+		"arguments": {"query": "{app=\"api\"}"}}]`), 0o644)
+	if problems := ValidateReportsFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, but got %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "daily", "schedule": "0 25 * * *", "tool": "loki_query", "sinks": [{"type": "email"}]}]`), 0o644)
+	problems := ValidateReportsFile(path)
+	if len(problems) != 1 || problems[0] != "$[0].sinks[0].type: must be one of webhook, slack, pagerduty" {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "daily", "schedule": "0 25 * * *", "tool": "loki_query"}]`), 0o644)
+	problems = ValidateReportsFile(path)
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], "report daily: ") || problems[1] != "report daily: a file or sink is required" {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
+
+// TestValidateAccessPolicyFile tests validating access policy files
+func TestValidateAccessPolicyFile(t *testing.T) {
+	setenv(t, EnvLokiOIDCIssuer, "")
+	path := filepath.Join(t.TempDir(), "access-policy.json")
+	os.WriteFile(path, []byte(`{"roles": {"sre": {"tools": ["*"], "labels": {"namespace": "ops"}}},
+		"subjects": [{"api_key": "k", "role": "sre"}]}`), 0o644)
+	if problems := ValidateAccessPolicyFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, but got %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`{"roles": {"sre": {"tools": "*", "labels": {"namespace": 1}}}, "subjects": []}`), 0o644)
+	problems := ValidateAccessPolicyFile(path)
+	if len(problems) != 2 || problems[0] != "$.roles.sre.labels.namespace: expected string" || problems[1] != "$.roles.sre.tools: expected array" {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`{"roles": {"sre": {"tools": ["*"]}}, "subjects": [{"claims": {"groups": "sre"}, "role": "sre"}]}`), 0o644)
+	problems = ValidateAccessPolicyFile(path)
+	if len(problems) != 1 || !strings.Contains(problems[0], "neither issuer nor LOKI_OIDC_ISSUER is set") {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
+
+// TestValidateSourceLinksFile tests checking source link URL templates and patterns
+func TestValidateSourceLinksFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source-links.json")
+	os.WriteFile(path, []byte(`[{"name": "api", "labels": {"app": "api"}, "url": "https://github.com/acme/api/blob/{ref}/{path}#L{line}"}]`), 0o644)
+	if problems := ValidateSourceLinksFile(path); len(problems) != 0 {
+		t.Errorf("Expected no problems, but got %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "api", "repo": "acme/api"}]`), 0o644)
+	problems := ValidateSourceLinksFile(path)
+	if len(problems) != 2 || problems[0] != "$[0]: missing required field url" || problems[1] != "$[0]: unknown key repo" {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "api", "pattern": "(\\S+\\.go)", "url": "https://github.com/acme/api/blob/{ref}/{path}"}]`), 0o644)
+	problems = ValidateSourceLinksFile(path)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "rule 1 (api): pattern must have a named group path") {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
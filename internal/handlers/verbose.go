@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// verboseKey is the context key for the timing recorder of a verbose tool call
+type verboseKey struct{}
+
+// requestTimingKey is the context key for the timing of the Loki request being sent
+type requestTimingKey struct{}
+
+// requestTiming is the breakdown of a request sent to Loki. Phases that didn't happen, such as
+// DNS and connect on a reused connection, are zero.
+type requestTiming struct {
+	Method  string
+	URL     string // with any credentials removed
+	Status  int
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration // from sending the request to the first response byte
+	Total   time.Duration // until the response body was read
+	Reused  bool          // the request was sent on a kept-alive connection
+	Cached  bool          // the response was served from the response cache
+	Err     string
+}
+
+// verboseTimings records where the time of a tool call went
+type verboseTimings struct {
+	mu          sync.Mutex
+	started     time.Time
+	requests    []*requestTiming
+	decode      time.Duration // decoding Loki's JSON responses
+	lastDecoded time.Time
+}
+
+// verboseOption returns the tool option for the timing breakdown
+func verboseOption() mcp.ToolOption {
+	return mcp.WithBoolean("verbose",
+		mcp.Description("Append a timing breakdown of the tool call: DNS, connect, TLS, time to first byte and total for each "+
+			"request sent to Loki with its URL (credentials removed), and the time spent decoding and formatting (default: false)"),
+	)
+}
+
+// verboseFromContext returns the timing recorder of the current tool call, or nil when it isn't verbose
+func verboseFromContext(ctx context.Context) *verboseTimings {
+	rec, _ := ctx.Value(verboseKey{}).(*verboseTimings)
+	return rec
+}
+
+// startRequest adds a request to the breakdown, returning a context carrying its timing for doLokiRequest
+func (v *verboseTimings) startRequest(ctx context.Context, method, requestURL string) (context.Context, *requestTiming) {
+	timing := &requestTiming{Method: method, URL: requestURL}
+	if u, err := url.Parse(requestURL); err == nil {
+		timing.URL = u.Redacted()
+	}
+	v.mu.Lock()
+	v.requests = append(v.requests, timing)
+	v.mu.Unlock()
+	return context.WithValue(ctx, requestTimingKey{}, timing), timing
+}
+
+// update changes a request's timing under the recorder's lock
+func (v *verboseTimings) update(fn func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fn()
+}
+
+// traceRequest returns a context tracing the phases of a request into the timing carried by ctx,
+// and a function recording the response status and total time once the body was read
+func traceRequest(ctx context.Context) (context.Context, func(status int, err error)) {
+	rec, timing := verboseFromContext(ctx), requestTimingFromContext(ctx)
+	if rec == nil || timing == nil {
+		return ctx, func(int, error) {}
+	}
+
+	// Callbacks may run on other goroutines, such as when dialing several addresses
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart time.Time
+	var dns, connect, tlsDuration, ttfb time.Duration
+	var reused bool
+	sent := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { mu.Lock(); dnsStart = time.Now(); mu.Unlock() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { mu.Lock(); dns = time.Since(dnsStart); mu.Unlock() },
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			if err == nil {
+				connect = time.Since(connectStart)
+			}
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() { mu.Lock(); tlsStart = time.Now(); mu.Unlock() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			tlsDuration = time.Since(tlsStart)
+			mu.Unlock()
+		},
+		GotConn:              func(info httptrace.GotConnInfo) { mu.Lock(); reused = info.Reused; mu.Unlock() },
+		GotFirstResponseByte: func() { mu.Lock(); ttfb = time.Since(sent); mu.Unlock() },
+	}
+
+	done := func(status int, err error) {
+		total := time.Since(sent)
+		mu.Lock()
+		defer mu.Unlock()
+		rec.update(func() {
+			timing.Status, timing.Total, timing.Reused = status, total, reused
+			timing.DNS, timing.Connect, timing.TLS, timing.TTFB = dns, connect, tlsDuration, ttfb
+			if err != nil {
+				timing.Err = err.Error()
+			}
+		})
+	}
+	return httptrace.WithClientTrace(ctx, trace), done
+}
+
+// requestTimingFromContext returns the timing of the Loki request being sent, or nil
+func requestTimingFromContext(ctx context.Context) *requestTiming {
+	timing, _ := ctx.Value(requestTimingKey{}).(*requestTiming)
+	return timing
+}
+
+// decodeLokiResponse decodes the JSON body of a Loki response, recording the time it took for
+// verbose tool calls
+func decodeLokiResponse(ctx context.Context, body []byte, v any) error {
+	rec := verboseFromContext(ctx)
+	if rec == nil {
+		return json.Unmarshal(body, v)
+	}
+	started := time.Now()
+	err := json.Unmarshal(body, v)
+	rec.update(func() {
+		rec.decode += time.Since(started)
+		rec.lastDecoded = time.Now()
+	})
+	return err
+}
+
+// VerboseMiddleware handles the verbose argument of every tool that talks to Loki, appending the
+// timing breakdown to the result, or to the error of a failed call
+func VerboseMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if verbose, _ := request.GetArguments()["verbose"].(bool); !verbose {
+			return next(ctx, request)
+		}
+
+		rec := &verboseTimings{started: time.Now()}
+		result, err := next(context.WithValue(ctx, verboseKey{}, rec), request)
+		breakdown := rec.format(time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("%w\n\n%s", err, breakdown)
+		}
+		if result != nil {
+			result.Content = append(result.Content, mcp.NewTextContent(breakdown))
+		}
+		return result, nil
+	}
+}
+
+// format renders the timing breakdown of a tool call that ended at the given time. Formatting
+// is the time from decoding the last response to the end of the call.
+func (v *verboseTimings) format(ended time.Time) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("Timing breakdown:\n")
+	if len(v.requests) == 0 {
+		b.WriteString("  no request was sent to Loki\n")
+	}
+	for _, timing := range v.requests {
+		fmt.Fprintf(&b, "  %s %s\n    %s\n", timing.Method, timing.URL, timing.phases())
+	}
+
+	format := time.Duration(0)
+	if !v.lastDecoded.IsZero() {
+		format = ended.Sub(v.lastDecoded)
+	}
+	fmt.Fprintf(&b, "  decode %s, format %s, total %s\n", roundTiming(v.decode), roundTiming(format), roundTiming(ended.Sub(v.started)))
+	return b.String()
+}
+
+// phases renders the phases of a request on one line
+func (t *requestTiming) phases() string {
+	if t.Cached {
+		return "served from the response cache"
+	}
+	connection := fmt.Sprintf("dns %s, connect %s, tls %s", roundTiming(t.DNS), roundTiming(t.Connect), roundTiming(t.TLS))
+	if t.Reused {
+		connection = "reused connection"
+	}
+	s := fmt.Sprintf("%s, ttfb %s, total %s", connection, roundTiming(t.TTFB), roundTiming(t.Total))
+	if t.Status != 0 {
+		s += fmt.Sprintf(", status %d", t.Status)
+	}
+	if t.Err != "" {
+		s += ", error: " + t.Err
+	}
+	return s
+}
+
+// roundTiming rounds a duration for display, keeping sub-millisecond precision for short phases
+func roundTiming(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
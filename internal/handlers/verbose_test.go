@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestVerboseMiddleware tests appending the timing breakdown of the requests sent to Loki
+func TestVerboseMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "success", "data": {"resultType": "streams", "result": [` +
+			`{"stream": {"app": "api"}, "values": [["1700000000000000000", "request failed"]]}]}}`))
+	}))
+	t.Cleanup(server.Close)
+	handler := VerboseMiddleware(HandleLokiQuery)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"query":    `{app="api"}`,
+		"url":      strings.Replace(server.URL, "http://", "http://admin:secret@", 1),
+		"username": "admin",
+		"password": "secret",
+		"verbose":  true,
+	}
+	result, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	last := result.Content[len(result.Content)-1].(mcp.TextContent).Text
+
+	for _, want := range []string{
+		"Timing breakdown:\n  GET http://admin:xxxxx@" + strings.TrimPrefix(server.URL, "http://") + "/loki/api/v1/query_range?",
+		"dns ", "connect ", "ttfb ", "status 200",
+		"  decode ", "format ",
+	} {
+		if !strings.Contains(last, want) {
+			t.Errorf("Expected %q in the breakdown:\n%s", want, last)
+		}
+	}
+	if strings.Contains(last, "secret") {
+		t.Errorf("Expected the credentials to be removed from the URL:\n%s", last)
+	}
+	if first := result.Content[0].(mcp.TextContent).Text; !strings.Contains(first, "request failed") {
+		t.Errorf("Expected the query result first, but got:\n%s", first)
+	}
+}
+
+// TestVerboseMiddleware_Error tests appending the timing breakdown to the error of a failed call
+func TestVerboseMiddleware_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too many outstanding requests", http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+	handler := VerboseMiddleware(HandleLokiQuery)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"}`, "url": server.URL, "verbose": true}
+	_, err := handler(context.Background(), request)
+	if err == nil || !strings.Contains(err.Error(), "Timing breakdown:") || !strings.Contains(err.Error(), "status 429") {
+		t.Errorf("Expected the breakdown in the error, but got %v", err)
+	}
+}
+
+// TestVerboseMiddleware_Disabled tests that calls without verbose are passed through unchanged
+func TestVerboseMiddleware_Disabled(t *testing.T) {
+	handler := VerboseMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if verboseFromContext(ctx) != nil {
+			t.Error("Expected no timing recorder in context")
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil || len(result.Content) != 1 {
+		t.Errorf("Expected the result unchanged, got %v, %v", result, err)
+	}
+}
+
+// TestRequestTimingPhases tests rendering the phases of requests
+func TestRequestTimingPhases(t *testing.T) {
+	tests := []struct {
+		timing requestTiming
+		want   string
+	}{
+		{requestTiming{DNS: 1500 * time.Microsecond, Connect: 250 * time.Microsecond, TTFB: 12 * time.Millisecond, Total: 15 * time.Millisecond, Status: 200},
+			"dns 1.5ms, connect 250µs, tls 0s, ttfb 12ms, total 15ms, status 200"},
+		{requestTiming{Reused: true, TTFB: 3 * time.Millisecond, Total: 4 * time.Millisecond, Status: 502},
+			"reused connection, ttfb 3ms, total 4ms, status 502"},
+		{requestTiming{Total: 2 * time.Second, Err: "connection refused"},
+			"dns 0s, connect 0s, tls 0s, ttfb 0s, total 2s, error: connection refused"},
+		{requestTiming{Cached: true}, "served from the response cache"},
+	}
+	for _, tt := range tests {
+		if got := tt.timing.phases(); got != tt.want {
+			t.Errorf("phases() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// patternDiff compares how often a log pattern occurs in two sets of logs
+type patternDiff struct {
+	Pattern  string  `json:"pattern"`
+	OldCount int     `json:"old_count"`
+	NewCount int     `json:"new_count"`
+	OldShare float64 `json:"old_share"` // fraction of the old lines matching the pattern
+	NewShare float64 `json:"new_share"` // fraction of the new lines matching the pattern
+	IsError  bool    `json:"is_error"`
+}
+
+// versionDiffReport is the result of comparing log patterns between two versions
+type versionDiffReport struct {
+	Label      string        `json:"label"`
+	OldVersion string        `json:"old_version"`
+	NewVersion string        `json:"new_version"`
+	OldLines   int           `json:"old_lines"`
+	NewLines   int           `json:"new_lines"`
+	New        []patternDiff `json:"new_patterns"`
+	Gone       []patternDiff `json:"gone_patterns"`
+	Changed    []patternDiff `json:"changed_patterns"`
+}
+
+// NewLokiVersionDiffTool creates and returns a tool for comparing log patterns between two versions
+func NewLokiVersionDiffTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Compare log patterns between an old and a new version of a workload for canary analysis. " +
+			"Lines are grouped into patterns (numbers, IDs and addresses replaced by placeholders) and reported side by side: " +
+			"patterns only seen in the new version (e.g. new error types), patterns that disappeared, and patterns whose frequency changed."),
+		mcp.WithString("selector",
+			mcp.Required(),
+			mcp.Description("Stream selector for the workload, e.g. {app=\"checkout\"}"),
+		),
+		mcp.WithString("label",
+			mcp.Required(),
+			mcp.Description("Label identifying the version, e.g. version or image_tag"),
+		),
+		mcp.WithString("old",
+			mcp.Required(),
+			mcp.Description("Label value of the old version"),
+		),
+		mcp.WithString("new",
+			mcp.Required(),
+			mcp.Description("Label value of the new version"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the comparison (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the comparison (default: now)"),
+		),
+		sinceOption(),
+		untilOption(),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of lines to sample per version (default: 1000)"),
+		),
+		mcp.WithNumber("top",
+			mcp.Description("Maximum number of patterns to show per section (default: 20)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_version_diff", opts...)
+}
+
+// HandleLokiVersionDiff handles Loki version diff tool requests
+func HandleLokiVersionDiff(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	selector, _ := args["selector"].(string)
+	label, _ := args["label"].(string)
+	oldVersion, _ := args["old"].(string)
+	newVersion, _ := args["new"].(string)
+	if selector == "" || label == "" || oldVersion == "" || newVersion == "" {
+		return nil, fmt.Errorf("selector, label, old and new are required")
+	}
+	if !labelNamePattern.MatchString(label) {
+		return nil, fmt.Errorf("invalid label name: %s", label)
+	}
+	selector = applySessionSelector(ctx, selector)
+
+	start, end, err := parseTimeRange(args, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := 1000
+	if limitVal, ok := args["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	top := 20
+	if topVal, ok := args["top"].(float64); ok && topVal > 0 {
+		top = int(topVal)
+	}
+
+	format := formatArg(args)
+
+	conn := ResolveLokiConnection(args)
+	fetch := func(version string) (map[string]int, int, error) {
+		query := mergeSelectorMatchers(selector, []string{label + "=" + quoteLogQLString(version)})
+		result, err := runLokiQuery(ctx, conn, query, start, end, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		lineOptions{}.apply(result)
+		counts, total := countPatterns(result)
+		return counts, total, nil
+	}
+
+	oldCounts, oldTotal, err := fetch(oldVersion)
+	if err != nil {
+		return nil, err
+	}
+	newCounts, newTotal, err := fetch(newVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	report := diffPatterns(oldCounts, oldTotal, newCounts, newTotal, top)
+	report.Label = label
+	report.OldVersion = oldVersion
+	report.NewVersion = newVersion
+
+	formattedResult, err := formatVersionDiff(report, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// diffPatterns compares two pattern count sets. Patterns whose share of lines changed
+// by at least half (or 1 percentage point) are reported as changed.
+func diffPatterns(oldCounts map[string]int, oldTotal int, newCounts map[string]int, newTotal int, top int) versionDiffReport {
+	report := versionDiffReport{OldLines: oldTotal, NewLines: newTotal}
+
+	share := func(count, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(count) / float64(total)
+	}
+	diff := func(pattern string) patternDiff {
+		return patternDiff{
+			Pattern:  pattern,
+			OldCount: oldCounts[pattern],
+			NewCount: newCounts[pattern],
+			OldShare: share(oldCounts[pattern], oldTotal),
+			NewShare: share(newCounts[pattern], newTotal),
+			IsError:  isErrorPattern(pattern),
+		}
+	}
+
+	for _, pc := range sortedPatterns(newCounts) {
+		if oldCounts[pc.Pattern] == 0 {
+			report.New = append(report.New, diff(pc.Pattern))
+			continue
+		}
+		d := diff(pc.Pattern)
+		delta := d.NewShare - d.OldShare
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta >= 0.01 || delta >= d.OldShare/2 {
+			report.Changed = append(report.Changed, d)
+		}
+	}
+	for _, pc := range sortedPatterns(oldCounts) {
+		if newCounts[pc.Pattern] == 0 {
+			report.Gone = append(report.Gone, diff(pc.Pattern))
+		}
+	}
+
+	// List new error patterns first, they are what canary analysis is looking for
+	errorsFirst := func(diffs []patternDiff) []patternDiff {
+		sorted := make([]patternDiff, 0, len(diffs))
+		for _, d := range diffs {
+			if d.IsError {
+				sorted = append(sorted, d)
+			}
+		}
+		for _, d := range diffs {
+			if !d.IsError {
+				sorted = append(sorted, d)
+			}
+		}
+		if len(sorted) > top {
+			sorted = sorted[:top]
+		}
+		return sorted
+	}
+	report.New = errorsFirst(report.New)
+	report.Gone = errorsFirst(report.Gone)
+	report.Changed = errorsFirst(report.Changed)
+
+	return report
+}
+
+// formatVersionDiff formats the version diff report into a readable string
+func formatVersionDiff(report versionDiffReport, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		output := fmt.Sprintf("Comparing %s=%s (%d lines) with %s=%s (%d lines)\n",
+			report.Label, report.OldVersion, report.OldLines, report.Label, report.NewVersion, report.NewLines)
+		if report.OldLines == 0 || report.NewLines == 0 {
+			output += "Warning: one of the versions has no logs in the selected window\n"
+		}
+
+		section := func(title string, diffs []patternDiff) {
+			output += fmt.Sprintf("\n%s (%d):\n", title, len(diffs))
+			if len(diffs) == 0 {
+				output += "  none\n"
+				return
+			}
+			for _, d := range diffs {
+				marker := "  "
+				if d.IsError {
+					marker = "! "
+				}
+				output += fmt.Sprintf("%sold=%d (%.1f%%) new=%d (%.1f%%)  %s\n",
+					marker, d.OldCount, d.OldShare*100, d.NewCount, d.NewShare*100, d.Pattern)
+			}
+		}
+		section(fmt.Sprintf("New patterns in %s", report.NewVersion), report.New)
+		section(fmt.Sprintf("Patterns gone in %s", report.NewVersion), report.Gone)
+		section("Patterns with changed frequency", report.Changed)
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
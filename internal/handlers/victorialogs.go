@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VictoriaLogsClient is the LokiClient of the victorialogs backend. It translates the LogQL of
+// the tools to LogsQL and calls the VictoriaLogs HTTP API, with the same failover, query policy
+// and dry run handling as Loki requests.
+//
+// Log queries support a stream selector, line filters, the json and logfmt parsers and label
+// filters. Metric queries support count_over_time and rate, optionally summed by labels.
+type VictoriaLogsClient struct{}
+
+// victoriaLogsLabelFilterPattern matches a label filter stage such as level="error" or status >= 500
+var victoriaLogsLabelFilterPattern = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|==|>=|<=|=|>|<)\s*(.+)$`)
+
+// victoriaLogsParserPattern matches the LogQL parsers the backend supports at the start of a stage
+var victoriaLogsParserPattern = regexp.MustCompile(`^(json|logfmt)\b`)
+
+// victoriaLogsMetricPattern matches the metric queries the backend supports:
+// [sum [by (labels)]] (count_over_time|rate)(log query [range]) [by (labels)]
+var victoriaLogsMetricPattern = regexp.MustCompile(`^\s*(sum\s*(?:by\s*\(([^)]*)\)\s*)?\(\s*)?(count_over_time|rate)\s*\(\s*(.+?)\s*\[(\w+)\]\s*\)\s*(\)\s*(?:by\s*\(([^)]*)\)\s*)?)?$`)
+
+// Query implements LokiClient
+func (VictoriaLogsClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	logsQL, err := translateLogQL(query)
+	if err != nil {
+		return nil, err
+	}
+	order := "_time desc"
+	if QueryDirection(ctx) == "forward" {
+		order = "_time"
+	}
+	logsQL += " | sort by (" + order + ")"
+	if limit > 0 {
+		logsQL += " limit " + strconv.Itoa(limit)
+	}
+
+	body, err := executeVictoriaLogsRequest(ctx, conn, "query", url.Values{"query": {logsQL}}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return parseVictoriaLogsEntries(body)
+}
+
+// MetricQuery implements LokiClient. Counts are taken per step instead of over the range of the
+// query, and rates divide them by the step.
+func (VictoriaLogsClient) MetricQuery(ctx context.Context, conn LokiConnection, query string, start, end time.Time, step time.Duration) (*LokiMetricResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	m := victoriaLogsMetricPattern.FindStringSubmatch(query)
+	if m == nil || (m[1] == "") != (m[6] == "") || (m[2] != "" && m[7] != "") {
+		return nil, fmt.Errorf("the victorialogs backend supports count_over_time and rate metric queries, optionally summed by labels: %s", query)
+	}
+	logsQL, err := translateLogQL(m[4])
+	if err != nil {
+		return nil, err
+	}
+	by := "_stream"
+	if m[1] != "" {
+		by = strings.TrimSpace(m[2] + m[7])
+	}
+	if by == "" {
+		logsQL += " | stats count() hits"
+	} else {
+		logsQL += " | stats by (" + by + ") count() hits"
+	}
+	if step <= 0 {
+		step = time.Minute
+	}
+
+	params := url.Values{"query": {logsQL}, "step": {formatLogQLDuration(step)}}
+	body, err := executeVictoriaLogsRequest(ctx, conn, "stats_query_range", params, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var result LokiMetricResult
+	if err := decodeLokiResponse(ctx, body, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "error" {
+		return nil, newLokiError(0, []byte(result.Error))
+	}
+
+	for i := range result.Data.Result {
+		series := &result.Data.Result[i]
+		delete(series.Metric, "__name__")
+		if stream, ok := series.Metric["_stream"]; ok && by == "_stream" {
+			series.Metric = parseVictoriaLogsStream(stream)
+		}
+		if m[3] == "rate" {
+			for _, sample := range series.Values {
+				if len(sample) < 2 {
+					continue
+				}
+				if s, ok := sample[1].(string); ok {
+					if v, err := strconv.ParseFloat(s, 64); err == nil {
+						sample[1] = strconv.FormatFloat(v/step.Seconds(), 'f', -1, 64)
+					}
+				}
+			}
+		}
+	}
+	return &result, nil
+}
+
+// Labels implements LokiClient, listing the stream fields
+func (VictoriaLogsClient) Labels(ctx context.Context, conn LokiConnection, start, end time.Time) (*LokiLabelsResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	values, err := victoriaLogsValues(ctx, conn, "stream_field_names", url.Values{"query": {"*"}}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &LokiLabelsResult{Status: "success", Data: values}, nil
+}
+
+// LabelValues implements LokiClient, listing the values of a stream field
+func (VictoriaLogsClient) LabelValues(ctx context.Context, conn LokiConnection, label string, start, end time.Time) (*LokiLabelValuesResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	values, err := victoriaLogsValues(ctx, conn, "stream_field_values", url.Values{"query": {"*"}, "field": {label}}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &LokiLabelValuesResult{Status: "success", Data: values}, nil
+}
+
+// Series implements LokiClient
+func (VictoriaLogsClient) Series(ctx context.Context, conn LokiConnection, selector string, start, end time.Time) (*LokiSeriesResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	logsQL, err := translateLogQL(selector)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := victoriaLogsValues(ctx, conn, "streams", url.Values{"query": {logsQL}}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	result := &LokiSeriesResult{Status: "success", Data: make([]map[string]string, 0, len(streams))}
+	for _, stream := range streams {
+		result.Data = append(result.Data, parseVictoriaLogsStream(stream))
+	}
+	return result, nil
+}
+
+// DetectedFields implements LokiClient, listing the fields of the matching entries other than
+// the stream fields. VictoriaLogs stores every field as a string, without a cardinality.
+func (VictoriaLogsClient) DetectedFields(ctx context.Context, conn LokiConnection, query string, start, end time.Time) (*LokiDetectedFieldsResult, error) {
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	logsQL, err := translateLogQL(query)
+	if err != nil {
+		return nil, err
+	}
+	names, err := victoriaLogsValues(ctx, conn, "field_names", url.Values{"query": {logsQL}}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := victoriaLogsValues(ctx, conn, "stream_field_names", url.Values{"query": {logsQL}}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	streamFields := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		streamFields[label] = true
+	}
+
+	result := &LokiDetectedFieldsResult{}
+	for _, name := range names {
+		if strings.HasPrefix(name, "_") || streamFields[name] {
+			continue
+		}
+		result.Fields = append(result.Fields, LokiDetectedField{Label: name, Type: "string"})
+	}
+	return result, nil
+}
+
+// tenantHeadersKey is the context key for the headers selecting the tenant of a request to a
+// backend that doesn't use X-Scope-OrgID
+type tenantHeadersKey struct{}
+
+// victoriaLogsTenantHeaders returns the AccountID and ProjectID headers selecting the VictoriaLogs
+// tenant of an org ID, written AccountID or AccountID:ProjectID as vmauth does, e.g. 12 or 12:3
+func victoriaLogsTenantHeaders(orgID string) (http.Header, error) {
+	account, project, _ := strings.Cut(orgID, ":")
+	if project == "" {
+		project = "0"
+	}
+	for _, id := range []string{account, project} {
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid VictoriaLogs tenant %q: the org ID must be AccountID or AccountID:ProjectID, e.g. 12 or 12:3", orgID)
+		}
+	}
+	headers := http.Header{}
+	headers.Set("AccountID", account)
+	headers.Set("ProjectID", project)
+	return headers, nil
+}
+
+// applyTenantHeaders replaces the X-Scope-OrgID header of a request to a backend selecting
+// tenants with headers of its own
+func applyTenantHeaders(ctx context.Context, req *http.Request) {
+	headers, ok := ctx.Value(tenantHeadersKey{}).(http.Header)
+	if !ok {
+		return
+	}
+	req.Header.Del("X-Scope-OrgID")
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+}
+
+// executeVictoriaLogsRequest sends a request to a VictoriaLogs LogsQL endpoint over the given
+// window, given in Unix nanoseconds like to Loki so the time range limits apply. The org ID is
+// checked against the access policy like a Loki tenant, and sent as the AccountID and ProjectID
+// headers.
+func executeVictoriaLogsRequest(ctx context.Context, conn LokiConnection, endpoint string, params url.Values, start, end time.Time) ([]byte, error) {
+	if conn.OrgID != "" {
+		headers, err := victoriaLogsTenantHeaders(conn.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, tenantHeadersKey{}, headers)
+	}
+	u, err := url.Parse(conn.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build VictoriaLogs URL: %v", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/select/logsql/" + endpoint
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	u.RawQuery = params.Encode()
+	return executeLokiRequest(ctx, u.String(), conn.Username, conn.Password, conn.Token, conn.OrgID)
+}
+
+// victoriaLogsValues calls an endpoint listing values with their hits, returning the values
+func victoriaLogsValues(ctx context.Context, conn LokiConnection, endpoint string, params url.Values, start, end time.Time) ([]string, error) {
+	body, err := executeVictoriaLogsRequest(ctx, conn, endpoint, params, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Values []struct {
+			Value string `json:"value"`
+		} `json:"values"`
+	}
+	if err := decodeLokiResponse(ctx, body, &response); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(response.Values))
+	for _, v := range response.Values {
+		values = append(values, v.Value)
+	}
+	return values, nil
+}
+
+// parseVictoriaLogsEntries converts the JSON Lines response of a LogsQL query to a log query
+// result, grouping the entries into streams in the order they were returned
+func parseVictoriaLogsEntries(body []byte) (*LokiResult, error) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{}}}
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry struct {
+			Time   time.Time `json:"_time"`
+			Stream string    `json:"_stream"`
+			Msg    string    `json:"_msg"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse VictoriaLogs response: %v", err)
+		}
+		i, ok := index[entry.Stream]
+		if !ok {
+			i = len(result.Data.Result)
+			index[entry.Stream] = i
+			result.Data.Result = append(result.Data.Result, LokiEntry{Stream: parseVictoriaLogsStream(entry.Stream)})
+		}
+		stream := &result.Data.Result[i]
+		stream.Values = append(stream.Values, []string{strconv.FormatInt(entry.Time.UnixNano(), 10), entry.Msg})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read VictoriaLogs response: %v", err)
+	}
+	return result, nil
+}
+
+// parseVictoriaLogsStream parses a stream such as {app="api",env="prod"} into its labels
+func parseVictoriaLogsStream(stream string) map[string]string {
+	labels := make(map[string]string)
+	stream = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(stream), "{"), "}")
+	for _, part := range splitOutsideQuotes(stream, ',') {
+		if name, _, value, err := parseLabelMatcher(strings.TrimSpace(part)); err == nil {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// translateLogQL translates a LogQL log query to LogsQL: the stream selector to a stream filter,
+// line filters to filters on the message, the json and logfmt parsers to unpack pipes, and label
+// filters to field filters
+func translateLogQL(query string) (string, error) {
+	rest := strings.TrimSpace(query)
+	end := selectorEnd(rest)
+	if end < 0 {
+		return "", fmt.Errorf("the victorialogs backend needs a query starting with a stream selector: %s", query)
+	}
+	matchers, err := parseContextMatchers(rest[:end+1])
+	if err != nil {
+		return "", err
+	}
+	parts := []string{"{" + strings.Join(matchers, ",") + "}"}
+
+	// Filters after a pipe go in a filter pipe
+	piped := false
+	addFilter := func(filter string) {
+		if piped {
+			filter = "| filter " + filter
+		}
+		parts = append(parts, filter)
+	}
+	for rest = strings.TrimSpace(rest[end+1:]); rest != ""; rest = strings.TrimSpace(rest) {
+		if op := rest[:min(2, len(rest))]; op == "|=" || op == "!=" || op == "|~" || op == "!~" {
+			quoted, err := strconv.QuotedPrefix(strings.TrimSpace(rest[2:]))
+			if err != nil {
+				return "", fmt.Errorf("invalid line filter %s: expected a quoted string", rest)
+			}
+			value, _ := strconv.Unquote(quoted)
+			rest = strings.TrimSpace(rest[2:])[len(quoted):]
+			if value == "" {
+				continue
+			}
+			pattern := value
+			if op[1] == '=' {
+				pattern = regexp.QuoteMeta(value)
+			}
+			filter := "~" + strconv.Quote(pattern)
+			if op[0] == '!' {
+				filter = "NOT " + filter
+			}
+			addFilter(filter)
+			continue
+		}
+		if rest[0] != '|' {
+			return "", fmt.Errorf("unsupported LogQL for the victorialogs backend: %s", rest)
+		}
+
+		rest = strings.TrimSpace(rest[1:])
+		if parser := victoriaLogsParserPattern.FindString(rest); parser != "" {
+			parts = append(parts, "| unpack_"+parser)
+			piped = true
+			rest = rest[len(parser):]
+			continue
+		}
+		stage := splitOutsideQuotes(rest, '|')[0]
+		rest = rest[len(stage):]
+		stage = strings.TrimSpace(stage)
+		filter, err := translateLabelFilter(stage)
+		if err != nil {
+			return "", err
+		}
+		addFilter(filter)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// translateLabelFilter translates a LogQL label filter stage to a LogsQL field filter
+func translateLabelFilter(stage string) (string, error) {
+	m := victoriaLogsLabelFilterPattern.FindStringSubmatch(stage)
+	if m == nil {
+		return "", fmt.Errorf("LogQL stage | %s is not supported by the victorialogs backend", stage)
+	}
+	name, op, value := m[1], m[2], strings.TrimSpace(m[3])
+	switch op {
+	case ">", ">=", "<", "<=":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("the victorialogs backend supports numeric comparisons only: | %s", stage)
+		}
+		return name + ":" + op + value, nil
+	}
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid label filter | %s: expected a quoted string", stage)
+	}
+	filter := name + ":=" + strconv.Quote(unquoted)
+	if op == "=~" || op == "!~" {
+		// LogQL regular expressions match the whole value
+		filter = name + ":~" + strconv.Quote("^(?:"+unquoted+")$")
+	}
+	if op[0] == '!' {
+		filter = "NOT " + filter
+	}
+	return filter, nil
+}
+
+// selectorEnd returns the index of the brace closing the stream selector a query starts with, or -1
+func selectorEnd(query string) int {
+	if !strings.HasPrefix(query, "{") {
+		return -1
+	}
+	var quote rune
+	escaped := false
+	for i, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == '}':
+			return i
+		}
+	}
+	return -1
+}
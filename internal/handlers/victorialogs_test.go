@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestTranslateLogQL tests translating LogQL log queries to LogsQL
+func TestTranslateLogQL(t *testing.T) {
+	for query, want := range map[string]string{
+		`{app="api"}`: `{app="api"}`,
+		`{app="api", env=~"prod|staging"} |= "timeout"`: `{app="api",env=~"prod|staging"} ~"timeout"`,
+		`{app="api"} != "GET /health" |~ "5\\d\\d"`:     `{app="api"} NOT ~"GET /health" ~"5\\d\\d"`,
+		`{app="api"} |= "a.b" | json | level="error"`:   `{app="api"} ~"a\\.b" | unpack_json | filter level:="error"`,
+		`{app="api"} | logfmt | status >= 500 |~ "ok"`:  `{app="api"} | unpack_logfmt | filter status:>=500 | filter ~"ok"`,
+		"{app=\"api\"} | json | path!~`/health.*`":      `{app="api"} | unpack_json | filter NOT path:~"^(?:/health.*)$"`,
+	} {
+		got, err := translateLogQL(query)
+		if err != nil {
+			t.Errorf("translateLogQL(%s): %v", query, err)
+		} else if got != want {
+			t.Errorf("translateLogQL(%s) = %s, want %s", query, got, want)
+		}
+	}
+
+	for query, want := range map[string]string{
+		`app="api"`:                          "needs a query starting with a stream selector",
+		`{app="api"} | line_format "{{.x}}"`: "is not supported by the victorialogs backend",
+		`{app="api"} | json | latency > 1s`:  "numeric comparisons only",
+	} {
+		if _, err := translateLogQL(query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("translateLogQL(%s) = %v, want an error containing %q", query, err, want)
+		}
+	}
+}
+
+// setVictoriaLogsDatasource installs a default victorialogs datasource served by handler
+func setVictoriaLogsDatasource(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	SetConfig(&Config{LokiURL: DefaultLokiURL, Datasources: []Datasource{
+		{Name: "vlogs", URL: server.URL, Backend: BackendVictoriaLogs, Default: true},
+	}})
+	t.Cleanup(func() { activeConfig.Store(nil) })
+}
+
+// TestVictoriaLogsClient_Query tests running a log query against VictoriaLogs
+func TestVictoriaLogsClient_Query(t *testing.T) {
+	var got string
+	setVictoriaLogsDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/select/logsql/query" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		r.ParseForm()
+		got = r.Form.Get("query")
+		if _, nanos, ok := parseLokiTimestamp(r.Form.Get("start")); !ok || !nanos {
+			t.Errorf("Expected the start in Unix nanoseconds, but got %s", r.Form.Get("start"))
+		}
+		w.Write([]byte(`{"_time":"2024-05-01T10:00:02Z","_stream":"{app=\"api\",env=\"prod\"}","_msg":"upstream timeout","level":"error"}` + "\n" +
+			`{"_time":"2024-05-01T10:00:01Z","_stream":"{app=\"api\",env=\"prod\"}","_msg":"retrying timeout"}` + "\n"))
+	})
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": `{app="api"} |= "timeout"`, "limit": float64(10), "format": "json"}
+	result, err := HandleLokiQuery(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if want := `{app="api"} ~"timeout" | sort by (_time desc) limit 10`; got != want {
+		t.Errorf("Expected LogsQL %s, but got %s", want, got)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{`"env": "prod"`, "upstream timeout", "retrying timeout", "1714557602000000000"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in:\n%s", want, text)
+		}
+	}
+}
+
+// TestVictoriaLogsClient_MetricQuery tests running count_over_time and rate queries as LogsQL stats
+func TestVictoriaLogsClient_MetricQuery(t *testing.T) {
+	var got string
+	setVictoriaLogsDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r.Form.Get("query")
+		if r.URL.Path != "/select/logsql/stats_query_range" || r.Form.Get("step") != "1m" {
+			t.Errorf("Unexpected request: %s step=%s", r.URL.Path, r.Form.Get("step"))
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"__name__":"hits","level":"error"},"values":[[1714557600,"120"]]}]}}`))
+	})
+
+	client := VictoriaLogsClient{}
+	conn := ResolveLokiConnection(map[string]any{})
+	end := time.Unix(1714557600, 0)
+	result, err := client.MetricQuery(context.Background(), conn, `sum by (level) (rate({app="api"} | json [5m]))`, end.Add(-time.Hour), end, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if want := `{app="api"} | unpack_json | stats by (level) count() hits`; got != want {
+		t.Errorf("Expected LogsQL %s, but got %s", want, got)
+	}
+	series := result.Data.Result[0]
+	if _, ok := series.Metric["__name__"]; ok || series.Metric["level"] != "error" || series.Values[0][1] != "2" {
+		t.Errorf("Expected a rate of 2 per second for level=error, but got %+v", series)
+	}
+
+	if _, err := client.MetricQuery(context.Background(), conn, `topk(5, count_over_time({app="api"}[5m]))`, end.Add(-time.Hour), end, time.Minute); err == nil {
+		t.Error("Expected an error for an unsupported metric query")
+	}
+}
+
+// TestVictoriaLogsClient_Series tests listing streams and stream fields
+func TestVictoriaLogsClient_Series(t *testing.T) {
+	setVictoriaLogsDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/select/logsql/streams":
+			w.Write([]byte(`{"values":[{"value":"{app=\"api\",pod=\"api-1\"}","hits":10},{"value":"{app=\"api\",pod=\"api-2\"}","hits":4}]}`))
+		case "/select/logsql/stream_field_names":
+			w.Write([]byte(`{"values":[{"value":"app","hits":14},{"value":"pod","hits":14}]}`))
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	client := VictoriaLogsClient{}
+	conn := ResolveLokiConnection(map[string]any{})
+	now := time.Now()
+	series, err := client.Series(context.Background(), conn, `{app="api"}`, now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(series.Data) != 2 || series.Data[1]["pod"] != "api-2" {
+		t.Errorf("Unexpected series: %+v", series.Data)
+	}
+	labels, err := client.Labels(context.Background(), conn, now.Add(-time.Hour), now)
+	if err != nil || strings.Join(labels.Data, ",") != "app,pod" {
+		t.Errorf("Unexpected labels: %+v, %v", labels, err)
+	}
+}
+
+// TestVictoriaLogsClient_Tenant tests selecting the VictoriaLogs tenant of the org ID with the
+// AccountID and ProjectID headers
+func TestVictoriaLogsClient_Tenant(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	setVictoriaLogsDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.Write([]byte(`{"values":[{"value":"app","hits":1}]}`))
+	})
+
+	for org, want := range map[string][2]string{"12:3": {"12", "3"}, "7": {"7", "0"}} {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"org": org}
+		if _, err := HandleLokiLabelNames(context.Background(), request); err != nil {
+			t.Fatalf("Expected no error for org %s, but got %v", org, err)
+		}
+		h := <-headers
+		if h.Get("AccountID") != want[0] || h.Get("ProjectID") != want[1] || h.Get("X-Scope-OrgID") != "" {
+			t.Errorf("Expected org %s to select AccountID %s and ProjectID %s, but got %v", org, want[0], want[1], h)
+		}
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"org": "team-a"}
+	if _, err := HandleLokiLabelNames(context.Background(), request); err == nil || !strings.Contains(err.Error(), "invalid VictoriaLogs tenant") {
+		t.Errorf("Expected an invalid tenant error, but got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// warningsKey is the context key for the warnings collected during a tool call
+type warningsKey struct{}
+
+// toolWarnings collects warnings raised while handling a tool call
+type toolWarnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// addWarning records a warning for the current tool call, ignoring duplicates
+func addWarning(ctx context.Context, message string) {
+	w, ok := ctx.Value(warningsKey{}).(*toolWarnings)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !slices.Contains(w.messages, message) {
+		w.messages = append(w.messages, message)
+	}
+}
+
+// WarningsMiddleware appends the warnings raised during a tool call to its result
+func WarningsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		w := &toolWarnings{}
+		result, err := next(context.WithValue(ctx, warningsKey{}, w), request)
+		if err != nil || result == nil {
+			return result, err
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, message := range w.messages {
+			result.Content = append(result.Content, mcp.NewTextContent("Warning: "+message))
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestWarningsMiddleware tests that warnings raised by a handler are appended to its result once
+func TestWarningsMiddleware(t *testing.T) {
+	handler := WarningsMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		addWarning(ctx, "slow query")
+		addWarning(ctx, "slow query")
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("Expected result and one warning, but got %d content items", len(result.Content))
+	}
+	if text := result.Content[1].(mcp.TextContent).Text; text != "Warning: slow query" {
+		t.Errorf("Unexpected warning: %s", text)
+	}
+
+	// Warnings outside a tool call are ignored
+	addWarning(context.Background(), "ignored")
+}
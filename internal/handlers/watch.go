@@ -0,0 +1,537 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Watch polling limits
+const (
+	defaultWatchInterval = time.Minute
+	minWatchInterval     = 10 * time.Second
+	defaultWatchWindow   = 5 * time.Minute
+	maxWatches           = 50
+)
+
+// Watch states reported in notifications
+const (
+	watchFiring   = "firing"
+	watchResolved = "resolved"
+)
+
+// watchConditions maps the supported threshold comparisons to their check
+var watchConditions = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+}
+
+// watch is a query polled in the background and compared against a threshold
+type watch struct {
+	ID        string
+	Name      string
+	Query     string // metric query evaluated at each poll
+	Condition string
+	Threshold float64
+	Interval  time.Duration
+	Window    time.Duration
+	Sinks     []NotificationSink
+	CreatedAt time.Time
+	logQuery  string // the watched log query, sampled for matched lines when firing
+	conn      LokiConnection
+	server    *server.MCPServer // server and session to notify, nil when not created over MCP
+	sessionID string            // session that created the watch, the only one that may list or delete it
+	cancel    context.CancelFunc
+
+	mu          sync.Mutex
+	lastValue   float64
+	lastChecked time.Time
+	lastError   string
+	firing      bool
+	firedAt     time.Time
+}
+
+// watchStatus is a snapshot of a watch for listing
+type watchStatus struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Query       string   `json:"query"`
+	Condition   string   `json:"condition"`
+	Threshold   float64  `json:"threshold"`
+	Interval    string   `json:"interval"`
+	Sinks       []string `json:"sinks,omitempty"`
+	State       string   `json:"state"`
+	LastValue   float64  `json:"last_value"`
+	LastChecked string   `json:"last_checked,omitempty"`
+	LastError   string   `json:"last_error,omitempty"`
+	FiringSince string   `json:"firing_since,omitempty"`
+}
+
+// watchStore holds the active watches keyed by ID
+type watchStore struct {
+	mu      sync.Mutex
+	watches map[string]*watch
+	nextID  int
+}
+
+var watches = &watchStore{watches: make(map[string]*watch)}
+
+// add registers a watch and starts polling it with the identity and access scope of the caller
+// that created it
+func (s *watchStore) add(ctx context.Context, w *watch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.watches) >= maxWatches {
+		return fmt.Errorf("too many watches (maximum %d); delete one with loki_watch_delete first", maxWatches)
+	}
+	s.nextID++
+	w.ID = fmt.Sprintf("watch-%d", s.nextID)
+
+	ctx, cancel := context.WithCancel(detachedCallerContext(ctx))
+	w.cancel = cancel
+	s.watches[w.ID] = w
+	go w.run(ctx)
+	return nil
+}
+
+// remove stops and deletes a watch created by the session, reporting whether it existed
+func (s *watchStore) remove(id, sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.watches[id]
+	if !ok || w.sessionID != sessionID {
+		return false
+	}
+	w.cancel()
+	delete(s.watches, id)
+	return true
+}
+
+// list returns the active watches created by the session, ordered by creation
+func (s *watchStore) list(sessionID string) []*watch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*watch, 0, len(s.watches))
+	for _, w := range s.watches {
+		if w.sessionID == sessionID {
+			list = append(list, w)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// StopWatches stops polling all watches, for use at server shutdown
+func StopWatches() {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	for id, w := range watches.watches {
+		w.cancel()
+		delete(watches.watches, id)
+	}
+}
+
+// NewLokiWatchCreateTool creates and returns a tool for registering a polled query with a threshold
+func NewLokiWatchCreateTool() mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Register a query to be polled by the server at an interval and compared against a threshold, " +
+			"for ad-hoc alerting during incidents. When the condition starts or stops holding, an MCP log notification is " +
+			"sent to this session and the optional webhook, Slack or PagerDuty sink is notified."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL query to watch. A log query such as {app=\"api\"} |= \"error\" counts its lines over the window; "+
+				"a metric query such as sum(rate({app=\"api\"}[1m])) is evaluated as is"),
+		),
+		mcp.WithNumber("threshold",
+			mcp.Required(),
+			mcp.Description("Value the query result is compared against"),
+		),
+		mcp.WithString("condition",
+			mcp.Description("Comparison that triggers the watch (default: >)"),
+			mcp.Enum(">", ">=", "<", "<="),
+		),
+		mcp.WithString("window",
+			mcp.Description("Window over which log lines are counted, e.g. 5m (default: 5m)"),
+		),
+		mcp.WithString("interval",
+			mcp.Description("How often to poll, at least 10s (default: 1m)"),
+		),
+		mcp.WithString("webhook",
+			mcp.Description("URL to POST a notification to when the watch fires or resolves"),
+		),
+		mcp.WithString("webhook_type",
+			mcp.Description("How the notification is sent: webhook posts the notification as JSON, slack posts a message to a "+
+				"Slack incoming webhook, pagerduty triggers and resolves a PagerDuty incident (default: webhook)"),
+			mcp.Enum(SinkWebhook, SinkSlack, SinkPagerDuty),
+		),
+		mcp.WithString("routing_key",
+			mcp.Description("PagerDuty integration key, required for the pagerduty webhook type"),
+		),
+		mcp.WithString("template",
+			mcp.Description("Go text/template rendered with the notification fields (.Name, .Query, .State, .Value, .Threshold, "+
+				".Count, .Lines, ...), replacing the webhook body, the Slack message or the PagerDuty summary"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Name for the watch, shown in notifications"),
+		),
+	}
+	opts = append(opts, LokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_watch_create", opts...)
+}
+
+// NewLokiWatchListTool creates and returns a tool for listing the registered watches
+func NewLokiWatchListTool() mcp.Tool {
+	return mcp.NewTool("loki_watch_list",
+		mcp.WithDescription("List the watches this session registered with loki_watch_create, with their last value and state"),
+		mcp.WithString("format",
+			mcp.Description("Output format: raw, json, or text (default: raw)"),
+			mcp.DefaultString("raw"),
+		),
+	)
+}
+
+// NewLokiWatchDeleteTool creates and returns a tool for deleting a watch
+func NewLokiWatchDeleteTool() mcp.Tool {
+	return mcp.NewTool("loki_watch_delete",
+		mcp.WithDescription("Stop and delete a watch this session registered with loki_watch_create"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the watch, e.g. watch-1"),
+		),
+	)
+}
+
+// HandleLokiWatchCreate handles Loki watch create tool requests
+func HandleLokiWatchCreate(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := applySessionContext(ctx, request.GetArguments())
+	query, _ := args["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	threshold, ok := args["threshold"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("threshold is required")
+	}
+
+	condition := ">"
+	if conditionArg, ok := args["condition"].(string); ok && conditionArg != "" {
+		if _, ok := watchConditions[conditionArg]; !ok {
+			return nil, fmt.Errorf("unsupported condition: %s. Supported conditions: >, >=, <, <=", conditionArg)
+		}
+		condition = conditionArg
+	}
+
+	window, err := durationArg(args, "window", defaultWatchWindow)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := durationArg(args, "interval", defaultWatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval < minWatchInterval {
+		return nil, fmt.Errorf("interval must be at least %s", minWatchInterval)
+	}
+
+	sink := NotificationSink{}
+	sink.URL, _ = args["webhook"].(string)
+	sink.Type, _ = args["webhook_type"].(string)
+	sink.RoutingKey, _ = args["routing_key"].(string)
+	sink.Template, _ = args["template"].(string)
+	var sinks []NotificationSink
+	if sink.URL != "" || sink.RoutingKey != "" || sink.Type != "" {
+		if err := sink.validate(); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	query = applySessionSelector(ctx, query)
+	w := &watch{
+		Query:     watchExpression(query, window),
+		Condition: condition,
+		Threshold: threshold,
+		Interval:  interval,
+		Window:    window,
+		Sinks:     sinks,
+		CreatedAt: time.Now(),
+		conn:      ResolveLokiConnection(args),
+		server:    server.ServerFromContext(ctx),
+	}
+	if w.Query != query {
+		w.logQuery = query
+	}
+	w.Name, _ = args["name"].(string)
+	w.sessionID = watchSessionID(ctx)
+
+	// Evaluate once up front so that invalid queries fail now rather than in the background
+	value, err := w.evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.record(value, nil)
+
+	if err := watches.add(ctx, w); err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Created %s: %s %s %s, polled every %s (current value: %s)",
+		w.ID, w.Query, condition, strconv.FormatFloat(threshold, 'f', -1, 64), interval,
+		strconv.FormatFloat(value, 'f', -1, 64))), nil
+}
+
+// HandleLokiWatchList handles Loki watch list tool requests
+func HandleLokiWatchList(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	format := formatArg(request.GetArguments())
+
+	statuses := []watchStatus{}
+	for _, w := range watches.list(watchSessionID(ctx)) {
+		statuses = append(statuses, w.status())
+	}
+
+	formattedResult, err := formatWatchList(statuses, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	return mcp.NewToolResultText(formattedResult), nil
+}
+
+// HandleLokiWatchDelete handles Loki watch delete tool requests
+func HandleLokiWatchDelete(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, _ := request.GetArguments()["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	if !watches.remove(id, watchSessionID(ctx)) {
+		return nil, fmt.Errorf("watch %s not found", id)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Deleted %s", id)), nil
+}
+
+// watchSessionID returns the ID of the MCP session the request belongs to, empty outside a session
+func watchSessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// watchExpression turns a log query into a count of its lines over the window,
+// leaving metric queries untouched
+func watchExpression(query string, window time.Duration) string {
+	query = strings.TrimSpace(query)
+	if strings.HasPrefix(query, "{") {
+		return fmt.Sprintf("sum(count_over_time(%s [%s]))", query, formatLogQLDuration(window))
+	}
+	return query
+}
+
+// run polls the watch until its context is cancelled
+func (w *watch) run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, w.Interval)
+			w.check(checkCtx)
+			cancel()
+		}
+	}
+}
+
+// check evaluates the watch once, notifying when it starts or stops firing
+func (w *watch) check(ctx context.Context) {
+	value, err := w.evaluate(ctx)
+	if ctx.Err() != nil && err != nil {
+		return
+	}
+	if state := w.record(value, err); state != "" {
+		w.notify(ctx, state, value)
+	}
+}
+
+// evaluate runs the watch query over the window ending now and returns the latest value,
+// summed across series. A query without samples evaluates to 0.
+func (w *watch) evaluate(ctx context.Context) (float64, error) {
+	end := time.Now()
+	result, err := runLokiMetricQuery(ctx, w.conn, w.Query, end.Add(-w.Window), end, w.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	sums := result.sumByTime()
+	for ts := range sums {
+		latest = max(latest, ts)
+	}
+	return sums[latest], nil
+}
+
+// record stores the result of an evaluation and returns the new state when the
+// watch started or stopped firing, or an empty string when nothing changed
+func (w *watch) record(value float64, err error) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastChecked = time.Now()
+	if err != nil {
+		w.lastError = err.Error()
+		return ""
+	}
+	w.lastError = ""
+	w.lastValue = value
+
+	firing := watchConditions[w.Condition](value, w.Threshold)
+	if firing == w.firing {
+		return ""
+	}
+	w.firing = firing
+	if firing {
+		w.firedAt = w.lastChecked
+		return watchFiring
+	}
+	return watchResolved
+}
+
+// notify sends an MCP log notification to the session that created the watch and notifies its sinks
+func (w *watch) notify(ctx context.Context, state string, value float64) {
+	n := notification{
+		Source:    "watch",
+		ID:        w.ID,
+		Name:      w.Name,
+		Query:     w.Query,
+		State:     state,
+		Condition: w.Condition,
+		Threshold: w.Threshold,
+		Value:     value,
+		Time:      time.Now().UTC().Format(time.RFC3339),
+	}
+	if w.logQuery != "" {
+		n.Count = int(value)
+		if state == watchFiring {
+			n.Lines = w.sampleLines(ctx)
+		}
+	}
+
+	if w.server != nil && w.sessionID != "" {
+		level := mcp.LoggingLevelWarning
+		if state == watchResolved {
+			level = mcp.LoggingLevelInfo
+		}
+		err := w.server.SendNotificationToSpecificClient(w.sessionID, "notifications/message", map[string]any{
+			"level":  level,
+			"logger": "loki_watch",
+			"data":   n,
+		})
+		if err != nil {
+			slog.Warn("watch notification failed", "watch", w.ID, "error", err)
+		}
+	}
+
+	sendNotifications(ctx, w.Sinks, n)
+}
+
+// sampleLines returns the most recent lines matching the watched log query within the window
+func (w *watch) sampleLines(ctx context.Context) []string {
+	end := time.Now()
+	result, err := runLokiQuery(ctx, w.conn, w.logQuery, end.Add(-w.Window), end, maxNotificationLines)
+	if err != nil {
+		slog.Warn("failed to sample watch lines", "watch", w.ID, "error", err)
+		return nil
+	}
+	var lines []string
+	for _, entry := range sortedLogEntries(result) {
+		lines = append(lines, entry.Line)
+	}
+	return lines
+}
+
+// status returns a snapshot of the watch for listing
+func (w *watch) status() watchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := watchStatus{
+		ID:        w.ID,
+		Name:      w.Name,
+		Query:     w.Query,
+		Condition: w.Condition,
+		Threshold: w.Threshold,
+		Interval:  w.Interval.String(),
+		State:     "ok",
+		LastValue: w.lastValue,
+		LastError: w.lastError,
+	}
+	for _, sink := range w.Sinks {
+		status.Sinks = append(status.Sinks, sink.String())
+	}
+	if !w.lastChecked.IsZero() {
+		status.LastChecked = w.lastChecked.UTC().Format(time.RFC3339)
+	}
+	if w.firing {
+		status.State = watchFiring
+		status.FiringSince = w.firedAt.UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+// formatWatchList formats the watch statuses into a readable string
+func formatWatchList(statuses []watchStatus, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw", "text":
+		if len(statuses) == 0 {
+			return "No watches registered", nil
+		}
+		var b strings.Builder
+		for _, s := range statuses {
+			value := strconv.FormatFloat(s.LastValue, 'f', -1, 64)
+			threshold := strconv.FormatFloat(s.Threshold, 'f', -1, 64)
+			if format == "raw" {
+				fmt.Fprintf(&b, "%s %s %s %s %s %s\n", s.ID, s.State, value, s.Condition, threshold, s.Query)
+				continue
+			}
+			name := s.ID
+			if s.Name != "" {
+				name += " (" + s.Name + ")"
+			}
+			fmt.Fprintf(&b, "%s: %s\n  %s %s %s, every %s\n  Last value: %s", name, s.State, s.Query, s.Condition, threshold, s.Interval, value)
+			if s.LastChecked != "" {
+				fmt.Fprintf(&b, " at %s", s.LastChecked)
+			}
+			b.WriteString("\n")
+			if s.FiringSince != "" {
+				fmt.Fprintf(&b, "  Firing since: %s\n", s.FiringSince)
+			}
+			if s.LastError != "" {
+				fmt.Fprintf(&b, "  Last error: %s\n", s.LastError)
+			}
+			for _, sink := range s.Sinks {
+				fmt.Fprintf(&b, "  Notifies: %s\n", sink)
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
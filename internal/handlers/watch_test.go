@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// countResult returns a metric result with a single sample
+func countResult(value string) *LokiMetricResult {
+	return &LokiMetricResult{Status: "success", Data: LokiMetricData{ResultType: "matrix", Result: []LokiMetricSeries{
+		{Metric: map[string]string{}, Values: [][]any{{float64(time.Now().Unix()), value}}},
+	}}}
+}
+
+// watchLokiClient returns a canned metric result and canned log lines
+type watchLokiClient struct {
+	metricLokiClient
+	lines []string
+}
+
+func (f *watchLokiClient) Query(ctx context.Context, conn LokiConnection, query string, start, end time.Time, limit int) (*LokiResult, error) {
+	stream := LokiEntry{Stream: map[string]string{"app": "api"}}
+	for i, line := range f.lines {
+		stream.Values = append(stream.Values, []string{strconv.Itoa(1700000000000000000 + i), line})
+	}
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{stream}}}, nil
+}
+
+// TestWatchExpression tests counting the lines of log queries
+func TestWatchExpression(t *testing.T) {
+	if expr := watchExpression(`{app="api"} |= "error"`, 5*time.Minute); expr != `sum(count_over_time({app="api"} |= "error" [5m]))` {
+		t.Errorf("Unexpected expression for a log query: %s", expr)
+	}
+	if expr := watchExpression(`sum(rate({app="api"}[1m]))`, 5*time.Minute); expr != `sum(rate({app="api"}[1m]))` {
+		t.Errorf("Expected a metric query to be unchanged, but got %s", expr)
+	}
+}
+
+// TestWatchLifecycle tests creating, triggering, listing and deleting a watch
+func TestWatchLifecycle(t *testing.T) {
+	fake := &watchLokiClient{metricLokiClient: metricLokiClient{result: countResult("3")}, lines: []string{"error: timeout"}}
+	SetLokiClient(fake)
+	t.Cleanup(func() { SetLokiClient(nil) })
+	t.Cleanup(StopWatches)
+
+	payloads := make(chan map[string]any, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer webhook.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"query":     `{app="api"} |= "error"`,
+		"threshold": float64(10),
+		"webhook":   webhook.URL,
+		"name":      "api errors",
+	}
+	result, err := HandleLokiWatchCreate(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "current value: 3") {
+		t.Errorf("Expected the current value in the result, but got %s", text)
+	}
+
+	list := watches.list("")
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 watch, but got %d", len(list))
+	}
+	w := list[0]
+
+	// Crossing the threshold fires the watch and calls the webhook once
+	fake.result = countResult("25")
+	w.check(context.Background())
+	w.check(context.Background())
+	select {
+	case payload := <-payloads:
+		if payload["state"] != watchFiring || payload["value"] != float64(25) || payload["name"] != "api errors" {
+			t.Errorf("Unexpected webhook payload: %v", payload)
+		}
+		if lines, _ := payload["lines"].([]any); len(lines) != 1 || lines[0] != "error: timeout" || payload["count"] != float64(25) {
+			t.Errorf("Expected the matched lines and count in the payload, but got %v", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the webhook to be called")
+	}
+	if status := w.status(); status.State != watchFiring || status.FiringSince == "" {
+		t.Errorf("Expected the watch to be firing, but got %+v", status)
+	}
+
+	// Dropping back below the threshold resolves it
+	fake.result = countResult("1")
+	w.check(context.Background())
+	if payload := <-payloads; payload["state"] != watchResolved {
+		t.Errorf("Expected a resolved notification, but got %v", payload)
+	}
+
+	request.Params.Arguments = map[string]any{"format": "raw"}
+	result, err = HandleLokiWatchList(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.HasPrefix(text, w.ID+" ok 1 > 10 ") {
+		t.Errorf("Unexpected watch list: %s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"id": w.ID}
+	if _, err := HandleLokiWatchDelete(context.Background(), request); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := HandleLokiWatchDelete(context.Background(), request); err == nil {
+		t.Error("Expected an error when deleting a missing watch")
+	}
+}
+
+// TestHandleLokiWatchCreate_Invalid tests rejecting invalid watch parameters
+func TestHandleLokiWatchCreate_Invalid(t *testing.T) {
+	testCases := map[string]map[string]any{
+		"missing threshold": {"query": `{app="api"}`},
+		"bad condition":     {"query": `{app="api"}`, "threshold": float64(1), "condition": "=="},
+		"short interval":    {"query": `{app="api"}`, "threshold": float64(1), "interval": "1s"},
+		"bad webhook":       {"query": `{app="api"}`, "threshold": float64(1), "webhook": "ftp://example.com"},
+		"missing key":       {"query": `{app="api"}`, "threshold": float64(1), "webhook_type": "pagerduty"},
+		"bad template":      {"query": `{app="api"}`, "threshold": float64(1), "webhook": "https://example.com", "template": "{{.Name"},
+	}
+	for name, args := range testCases {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = args
+		if _, err := HandleLokiWatchCreate(context.Background(), request); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestWatchSessionIsolation tests that sessions can't list or delete each other's watches
+func TestWatchSessionIsolation(t *testing.T) {
+	t.Cleanup(StopWatches)
+	other := &watch{Query: `sum(rate({app="secret"}[1m]))`, Condition: ">", Interval: time.Hour, CreatedAt: time.Now(), sessionID: "other"}
+	if err := watches.add(context.Background(), other); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"format": "raw"}
+	result, err := HandleLokiWatchList(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; text != "No watches registered" {
+		t.Errorf("Expected another session's watch to be hidden, but got %s", text)
+	}
+
+	request.Params.Arguments = map[string]any{"id": other.ID}
+	if _, err := HandleLokiWatchDelete(context.Background(), request); err == nil {
+		t.Error("Expected an error when deleting another session's watch")
+	}
+	if len(watches.list("other")) != 1 {
+		t.Error("Expected the other session's watch to be kept")
+	}
+}
+
+// TestWatchPollsWithCallerScope tests that background polls keep the access scope of the watch's creator
+func TestWatchPollsWithCallerScope(t *testing.T) {
+	t.Cleanup(StopWatches)
+	queries := make(chan string, 10)
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case queries <- r.URL.Query().Get("query"):
+		default:
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}))
+	t.Cleanup(loki.Close)
+
+	ctx := context.WithValue(context.Background(), accessScopeKey{}, &AccessRole{Labels: map[string]string{"namespace": "team-a-.*"}})
+	w := &watch{
+		Query:     `sum(count_over_time({app="web"} [5m]))`,
+		Condition: ">",
+		Interval:  10 * time.Millisecond,
+		Window:    5 * time.Minute,
+		CreatedAt: time.Now(),
+		conn:      LokiConnection{URL: loki.URL},
+	}
+	if err := watches.add(ctx, w); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	select {
+	case query := <-queries:
+		if !strings.Contains(query, `namespace=~"team-a-.*"`) {
+			t.Errorf("Expected the poll to be scoped to team-a, but got %s", query)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the watch to poll Loki")
+	}
+}
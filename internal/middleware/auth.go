@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Environment variable name for the bearer token required on incoming MCP HTTP connections
+const EnvAuthToken = "MCP_AUTH_TOKEN"
+
+// Environment variable name for the username required on incoming MCP HTTP connections
+const EnvAuthUsername = "MCP_AUTH_USERNAME"
+
+// Environment variable name for the password required on incoming MCP HTTP connections
+const EnvAuthPassword = "MCP_AUTH_PASSWORD"
+
+// AuthConfig holds the credentials clients must present to use the HTTP transports
+type AuthConfig struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// AuthConfigFromEnv reads the transport credentials from environment variables
+func AuthConfigFromEnv() AuthConfig {
+	return AuthConfig{
+		Token:    os.Getenv(EnvAuthToken),
+		Username: os.Getenv(EnvAuthUsername),
+		Password: os.Getenv(EnvAuthPassword),
+	}
+}
+
+// Enabled reports whether any credentials are configured
+func (c AuthConfig) Enabled() bool {
+	return c.Token != "" || c.Username != "" || c.Password != ""
+}
+
+// Auth rejects requests without a valid bearer token or basic auth credentials.
+// Requests pass through unchanged when no credentials are configured.
+func Auth(config AuthConfig, next http.Handler) http.Handler {
+	if !config.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.Authorized(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if config.Token != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="loki-mcp"`)
+		}
+		if config.Username != "" || config.Password != "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="loki-mcp"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// Authorized reports whether the request carries valid credentials
+func (c AuthConfig) Authorized(r *http.Request) bool {
+	if c.Token != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(token, c.Token) {
+			return true
+		}
+	}
+	if c.Username != "" || c.Password != "" {
+		if username, password, ok := r.BasicAuth(); ok && secureEqual(username, c.Username) && secureEqual(password, c.Password) {
+			return true
+		}
+	}
+	return false
+}
+
+// secureEqual compares two secrets in constant time
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
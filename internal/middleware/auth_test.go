@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// okHandler responds with 200 OK
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// TestAuth_BearerToken tests that requests need the configured bearer token
+func TestAuth_BearerToken(t *testing.T) {
+	handler := Auth(AuthConfig{Token: "secret"}, okHandler)
+
+	testCases := []struct {
+		name     string
+		header   string
+		expected int
+	}{
+		{"Valid token", "Bearer secret", http.StatusOK},
+		{"Wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"Missing header", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/sse", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.expected {
+				t.Errorf("Expected status %d, but got %d", tc.expected, rec.Code)
+			}
+		})
+	}
+}
+
+// TestAuth_BasicAuth tests that requests need the configured username and password
+func TestAuth_BasicAuth(t *testing.T) {
+	handler := Auth(AuthConfig{Username: "agent", Password: "pw"}, okHandler)
+
+	req := httptest.NewRequest("POST", "/stream", nil)
+	req.SetBasicAuth("agent", "pw")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, but got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/stream", nil)
+	req.SetBasicAuth("agent", "nope")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with WWW-Authenticate, but got %d", rec.Code)
+	}
+}
+
+// TestAuth_Disabled tests that requests pass through without configured credentials
+func TestAuth_Disabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Auth(AuthConfig{}, okHandler).ServeHTTP(rec, httptest.NewRequest("GET", "/sse", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Environment variable name for the comma-separated origins allowed to call the HTTP transports, or *
+const EnvCORSOrigins = "MCP_CORS_ORIGINS"
+
+// CORSOriginsFromEnv reads the allowed CORS origins from the environment
+func CORSOriginsFromEnv() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv(EnvCORSOrigins), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// CORS adds CORS headers for requests from allowed origins and answers preflight requests.
+// Without allowed origins no CORS headers are sent, so browsers block cross-origin calls.
+func CORS(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && (slices.Contains(origins, "*") || slices.Contains(origins, origin))
+
+		if allowed {
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Mcp-Session-Id, Mcp-Protocol-Version, Mcp-Resume-Session, Last-Event-ID")
+			h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			h.Set("Access-Control-Expose-Headers", "Mcp-Session-Id")
+		}
+
+		// Answer preflight requests before authentication, which browsers do not send them with
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCORS tests CORS headers and preflight handling for allowed and other origins
+func TestCORS(t *testing.T) {
+	handler := CORS([]string{"https://app.example.com"}, Auth(AuthConfig{Token: "secret"}, okHandler))
+
+	// Preflight from an allowed origin is answered without credentials
+	req := httptest.NewRequest("OPTIONS", "/stream", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, but got %d", rec.Code)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Unexpected Access-Control-Allow-Origin: %s", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// Preflight from another origin is rejected
+	req = httptest.NewRequest("OPTIONS", "/stream", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected 403 without CORS headers, but got %d", rec.Code)
+	}
+
+	// Actual requests still require authentication
+	req = httptest.NewRequest("POST", "/stream", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import "net/http"
+
+// Health answers Kubernetes probes ahead of authentication: /healthz reports that the process is
+// alive, and /readyz whether it accepts tool calls, failing once shutdown has started
+func Health(ready func() bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.Write([]byte("ok\n"))
+		case "/readyz":
+			if !ready() {
+				http.Error(w, "shutting down", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok\n"))
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
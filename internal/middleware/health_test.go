@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHealth tests answering probes without credentials and failing readiness while shutting down
+func TestHealth(t *testing.T) {
+	ready := true
+	handler := Health(func() bool { return ready }, Auth(AuthConfig{Token: "secret"}, okHandler))
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, but got %d", path, rec.Code)
+		}
+	}
+
+	ready = false
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while shutting down, but got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the process to stay live while shutting down, but got %d", rec.Code)
+	}
+
+	// Other paths still require authentication
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/stream", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, but got %d", rec.Code)
+	}
+}
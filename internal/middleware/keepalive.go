@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"os"
+	"time"
+)
+
+// Environment variable name for the interval between keep-alive pings on idle streams, e.g. 15s, or 0 to disable
+const EnvKeepAliveInterval = "MCP_KEEPALIVE_INTERVAL"
+
+// DefaultKeepAliveInterval is below the 30-60s idle timeouts common to proxies and load balancers
+const DefaultKeepAliveInterval = 15 * time.Second
+
+// KeepAliveIntervalFromEnv reads the keep-alive interval from the environment
+func KeepAliveIntervalFromEnv() time.Duration {
+	if value := os.Getenv(EnvKeepAliveInterval); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return DefaultKeepAliveInterval
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Environment variable names for where the HTTP transports listen
+const (
+	// EnvListenAddr is the host or IP address to listen on, empty for all interfaces
+	EnvListenAddr = "MCP_LISTEN_ADDR"
+	// EnvPort is the port to listen on
+	EnvPort = "PORT"
+	// EnvBasePath is the URL path the endpoints are served under, e.g. /loki-mcp behind a reverse proxy
+	EnvBasePath = "MCP_BASE_PATH"
+	// EnvGRPCPort is the port the gRPC interface listens on, empty to not serve it
+	EnvGRPCPort = "MCP_GRPC_PORT"
+)
+
+// DefaultPort is the port the HTTP transports listen on unless configured
+const DefaultPort = "8080"
+
+// ListenConfig is where the HTTP transports listen and the URL path their endpoints are served
+// under, and the port of the gRPC interface
+type ListenConfig struct {
+	Host     string
+	Port     string
+	BasePath string
+	GRPCPort string
+}
+
+// ListenConfigFromEnv reads the listen address, port and base path from the environment
+func ListenConfigFromEnv() ListenConfig {
+	c := ListenConfig{
+		Host:     strings.TrimSpace(os.Getenv(EnvListenAddr)),
+		Port:     strings.TrimSpace(os.Getenv(EnvPort)),
+		BasePath: NormalizeBasePath(os.Getenv(EnvBasePath)),
+		GRPCPort: strings.TrimSpace(os.Getenv(EnvGRPCPort)),
+	}
+	if c.Port == "" {
+		c.Port = DefaultPort
+	}
+	return c
+}
+
+// Addr returns the address to listen on, e.g. 127.0.0.1:8080 or :8080
+func (c ListenConfig) Addr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// GRPCAddr returns the address the gRPC interface listens on, or an empty string when it is not served
+func (c ListenConfig) GRPCAddr() string {
+	if c.GRPCPort == "" {
+		return ""
+	}
+	return net.JoinHostPort(c.Host, c.GRPCPort)
+}
+
+// URL returns the URL of an endpoint for log messages, using localhost when listening on all
+// interfaces
+func (c ListenConfig) URL(endpoint string) string {
+	host := c.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, c.Port) + c.BasePath + endpoint
+}
+
+// NormalizeBasePath cleans a base path to start with a slash and not end with one, returning an
+// empty string for the root
+func NormalizeBasePath(basePath string) string {
+	basePath = strings.TrimSpace(basePath)
+	if basePath == "" {
+		return ""
+	}
+	basePath = path.Clean("/" + basePath)
+	if basePath == "/" {
+		return ""
+	}
+	return basePath
+}
+
+// BasePath serves the endpoints under a base path by removing it from request paths. Requests
+// without the base path are served as they are, so the server works behind reverse proxies that
+// strip the prefix as well as those forwarding it.
+func BasePath(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, basePath)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if rest == "" {
+			rest = "/"
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = rest
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestListenConfigFromEnv tests reading the listen address, port and base path
+func TestListenConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvListenAddr, "")
+	t.Setenv(EnvPort, "")
+	t.Setenv(EnvBasePath, "")
+	t.Setenv(EnvGRPCPort, "")
+	c := ListenConfigFromEnv()
+	if c.Addr() != ":8080" || c.BasePath != "" || c.URL("/sse") != "http://localhost:8080/sse" || c.GRPCAddr() != "" {
+		t.Errorf("Unexpected defaults: %+v", c)
+	}
+
+	t.Setenv(EnvListenAddr, "127.0.0.1")
+	t.Setenv(EnvPort, "9090")
+	t.Setenv(EnvBasePath, "loki-mcp/")
+	t.Setenv(EnvGRPCPort, "9095")
+	c = ListenConfigFromEnv()
+	if c.Addr() != "127.0.0.1:9090" || c.BasePath != "/loki-mcp" || c.URL("/stream") != "http://127.0.0.1:9090/loki-mcp/stream" || c.GRPCAddr() != "127.0.0.1:9095" {
+		t.Errorf("Unexpected config: %+v", c)
+	}
+
+	t.Setenv(EnvListenAddr, "::1")
+	if addr := ListenConfigFromEnv().Addr(); addr != "[::1]:9090" {
+		t.Errorf("Expected a bracketed IPv6 address, but got %s", addr)
+	}
+}
+
+// TestNormalizeBasePath tests cleaning base paths
+func TestNormalizeBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"/":               "",
+		"loki-mcp":        "/loki-mcp",
+		"/loki-mcp/":      "/loki-mcp",
+		" /tools//loki/ ": "/tools/loki",
+	}
+	for basePath, want := range tests {
+		if got := NormalizeBasePath(basePath); got != want {
+			t.Errorf("NormalizeBasePath(%q) = %q, want %q", basePath, got, want)
+		}
+	}
+}
+
+// TestBasePath tests serving endpoints behind proxies that forward or strip the base path
+func TestBasePath(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/stream", okHandler)
+	handler := BasePath("/loki-mcp", Health(func() bool { return true }, mux))
+
+	tests := map[string]int{
+		"/loki-mcp/stream":  http.StatusOK,
+		"/loki-mcp/healthz": http.StatusOK,
+		"/stream":           http.StatusOK,
+		"/loki-mcpx/stream": http.StatusNotFound,
+		"/loki-mcp/sse":     http.StatusNotFound,
+	}
+	for path, want := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected status %d, but got %d", path, want, rec.Code)
+		}
+	}
+}
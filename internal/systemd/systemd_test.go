@@ -0,0 +1,66 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestNotify tests sending states to the notification socket
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Errorf("Expected nothing to be sent without NOTIFY_SOCKET, but got %v, %v", sent, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if sent, err := Notify(Ready); !sent || err != nil {
+		t.Fatalf("Expected the state to be sent, but got %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != Ready {
+		t.Errorf("Expected %q, but got %q (%v)", Ready, buf[:n], err)
+	}
+}
+
+// TestListeners tests ignoring socket activation variables meant for another process
+func TestListeners(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := Listeners()
+	if err != nil || len(listeners) != 0 {
+		t.Errorf("Expected no listeners, but got %v, %v", listeners, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("Expected LISTEN_FDS to be unset")
+	}
+}
+
+// TestWatchdogInterval tests reading the watchdog interval for this process
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if interval := WatchdogInterval(); interval != 30*time.Second {
+		t.Errorf("Expected 30s, but got %s", interval)
+	}
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if interval := WatchdogInterval(); interval != 0 {
+		t.Errorf("Expected no watchdog for another process, but got %s", interval)
+	}
+}
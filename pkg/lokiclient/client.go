@@ -0,0 +1,246 @@
+// Package lokiclient is a client for the Grafana Loki HTTP API.
+//
+// It handles locating the API under a base URL (including reverse proxies and
+// gateways that mount Loki under a sub-path), authentication with basic auth or
+// bearer tokens, multi-tenancy through X-Scope-OrgID, and sending long queries as
+// form-encoded POST requests.
+//
+//	client := lokiclient.New("http://localhost:3100", lokiclient.Credentials{OrgID: "tenant-1"})
+//	result, err := client.Query(ctx, `{app="api"} |= "error"`, time.Now().Add(-time.Hour), time.Now(), 100)
+package lokiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultTimeout is the request timeout of clients created with New
+const DefaultTimeout = 30 * time.Second
+
+// Credentials holds the authentication and tenant settings sent with every request
+type Credentials struct {
+	Username string
+	Password string
+	Token    string // bearer token, used instead of basic auth when set
+	OrgID    string // tenant sent in the X-Scope-OrgID header
+}
+
+// Apply adds the authentication and tenant headers to a request
+func (c Credentials) Apply(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	if c.OrgID != "" {
+		req.Header.Add("X-Scope-OrgID", c.OrgID)
+	}
+}
+
+// Client calls the Loki HTTP API of a single Loki server
+type Client struct {
+	// BaseURL is the Loki server URL, e.g. http://localhost:3100
+	BaseURL string
+	Credentials
+
+	// APIPrefix is the path below BaseURL where the API lives, see SetAPIPath
+	APIPrefix string
+	// MaxURLLength is the URL length above which query requests are sent as POST, see NewRequest
+	MaxURLLength int
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// New creates a client for the Loki server at baseURL
+func New(baseURL string, credentials Credentials) *Client {
+	return &Client{
+		BaseURL:      baseURL,
+		Credentials:  credentials,
+		MaxURLLength: DefaultMaxURLLength,
+		HTTPClient:   &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// URL returns the URL of an API endpoint such as "query_range" with the given parameters
+func (c *Client) URL(endpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	SetAPIPath(u, endpoint, c.APIPrefix)
+
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Do sends an authenticated request to a Loki API URL and returns the response body.
+// Responses with a status other than 200 OK are returned as a *StatusError.
+func (c *Client) Do(ctx context.Context, requestURL string) ([]byte, error) {
+	req, err := NewRequest(ctx, requestURL, c.MaxURLLength)
+	if err != nil {
+		return nil, err
+	}
+	c.Apply(req)
+
+	return c.send(req)
+}
+
+// send executes a request, returning the body of a 2xx response
+func (c *Client) send(req *http.Request) ([]byte, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK && (req.Method != http.MethodPost || resp.StatusCode != http.StatusNoContent) {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: body}
+	}
+
+	return body, nil
+}
+
+// get requests an API endpoint and decodes the JSON response into result
+func (c *Client) get(ctx context.Context, endpoint string, params url.Values, result any) error {
+	requestURL, err := c.URL(endpoint, params)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.Do(ctx, requestURL)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// Query runs a LogQL log query over the given window, returning at most limit entries. The window
+// is sent in nanoseconds, so the timestamp of the oldest entry returned can be used as the end of
+// the next page.
+func (c *Client) Query(ctx context.Context, query string, start, end time.Time, limit int) (*QueryResult, error) {
+	var result QueryResult
+	if err := c.get(ctx, "query_range", url.Values{
+		"query": {query},
+		"start": {strconv.FormatInt(start.UnixNano(), 10)},
+		"end":   {strconv.FormatInt(end.UnixNano(), 10)},
+		"limit": {strconv.Itoa(limit)},
+	}, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "error" {
+		return nil, &APIError{Message: result.Error}
+	}
+	return &result, nil
+}
+
+// MetricQuery runs a LogQL metric query over the given window, evaluated at step
+func (c *Client) MetricQuery(ctx context.Context, query string, start, end time.Time, step time.Duration) (*MetricResult, error) {
+	var result MetricResult
+	if err := c.get(ctx, "query_range", url.Values{
+		"query": {query},
+		"start": {strconv.FormatInt(start.Unix(), 10)},
+		"end":   {strconv.FormatInt(end.Unix(), 10)},
+		"step":  {strconv.FormatInt(int64(step.Seconds()), 10)},
+	}, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "error" {
+		return nil, &APIError{Message: result.Error}
+	}
+	return &result, nil
+}
+
+// Labels returns the label names seen in the given window
+func (c *Client) Labels(ctx context.Context, start, end time.Time) ([]string, error) {
+	return c.stringList(ctx, "labels", url.Values{
+		"start": {strconv.FormatInt(start.Unix(), 10)},
+		"end":   {strconv.FormatInt(end.Unix(), 10)},
+	})
+}
+
+// LabelValues returns the values of a label seen in the given window
+func (c *Client) LabelValues(ctx context.Context, label string, start, end time.Time) ([]string, error) {
+	return c.stringList(ctx, "label/"+label+"/values", url.Values{
+		"start": {strconv.FormatInt(start.Unix(), 10)},
+		"end":   {strconv.FormatInt(end.Unix(), 10)},
+	})
+}
+
+// stringList requests an endpoint returning a list of strings
+func (c *Client) stringList(ctx context.Context, endpoint string, params url.Values) ([]string, error) {
+	var result struct {
+		Status string   `json:"status"`
+		Data   []string `json:"data"`
+		Error  string   `json:"error,omitempty"`
+	}
+	if err := c.get(ctx, endpoint, params, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "error" {
+		return nil, &APIError{Message: result.Error}
+	}
+	return result.Data, nil
+}
+
+// Series returns the label sets of the streams matching a selector in the given window
+func (c *Client) Series(ctx context.Context, selector string, start, end time.Time) ([]map[string]string, error) {
+	var result SeriesResult
+	if err := c.get(ctx, "series", url.Values{
+		"match[]": {selector},
+		"start":   {strconv.FormatInt(start.Unix(), 10)},
+		"end":     {strconv.FormatInt(end.Unix(), 10)},
+	}, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "error" {
+		return nil, &APIError{Message: result.Error}
+	}
+	return result.Data, nil
+}
+
+// Push sends log lines to Loki
+func (c *Client) Push(ctx context.Context, streams []PushStream) error {
+	pushURL, err := c.URL("push", nil)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(PushRequest{Streams: streams})
+	if err != nil {
+		return fmt.Errorf("failed to marshal push request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pushURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.Apply(req)
+
+	_, err = c.send(req)
+	return err
+}
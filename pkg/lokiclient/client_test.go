@@ -0,0 +1,118 @@
+package lokiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestClient_Query tests log queries, including authentication and tenant headers
+func TestClient_Query(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/query_range" {
+			t.Errorf("Expected path /loki/api/v1/query_range, but got %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("query") != `{app="api"}` || r.URL.Query().Get("limit") != "10" {
+			t.Errorf("Unexpected query parameters: %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Scope-OrgID") != "tenant-1" {
+			t.Errorf("Expected auth and tenant headers, but got %v", r.Header)
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[["1","hello"]]}]}}`))
+	}))
+	defer server.Close()
+
+	client := New(server.URL, Credentials{Token: "secret", OrgID: "tenant-1"})
+	result, err := client.Query(context.Background(), `{app="api"}`, time.Unix(1, 0), time.Unix(2, 0), 10)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(result.Data.Result) != 1 || result.Data.Result[0].Values[0][1] != "hello" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+// TestClient_LabelsAndSeries tests the label and series endpoints with basic auth
+func TestClient_LabelsAndSeries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pw" {
+			t.Error("Expected basic auth credentials")
+		}
+		switch r.URL.Path {
+		case "/loki/api/v1/labels":
+			w.Write([]byte(`{"status":"success","data":["app","pod"]}`))
+		case "/loki/api/v1/label/app/values":
+			w.Write([]byte(`{"status":"success","data":["api"]}`))
+		case "/loki/api/v1/series":
+			w.Write([]byte(`{"status":"success","data":[{"app":"api","pod":"api-1"}]}`))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL, Credentials{Username: "user", Password: "pw"})
+	ctx := context.Background()
+	start, end := time.Unix(1, 0), time.Unix(2, 0)
+
+	if labels, err := client.Labels(ctx, start, end); err != nil || len(labels) != 2 {
+		t.Errorf("Expected 2 labels, but got %v (%v)", labels, err)
+	}
+	if values, err := client.LabelValues(ctx, "app", start, end); err != nil || len(values) != 1 || values[0] != "api" {
+		t.Errorf("Expected [api], but got %v (%v)", values, err)
+	}
+	if series, err := client.Series(ctx, `{app="api"}`, start, end); err != nil || len(series) != 1 || series[0]["pod"] != "api-1" {
+		t.Errorf("Expected one series, but got %v (%v)", series, err)
+	}
+}
+
+// TestClient_Push tests pushing log lines
+func TestClient_Push(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("Expected POST /loki/api/v1/push, but got %s %s", r.Method, r.URL.Path)
+		}
+		var push PushRequest
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil || len(push.Streams) != 1 || push.Streams[0].Values[0][1] != "hello" {
+			t.Errorf("Unexpected push body: %+v (%v)", push, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := New(server.URL, Credentials{}).Push(context.Background(), []PushStream{
+		{Stream: map[string]string{"app": "api"}, Values: [][2]string{{"1000", "hello"}}},
+	})
+	if err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+}
+
+// TestClient_Errors tests HTTP and Loki errors
+func TestClient_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loki/api/v1/labels" {
+			w.Write([]byte(`{"status":"error","error":"bad request"}`))
+			return
+		}
+		http.Error(w, "parse error", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, Credentials{})
+	_, err := client.Query(context.Background(), "{", time.Unix(1, 0), time.Unix(2, 0), 10)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a 400 StatusError, but got %v", err)
+	}
+
+	_, err = client.Labels(context.Background(), time.Unix(1, 0), time.Unix(2, 0))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "bad request" {
+		t.Errorf("Expected an APIError, but got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package lokiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMaxURLLength is the URL length above which query requests are sent as POST
+// form submissions, safely below the 8KB request line limit of common proxies and gateways
+const DefaultMaxURLLength = 4096
+
+// NewRequest creates a GET request for a Loki API URL. Query endpoints whose URL
+// exceeds maxURLLength are sent as a POST with a form-encoded body instead.
+func NewRequest(ctx context.Context, requestURL string, maxURLLength int) (*http.Request, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxURLLength <= 0 {
+		maxURLLength = DefaultMaxURLLength
+	}
+	if len(requestURL) <= maxURLLength || !SupportsFormPost(u.Path) {
+		return http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	}
+
+	form := u.RawQuery
+	u.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(form))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// SupportsFormPost reports whether a Loki API path accepts form-encoded POST requests
+func SupportsFormPost(path string) bool {
+	for _, endpoint := range []string{"/query_range", "/query", "/series"} {
+		if strings.HasSuffix(path, endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAPIPath points u at a Loki API endpoint such as "query_range".
+//
+// With an empty prefix, /loki/api/v1/<endpoint> is appended to the URL's path unless
+// the path already contains loki/api/v1. Otherwise the prefix is appended to the URL's
+// path, and may be a template containing {endpoint}, e.g.
+// /api/datasources/proxy/uid/loki/loki/api/v1/{endpoint}.
+func SetAPIPath(u *url.URL, endpoint, prefix string) {
+	prefix = strings.TrimSpace(prefix)
+	u.RawPath = ""
+
+	if prefix != "" {
+		var path string
+		if strings.Contains(prefix, "{endpoint}") {
+			path = strings.ReplaceAll(prefix, "{endpoint}", endpoint)
+		} else {
+			path = strings.TrimRight(prefix, "/") + "/" + endpoint
+		}
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + strings.TrimLeft(path, "/")
+		return
+	}
+
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/" + endpoint
+		} else {
+			u.Path = u.Path + "/loki/api/v1/" + endpoint
+		}
+		return
+	}
+
+	// If the path already contains loki/api/v1, just append the endpoint if not present
+	if !strings.HasSuffix(u.Path, endpoint) {
+		u.Path = u.Path + "/" + endpoint
+	}
+}
@@ -0,0 +1,57 @@
+package lokiclient
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestSetAPIPath tests locating API endpoints below base URLs and prefixes
+func TestSetAPIPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		baseURL  string
+		prefix   string
+		expected string
+	}{
+		{"Root URL", "http://loki:3100", "", "http://loki:3100/loki/api/v1/labels"},
+		{"Sub-path", "http://gateway/loki-a", "", "http://gateway/loki-a/loki/api/v1/labels"},
+		{"API path included", "http://loki:3100/loki/api/v1", "", "http://loki:3100/loki/api/v1/labels"},
+		{"Prefix", "http://grafana", "/api/datasources/proxy/uid/loki/loki/api/v1", "http://grafana/api/datasources/proxy/uid/loki/loki/api/v1/labels"},
+		{"Prefix template", "http://grafana", "/proxy/{endpoint}/v1", "http://grafana/proxy/labels/v1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, _ := url.Parse(tc.baseURL)
+			SetAPIPath(u, "labels", tc.prefix)
+			if u.String() != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, u.String())
+			}
+		})
+	}
+}
+
+// TestNewRequest tests that long query URLs are sent as form-encoded POST requests
+func TestNewRequest(t *testing.T) {
+	longURL := "http://loki:3100/loki/api/v1/query_range?query=" + strings.Repeat("a", 100)
+
+	req, err := NewRequest(context.Background(), longURL, 1000)
+	if err != nil || req.Method != "GET" {
+		t.Fatalf("Expected a GET request, but got %v (%v)", req, err)
+	}
+
+	req, err = NewRequest(context.Background(), longURL, 50)
+	if err != nil || req.Method != "POST" || req.URL.RawQuery != "" {
+		t.Fatalf("Expected a POST request without query string, but got %v (%v)", req, err)
+	}
+	if req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("Expected form content type, but got %s", req.Header.Get("Content-Type"))
+	}
+
+	labelsURL := "http://loki:3100/loki/api/v1/labels?start=" + strings.Repeat("1", 100)
+	if req, _ = NewRequest(context.Background(), labelsURL, 50); req.Method != "GET" {
+		t.Errorf("Expected labels requests to stay GET, but got %s", req.Method)
+	}
+}
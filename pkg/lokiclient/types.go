@@ -0,0 +1,84 @@
+package lokiclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryResult is the response of a LogQL log query
+type QueryResult struct {
+	Status string    `json:"status"`
+	Data   QueryData `json:"data"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// QueryData is the data portion of a log query response
+type QueryData struct {
+	ResultType string   `json:"resultType"`
+	Result     []Stream `json:"result"`
+}
+
+// Stream is a log stream with its entries
+type Stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]string        `json:"values"` // [timestamp, log line]
+}
+
+// MetricResult is the response of a LogQL metric query
+type MetricResult struct {
+	Status string     `json:"status"`
+	Data   MetricData `json:"data"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// MetricData is the data portion of a metric query response
+type MetricData struct {
+	ResultType string         `json:"resultType"`
+	Result     []MetricSeries `json:"result"`
+}
+
+// MetricSeries is a single series of a metric query
+type MetricSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]any           `json:"values,omitempty"` // [unix seconds, "value"] for matrix results
+	Value  []any             `json:"value,omitempty"`  // [unix seconds, "value"] for vector results
+}
+
+// SeriesResult is the response of the series endpoint
+type SeriesResult struct {
+	Status string              `json:"status"`
+	Data   []map[string]string `json:"data"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// PushRequest is the body of a push request
+type PushRequest struct {
+	Streams []PushStream `json:"streams"`
+}
+
+// PushStream is a set of log lines pushed with the same labels
+type PushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // [unix nanoseconds, log line]
+}
+
+// StatusError is returned when Loki responds with an unexpected HTTP status
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP error %d: %s", e.StatusCode, strings.TrimSpace(string(e.Body)))
+}
+
+// APIError is returned when Loki responds with status "error"
+type APIError struct {
+	Message string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return "loki error: " + e.Message
+}